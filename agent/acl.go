@@ -127,6 +127,8 @@ func (m *aclManager) isDisabled() bool {
 // token. The agent may be used to perform RPC calls to the servers to fetch
 // policies that aren't in the cache.
 func (m *aclManager) lookupACL(a *Agent, id string) (acl.ACL, error) {
+	cfg := a.RuntimeConfig()
+
 	// Handle some special cases for the ID.
 	if len(id) == 0 {
 		id = anonymousToken
@@ -150,7 +152,7 @@ func (m *aclManager) lookupACL(a *Agent, id string) (acl.ACL, error) {
 	// At this point we might have a stale cached ACL, or none at all, so
 	// try to contact the servers.
 	args := structs.ACLPolicyRequest{
-		Datacenter: a.config.ACLDatacenter,
+		Datacenter: cfg.ACLDatacenter,
 		ACL:        id,
 	}
 	if cached != nil {
@@ -160,9 +162,9 @@ func (m *aclManager) lookupACL(a *Agent, id string) (acl.ACL, error) {
 	err := a.RPC("ACL.GetPolicy", &args, &reply)
 	if err != nil {
 		if acl.IsErrDisabled(err) {
-			a.logger.Printf("[DEBUG] agent: ACLs disabled on servers, will check again after %s", a.config.ACLDisabledTTL)
+			a.logger.Printf("[DEBUG] agent: ACLs disabled on servers, will check again after %s", cfg.ACLDisabledTTL)
 			m.disabledLock.Lock()
-			m.disabled = time.Now().Add(a.config.ACLDisabledTTL)
+			m.disabled = time.Now().Add(cfg.ACLDisabledTTL)
 			m.disabledLock.Unlock()
 			return nil, nil
 		} else if acl.IsErrNotFound(err) {
@@ -217,14 +219,16 @@ func (m *aclManager) lookupACL(a *Agent, id string) (acl.ACL, error) {
 // clients. Some of the enforcement is normative (e.g. self and monitor)
 // and some is informative (e.g. catalog and health).
 func (a *Agent) resolveToken(id string) (acl.ACL, error) {
+	cfg := a.RuntimeConfig()
+
 	// Disable ACLs if version 8 enforcement isn't enabled.
-	if !(*a.config.ACLEnforceVersion8) {
+	if !(*cfg.ACLEnforceVersion8) {
 		return nil, nil
 	}
 
 	// Bail if there's no ACL datacenter configured. This means that agent
 	// enforcement isn't on.
-	if a.config.ACLDatacenter == "" {
+	if cfg.ACLDatacenter == "" {
 		return nil, nil
 	}
 
@@ -294,6 +298,8 @@ func (a *Agent) vetServiceUpdate(token string, serviceID string) error {
 // vetCheckRegister makes sure the check registration action is allowed by the
 // given token.
 func (a *Agent) vetCheckRegister(token string, check *structs.HealthCheck) error {
+	cfg := a.RuntimeConfig()
+
 	// Resolve the token and bail if ACLs aren't enabled.
 	rule, err := a.resolveToken(token)
 	if err != nil {
@@ -309,7 +315,7 @@ func (a *Agent) vetCheckRegister(token string, check *structs.HealthCheck) error
 			return acl.ErrPermissionDenied
 		}
 	} else {
-		if !rule.NodeWrite(a.config.NodeName) {
+		if !rule.NodeWrite(cfg.NodeName) {
 			return acl.ErrPermissionDenied
 		}
 	}
@@ -322,7 +328,7 @@ func (a *Agent) vetCheckRegister(token string, check *structs.HealthCheck) error
 				return acl.ErrPermissionDenied
 			}
 		} else {
-			if !rule.NodeWrite(a.config.NodeName) {
+			if !rule.NodeWrite(cfg.NodeName) {
 				return acl.ErrPermissionDenied
 			}
 		}
@@ -350,7 +356,7 @@ func (a *Agent) vetCheckUpdate(token string, checkID types.CheckID) error {
 				return acl.ErrPermissionDenied
 			}
 		} else {
-			if !rule.NodeWrite(a.config.NodeName) {
+			if !rule.NodeWrite(a.RuntimeConfig().NodeName) {
 				return acl.ErrPermissionDenied
 			}
 		}
@@ -427,7 +433,7 @@ func (a *Agent) filterChecks(token string, checks *map[types.CheckID]*structs.He
 				continue
 			}
 		} else {
-			if rule.NodeRead(a.config.NodeName) {
+			if rule.NodeRead(a.RuntimeConfig().NodeName) {
 				continue
 			}
 		}
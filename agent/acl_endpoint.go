@@ -30,7 +30,7 @@ func (s *HTTPServer) ACLBootstrap(resp http.ResponseWriter, req *http.Request) (
 	}
 
 	args := structs.DCSpecificRequest{
-		Datacenter: s.agent.config.ACLDatacenter,
+		Datacenter: s.agent.RuntimeConfig().ACLDatacenter,
 	}
 
 	var out structs.ACL
@@ -56,7 +56,7 @@ func (s *HTTPServer) ACLDestroy(resp http.ResponseWriter, req *http.Request) (in
 	}
 
 	args := structs.ACLRequest{
-		Datacenter: s.agent.config.ACLDatacenter,
+		Datacenter: s.agent.RuntimeConfig().ACLDatacenter,
 		Op:         structs.ACLDelete,
 	}
 	s.parseToken(req, &args.Token)
@@ -92,7 +92,7 @@ func (s *HTTPServer) aclSet(resp http.ResponseWriter, req *http.Request, update
 	}
 
 	args := structs.ACLRequest{
-		Datacenter: s.agent.config.ACLDatacenter,
+		Datacenter: s.agent.RuntimeConfig().ACLDatacenter,
 		Op:         structs.ACLSet,
 		ACL: structs.ACL{
 			Type: structs.ACLTypeClient,
@@ -135,7 +135,7 @@ func (s *HTTPServer) ACLClone(resp http.ResponseWriter, req *http.Request) (inte
 	}
 
 	args := structs.ACLSpecificRequest{
-		Datacenter: s.agent.config.ACLDatacenter,
+		Datacenter: s.agent.RuntimeConfig().ACLDatacenter,
 	}
 	var dc string
 	if done := s.parse(resp, req, &dc, &args.QueryOptions); done {
@@ -183,7 +183,7 @@ func (s *HTTPServer) ACLClone(resp http.ResponseWriter, req *http.Request) (inte
 
 func (s *HTTPServer) ACLGet(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
 	args := structs.ACLSpecificRequest{
-		Datacenter: s.agent.config.ACLDatacenter,
+		Datacenter: s.agent.RuntimeConfig().ACLDatacenter,
 	}
 	var dc string
 	if done := s.parse(resp, req, &dc, &args.QueryOptions); done {
@@ -213,7 +213,7 @@ func (s *HTTPServer) ACLGet(resp http.ResponseWriter, req *http.Request) (interf
 
 func (s *HTTPServer) ACLList(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
 	args := structs.DCSpecificRequest{
-		Datacenter: s.agent.config.ACLDatacenter,
+		Datacenter: s.agent.RuntimeConfig().ACLDatacenter,
 	}
 	var dc string
 	if done := s.parse(resp, req, &dc, &args.QueryOptions); done {
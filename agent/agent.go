@@ -13,9 +13,11 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/armon/go-metrics"
@@ -31,6 +33,7 @@ import (
 	"github.com/hashicorp/consul/types"
 	"github.com/hashicorp/consul/watch"
 	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/memberlist"
 	"github.com/hashicorp/raft"
 	"github.com/hashicorp/serf/coordinate"
 	"github.com/hashicorp/serf/serf"
@@ -80,8 +83,13 @@ type notifier interface {
 // mode, it runs a full Consul server. In client-only mode, it only forwards
 // requests to other Consul servers.
 type Agent struct {
-	// config is the agent configuration.
-	config *Config
+	// config holds the *Config the agent is running with. It is replaced
+	// as a whole on reload and must be accessed via RuntimeConfig.
+	config atomic.Value
+
+	// configHooks are the functions called after a reload changed the
+	// configuration.
+	configHooks configHooks
 
 	// Used for writing our logs
 	logger *log.Logger
@@ -145,6 +153,12 @@ type Agent struct {
 
 	reloadCh chan chan error
 
+	// secretFiles are the files referenced by file secret references in
+	// the current configuration. They are watched for changes so that
+	// rotated secrets trigger a reload.
+	secretFiles     []string
+	secretFilesLock sync.Mutex
+
 	shutdown     bool
 	shutdownCh   chan struct{}
 	shutdownLock sync.Mutex
@@ -181,6 +195,28 @@ type Agent struct {
 	// agent.
 	watchPlans []*watch.Plan
 
+	// auditLog records HTTP API requests. It is nil if audit logging is
+	// disabled.
+	auditLog *auditLog
+
+	// dataDirCipher encrypts sensitive state written to the data
+	// directory. It is nil if data directory encryption is disabled.
+	dataDirCipher *dataDirCipher
+
+	// keyrings maps the paths of encrypted keyring files to the keyrings
+	// they were loaded into, so that changes can be persisted.
+	// keyringsWritten holds the keys last written to each file and
+	// keyringLock serializes the writes of the files.
+	keyrings        map[string]*memberlist.Keyring
+	keyringsWritten map[string][]string
+	keyringLock     sync.Mutex
+
+	// configServices and configChecks are the service and check
+	// definitions from the configuration which are registered, so that a
+	// reload only needs to register the definitions which changed.
+	configServices map[string]*structs.ServiceDefinition
+	configChecks   map[types.CheckID]*structs.CheckDefinition
+
 	// tokens holds ACL tokens initially from the configuration, but can
 	// be updated at runtime, so should always be used instead of going to
 	// the configuration directly.
@@ -206,9 +242,16 @@ func New(c *Config) (*Agent, error) {
 	if err != nil {
 		return nil, err
 	}
+	var ddc *dataDirCipher
+	if key, err := c.DataDirEncryptionKey(); err != nil {
+		return nil, err
+	} else if key != nil {
+		if ddc, err = newDataDirCipher(key); err != nil {
+			return nil, fmt.Errorf("Invalid data_dir_encryption key: %v", err)
+		}
+	}
 
 	a := &Agent{
-		config:          c,
 		acls:            acls,
 		checkReapAfter:  make(map[types.CheckID]time.Duration),
 		checkMonitors:   make(map[types.CheckID]*CheckMonitor),
@@ -225,20 +268,37 @@ func New(c *Config) (*Agent, error) {
 		endpoints:       make(map[string]string),
 		dnsAddrs:        dnsAddrs,
 		httpAddrs:       httpAddrs,
+		dataDirCipher:   ddc,
 		tokens:          new(token.Store),
 	}
+	a.config.Store(c)
 
 	// Set up the initial state of the token store based on the config.
-	a.tokens.UpdateUserToken(a.config.ACLToken)
-	a.tokens.UpdateAgentToken(a.config.ACLAgentToken)
-	a.tokens.UpdateAgentMasterToken(a.config.ACLAgentMasterToken)
-	a.tokens.UpdateACLReplicationToken(a.config.ACLReplicationToken)
+	a.tokens.UpdateUserToken(c.ACLToken)
+	a.tokens.UpdateAgentToken(c.ACLAgentToken)
+	a.tokens.UpdateAgentMasterToken(c.ACLAgentMasterToken)
+	a.tokens.UpdateACLReplicationToken(c.ACLReplicationToken)
+
+	// Update filtered metrics on reload.
+	a.OnConfigChange(func(old, new *Config, changed map[string]bool) {
+		if changed["telemetry.prefix_filter"] {
+			metrics.UpdateFilter(new.Telemetry.AllowedPrefixes, new.Telemetry.BlockedPrefixes)
+		}
+	})
 
 	return a, nil
 }
 
+// RuntimeConfig returns the configuration the agent is running with. The
+// configuration must not be modified since it is shared with concurrent
+// readers. ReloadConfig replaces it as a whole so that readers never
+// observe a partially applied reload.
+func (a *Agent) RuntimeConfig() *Config {
+	return a.config.Load().(*Config)
+}
+
 func (a *Agent) Start() error {
-	c := a.config
+	c := a.RuntimeConfig()
 
 	logOutput := a.LogOutput
 	if a.logger == nil {
@@ -295,6 +355,9 @@ func (a *Agent) Start() error {
 	if err := a.loadMetadata(c); err != nil {
 		return err
 	}
+	if c.StartInMaintenance {
+		a.EnableNodeMaintenance(c.StartInMaintenanceReason, "")
+	}
 
 	// Start watching for critical services to deregister, based on their
 	// checks.
@@ -303,6 +366,17 @@ func (a *Agent) Start() error {
 	// Start handling events.
 	go a.handleEvents()
 
+	// Start persisting the changes other agents make to the encrypted
+	// keyrings.
+	go a.watchKeyrings()
+
+	// Start rotating the gossip key if configured.
+	go a.rotateGossipKeys()
+
+	// Start watching the files referenced by secret references.
+	a.setSecretFiles(c)
+	go a.watchSecretFiles()
+
 	// Start sending network coordinate to the server.
 	if !c.DisableCoordinates {
 		go a.sendCoordinate()
@@ -318,6 +392,13 @@ func (a *Agent) Start() error {
 		return err
 	}
 
+	// open the audit log before serving any HTTP requests
+	if c.Audit.Enabled {
+		if a.auditLog, err = newAuditLog(c.Audit.Sink); err != nil {
+			return err
+		}
+	}
+
 	// create listeners and unstarted servers
 	// see comment on listenHTTP why we are doing this
 	httpln, err := a.listenHTTP(a.httpAddrs)
@@ -327,7 +408,10 @@ func (a *Agent) Start() error {
 
 	// start HTTP servers
 	for _, l := range httpln {
-		srv := NewHTTPServer(l.Addr().String(), a)
+		srv, err := NewHTTPServer(l.Addr().String(), a)
+		if err != nil {
+			return err
+		}
 		if err := a.serveHTTP(l, srv); err != nil {
 			return err
 		}
@@ -335,7 +419,7 @@ func (a *Agent) Start() error {
 	}
 
 	// register watches
-	if err := a.reloadWatches(a.config); err != nil {
+	if err := a.reloadWatches(c); err != nil {
 		return err
 	}
 
@@ -363,9 +447,9 @@ func (a *Agent) listenAndServeDNS() error {
 		go func() {
 			defer a.wgServers.Done()
 
-			err := s.ListenAndServe(p.Net, p.Addr, func() { notif <- p })
+			err := s.ListenAndServe(listenNetwork(p.Addr, a.dnsAddrs), p.Addr.String(), func() { notif <- p })
 			if err != nil && !strings.Contains(err.Error(), "accept") {
-				a.logger.Printf("[ERR] agent: Error starting DNS server %s (%s): %v", p.Addr, p.Net, err)
+				a.logger.Printf("[ERR] agent: Error starting DNS server %s (%s): %v", p.Addr, p.Addr.Network(), err)
 			}
 		}()
 	}
@@ -375,7 +459,7 @@ func (a *Agent) listenAndServeDNS() error {
 	for range a.dnsAddrs {
 		select {
 		case p := <-notif:
-			a.logger.Printf("[INFO] agent: Started DNS server %s (%s)", p.Addr, p.Net)
+			a.logger.Printf("[INFO] agent: Started DNS server %s (%s)", p.Addr, p.Addr.Network())
 			continue
 		case <-timeout:
 			return fmt.Errorf("agent: timeout starting DNS servers")
@@ -400,28 +484,30 @@ func (a *Agent) listenAndServeDNS() error {
 // This approach should ultimately be refactored to the point where we just
 // start the server and any error should trigger a proper shutdown of the agent.
 func (a *Agent) listenHTTP(addrs []ProtoAddr) ([]net.Listener, error) {
+	cfg := a.RuntimeConfig()
 	var ln []net.Listener
 	for _, p := range addrs {
 		var l net.Listener
 		var err error
 
+		addr, isTCP := p.Addr.(*net.TCPAddr)
 		switch {
-		case p.Net == "unix":
-			l, err = a.listenSocket(p.Addr, a.config.UnixSockets)
+		case isUnixAddr(p.Addr):
+			l, err = a.listenSocket(p.Addr.String(), cfg.UnixSockets)
 
-		case p.Net == "tcp" && p.Proto == "http":
-			l, err = net.Listen("tcp", p.Addr)
+		case isTCP && p.Proto == "http":
+			l, err = net.Listen(listenNetwork(addr, addrs), addr.String())
 
-		case p.Net == "tcp" && p.Proto == "https":
+		case isTCP && p.Proto == "https":
 			var tlscfg *tls.Config
-			tlscfg, err = a.config.IncomingHTTPSConfig()
+			tlscfg, err = cfg.IncomingHTTPSConfig()
 			if err != nil {
 				break
 			}
-			l, err = tls.Listen("tcp", p.Addr, tlscfg)
+			l, err = tls.Listen(listenNetwork(addr, addrs), addr.String(), tlscfg)
 
 		default:
-			return nil, fmt.Errorf("%s:%s listener not supported", p.Net, p.Proto)
+			return nil, fmt.Errorf("%s:%s listener not supported", p.Addr.Network(), p.Proto)
 		}
 
 		if err != nil {
@@ -440,6 +526,42 @@ func (a *Agent) listenHTTP(addrs []ProtoAddr) ([]net.Listener, error) {
 	return ln, nil
 }
 
+// listenNetwork returns the network to listen on addr, which is one of
+// addrs. A listener on an IPv6 address accepts IPv4 connections as well
+// unless it is restricted to IPv6, which it must be if another listener
+// binds the same port over IPv4, e.g. for a client_addr of "0.0.0.0 ::".
+func listenNetwork(addr net.Addr, addrs []ProtoAddr) string {
+	ipPort := func(a net.Addr) (net.IP, int) {
+		switch a := a.(type) {
+		case *net.TCPAddr:
+			return a.IP, a.Port
+		case *net.UDPAddr:
+			return a.IP, a.Port
+		}
+		return nil, 0
+	}
+
+	ip, port := ipPort(addr)
+	if ip == nil || ip.To4() != nil {
+		return addr.Network()
+	}
+	for _, p := range addrs {
+		if p.Addr.Network() != addr.Network() {
+			continue
+		}
+		if other, otherPort := ipPort(p.Addr); other != nil && other.To4() != nil && otherPort == port {
+			return addr.Network() + "6"
+		}
+	}
+	return addr.Network()
+}
+
+// isUnixAddr returns whether addr is the path of a unix socket.
+func isUnixAddr(addr net.Addr) bool {
+	_, ok := addr.(*net.UnixAddr)
+	return ok
+}
+
 // tcpKeepAliveListener sets TCP keep-alive timeouts on accepted
 // connections. It's used by NewHttpServer so dead TCP connections
 // eventually go away.
@@ -536,11 +658,11 @@ func (a *Agent) reloadWatches(cfg *Config) error {
 	for _, wp := range cfg.WatchPlans {
 		a.watchPlans = append(a.watchPlans, wp)
 		go func(wp *watch.Plan) {
-			wp.Handler = makeWatchHandler(a.LogOutput, wp.Exempt["handler"])
+			wp.Handler = makeWatchPlanHandler(a.LogOutput, wp)
 			wp.LogOutput = a.LogOutput
 			addr := addrs[0].String()
-			if addrs[0].Net == "unix" {
-				addr = "unix://" + addr
+			if isUnixAddr(addrs[0].Addr) {
+				addr = "unix://" + addrs[0].Addr.String()
 			}
 			if err := wp.Run(addr); err != nil {
 				a.logger.Printf("[ERR] Failed to run watch: %v", err)
@@ -552,161 +674,176 @@ func (a *Agent) reloadWatches(cfg *Config) error {
 
 // consulConfig is used to return a consul configuration
 func (a *Agent) consulConfig() (*consul.Config, error) {
+	cfg := a.RuntimeConfig()
+
 	// Start with the provided config or default config
 	base := consul.DefaultConfig()
 
 	// a.config.ConsulConfig, if set, is a partial configuration for the
 	// consul server or client. Therefore, clone and augment it but
 	// don't use it as base directly.
-	if a.config.ConsulConfig != nil {
+	if cfg.ConsulConfig != nil {
 		base = new(consul.Config)
-		*base = *a.config.ConsulConfig
+		*base = *cfg.ConsulConfig
 	}
 
 	// This is set when the agent starts up
-	base.NodeID = a.config.NodeID
+	base.NodeID = cfg.NodeID
 
 	// Apply dev mode
-	base.DevMode = a.config.DevMode
+	base.DevMode = cfg.DevMode
 
 	// Apply performance factors
-	if a.config.Performance.RaftMultiplier > 0 {
-		base.ScaleRaft(a.config.Performance.RaftMultiplier)
+	if cfg.Performance.RaftMultiplier > 0 {
+		base.ScaleRaft(cfg.Performance.RaftMultiplier)
 	}
 
 	// Override with our config
-	if a.config.Datacenter != "" {
-		base.Datacenter = a.config.Datacenter
+	if cfg.NodeMetaLimits != (NodeMetaLimits{}) {
+		base.NodeMetaLimits = cfg.NodeMetaLimits.MetaLimits()
+	}
+	if cfg.Datacenter != "" {
+		base.Datacenter = cfg.Datacenter
 	}
-	if a.config.DataDir != "" {
-		base.DataDir = a.config.DataDir
+	if cfg.DataDir != "" {
+		base.DataDir = cfg.DataDir
 	}
-	if a.config.NodeName != "" {
-		base.NodeName = a.config.NodeName
+	if cfg.NodeName != "" {
+		base.NodeName = cfg.NodeName
 	}
-	if a.config.Ports.SerfLan != 0 {
-		base.SerfLANConfig.MemberlistConfig.BindPort = a.config.Ports.SerfLan
-		base.SerfLANConfig.MemberlistConfig.AdvertisePort = a.config.Ports.SerfLan
+	if cfg.Ports.SerfLan != 0 {
+		base.SerfLANConfig.MemberlistConfig.BindPort = cfg.Ports.SerfLan
+		base.SerfLANConfig.MemberlistConfig.AdvertisePort = cfg.Ports.SerfLan
 	}
-	if a.config.Ports.SerfWan != 0 {
-		base.SerfWANConfig.MemberlistConfig.BindPort = a.config.Ports.SerfWan
-		base.SerfWANConfig.MemberlistConfig.AdvertisePort = a.config.Ports.SerfWan
+	if cfg.Ports.SerfWan != 0 {
+		base.SerfWANConfig.MemberlistConfig.BindPort = cfg.Ports.SerfWan
+		base.SerfWANConfig.MemberlistConfig.AdvertisePort = cfg.Ports.SerfWan
 	}
-	if a.config.BindAddr != "" {
+	if cfg.BindAddr != "" {
 		bindAddr := &net.TCPAddr{
-			IP:   net.ParseIP(a.config.BindAddr),
-			Port: a.config.Ports.Server,
+			IP:   net.ParseIP(cfg.BindAddr),
+			Port: cfg.Ports.Server,
 		}
 		base.RPCAddr = bindAddr
 
 		// Set the Serf configs using the old default behavior, we may
 		// override these in the code right below.
-		base.SerfLANConfig.MemberlistConfig.BindAddr = a.config.BindAddr
-		base.SerfWANConfig.MemberlistConfig.BindAddr = a.config.BindAddr
+		base.SerfLANConfig.MemberlistConfig.BindAddr = cfg.BindAddr
+		base.SerfWANConfig.MemberlistConfig.BindAddr = cfg.BindAddr
 	}
-	if a.config.SerfLanBindAddr != "" {
-		base.SerfLANConfig.MemberlistConfig.BindAddr = a.config.SerfLanBindAddr
+	if cfg.SerfLanBindAddr != "" {
+		base.SerfLANConfig.MemberlistConfig.BindAddr = cfg.SerfLanBindAddr
 	}
-	if a.config.SerfWanBindAddr != "" {
-		base.SerfWANConfig.MemberlistConfig.BindAddr = a.config.SerfWanBindAddr
+	if cfg.SerfWanBindAddr != "" {
+		base.SerfWANConfig.MemberlistConfig.BindAddr = cfg.SerfWanBindAddr
 	}
+	lanCIDRs, err := ParseCIDRs(cfg.SerfLANAllowedCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid serf_lan_allowed_cidrs: %v", err)
+	}
+	base.SerfLANAllowedCIDRs = lanCIDRs
+	wanCIDRs, err := ParseCIDRs(cfg.SerfWANAllowedCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid serf_wan_allowed_cidrs: %v", err)
+	}
+	base.SerfWANAllowedCIDRs = wanCIDRs
 
-	if a.config.AdvertiseAddr != "" {
-		base.SerfLANConfig.MemberlistConfig.AdvertiseAddr = a.config.AdvertiseAddr
-		base.SerfWANConfig.MemberlistConfig.AdvertiseAddr = a.config.AdvertiseAddr
-		if a.config.AdvertiseAddrWan != "" {
-			base.SerfWANConfig.MemberlistConfig.AdvertiseAddr = a.config.AdvertiseAddrWan
+	if cfg.AdvertiseAddr != "" {
+		base.SerfLANConfig.MemberlistConfig.AdvertiseAddr = cfg.AdvertiseAddr
+		base.SerfWANConfig.MemberlistConfig.AdvertiseAddr = cfg.AdvertiseAddr
+		if cfg.AdvertiseAddrWan != "" {
+			base.SerfWANConfig.MemberlistConfig.AdvertiseAddr = cfg.AdvertiseAddrWan
 		}
 		base.RPCAdvertise = &net.TCPAddr{
-			IP:   net.ParseIP(a.config.AdvertiseAddr),
-			Port: a.config.Ports.Server,
+			IP:   net.ParseIP(cfg.AdvertiseAddr),
+			Port: cfg.Ports.Server,
 		}
 	}
-	if a.config.AdvertiseAddrs.SerfLan != nil {
-		base.SerfLANConfig.MemberlistConfig.AdvertiseAddr = a.config.AdvertiseAddrs.SerfLan.IP.String()
-		base.SerfLANConfig.MemberlistConfig.AdvertisePort = a.config.AdvertiseAddrs.SerfLan.Port
+	if cfg.AdvertiseAddrs.SerfLan != nil {
+		base.SerfLANConfig.MemberlistConfig.AdvertiseAddr = cfg.AdvertiseAddrs.SerfLan.IP.String()
+		base.SerfLANConfig.MemberlistConfig.AdvertisePort = cfg.AdvertiseAddrs.SerfLan.Port
 	}
-	if a.config.AdvertiseAddrs.SerfWan != nil {
-		base.SerfWANConfig.MemberlistConfig.AdvertiseAddr = a.config.AdvertiseAddrs.SerfWan.IP.String()
-		base.SerfWANConfig.MemberlistConfig.AdvertisePort = a.config.AdvertiseAddrs.SerfWan.Port
+	if cfg.AdvertiseAddrs.SerfWan != nil {
+		base.SerfWANConfig.MemberlistConfig.AdvertiseAddr = cfg.AdvertiseAddrs.SerfWan.IP.String()
+		base.SerfWANConfig.MemberlistConfig.AdvertisePort = cfg.AdvertiseAddrs.SerfWan.Port
 	}
-	if a.config.ReconnectTimeoutLan != 0 {
-		base.SerfLANConfig.ReconnectTimeout = a.config.ReconnectTimeoutLan
+	if cfg.ReconnectTimeoutLan != 0 {
+		base.SerfLANConfig.ReconnectTimeout = cfg.ReconnectTimeoutLan
 	}
-	if a.config.ReconnectTimeoutWan != 0 {
-		base.SerfWANConfig.ReconnectTimeout = a.config.ReconnectTimeoutWan
+	if cfg.ReconnectTimeoutWan != 0 {
+		base.SerfWANConfig.ReconnectTimeout = cfg.ReconnectTimeoutWan
 	}
-	if a.config.EncryptVerifyIncoming != nil {
-		base.SerfWANConfig.MemberlistConfig.GossipVerifyIncoming = *a.config.EncryptVerifyIncoming
-		base.SerfLANConfig.MemberlistConfig.GossipVerifyIncoming = *a.config.EncryptVerifyIncoming
+	if cfg.EncryptVerifyIncoming != nil {
+		base.SerfWANConfig.MemberlistConfig.GossipVerifyIncoming = *cfg.EncryptVerifyIncoming
+		base.SerfLANConfig.MemberlistConfig.GossipVerifyIncoming = *cfg.EncryptVerifyIncoming
 	}
-	if a.config.EncryptVerifyOutgoing != nil {
-		base.SerfWANConfig.MemberlistConfig.GossipVerifyOutgoing = *a.config.EncryptVerifyOutgoing
-		base.SerfLANConfig.MemberlistConfig.GossipVerifyOutgoing = *a.config.EncryptVerifyOutgoing
+	if cfg.EncryptVerifyOutgoing != nil {
+		base.SerfWANConfig.MemberlistConfig.GossipVerifyOutgoing = *cfg.EncryptVerifyOutgoing
+		base.SerfLANConfig.MemberlistConfig.GossipVerifyOutgoing = *cfg.EncryptVerifyOutgoing
 	}
-	if a.config.AdvertiseAddrs.RPC != nil {
-		base.RPCAdvertise = a.config.AdvertiseAddrs.RPC
+	if cfg.AdvertiseAddrs.RPC != nil {
+		base.RPCAdvertise = cfg.AdvertiseAddrs.RPC
 	}
-	if a.config.Bootstrap {
+	if cfg.Bootstrap {
 		base.Bootstrap = true
 	}
-	if a.config.RejoinAfterLeave {
+	if cfg.RejoinAfterLeave {
 		base.RejoinAfterLeave = true
 	}
-	if a.config.BootstrapExpect != 0 {
-		base.BootstrapExpect = a.config.BootstrapExpect
+	if cfg.BootstrapExpect != 0 {
+		base.BootstrapExpect = cfg.BootstrapExpect
 	}
-	if a.config.Protocol > 0 {
-		base.ProtocolVersion = uint8(a.config.Protocol)
+	if cfg.Protocol > 0 {
+		base.ProtocolVersion = uint8(cfg.Protocol)
 	}
-	if a.config.RaftProtocol != 0 {
-		base.RaftConfig.ProtocolVersion = raft.ProtocolVersion(a.config.RaftProtocol)
+	if cfg.RaftProtocol != 0 {
+		base.RaftConfig.ProtocolVersion = raft.ProtocolVersion(cfg.RaftProtocol)
 	}
-	if a.config.ACLMasterToken != "" {
-		base.ACLMasterToken = a.config.ACLMasterToken
+	if cfg.ACLMasterToken != "" {
+		base.ACLMasterToken = cfg.ACLMasterToken
 	}
-	if a.config.ACLDatacenter != "" {
-		base.ACLDatacenter = a.config.ACLDatacenter
+	if cfg.ACLDatacenter != "" {
+		base.ACLDatacenter = cfg.ACLDatacenter
 	}
-	if a.config.ACLTTLRaw != "" {
-		base.ACLTTL = a.config.ACLTTL
+	if cfg.ACLTTLRaw != "" {
+		base.ACLTTL = cfg.ACLTTL
 	}
-	if a.config.ACLDefaultPolicy != "" {
-		base.ACLDefaultPolicy = a.config.ACLDefaultPolicy
+	if cfg.ACLDefaultPolicy != "" {
+		base.ACLDefaultPolicy = cfg.ACLDefaultPolicy
 	}
-	if a.config.ACLDownPolicy != "" {
-		base.ACLDownPolicy = a.config.ACLDownPolicy
+	if cfg.ACLDownPolicy != "" {
+		base.ACLDownPolicy = cfg.ACLDownPolicy
 	}
-	base.EnableACLReplication = a.config.EnableACLReplication
-	if a.config.ACLEnforceVersion8 != nil {
-		base.ACLEnforceVersion8 = *a.config.ACLEnforceVersion8
+	base.EnableACLReplication = cfg.EnableACLReplication
+	if cfg.ACLEnforceVersion8 != nil {
+		base.ACLEnforceVersion8 = *cfg.ACLEnforceVersion8
 	}
-	if a.config.SessionTTLMinRaw != "" {
-		base.SessionTTLMin = a.config.SessionTTLMin
+	if cfg.SessionTTLMinRaw != "" {
+		base.SessionTTLMin = cfg.SessionTTLMin
 	}
-	if a.config.Autopilot.CleanupDeadServers != nil {
-		base.AutopilotConfig.CleanupDeadServers = *a.config.Autopilot.CleanupDeadServers
+	if cfg.Autopilot.CleanupDeadServers != nil {
+		base.AutopilotConfig.CleanupDeadServers = *cfg.Autopilot.CleanupDeadServers
 	}
-	if a.config.Autopilot.LastContactThreshold != nil {
-		base.AutopilotConfig.LastContactThreshold = *a.config.Autopilot.LastContactThreshold
+	if cfg.Autopilot.LastContactThreshold != nil {
+		base.AutopilotConfig.LastContactThreshold = *cfg.Autopilot.LastContactThreshold
 	}
-	if a.config.Autopilot.MaxTrailingLogs != nil {
-		base.AutopilotConfig.MaxTrailingLogs = *a.config.Autopilot.MaxTrailingLogs
+	if cfg.Autopilot.MaxTrailingLogs != nil {
+		base.AutopilotConfig.MaxTrailingLogs = *cfg.Autopilot.MaxTrailingLogs
 	}
-	if a.config.Autopilot.ServerStabilizationTime != nil {
-		base.AutopilotConfig.ServerStabilizationTime = *a.config.Autopilot.ServerStabilizationTime
+	if cfg.Autopilot.ServerStabilizationTime != nil {
+		base.AutopilotConfig.ServerStabilizationTime = *cfg.Autopilot.ServerStabilizationTime
 	}
-	if a.config.NonVotingServer {
-		base.NonVoter = a.config.NonVotingServer
+	if cfg.ReadReplica {
+		base.NonVoter = cfg.ReadReplica
 	}
-	if a.config.Autopilot.RedundancyZoneTag != "" {
-		base.AutopilotConfig.RedundancyZoneTag = a.config.Autopilot.RedundancyZoneTag
+	if cfg.Autopilot.RedundancyZoneTag != "" {
+		base.AutopilotConfig.RedundancyZoneTag = cfg.Autopilot.RedundancyZoneTag
 	}
-	if a.config.Autopilot.DisableUpgradeMigration != nil {
-		base.AutopilotConfig.DisableUpgradeMigration = *a.config.Autopilot.DisableUpgradeMigration
+	if cfg.Autopilot.DisableUpgradeMigration != nil {
+		base.AutopilotConfig.DisableUpgradeMigration = *cfg.Autopilot.DisableUpgradeMigration
 	}
-	if a.config.Autopilot.UpgradeVersionTag != "" {
-		base.AutopilotConfig.UpgradeVersionTag = a.config.Autopilot.UpgradeVersionTag
+	if cfg.Autopilot.UpgradeVersionTag != "" {
+		base.AutopilotConfig.UpgradeVersionTag = cfg.Autopilot.UpgradeVersionTag
 	}
 
 	// make sure the advertise address is always set
@@ -721,28 +858,28 @@ func (a *Agent) consulConfig() (*consul.Config, error) {
 	}
 
 	// Format the build string
-	revision := a.config.Revision
+	revision := cfg.Revision
 	if len(revision) > 8 {
 		revision = revision[:8]
 	}
-	base.Build = fmt.Sprintf("%s%s:%s", a.config.Version, a.config.VersionPrerelease, revision)
+	base.Build = fmt.Sprintf("%s%s:%s", cfg.Version, cfg.VersionPrerelease, revision)
 
 	// Copy the TLS configuration
-	base.VerifyIncoming = a.config.VerifyIncoming || a.config.VerifyIncomingRPC
-	if a.config.CAPath != "" || a.config.CAFile != "" {
+	base.VerifyIncoming = cfg.VerifyIncoming || cfg.VerifyIncomingRPC
+	if cfg.CAPath != "" || cfg.CAFile != "" {
 		base.UseTLS = true
 	}
-	base.VerifyOutgoing = a.config.VerifyOutgoing
-	base.VerifyServerHostname = a.config.VerifyServerHostname
-	base.CAFile = a.config.CAFile
-	base.CAPath = a.config.CAPath
-	base.CertFile = a.config.CertFile
-	base.KeyFile = a.config.KeyFile
-	base.ServerName = a.config.ServerName
-	base.Domain = a.config.Domain
-	base.TLSMinVersion = a.config.TLSMinVersion
-	base.TLSCipherSuites = a.config.TLSCipherSuites
-	base.TLSPreferServerCipherSuites = a.config.TLSPreferServerCipherSuites
+	base.VerifyOutgoing = cfg.VerifyOutgoing
+	base.VerifyServerHostname = cfg.VerifyServerHostname
+	base.CAFile = cfg.CAFile
+	base.CAPath = cfg.CAPath
+	base.CertFile = cfg.CertFile
+	base.KeyFile = cfg.KeyFile
+	base.ServerName = cfg.ServerName
+	base.Domain = cfg.Domain
+	base.TLSMinVersion = cfg.TLSMinVersion
+	base.TLSCipherSuites = cfg.TLSCipherSuites
+	base.TLSPreferServerCipherSuites = cfg.TLSPreferServerCipherSuites
 
 	// Setup the user event callback
 	base.UserEventHandler = func(e serf.UserEvent) {
@@ -755,6 +892,11 @@ func (a *Agent) consulConfig() (*consul.Config, error) {
 	// Setup the loggers
 	base.LogOutput = a.LogOutput
 
+	// A negative port disables the WAN gossip pool of servers.
+	if cfg.Ports.SerfWan < 0 {
+		base.SerfWANConfig = nil
+	}
+
 	// This will set up the LAN keyring, as well as the WAN for servers.
 	if err := a.setupKeyrings(base); err != nil {
 		return nil, fmt.Errorf("Failed to configure keyring: %v", err)
@@ -781,7 +923,7 @@ func (a *Agent) makeRandomID() (string, error) {
 // gopsutil change implementations without affecting in-place upgrades of nodes.
 func (a *Agent) makeNodeID() (string, error) {
 	// If they've disabled host-based IDs then just make a random one.
-	if *a.config.DisableHostNodeID {
+	if *a.RuntimeConfig().DisableHostNodeID {
 		return a.makeRandomID()
 	}
 
@@ -822,16 +964,17 @@ func (a *Agent) setupNodeID(config *Config) error {
 	// If they've configured a node ID manually then just use that, as
 	// long as it's valid.
 	if config.NodeID != "" {
-		config.NodeID = types.NodeID(strings.ToLower(string(config.NodeID)))
-		if _, err := uuid.ParseUUID(string(config.NodeID)); err != nil {
+		id, err := ValidateNodeID(config.NodeID)
+		if err != nil {
 			return err
 		}
 
+		config.NodeID = id
 		return nil
 	}
 
 	// For dev mode we have no filesystem access so just make one.
-	if a.config.DevMode {
+	if a.RuntimeConfig().DevMode {
 		id, err := a.makeNodeID()
 		if err != nil {
 			return err
@@ -842,22 +985,20 @@ func (a *Agent) setupNodeID(config *Config) error {
 	}
 
 	// Load saved state, if any. Since a user could edit this, we also
-	// validate it.
-	fileID := filepath.Join(config.DataDir, "node-id")
-	if _, err := os.Stat(fileID); err == nil {
-		rawID, err := ioutil.ReadFile(fileID)
-		if err != nil {
-			return err
-		}
-
-		nodeID := strings.TrimSpace(string(rawID))
-		nodeID = strings.ToLower(nodeID)
-		if _, err := uuid.ParseUUID(nodeID); err != nil {
-			return err
+	// validate it. IDs persisted by older versions are rewritten in the
+	// lower case form.
+	fileID := filepath.Join(config.DataDir, NodeIDFile)
+	id, legacy, err := ReadNodeIDFile(config.DataDir)
+	if err != nil {
+		return err
+	}
+	if legacy {
+		if err := writeFileAtomic(fileID, []byte(id)); err != nil {
+			return fmt.Errorf("Error migrating node ID in '%s': %s", fileID, err)
 		}
-
-		config.NodeID = types.NodeID(nodeID)
+		a.logger.Printf("[INFO] agent: Migrated node ID in %q to lower case", fileID)
 	}
+	config.NodeID = id
 
 	// If we still don't have a valid node ID, make one.
 	if config.NodeID == "" {
@@ -879,18 +1020,23 @@ func (a *Agent) setupNodeID(config *Config) error {
 
 // setupKeyrings is used to initialize and load keyrings during agent startup
 func (a *Agent) setupKeyrings(config *consul.Config) error {
+	cfg := a.RuntimeConfig()
+
+	// Only servers with the WAN gossip pool enabled have a WAN keyring.
+	wan := cfg.Server && config.SerfWANConfig != nil
+
 	// If the keyring file is disabled then just poke the provided key
 	// into the in-memory keyring.
-	if a.config.DisableKeyringFile {
-		if a.config.EncryptKey == "" {
+	if cfg.DisableKeyringFile {
+		if cfg.EncryptKey == "" {
 			return nil
 		}
 
-		keys := []string{a.config.EncryptKey}
+		keys := []string{cfg.EncryptKey}
 		if err := loadKeyring(config.SerfLANConfig, keys); err != nil {
 			return err
 		}
-		if a.config.Server {
+		if wan {
 			if err := loadKeyring(config.SerfWANConfig, keys); err != nil {
 				return err
 			}
@@ -899,20 +1045,20 @@ func (a *Agent) setupKeyrings(config *consul.Config) error {
 	}
 
 	// Otherwise, we need to deal with the keyring files.
-	fileLAN := filepath.Join(a.config.DataDir, SerfLANKeyring)
-	fileWAN := filepath.Join(a.config.DataDir, SerfWANKeyring)
+	fileLAN := filepath.Join(cfg.DataDir, SerfLANKeyring)
+	fileWAN := filepath.Join(cfg.DataDir, SerfWANKeyring)
 
-	if a.config.EncryptKey == "" {
+	if cfg.EncryptKey == "" {
 		goto LOAD
 	}
 	if _, err := os.Stat(fileLAN); err != nil {
-		if err := initKeyring(fileLAN, a.config.EncryptKey); err != nil {
+		if err := initKeyring(fileLAN, cfg.EncryptKey); err != nil {
 			return err
 		}
 	}
-	if a.config.Server {
+	if wan {
 		if _, err := os.Stat(fileWAN); err != nil {
-			if err := initKeyring(fileWAN, a.config.EncryptKey); err != nil {
+			if err := initKeyring(fileWAN, cfg.EncryptKey); err != nil {
 				return err
 			}
 		}
@@ -922,14 +1068,14 @@ LOAD:
 	if _, err := os.Stat(fileLAN); err == nil {
 		config.SerfLANConfig.KeyringFile = fileLAN
 	}
-	if err := loadKeyringFile(config.SerfLANConfig); err != nil {
+	if err := a.loadKeyringFile(config.SerfLANConfig); err != nil {
 		return err
 	}
-	if a.config.Server {
+	if wan {
 		if _, err := os.Stat(fileWAN); err == nil {
 			config.SerfWANConfig.KeyringFile = fileWAN
 		}
-		if err := loadKeyringFile(config.SerfWANConfig); err != nil {
+		if err := a.loadKeyringFile(config.SerfWANConfig); err != nil {
 			return err
 		}
 	}
@@ -1023,6 +1169,12 @@ func (a *Agent) ShutdownAgent() error {
 		}
 	}
 
+	// Persist the changes made to the encrypted keyrings since they were
+	// last checked.
+	if err := a.persistKeyrings(); err != nil {
+		a.logger.Printf("[ERR] agent: %v", err)
+	}
+
 	pidErr := a.deletePid()
 	if pidErr != nil {
 		a.logger.Println("[WARN] agent: could not delete pid file ", pidErr)
@@ -1064,6 +1216,12 @@ func (a *Agent) ShutdownEndpoints() {
 	a.logger.Println("[INFO] agent: Waiting for endpoints to shut down")
 	a.wgServers.Wait()
 	a.logger.Print("[INFO] agent: Endpoints down")
+
+	if a.auditLog != nil {
+		if err := a.auditLog.Close(); err != nil {
+			a.logger.Printf("[WARN] agent: Failed to close audit log: %v", err)
+		}
+	}
 }
 
 // ReloadCh is used to return a channel that can be
@@ -1072,6 +1230,25 @@ func (a *Agent) ReloadCh() chan chan error {
 	return a.reloadCh
 }
 
+// TriggerReload requests a configuration reload through the reload channel
+// and waits for its result.
+func (a *Agent) TriggerReload() error {
+	errCh := make(chan error, 0)
+	select {
+	case <-a.shutdownCh:
+		return fmt.Errorf("Agent was shutdown before reload could be completed")
+	case a.reloadCh <- errCh:
+	}
+
+	// Wait for the result of the reload, or for the agent to shutdown
+	select {
+	case <-a.shutdownCh:
+		return fmt.Errorf("Agent was shutdown before reload could be completed")
+	case err := <-errCh:
+		return err
+	}
+}
+
 // RetryJoinCh is a channel that transports errors
 // from the retry join process.
 func (a *Agent) RetryJoinCh() <-chan error {
@@ -1164,8 +1341,9 @@ func (a *Agent) GetLANCoordinate() (*coordinate.Coordinate, error) {
 // to the server. Closing the agent's shutdownChannel will cause this to exit.
 func (a *Agent) sendCoordinate() {
 	for {
-		rate := a.config.SyncCoordinateRateTarget
-		min := a.config.SyncCoordinateIntervalMin
+		cfg := a.RuntimeConfig()
+		rate := cfg.SyncCoordinateRateTarget
+		min := cfg.SyncCoordinateIntervalMin
 		intv := lib.RateScaledInterval(rate, min, len(a.LANMembers()))
 		intv = intv + lib.RandomStagger(intv)
 
@@ -1189,8 +1367,8 @@ func (a *Agent) sendCoordinate() {
 			}
 
 			req := structs.CoordinateUpdateRequest{
-				Datacenter:   a.config.Datacenter,
-				Node:         a.config.NodeName,
+				Datacenter:   cfg.Datacenter,
+				Node:         cfg.NodeName,
 				Coord:        c,
 				WriteRequest: structs.WriteRequest{Token: a.tokens.AgentToken()},
 			}
@@ -1246,7 +1424,7 @@ func (a *Agent) reapServicesInternal() {
 func (a *Agent) reapServices() {
 	for {
 		select {
-		case <-time.After(a.config.CheckReapInterval):
+		case <-time.After(a.RuntimeConfig().CheckReapInterval):
 			a.reapServicesInternal()
 
 		case <-a.shutdownCh:
@@ -1265,7 +1443,7 @@ type persistedService struct {
 
 // persistService saves a service definition to a JSON file in the data dir
 func (a *Agent) persistService(service *structs.NodeService) error {
-	svcPath := filepath.Join(a.config.DataDir, servicesDir, stringHash(service.ID))
+	svcPath := filepath.Join(a.RuntimeConfig().DataDir, servicesDir, stringHash(service.ID))
 
 	wrapped := persistedService{
 		Token:   a.state.ServiceToken(service.ID),
@@ -1276,12 +1454,12 @@ func (a *Agent) persistService(service *structs.NodeService) error {
 		return err
 	}
 
-	return writeFileAtomic(svcPath, encoded)
+	return a.writeDataFileAtomic(svcPath, encoded)
 }
 
 // purgeService removes a persisted service definition file from the data dir
 func (a *Agent) purgeService(serviceID string) error {
-	svcPath := filepath.Join(a.config.DataDir, servicesDir, stringHash(serviceID))
+	svcPath := filepath.Join(a.RuntimeConfig().DataDir, servicesDir, stringHash(serviceID))
 	if _, err := os.Stat(svcPath); err == nil {
 		return os.Remove(svcPath)
 	}
@@ -1290,7 +1468,7 @@ func (a *Agent) purgeService(serviceID string) error {
 
 // persistCheck saves a check definition to the local agent's state directory
 func (a *Agent) persistCheck(check *structs.HealthCheck, chkType *structs.CheckType) error {
-	checkPath := filepath.Join(a.config.DataDir, checksDir, checkIDHash(check.CheckID))
+	checkPath := filepath.Join(a.RuntimeConfig().DataDir, checksDir, checkIDHash(check.CheckID))
 
 	// Create the persisted check
 	wrapped := persistedCheck{
@@ -1304,12 +1482,12 @@ func (a *Agent) persistCheck(check *structs.HealthCheck, chkType *structs.CheckT
 		return err
 	}
 
-	return writeFileAtomic(checkPath, encoded)
+	return a.writeDataFileAtomic(checkPath, encoded)
 }
 
 // purgeCheck removes a persisted check definition file from the data dir
 func (a *Agent) purgeCheck(checkID types.CheckID) error {
-	checkPath := filepath.Join(a.config.DataDir, checksDir, checkIDHash(checkID))
+	checkPath := filepath.Join(a.RuntimeConfig().DataDir, checksDir, checkIDHash(checkID))
 	if _, err := os.Stat(checkPath); err == nil {
 		return os.Remove(checkPath)
 	}
@@ -1319,6 +1497,12 @@ func (a *Agent) purgeCheck(checkID types.CheckID) error {
 // writeFileAtomic writes the given contents to a temporary file in the same
 // directory, does an fsync and then renames the file to its real path
 func writeFileAtomic(path string, contents []byte) error {
+	return writeFileAtomicMode(path, contents, 0600)
+}
+
+// writeFileAtomicMode is like writeFileAtomic but creates the file with the
+// given permissions.
+func writeFileAtomicMode(path string, contents []byte, perm os.FileMode) error {
 	uuid, err := uuid.GenerateUUID()
 	if err != nil {
 		return err
@@ -1328,7 +1512,7 @@ func writeFileAtomic(path string, contents []byte) error {
 	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
 		return err
 	}
-	fh, err := os.OpenFile(tempPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	fh, err := os.OpenFile(tempPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
 	if err != nil {
 		return err
 	}
@@ -1353,13 +1537,43 @@ func writeFileAtomic(path string, contents []byte) error {
 	return nil
 }
 
+// configSource describes where a service or check definition came from.
+type configSource int
+
+const (
+	// ConfigSourceLocal is used for definitions from the local
+	// configuration files.
+	ConfigSourceLocal configSource = iota
+
+	// ConfigSourceRemote is used for definitions registered via the HTTP
+	// API, including those restored from the data directory.
+	ConfigSourceRemote
+)
+
+// serviceCheckID returns the ID of the i-th of the given checks registered
+// with a service.
+func serviceCheckID(serviceID string, chkTypes []*structs.CheckType, i int) types.CheckID {
+	if chkTypes[i].CheckID != "" {
+		return chkTypes[i].CheckID
+	}
+	checkID := fmt.Sprintf("service:%s", serviceID)
+	if len(chkTypes) > 1 {
+		checkID += fmt.Sprintf(":%d", i+1)
+	}
+	return types.CheckID(checkID)
+}
+
 // AddService is used to add a service entry.
 // This entry is persistent and the agent will make a best effort to
 // ensure it is registered
-func (a *Agent) AddService(service *structs.NodeService, chkTypes []*structs.CheckType, persist bool, token string) error {
+func (a *Agent) AddService(service *structs.NodeService, chkTypes []*structs.CheckType, persist bool, token string, source configSource) error {
+	cfg := a.RuntimeConfig()
 	if service.Service == "" {
 		return fmt.Errorf("Service name missing")
 	}
+	if err := structs.ValidateMetadata(service.Meta); err != nil {
+		return fmt.Errorf("Invalid service meta: %v", err)
+	}
 	if service.ID == "" && service.Service != "" {
 		service.ID = service.Service
 	}
@@ -1398,7 +1612,7 @@ func (a *Agent) AddService(service *structs.NodeService, chkTypes []*structs.Che
 	a.state.AddService(service, token)
 
 	// Persist the service to a file
-	if persist && !a.config.DevMode {
+	if persist && !cfg.DevMode {
 		if err := a.persistService(service); err != nil {
 			return err
 		}
@@ -1406,20 +1620,14 @@ func (a *Agent) AddService(service *structs.NodeService, chkTypes []*structs.Che
 
 	// Create an associated health check
 	for i, chkType := range chkTypes {
-		checkID := string(chkType.CheckID)
-		if checkID == "" {
-			checkID = fmt.Sprintf("service:%s", service.ID)
-			if len(chkTypes) > 1 {
-				checkID += fmt.Sprintf(":%d", i+1)
-			}
-		}
+		checkID := serviceCheckID(service.ID, chkTypes, i)
 		name := chkType.Name
 		if name == "" {
 			name = fmt.Sprintf("Service '%s' check", service.Service)
 		}
 		check := &structs.HealthCheck{
-			Node:        a.config.NodeName,
-			CheckID:     types.CheckID(checkID),
+			Node:        cfg.NodeName,
+			CheckID:     checkID,
 			Name:        name,
 			Status:      api.HealthCritical,
 			Notes:       chkType.Notes,
@@ -1429,7 +1637,7 @@ func (a *Agent) AddService(service *structs.NodeService, chkTypes []*structs.Che
 		if chkType.Status != "" {
 			check.Status = chkType.Status
 		}
-		if err := a.AddCheck(check, chkType, persist, token); err != nil {
+		if err := a.AddCheck(check, chkType, persist, token, source); err != nil {
 			return err
 		}
 	}
@@ -1475,7 +1683,8 @@ func (a *Agent) RemoveService(serviceID string, persist bool) error {
 // This entry is persistent and the agent will make a best effort to
 // ensure it is registered. The Check may include a CheckType which
 // is used to automatically update the check status
-func (a *Agent) AddCheck(check *structs.HealthCheck, chkType *structs.CheckType, persist bool, token string) error {
+func (a *Agent) AddCheck(check *structs.HealthCheck, chkType *structs.CheckType, persist bool, token string, source configSource) error {
+	cfg := a.RuntimeConfig()
 	if check.CheckID == "" {
 		return fmt.Errorf("CheckID missing")
 	}
@@ -1485,8 +1694,17 @@ func (a *Agent) AddCheck(check *structs.HealthCheck, chkType *structs.CheckType,
 			return fmt.Errorf("Check type is not valid")
 		}
 
-		if chkType.IsScript() && !a.config.EnableScriptChecks {
-			return fmt.Errorf("Scripts are disabled on this agent; to enable, configure 'enable_script_checks' to true")
+		if chkType.OutputMaxSize < 0 {
+			return fmt.Errorf("Check output max size must not be negative")
+		}
+
+		if chkType.IsScript() {
+			if source == ConfigSourceLocal && !cfg.EnableScriptChecks && !cfg.EnableLocalScriptChecks {
+				return fmt.Errorf("Scripts are disabled on this agent; to enable, configure 'enable_script_checks' or 'enable_local_script_checks' to true")
+			}
+			if source == ConfigSourceRemote && !cfg.EnableScriptChecks {
+				return fmt.Errorf("Scripts are disabled on this agent from remote calls; to enable, configure 'enable_script_checks' to true")
+			}
 		}
 	}
 
@@ -1516,6 +1734,8 @@ func (a *Agent) AddCheck(check *structs.HealthCheck, chkType *structs.CheckType,
 				CheckID: check.CheckID,
 				TTL:     chkType.TTL,
 				Logger:  a.logger,
+
+				OutputMaxSize: a.checkOutputMaxSize(chkType),
 			}
 
 			// Restore persisted state, if any
@@ -1537,17 +1757,33 @@ func (a *Agent) AddCheck(check *structs.HealthCheck, chkType *structs.CheckType,
 					check.CheckID, MinInterval))
 				chkType.Interval = MinInterval
 			}
+			httpType := a.httpCheckDefaults(chkType)
+
+			var tlsConfig *tls.Config
+			useAgentTLS := cfg.EnableAgentTLSForChecks
+			if chkType.EnableAgentTLS != nil {
+				useAgentTLS = *chkType.EnableAgentTLS
+			}
+			if useAgentTLS {
+				var err error
+				tlsConfig, err = cfg.CheckTLSConfig(chkType.TLSServerName)
+				if err != nil {
+					return fmt.Errorf("Failed to set up TLS for check %q: %v", check.CheckID, err)
+				}
+			}
 
 			http := &CheckHTTP{
-				Notify:        a.state,
-				CheckID:       check.CheckID,
-				HTTP:          chkType.HTTP,
-				Header:        chkType.Header,
-				Method:        chkType.Method,
-				Interval:      chkType.Interval,
-				Timeout:       chkType.Timeout,
-				Logger:        a.logger,
-				TLSSkipVerify: chkType.TLSSkipVerify,
+				Notify:          a.state,
+				CheckID:         check.CheckID,
+				HTTP:            chkType.HTTP,
+				Header:          httpType.Header,
+				Method:          chkType.Method,
+				Interval:        chkType.Interval,
+				Timeout:         httpType.Timeout,
+				Logger:          a.logger,
+				TLSSkipVerify:   httpType.TLSSkipVerify != nil && *httpType.TLSSkipVerify,
+				TLSClientConfig: tlsConfig,
+				OutputMaxSize:   a.checkOutputMaxSize(chkType),
 			}
 			http.Start()
 			a.checkHTTPs[check.CheckID] = http
@@ -1586,7 +1822,7 @@ func (a *Agent) AddCheck(check *structs.HealthCheck, chkType *structs.CheckType,
 			}
 
 			if a.dockerClient == nil {
-				dc, err := NewDockerClient(os.Getenv("DOCKER_HOST"), CheckBufSize)
+				dc, err := NewDockerClient(os.Getenv("DOCKER_HOST"), int64(cfg.CheckOutputMaxSize))
 				if err != nil {
 					a.logger.Printf("[ERR] agent: error creating docker client: %s", err)
 					return err
@@ -1603,6 +1839,7 @@ func (a *Agent) AddCheck(check *structs.HealthCheck, chkType *structs.CheckType,
 				Script:            chkType.Script,
 				Interval:          chkType.Interval,
 				Logger:            a.logger,
+				OutputMaxSize:     a.checkOutputMaxSize(chkType),
 				client:            a.dockerClient,
 			}
 			dockerCheck.Start()
@@ -1626,6 +1863,8 @@ func (a *Agent) AddCheck(check *structs.HealthCheck, chkType *structs.CheckType,
 				Interval: chkType.Interval,
 				Timeout:  chkType.Timeout,
 				Logger:   a.logger,
+
+				OutputMaxSize: a.checkOutputMaxSize(chkType),
 			}
 			monitor.Start()
 			a.checkMonitors[check.CheckID] = monitor
@@ -1634,12 +1873,16 @@ func (a *Agent) AddCheck(check *structs.HealthCheck, chkType *structs.CheckType,
 			return fmt.Errorf("Check type is not valid")
 		}
 
-		if chkType.DeregisterCriticalServiceAfter > 0 {
-			timeout := chkType.DeregisterCriticalServiceAfter
-			if timeout < a.config.CheckDeregisterIntervalMin {
-				timeout = a.config.CheckDeregisterIntervalMin
+		// Checks of services which don't set a timeout use the agent default.
+		timeout := chkType.DeregisterCriticalServiceAfter
+		if timeout == 0 && check.ServiceID != "" {
+			timeout = cfg.DeregisterCriticalServiceAfter
+		}
+		if timeout > 0 {
+			if timeout < cfg.CheckDeregisterIntervalMin {
+				timeout = cfg.CheckDeregisterIntervalMin
 				a.logger.Println(fmt.Sprintf("[WARN] agent: check '%s' has deregister interval below minimum of %v",
-					check.CheckID, a.config.CheckDeregisterIntervalMin))
+					check.CheckID, cfg.CheckDeregisterIntervalMin))
 			}
 			a.checkReapAfter[check.CheckID] = timeout
 		} else {
@@ -1655,7 +1898,7 @@ func (a *Agent) AddCheck(check *structs.HealthCheck, chkType *structs.CheckType,
 	}
 
 	// Persist the check
-	if persist && !a.config.DevMode {
+	if persist && !cfg.DevMode {
 		return a.persistCheck(check, chkType)
 	}
 
@@ -1715,6 +1958,44 @@ func (a *Agent) cancelCheckMonitors(checkID types.CheckID) {
 	}
 }
 
+// checkOutputMaxSize returns the maximum size of the stored output of a
+// check, which is the size of its definition or the agent default, which
+// for HTTP checks can be set in check_defaults.http.
+func (a *Agent) checkOutputMaxSize(chkType *structs.CheckType) int {
+	cfg := a.RuntimeConfig()
+	if chkType.OutputMaxSize > 0 {
+		return chkType.OutputMaxSize
+	}
+	if d := cfg.CheckDefaults.HTTP.OutputMaxSize; chkType.IsHTTP() && d > 0 {
+		return d
+	}
+	return cfg.CheckOutputMaxSize
+}
+
+// httpCheckDefaults returns a copy of the HTTP check chkType with the
+// settings it doesn't set taken from check_defaults.http.
+func (a *Agent) httpCheckDefaults(chkType *structs.CheckType) *structs.CheckType {
+	d := a.RuntimeConfig().CheckDefaults.HTTP
+	c := *chkType
+	if c.Timeout == 0 {
+		c.Timeout = d.Timeout
+	}
+	if c.TLSSkipVerify == nil {
+		c.TLSSkipVerify = Bool(d.TLSSkipVerify)
+	}
+	if len(d.Headers) > 0 {
+		h := make(map[string][]string)
+		for k, v := range d.Headers {
+			h[http.CanonicalHeaderKey(k)] = v
+		}
+		for k, v := range chkType.Header {
+			h[http.CanonicalHeaderKey(k)] = v
+		}
+		c.Header = h
+	}
+	return &c
+}
+
 // updateTTLCheck is used to update the status of a TTL check via the Agent API.
 func (a *Agent) updateTTLCheck(checkID types.CheckID, status, output string) error {
 	a.checkLock.Lock()
@@ -1727,10 +2008,10 @@ func (a *Agent) updateTTLCheck(checkID types.CheckID, status, output string) err
 	}
 
 	// Set the status through CheckTTL to reset the TTL.
-	check.SetStatus(status, output)
+	output = check.SetStatus(status, output)
 
 	// We don't write any files in dev mode so bail here.
-	if a.config.DevMode {
+	if a.RuntimeConfig().DevMode {
 		return nil
 	}
 
@@ -1760,9 +2041,12 @@ func (a *Agent) persistCheckState(check *CheckTTL, status, output string) error
 	if err != nil {
 		return err
 	}
+	if buf, err = a.sealDataFile(buf); err != nil {
+		return err
+	}
 
 	// Create the state dir if it doesn't exist
-	dir := filepath.Join(a.config.DataDir, checkStateDir)
+	dir := filepath.Join(a.RuntimeConfig().DataDir, checkStateDir)
 	if err := os.MkdirAll(dir, 0700); err != nil {
 		return fmt.Errorf("failed creating check state dir %q: %s", dir, err)
 	}
@@ -1787,7 +2071,7 @@ func (a *Agent) persistCheckState(check *CheckTTL, status, output string) error
 // loadCheckState is used to restore the persisted state of a check.
 func (a *Agent) loadCheckState(check *structs.HealthCheck) error {
 	// Try to read the persisted state for this check
-	file := filepath.Join(a.config.DataDir, checkStateDir, checkIDHash(check.CheckID))
+	file := filepath.Join(a.RuntimeConfig().DataDir, checkStateDir, checkIDHash(check.CheckID))
 	buf, err := ioutil.ReadFile(file)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -1795,6 +2079,9 @@ func (a *Agent) loadCheckState(check *structs.HealthCheck) error {
 		}
 		return fmt.Errorf("failed reading file %q: %s", file, err)
 	}
+	if buf, err = a.openDataFile(buf); err != nil {
+		return fmt.Errorf("failed reading file %q: %s", file, err)
+	}
 
 	// Decode the state data
 	var p persistedCheckState
@@ -1817,7 +2104,7 @@ func (a *Agent) loadCheckState(check *structs.HealthCheck) error {
 
 // purgeCheckState is used to purge the state of a check from the data dir
 func (a *Agent) purgeCheckState(checkID types.CheckID) error {
-	file := filepath.Join(a.config.DataDir, checkStateDir, checkIDHash(checkID))
+	file := filepath.Join(a.RuntimeConfig().DataDir, checkStateDir, checkIDHash(checkID))
 	err := os.Remove(file)
 	if os.IsNotExist(err) {
 		return nil
@@ -1831,6 +2118,7 @@ func (a *Agent) GossipEncrypted() bool {
 
 // Stats is used to get various debugging state from the sub-systems
 func (a *Agent) Stats() map[string]map[string]string {
+	cfg := a.RuntimeConfig()
 	toString := func(v uint64) string {
 		return strconv.FormatUint(v, 10)
 	}
@@ -1840,48 +2128,54 @@ func (a *Agent) Stats() map[string]map[string]string {
 		"check_ttls":     toString(uint64(len(a.checkTTLs))),
 		"checks":         toString(uint64(len(a.state.checks))),
 		"services":       toString(uint64(len(a.state.services))),
+		"config_hash":    cfg.Hash(),
 	}
 
-	revision := a.config.Revision
+	revision := cfg.Revision
 	if len(revision) > 8 {
 		revision = revision[:8]
 	}
 	stats["build"] = map[string]string{
 		"revision":   revision,
-		"version":    a.config.Version,
-		"prerelease": a.config.VersionPrerelease,
+		"version":    cfg.Version,
+		"prerelease": cfg.VersionPrerelease,
 	}
 	return stats
 }
 
-// storePid is used to write out our PID to a file if necessary
+// storePid is used to write out our PID to a file if necessary. The file
+// is replaced atomically so that readers never see a partial PID. Unless
+// disable_pid_file_check is set, the agent refuses to start if the file
+// belongs to another running process.
 func (a *Agent) storePid() error {
+	cfg := a.RuntimeConfig()
+
 	// Quit fast if no pidfile
-	pidPath := a.config.PidFile
+	pidPath := cfg.PidFile
 	if pidPath == "" {
 		return nil
 	}
 
-	// Open the PID file
-	pidFile, err := os.OpenFile(pidPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
-	if err != nil {
-		return fmt.Errorf("Could not open pid file: %v", err)
+	pid := os.Getpid()
+	if !cfg.DisablePidFileCheck {
+		if other, ok := readPid(pidPath); ok && other != pid && processAlive(other) {
+			return fmt.Errorf("Pid file '%s' belongs to the running process %d. "+
+				"Stop that process or set disable_pid_file_check to overwrite it", pidPath, other)
+		}
 	}
-	defer pidFile.Close()
 
 	// Write out the PID
-	pid := os.Getpid()
-	_, err = pidFile.WriteString(fmt.Sprintf("%d", pid))
-	if err != nil {
+	if err := writeFileAtomicMode(pidPath, []byte(fmt.Sprintf("%d", pid)), 0644); err != nil {
 		return fmt.Errorf("Could not write to pid file: %s", err)
 	}
 	return nil
 }
 
-// deletePid is used to delete our PID on exit
+// deletePid is used to delete our PID on exit. The file is left alone if
+// it no longer contains our PID since another agent has taken it over.
 func (a *Agent) deletePid() error {
 	// Quit fast if no pidfile
-	pidPath := a.config.PidFile
+	pidPath := a.RuntimeConfig().PidFile
 	if pidPath == "" {
 		return nil
 	}
@@ -1895,6 +2189,11 @@ func (a *Agent) deletePid() error {
 		return fmt.Errorf("Specified pid file path is directory")
 	}
 
+	if pid, ok := readPid(pidPath); ok && pid != os.Getpid() {
+		a.logger.Printf("[WARN] agent: not removing pid file '%s' which belongs to process %d", pidPath, pid)
+		return nil
+	}
+
 	err = os.Remove(pidPath)
 	if err != nil {
 		return fmt.Errorf("Could not remove pid file: %s", err)
@@ -1902,20 +2201,36 @@ func (a *Agent) deletePid() error {
 	return nil
 }
 
+// readPid returns the PID stored in the given file. It returns false if
+// the file does not exist or does not contain a PID.
+func readPid(path string) (int, bool) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil || pid <= 0 {
+		return 0, false
+	}
+	return pid, true
+}
+
 // loadServices will load service definitions from configuration and persisted
 // definitions on disk, and load them into the local agent.
 func (a *Agent) loadServices(conf *Config) error {
 	// Register the services from config
+	a.configServices = make(map[string]*structs.ServiceDefinition)
 	for _, service := range conf.Services {
 		ns := service.NodeService()
 		chkTypes := service.CheckTypes()
-		if err := a.AddService(ns, chkTypes, false, service.Token); err != nil {
+		if err := a.AddService(ns, chkTypes, false, service.Token, ConfigSourceLocal); err != nil {
 			return fmt.Errorf("Failed to register service '%s': %v", service.ID, err)
 		}
+		a.configServices[ns.ID] = service
 	}
 
 	// Load any persisted services
-	svcDir := filepath.Join(a.config.DataDir, servicesDir)
+	svcDir := filepath.Join(a.RuntimeConfig().DataDir, servicesDir)
 	files, err := ioutil.ReadDir(svcDir)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -1948,6 +2263,9 @@ func (a *Agent) loadServices(conf *Config) error {
 		if err != nil {
 			return fmt.Errorf("failed reading service file %q: %s", file, err)
 		}
+		if buf, err = a.openDataFile(buf); err != nil {
+			return fmt.Errorf("failed reading service file %q: %s", file, err)
+		}
 
 		// Try decoding the service definition
 		var p persistedService
@@ -1970,7 +2288,7 @@ func (a *Agent) loadServices(conf *Config) error {
 		} else {
 			a.logger.Printf("[DEBUG] agent: restored service definition %q from %q",
 				serviceID, file)
-			if err := a.AddService(p.Service, nil, false, p.Token); err != nil {
+			if err := a.AddService(p.Service, nil, false, p.Token, ConfigSourceRemote); err != nil {
 				return fmt.Errorf("failed adding service %q: %s", serviceID, err)
 			}
 		}
@@ -1995,16 +2313,18 @@ func (a *Agent) unloadServices() error {
 // disk and re-registers them with the local agent.
 func (a *Agent) loadChecks(conf *Config) error {
 	// Register the checks from config
+	a.configChecks = make(map[types.CheckID]*structs.CheckDefinition)
 	for _, check := range conf.Checks {
 		health := check.HealthCheck(conf.NodeName)
 		chkType := check.CheckType()
-		if err := a.AddCheck(health, chkType, false, check.Token); err != nil {
+		if err := a.AddCheck(health, chkType, false, check.Token, ConfigSourceLocal); err != nil {
 			return fmt.Errorf("Failed to register check '%s': %v %v", check.Name, err, check)
 		}
+		a.configChecks[health.CheckID] = check
 	}
 
 	// Load any persisted checks
-	checkDir := filepath.Join(a.config.DataDir, checksDir)
+	checkDir := filepath.Join(a.RuntimeConfig().DataDir, checksDir)
 	files, err := ioutil.ReadDir(checkDir)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -2031,6 +2351,9 @@ func (a *Agent) loadChecks(conf *Config) error {
 		if err != nil {
 			return fmt.Errorf("failed reading check file %q: %s", file, err)
 		}
+		if buf, err = a.openDataFile(buf); err != nil {
+			return fmt.Errorf("failed reading check file %q: %s", file, err)
+		}
 
 		// Decode the check
 		var p persistedCheck
@@ -2052,7 +2375,7 @@ func (a *Agent) loadChecks(conf *Config) error {
 			// services into the active pool
 			p.Check.Status = api.HealthCritical
 
-			if err := a.AddCheck(p.Check, p.ChkType, false, p.Token); err != nil {
+			if err := a.AddCheck(p.Check, p.ChkType, false, p.Token, ConfigSourceRemote); err != nil {
 				// Purge the check if it is unable to be restored.
 				a.logger.Printf("[WARN] agent: Failed to restore check %q: %s",
 					checkID, err)
@@ -2079,6 +2402,111 @@ func (a *Agent) unloadChecks() error {
 	return nil
 }
 
+// reloadServices registers the services from the configuration which were
+// added or changed since they were last loaded and deregisters the ones
+// which are no longer configured. Unchanged services and services
+// registered via the HTTP API are left alone so that the cost of a reload
+// does not grow with the number of services.
+func (a *Agent) reloadServices(conf *Config) error {
+	services := make(map[string]*structs.ServiceDefinition)
+	for _, service := range conf.Services {
+		services[service.NodeService().ID] = service
+	}
+
+	for id := range a.configServices {
+		if _, ok := services[id]; ok {
+			continue
+		}
+		if err := a.RemoveService(id, false); err != nil {
+			return fmt.Errorf("Failed deregistering service '%s': %v", id, err)
+		}
+		delete(a.configServices, id)
+	}
+
+	registered := a.state.Services()
+	for id, service := range services {
+		old, ok := a.configServices[id]
+		if _, exists := registered[id]; ok && exists && reflect.DeepEqual(old, service) {
+			continue
+		}
+		if !ok {
+			// Purge a previously persisted service. This allows config to
+			// be preferred over services persisted from the API.
+			if err := a.purgeService(id); err != nil {
+				return fmt.Errorf("failed purging service %q: %s", id, err)
+			}
+		}
+
+		ns := service.NodeService()
+		chkTypes := service.CheckTypes()
+		if err := a.AddService(ns, chkTypes, false, service.Token, ConfigSourceLocal); err != nil {
+			return fmt.Errorf("Failed to register service '%s': %v", id, err)
+		}
+		if ok {
+			// Deregister the checks which were removed from the definition.
+			keep := make(map[types.CheckID]bool)
+			for i := range chkTypes {
+				keep[serviceCheckID(id, chkTypes, i)] = true
+			}
+			oldTypes := old.CheckTypes()
+			for i := range oldTypes {
+				if checkID := serviceCheckID(id, oldTypes, i); !keep[checkID] {
+					if err := a.RemoveCheck(checkID, false); err != nil {
+						return fmt.Errorf("Failed deregistering check '%s': %s", checkID, err)
+					}
+				}
+			}
+		}
+		a.configServices[id] = service
+	}
+	return nil
+}
+
+// reloadChecks registers the checks from the configuration which were added
+// or changed since they were last loaded and deregisters the ones which are
+// no longer configured. It must be called after reloadServices.
+func (a *Agent) reloadChecks(conf *Config) error {
+	checks := make(map[types.CheckID]*structs.CheckDefinition)
+	for _, check := range conf.Checks {
+		checks[check.HealthCheck(conf.NodeName).CheckID] = check
+	}
+
+	for id := range a.configChecks {
+		if _, ok := checks[id]; ok {
+			continue
+		}
+		if err := a.RemoveCheck(id, false); err != nil {
+			return fmt.Errorf("Failed deregistering check '%s': %s", id, err)
+		}
+		delete(a.configChecks, id)
+	}
+
+	// Checks are registered again if they are no longer registered since
+	// they are deregistered with their service.
+	registered := a.state.Checks()
+	for id, check := range checks {
+		old, ok := a.configChecks[id]
+		if _, exists := registered[id]; ok && exists && reflect.DeepEqual(old, check) {
+			continue
+		}
+		if !ok {
+			// Purge a previously persisted check. This allows config to be
+			// preferred over checks persisted from the API.
+			if err := a.purgeCheck(id); err != nil {
+				return fmt.Errorf("Failed purging check %q: %s", id, err)
+			}
+		}
+
+		health := check.HealthCheck(conf.NodeName)
+		chkType := check.CheckType()
+		if err := a.AddCheck(health, chkType, false, check.Token, ConfigSourceLocal); err != nil {
+			return fmt.Errorf("Failed to register check '%s': %v %v", check.Name, err, check)
+		}
+		a.configChecks[id] = check
+	}
+	return nil
+}
+
 // snapshotCheckState is used to snapshot the current state of the health
 // checks. This is done before we reload our checks, so that we can properly
 // restore into the same state.
@@ -2144,7 +2572,7 @@ func (a *Agent) EnableServiceMaintenance(serviceID, reason, token string) error
 
 	// Create and register the critical health check
 	check := &structs.HealthCheck{
-		Node:        a.config.NodeName,
+		Node:        a.RuntimeConfig().NodeName,
 		CheckID:     checkID,
 		Name:        "Service Maintenance Mode",
 		Notes:       reason,
@@ -2152,7 +2580,7 @@ func (a *Agent) EnableServiceMaintenance(serviceID, reason, token string) error
 		ServiceName: service.Service,
 		Status:      api.HealthCritical,
 	}
-	a.AddCheck(check, nil, true, token)
+	a.AddCheck(check, nil, true, token, ConfigSourceLocal)
 	a.logger.Printf("[INFO] agent: Service %q entered maintenance mode", serviceID)
 
 	return nil
@@ -2192,13 +2620,13 @@ func (a *Agent) EnableNodeMaintenance(reason, token string) {
 
 	// Create and register the node maintenance check
 	check := &structs.HealthCheck{
-		Node:    a.config.NodeName,
+		Node:    a.RuntimeConfig().NodeName,
 		CheckID: structs.NodeMaint,
 		Name:    "Node Maintenance Mode",
 		Notes:   reason,
 		Status:  api.HealthCritical,
 	}
-	a.AddCheck(check, nil, true, token)
+	a.AddCheck(check, nil, true, token, ConfigSourceLocal)
 	a.logger.Printf("[INFO] agent: Node entered maintenance mode")
 }
 
@@ -2211,6 +2639,35 @@ func (a *Agent) DisableNodeMaintenance() {
 	a.logger.Printf("[INFO] agent: Node left maintenance mode")
 }
 
+// SetConfigStale registers a warning check on the node while the
+// configuration files differ from the ones the running configuration was
+// loaded from and removes it once they match again.
+func (a *Agent) SetConfigStale(stale bool, notes string) {
+	existing, ok := a.state.Checks()[structs.ConfigStale]
+	if !stale {
+		if ok {
+			a.RemoveCheck(structs.ConfigStale, false)
+			a.logger.Printf("[INFO] agent: Configuration files match the running configuration")
+		}
+		return
+	}
+	if ok && existing.Notes == notes {
+		return
+	}
+
+	check := &structs.HealthCheck{
+		Node:    a.RuntimeConfig().NodeName,
+		CheckID: structs.ConfigStale,
+		Name:    "Configuration Reload Pending",
+		Notes:   notes,
+		Status:  api.HealthWarning,
+	}
+	a.AddCheck(check, nil, false, "", ConfigSourceLocal)
+	if !ok {
+		a.logger.Printf("[WARN] agent: Configuration files changed since the configuration was loaded")
+	}
+}
+
 func (a *Agent) ReloadConfig(newCfg *Config) error {
 	// Bulk update the services and checks
 	a.PauseSync()
@@ -2220,23 +2677,16 @@ func (a *Agent) ReloadConfig(newCfg *Config) error {
 	snap := a.snapshotCheckState()
 	defer a.restoreCheckState(snap)
 
-	// First unload all checks, services, and metadata. This lets us begin the reload
-	// with a clean slate.
-	if err := a.unloadServices(); err != nil {
-		return fmt.Errorf("Failed unloading services: %s", err)
-	}
-	if err := a.unloadChecks(); err != nil {
-		return fmt.Errorf("Failed unloading checks: %s", err)
-	}
-	a.unloadMetadata()
-
-	// Reload service/check definitions and metadata.
-	if err := a.loadServices(newCfg); err != nil {
+	// Only register the service and check definitions which changed.
+	if err := a.reloadServices(newCfg); err != nil {
 		return fmt.Errorf("Failed reloading services: %s", err)
 	}
-	if err := a.loadChecks(newCfg); err != nil {
+	if err := a.reloadChecks(newCfg); err != nil {
 		return fmt.Errorf("Failed reloading checks: %s", err)
 	}
+
+	// Reload metadata from a clean slate.
+	a.unloadMetadata()
 	if err := a.loadMetadata(newCfg); err != nil {
 		return fmt.Errorf("Failed reloading metadata: %s", err)
 	}
@@ -2245,8 +2695,108 @@ func (a *Agent) ReloadConfig(newCfg *Config) error {
 		return fmt.Errorf("Failed reloading watches: %v", err)
 	}
 
-	// Update filtered metrics
-	metrics.UpdateFilter(newCfg.Telemetry.AllowedPrefixes, newCfg.Telemetry.BlockedPrefixes)
+	a.setSecretFiles(newCfg)
 
+	old := a.RuntimeConfig()
+	if keys := restartConfigKeys(old, newCfg); len(keys) > 0 {
+		a.logger.Printf("[WARN] agent: Changes to %s require a restart and were not applied", strings.Join(keys, ", "))
+	}
+	cur := reloadedConfig(old, newCfg)
+	a.config.Store(cur)
+	a.reloadSecrets(old, cur)
+	a.notifyConfigChange(old, cur)
 	return nil
 }
+
+// reloadSecrets applies the tokens and the gossip key which changed with a
+// reload, e.g. because the files behind their secret references were
+// rotated. Tokens which didn't change in the configuration are left alone
+// so that tokens set through the API are kept. A new gossip key is only
+// installed in the keyrings since it can only be used once every member
+// has it.
+func (a *Agent) reloadSecrets(old, cur *Config) {
+	if cur.ACLToken != old.ACLToken {
+		a.tokens.UpdateUserToken(cur.ACLToken)
+	}
+	if cur.ACLAgentToken != old.ACLAgentToken {
+		a.tokens.UpdateAgentToken(cur.ACLAgentToken)
+	}
+	if cur.ACLAgentMasterToken != old.ACLAgentMasterToken {
+		a.tokens.UpdateAgentMasterToken(cur.ACLAgentMasterToken)
+	}
+	if cur.ACLReplicationToken != old.ACLReplicationToken {
+		a.tokens.UpdateACLReplicationToken(cur.ACLReplicationToken)
+	}
+
+	if cur.EncryptKey != old.EncryptKey && cur.EncryptKey != "" && a.delegate.Encrypted() {
+		if _, err := a.InstallKey(cur.EncryptKey, a.tokens.AgentToken(), 0); err != nil {
+			a.logger.Printf("[ERR] agent: Failed to install the reloaded gossip key: %v", err)
+			return
+		}
+		a.logger.Printf("[INFO] agent: Installed the reloaded gossip key, use 'consul keyring -use' to make it the primary key")
+	}
+}
+
+// reloadableConfigKeys are the configuration keys of the settings which
+// reloadedConfig takes from the new configuration.
+var reloadableConfigKeys = map[string]bool{
+	"service":                 true,
+	"services":                true,
+	"check":                   true,
+	"checks":                  true,
+	"node_meta":               true,
+	"node_meta_file":          true,
+	"license_path":            true,
+	"license":                 true,
+	"watches":                 true,
+	"log_level":               true,
+	"telemetry.prefix_filter": true,
+	"acl_token":               true,
+	"acl_agent_token":         true,
+	"acl_agent_master_token":  true,
+	"acl_replication_token":   true,
+	"encrypt":                 true,
+}
+
+// restartConfigKeys returns the keys of the changes from the running
+// configuration cur to newCfg which a reload does not apply. The node ID
+// generated by the agent is not reported as a change.
+func restartConfigKeys(cur, newCfg *Config) []string {
+	next := *newCfg
+	if next.NodeID == "" {
+		next.NodeID = cur.NodeID
+	}
+	var keys []string
+	for _, change := range cur.Diff(&next) {
+		if !change.Reloadable {
+			keys = append(keys, change.Key)
+		}
+	}
+	return keys
+}
+
+// reloadedConfig returns a copy of the running configuration in which the
+// settings applied by ReloadConfig are taken from newCfg. All other
+// settings require a restart and keep their running values.
+func reloadedConfig(cur, newCfg *Config) *Config {
+	c := *cur
+	c.Services = newCfg.Services
+	c.Checks = newCfg.Checks
+	c.Meta = newCfg.Meta
+	c.NodeMetaFile = newCfg.NodeMetaFile
+	c.LicensePath = newCfg.LicensePath
+	c.License = newCfg.License
+	c.Watches = newCfg.Watches
+	c.WatchPlans = newCfg.WatchPlans
+	c.LogLevel = newCfg.LogLevel
+	c.SecretRefs = newCfg.SecretRefs
+	c.ACLToken = newCfg.ACLToken
+	c.ACLAgentToken = newCfg.ACLAgentToken
+	c.ACLAgentMasterToken = newCfg.ACLAgentMasterToken
+	c.ACLReplicationToken = newCfg.ACLReplicationToken
+	c.EncryptKey = newCfg.EncryptKey
+	c.Telemetry.PrefixFilter = newCfg.Telemetry.PrefixFilter
+	c.Telemetry.AllowedPrefixes = newCfg.Telemetry.AllowedPrefixes
+	c.Telemetry.BlockedPrefixes = newCfg.Telemetry.BlockedPrefixes
+	return &c
+}
@@ -2,6 +2,8 @@ package agent
 
 import (
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"strconv"
@@ -27,8 +29,9 @@ type Self struct {
 }
 
 func (s *HTTPServer) AgentSelf(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	cfg := s.agent.RuntimeConfig()
 	var c *coordinate.Coordinate
-	if !s.agent.config.DisableCoordinates {
+	if !cfg.DisableCoordinates {
 		var err error
 		if c, err = s.agent.GetLANCoordinate(); err != nil {
 			return nil, err
@@ -42,12 +45,12 @@ func (s *HTTPServer) AgentSelf(resp http.ResponseWriter, req *http.Request) (int
 	if err != nil {
 		return nil, err
 	}
-	if rule != nil && !rule.AgentRead(s.agent.config.NodeName) {
+	if rule != nil && !rule.AgentRead(cfg.NodeName) {
 		return nil, acl.ErrPermissionDenied
 	}
 
 	return Self{
-		Config: s.agent.config,
+		Config: cfg.Sanitized(),
 		Coord:  c,
 		Member: s.agent.LocalMember(),
 		Stats:  s.agent.Stats(),
@@ -63,7 +66,7 @@ func (s *HTTPServer) AgentMetrics(resp http.ResponseWriter, req *http.Request) (
 	if err != nil {
 		return nil, err
 	}
-	if rule != nil && !rule.AgentRead(s.agent.config.NodeName) {
+	if rule != nil && !rule.AgentRead(s.agent.RuntimeConfig().NodeName) {
 		return nil, acl.ErrPermissionDenied
 	}
 
@@ -83,25 +86,40 @@ func (s *HTTPServer) AgentReload(resp http.ResponseWriter, req *http.Request) (i
 	if err != nil {
 		return nil, err
 	}
-	if rule != nil && !rule.AgentWrite(s.agent.config.NodeName) {
+	if rule != nil && !rule.AgentWrite(s.agent.RuntimeConfig().NodeName) {
 		return nil, acl.ErrPermissionDenied
 	}
 
 	// Trigger the reload
-	errCh := make(chan error, 0)
-	select {
-	case <-s.agent.shutdownCh:
-		return nil, fmt.Errorf("Agent was shutdown before reload could be completed")
-	case s.agent.reloadCh <- errCh:
+	return nil, s.agent.TriggerReload()
+}
+
+func (s *HTTPServer) AgentConfigValidate(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	cfg := s.agent.RuntimeConfig()
+	if req.Method != "PUT" {
+		resp.WriteHeader(http.StatusMethodNotAllowed)
+		return nil, nil
 	}
 
-	// Wait for the result of the reload, or for the agent to shutdown
-	select {
-	case <-s.agent.shutdownCh:
-		return nil, fmt.Errorf("Agent was shutdown before reload could be completed")
-	case err := <-errCh:
+	// Fetch the ACL token, if any, and enforce agent policy.
+	var token string
+	s.parseToken(req, &token)
+	rule, err := s.agent.resolveToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if rule != nil && !rule.AgentRead(cfg.NodeName) {
+		return nil, acl.ErrPermissionDenied
+	}
+
+	// Read one byte more than the limit so that larger documents are
+	// rejected instead of truncated.
+	limits := DefaultConfigLimits()
+	data, err := ioutil.ReadAll(io.LimitReader(req.Body, limits.MaxFileSize+1))
+	if err != nil {
 		return nil, err
 	}
+	return ValidateConfigDocument(data, limits, cfg), nil
 }
 
 func (s *HTTPServer) AgentServices(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
@@ -175,7 +193,7 @@ func (s *HTTPServer) AgentJoin(resp http.ResponseWriter, req *http.Request) (int
 	if err != nil {
 		return nil, err
 	}
-	if rule != nil && !rule.AgentWrite(s.agent.config.NodeName) {
+	if rule != nil && !rule.AgentWrite(s.agent.RuntimeConfig().NodeName) {
 		return nil, acl.ErrPermissionDenied
 	}
 
@@ -208,7 +226,7 @@ func (s *HTTPServer) AgentLeave(resp http.ResponseWriter, req *http.Request) (in
 	if err != nil {
 		return nil, err
 	}
-	if rule != nil && !rule.AgentWrite(s.agent.config.NodeName) {
+	if rule != nil && !rule.AgentWrite(s.agent.RuntimeConfig().NodeName) {
 		return nil, acl.ErrPermissionDenied
 	}
 
@@ -226,7 +244,7 @@ func (s *HTTPServer) AgentForceLeave(resp http.ResponseWriter, req *http.Request
 	if err != nil {
 		return nil, err
 	}
-	if rule != nil && !rule.AgentWrite(s.agent.config.NodeName) {
+	if rule != nil && !rule.AgentWrite(s.agent.RuntimeConfig().NodeName) {
 		return nil, acl.ErrPermissionDenied
 	}
 
@@ -271,7 +289,7 @@ func (s *HTTPServer) AgentRegisterCheck(resp http.ResponseWriter, req *http.Requ
 	}
 
 	// Construct the health check.
-	health := args.HealthCheck(s.agent.config.NodeName)
+	health := args.HealthCheck(s.agent.RuntimeConfig().NodeName)
 
 	// Verify the check type.
 	chkType := args.CheckType()
@@ -289,7 +307,7 @@ func (s *HTTPServer) AgentRegisterCheck(resp http.ResponseWriter, req *http.Requ
 	}
 
 	// Add the check.
-	if err := s.agent.AddCheck(health, chkType, true, token); err != nil {
+	if err := s.agent.AddCheck(health, chkType, true, token, ConfigSourceRemote); err != nil {
 		return nil, err
 	}
 	s.syncChanges()
@@ -405,12 +423,6 @@ func (s *HTTPServer) AgentCheckUpdate(resp http.ResponseWriter, req *http.Reques
 		return nil, nil
 	}
 
-	total := len(update.Output)
-	if total > CheckBufSize {
-		update.Output = fmt.Sprintf("%s ... (captured %d of %d bytes)",
-			update.Output[:CheckBufSize], CheckBufSize, total)
-	}
-
 	checkID := types.CheckID(strings.TrimPrefix(req.URL.Path, "/v1/agent/check/update/"))
 
 	// Get the provided token, if any, and vet against any ACL policies.
@@ -503,7 +515,7 @@ func (s *HTTPServer) AgentRegisterService(resp http.ResponseWriter, req *http.Re
 	}
 
 	// Add the service.
-	if err := s.agent.AddService(ns, chkTypes, true, token); err != nil {
+	if err := s.agent.AddService(ns, chkTypes, true, token, ConfigSourceRemote); err != nil {
 		return nil, err
 	}
 	s.syncChanges()
@@ -613,7 +625,7 @@ func (s *HTTPServer) AgentNodeMaintenance(resp http.ResponseWriter, req *http.Re
 	if err != nil {
 		return nil, err
 	}
-	if rule != nil && !rule.NodeWrite(s.agent.config.NodeName) {
+	if rule != nil && !rule.NodeWrite(s.agent.RuntimeConfig().NodeName) {
 		return nil, acl.ErrPermissionDenied
 	}
 
@@ -640,7 +652,7 @@ func (s *HTTPServer) AgentMonitor(resp http.ResponseWriter, req *http.Request) (
 	if err != nil {
 		return nil, err
 	}
-	if rule != nil && !rule.AgentRead(s.agent.config.NodeName) {
+	if rule != nil && !rule.AgentRead(s.agent.RuntimeConfig().NodeName) {
 		return nil, acl.ErrPermissionDenied
 	}
 
@@ -728,7 +740,7 @@ func (s *HTTPServer) AgentToken(resp http.ResponseWriter, req *http.Request) (in
 	if err != nil {
 		return nil, err
 	}
-	if rule != nil && !rule.AgentWrite(s.agent.config.NodeName) {
+	if rule != nil && !rule.AgentWrite(s.agent.RuntimeConfig().NodeName) {
 		return nil, acl.ErrPermissionDenied
 	}
 
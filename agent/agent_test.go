@@ -3,10 +3,15 @@ package agent
 import (
 	"bytes"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"reflect"
 	"runtime"
@@ -18,6 +23,7 @@ import (
 	"github.com/hashicorp/consul/agent/structs"
 	"github.com/hashicorp/consul/api"
 	"github.com/hashicorp/consul/testutil"
+	"github.com/hashicorp/consul/testutil/retry"
 	"github.com/hashicorp/consul/types"
 	"github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/raft"
@@ -80,6 +86,32 @@ func TestAgent_RPCPing(t *testing.T) {
 	}
 }
 
+func TestListenNetwork(t *testing.T) {
+	t.Parallel()
+	v4 := &net.TCPAddr{IP: net.ParseIP("0.0.0.0"), Port: 8500}
+	v6 := &net.TCPAddr{IP: net.ParseIP("::"), Port: 8500}
+	v6Other := &net.TCPAddr{IP: net.ParseIP("::"), Port: 8501}
+	udp6 := &net.UDPAddr{IP: net.ParseIP("::"), Port: 8500}
+	sock := &net.UnixAddr{Name: "/tmp/consul.sock", Net: "unix"}
+	addrs := []ProtoAddr{{"http", v4}, {"http", v6}, {"https", v6Other}, {"dns", udp6}, {"http", sock}}
+
+	tests := []struct {
+		addr net.Addr
+		want string
+	}{
+		{v4, "tcp"},
+		{v6, "tcp6"},
+		{v6Other, "tcp"},
+		{udp6, "udp"},
+		{sock, "unix"},
+	}
+	for _, tt := range tests {
+		if got := listenNetwork(tt.addr, addrs); got != tt.want {
+			t.Fatalf("%s: got %q want %q", tt.addr, got, tt.want)
+		}
+	}
+}
+
 func TestAgent_CheckSerfBindAddrsSettings(t *testing.T) {
 	t.Parallel()
 	if runtime.GOOS == "darwin" {
@@ -305,6 +337,15 @@ func TestAgent_setupNodeID(t *testing.T) {
 	if id := a.consulConfig().NodeID; string(id) != "adf4238a-882b-9ddc-4a9d-5b6758e4159e" {
 		t.Fatalf("bad: %q vs. %q", id, newID)
 	}
+
+	// The legacy upper case ID in the file should have been migrated.
+	raw, err := ioutil.ReadFile(fileID)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(raw) != "adf4238a-882b-9ddc-4a9d-5b6758e4159e" {
+		t.Fatalf("bad: %q", raw)
+	}
 }
 
 func TestAgent_makeNodeID(t *testing.T) {
@@ -463,7 +504,7 @@ func TestAgent_AddService(t *testing.T) {
 		t.Run(tt.desc, func(t *testing.T) {
 			// check the service registration
 			t.Run(tt.srv.ID, func(t *testing.T) {
-				err := a.AddService(tt.srv, tt.chkTypes, false, "")
+				err := a.AddService(tt.srv, tt.chkTypes, false, "", ConfigSourceLocal)
 				if err != nil {
 					t.Fatalf("err: %v", err)
 				}
@@ -523,7 +564,7 @@ func TestAgent_RemoveService(t *testing.T) {
 		}
 		chkTypes := []*structs.CheckType{&structs.CheckType{TTL: time.Minute}}
 
-		if err := a.AddService(srv, chkTypes, false, ""); err != nil {
+		if err := a.AddService(srv, chkTypes, false, "", ConfigSourceLocal); err != nil {
 			t.Fatalf("err: %v", err)
 		}
 
@@ -535,7 +576,7 @@ func TestAgent_RemoveService(t *testing.T) {
 			TTL:       time.Minute,
 		}
 		hc := check.HealthCheck("node1")
-		if err := a.AddCheck(hc, check.CheckType(), false, ""); err != nil {
+		if err := a.AddCheck(hc, check.CheckType(), false, "", ConfigSourceLocal); err != nil {
 			t.Fatalf("err: %s", err)
 		}
 
@@ -561,7 +602,7 @@ func TestAgent_RemoveService(t *testing.T) {
 			&structs.CheckType{TTL: time.Minute},
 			&structs.CheckType{TTL: 30 * time.Second},
 		}
-		if err := a.AddService(srv, chkTypes, false, ""); err != nil {
+		if err := a.AddService(srv, chkTypes, false, "", ConfigSourceLocal); err != nil {
 			t.Fatalf("err: %v", err)
 		}
 
@@ -607,7 +648,7 @@ func TestAgent_RemoveServiceRemovesAllChecks(t *testing.T) {
 	hchk2 := &structs.HealthCheck{Node: "node1", CheckID: "chk2", Name: "chk2", Status: "critical", ServiceID: "redis", ServiceName: "redis"}
 
 	// register service with chk1
-	if err := a.AddService(svc, []*structs.CheckType{chk1}, false, ""); err != nil {
+	if err := a.AddService(svc, []*structs.CheckType{chk1}, false, "", ConfigSourceLocal); err != nil {
 		t.Fatal("Failed to register service", err)
 	}
 
@@ -617,7 +658,7 @@ func TestAgent_RemoveServiceRemovesAllChecks(t *testing.T) {
 	}
 
 	// update the service with chk2
-	if err := a.AddService(svc, []*structs.CheckType{chk2}, false, ""); err != nil {
+	if err := a.AddService(svc, []*structs.CheckType{chk2}, false, "", ConfigSourceLocal); err != nil {
 		t.Fatal("Failed to update service", err)
 	}
 
@@ -660,7 +701,7 @@ func TestAgent_AddCheck(t *testing.T) {
 		Script:   "exit 0",
 		Interval: 15 * time.Second,
 	}
-	err := a.AddCheck(health, chk, false, "")
+	err := a.AddCheck(health, chk, false, "", ConfigSourceLocal)
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -699,7 +740,7 @@ func TestAgent_AddCheck_StartPassing(t *testing.T) {
 		Script:   "exit 0",
 		Interval: 15 * time.Second,
 	}
-	err := a.AddCheck(health, chk, false, "")
+	err := a.AddCheck(health, chk, false, "", ConfigSourceLocal)
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -738,7 +779,7 @@ func TestAgent_AddCheck_MinInterval(t *testing.T) {
 		Script:   "exit 0",
 		Interval: time.Microsecond,
 	}
-	err := a.AddCheck(health, chk, false, "")
+	err := a.AddCheck(health, chk, false, "", ConfigSourceLocal)
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -756,6 +797,93 @@ func TestAgent_AddCheck_MinInterval(t *testing.T) {
 	}
 }
 
+func TestAgent_AddCheck_AgentTLS(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, ca, 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	cfg := TestConfig()
+	cfg.EnableAgentTLSForChecks = true
+	cfg.CAFile = caFile
+	cfg.ServerName = "example.com"
+	a := NewTestAgent(t.Name(), cfg)
+	defer a.Shutdown()
+
+	tests := []struct {
+		id      types.CheckID
+		enable  *bool
+		name    string
+		healthy bool
+	}{
+		{"agent-tls", nil, "", true},
+		{"no-agent-tls", Bool(false), "", false},
+		{"wrong-server-name", nil, "other.example.org", false},
+	}
+	for _, tt := range tests {
+		health := &structs.HealthCheck{Node: "foo", CheckID: tt.id, Name: string(tt.id), Status: api.HealthCritical}
+		chk := &structs.CheckType{
+			HTTP:           server.URL,
+			Interval:       MinInterval,
+			EnableAgentTLS: tt.enable,
+			TLSServerName:  tt.name,
+		}
+		if err := a.AddCheck(health, chk, false, "", ConfigSourceLocal); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	for _, tt := range tests {
+		retry.Run(t, func(r *retry.R) {
+			c := a.state.Checks()[tt.id]
+			if healthy := c.Status == api.HealthPassing; healthy != tt.healthy {
+				r.Fatalf("%s: got status %q output %q", tt.id, c.Status, c.Output)
+			}
+		})
+	}
+}
+
+func TestAgent_AddCheck_HTTPDefaults(t *testing.T) {
+	t.Parallel()
+	cfg := TestConfig()
+	cfg.CheckDefaults.HTTP = HTTPCheckDefaults{
+		Timeout:       3 * time.Second,
+		TLSSkipVerify: true,
+		Headers:       map[string][]string{"x-foo": {"a"}, "X-Bar": {"b"}},
+		OutputMaxSize: 100,
+	}
+	a := NewTestAgent(t.Name(), cfg)
+	defer a.Shutdown()
+
+	add := func(id types.CheckID, chk *structs.CheckType) *CheckHTTP {
+		chk.HTTP = "http://127.0.0.1:0"
+		chk.Interval = 10 * time.Second
+		health := &structs.HealthCheck{Node: "foo", CheckID: id, Name: string(id), Status: api.HealthCritical}
+		if err := a.AddCheck(health, chk, false, "", ConfigSourceLocal); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		return a.checkHTTPs[id]
+	}
+
+	got := add("defaults", &structs.CheckType{Header: map[string][]string{"x-bar": {"c"}}})
+	want := map[string][]string{"X-Foo": {"a"}, "X-Bar": {"c"}}
+	if got.Timeout != 3*time.Second || !got.TLSSkipVerify || got.OutputMaxSize != 100 {
+		t.Fatalf("got timeout %v skip verify %v output max size %d", got.Timeout, got.TLSSkipVerify, got.OutputMaxSize)
+	}
+	verify.Values(t, "header", got.Header, want)
+
+	got = add("own", &structs.CheckType{Timeout: time.Second, OutputMaxSize: 50, TLSSkipVerify: Bool(false)})
+	if got.Timeout != time.Second || got.TLSSkipVerify || got.OutputMaxSize != 50 {
+		t.Fatalf("got timeout %v skip verify %v output max size %d", got.Timeout, got.TLSSkipVerify, got.OutputMaxSize)
+	}
+}
+
 func TestAgent_AddCheck_MissingService(t *testing.T) {
 	t.Parallel()
 	cfg := TestConfig()
@@ -773,7 +901,7 @@ func TestAgent_AddCheck_MissingService(t *testing.T) {
 		Script:   "exit 0",
 		Interval: time.Microsecond,
 	}
-	err := a.AddCheck(health, chk, false, "")
+	err := a.AddCheck(health, chk, false, "", ConfigSourceLocal)
 	if err == nil || err.Error() != `ServiceID "baz" does not exist` {
 		t.Fatalf("expected service id error, got: %v", err)
 	}
@@ -803,7 +931,7 @@ func TestAgent_AddCheck_RestoreState(t *testing.T) {
 	chk := &structs.CheckType{
 		TTL: time.Minute,
 	}
-	err = a.AddCheck(health, chk, false, "")
+	err = a.AddCheck(health, chk, false, "", ConfigSourceLocal)
 	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
@@ -838,7 +966,7 @@ func TestAgent_AddCheck_ExecDisable(t *testing.T) {
 		Script:   "exit 0",
 		Interval: 15 * time.Second,
 	}
-	err := a.AddCheck(health, chk, false, "")
+	err := a.AddCheck(health, chk, false, "", ConfigSourceLocal)
 	if err == nil || !strings.Contains(err.Error(), "Scripts are disabled on this agent") {
 		t.Fatalf("err: %v", err)
 	}
@@ -849,6 +977,42 @@ func TestAgent_AddCheck_ExecDisable(t *testing.T) {
 	}
 }
 
+func TestAgent_AddCheck_LocalScriptChecks(t *testing.T) {
+	t.Parallel()
+	cfg := TestConfig()
+	cfg.EnableLocalScriptChecks = true
+	a := NewTestAgent(t.Name(), cfg)
+	defer a.Shutdown()
+
+	health := &structs.HealthCheck{
+		Node:    "foo",
+		CheckID: "mem",
+		Name:    "memory util",
+		Status:  api.HealthCritical,
+	}
+	chk := &structs.CheckType{
+		Script:   "exit 0",
+		Interval: 15 * time.Second,
+	}
+
+	// Script checks from the HTTP API are still rejected.
+	err := a.AddCheck(health, chk, false, "", ConfigSourceRemote)
+	if err == nil || !strings.Contains(err.Error(), "Scripts are disabled on this agent from remote calls") {
+		t.Fatalf("err: %v", err)
+	}
+	if memChk := a.state.Checks()["mem"]; memChk != nil {
+		t.Fatalf("should be missing mem check")
+	}
+
+	// Script checks from the configuration files are allowed.
+	if err := a.AddCheck(health, chk, false, "", ConfigSourceLocal); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, ok := a.checkMonitors["mem"]; !ok {
+		t.Fatalf("missing mem monitor")
+	}
+}
+
 func TestAgent_RemoveCheck(t *testing.T) {
 	t.Parallel()
 	cfg := TestConfig()
@@ -876,7 +1040,7 @@ func TestAgent_RemoveCheck(t *testing.T) {
 		Script:   "exit 0",
 		Interval: 15 * time.Second,
 	}
-	err := a.AddCheck(health, chk, false, "")
+	err := a.AddCheck(health, chk, false, "", ConfigSourceLocal)
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -913,7 +1077,7 @@ func TestAgent_updateTTLCheck(t *testing.T) {
 	}
 
 	// Add check and update it.
-	err := a.AddCheck(health, chk, false, "")
+	err := a.AddCheck(health, chk, false, "", ConfigSourceLocal)
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -931,6 +1095,47 @@ func TestAgent_updateTTLCheck(t *testing.T) {
 	}
 }
 
+func TestAgent_updateTTLCheck_outputMaxSize(t *testing.T) {
+	t.Parallel()
+	cfg := TestConfig()
+	cfg.CheckOutputMaxSize = 5
+	a := NewTestAgent(t.Name(), cfg)
+	defer a.Shutdown()
+
+	tests := []struct {
+		id      types.CheckID
+		maxSize int
+		out     string
+	}{
+		{"default", 0, "01234 ... (captured 5 of 10 bytes)"},
+		{"override", 8, "01234567 ... (captured 8 of 10 bytes)"},
+		{"fits", 10, "0123456789"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.id), func(t *testing.T) {
+			health := &structs.HealthCheck{
+				Node:    "foo",
+				CheckID: tt.id,
+				Name:    string(tt.id),
+				Status:  api.HealthCritical,
+			}
+			chk := &structs.CheckType{
+				TTL:           15 * time.Second,
+				OutputMaxSize: tt.maxSize,
+			}
+			if err := a.AddCheck(health, chk, false, "", ConfigSourceLocal); err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			if err := a.updateTTLCheck(tt.id, api.HealthPassing, "0123456789"); err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			if got, want := a.state.Checks()[tt.id].Output, tt.out; got != want {
+				t.Fatalf("got %q want %q", got, want)
+			}
+		})
+	}
+}
+
 func TestAgent_PersistService(t *testing.T) {
 	t.Parallel()
 	cfg := TestConfig()
@@ -950,7 +1155,7 @@ func TestAgent_PersistService(t *testing.T) {
 	file := filepath.Join(a.Config.DataDir, servicesDir, stringHash(svc.ID))
 
 	// Check is not persisted unless requested
-	if err := a.AddService(svc, nil, false, ""); err != nil {
+	if err := a.AddService(svc, nil, false, "", ConfigSourceLocal); err != nil {
 		t.Fatalf("err: %v", err)
 	}
 	if _, err := os.Stat(file); err == nil {
@@ -958,7 +1163,7 @@ func TestAgent_PersistService(t *testing.T) {
 	}
 
 	// Persists to file if requested
-	if err := a.AddService(svc, nil, true, "mytoken"); err != nil {
+	if err := a.AddService(svc, nil, true, "mytoken", ConfigSourceLocal); err != nil {
 		t.Fatalf("err: %v", err)
 	}
 	if _, err := os.Stat(file); err != nil {
@@ -981,7 +1186,7 @@ func TestAgent_PersistService(t *testing.T) {
 
 	// Updates service definition on disk
 	svc.Port = 8001
-	if err := a.AddService(svc, nil, true, "mytoken"); err != nil {
+	if err := a.AddService(svc, nil, true, "mytoken", ConfigSourceLocal); err != nil {
 		t.Fatalf("err: %v", err)
 	}
 	expected, err = json.Marshal(persistedService{
@@ -1074,7 +1279,7 @@ func TestAgent_PurgeService(t *testing.T) {
 	}
 
 	file := filepath.Join(a.Config.DataDir, servicesDir, stringHash(svc.ID))
-	if err := a.AddService(svc, nil, true, ""); err != nil {
+	if err := a.AddService(svc, nil, true, "", ConfigSourceLocal); err != nil {
 		t.Fatalf("err: %v", err)
 	}
 
@@ -1087,7 +1292,7 @@ func TestAgent_PurgeService(t *testing.T) {
 	}
 
 	// Re-add the service
-	if err := a.AddService(svc, nil, true, ""); err != nil {
+	if err := a.AddService(svc, nil, true, "", ConfigSourceLocal); err != nil {
 		t.Fatalf("err: %v", err)
 	}
 
@@ -1115,7 +1320,7 @@ func TestAgent_PurgeServiceOnDuplicate(t *testing.T) {
 	}
 
 	// First persist the service
-	if err := a.AddService(svc1, nil, true, ""); err != nil {
+	if err := a.AddService(svc1, nil, true, "", ConfigSourceLocal); err != nil {
 		t.Fatalf("err: %v", err)
 	}
 	a.Shutdown()
@@ -1170,7 +1375,7 @@ func TestAgent_PersistCheck(t *testing.T) {
 	file := filepath.Join(a.Config.DataDir, checksDir, checkIDHash(check.CheckID))
 
 	// Not persisted if not requested
-	if err := a.AddCheck(check, chkType, false, ""); err != nil {
+	if err := a.AddCheck(check, chkType, false, "", ConfigSourceLocal); err != nil {
 		t.Fatalf("err: %v", err)
 	}
 	if _, err := os.Stat(file); err == nil {
@@ -1178,7 +1383,7 @@ func TestAgent_PersistCheck(t *testing.T) {
 	}
 
 	// Should persist if requested
-	if err := a.AddCheck(check, chkType, true, "mytoken"); err != nil {
+	if err := a.AddCheck(check, chkType, true, "mytoken", ConfigSourceLocal); err != nil {
 		t.Fatalf("err: %v", err)
 	}
 	if _, err := os.Stat(file); err != nil {
@@ -1202,7 +1407,7 @@ func TestAgent_PersistCheck(t *testing.T) {
 
 	// Updates the check definition on disk
 	check.Name = "mem1"
-	if err := a.AddCheck(check, chkType, true, "mytoken"); err != nil {
+	if err := a.AddCheck(check, chkType, true, "mytoken", ConfigSourceLocal); err != nil {
 		t.Fatalf("err: %v", err)
 	}
 	expected, err = json.Marshal(persistedCheck{
@@ -1259,7 +1464,7 @@ func TestAgent_PurgeCheck(t *testing.T) {
 	}
 
 	file := filepath.Join(a.Config.DataDir, checksDir, checkIDHash(check.CheckID))
-	if err := a.AddCheck(check, nil, true, ""); err != nil {
+	if err := a.AddCheck(check, nil, true, "", ConfigSourceLocal); err != nil {
 		t.Fatalf("err: %v", err)
 	}
 
@@ -1298,7 +1503,7 @@ func TestAgent_PurgeCheckOnDuplicate(t *testing.T) {
 	}
 
 	// First persist the check
-	if err := a.AddCheck(check1, nil, true, ""); err != nil {
+	if err := a.AddCheck(check1, nil, true, "", ConfigSourceLocal); err != nil {
 		t.Fatalf("err: %v", err)
 	}
 	a.Shutdown()
@@ -1363,7 +1568,7 @@ func TestAgent_unloadChecks(t *testing.T) {
 		Tags:    []string{"foo"},
 		Port:    8000,
 	}
-	if err := a.AddService(svc, nil, false, ""); err != nil {
+	if err := a.AddService(svc, nil, false, "", ConfigSourceLocal); err != nil {
 		t.Fatalf("err: %v", err)
 	}
 
@@ -1376,7 +1581,7 @@ func TestAgent_unloadChecks(t *testing.T) {
 		ServiceID:   "redis",
 		ServiceName: "redis",
 	}
-	if err := a.AddCheck(check1, nil, false, ""); err != nil {
+	if err := a.AddCheck(check1, nil, false, "", ConfigSourceLocal); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 	found := false
@@ -1424,6 +1629,29 @@ func TestAgent_loadServices_token(t *testing.T) {
 	}
 }
 
+func TestAgent_loadServices_meta(t *testing.T) {
+	t.Parallel()
+	cfg := TestConfig()
+	cfg.Services = append(cfg.Services, &structs.ServiceDefinition{
+		Name: "web",
+		Port: 80,
+		Meta: map[string]string{"version": "2"},
+	})
+	a := NewTestAgent(t.Name(), cfg)
+	defer a.Shutdown()
+
+	svc, ok := a.state.Services()["web"]
+	if !ok {
+		t.Fatalf("missing service")
+	}
+	verify.Values(t, "meta", svc.Meta, map[string]string{"version": "2"})
+
+	bad := &structs.NodeService{ID: "db", Service: "db", Meta: map[string]string{"consul-version": "1"}}
+	if err := a.AddService(bad, nil, false, "", ConfigSourceLocal); err == nil || !strings.Contains(err.Error(), "Invalid service meta") {
+		t.Fatalf("got error %v", err)
+	}
+}
+
 func TestAgent_unloadServices(t *testing.T) {
 	t.Parallel()
 	a := NewTestAgent(t.Name(), nil)
@@ -1437,7 +1665,7 @@ func TestAgent_unloadServices(t *testing.T) {
 	}
 
 	// Register the service
-	if err := a.AddService(svc, nil, false, ""); err != nil {
+	if err := a.AddService(svc, nil, false, "", ConfigSourceLocal); err != nil {
 		t.Fatalf("err: %v", err)
 	}
 	found := false
@@ -1460,6 +1688,131 @@ func TestAgent_unloadServices(t *testing.T) {
 	}
 }
 
+func TestAgent_reloadServices(t *testing.T) {
+	t.Parallel()
+	cfg := TestConfig()
+	cfg.Services = []*structs.ServiceDefinition{
+		&structs.ServiceDefinition{Name: "same", Check: structs.CheckType{TTL: time.Minute}},
+		&structs.ServiceDefinition{
+			Name: "changed",
+			Checks: structs.CheckTypes{
+				&structs.CheckType{TTL: time.Minute},
+				&structs.CheckType{TTL: time.Minute},
+			},
+		},
+		&structs.ServiceDefinition{Name: "removed"},
+	}
+	cfg.Checks = []*structs.CheckDefinition{
+		&structs.CheckDefinition{Name: "node", TTL: time.Minute},
+		&structs.CheckDefinition{Name: "on-changed", ServiceID: "changed", TTL: time.Minute},
+		&structs.CheckDefinition{Name: "on-removed", ServiceID: "removed", TTL: time.Minute},
+	}
+	a := NewTestAgent(t.Name(), cfg)
+	defer a.Shutdown()
+
+	// A service registered via the API is left alone.
+	apiSvc := &structs.NodeService{ID: "api", Service: "api"}
+	if err := a.AddService(apiSvc, nil, true, "", ConfigSourceRemote); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := a.updateTTLCheck("node", api.HealthPassing, "ok"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	same := a.state.services["same"]
+
+	cfg2 := TestConfig()
+	cfg2.Services = []*structs.ServiceDefinition{
+		&structs.ServiceDefinition{Name: "same", Check: structs.CheckType{TTL: time.Minute}},
+		&structs.ServiceDefinition{
+			Name:   "changed",
+			Tags:   []string{"v2"},
+			Checks: structs.CheckTypes{&structs.CheckType{TTL: time.Minute}},
+		},
+		&structs.ServiceDefinition{Name: "added"},
+	}
+	cfg2.Checks = []*structs.CheckDefinition{
+		&structs.CheckDefinition{Name: "node", TTL: time.Minute},
+		&structs.CheckDefinition{Name: "on-changed", ServiceID: "changed", TTL: time.Minute},
+	}
+	if err := a.ReloadConfig(cfg2); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	services := a.state.Services()
+	for _, id := range []string{"same", "changed", "added", "api"} {
+		if _, ok := services[id]; !ok {
+			t.Fatalf("missing service %q", id)
+		}
+	}
+	if _, ok := services["removed"]; ok {
+		t.Fatal("removed service is still registered")
+	}
+	if a.state.services["same"] != same {
+		t.Fatal("unchanged service was registered again")
+	}
+	if got, want := services["changed"].Tags, []string{"v2"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got tags %v want %v", got, want)
+	}
+
+	checks := a.state.Checks()
+	for _, id := range []types.CheckID{"service:same", "service:changed", "node", "on-changed"} {
+		if _, ok := checks[id]; !ok {
+			t.Fatalf("missing check %q", id)
+		}
+	}
+	for _, id := range []types.CheckID{"service:changed:1", "service:changed:2", "on-removed"} {
+		if _, ok := checks[id]; ok {
+			t.Fatalf("check %q is still registered", id)
+		}
+	}
+	if got := checks["node"].Status; got != api.HealthPassing {
+		t.Fatalf("got status %q for unchanged check", got)
+	}
+}
+
+func TestAgent_ReloadConfig_RuntimeConfig(t *testing.T) {
+	t.Parallel()
+	cfg := TestConfig()
+	cfg.Services = []*structs.ServiceDefinition{&structs.ServiceDefinition{Name: "redis"}}
+	a := NewTestAgent(t.Name(), cfg)
+	defer a.Shutdown()
+
+	// Readers hold on to the configuration while it is being reloaded.
+	old := a.RuntimeConfig()
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		for i := 0; i < 1000; i++ {
+			if c := a.RuntimeConfig(); len(c.Services) != 1 {
+				t.Errorf("got %d services", len(c.Services))
+				return
+			}
+		}
+	}()
+
+	cfg2 := TestConfig()
+	cfg2.Services = []*structs.ServiceDefinition{&structs.ServiceDefinition{Name: "redis-reloaded"}}
+	cfg2.Ports.HTTP = old.Ports.HTTP + 1
+	if err := a.ReloadConfig(cfg2); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	<-doneCh
+
+	cur := a.RuntimeConfig()
+	if cur == old {
+		t.Fatal("configuration was not replaced")
+	}
+	if got, want := cur.Services, cfg2.Services; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got services %v want %v", got, want)
+	}
+	if got, want := cur.Ports.HTTP, old.Ports.HTTP; got != want {
+		t.Fatalf("got HTTP port %d want %d, it cannot be reloaded", got, want)
+	}
+	if got := old.Services[0].Name; got != "redis" {
+		t.Fatalf("previous configuration was modified: %q", got)
+	}
+}
+
 func TestAgent_Service_MaintenanceMode(t *testing.T) {
 	t.Parallel()
 	a := NewTestAgent(t.Name(), nil)
@@ -1473,7 +1826,7 @@ func TestAgent_Service_MaintenanceMode(t *testing.T) {
 	}
 
 	// Register the service
-	if err := a.AddService(svc, nil, false, ""); err != nil {
+	if err := a.AddService(svc, nil, false, "", ConfigSourceLocal); err != nil {
 		t.Fatalf("err: %v", err)
 	}
 
@@ -1524,6 +1877,55 @@ func TestAgent_Service_MaintenanceMode(t *testing.T) {
 	}
 }
 
+func TestAgent_AddCheck_deregisterCriticalServiceAfter(t *testing.T) {
+	t.Parallel()
+	cfg := TestConfig()
+	cfg.DeregisterCriticalServiceAfter = 2 * time.Minute
+	a := NewTestAgent(t.Name(), cfg)
+	defer a.Shutdown()
+
+	svc := &structs.NodeService{ID: "redis", Service: "redis", Port: 8000}
+	if err := a.AddService(svc, nil, false, "", ConfigSourceLocal); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	tests := []struct {
+		id        types.CheckID
+		serviceID string
+		after     time.Duration
+		want      time.Duration
+	}{
+		{"default", "redis", 0, 2 * time.Minute},
+		{"override", "redis", 5 * time.Minute, 5 * time.Minute},
+		{"below minimum", "redis", time.Second, time.Minute},
+		{"node", "", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.id), func(t *testing.T) {
+			health := &structs.HealthCheck{
+				Node:      "foo",
+				CheckID:   tt.id,
+				Name:      string(tt.id),
+				ServiceID: tt.serviceID,
+				Status:    api.HealthCritical,
+			}
+			chk := &structs.CheckType{
+				TTL:                            15 * time.Second,
+				DeregisterCriticalServiceAfter: tt.after,
+			}
+			if err := a.AddCheck(health, chk, false, "", ConfigSourceLocal); err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			a.checkLock.Lock()
+			got := a.checkReapAfter[tt.id]
+			a.checkLock.Unlock()
+			if got != tt.want {
+				t.Fatalf("got %v want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestAgent_Service_Reap(t *testing.T) {
 	// t.Parallel() // timing test. no parallel
 	cfg := TestConfig()
@@ -1547,7 +1949,7 @@ func TestAgent_Service_Reap(t *testing.T) {
 	}
 
 	// Register the service.
-	if err := a.AddService(svc, chkTypes, false, ""); err != nil {
+	if err := a.AddService(svc, chkTypes, false, "", ConfigSourceLocal); err != nil {
 		t.Fatalf("err: %v", err)
 	}
 
@@ -1620,7 +2022,7 @@ func TestAgent_Service_NoReap(t *testing.T) {
 	}
 
 	// Register the service.
-	if err := a.AddService(svc, chkTypes, false, ""); err != nil {
+	if err := a.AddService(svc, chkTypes, false, "", ConfigSourceLocal); err != nil {
 		t.Fatalf("err: %v", err)
 	}
 
@@ -1663,7 +2065,7 @@ func TestAgent_addCheck_restoresSnapshot(t *testing.T) {
 		Tags:    []string{"foo"},
 		Port:    8000,
 	}
-	if err := a.AddService(svc, nil, false, ""); err != nil {
+	if err := a.AddService(svc, nil, false, "", ConfigSourceLocal); err != nil {
 		t.Fatalf("err: %v", err)
 	}
 
@@ -1676,13 +2078,13 @@ func TestAgent_addCheck_restoresSnapshot(t *testing.T) {
 		ServiceID:   "redis",
 		ServiceName: "redis",
 	}
-	if err := a.AddCheck(check1, nil, false, ""); err != nil {
+	if err := a.AddCheck(check1, nil, false, "", ConfigSourceLocal); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
 	// Re-registering the service preserves the state of the check
 	chkTypes := []*structs.CheckType{&structs.CheckType{TTL: 30 * time.Second}}
-	if err := a.AddService(svc, chkTypes, false, ""); err != nil {
+	if err := a.AddService(svc, chkTypes, false, "", ConfigSourceLocal); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 	check, ok := a.state.Checks()["service:redis"]
@@ -1694,6 +2096,33 @@ func TestAgent_addCheck_restoresSnapshot(t *testing.T) {
 	}
 }
 
+func TestAgent_StartInMaintenance(t *testing.T) {
+	t.Parallel()
+	cfg := TestConfig()
+	cfg.StartInMaintenance = true
+	cfg.StartInMaintenanceReason = "canary rebuild"
+	a := NewTestAgent(t.Name(), cfg)
+	defer a.Shutdown()
+
+	check, ok := a.state.Checks()[structs.NodeMaint]
+	if !ok {
+		t.Fatalf("should have registered critical node check")
+	}
+	if check.Status != api.HealthCritical || check.Notes != "canary rebuild" {
+		t.Fatalf("bad: %#v", check)
+	}
+
+	// Maintenance mode is not entered again on reload once it was
+	// disabled.
+	a.DisableNodeMaintenance()
+	if err := a.ReloadConfig(cfg); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, ok := a.state.Checks()[structs.NodeMaint]; ok {
+		t.Fatalf("should not have registered critical node check")
+	}
+}
+
 func TestAgent_NodeMaintenanceMode(t *testing.T) {
 	t.Parallel()
 	a := NewTestAgent(t.Name(), nil)
@@ -1739,6 +2168,31 @@ func TestAgent_NodeMaintenanceMode(t *testing.T) {
 	}
 }
 
+func TestAgent_SetConfigStale(t *testing.T) {
+	t.Parallel()
+	a := NewTestAgent(t.Name(), nil)
+	defer a.Shutdown()
+
+	a.SetConfigStale(true, "a.json changed")
+	check, ok := a.state.Checks()[structs.ConfigStale]
+	if !ok {
+		t.Fatalf("should have registered warning node check")
+	}
+	if check.Status != api.HealthWarning || check.Notes != "a.json changed" {
+		t.Fatalf("bad: %#v", check)
+	}
+
+	a.SetConfigStale(true, "b.json changed")
+	if check := a.state.Checks()[structs.ConfigStale]; check.Notes != "b.json changed" {
+		t.Fatalf("bad: %#v", check)
+	}
+
+	a.SetConfigStale(false, "")
+	if _, ok := a.state.Checks()[structs.ConfigStale]; ok {
+		t.Fatalf("should have deregistered warning node check")
+	}
+}
+
 func TestAgent_checkStateSnapshot(t *testing.T) {
 	t.Parallel()
 	a := NewTestAgent(t.Name(), nil)
@@ -1751,7 +2205,7 @@ func TestAgent_checkStateSnapshot(t *testing.T) {
 		Tags:    []string{"foo"},
 		Port:    8000,
 	}
-	if err := a.AddService(svc, nil, false, ""); err != nil {
+	if err := a.AddService(svc, nil, false, "", ConfigSourceLocal); err != nil {
 		t.Fatalf("err: %v", err)
 	}
 
@@ -1764,7 +2218,7 @@ func TestAgent_checkStateSnapshot(t *testing.T) {
 		ServiceID:   "redis",
 		ServiceName: "redis",
 	}
-	if err := a.AddCheck(check1, nil, true, ""); err != nil {
+	if err := a.AddCheck(check1, nil, true, "", ConfigSourceLocal); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
@@ -1991,3 +2445,71 @@ func TestAgent_GetCoordinate(t *testing.T) {
 	check(true)
 	check(false)
 }
+
+func TestAgent_storePid(t *testing.T) {
+	t.Parallel()
+	dir := testutil.TempDir(t, "agent")
+	defer os.RemoveAll(dir)
+	pidFile := filepath.Join(dir, "consul.pid")
+
+	newAgent := func(disableCheck bool) *Agent {
+		cfg := TestConfig()
+		cfg.DataDir = dir
+		cfg.PidFile = pidFile
+		cfg.DisablePidFileCheck = disableCheck
+		a, err := New(cfg)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		a.logger = log.New(os.Stderr, "", log.LstdFlags)
+		return a
+	}
+	writePid := func(pid int) {
+		if err := ioutil.WriteFile(pidFile, []byte(fmt.Sprintf("%d\n", pid)), 0644); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	wantPid := func(pid int) {
+		if got, ok := readPid(pidFile); !ok || got != pid {
+			t.Fatalf("got pid %d, %v want %d", got, ok, pid)
+		}
+	}
+
+	// A stale file of a process which is no longer running is replaced.
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	writePid(cmd.Process.Pid)
+	a := newAgent(false)
+	if err := a.storePid(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	wantPid(os.Getpid())
+
+	// The file of a running process is kept unless the check is disabled.
+	writePid(os.Getppid())
+	err := a.storePid()
+	if err == nil || !strings.Contains(err.Error(), "belongs to the running process") {
+		t.Fatalf("got %v want running process error", err)
+	}
+	wantPid(os.Getppid())
+	if err := newAgent(true).storePid(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	wantPid(os.Getpid())
+
+	// The file is only removed on shutdown if it still has our PID.
+	writePid(os.Getppid())
+	if err := a.deletePid(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	wantPid(os.Getppid())
+	writePid(os.Getpid())
+	if err := a.deletePid(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := os.Stat(pidFile); !os.IsNotExist(err) {
+		t.Fatalf("got %v want pid file removed", err)
+	}
+}
@@ -0,0 +1,223 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// auditRotateTimeFormat is appended to the path of rotated audit log files.
+// It sorts lexically in chronological order.
+const auditRotateTimeFormat = "20060102T150405.000000000"
+
+// auditEvent describes a single HTTP API request.
+type auditEvent struct {
+	Time       time.Time `json:"time"`
+	RemoteAddr string    `json:"remote_addr"`
+	Token      string    `json:"token"`
+	Method     string    `json:"method"`
+	URL        string    `json:"url"`
+	Status     int       `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	Duration   string    `json:"duration"`
+}
+
+// auditTokenID returns an identifier for the given ACL token which can be
+// logged without disclosing the token itself.
+func auditTokenID(token string) string {
+	if token == "" {
+		return "anonymous"
+	}
+	h := sha256.Sum256([]byte(token))
+	return "sha256:" + hex.EncodeToString(h[:8])
+}
+
+// auditLog writes audit events to a file and rotates it by size and age.
+type auditLog struct {
+	sink AuditSink
+
+	l      sync.Mutex
+	f      *os.File
+	size   int
+	opened time.Time
+}
+
+// newAuditLog opens the audit log for the given sink.
+func newAuditLog(sink AuditSink) (*auditLog, error) {
+	a := &auditLog{sink: sink}
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// open opens the audit log file for appending.
+func (a *auditLog) open() error {
+	f, err := os.OpenFile(a.sink.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %v", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to open audit log: %v", err)
+	}
+	a.f, a.size, a.opened = f, int(fi.Size()), time.Now()
+	return nil
+}
+
+// rotate moves the current file aside, opens a new one and removes the
+// oldest rotated files beyond the configured maximum.
+func (a *auditLog) rotate() error {
+	if err := a.f.Close(); err != nil {
+		return err
+	}
+	rotated := a.sink.Path + "." + time.Now().UTC().Format(auditRotateTimeFormat)
+	if err := os.Rename(a.sink.Path, rotated); err != nil {
+		return err
+	}
+	if err := a.open(); err != nil {
+		return err
+	}
+
+	if a.sink.RotateMaxFiles <= 0 {
+		return nil
+	}
+	files, err := auditRotatedFiles(a.sink.Path)
+	if err != nil {
+		return err
+	}
+	for len(files) > a.sink.RotateMaxFiles {
+		if err := os.Remove(files[0]); err != nil {
+			return err
+		}
+		files = files[1:]
+	}
+	return nil
+}
+
+// auditRotatedFiles returns the rotated files of the audit log at path,
+// oldest first. Only files named like rotate names them are returned so
+// that other files next to the audit log are never removed.
+func auditRotatedFiles(path string) ([]string, error) {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, fi := range infos {
+		name := fi.Name()
+		if !fi.Mode().IsRegular() || !strings.HasPrefix(name, base+".") {
+			continue
+		}
+		suffix := strings.TrimPrefix(name, base+".")
+		t, err := time.Parse(auditRotateTimeFormat, suffix)
+		if err != nil || t.Format(auditRotateTimeFormat) != suffix {
+			continue
+		}
+		files = append(files, filepath.Join(dir, name))
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// format encodes the event in the configured format.
+func (a *auditLog) format(e *auditEvent) ([]byte, error) {
+	if a.sink.Format == "text" {
+		line := fmt.Sprintf("%s remote_addr=%s token=%s method=%s url=%q status=%d duration=%s",
+			e.Time.Format(time.RFC3339Nano), e.RemoteAddr, e.Token, e.Method, e.URL, e.Status, e.Duration)
+		if e.Error != "" {
+			line += fmt.Sprintf(" error=%q", e.Error)
+		}
+		return []byte(line + "\n"), nil
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// Write appends the event to the audit log.
+func (a *auditLog) Write(e *auditEvent) error {
+	b, err := a.format(e)
+	if err != nil {
+		return err
+	}
+
+	a.l.Lock()
+	defer a.l.Unlock()
+	if a.f == nil {
+		return fmt.Errorf("audit log is closed")
+	}
+	tooBig := a.sink.RotateBytes > 0 && a.size > 0 && a.size+len(b) > a.sink.RotateBytes
+	tooOld := a.sink.RotateDuration > 0 && time.Since(a.opened) > a.sink.RotateDuration
+	if tooBig || tooOld {
+		if err := a.rotate(); err != nil {
+			return fmt.Errorf("failed to rotate audit log: %v", err)
+		}
+	}
+	n, err := a.f.Write(b)
+	a.size += n
+	return err
+}
+
+// Close closes the audit log.
+func (a *auditLog) Close() error {
+	a.l.Lock()
+	defer a.l.Unlock()
+	if a.f == nil {
+		return nil
+	}
+	err := a.f.Close()
+	a.f = nil
+	return err
+}
+
+// auditResponseWriter records the status code written by an HTTP handler.
+type auditResponseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *auditResponseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *auditResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush and CloseNotify are passed through for streaming endpoints such as
+// the monitor endpoint.
+func (w *auditResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *auditResponseWriter) CloseNotify() <-chan bool {
+	if cn, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	return make(chan bool)
+}
@@ -0,0 +1,160 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/testutil"
+	"github.com/pascaldekloe/goe/verify"
+)
+
+func TestConfig_ValidateAudit(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		desc  string
+		audit Audit
+		err   string
+	}{
+		{"disabled", Audit{Sink: AuditSink{Type: "syslog"}}, ""},
+		{"valid", Audit{Enabled: true, Sink: AuditSink{Type: "file", Path: "/tmp/audit.log", Format: "text"}}, ""},
+		{"bad type", Audit{Enabled: true, Sink: AuditSink{Type: "syslog", Path: "x", Format: "json"}}, `audit.sink.type must be "file", got "syslog"`},
+		{"no path", Audit{Enabled: true, Sink: AuditSink{Type: "file", Format: "json"}}, "audit.sink.path must be set"},
+		{"bad format", Audit{Enabled: true, Sink: AuditSink{Type: "file", Path: "x", Format: "xml"}}, `audit.sink.format must be "json" or "text", got "xml"`},
+		{"negative rotate", Audit{Enabled: true, Sink: AuditSink{Type: "file", Path: "x", Format: "json", RotateMaxFiles: -1}}, "audit.sink.rotate_max_files cannot be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			c := &Config{Audit: tt.audit}
+			err := c.ValidateAudit()
+			if got := errString(err); got != tt.err {
+				t.Fatalf("got error %q want %q", got, tt.err)
+			}
+		})
+	}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func TestAuditLog_Rotate(t *testing.T) {
+	t.Parallel()
+	td := testutil.TempDir(t, "audit")
+	defer os.RemoveAll(td)
+
+	path := filepath.Join(td, "audit.log")
+
+	// Files which weren't rotated by the audit log must be left alone, even
+	// if they sort before the rotated ones.
+	others := []string{path + ".bak", path + ".1", path + ".20000101T000000"}
+	for _, other := range others {
+		if err := ioutil.WriteFile(other, []byte("keep"), 0600); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	l, err := newAuditLog(AuditSink{Path: path, Format: "json", RotateBytes: 10, RotateMaxFiles: 2})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer l.Close()
+
+	for i := 0; i < 5; i++ {
+		if err := l.Write(&auditEvent{Method: "GET", URL: "/v1/agent/self"}); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	// Every event exceeds the limit, so each write after the first rotates
+	// and only the two newest rotated files are kept.
+	rotated, err := auditRotatedFiles(path)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(rotated) != 2 {
+		t.Fatalf("got rotated files %v want 2", rotated)
+	}
+	for _, other := range others {
+		if _, err := os.Stat(other); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Size() == 0 {
+		t.Fatalf("bad current file: %v %v", fi, err)
+	}
+}
+
+func TestHTTPAPI_AuditLog(t *testing.T) {
+	t.Parallel()
+	td := testutil.TempDir(t, "audit")
+	defer os.RemoveAll(td)
+
+	cfg := TestConfig()
+	cfg.Audit.Enabled = true
+	cfg.Audit.Sink = AuditSink{Type: "file", Path: filepath.Join(td, "audit.log"), Format: "json"}
+	cfg.HTTPConfig.BlockEndpoints = []string{"/v1/agent/self"}
+	a := NewTestAgent(t.Name(), cfg)
+	defer a.Shutdown()
+
+	ok := func(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+		return nil, nil
+	}
+	fail := func(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+		return nil, errors.New("boom")
+	}
+	requests := []struct {
+		url     string
+		handler func(http.ResponseWriter, *http.Request) (interface{}, error)
+	}{
+		{"/v1/agent/checks?token=secret", ok},
+		{"/v1/agent/self", ok},
+		{"/v1/agent/members", fail},
+	}
+	for _, r := range requests {
+		req, _ := http.NewRequest("GET", r.url, nil)
+		req.RemoteAddr = "1.2.3.4:5678"
+		a.srv.wrap(r.handler)(httptest.NewRecorder(), req)
+	}
+	a.Shutdown()
+
+	f, err := os.Open(cfg.Audit.Sink.Path)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer f.Close()
+	var got []auditEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if strings.Contains(scanner.Text(), "secret") {
+			t.Fatalf("token leaked into audit log: %s", scanner.Text())
+		}
+		var e auditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if e.Time.IsZero() || e.Duration == "" {
+			t.Fatalf("bad event: %s", scanner.Text())
+		}
+		e.Time, e.Duration = time.Time{}, ""
+		got = append(got, e)
+	}
+
+	want := []auditEvent{
+		{RemoteAddr: "1.2.3.4:5678", Token: auditTokenID("secret"), Method: "GET", URL: "/v1/agent/checks?token=<hidden>", Status: 200},
+		{RemoteAddr: "1.2.3.4:5678", Token: "anonymous", Method: "GET", URL: "/v1/agent/self", Status: 403},
+		{RemoteAddr: "1.2.3.4:5678", Token: "anonymous", Method: "GET", URL: "/v1/agent/members", Status: 500, Error: "boom"},
+	}
+	verify.Values(t, "", got, want)
+}
@@ -18,7 +18,7 @@ func (s *HTTPServer) CatalogRegister(resp http.ResponseWriter, req *http.Request
 
 	// Setup the default DC if not provided
 	if args.Datacenter == "" {
-		args.Datacenter = s.agent.config.Datacenter
+		args.Datacenter = s.agent.RuntimeConfig().Datacenter
 	}
 	s.parseToken(req, &args.Token)
 
@@ -40,7 +40,7 @@ func (s *HTTPServer) CatalogDeregister(resp http.ResponseWriter, req *http.Reque
 
 	// Setup the default DC if not provided
 	if args.Datacenter == "" {
-		args.Datacenter = s.agent.config.Datacenter
+		args.Datacenter = s.agent.RuntimeConfig().Datacenter
 	}
 	s.parseToken(req, &args.Token)
 
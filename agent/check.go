@@ -38,6 +38,15 @@ const (
 	UserAgent = "Consul Health Check"
 )
 
+// checkOutputMaxSize returns the maximum size of the captured
+// check output, which is CheckBufSize unless size is set.
+func checkOutputMaxSize(size int) int {
+	if size > 0 {
+		return size
+	}
+	return CheckBufSize
+}
+
 // CheckNotifier interface is used by the CheckMonitor
 // to notify when a check has a status update. The update
 // should take care to be idempotent.
@@ -56,6 +65,10 @@ type CheckMonitor struct {
 	Timeout  time.Duration
 	Logger   *log.Logger
 
+	// OutputMaxSize is the maximum number of bytes of the output which
+	// is captured. It defaults to CheckBufSize.
+	OutputMaxSize int
+
 	stop     bool
 	stopCh   chan struct{}
 	stopLock sync.Mutex
@@ -109,7 +122,7 @@ func (c *CheckMonitor) check() {
 	}
 
 	// Collect the output
-	output, _ := circbuf.NewBuffer(CheckBufSize)
+	output, _ := circbuf.NewBuffer(int64(checkOutputMaxSize(c.OutputMaxSize)))
 	cmd.Stdout = output
 	cmd.Stderr = output
 
@@ -180,6 +193,10 @@ type CheckTTL struct {
 	TTL     time.Duration
 	Logger  *log.Logger
 
+	// OutputMaxSize is the maximum number of bytes of the output which
+	// is stored. It defaults to CheckBufSize.
+	OutputMaxSize int
+
 	timer *time.Timer
 
 	lastOutput     string
@@ -241,7 +258,14 @@ func (c *CheckTTL) getExpiredOutput() string {
 
 // SetStatus is used to update the status of the check,
 // and to renew the TTL. If expired, TTL is restarted.
-func (c *CheckTTL) SetStatus(status, output string) {
+// Outputs exceeding OutputMaxSize are truncated and the
+// stored output is returned.
+func (c *CheckTTL) SetStatus(status, output string) string {
+	if max := checkOutputMaxSize(c.OutputMaxSize); len(output) > max {
+		output = fmt.Sprintf("%s ... (captured %d of %d bytes)",
+			output[:max], max, len(output))
+	}
+
 	c.Logger.Printf("[DEBUG] agent: Check '%v' status is now %v",
 		c.CheckID, status)
 	c.Notify.UpdateCheck(c.CheckID, status, output)
@@ -252,6 +276,7 @@ func (c *CheckTTL) SetStatus(status, output string) {
 	c.lastOutputLock.Unlock()
 
 	c.timer.Reset(c.TTL)
+	return output
 }
 
 // persistedCheck is used to serialize a check and write it to disk
@@ -290,6 +315,14 @@ type CheckHTTP struct {
 	Logger        *log.Logger
 	TLSSkipVerify bool
 
+	// TLSClientConfig, if set, is the TLS configuration used to connect to
+	// HTTPS endpoints. TLSSkipVerify is applied on top of it.
+	TLSClientConfig *tls.Config
+
+	// OutputMaxSize is the maximum number of bytes of the response body
+	// which is captured. It defaults to CheckBufSize.
+	OutputMaxSize int
+
 	httpClient *http.Client
 	stop       bool
 	stopCh     chan struct{}
@@ -309,7 +342,10 @@ func (c *CheckHTTP) Start() {
 		trans.DisableKeepAlives = true
 
 		// Skip SSL certificate verification if TLSSkipVerify is true
-		if trans.TLSClientConfig == nil {
+		if c.TLSClientConfig != nil {
+			trans.TLSClientConfig = c.TLSClientConfig
+			trans.TLSClientConfig.InsecureSkipVerify = c.TLSSkipVerify
+		} else if trans.TLSClientConfig == nil {
 			trans.TLSClientConfig = &tls.Config{
 				InsecureSkipVerify: c.TLSSkipVerify,
 			}
@@ -406,7 +442,7 @@ func (c *CheckHTTP) check() {
 	defer resp.Body.Close()
 
 	// Read the response into a circular buffer to limit the size
-	output, _ := circbuf.NewBuffer(CheckBufSize)
+	output, _ := circbuf.NewBuffer(int64(checkOutputMaxSize(c.OutputMaxSize)))
 	if _, err := io.Copy(output, resp.Body); err != nil {
 		c.Logger.Printf("[WARN] agent: Check '%v': Get error while reading body: %s", c.CheckID, err)
 	}
@@ -529,6 +565,10 @@ type CheckDocker struct {
 	Interval          time.Duration
 	Logger            *log.Logger
 
+	// OutputMaxSize is the maximum number of bytes of the output which
+	// is captured. It defaults to the buffer size of the client.
+	OutputMaxSize int
+
 	client *DockerClient
 	stop   chan struct{}
 }
@@ -581,7 +621,7 @@ func (c *CheckDocker) check() {
 		c.Logger.Printf("[DEBUG] agent: Check '%s': %s", c.CheckID, err)
 		out = err.Error()
 	} else {
-		// out is already limited to CheckBufSize since we're getting a
+		// out is already limited to OutputMaxSize since we're getting a
 		// limited buffer. So we don't need to truncate it just report
 		// that it was truncated.
 		out = string(b.Bytes())
@@ -605,7 +645,7 @@ func (c *CheckDocker) doCheck() (string, *circbuf.Buffer, error) {
 		return api.HealthCritical, nil, err
 	}
 
-	buf, err := c.client.StartExec(c.DockerContainerID, execID)
+	buf, err := c.client.StartExec(c.DockerContainerID, execID, int64(c.OutputMaxSize))
 	if err != nil {
 		return api.HealthCritical, nil, err
 	}
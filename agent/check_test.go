@@ -125,6 +125,57 @@ func TestCheckMonitor_LimitOutput(t *testing.T) {
 	}
 }
 
+func TestCheckMonitor_OutputMaxSize(t *testing.T) {
+	t.Parallel()
+	notif := mock.NewNotify()
+	check := &CheckMonitor{
+		Notify:        notif,
+		CheckID:       types.CheckID("foo"),
+		Script:        "od -N 81920 /dev/urandom",
+		Interval:      25 * time.Millisecond,
+		Logger:        log.New(ioutil.Discard, UniqueID(), log.LstdFlags),
+		OutputMaxSize: 100,
+	}
+	check.Start()
+	defer check.Stop()
+
+	retry.Run(t, func(r *retry.R) {
+		out := notif.Output("foo")
+		if !strings.HasPrefix(out, "Captured 100 of ") {
+			r.Fatalf("output not truncated: %q", out)
+		}
+		// Allow for extra bytes for the truncation message
+		if len(out) > 100+50 {
+			r.Fatalf("output size is too long: %d", len(out))
+		}
+	})
+}
+
+func TestCheckTTL_OutputMaxSize(t *testing.T) {
+	t.Parallel()
+	notif := mock.NewNotify()
+	check := &CheckTTL{
+		Notify:        notif,
+		CheckID:       types.CheckID("foo"),
+		TTL:           time.Minute,
+		Logger:        log.New(ioutil.Discard, UniqueID(), log.LstdFlags),
+		OutputMaxSize: 5,
+	}
+	check.Start()
+	defer check.Stop()
+
+	want := "01234 ... (captured 5 of 10 bytes)"
+	if got := check.SetStatus(api.HealthPassing, "0123456789"); got != want {
+		t.Fatalf("got %q want %q", got, want)
+	}
+	if got := notif.Output("foo"); got != want {
+		t.Fatalf("got %q want %q", got, want)
+	}
+	if got := check.SetStatus(api.HealthPassing, "01234"); got != "01234" {
+		t.Fatalf("got %q want %q", got, "01234")
+	}
+}
+
 func TestCheckTTL(t *testing.T) {
 	// t.Parallel() // timing test. no parallel
 	notif := mock.NewNotify()
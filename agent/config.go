@@ -1,18 +1,23 @@
 package agent
 
 import (
+	"bytes"
 	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"os"
 	"path/filepath"
+	"reflect"
+	"runtime"
 	"sort"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/hashicorp/consul/agent/consul"
 	"github.com/hashicorp/consul/agent/structs"
@@ -32,13 +37,20 @@ type PortConfig struct {
 	DNS     int // DNS Query interface
 	HTTP    int // HTTP API
 	HTTPS   int // HTTPS API
+	GRPC    int // gRPC API
 	SerfLan int `mapstructure:"serf_lan"` // LAN gossip (Client + Server)
 	SerfWan int `mapstructure:"serf_wan"` // WAN gossip (Server only)
 	Server  int // Server internal RPC
 
-	// RPC is deprecated and is no longer used. It will be removed in a future
-	// version.
-	RPC int // CLI RPC
+	// SidecarMinPort and SidecarMaxPort are the inclusive range of ports
+	// assigned to sidecar proxies which don't set a port of their own.
+	SidecarMinPort int `mapstructure:"sidecar_min_port"`
+	SidecarMaxPort int `mapstructure:"sidecar_max_port"`
+
+	// ExposeMinPort and ExposeMaxPort are the inclusive range of ports
+	// assigned to the paths exposed by sidecar proxies.
+	ExposeMinPort int `mapstructure:"expose_min_port"`
+	ExposeMaxPort int `mapstructure:"expose_max_port"`
 }
 
 // AddressConfig is used to provide address overrides
@@ -48,10 +60,6 @@ type AddressConfig struct {
 	DNS   string // DNS Query interface
 	HTTP  string // HTTP API
 	HTTPS string // HTTPS API
-
-	// RPC is deprecated and is no longer used. It will be removed in a future
-	// version.
-	RPC string // CLI RPC
 }
 
 type AdvertiseAddrsConfig struct {
@@ -68,14 +76,14 @@ type AdvertiseAddrsConfig struct {
 // reads
 type DNSConfig struct {
 	// NodeTTL provides the TTL value for a node query
-	NodeTTL    time.Duration `mapstructure:"-"`
-	NodeTTLRaw string        `mapstructure:"node_ttl" json:"-"`
+	NodeTTL    time.Duration    `mapstructure:"-"`
+	NodeTTLRaw FlexibleDuration `mapstructure:"node_ttl" json:"-"`
 
 	// ServiceTTL provides the TTL value for a service
 	// query for given service. The "*" wildcard can be used
 	// to set a default for all services.
-	ServiceTTL    map[string]time.Duration `mapstructure:"-"`
-	ServiceTTLRaw map[string]string        `mapstructure:"service_ttl" json:"-"`
+	ServiceTTL    map[string]time.Duration    `mapstructure:"-"`
+	ServiceTTLRaw map[string]FlexibleDuration `mapstructure:"service_ttl" json:"-"`
 
 	// AllowStale is used to enable lookups with stale
 	// data. This gives horizontal read scalability since
@@ -110,8 +118,8 @@ type DNSConfig struct {
 	// AllowStale to limit how old of a value is served up.
 	// If the stale result exceeds this, another non-stale
 	// stale read is performed.
-	MaxStale    time.Duration `mapstructure:"-"`
-	MaxStaleRaw string        `mapstructure:"max_stale" json:"-"`
+	MaxStale    time.Duration    `mapstructure:"-"`
+	MaxStaleRaw FlexibleDuration `mapstructure:"max_stale" json:"-"`
 
 	// OnlyPassing is used to determine whether to filter nodes
 	// whose health checks are in any non-passing state. By
@@ -127,8 +135,8 @@ type DNSConfig struct {
 	// for Consul's internal dns client used for recursion.
 	// This value is used for the connection, read and write timeout.
 	// Default: 2s
-	RecursorTimeout    time.Duration `mapstructure:"-"`
-	RecursorTimeoutRaw string        `mapstructure:"recursor_timeout" json:"-"`
+	RecursorTimeout    time.Duration    `mapstructure:"-"`
+	RecursorTimeoutRaw FlexibleDuration `mapstructure:"recursor_timeout" json:"-"`
 }
 
 // HTTPConfig is used to fine tune the Http sub-system.
@@ -139,58 +147,106 @@ type HTTPConfig struct {
 
 	// ResponseHeaders are used to add HTTP header response fields to the HTTP API responses.
 	ResponseHeaders map[string]string `mapstructure:"response_headers"`
+
+	// AllowedClientSubjects is a list of glob patterns for the subject
+	// alternative names of client certificates which may call mutating
+	// endpoints of the HTTPS API. Requires client certificates to be
+	// verified.
+	AllowedClientSubjects []string `mapstructure:"allowed_client_subjects"`
+
+	// ReadOnly rejects all requests to endpoints which change state,
+	// regardless of the ACL token, for agents which should only serve
+	// queries.
+	ReadOnly bool `mapstructure:"read_only"`
+}
+
+// DataDirEncryption is used to encrypt sensitive state, such as the gossip
+// keyrings and persisted service and check definitions, which is written to
+// the data directory.
+type DataDirEncryption struct {
+	// Key is the base64 encoded 16, 24 or 32 byte AES key. It can be
+	// written as a secret reference to fetch it from an external key
+	// management system.
+	Key string `mapstructure:"key" json:"-"`
+
+	// KeyFile is the path to a file containing the base64 encoded key.
+	KeyFile string `mapstructure:"key_file"`
 }
 
-// RetryJoinEC2 is used to configure discovery of instances via Amazon's EC2 api
-type RetryJoinEC2 struct {
-	// The AWS region to look for instances in
-	Region string `mapstructure:"region"`
+// Permissions describes the expected permissions of the files and
+// directories the agent reads its configuration and secrets from and writes
+// its state to. They are audited on startup.
+type Permissions struct {
+	// DataDirMode is the most permissive octal mode allowed for the data
+	// directory.
+	DataDirMode string `mapstructure:"data_dir_mode"`
+
+	// ConfigFileMode is the most permissive octal mode allowed for
+	// configuration files and directories.
+	ConfigFileMode string `mapstructure:"config_file_mode"`
+
+	// SecretFileMode is the most permissive octal mode allowed for files
+	// referenced by file secret references and for the key file of the
+	// data directory encryption.
+	SecretFileMode string `mapstructure:"secret_file_mode"`
+}
 
-	// The tag key and value to use when filtering instances
-	TagKey   string `mapstructure:"tag_key"`
-	TagValue string `mapstructure:"tag_value"`
+// Audit configures the audit log of HTTP API requests.
+type Audit struct {
+	// Enabled turns on audit logging.
+	Enabled bool `mapstructure:"enabled"`
 
-	// The AWS credentials to use for making requests to EC2
-	AccessKeyID     string `mapstructure:"access_key_id" json:"-"`
-	SecretAccessKey string `mapstructure:"secret_access_key" json:"-"`
+	// Sink configures where the audit events are written to.
+	Sink AuditSink `mapstructure:"sink"`
 }
 
-// RetryJoinGCE is used to configure discovery of instances via Google Compute
-// Engine's API.
-type RetryJoinGCE struct {
-	// The name of the project the instances reside in.
-	ProjectName string `mapstructure:"project_name"`
+// AuditSink configures the destination of the audit log.
+type AuditSink struct {
+	// Type is the type of the sink. Only "file" is supported.
+	Type string `mapstructure:"type"`
+
+	// Path is the file the audit events are written to.
+	Path string `mapstructure:"path"`
+
+	// Format is the format of the audit events, either "json" or "text".
+	Format string `mapstructure:"format"`
 
-	// A regular expression (RE2) pattern for the zones you want to discover the instances in.
-	// Example: us-west1-.*, or us-(?west|east).*.
-	ZonePattern string `mapstructure:"zone_pattern"`
+	// RotateBytes is the size in bytes after which the file is rotated.
+	// Zero disables size based rotation.
+	RotateBytes int `mapstructure:"rotate_bytes"`
+
+	// RotateDuration is the time after which the file is rotated. Zero
+	// disables time based rotation.
+	RotateDuration    time.Duration    `mapstructure:"-"`
+	RotateDurationRaw FlexibleDuration `mapstructure:"rotate_duration"`
+
+	// RotateMaxFiles is the number of rotated files to keep. Zero keeps
+	// all of them.
+	RotateMaxFiles int `mapstructure:"rotate_max_files"`
+}
 
-	// The tag value to search for when filtering instances.
-	TagValue string `mapstructure:"tag_value"`
+// GossipKeyRotation configures the automatic rotation of the gossip
+// encryption key by the servers.
+type GossipKeyRotation struct {
+	// Interval is the time between rotations. Zero disables rotation.
+	Interval    time.Duration    `mapstructure:"-"`
+	IntervalRaw FlexibleDuration `mapstructure:"interval"`
 
-	// A path to a JSON file with the service account credentials necessary to
-	// connect to GCE. If this is not defined, the following chain is respected:
-	// 1. A JSON file whose path is specified by the
-	//		GOOGLE_APPLICATION_CREDENTIALS environment variable.
-	// 2. A JSON file in a location known to the gcloud command-line tool.
-	//    On Windows, this is %APPDATA%/gcloud/application_default_credentials.json.
-	//  	On other systems, $HOME/.config/gcloud/application_default_credentials.json.
-	// 3. On Google Compute Engine, it fetches credentials from the metadata
-	//    server.  (In this final case any provided scopes are ignored.)
-	CredentialsFile string `mapstructure:"credentials_file"`
+	// Retain is the number of previous keys which are kept installed after
+	// a rotation so that nodes which missed it can still communicate.
+	Retain int `mapstructure:"retain"`
 }
 
-// RetryJoinAzure is used to configure discovery of instances via AzureRM API
-type RetryJoinAzure struct {
-	// The tag name and value to use when filtering instances
-	TagName  string `mapstructure:"tag_name"`
-	TagValue string `mapstructure:"tag_value"`
+// ConfigOverlay configures fetching configuration overlays which are
+// stored in the KV store, so that settings shared by many agents can be
+// changed in one place.
+type ConfigOverlay struct {
+	// Enabled makes the agent fetch its overlay when it starts and watch
+	// it for changes.
+	Enabled bool `mapstructure:"enabled"`
 
-	// The Azure credentials to use for making requests to AzureRM
-	SubscriptionID  string `mapstructure:"subscription_id" json:"-"`
-	TenantID        string `mapstructure:"tenant_id" json:"-"`
-	ClientID        string `mapstructure:"client_id" json:"-"`
-	SecretAccessKey string `mapstructure:"secret_access_key" json:"-"`
+	// Prefix is the KV prefix below which the overlays are stored.
+	Prefix string `mapstructure:"prefix"`
 }
 
 // Performance is used to tune the performance of Consul's subsystems.
@@ -200,6 +256,65 @@ type Performance struct {
 	RaftMultiplier uint `mapstructure:"raft_multiplier"`
 }
 
+// NodeMetaLimits bounds the node metadata. Zero values use the defaults of
+// 64 key/value pairs, 128 character keys and 512 character values.
+type NodeMetaLimits struct {
+	// MaxKeys is the maximum number of key/value pairs.
+	MaxKeys int `mapstructure:"max_keys"`
+
+	// MaxKeyLength is the maximum length of a key.
+	MaxKeyLength int `mapstructure:"max_key_length"`
+
+	// MaxValueLength is the maximum length of a value.
+	MaxValueLength int `mapstructure:"max_value_length"`
+}
+
+// MetaLimits returns the limits in the form used to validate metadata.
+func (l NodeMetaLimits) MetaLimits() structs.MetaLimits {
+	return structs.MetaLimits{
+		MaxKeyPairs:    l.MaxKeys,
+		KeyMaxLength:   l.MaxKeyLength,
+		ValueMaxLength: l.MaxValueLength,
+	}
+}
+
+// Reporting configures the usage reporting.
+type Reporting struct {
+	// ExportAddress is the http or https URL the usage reports are sent
+	// to. Reporting is disabled if it is empty.
+	ExportAddress string `mapstructure:"export_address"`
+
+	// Interval is how often usage is reported. It defaults to one hour.
+	Interval    time.Duration    `mapstructure:"-"`
+	IntervalRaw FlexibleDuration `mapstructure:"interval" json:"-"`
+}
+
+// CheckDefaults holds the settings applied to the checks which don't set
+// them, so that they can be tuned for all checks of an agent in one place.
+type CheckDefaults struct {
+	// HTTP are the defaults of the HTTP checks.
+	HTTP HTTPCheckDefaults `mapstructure:"http"`
+}
+
+// HTTPCheckDefaults are the defaults of the HTTP checks.
+type HTTPCheckDefaults struct {
+	// Timeout is the timeout of checks without a timeout.
+	Timeout    time.Duration    `mapstructure:"-"`
+	TimeoutRaw FlexibleDuration `mapstructure:"timeout" json:"-"`
+
+	// TLSSkipVerify disables the certificate verification of checks
+	// without a tls_skip_verify.
+	TLSSkipVerify bool `mapstructure:"tls_skip_verify"`
+
+	// Headers are added to the requests of the checks. Headers of a check
+	// replace the ones with the same name.
+	Headers map[string][]string `mapstructure:"headers"`
+
+	// OutputMaxSize replaces check_output_max_size for HTTP checks without
+	// an output_max_size.
+	OutputMaxSize int `mapstructure:"output_max_size"`
+}
+
 // Telemetry is the telemetry configuration for the server
 type Telemetry struct {
 	// StatsiteAddr is the address of a statsite instance. If provided,
@@ -233,7 +348,7 @@ type Telemetry struct {
 
 	// DogStatsdTags are the global tags that should be sent with each packet to dogstatsd
 	// It is a list of strings, where each string looks like "my_tag_name:my_tag_value"
-	DogStatsdTags []string `mapstructure:"dogstatsd_tags"`
+	DogStatsdTags []string `mapstructure:"dogstatsd_tags" merge:"replace"`
 
 	// Circonus: see https://github.com/circonus-labs/circonus-gometrics
 	// for more details on the various configuration options.
@@ -315,8 +430,8 @@ type Autopilot struct {
 
 	// LastContactThreshold is the limit on the amount of time a server can go
 	// without leader contact before being considered unhealthy.
-	LastContactThreshold    *time.Duration `mapstructure:"-" json:"-"`
-	LastContactThresholdRaw string         `mapstructure:"last_contact_threshold"`
+	LastContactThreshold    *time.Duration   `mapstructure:"-" json:"-"`
+	LastContactThresholdRaw FlexibleDuration `mapstructure:"last_contact_threshold"`
 
 	// MaxTrailingLogs is the amount of entries in the Raft Log that a server can
 	// be behind before being considered unhealthy.
@@ -325,8 +440,8 @@ type Autopilot struct {
 	// ServerStabilizationTime is the minimum amount of time a server must be
 	// in a stable, healthy state before it can be added to the cluster. Only
 	// applicable with Raft protocol version 3 or higher.
-	ServerStabilizationTime    *time.Duration `mapstructure:"-" json:"-"`
-	ServerStabilizationTimeRaw string         `mapstructure:"server_stabilization_time"`
+	ServerStabilizationTime    *time.Duration   `mapstructure:"-" json:"-"`
+	ServerStabilizationTimeRaw FlexibleDuration `mapstructure:"server_stabilization_time"`
 
 	// (Enterprise-only) RedundancyZoneTag is the Meta tag to use for separating servers
 	// into zones for redundancy. If left blank, this feature will be disabled.
@@ -344,7 +459,9 @@ type Autopilot struct {
 
 // Config is the configuration that can be set for an Agent.
 // Some of this is configurable as CLI flags, but most must
-// be set using a configuration file.
+// be set using a configuration file. The merge tag of a field
+// sets how MergeConfig merges it: "set", "append", "replace",
+// "union" or "skip".
 type Config struct {
 	// DevMode enables a fast-path mode of operation to bring up an in-memory
 	// server with minimal configuration. Useful for developing Consul.
@@ -366,9 +483,10 @@ type Config struct {
 	// in leader election, etc.
 	Server bool `mapstructure:"server"`
 
-	// (Enterprise-only) NonVotingServer is whether this server will act as a non-voting member
-	// of the cluster to help provide read scalability.
-	NonVotingServer bool `mapstructure:"non_voting_server"`
+	// ReadReplica is whether this server will act as a non-voting member
+	// of the cluster to help provide read scalability. It replaces the
+	// deprecated non_voting_server key.
+	ReadReplica bool `mapstructure:"read_replica"`
 
 	// Datacenter is the datacenter this node is in. Defaults to dc1
 	Datacenter string `mapstructure:"datacenter"`
@@ -376,10 +494,11 @@ type Config struct {
 	// DataDir is the directory to store our state in
 	DataDir string `mapstructure:"data_dir"`
 
-	// DNSRecursors can be set to allow the DNS servers to recursively
-	// resolve non-consul domains. It is deprecated, and merges into the
-	// recursors array.
-	DNSRecursor string `mapstructure:"recursor"`
+	// DataDirFilesystemDenylist lists the filesystem types, like nfs, which
+	// are known to break the locking and fsync guarantees the data
+	// directory relies on. The agent warns if the data directory is on one
+	// of them.
+	DataDirFilesystemDenylist []string `mapstructure:"data_dir_filesystem_denylist" merge:"replace"`
 
 	// DNSRecursors can be set to allow the DNS servers to recursively
 	// resolve non-consul domains
@@ -400,6 +519,30 @@ type Config struct {
 	// Disables writing the keyring to a file.
 	DisableKeyringFile bool `mapstructure:"disable_keyring_file"`
 
+	// DataDirEncryption configures encryption of sensitive state written
+	// to the data directory.
+	DataDirEncryption DataDirEncryption `mapstructure:"data_dir_encryption"`
+
+	// Audit configures the audit log of HTTP API requests.
+	Audit Audit `mapstructure:"audit"`
+
+	// GossipKeyRotation configures the periodic rotation of the gossip
+	// encryption key. Only used by servers.
+	GossipKeyRotation GossipKeyRotation `mapstructure:"gossip_key_rotation"`
+
+	// ConfigOverlay configures the configuration overlay fetched from the
+	// KV store. It is merged after the local configuration and before the
+	// command line flags.
+	ConfigOverlay ConfigOverlay `mapstructure:"config_overlay"`
+
+	// Permissions sets the expected permissions of the data directory,
+	// the configuration files and the secret files.
+	Permissions Permissions `mapstructure:"permissions"`
+
+	// StrictPermissions makes the agent refuse to start when the
+	// permissions audit finds a violation instead of only warning about it.
+	StrictPermissions bool `mapstructure:"strict_permissions"`
+
 	// EncryptVerifyIncoming and EncryptVerifyOutgoing are used to enforce
 	// incoming/outgoing gossip encryption and can be used to upshift to
 	// encrypted gossip on a running cluster.
@@ -422,7 +565,8 @@ type Config struct {
 	NodeName string `mapstructure:"node_name"`
 
 	// ClientAddr is used to control the address we bind to for
-	// client services (DNS, HTTP, HTTPS, RPC)
+	// client services (DNS, HTTP, HTTPS, RPC). It can be a space or
+	// comma separated list of addresses to listen on all of them.
 	ClientAddr string `mapstructure:"client_addr"`
 
 	// BindAddr is used to control the address we bind to.
@@ -443,6 +587,12 @@ type Config struct {
 	// services (Gossip) Serf
 	SerfLanBindAddr string `mapstructure:"serf_lan_bind"`
 
+	// SerfLANAllowedCIDRs and SerfWANAllowedCIDRs are the networks from
+	// which LAN and WAN gossip is accepted. Gossip from other addresses is
+	// dropped. If empty, gossip is accepted from everywhere.
+	SerfLANAllowedCIDRs []string `mapstructure:"serf_lan_allowed_cidrs"`
+	SerfWANAllowedCIDRs []string `mapstructure:"serf_wan_allowed_cidrs"`
+
 	// AdvertiseAddr is the address we use for advertising our Serf,
 	// and Consul RPC IP. If not specified, bind address is used.
 	AdvertiseAddr string `mapstructure:"advertise_addr"`
@@ -466,18 +616,34 @@ type Config struct {
 	Addresses AddressConfig
 
 	// Tagged addresses. These are used to publish a set of addresses for
-	// for a node, which can be used by the remote agent. We currently
-	// populate only the "wan" tag based on the SerfWan advertise address,
-	// but this structure is here for possible future features with other
-	// user-defined tags. The "wan" tag will be used by remote agents if
-	// they are configured with TranslateWanAddrs set to true.
-	TaggedAddresses map[string]string
+	// for a node, which can be used by the remote agent. The "lan" and
+	// "wan" tags default to the advertise addresses, other tags are only
+	// published if they are configured. The "wan" tag will be used by
+	// remote agents if they are configured with TranslateWanAddrs set to
+	// true.
+	TaggedAddresses map[string]string `mapstructure:"tagged_addresses"`
 
 	// Node metadata key/value pairs. These are excluded from JSON output
 	// because they can be reloaded and might be stale when shown from the
 	// config instead of the local state.
 	Meta map[string]string `mapstructure:"node_meta" json:"-"`
 
+	// NodeMetaFile is the path of a JSON or HCL file with node metadata,
+	// e.g. maintained by inventory tooling. It is merged beneath Meta and
+	// read again on reload.
+	NodeMetaFile string `mapstructure:"node_meta_file"`
+
+	// NodeMetaLimits bounds the node metadata. Servers reject catalog
+	// registrations exceeding their limits, agents validate their own
+	// metadata against them.
+	NodeMetaLimits NodeMetaLimits `mapstructure:"node_meta_limits"`
+
+	// StartInMaintenance puts the node into maintenance mode when the
+	// agent starts, with StartInMaintenanceReason as the reason if set. The
+	// node stays in maintenance mode until it is disabled through the API.
+	StartInMaintenance       bool   `mapstructure:"start_in_maintenance"`
+	StartInMaintenanceReason string `mapstructure:"start_in_maintenance_reason"`
+
 	// LeaveOnTerm controls if Serf does a graceful leave when receiving
 	// the TERM signal. Defaults true on clients, false on servers. This can
 	// be changed on reload.
@@ -561,6 +727,12 @@ type Config struct {
 	// over the client ciphersuites.
 	TLSPreferServerCipherSuites bool `mapstructure:"tls_prefer_server_cipher_suites"`
 
+	// EnableAgentTLSForChecks makes the HTTP checks use the CA, the
+	// certificate and the server name of the agent when connecting to
+	// HTTPS endpoints, e.g. of services which require mutual TLS. Checks
+	// can override it with EnableAgentTLS.
+	EnableAgentTLSForChecks bool `mapstructure:"enable_agent_tls_for_checks"`
+
 	// StartJoin is a list of addresses to attempt to join when the
 	// agent starts. If Serf is unable to communicate with any of these
 	// addresses, then the agent will error and exit.
@@ -582,8 +754,8 @@ type Config struct {
 	// RetryInterval specifies the amount of time to wait in between join
 	// attempts on agent start. The minimum allowed value is 1 second and
 	// the default is 30s.
-	RetryInterval    time.Duration `mapstructure:"-" json:"-"`
-	RetryIntervalRaw string        `mapstructure:"retry_interval"`
+	RetryInterval    time.Duration    `mapstructure:"-" json:"-"`
+	RetryIntervalRaw FlexibleDuration `mapstructure:"retry_interval"`
 
 	// RetryJoinWan is a list of addresses to join -wan with retry enabled.
 	RetryJoinWan []string `mapstructure:"retry_join_wan"`
@@ -596,16 +768,16 @@ type Config struct {
 	// RetryIntervalWan specifies the amount of time to wait in between join
 	// -wan attempts on agent start. The minimum allowed value is 1 second and
 	// the default is 30s.
-	RetryIntervalWan    time.Duration `mapstructure:"-" json:"-"`
-	RetryIntervalWanRaw string        `mapstructure:"retry_interval_wan"`
+	RetryIntervalWan    time.Duration    `mapstructure:"-" json:"-"`
+	RetryIntervalWanRaw FlexibleDuration `mapstructure:"retry_interval_wan"`
 
 	// ReconnectTimeout* specify the amount of time to wait to reconnect with
 	// another agent before deciding it's permanently gone. This can be used to
 	// control the time it takes to reap failed nodes from the cluster.
-	ReconnectTimeoutLan    time.Duration `mapstructure:"-"`
-	ReconnectTimeoutLanRaw string        `mapstructure:"reconnect_timeout"`
-	ReconnectTimeoutWan    time.Duration `mapstructure:"-"`
-	ReconnectTimeoutWanRaw string        `mapstructure:"reconnect_timeout_wan"`
+	ReconnectTimeoutLan    time.Duration    `mapstructure:"-"`
+	ReconnectTimeoutLanRaw FlexibleDuration `mapstructure:"reconnect_timeout"`
+	ReconnectTimeoutWan    time.Duration    `mapstructure:"-"`
+	ReconnectTimeoutWanRaw FlexibleDuration `mapstructure:"reconnect_timeout_wan"`
 
 	// EnableUI enables the statically-compiled assets for the Consul web UI and
 	// serves them at the default /ui/ endpoint automatically.
@@ -618,6 +790,10 @@ type Config struct {
 	// PidFile is the file to store our PID in
 	PidFile string `mapstructure:"pid_file"`
 
+	// DisablePidFileCheck lets the agent overwrite a PID file which
+	// belongs to another running process instead of refusing to start.
+	DisablePidFileCheck bool `mapstructure:"disable_pid_file_check"`
+
 	// EnableSyslog is used to also tee all the logs over to syslog. Only supported
 	// on linux and OSX. Other platforms will generate an error.
 	EnableSyslog bool `mapstructure:"enable_syslog"`
@@ -626,24 +802,57 @@ type Config struct {
 	// By default, goes to LOCAL0
 	SyslogFacility string `mapstructure:"syslog_facility"`
 
+	// EnableEventLog is used to also tee all the logs over to the Windows
+	// Event Log. Only supported on Windows.
+	EnableEventLog bool `mapstructure:"enable_eventlog"`
+
+	// WindowsServiceName is the name of the Windows service the agent runs
+	// as. When it is set and the agent was started by the service control
+	// manager, stop requests shut the agent down and parameter change
+	// requests reload the configuration. It is also used as the source of
+	// the messages written to the Windows Event Log.
+	WindowsServiceName string `mapstructure:"windows_service_name"`
+
 	// RejoinAfterLeave controls our interaction with the cluster after leave.
 	// When set to false (default), a leave causes Consul to not rejoin
 	// the cluster until an explicit join is received. If this is set to
 	// true, we ignore the leave, and rejoin the cluster on start.
 	RejoinAfterLeave bool `mapstructure:"rejoin_after_leave"`
 
+	// SystemdNotify controls whether systemd is notified through the
+	// sd_notify protocol once the agent has started and joined the
+	// cluster, and whether the systemd watchdog is pet from the agent's
+	// main loop. This allows unit files to use Type=notify and WatchdogSec.
+	SystemdNotify bool `mapstructure:"systemd_notify"`
+
 	// EnableScriptChecks controls whether health checks which execute
 	// scripts are enabled. This includes regular script checks and Docker
 	// checks.
 	EnableScriptChecks bool `mapstructure:"enable_script_checks"`
 
+	// EnableLocalScriptChecks controls whether health checks which execute
+	// scripts are enabled when they are defined in the local configuration
+	// files. Unlike EnableScriptChecks it does not allow registering them
+	// via the HTTP API.
+	EnableLocalScriptChecks bool `mapstructure:"enable_local_script_checks"`
+
 	// CheckUpdateInterval controls the interval on which the output of a health check
 	// is updated if there is no change to the state. For example, a check in a steady
 	// state may run every 5 second generating a unique output (timestamp, etc), forcing
 	// constant writes. This allows Consul to defer the write for some period of time,
 	// reducing the write pressure when the state is steady.
-	CheckUpdateInterval    time.Duration `mapstructure:"-"`
-	CheckUpdateIntervalRaw string        `mapstructure:"check_update_interval" json:"-"`
+	CheckUpdateInterval    time.Duration    `mapstructure:"-"`
+	CheckUpdateIntervalRaw FlexibleDuration `mapstructure:"check_update_interval" json:"-"`
+
+	// CheckOutputMaxSize is the maximum number of bytes of the output of a
+	// health check which is stored. Larger outputs are truncated, keeping
+	// the end of the output. Check definitions can override it with
+	// output_max_size.
+	CheckOutputMaxSize int `mapstructure:"check_output_max_size"`
+
+	// CheckDefaults holds the settings applied to the checks which don't
+	// set them.
+	CheckDefaults CheckDefaults `mapstructure:"check_defaults"`
 
 	// CheckReapInterval controls the interval on which we will look for
 	// failed checks and reap their associated services, if so configured.
@@ -651,7 +860,30 @@ type Config struct {
 
 	// CheckDeregisterIntervalMin is the smallest allowed interval to set
 	// a check's DeregisterCriticalServiceAfter value to.
-	CheckDeregisterIntervalMin time.Duration `mapstructure:"-"`
+	CheckDeregisterIntervalMin    time.Duration    `mapstructure:"-"`
+	CheckDeregisterIntervalMinRaw FlexibleDuration `mapstructure:"check_deregister_interval_min" json:"-"`
+
+	// DeregisterCriticalServiceAfter is the DeregisterCriticalServiceAfter
+	// value of the checks associated with a service which do not set one.
+	// Zero keeps the services of critical checks registered.
+	DeregisterCriticalServiceAfter    time.Duration    `mapstructure:"-"`
+	DeregisterCriticalServiceAfterRaw FlexibleDuration `mapstructure:"deregister_critical_service_after" json:"-"`
+
+	// ConfigStaleCheckInterval controls how often the configuration files
+	// on disk are compared with the ones the running configuration was
+	// loaded from. If they differ the node is flagged with a warning check
+	// until the configuration is reloaded. Zero disables the comparison.
+	ConfigStaleCheckInterval    time.Duration    `mapstructure:"-"`
+	ConfigStaleCheckIntervalRaw FlexibleDuration `mapstructure:"config_stale_check_interval" json:"-"`
+
+	// LicensePath is the path of the license file of builds which support
+	// licensing. The file is read when the configuration is built and is
+	// watched like the files of secret references, so that a rotated
+	// license is picked up by a reload.
+	LicensePath string `mapstructure:"license_path"`
+
+	// Reporting configures the usage reporting of builds which support it.
+	Reporting Reporting `mapstructure:"reporting"`
 
 	// ACLToken is the default token used to make requests if a per-request
 	// token is not provided. If not configured the 'anonymous' token is used.
@@ -679,8 +911,8 @@ type Config struct {
 
 	// ACLTTL is used to control the time-to-live of cached ACLs . This has
 	// a major impact on performance. By default, it is set to 30 seconds.
-	ACLTTL    time.Duration `mapstructure:"-"`
-	ACLTTLRaw string        `mapstructure:"acl_ttl"`
+	ACLTTL    time.Duration    `mapstructure:"-"`
+	ACLTTLRaw FlexibleDuration `mapstructure:"acl_ttl"`
 
 	// ACLDefaultPolicy is used to control the ACL interaction when
 	// there is no defined policy. This can be "allow" which means
@@ -729,6 +961,11 @@ type Config struct {
 	// feature. This is for security to prevent unknown scripts from running.
 	DisableRemoteExec *bool `mapstructure:"disable_remote_exec"`
 
+	// AllowRemoteExecWithoutACLs permits enabling remote execution on an
+	// agent which does not have ACLs enabled. Without ACLs anyone who can
+	// write to the KV store can run commands on the agent.
+	AllowRemoteExecWithoutACLs bool `mapstructure:"allow_remote_exec_without_acls"`
+
 	// DisableUpdateCheck is used to turn off the automatic update and
 	// security bulletin checking.
 	DisableUpdateCheck bool `mapstructure:"disable_update_check"`
@@ -764,16 +1001,39 @@ type Config struct {
 	Services []*structs.ServiceDefinition `mapstructure:"-" json:"-"`
 
 	// ConsulConfig can either be provided or a default one created
-	ConsulConfig *consul.Config `mapstructure:"-" json:"-"`
+	ConsulConfig *consul.Config `mapstructure:"-" json:"-" merge:"skip"`
+
+	// SecretFileWatchInterval controls how often the files referenced by
+	// file secret references are checked for changes. A change triggers a
+	// configuration reload so that rotated secrets are picked up.
+	SecretFileWatchInterval time.Duration `mapstructure:"-" json:"-"`
+
+	// SecretRefs maps the config keys of values which were written as
+	// secret references to the reference they were resolved from. The
+	// resolved values are always treated as secrets.
+	SecretRefs map[string]string `mapstructure:"-" json:"-" merge:"skip"`
+
+	// License holds the contents of the file at LicensePath.
+	License string `mapstructure:"-" json:"-" merge:"skip"`
+
+	// Deprecations are the warnings about the deprecated keys used by the
+	// configuration files and the other decoded sources, including their
+	// replacements. ConfigBuilder returns them with its warnings.
+	Deprecations []string `mapstructure:"-" json:"-"`
+
+	// Unset are the keys which were set to null to clear the values of
+	// earlier configurations. MergeConfig resets them to their default
+	// value before it merges the other settings.
+	Unset []string `mapstructure:"-" json:"-"`
 
 	// Revision is the GitCommit this maps to
-	Revision string `mapstructure:"-"`
+	Revision string `mapstructure:"-" merge:"skip"`
 
 	// Version is the release version number
-	Version string `mapstructure:"-"`
+	Version string `mapstructure:"-" merge:"skip"`
 
 	// VersionPrerelease is a label for pre-release builds
-	VersionPrerelease string `mapstructure:"-"`
+	VersionPrerelease string `mapstructure:"-" merge:"skip"`
 
 	// WatchPlans contains the compiled watches
 	WatchPlans []*watch.Plan `mapstructure:"-" json:"-"`
@@ -782,20 +1042,8 @@ type Config struct {
 	UnixSockets UnixSocketConfig `mapstructure:"unix_sockets"`
 
 	// Minimum Session TTL
-	SessionTTLMin    time.Duration `mapstructure:"-"`
-	SessionTTLMinRaw string        `mapstructure:"session_ttl_min"`
-
-	// deprecated fields
-	// keep them exported since otherwise the error messages don't show up
-	DeprecatedAtlasInfrastructure    string            `mapstructure:"atlas_infrastructure" json:"-"`
-	DeprecatedAtlasToken             string            `mapstructure:"atlas_token" json:"-"`
-	DeprecatedAtlasACLToken          string            `mapstructure:"atlas_acl_token" json:"-"`
-	DeprecatedAtlasJoin              bool              `mapstructure:"atlas_join" json:"-"`
-	DeprecatedAtlasEndpoint          string            `mapstructure:"atlas_endpoint" json:"-"`
-	DeprecatedHTTPAPIResponseHeaders map[string]string `mapstructure:"http_api_response_headers"`
-	DeprecatedRetryJoinEC2           RetryJoinEC2      `mapstructure:"retry_join_ec2"`
-	DeprecatedRetryJoinGCE           RetryJoinGCE      `mapstructure:"retry_join_gce"`
-	DeprecatedRetryJoinAzure         RetryJoinAzure    `mapstructure:"retry_join_azure"`
+	SessionTTLMin    time.Duration    `mapstructure:"-"`
+	SessionTTLMinRaw FlexibleDuration `mapstructure:"session_ttl_min"`
 }
 
 // IncomingHTTPSConfig returns the TLS configuration for HTTPS
@@ -817,25 +1065,57 @@ func (c *Config) IncomingHTTPSConfig() (*tls.Config, error) {
 	return tc.IncomingTLSConfig()
 }
 
+// CheckTLSConfig returns the TLS configuration of an HTTP check which uses
+// the TLS client configuration of the agent. serverName, if set, replaces
+// the server name of the agent.
+func (c *Config) CheckTLSConfig(serverName string) (*tls.Config, error) {
+	tc := &tlsutil.Config{
+		CAFile:        c.CAFile,
+		CAPath:        c.CAPath,
+		CertFile:      c.CertFile,
+		KeyFile:       c.KeyFile,
+		ServerName:    c.ServerName,
+		TLSMinVersion: c.TLSMinVersion,
+		CipherSuites:  c.TLSCipherSuites,
+	}
+	if serverName != "" {
+		tc.ServerName = serverName
+	}
+	return tc.ClientTLSConfig()
+}
+
+// ProtoAddr is an address an agent endpoint listens on and the application
+// protocol which is served on it, e.g. "dns", "http" or "https".
 type ProtoAddr struct {
-	Proto, Net, Addr string
+	Proto string
+
+	// Addr is a *net.TCPAddr, *net.UDPAddr or *net.UnixAddr.
+	Addr net.Addr
 }
 
 func (p ProtoAddr) String() string {
-	return p.Proto + "://" + p.Addr
+	return p.Proto + "://" + p.Addr.String()
 }
 
+// DNSAddrs returns the TCP and UDP addresses for the DNS server.
 func (c *Config) DNSAddrs() ([]ProtoAddr, error) {
 	if c.Ports.DNS <= 0 {
 		return nil, nil
 	}
-	a, err := c.ClientListener(c.Addresses.DNS, c.Ports.DNS)
+	listeners, err := c.ClientListeners(c.Addresses.DNS, c.Ports.DNS)
 	if err != nil {
 		return nil, err
 	}
-	addrs := []ProtoAddr{
-		{"dns", "tcp", a.String()},
-		{"dns", "udp", a.String()},
+	var addrs []ProtoAddr
+	for _, a := range listeners {
+		tcp, ok := a.(*net.TCPAddr)
+		if !ok {
+			return nil, fmt.Errorf("DNS cannot listen on unix socket %q", a)
+		}
+		addrs = append(addrs,
+			ProtoAddr{"dns", tcp},
+			ProtoAddr{"dns", &net.UDPAddr{IP: tcp.IP, Port: tcp.Port, Zone: tcp.Zone}},
+		)
 	}
 	return addrs, nil
 }
@@ -846,18 +1126,22 @@ func (c *Config) DNSAddrs() ([]ProtoAddr, error) {
 func (c *Config) HTTPAddrs() ([]ProtoAddr, error) {
 	var addrs []ProtoAddr
 	if c.Ports.HTTP > 0 {
-		a, err := c.ClientListener(c.Addresses.HTTP, c.Ports.HTTP)
+		listeners, err := c.ClientListeners(c.Addresses.HTTP, c.Ports.HTTP)
 		if err != nil {
 			return nil, err
 		}
-		addrs = append(addrs, ProtoAddr{"http", a.Network(), a.String()})
+		for _, a := range listeners {
+			addrs = append(addrs, ProtoAddr{"http", a})
+		}
 	}
 	if c.Ports.HTTPS > 0 && c.CertFile != "" && c.KeyFile != "" {
-		a, err := c.ClientListener(c.Addresses.HTTPS, c.Ports.HTTPS)
+		listeners, err := c.ClientListeners(c.Addresses.HTTPS, c.Ports.HTTPS)
 		if err != nil {
 			return nil, err
 		}
-		addrs = append(addrs, ProtoAddr{"https", a.Network(), a.String()})
+		for _, a := range listeners {
+			addrs = append(addrs, ProtoAddr{"https", a})
+		}
 	}
 	return addrs, nil
 }
@@ -930,12 +1214,17 @@ func DefaultConfig() *Config {
 		ClientAddr:      "127.0.0.1",
 		BindAddr:        "0.0.0.0",
 		Ports: PortConfig{
-			DNS:     8600,
-			HTTP:    8500,
-			HTTPS:   -1,
-			SerfLan: consul.DefaultLANSerfPort,
-			SerfWan: consul.DefaultWANSerfPort,
-			Server:  8300,
+			DNS:            8600,
+			HTTP:           8500,
+			HTTPS:          -1,
+			GRPC:           -1,
+			SerfLan:        consul.DefaultLANSerfPort,
+			SerfWan:        consul.DefaultWANSerfPort,
+			Server:         8300,
+			SidecarMinPort: 21000,
+			SidecarMaxPort: 21255,
+			ExposeMinPort:  21500,
+			ExposeMaxPort:  21755,
 		},
 		DNSConfig: DNSConfig{
 			AllowStale:      Bool(true),
@@ -947,14 +1236,37 @@ func DefaultConfig() *Config {
 			StatsitePrefix: "consul",
 			FilterDefault:  Bool(true),
 		},
+		GossipKeyRotation: GossipKeyRotation{
+			Retain: 1,
+		},
+		ConfigOverlay: ConfigOverlay{
+			Prefix: "_consul/agent-config",
+		},
+		Audit: Audit{
+			Sink: AuditSink{
+				Type:   "file",
+				Format: "json",
+			},
+		},
+		Permissions: Permissions{
+			DataDirMode:    "0750",
+			ConfigFileMode: "0644",
+			SecretFileMode: "0600",
+		},
+		DataDirFilesystemDenylist:  []string{"nfs", "cifs", "smb", "smb2"},
 		Meta:                       make(map[string]string),
 		SyslogFacility:             "LOCAL0",
 		Protocol:                   consul.ProtocolVersion2Compatible,
 		CheckUpdateInterval:        5 * time.Minute,
+		CheckOutputMaxSize:         CheckBufSize,
 		CheckDeregisterIntervalMin: time.Minute,
 		CheckReapInterval:          30 * time.Second,
 		AEInterval:                 time.Minute,
+		SecretFileWatchInterval:    10 * time.Second,
 		DisableCoordinates:         false,
+		Reporting: Reporting{
+			Interval: time.Hour,
+		},
 
 		// SyncCoordinateRateTarget is set based on the rate that we want
 		// the server to handle as an aggregate across the entire cluster.
@@ -1017,13 +1329,101 @@ func (c *Config) EncryptBytes() ([]byte, error) {
 	return base64.StdEncoding.DecodeString(c.EncryptKey)
 }
 
+// DataDirEncryptionKey returns the key used to encrypt sensitive state in
+// the data directory, or nil if data directory encryption is disabled.
+func (c *Config) DataDirEncryptionKey() ([]byte, error) {
+	key := c.DataDirEncryption.Key
+	if path := c.DataDirEncryption.KeyFile; path != "" {
+		if key != "" {
+			return nil, fmt.Errorf("data_dir_encryption: key and key_file are mutually exclusive")
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("data_dir_encryption: %v", err)
+		}
+		key = strings.TrimSpace(string(b))
+	}
+	if key == "" {
+		return nil, nil
+	}
+
+	b, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("data_dir_encryption: invalid key: %v", err)
+	}
+	switch len(b) {
+	case 16, 24, 32:
+		return b, nil
+	default:
+		return nil, fmt.Errorf("data_dir_encryption: key must be 16, 24 or 32 bytes, got %d", len(b))
+	}
+}
+
+// ValidateAudit checks the audit block for errors.
+func (c *Config) ValidateAudit() error {
+	if !c.Audit.Enabled {
+		return nil
+	}
+	sink := c.Audit.Sink
+	switch {
+	case sink.Type != "file":
+		return fmt.Errorf("audit.sink.type must be \"file\", got %q", sink.Type)
+	case sink.Path == "":
+		return fmt.Errorf("audit.sink.path must be set")
+	case sink.Format != "json" && sink.Format != "text":
+		return fmt.Errorf("audit.sink.format must be \"json\" or \"text\", got %q", sink.Format)
+	case sink.RotateBytes < 0:
+		return fmt.Errorf("audit.sink.rotate_bytes cannot be negative")
+	case sink.RotateDuration < 0:
+		return fmt.Errorf("audit.sink.rotate_duration cannot be negative")
+	case sink.RotateMaxFiles < 0:
+		return fmt.Errorf("audit.sink.rotate_max_files cannot be negative")
+	}
+	return nil
+}
+
 // ClientListener is used to format a listener for a
-// port on a ClientAddr
+// port on the first address of ClientAddr
 func (c *Config) ClientListener(override string, port int) (net.Addr, error) {
-	addr := c.ClientAddr
+	addrs, err := c.ClientListeners(override, port)
+	if err != nil {
+		return nil, err
+	}
+	return addrs[0], nil
+}
+
+// ClientListeners is used to format the listeners for a port
+// on every address of ClientAddr. The override replaces the
+// addresses of ClientAddr if it is set.
+func (c *Config) ClientListeners(override string, port int) ([]net.Addr, error) {
+	addrs := c.ClientAddr
 	if override != "" {
-		addr = override
+		addrs = override
+	}
+	list := splitAddrs(addrs)
+	if len(list) == 0 {
+		list = []string{addrs}
 	}
+	var listeners []net.Addr
+	for _, addr := range list {
+		l, err := clientListener(addr, port)
+		if err != nil {
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// splitAddrs splits a space or comma separated list of addresses.
+func splitAddrs(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+}
+
+// clientListener returns the listener for a port on a single address.
+func clientListener(addr string, port int) (net.Addr, error) {
 	if path := socketPath(addr); path != "" {
 		return &net.UnixAddr{Name: path, Net: "unix"}, nil
 	}
@@ -1035,122 +1435,209 @@ func (c *Config) ClientListener(override string, port int) (net.Addr, error) {
 }
 
 // VerifyUniqueListeners checks to see if an address was used more than once in
-// the config
+// the config. A wildcard address like 0.0.0.0 conflicts with the addresses
+// of its family on the same port. The returned *ConfigError names the ports
+// of both endpoints.
 func (c *Config) VerifyUniqueListeners() error {
+	bindAddr := func(addr string) string {
+		if addr != "" {
+			return addr
+		}
+		return c.BindAddr
+	}
 	listeners := []struct {
-		host  string
-		port  int
-		descr string
+		host   string
+		port   int
+		descr  string
+		key    string
+		client bool
 	}{
-		{c.Addresses.DNS, c.Ports.DNS, "DNS"},
-		{c.Addresses.HTTP, c.Ports.HTTP, "HTTP"},
-		{c.Addresses.HTTPS, c.Ports.HTTPS, "HTTPS"},
-		{c.AdvertiseAddr, c.Ports.Server, "Server RPC"},
-		{c.AdvertiseAddr, c.Ports.SerfLan, "Serf LAN"},
-		{c.AdvertiseAddr, c.Ports.SerfWan, "Serf WAN"},
+		{c.Addresses.DNS, c.Ports.DNS, "DNS", "ports.dns", true},
+		{c.Addresses.HTTP, c.Ports.HTTP, "HTTP", "ports.http", true},
+		{c.Addresses.HTTPS, c.Ports.HTTPS, "HTTPS", "ports.https", true},
+		{"", c.Ports.GRPC, "gRPC", "ports.grpc", true},
+		{c.BindAddr, c.Ports.Server, "Server RPC", "ports.server", false},
+		{bindAddr(c.SerfLanBindAddr), c.Ports.SerfLan, "Serf LAN", "ports.serf_lan", false},
+		{bindAddr(c.SerfWanBindAddr), c.Ports.SerfWan, "Serf WAN", "ports.serf_wan", false},
 	}
 
-	type key struct {
-		host string
-		port int
+	type bound struct {
+		host  string
+		port  int
+		descr string
+		key   string
 	}
-	m := make(map[key]string, len(listeners))
+	var seen []bound
 
 	for _, l := range listeners {
-		if l.host == "" {
-			l.host = "0.0.0.0"
-		} else if strings.HasPrefix(l.host, "unix") {
-			// Don't compare ports on unix sockets
-			l.port = 0
-		}
-		if l.host == "0.0.0.0" && l.port <= 0 {
-			continue
-		}
+		hosts := splitAddrs(l.host)
+
+		// The client endpoints without an address of their own listen on
+		// the client addresses.
+		if len(hosts) == 0 && l.client {
+			hosts = splitAddrs(c.ClientAddr)
+		}
+		if len(hosts) == 0 {
+			hosts = []string{"0.0.0.0"}
+		}
+		for _, host := range hosts {
+			port := l.port
+			if socketPath(host) != "" {
+				// Don't compare ports on unix sockets
+				port = 0
+			} else if port <= 0 {
+				// The endpoint is disabled.
+				continue
+			}
 
-		k := key{l.host, l.port}
-		v, ok := m[k]
-		if ok {
-			return fmt.Errorf("%s address already configured for %s", l.descr, v)
+			for _, b := range seen {
+				if b.port != port || !listenAddrsOverlap(b.host, host) {
+					continue
+				}
+				addr := host
+				if port > 0 {
+					addr = net.JoinHostPort(strings.Trim(host, "[]"), fmt.Sprint(port))
+				}
+				return configErrorf([]string{b.key, l.key}, "%s and %s cannot both listen on %s", b.descr, l.descr, addr)
+			}
+			seen = append(seen, bound{host, port, l.descr, l.key})
 		}
-		m[k] = l.descr
 	}
 	return nil
 }
 
+// listenAddrsOverlap returns true if listeners on the addresses a and b
+// with the same port conflict.
+func listenAddrsOverlap(a, b string) bool {
+	if a == b {
+		return true
+	}
+	ipA, ipB := net.ParseIP(strings.Trim(a, "[]")), net.ParseIP(strings.Trim(b, "[]"))
+	if ipA == nil || ipB == nil {
+		return false
+	}
+	if ipA.Equal(ipB) {
+		return true
+	}
+	sameFamily := (ipA.To4() == nil) == (ipB.To4() == nil)
+	return sameFamily && (ipA.IsUnspecified() || ipB.IsUnspecified())
+}
+
 // DecodeConfig reads the configuration from the given reader in JSON
 // format and decodes it into a proper Config structure.
 func DecodeConfig(r io.Reader) (*Config, error) {
+	return decodeConfig(r, nil, false, false)
+}
+
+// decodeConfig works like DecodeConfig but replaces the ${NAME} references
+// to the given variables in all string values before decoding. If strict
+// is set, unknown keys of service and check definitions are rejected like
+// the unknown keys of the configuration. If funcs is set, the function
+// calls like ${env "NAME"} are replaced with their results after the
+// variables.
+func decodeConfig(r io.Reader, vars map[string]string, strict, funcs bool) (*Config, error) {
 	var raw interface{}
 	if err := json.NewDecoder(r).Decode(&raw); err != nil {
 		return nil, err
 	}
+	if len(vars) > 0 {
+		raw = interpolateVars(raw, vars)
+	}
+	if funcs {
+		var err error
+		if raw, err = interpolateConfigFuncs(raw); err != nil {
+			return nil, err
+		}
+	}
+	if name := undefinedConfigVar(raw); name != "" {
+		return nil, fmt.Errorf("Undefined variable %s", name)
+	}
 
 	// Check the result type
 	var result Config
+	var unused, deprecations, invalidNulls []string
 	if obj, ok := raw.(map[string]interface{}); ok {
+		// The variable declarations were read before the configuration
+		// was decoded.
+		delete(obj, "variable")
+
+		// Keys set to null clear the values of earlier configurations
+		// and are not decoded.
+		result.Unset, invalidNulls = unsetConfigKeys(obj)
+
+		// Translate the legacy keys before decoding so that existing
+		// configuration files keep working.
+		for _, change := range MigrateLegacyConfig(obj) {
+			if change.NewKey == "" {
+				deprecations = append(deprecations, fmt.Sprintf("%s is deprecated and is "+
+					"no longer used. Please remove it from your configuration", change.Key))
+				continue
+			}
+			deprecations = append(deprecations, fmt.Sprintf("%s is deprecated. "+
+				"Please use %s instead", change.Key, change.NewKey))
+		}
+		if err := fixupSecretFiles(obj); err != nil {
+			return nil, err
+		}
+		for _, key := range fixupFlexibleConfig(obj) {
+			deprecations = append(deprecations, fmt.Sprintf("a single string for %s is deprecated. "+
+				"Please use a list instead", key))
+		}
+		for _, key := range fixupFlexibleDurations(obj) {
+			deprecations = append(deprecations, fmt.Sprintf("a number of seconds for %s is deprecated. "+
+				"Please use a duration like \"30s\" instead", key))
+		}
+		if err := checkStrictConfigBlocks(obj); err != nil {
+			return nil, err
+		}
+
 		// Check for a "services", "service" or "check" key, meaning
 		// this is actually a definition entry
 		if sub, ok := obj["services"]; ok {
 			if list, ok := sub.([]interface{}); ok {
-				for _, srv := range list {
-					service, err := DecodeServiceDefinition(srv)
+				for i, srv := range list {
+					service, md, err := decodeServiceDefinition(srv)
 					if err != nil {
 						return nil, err
 					}
 					result.Services = append(result.Services, service)
+					unused = append(unused, prefixKeys(fmt.Sprintf("services[%d].", i), md)...)
 				}
 			}
 		}
 		if sub, ok := obj["service"]; ok {
-			service, err := DecodeServiceDefinition(sub)
+			service, md, err := decodeServiceDefinition(sub)
 			if err != nil {
 				return nil, err
 			}
 			result.Services = append(result.Services, service)
+			unused = append(unused, prefixKeys("service.", md)...)
 		}
 		if sub, ok := obj["checks"]; ok {
 			if list, ok := sub.([]interface{}); ok {
-				for _, chk := range list {
-					check, err := DecodeCheckDefinition(chk)
+				for i, chk := range list {
+					check, md, err := decodeCheckDefinition(chk)
 					if err != nil {
 						return nil, err
 					}
 					result.Checks = append(result.Checks, check)
+					unused = append(unused, prefixKeys(fmt.Sprintf("checks[%d].", i), md)...)
 				}
 			}
 		}
 		if sub, ok := obj["check"]; ok {
-			check, err := DecodeCheckDefinition(sub)
+			check, md, err := decodeCheckDefinition(sub)
 			if err != nil {
 				return nil, err
 			}
 			result.Checks = append(result.Checks, check)
-		}
-
-		// A little hacky but upgrades the old stats config directives to the new way
-		if sub, ok := obj["statsd_addr"]; ok && result.Telemetry.StatsdAddr == "" {
-			result.Telemetry.StatsdAddr = sub.(string)
-		}
-
-		if sub, ok := obj["statsite_addr"]; ok && result.Telemetry.StatsiteAddr == "" {
-			result.Telemetry.StatsiteAddr = sub.(string)
-		}
-
-		if sub, ok := obj["statsite_prefix"]; ok && result.Telemetry.StatsitePrefix == "" {
-			result.Telemetry.StatsitePrefix = sub.(string)
-		}
-
-		if sub, ok := obj["dogstatsd_addr"]; ok && result.Telemetry.DogStatsdAddr == "" {
-			result.Telemetry.DogStatsdAddr = sub.(string)
-		}
-
-		if sub, ok := obj["dogstatsd_tags"].([]interface{}); ok && len(result.Telemetry.DogStatsdTags) == 0 {
-			result.Telemetry.DogStatsdTags = make([]string, len(sub))
-			for i := range sub {
-				result.Telemetry.DogStatsdTags[i] = sub[i].(string)
-			}
+			unused = append(unused, prefixKeys("check.", md)...)
 		}
 	}
+	if !strict {
+		unused = nil
+	}
+	unused = append(unused, invalidNulls...)
 
 	// Decode
 	var md mapstructure.Metadata
@@ -1166,67 +1653,41 @@ func DecodeConfig(r io.Reader) (*Config, error) {
 		return nil, err
 	}
 
-	// Check for deprecations
-	if result.Ports.RPC != 0 {
-		fmt.Fprintln(os.Stderr, "==> DEPRECATION: ports.rpc is deprecated and is "+
-			"no longer used. Please remove it from your configuration.")
-	}
-	if result.Addresses.RPC != "" {
-		fmt.Fprintln(os.Stderr, "==> DEPRECATION: addresses.rpc is deprecated and "+
-			"is no longer used. Please remove it from your configuration.")
-	}
-	if result.DeprecatedAtlasInfrastructure != "" {
-		fmt.Fprintln(os.Stderr, "==> DEPRECATION: atlas_infrastructure is deprecated and "+
-			"is no longer used. Please remove it from your configuration.")
-	}
-	if result.DeprecatedAtlasToken != "" {
-		fmt.Fprintln(os.Stderr, "==> DEPRECATION: atlas_token is deprecated and "+
-			"is no longer used. Please remove it from your configuration.")
-	}
-	if result.DeprecatedAtlasACLToken != "" {
-		fmt.Fprintln(os.Stderr, "==> DEPRECATION: atlas_acl_token is deprecated and "+
-			"is no longer used. Please remove it from your configuration.")
-	}
-	if result.DeprecatedAtlasJoin != false {
-		fmt.Fprintln(os.Stderr, "==> DEPRECATION: atlas_join is deprecated and "+
-			"is no longer used. Please remove it from your configuration.")
-	}
-	if result.DeprecatedAtlasEndpoint != "" {
-		fmt.Fprintln(os.Stderr, "==> DEPRECATION: atlas_endpoint is deprecated and "+
-			"is no longer used. Please remove it from your configuration.")
-	}
-
 	// Check unused fields and verify that no bad configuration options were
 	// passed to Consul. There are a few additional fields which don't directly
-	// use mapstructure decoding, so we need to account for those as well. These
-	// telemetry-related fields used to be available as top-level keys, so they
-	// are here for backward compatibility with the old format.
-	allowedKeys := []string{
-		"service", "services", "check", "checks", "statsd_addr", "statsite_addr", "statsite_prefix",
-		"dogstatsd_addr", "dogstatsd_tags",
-	}
+	// use mapstructure decoding, so we need to account for those as well.
+	allowedKeys := []string{"service", "services", "check", "checks"}
 
-	var unused []string
 	for _, field := range md.Unused {
 		if !lib.StrContains(allowedKeys, field) {
 			unused = append(unused, field)
 		}
 	}
 	if len(unused) > 0 {
+		sort.Strings(unused)
 		return nil, fmt.Errorf("Config has invalid keys: %s", strings.Join(unused, ","))
 	}
+	result.Deprecations = deprecations
 
 	// Handle time conversions
 	if raw := result.DNSConfig.NodeTTLRaw; raw != "" {
-		dur, err := time.ParseDuration(raw)
+		dur, err := raw.Duration()
 		if err != nil {
 			return nil, fmt.Errorf("NodeTTL invalid: %v", err)
 		}
 		result.DNSConfig.NodeTTL = dur
 	}
 
+	if raw := result.CheckDefaults.HTTP.TimeoutRaw; raw != "" {
+		dur, err := raw.Duration()
+		if err != nil {
+			return nil, fmt.Errorf("CheckDefaults.HTTP.Timeout invalid: %v", err)
+		}
+		result.CheckDefaults.HTTP.Timeout = dur
+	}
+
 	if raw := result.DNSConfig.MaxStaleRaw; raw != "" {
-		dur, err := time.ParseDuration(raw)
+		dur, err := raw.Duration()
 		if err != nil {
 			return nil, fmt.Errorf("MaxStale invalid: %v", err)
 		}
@@ -1234,7 +1695,7 @@ func DecodeConfig(r io.Reader) (*Config, error) {
 	}
 
 	if raw := result.DNSConfig.RecursorTimeoutRaw; raw != "" {
-		dur, err := time.ParseDuration(raw)
+		dur, err := raw.Duration()
 		if err != nil {
 			return nil, fmt.Errorf("RecursorTimeout invalid: %v", err)
 		}
@@ -1246,7 +1707,7 @@ func DecodeConfig(r io.Reader) (*Config, error) {
 			result.DNSConfig.ServiceTTL = make(map[string]time.Duration)
 		}
 		for service, raw := range result.DNSConfig.ServiceTTLRaw {
-			dur, err := time.ParseDuration(raw)
+			dur, err := raw.Duration()
 			if err != nil {
 				return nil, fmt.Errorf("ServiceTTL %s invalid: %v", service, err)
 			}
@@ -1255,15 +1716,47 @@ func DecodeConfig(r io.Reader) (*Config, error) {
 	}
 
 	if raw := result.CheckUpdateIntervalRaw; raw != "" {
-		dur, err := time.ParseDuration(raw)
+		dur, err := raw.Duration()
 		if err != nil {
 			return nil, fmt.Errorf("CheckUpdateInterval invalid: %v", err)
 		}
 		result.CheckUpdateInterval = dur
 	}
 
+	if raw := result.CheckDeregisterIntervalMinRaw; raw != "" {
+		dur, err := raw.Duration()
+		if err != nil {
+			return nil, fmt.Errorf("CheckDeregisterIntervalMin invalid: %v", err)
+		}
+		result.CheckDeregisterIntervalMin = dur
+	}
+
+	if raw := result.DeregisterCriticalServiceAfterRaw; raw != "" {
+		dur, err := raw.Duration()
+		if err != nil {
+			return nil, fmt.Errorf("DeregisterCriticalServiceAfter invalid: %v", err)
+		}
+		result.DeregisterCriticalServiceAfter = dur
+	}
+
+	if raw := result.Reporting.IntervalRaw; raw != "" {
+		dur, err := raw.Duration()
+		if err != nil {
+			return nil, fmt.Errorf("Reporting.Interval invalid: %v", err)
+		}
+		result.Reporting.Interval = dur
+	}
+
+	if raw := result.ConfigStaleCheckIntervalRaw; raw != "" {
+		dur, err := raw.Duration()
+		if err != nil {
+			return nil, fmt.Errorf("ConfigStaleCheckInterval invalid: %v", err)
+		}
+		result.ConfigStaleCheckInterval = dur
+	}
+
 	if raw := result.ACLTTLRaw; raw != "" {
-		dur, err := time.ParseDuration(raw)
+		dur, err := raw.Duration()
 		if err != nil {
 			return nil, fmt.Errorf("ACL TTL invalid: %v", err)
 		}
@@ -1271,7 +1764,7 @@ func DecodeConfig(r io.Reader) (*Config, error) {
 	}
 
 	if raw := result.RetryIntervalRaw; raw != "" {
-		dur, err := time.ParseDuration(raw)
+		dur, err := raw.Duration()
 		if err != nil {
 			return nil, fmt.Errorf("RetryInterval invalid: %v", err)
 		}
@@ -1279,7 +1772,7 @@ func DecodeConfig(r io.Reader) (*Config, error) {
 	}
 
 	if raw := result.RetryIntervalWanRaw; raw != "" {
-		dur, err := time.ParseDuration(raw)
+		dur, err := raw.Duration()
 		if err != nil {
 			return nil, fmt.Errorf("RetryIntervalWan invalid: %v", err)
 		}
@@ -1288,7 +1781,7 @@ func DecodeConfig(r io.Reader) (*Config, error) {
 
 	const reconnectTimeoutMin = 8 * time.Hour
 	if raw := result.ReconnectTimeoutLanRaw; raw != "" {
-		dur, err := time.ParseDuration(raw)
+		dur, err := raw.Duration()
 		if err != nil {
 			return nil, fmt.Errorf("ReconnectTimeoutLan invalid: %v", err)
 		}
@@ -1298,7 +1791,7 @@ func DecodeConfig(r io.Reader) (*Config, error) {
 		result.ReconnectTimeoutLan = dur
 	}
 	if raw := result.ReconnectTimeoutWanRaw; raw != "" {
-		dur, err := time.ParseDuration(raw)
+		dur, err := raw.Duration()
 		if err != nil {
 			return nil, fmt.Errorf("ReconnectTimeoutWan invalid: %v", err)
 		}
@@ -1309,27 +1802,38 @@ func DecodeConfig(r io.Reader) (*Config, error) {
 	}
 
 	if raw := result.Autopilot.LastContactThresholdRaw; raw != "" {
-		dur, err := time.ParseDuration(raw)
+		dur, err := raw.Duration()
 		if err != nil {
 			return nil, fmt.Errorf("LastContactThreshold invalid: %v", err)
 		}
 		result.Autopilot.LastContactThreshold = &dur
 	}
 	if raw := result.Autopilot.ServerStabilizationTimeRaw; raw != "" {
-		dur, err := time.ParseDuration(raw)
+		dur, err := raw.Duration()
 		if err != nil {
 			return nil, fmt.Errorf("ServerStabilizationTime invalid: %v", err)
 		}
 		result.Autopilot.ServerStabilizationTime = &dur
 	}
 
-	// Merge the single recursor
-	if result.DNSRecursor != "" {
-		result.DNSRecursors = append(result.DNSRecursors, result.DNSRecursor)
+	if raw := result.GossipKeyRotation.IntervalRaw; raw != "" {
+		dur, err := raw.Duration()
+		if err != nil {
+			return nil, fmt.Errorf("Gossip key rotation interval invalid: %v", err)
+		}
+		result.GossipKeyRotation.Interval = dur
+	}
+
+	if raw := result.Audit.Sink.RotateDurationRaw; raw != "" {
+		dur, err := raw.Duration()
+		if err != nil {
+			return nil, fmt.Errorf("Audit sink rotate_duration invalid: %v", err)
+		}
+		result.Audit.Sink.RotateDuration = dur
 	}
 
 	if raw := result.SessionTTLMinRaw; raw != "" {
-		dur, err := time.ParseDuration(raw)
+		dur, err := raw.Duration()
 		if err != nil {
 			return nil, fmt.Errorf("Session TTL Min invalid: %v", err)
 		}
@@ -1378,11 +1882,6 @@ func DecodeConfig(r io.Reader) (*Config, error) {
 		result.AdvertiseAddrs.RPC = addr
 	}
 
-	// Enforce the max Raft multiplier.
-	if result.Performance.RaftMultiplier > consul.MaxRaftMultiplier {
-		return nil, fmt.Errorf("Performance.RaftMultiplier must be <= %d", consul.MaxRaftMultiplier)
-	}
-
 	if raw := result.TLSCipherSuitesRaw; raw != "" {
 		ciphers, err := tlsutil.ParseCiphers(raw)
 		if err != nil {
@@ -1391,20 +1890,6 @@ func DecodeConfig(r io.Reader) (*Config, error) {
 		result.TLSCipherSuites = ciphers
 	}
 
-	// This is for backwards compatibility.
-	// HTTPAPIResponseHeaders has been replaced with HTTPConfig.ResponseHeaders
-	if len(result.DeprecatedHTTPAPIResponseHeaders) > 0 {
-		fmt.Fprintln(os.Stderr, "==> DEPRECATION: http_api_response_headers is deprecated and "+
-			"is no longer used. Please use http_config.response_headers instead.")
-		if result.HTTPConfig.ResponseHeaders == nil {
-			result.HTTPConfig.ResponseHeaders = make(map[string]string)
-		}
-		for field, value := range result.DeprecatedHTTPAPIResponseHeaders {
-			result.HTTPConfig.ResponseHeaders[field] = value
-		}
-		result.DeprecatedHTTPAPIResponseHeaders = nil
-	}
-
 	// Set the ACL replication enable if they set a token, for backwards
 	// compatibility.
 	if result.ACLReplicationToken != "" {
@@ -1431,6 +1916,13 @@ func DecodeConfig(r io.Reader) (*Config, error) {
 
 // DecodeServiceDefinition is used to decode a service definition
 func DecodeServiceDefinition(raw interface{}) (*structs.ServiceDefinition, error) {
+	service, _, err := decodeServiceDefinition(raw)
+	return service, err
+}
+
+// decodeServiceDefinition works like DecodeServiceDefinition and also
+// returns the keys of the definition which were not decoded.
+func decodeServiceDefinition(raw interface{}) (*structs.ServiceDefinition, []string, error) {
 	rawMap, ok := raw.(map[string]interface{})
 	if !ok {
 		goto AFTER_FIX
@@ -1447,7 +1939,7 @@ func DecodeServiceDefinition(raw interface{}) (*structs.ServiceDefinition, error
 		switch strings.ToLower(k) {
 		case "check":
 			if err := FixupCheckType(v); err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 		case "checks":
 			chkTypes, ok := v.([]interface{})
@@ -1456,7 +1948,7 @@ func DecodeServiceDefinition(raw interface{}) (*structs.ServiceDefinition, error
 			}
 			for _, chkType := range chkTypes {
 				if err := FixupCheckType(chkType); err != nil {
-					return nil, err
+					return nil, nil, err
 				}
 			}
 		}
@@ -1469,12 +1961,20 @@ AFTER_FIX:
 		Result:   &result,
 	})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if err := msdec.Decode(raw); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return &result, nil
+
+	// The deprecated tag was handled above.
+	var unused []string
+	for _, k := range md.Unused {
+		if k != "tag" {
+			unused = append(unused, k)
+		}
+	}
+	return &result, unused, nil
 }
 
 var errInvalidHeaderFormat = errors.New("agent: invalid format of 'header' field")
@@ -1559,11 +2059,20 @@ func FixupCheckType(raw interface{}) error {
 		case "docker_container_id":
 			replace(k, "DockerContainerID", v)
 
+		case "output_max_size":
+			replace(k, "OutputMaxSize", v)
+
 		case "service_id":
 			replace(k, "ServiceID", v)
 
 		case "tls_skip_verify":
 			replace(k, "TLSSkipVerify", v)
+
+		case "tls_server_name":
+			replace(k, "TLSServerName", v)
+
+		case "enable_agent_tls":
+			replace(k, "EnableAgentTLS", v)
 		}
 	}
 	return nil
@@ -1571,8 +2080,15 @@ func FixupCheckType(raw interface{}) error {
 
 // DecodeCheckDefinition is used to decode a check definition
 func DecodeCheckDefinition(raw interface{}) (*structs.CheckDefinition, error) {
+	check, _, err := decodeCheckDefinition(raw)
+	return check, err
+}
+
+// decodeCheckDefinition works like DecodeCheckDefinition and also returns
+// the keys of the definition which were not decoded.
+func decodeCheckDefinition(raw interface{}) (*structs.CheckDefinition, []string, error) {
 	if err := FixupCheckType(raw); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	var md mapstructure.Metadata
 	var result structs.CheckDefinition
@@ -1581,563 +2097,210 @@ func DecodeCheckDefinition(raw interface{}) (*structs.CheckDefinition, error) {
 		Result:   &result,
 	})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if err := msdec.Decode(raw); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return &result, nil
+	return &result, md.Unused, nil
+}
+
+// prefixKeys returns the keys with the given prefix.
+func prefixKeys(prefix string, keys []string) []string {
+	var result []string
+	for _, k := range keys {
+		result = append(result, prefix+k)
+	}
+	return result
 }
 
 // MergeConfig merges two configurations together to make a single new
-// configuration.
+// configuration. Values set in b take precedence. Slices are appended and
+// maps are combined unless the merge tag of the field says otherwise, see
+// mergeFields and mergeTags. The keys which b unsets are reset to their
+// default value first, so that b can clear the values of a.
 func MergeConfig(a, b *Config) *Config {
-	var result Config = *a
+	return MergeConfigSource(a, b, "", nil)
+}
 
-	// Propagate non-default performance settings
-	if b.Performance.RaftMultiplier > 0 {
-		result.Performance.RaftMultiplier = b.Performance.RaftMultiplier
+// MergeConfigSource works like MergeConfig and records source in prov for
+// the keys which b sets, if prov is not nil.
+func MergeConfigSource(a, b *Config, source string, prov Provenance) *Config {
+	var result Config = *a
+	if len(b.Unset) > 0 {
+		keys := make(map[string]bool)
+		for _, k := range b.Unset {
+			keys[k] = true
+			if prov != nil {
+				prov[k] = source
+			}
+		}
+		def := reflect.ValueOf(DefaultConfig()).Elem()
+		unsetFields(mergeFieldsForConfig(), reflect.ValueOf(&result).Elem(), def, keys)
 	}
+	mergeFields(mergeFieldsForConfig(), reflect.ValueOf(&result).Elem(), reflect.ValueOf(b).Elem(), source, prov)
+	return &result
+}
 
-	// Copy the strings if they're set
-	if b.Bootstrap {
-		result.Bootstrap = true
-	}
-	if b.BootstrapExpect != 0 {
-		result.BootstrapExpect = b.BootstrapExpect
-	}
-	if b.Datacenter != "" {
-		result.Datacenter = b.Datacenter
-	}
-	if b.DataDir != "" {
-		result.DataDir = b.DataDir
-	}
+// ReadConfigPaths reads the paths in the given order to load configurations.
+// The paths can be to files, directories or glob patterns. If the path is
+// a directory, we read one directory deep and read any files ending in
+// ".json", ".yaml", ".yml" or ".hcl" as configuration files. Files are
+// decoded concurrently but always merged in that order.
+func ReadConfigPaths(paths []string) (*Config, error) {
+	return readConfigPaths(paths, runtime.GOMAXPROCS(0), DefaultConfigLimits(), nil, nil)
+}
 
-	// Copy the dns recursors
-	result.DNSRecursors = make([]string, 0, len(a.DNSRecursors)+len(b.DNSRecursors))
-	result.DNSRecursors = append(result.DNSRecursors, a.DNSRecursors...)
-	result.DNSRecursors = append(result.DNSRecursors, b.DNSRecursors...)
+// configFile is a single configuration file read by readConfigPaths. err
+// is set if the path could not be read, so that errors are reported in the
+// same order in which the files are merged. done is closed once the file
+// has been decoded.
+type configFile struct {
+	path   string
+	size   int64
+	err    error
+	config *Config
+	done   chan struct{}
+}
 
-	if b.Domain != "" {
-		result.Domain = b.Domain
-	}
-	if b.EncryptKey != "" {
-		result.EncryptKey = b.EncryptKey
-	}
-	if b.DisableKeyringFile {
-		result.DisableKeyringFile = true
-	}
-	if b.EncryptVerifyIncoming != nil {
-		result.EncryptVerifyIncoming = b.EncryptVerifyIncoming
-	}
-	if b.EncryptVerifyOutgoing != nil {
-		result.EncryptVerifyOutgoing = b.EncryptVerifyOutgoing
-	}
-	if b.LogLevel != "" {
-		result.LogLevel = b.LogLevel
-	}
-	if b.Protocol > 0 {
-		result.Protocol = b.Protocol
-	}
-	if b.RaftProtocol > 0 {
-		result.RaftProtocol = b.RaftProtocol
-	}
-	if b.NodeID != "" {
-		result.NodeID = b.NodeID
-	}
-	if b.DisableHostNodeID != nil {
-		result.DisableHostNodeID = b.DisableHostNodeID
-	}
-	if b.NodeName != "" {
-		result.NodeName = b.NodeName
-	}
-	if b.ClientAddr != "" {
-		result.ClientAddr = b.ClientAddr
-	}
-	if b.BindAddr != "" {
-		result.BindAddr = b.BindAddr
-	}
-	if b.AdvertiseAddr != "" {
-		result.AdvertiseAddr = b.AdvertiseAddr
-	}
-	if b.AdvertiseAddrWan != "" {
-		result.AdvertiseAddrWan = b.AdvertiseAddrWan
-	}
-	if b.SerfWanBindAddr != "" {
-		result.SerfWanBindAddr = b.SerfWanBindAddr
-	}
-	if b.SerfLanBindAddr != "" {
-		result.SerfLanBindAddr = b.SerfLanBindAddr
-	}
-	if b.TranslateWanAddrs == true {
-		result.TranslateWanAddrs = true
-	}
-	if b.AdvertiseAddrs.SerfLan != nil {
-		result.AdvertiseAddrs.SerfLan = b.AdvertiseAddrs.SerfLan
-		result.AdvertiseAddrs.SerfLanRaw = b.AdvertiseAddrs.SerfLanRaw
-	}
-	if b.AdvertiseAddrs.SerfWan != nil {
-		result.AdvertiseAddrs.SerfWan = b.AdvertiseAddrs.SerfWan
-		result.AdvertiseAddrs.SerfWanRaw = b.AdvertiseAddrs.SerfWanRaw
-	}
-	if b.AdvertiseAddrs.RPC != nil {
-		result.AdvertiseAddrs.RPC = b.AdvertiseAddrs.RPC
-		result.AdvertiseAddrs.RPCRaw = b.AdvertiseAddrs.RPCRaw
-	}
-	if b.Server == true {
-		result.Server = b.Server
-	}
-	if b.NonVotingServer == true {
-		result.NonVotingServer = b.NonVotingServer
-	}
-	if b.LeaveOnTerm != nil {
-		result.LeaveOnTerm = b.LeaveOnTerm
-	}
-	if b.SkipLeaveOnInt != nil {
-		result.SkipLeaveOnInt = b.SkipLeaveOnInt
-	}
-	if b.Autopilot.CleanupDeadServers != nil {
-		result.Autopilot.CleanupDeadServers = b.Autopilot.CleanupDeadServers
-	}
-	if b.Autopilot.LastContactThreshold != nil {
-		result.Autopilot.LastContactThreshold = b.Autopilot.LastContactThreshold
-	}
-	if b.Autopilot.MaxTrailingLogs != nil {
-		result.Autopilot.MaxTrailingLogs = b.Autopilot.MaxTrailingLogs
-	}
-	if b.Autopilot.ServerStabilizationTime != nil {
-		result.Autopilot.ServerStabilizationTime = b.Autopilot.ServerStabilizationTime
-	}
-	if b.Autopilot.RedundancyZoneTag != "" {
-		result.Autopilot.RedundancyZoneTag = b.Autopilot.RedundancyZoneTag
-	}
-	if b.Autopilot.DisableUpgradeMigration != nil {
-		result.Autopilot.DisableUpgradeMigration = b.Autopilot.DisableUpgradeMigration
-	}
-	if b.Autopilot.UpgradeVersionTag != "" {
-		result.Autopilot.UpgradeVersionTag = b.Autopilot.UpgradeVersionTag
-	}
-	if b.Telemetry.DisableHostname == true {
-		result.Telemetry.DisableHostname = true
-	}
-	if len(b.Telemetry.PrefixFilter) != 0 {
-		result.Telemetry.PrefixFilter = append(result.Telemetry.PrefixFilter, b.Telemetry.PrefixFilter...)
-	}
-	if b.Telemetry.FilterDefault != nil {
-		result.Telemetry.FilterDefault = b.Telemetry.FilterDefault
-	}
-	if b.Telemetry.StatsdAddr != "" {
-		result.Telemetry.StatsdAddr = b.Telemetry.StatsdAddr
-	}
-	if b.Telemetry.StatsiteAddr != "" {
-		result.Telemetry.StatsiteAddr = b.Telemetry.StatsiteAddr
-	}
-	if b.Telemetry.StatsitePrefix != "" {
-		result.Telemetry.StatsitePrefix = b.Telemetry.StatsitePrefix
-	}
-	if b.Telemetry.DogStatsdAddr != "" {
-		result.Telemetry.DogStatsdAddr = b.Telemetry.DogStatsdAddr
-	}
-	if b.Telemetry.DogStatsdTags != nil {
-		result.Telemetry.DogStatsdTags = b.Telemetry.DogStatsdTags
-	}
-	if b.Telemetry.CirconusAPIToken != "" {
-		result.Telemetry.CirconusAPIToken = b.Telemetry.CirconusAPIToken
-	}
-	if b.Telemetry.CirconusAPIApp != "" {
-		result.Telemetry.CirconusAPIApp = b.Telemetry.CirconusAPIApp
-	}
-	if b.Telemetry.CirconusAPIURL != "" {
-		result.Telemetry.CirconusAPIURL = b.Telemetry.CirconusAPIURL
-	}
-	if b.Telemetry.CirconusCheckSubmissionURL != "" {
-		result.Telemetry.CirconusCheckSubmissionURL = b.Telemetry.CirconusCheckSubmissionURL
-	}
-	if b.Telemetry.CirconusSubmissionInterval != "" {
-		result.Telemetry.CirconusSubmissionInterval = b.Telemetry.CirconusSubmissionInterval
-	}
-	if b.Telemetry.CirconusCheckID != "" {
-		result.Telemetry.CirconusCheckID = b.Telemetry.CirconusCheckID
-	}
-	if b.Telemetry.CirconusCheckForceMetricActivation != "" {
-		result.Telemetry.CirconusCheckForceMetricActivation = b.Telemetry.CirconusCheckForceMetricActivation
-	}
-	if b.Telemetry.CirconusCheckInstanceID != "" {
-		result.Telemetry.CirconusCheckInstanceID = b.Telemetry.CirconusCheckInstanceID
-	}
-	if b.Telemetry.CirconusCheckSearchTag != "" {
-		result.Telemetry.CirconusCheckSearchTag = b.Telemetry.CirconusCheckSearchTag
-	}
-	if b.Telemetry.CirconusCheckDisplayName != "" {
-		result.Telemetry.CirconusCheckDisplayName = b.Telemetry.CirconusCheckDisplayName
-	}
-	if b.Telemetry.CirconusCheckTags != "" {
-		result.Telemetry.CirconusCheckTags = b.Telemetry.CirconusCheckTags
-	}
-	if b.Telemetry.CirconusBrokerID != "" {
-		result.Telemetry.CirconusBrokerID = b.Telemetry.CirconusBrokerID
-	}
-	if b.Telemetry.CirconusBrokerSelectTag != "" {
-		result.Telemetry.CirconusBrokerSelectTag = b.Telemetry.CirconusBrokerSelectTag
-	}
-	if b.EnableDebug {
-		result.EnableDebug = true
-	}
-	if b.VerifyIncoming {
-		result.VerifyIncoming = true
-	}
-	if b.VerifyIncomingRPC {
-		result.VerifyIncomingRPC = true
-	}
-	if b.VerifyIncomingHTTPS {
-		result.VerifyIncomingHTTPS = true
-	}
-	if b.VerifyOutgoing {
-		result.VerifyOutgoing = true
-	}
-	if b.VerifyServerHostname {
-		result.VerifyServerHostname = true
-	}
-	if b.CAFile != "" {
-		result.CAFile = b.CAFile
-	}
-	if b.CAPath != "" {
-		result.CAPath = b.CAPath
-	}
-	if b.CertFile != "" {
-		result.CertFile = b.CertFile
-	}
-	if b.KeyFile != "" {
-		result.KeyFile = b.KeyFile
-	}
-	if b.ServerName != "" {
-		result.ServerName = b.ServerName
-	}
-	if b.TLSMinVersion != "" {
-		result.TLSMinVersion = b.TLSMinVersion
-	}
-	if len(b.TLSCipherSuites) != 0 {
-		result.TLSCipherSuites = append(result.TLSCipherSuites, b.TLSCipherSuites...)
-	}
-	if b.TLSPreferServerCipherSuites {
-		result.TLSPreferServerCipherSuites = true
-	}
-	if b.Checks != nil {
-		result.Checks = append(result.Checks, b.Checks...)
-	}
-	if b.Services != nil {
-		result.Services = append(result.Services, b.Services...)
-	}
-	if b.Ports.DNS != 0 {
-		result.Ports.DNS = b.Ports.DNS
-	}
-	if b.Ports.HTTP != 0 {
-		result.Ports.HTTP = b.Ports.HTTP
-	}
-	if b.Ports.HTTPS != 0 {
-		result.Ports.HTTPS = b.Ports.HTTPS
-	}
-	if b.Ports.RPC != 0 {
-		result.Ports.RPC = b.Ports.RPC
-	}
-	if b.Ports.SerfLan != 0 {
-		result.Ports.SerfLan = b.Ports.SerfLan
-	}
-	if b.Ports.SerfWan != 0 {
-		result.Ports.SerfWan = b.Ports.SerfWan
-	}
-	if b.Ports.Server != 0 {
-		result.Ports.Server = b.Ports.Server
-	}
-	if b.Addresses.DNS != "" {
-		result.Addresses.DNS = b.Addresses.DNS
-	}
-	if b.Addresses.HTTP != "" {
-		result.Addresses.HTTP = b.Addresses.HTTP
-	}
-	if b.Addresses.HTTPS != "" {
-		result.Addresses.HTTPS = b.Addresses.HTTPS
-	}
-	if b.Addresses.RPC != "" {
-		result.Addresses.RPC = b.Addresses.RPC
-	}
-	if b.EnableUI {
-		result.EnableUI = true
-	}
-	if b.UIDir != "" {
-		result.UIDir = b.UIDir
-	}
-	if b.PidFile != "" {
-		result.PidFile = b.PidFile
-	}
-	if b.EnableSyslog {
-		result.EnableSyslog = true
-	}
-	if b.RejoinAfterLeave {
-		result.RejoinAfterLeave = true
-	}
-	if b.RetryMaxAttempts != 0 {
-		result.RetryMaxAttempts = b.RetryMaxAttempts
-	}
-	if b.RetryInterval != 0 {
-		result.RetryInterval = b.RetryInterval
-	}
-	if b.DeprecatedRetryJoinEC2.AccessKeyID != "" {
-		result.DeprecatedRetryJoinEC2.AccessKeyID = b.DeprecatedRetryJoinEC2.AccessKeyID
-	}
-	if b.DeprecatedRetryJoinEC2.SecretAccessKey != "" {
-		result.DeprecatedRetryJoinEC2.SecretAccessKey = b.DeprecatedRetryJoinEC2.SecretAccessKey
-	}
-	if b.DeprecatedRetryJoinEC2.Region != "" {
-		result.DeprecatedRetryJoinEC2.Region = b.DeprecatedRetryJoinEC2.Region
-	}
-	if b.DeprecatedRetryJoinEC2.TagKey != "" {
-		result.DeprecatedRetryJoinEC2.TagKey = b.DeprecatedRetryJoinEC2.TagKey
-	}
-	if b.DeprecatedRetryJoinEC2.TagValue != "" {
-		result.DeprecatedRetryJoinEC2.TagValue = b.DeprecatedRetryJoinEC2.TagValue
-	}
-	if b.DeprecatedRetryJoinGCE.ProjectName != "" {
-		result.DeprecatedRetryJoinGCE.ProjectName = b.DeprecatedRetryJoinGCE.ProjectName
-	}
-	if b.DeprecatedRetryJoinGCE.ZonePattern != "" {
-		result.DeprecatedRetryJoinGCE.ZonePattern = b.DeprecatedRetryJoinGCE.ZonePattern
-	}
-	if b.DeprecatedRetryJoinGCE.TagValue != "" {
-		result.DeprecatedRetryJoinGCE.TagValue = b.DeprecatedRetryJoinGCE.TagValue
-	}
-	if b.DeprecatedRetryJoinGCE.CredentialsFile != "" {
-		result.DeprecatedRetryJoinGCE.CredentialsFile = b.DeprecatedRetryJoinGCE.CredentialsFile
-	}
-	if b.DeprecatedRetryJoinAzure.TagName != "" {
-		result.DeprecatedRetryJoinAzure.TagName = b.DeprecatedRetryJoinAzure.TagName
-	}
-	if b.DeprecatedRetryJoinAzure.TagValue != "" {
-		result.DeprecatedRetryJoinAzure.TagValue = b.DeprecatedRetryJoinAzure.TagValue
-	}
-	if b.DeprecatedRetryJoinAzure.SubscriptionID != "" {
-		result.DeprecatedRetryJoinAzure.SubscriptionID = b.DeprecatedRetryJoinAzure.SubscriptionID
-	}
-	if b.DeprecatedRetryJoinAzure.TenantID != "" {
-		result.DeprecatedRetryJoinAzure.TenantID = b.DeprecatedRetryJoinAzure.TenantID
-	}
-	if b.DeprecatedRetryJoinAzure.ClientID != "" {
-		result.DeprecatedRetryJoinAzure.ClientID = b.DeprecatedRetryJoinAzure.ClientID
-	}
-	if b.DeprecatedRetryJoinAzure.SecretAccessKey != "" {
-		result.DeprecatedRetryJoinAzure.SecretAccessKey = b.DeprecatedRetryJoinAzure.SecretAccessKey
-	}
-	if b.RetryMaxAttemptsWan != 0 {
-		result.RetryMaxAttemptsWan = b.RetryMaxAttemptsWan
-	}
-	if b.RetryIntervalWan != 0 {
-		result.RetryIntervalWan = b.RetryIntervalWan
-	}
-	if b.ReconnectTimeoutLan != 0 {
-		result.ReconnectTimeoutLan = b.ReconnectTimeoutLan
-		result.ReconnectTimeoutLanRaw = b.ReconnectTimeoutLanRaw
-	}
-	if b.ReconnectTimeoutWan != 0 {
-		result.ReconnectTimeoutWan = b.ReconnectTimeoutWan
-		result.ReconnectTimeoutWanRaw = b.ReconnectTimeoutWanRaw
-	}
-	if b.DNSConfig.NodeTTL != 0 {
-		result.DNSConfig.NodeTTL = b.DNSConfig.NodeTTL
-	}
-	if len(b.DNSConfig.ServiceTTL) != 0 {
-		if result.DNSConfig.ServiceTTL == nil {
-			result.DNSConfig.ServiceTTL = make(map[string]time.Duration)
-		}
-		for service, dur := range b.DNSConfig.ServiceTTL {
-			result.DNSConfig.ServiceTTL[service] = dur
-		}
-	}
-	if b.DNSConfig.AllowStale != nil {
-		result.DNSConfig.AllowStale = b.DNSConfig.AllowStale
-	}
-	if b.DNSConfig.UDPAnswerLimit != 0 {
-		result.DNSConfig.UDPAnswerLimit = b.DNSConfig.UDPAnswerLimit
-	}
-	if b.DNSConfig.EnableTruncate {
-		result.DNSConfig.EnableTruncate = true
-	}
-	if b.DNSConfig.MaxStale != 0 {
-		result.DNSConfig.MaxStale = b.DNSConfig.MaxStale
-	}
-	if b.DNSConfig.OnlyPassing {
-		result.DNSConfig.OnlyPassing = true
-	}
-	if b.DNSConfig.DisableCompression {
-		result.DNSConfig.DisableCompression = true
-	}
-	if b.DNSConfig.RecursorTimeout != 0 {
-		result.DNSConfig.RecursorTimeout = b.DNSConfig.RecursorTimeout
-	}
-	if b.EnableScriptChecks {
-		result.EnableScriptChecks = true
-	}
-	if b.CheckUpdateIntervalRaw != "" || b.CheckUpdateInterval != 0 {
-		result.CheckUpdateInterval = b.CheckUpdateInterval
-	}
-	if b.SyslogFacility != "" {
-		result.SyslogFacility = b.SyslogFacility
-	}
-	if b.ACLToken != "" {
-		result.ACLToken = b.ACLToken
-	}
-	if b.ACLAgentMasterToken != "" {
-		result.ACLAgentMasterToken = b.ACLAgentMasterToken
-	}
-	if b.ACLAgentToken != "" {
-		result.ACLAgentToken = b.ACLAgentToken
-	}
-	if b.ACLMasterToken != "" {
-		result.ACLMasterToken = b.ACLMasterToken
-	}
-	if b.ACLDatacenter != "" {
-		result.ACLDatacenter = b.ACLDatacenter
-	}
-	if b.ACLTTLRaw != "" {
-		result.ACLTTL = b.ACLTTL
-		result.ACLTTLRaw = b.ACLTTLRaw
-	}
-	if b.ACLDownPolicy != "" {
-		result.ACLDownPolicy = b.ACLDownPolicy
-	}
-	if b.ACLDefaultPolicy != "" {
-		result.ACLDefaultPolicy = b.ACLDefaultPolicy
-	}
-	if b.EnableACLReplication {
-		result.EnableACLReplication = true
-	}
-	if b.ACLReplicationToken != "" {
-		result.ACLReplicationToken = b.ACLReplicationToken
-	}
-	if b.ACLEnforceVersion8 != nil {
-		result.ACLEnforceVersion8 = b.ACLEnforceVersion8
-	}
-	if len(b.Watches) != 0 {
-		result.Watches = append(result.Watches, b.Watches...)
-	}
-	if len(b.WatchPlans) != 0 {
-		result.WatchPlans = append(result.WatchPlans, b.WatchPlans...)
-	}
-	if b.DisableRemoteExec != nil {
-		result.DisableRemoteExec = b.DisableRemoteExec
-	}
-	if b.DisableUpdateCheck {
-		result.DisableUpdateCheck = true
-	}
-	if b.DisableAnonymousSignature {
-		result.DisableAnonymousSignature = true
-	}
-	if b.UnixSockets.Usr != "" {
-		result.UnixSockets.Usr = b.UnixSockets.Usr
-	}
-	if b.UnixSockets.Grp != "" {
-		result.UnixSockets.Grp = b.UnixSockets.Grp
-	}
-	if b.UnixSockets.Perms != "" {
-		result.UnixSockets.Perms = b.UnixSockets.Perms
-	}
-	if b.DisableCoordinates {
-		result.DisableCoordinates = true
-	}
-	if b.SessionTTLMinRaw != "" {
-		result.SessionTTLMin = b.SessionTTLMin
-		result.SessionTTLMinRaw = b.SessionTTLMinRaw
-	}
+func newConfigFile(path string, err error) *configFile {
+	return &configFile{path: path, err: err, done: make(chan struct{})}
+}
 
-	result.HTTPConfig.BlockEndpoints = append(a.HTTPConfig.BlockEndpoints,
-		b.HTTPConfig.BlockEndpoints...)
-	if len(b.HTTPConfig.ResponseHeaders) > 0 {
-		if result.HTTPConfig.ResponseHeaders == nil {
-			result.HTTPConfig.ResponseHeaders = make(map[string]string)
-		}
-		for field, value := range b.HTTPConfig.ResponseHeaders {
-			result.HTTPConfig.ResponseHeaders[field] = value
+// readConfigPaths decodes the given configuration files and the JSON files
+// in the given directories using up to workers goroutines. The decoded
+// files are merged in the order of paths and, within a directory, in
+// lexical order regardless of the order in which they were decoded.
+//
+// Files are streamed from disk and each decoded file is released as soon
+// as it has been merged. At most 2*workers files are decoded ahead of the
+// merge so that large configuration trees are never held in memory at
+// once.
+//
+// Files exceeding the given limits are rejected before they are decoded.
+// All files are decoded even if one of them fails so that the errors of
+// all files are returned together, in merge order. If cache is not nil, files whose contents are unchanged since they were
+// last read through the cache are not decoded again. If prov is not nil,
+// the path of the file which set each key is recorded in it.
+func readConfigPaths(paths []string, workers int, limits ConfigLimits, cache *ConfigCache, prov Provenance) (*Config, error) {
+	files := configFiles(paths)
+	limits.checkSizes(files)
+	decode := func(path string) (*Config, error) {
+		return decodeConfigFile(path, limits)
+	}
+	if cache != nil {
+		cache.retain(files)
+		decode = func(path string) (*Config, error) {
+			return cache.decode(path, limits)
+		}
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+	window := make(chan struct{}, 2*workers)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	ch := make(chan *configFile)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for cf := range ch {
+				if cf.err == nil {
+					cf.config, cf.err = decode(cf.path)
+				}
+				close(cf.done)
+			}
+		}()
+	}
+	go func() {
+		defer close(ch)
+		for _, cf := range files {
+			select {
+			case window <- struct{}{}:
+			case <-stopCh:
+				return
+			}
+			ch <- cf
 		}
-	}
+	}()
 
-	if len(b.Meta) != 0 {
-		if result.Meta == nil {
-			result.Meta = make(map[string]string)
-		}
-		for field, value := range b.Meta {
-			result.Meta[field] = value
+	result := new(Config)
+	var errs []error
+	for _, cf := range files {
+		<-cf.done
+		switch {
+		case cf.err != nil:
+			errs = append(errs, cf.err)
+		case len(errs) == 0:
+			result = MergeConfigSource(result, cf.config, cf.path, prov)
 		}
+		cf.config = nil
+		<-window
 	}
-
-	// Copy the start join addresses
-	result.StartJoin = make([]string, 0, len(a.StartJoin)+len(b.StartJoin))
-	result.StartJoin = append(result.StartJoin, a.StartJoin...)
-	result.StartJoin = append(result.StartJoin, b.StartJoin...)
-
-	// Copy the start join addresses
-	result.StartJoinWan = make([]string, 0, len(a.StartJoinWan)+len(b.StartJoinWan))
-	result.StartJoinWan = append(result.StartJoinWan, a.StartJoinWan...)
-	result.StartJoinWan = append(result.StartJoinWan, b.StartJoinWan...)
-
-	// Copy the retry join addresses
-	result.RetryJoin = make([]string, 0, len(a.RetryJoin)+len(b.RetryJoin))
-	result.RetryJoin = append(result.RetryJoin, a.RetryJoin...)
-	result.RetryJoin = append(result.RetryJoin, b.RetryJoin...)
-
-	// Copy the retry join -wan addresses
-	result.RetryJoinWan = make([]string, 0, len(a.RetryJoinWan)+len(b.RetryJoinWan))
-	result.RetryJoinWan = append(result.RetryJoinWan, a.RetryJoinWan...)
-	result.RetryJoinWan = append(result.RetryJoinWan, b.RetryJoinWan...)
-
-	return &result
+	if len(errs) > 0 {
+		return nil, configErrors(errs)
+	}
+	return result, nil
 }
 
-// ReadConfigPaths reads the paths in the given order to load configurations.
-// The paths can be to files or directories. If the path is a directory,
-// we read one directory deep and read any files ending in ".json" as
-// configuration files.
-func ReadConfigPaths(paths []string) (*Config, error) {
-	result := new(Config)
-	for _, path := range paths {
+// configFiles returns the files to read for the given configuration files,
+// directories and glob patterns in merge order.
+func configFiles(paths []string) []*configFile {
+	var files []*configFile
+	for _, path := range ExpandConfigGlobs(paths) {
 		f, err := os.Open(path)
 		if err != nil {
-			return nil, fmt.Errorf("Error reading '%s': %s", path, err)
+			if isConfigGlob(path) {
+				if _, err = filepath.Glob(path); err == nil {
+					err = fmt.Errorf("no configuration files or directories match the pattern")
+				}
+			}
+			files = append(files, newConfigFile(path, fmt.Errorf("Error reading '%s': %s", path, err)))
+			continue
 		}
 
 		fi, err := f.Stat()
 		if err != nil {
 			f.Close()
-			return nil, fmt.Errorf("Error reading '%s': %s", path, err)
+			files = append(files, newConfigFile(path, fmt.Errorf("Error reading '%s': %s", path, err)))
+			continue
 		}
 
 		if !fi.IsDir() {
-			config, err := DecodeConfig(f)
 			f.Close()
-
-			if err != nil {
-				return nil, fmt.Errorf("Error decoding '%s': %s", path, err)
-			}
-
-			result = MergeConfig(result, config)
+			cf := newConfigFile(path, nil)
+			cf.size = fi.Size()
+			files = append(files, cf)
 			continue
 		}
 
 		contents, err := f.Readdir(-1)
 		f.Close()
 		if err != nil {
-			return nil, fmt.Errorf("Error reading '%s': %s", path, err)
+			files = append(files, newConfigFile(path, fmt.Errorf("Error reading '%s': %s", path, err)))
+			continue
 		}
 
 		// Sort the contents, ensures lexical order
 		sort.Sort(dirEnts(contents))
 
 		for _, fi := range contents {
+			// Follow symlinks, as used by mounted Kubernetes volumes,
+			// so that the size and type of the target are checked.
+			if fi.Mode()&os.ModeSymlink != 0 {
+				if target, err := os.Stat(filepath.Join(path, fi.Name())); err == nil {
+					fi = target
+				}
+			}
+
 			// Don't recursively read contents
 			if fi.IsDir() {
 				continue
 			}
 
-			// If it isn't a JSON file, ignore it
-			if !strings.HasSuffix(fi.Name(), ".json") {
+			// If it isn't a JSON, YAML or HCL file, ignore it
+			if !isConfigFileName(fi.Name()) {
 				continue
 			}
 			// If the config file is empty, ignore it
@@ -2145,24 +2308,41 @@ func ReadConfigPaths(paths []string) (*Config, error) {
 				continue
 			}
 
-			subpath := filepath.Join(path, fi.Name())
-			f, err := os.Open(subpath)
-			if err != nil {
-				return nil, fmt.Errorf("Error reading '%s': %s", subpath, err)
-			}
-
-			config, err := DecodeConfig(f)
-			f.Close()
-
-			if err != nil {
-				return nil, fmt.Errorf("Error decoding '%s': %s", subpath, err)
-			}
-
-			result = MergeConfig(result, config)
+			cf := newConfigFile(filepath.Join(path, fi.Name()), nil)
+			cf.size = fi.Size()
+			files = append(files, cf)
 		}
 	}
+	return files
+}
 
-	return result, nil
+// decodeConfigFile decodes a single configuration file within the given
+// limits.
+func decodeConfigFile(path string, limits ConfigLimits) (*Config, error) {
+	data, err := readConfigFileData(path, limits)
+	if err != nil {
+		return nil, err
+	}
+	return decodeConfigData(path, data, limits, nil, false, true)
+}
+
+// decodeConfigData decodes the contents of the configuration file at path
+// and interpolates the given variables. If strict is set, unknown keys of
+// service and check definitions are rejected. If funcs is set, function
+// calls are evaluated, which is only safe for local documents since they
+// can read local files.
+func decodeConfigData(path string, data []byte, limits ConfigLimits, vars map[string]string, strict, funcs bool) (*Config, error) {
+	if err := checkJSONDepth(data, limits.MaxDepth); err != nil {
+		return nil, fmt.Errorf("Error decoding '%s': %s", path, err)
+	}
+	config, err := decodeConfig(bytes.NewReader(data), vars, strict, funcs)
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding '%s': %s", path, jsonErrorPosition(data, err))
+	}
+	for i, d := range config.Deprecations {
+		config.Deprecations[i] = fmt.Sprintf("%s: %s", path, d)
+	}
+	return config, nil
 }
 
 // ResolveTmplAddrs iterates over the myriad of addresses in the agent's config
@@ -2195,13 +2375,38 @@ func (c *Config) ResolveTmplAddrs() (err error) {
 	if c == nil {
 		return
 	}
-	parse(&c.Addresses.DNS, true, "DNS address")
-	parse(&c.Addresses.HTTP, true, "HTTP address")
-	parse(&c.Addresses.HTTPS, true, "HTTPS address")
+	// The client addresses can be lists, which templates can expand to.
+	parseList := func(addr *string, name string) {
+		if *addr == "" || err != nil {
+			return
+		}
+		var out string
+		out, err = template.Parse(*addr)
+		if err != nil {
+			err = fmt.Errorf("Resolution of %s failed: Unable to parse address template %q: %v", name, *addr, err)
+			return
+		}
+		list := splitAddrs(out)
+		if len(list) == 0 {
+			err = fmt.Errorf("Resolution of %s failed: No addresses found, please configure one.", name)
+			return
+		}
+		for _, ip := range list {
+			if socketPath(ip) == "" && net.ParseIP(ip) == nil {
+				err = fmt.Errorf("Failed to parse %s, %q is not a valid IP address or socket", name, ip)
+				return
+			}
+		}
+		*addr = strings.Join(list, " ")
+	}
+
+	parseList(&c.Addresses.DNS, "DNS address")
+	parseList(&c.Addresses.HTTP, "HTTP address")
+	parseList(&c.Addresses.HTTPS, "HTTPS address")
 	parse(&c.AdvertiseAddr, false, "Advertise address")
 	parse(&c.AdvertiseAddrWan, false, "Advertise WAN address")
 	parse(&c.BindAddr, true, "Bind address")
-	parse(&c.ClientAddr, true, "Client address")
+	parseList(&c.ClientAddr, "Client address")
 	parse(&c.SerfLanBindAddr, false, "Serf LAN address")
 	parse(&c.SerfWanBindAddr, false, "Serf WAN address")
 
@@ -2233,11 +2438,15 @@ func (cfg *Config) SetupTaggedAndAdvertiseAddrs() error {
 		cfg.AdvertiseAddrWan = cfg.AdvertiseAddr
 	}
 
-	// Create the default set of tagged addresses.
-	cfg.TaggedAddresses = map[string]string{
+	// Add the default tagged addresses to the configured ones.
+	tagged := map[string]string{
 		"lan": cfg.AdvertiseAddr,
 		"wan": cfg.AdvertiseAddrWan,
 	}
+	for k, v := range cfg.TaggedAddresses {
+		tagged[k] = v
+	}
+	cfg.TaggedAddresses = tagged
 	return nil
 }
 
@@ -0,0 +1,303 @@
+package agent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/consul/watch"
+)
+
+// ConfigSource is a configuration merged by a ConfigBuilder after the
+// configuration files.
+type ConfigSource struct {
+	// Name names the source in the Provenance of the configuration, like
+	// "command line flags". It defaults to "source <n>" for the n-th
+	// source.
+	Name string
+
+	// Config is the configuration of the source.
+	Config *Config
+
+	// Data, if Config is not set, is the configuration document of the
+	// source in Format, which is "json", "yaml" or "hcl". If Format is
+	// empty, documents which start with '{' are JSON and all others HCL.
+	// The document is decoded with the limits and variables of the
+	// builder, see DecodeConfigSource.
+	Format string
+	Data   string
+
+	// Load, if set, returns the configuration of a source which depends
+	// on the configuration built from the preceding sources, like the
+	// configuration overlay. It returns nil to merge nothing. Loaded
+	// sources do not select override files.
+	Load func(cur *Config) (*Config, error)
+}
+
+// ConfigBuilder builds the configuration an agent runs with. It merges
+// the defaults, the configuration files with their override files and the
+// further sources in order, fills in the settings derived from other
+// settings and validates the result. The agent and validate commands
+// share it so that they build the same configuration from the same inputs.
+type ConfigBuilder struct {
+	// Default is the configuration everything is merged over. It
+	// defaults to DefaultConfig().
+	Default *Config
+
+	// Paths are the configuration files and directories. They are read in
+	// order, followed by the override files which apply to the agent.
+	Paths []string
+
+	// Sources are merged over the configuration files in order.
+	Sources []ConfigSource
+
+	// Limits bounds the configuration files, see DefaultConfigLimits.
+	Limits ConfigLimits
+
+	// Vars are interpolated into the configuration files.
+	Vars map[string]string
+
+	// Cache, if set, reads the configuration files so that unchanged
+	// files are not decoded again.
+	Cache *ConfigCache
+
+	// Strict fails the build if there are warnings.
+	Strict bool
+
+	// StrictKeys fails the build if a service or check definition of the
+	// configuration files has unknown keys. The unknown keys of the rest
+	// of the configuration are always rejected.
+	StrictKeys bool
+
+	// DisableFunctions leaves the function calls like ${env "NAME"} and
+	// ${file "path"} in the values of the configuration files and the
+	// other sources unevaluated.
+	DisableFunctions bool
+
+	// Remote, if set, returns true for the configuration files which were
+	// fetched from a remote URL, see RemoteConfig. Their function calls
+	// are not evaluated since they could read local files.
+	Remote func(path string) bool
+
+	// ExtraValidators are called in order with the configuration after it
+	// passed Validate. The first error fails the build.
+	ExtraValidators []func(*Config) error
+
+	files      []string
+	provenance Provenance
+}
+
+// Files returns the configuration files and directories read by the last
+// call to Build, including the override files.
+func (b *ConfigBuilder) Files() []string {
+	return b.files
+}
+
+// LoadOrder returns the configuration files read by the last call to
+// Build in the order in which they were merged, with the files of the
+// directories and the paths matching the glob patterns among Files in
+// place of them.
+func (b *ConfigBuilder) LoadOrder() []string {
+	var order []string
+	for _, cf := range configFiles(b.files) {
+		if cf.err == nil {
+			order = append(order, cf.path)
+		}
+	}
+	return order
+}
+
+// Provenance returns the sources which supplied the keys of the
+// configuration built by the last call to Build. The configuration files
+// are named by their paths and the other sources by their names.
+func (b *ConfigBuilder) Provenance() Provenance {
+	return b.provenance
+}
+
+// Build builds and validates the configuration. It returns the warnings
+// about settings which are valid but likely not what was intended. Errors
+// about conflicting settings are returned as a *ConfigError naming the
+// keys involved. If there are several errors in the configuration files or
+// the merged configuration, all of them are returned as a
+// *multierror.Error.
+func (b *ConfigBuilder) Build() (*Config, []string, error) {
+	cfg := b.Default
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+
+	// The documents of the sources are decoded first since they select
+	// override files like the configurations of the other sources.
+	names := make([]string, len(b.Sources))
+	configs := make([]*Config, len(b.Sources))
+	for i, src := range b.Sources {
+		names[i] = src.Name
+		if names[i] == "" {
+			names[i] = fmt.Sprintf("source %d", i+1)
+		}
+		configs[i] = src.Config
+		if src.Load == nil && src.Config == nil && src.Data != "" {
+			c, err := decodeConfigSource(names[i], src.Format, src.Data, b.Limits, b.Vars, !b.DisableFunctions)
+			if err != nil {
+				return nil, nil, err
+			}
+			configs[i] = c
+		}
+	}
+
+	b.files = b.Paths
+	b.provenance = make(Provenance)
+	if len(b.Paths) > 0 {
+		cache := b.Cache
+		if cache == nil {
+			cache = NewConfigCache()
+		}
+		cache.Limits = b.Limits
+		cache.Vars = b.Vars
+		cache.StrictKeys = b.StrictKeys
+		cache.DisableFunctions = b.DisableFunctions
+		cache.Remote = b.Remote
+		prov := make(Provenance)
+		fileConfig, err := cache.readConfigPaths(b.Paths, prov)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// The override files of the configuration directories for the
+		// datacenter and node name set by all sources are merged
+		// right after the main configuration.
+		selectors := append([]*Config{cfg, fileConfig}, configs...)
+		dc, node := ConfigOverrideSelectors(selectors...)
+		if overrides := ConfigOverrideFiles(b.Paths, dc, node); len(overrides) > 0 {
+			b.files = append(append([]string{}, b.Paths...), overrides...)
+			prov = make(Provenance)
+			if fileConfig, err = cache.readConfigPaths(b.files, prov); err != nil {
+				return nil, nil, err
+			}
+		}
+		cfg = MergeConfig(cfg, fileConfig)
+		b.provenance = prov
+	}
+
+	for i, src := range b.Sources {
+		c := configs[i]
+		if src.Load != nil {
+			var err error
+			if c, err = src.Load(cfg); err != nil {
+				return nil, nil, err
+			}
+		}
+		if c != nil {
+			cfg = MergeConfigSource(cfg, c, names[i], b.provenance)
+		}
+	}
+	return b.finish(cfg)
+}
+
+// finish fills in the settings of cfg which are derived from other
+// settings and validates it.
+func (b *ConfigBuilder) finish(cfg *Config) (*Config, []string, error) {
+	if err := cfg.ResolveSecretRefs(); err != nil {
+		return nil, nil, err
+	}
+
+	if cfg.NodeName == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, nil, fmt.Errorf("Error determining node name: %s", err)
+		}
+		cfg.NodeName = hostname
+	}
+	cfg.NodeName = strings.TrimSpace(cfg.NodeName)
+	if cfg.NodeName == "" {
+		return nil, nil, fmt.Errorf("Node name can not be empty")
+	}
+
+	// The node metadata file is merged beneath the inline node_meta.
+	if cfg.NodeMetaFile != "" {
+		meta, err := ReadNodeMetaFile(cfg.NodeMetaFile, b.Limits)
+		if err != nil {
+			return nil, nil, err
+		}
+		for k, v := range cfg.Meta {
+			meta[k] = v
+		}
+		cfg.Meta = meta
+	}
+
+	if cfg.LicensePath != "" {
+		b, err := ioutil.ReadFile(cfg.LicensePath)
+		if err != nil {
+			return nil, nil, configErrorf([]string{"license_path"}, "Error reading license_path: %s", err)
+		}
+		cfg.License = strings.TrimSpace(string(b))
+	}
+
+	// Make sure LeaveOnTerm and SkipLeaveOnInt are set to the right
+	// defaults based on the agent's mode (client or server).
+	if cfg.LeaveOnTerm == nil {
+		cfg.LeaveOnTerm = Bool(!cfg.Server)
+	}
+	if cfg.SkipLeaveOnInt == nil {
+		cfg.SkipLeaveOnInt = Bool(cfg.Server)
+	}
+
+	// Ensure the datacenters are always lowercased. The DNS endpoints automatically
+	// lowercase all queries, and internally we expect DC1 and dc1 to be the same.
+	cfg.Datacenter = strings.ToLower(cfg.Datacenter)
+	cfg.ACLDatacenter = strings.ToLower(cfg.ACLDatacenter)
+
+	warnings, errs := cfg.Validate()
+	errs = append(errs, cfg.verifyTLSFiles()...)
+	keyringWarnings, err := cfg.verifyKeyrings()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	warnings = append(warnings, keyringWarnings...)
+	if len(errs) > 0 {
+		return nil, warnings, configErrors(errs)
+	}
+	for _, v := range b.ExtraValidators {
+		if err := v(cfg); err != nil {
+			return nil, warnings, err
+		}
+	}
+
+	if cfg.NodeID != "" {
+		cfg.NodeID, _ = ValidateNodeID(cfg.NodeID)
+	}
+
+	// Verifying the server hostname implies verifying outgoing connections.
+	if cfg.VerifyServerHostname {
+		cfg.VerifyOutgoing = true
+	}
+
+	warnings = append(warnings, cfg.Deprecations...)
+
+	// Compile all the watches
+	for _, params := range cfg.Watches {
+		// Parse the watches, excluding the handler
+		wp, err := watch.ParseExempt(params, watchExempt)
+		if err != nil {
+			return nil, warnings, fmt.Errorf("Failed to parse watch (%#v): %v", params, err)
+		}
+
+		// Check the handler
+		if err := parseWatchHandler(wp); err != nil {
+			return nil, warnings, err
+		}
+
+		// Store the watch plan
+		cfg.WatchPlans = append(cfg.WatchPlans, wp)
+	}
+
+	if err := cfg.ResolveTmplAddrs(); err != nil {
+		return nil, warnings, fmt.Errorf("Failed to parse config: %v", err)
+	}
+
+	if b.Strict && len(warnings) > 0 {
+		return nil, warnings, fmt.Errorf("Configuration has warnings: %s", strings.Join(warnings, "; "))
+	}
+	return cfg, warnings, nil
+}
@@ -0,0 +1,379 @@
+package agent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/consul/testutil"
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/pascaldekloe/goe/verify"
+)
+
+func TestConfigBuilder_Build(t *testing.T) {
+	t.Parallel()
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, ConfigOverridesDir), 0700); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	write := func(name, content string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	write("a.json", `{"datacenter": "DC2", "node_name": "node1", "log_level": "${level}"}`)
+	write("overrides/dc-dc2.json", `{"ports": {"http": 8501}}`)
+	write("overrides/host-node1.json", `{"ports": {"http": 8502}}`)
+
+	b := &ConfigBuilder{
+		Paths: []string{dir},
+		Sources: []ConfigSource{
+			{Config: &Config{Ports: PortConfig{DNS: 8601}}},
+			{Load: func(cur *Config) (*Config, error) {
+				return &Config{NodeName: cur.NodeName + "-loaded"}, nil
+			}},
+			{Config: &Config{Server: true}},
+		},
+		Limits: DefaultConfigLimits(),
+		Vars:   map[string]string{"level": "DEBUG"},
+	}
+	cfg, warnings, err := b.Build()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(warnings) != 0 {
+		t.Fatalf("got warnings %v", warnings)
+	}
+
+	verify.Values(t, "files", b.Files(), []string{
+		dir,
+		filepath.Join(dir, ConfigOverridesDir, "dc-dc2.json"),
+		filepath.Join(dir, ConfigOverridesDir, "host-node1.json"),
+	})
+	verify.Values(t, "datacenter", cfg.Datacenter, "dc2")
+	verify.Values(t, "node_name", cfg.NodeName, "node1-loaded")
+	verify.Values(t, "log_level", cfg.LogLevel, "DEBUG")
+	verify.Values(t, "ports.http", cfg.Ports.HTTP, 8502)
+	verify.Values(t, "ports.dns", cfg.Ports.DNS, 8601)
+	verify.Values(t, "leave_on_terminate", *cfg.LeaveOnTerm, false)
+	verify.Values(t, "skip_leave_on_interrupt", *cfg.SkipLeaveOnInt, true)
+
+	// Documents of the sources, like CONSUL_LOCAL_CONFIG and the -hcl
+	// snippets, select the override files as well.
+	write("overrides/dc-dc3.json", `{"ports": {"http": 8503}}`)
+	write("overrides/host-node2.hcl", `ports { dns = 8602 }`)
+	b.Sources = []ConfigSource{
+		{Name: "local", Data: `{"datacenter": "dc3"}`},
+		{Name: "-hcl", Format: ConfigFormatHCL, Data: `node_name = "node2"`},
+	}
+	if cfg, _, err = b.Build(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	verify.Values(t, "files", b.Files(), []string{
+		dir,
+		filepath.Join(dir, ConfigOverridesDir, "dc-dc3.json"),
+		filepath.Join(dir, ConfigOverridesDir, "host-node2.hcl"),
+	})
+	verify.Values(t, "ports.http", cfg.Ports.HTTP, 8503)
+	verify.Values(t, "ports.dns", cfg.Ports.DNS, 8602)
+}
+
+func TestConfigBuilder_Options(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		desc     string
+		b        *ConfigBuilder
+		warnings []string
+		err      string
+	}{
+		{
+			desc: "validation error",
+			b:    &ConfigBuilder{Sources: []ConfigSource{{Config: &Config{Bootstrap: true}}}},
+			err:  "Bootstrap mode cannot be enabled when server mode is not enabled",
+		},
+		{
+			desc:     "warnings",
+			b:        &ConfigBuilder{Sources: []ConfigSource{{Config: &Config{StartInMaintenanceReason: "x"}}}},
+			warnings: []string{"start_in_maintenance_reason has no effect without start_in_maintenance"},
+		},
+		{
+			desc: "strict",
+			b: &ConfigBuilder{
+				Sources: []ConfigSource{{Config: &Config{StartInMaintenanceReason: "x"}}},
+				Strict:  true,
+			},
+			warnings: []string{"start_in_maintenance_reason has no effect without start_in_maintenance"},
+			err:      "Configuration has warnings: start_in_maintenance_reason has no effect",
+		},
+		{
+			desc: "extra validators",
+			b: &ConfigBuilder{ExtraValidators: []func(*Config) error{
+				func(*Config) error { return nil },
+				func(c *Config) error { return fmt.Errorf("datacenter %s is not allowed", c.Datacenter) },
+			}},
+			err: "datacenter dc1 is not allowed",
+		},
+		{
+			desc: "source error",
+			b: &ConfigBuilder{Sources: []ConfigSource{{Load: func(*Config) (*Config, error) {
+				return nil, fmt.Errorf("unavailable")
+			}}}},
+			err: "unavailable",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			cfg, warnings, err := tt.b.Build()
+			verify.Values(t, "warnings", warnings, tt.warnings)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			if cfg == nil {
+				t.Fatal("no configuration")
+			}
+		})
+	}
+}
+
+func TestConfigBuilder_NodeMetaFile(t *testing.T) {
+	t.Parallel()
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		desc, content string
+		meta          map[string]string
+		err           string
+	}{
+		{
+			desc:    "json",
+			content: `{"rack": "r1", "zone": "file"}`,
+			meta:    map[string]string{"rack": "r1", "zone": "inline"},
+		},
+		{
+			desc:    "hcl",
+			content: "rack = \"r2\"\nzone = \"file\"\n",
+			meta:    map[string]string{"rack": "r2", "zone": "inline"},
+		},
+		{
+			desc:    "not a string",
+			content: `{"rack": 1}`,
+			err:     `value of "rack" must be a string`,
+		},
+	}
+	for i, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			path := filepath.Join(dir, fmt.Sprintf("meta%d", i))
+			if err := ioutil.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			b := &ConfigBuilder{
+				Sources: []ConfigSource{{Config: &Config{
+					NodeName:     "node1",
+					NodeMetaFile: path,
+					Meta:         map[string]string{"zone": "inline"},
+				}}},
+				Limits: DefaultConfigLimits(),
+			}
+			cfg, _, err := b.Build()
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			verify.Values(t, "meta", cfg.Meta, tt.meta)
+		})
+	}
+}
+
+func TestConfigBuilder_License(t *testing.T) {
+	t.Parallel()
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "license")
+	if err := ioutil.WriteFile(path, []byte("02MV4UU43BK5HGYYTOJZ\n"), 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	b := &ConfigBuilder{
+		Sources: []ConfigSource{{Config: &Config{NodeName: "node1", LicensePath: path}}},
+		Limits:  DefaultConfigLimits(),
+	}
+	cfg, _, err := b.Build()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if cfg.License != "02MV4UU43BK5HGYYTOJZ" {
+		t.Fatalf("got license %q", cfg.License)
+	}
+
+	b.Sources[0].Config.LicensePath = filepath.Join(dir, "missing")
+	_, _, err = b.Build()
+	if ce, ok := err.(*ConfigError); !ok || ce.Keys[0] != "license_path" {
+		t.Fatalf("got error %v want a *ConfigError for license_path", err)
+	}
+}
+
+func TestConfigBuilder_Provenance(t *testing.T) {
+	t.Parallel()
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, ConfigOverridesDir), 0700); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		return path
+	}
+	a := write("a.json", `{"datacenter": "dc2", "node_name": "node1", "ports": {"dns": 8601}, "retry_join": ["a"], "check_update_interval": "1m"}`)
+	b := write("b.json", `{"node_name": "node2", "ports": {"http": 8501}, "service": {"name": "web"}, "unix_sockets": {"mode": "0700"}}`)
+	override := write("overrides/dc-dc2.json", `{"ports": {"http": 8502}}`)
+
+	builder := &ConfigBuilder{
+		Paths: []string{dir},
+		Sources: []ConfigSource{
+			{Name: "flags", Config: &Config{LogLevel: "DEBUG", RetryJoin: []string{"b"}}},
+			{Config: &Config{Server: true}},
+		},
+		Limits: DefaultConfigLimits(),
+	}
+	if _, _, err := builder.Build(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	verify.Values(t, "", builder.Provenance(), Provenance{
+		"check_update_interval": a,
+		"datacenter":            a,
+		"log_level":             "flags",
+		"node_name":             b,
+		"ports.dns":             a,
+		"ports.http":            override,
+		"retry_join":            "flags",
+		"server":                "source 2",
+		"services":              b,
+		"unix_sockets.mode":     b,
+	})
+	if got := builder.Provenance().Source("bind_addr"); got != "" {
+		t.Fatalf("got %q want the default", got)
+	}
+}
+
+func TestConfigBuilder_DataSources(t *testing.T) {
+	t.Parallel()
+	b := &ConfigBuilder{
+		Sources: []ConfigSource{
+			{Name: "json", Data: `{"node_name": "${NODE}", "ports": {"dns": 8601}}`},
+			{Name: "hcl", Data: `log_level = "WARN"`},
+			{Name: "yaml", Format: ConfigFormatYAML, Data: "ports:\n  http: 8501\n"},
+			{Name: "empty"},
+		},
+		Limits: DefaultConfigLimits(),
+		Vars:   map[string]string{"NODE": "node1"},
+	}
+	cfg, _, err := b.Build()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	verify.Values(t, "node_name", cfg.NodeName, "node1")
+	verify.Values(t, "log_level", cfg.LogLevel, "WARN")
+	verify.Values(t, "ports.dns", cfg.Ports.DNS, 8601)
+	verify.Values(t, "ports.http", cfg.Ports.HTTP, 8501)
+	verify.Values(t, "source", b.Provenance().Source("ports.http"), "yaml")
+
+	// Errors name the source and the position of syntax errors.
+	b.Sources = []ConfigSource{{Name: "flag", Data: "{\n  \"node_name\": \"a\",\n}"}}
+	_, _, err = b.Build()
+	want := "Error decoding 'flag': line 3, column 1: invalid character '}'"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("got error %v want %q", err, want)
+	}
+	b.Sources = []ConfigSource{{Name: "flag", Format: "toml", Data: "a = 1"}}
+	if _, _, err = b.Build(); err == nil || !strings.Contains(err.Error(), `unknown configuration format "toml"`) {
+		t.Fatalf("got error %v", err)
+	}
+}
+
+func TestConfigBuilder_MultipleErrors(t *testing.T) {
+	t.Parallel()
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+	write := func(name, content string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	// All errors of the merged configuration are returned.
+	write("a.json", `{"bootstrap": true, "serf_lan_allowed_cidrs": ["bogus"]}`)
+	b := &ConfigBuilder{Paths: []string{dir}, Limits: DefaultConfigLimits()}
+	_, _, err := b.Build()
+	merr, ok := err.(*multierror.Error)
+	if !ok || len(merr.Errors) != 2 {
+		t.Fatalf("got error %v want 2 errors", err)
+	}
+	for _, err := range merr.Errors {
+		if _, ok := err.(*ConfigError); !ok {
+			t.Fatalf("got %T want *ConfigError", err)
+		}
+	}
+
+	// A single error is returned as it is.
+	write("a.json", `{"bootstrap": true}`)
+	if _, _, err := b.Build(); err == nil {
+		t.Fatal("should fail")
+	} else if _, ok := err.(*ConfigError); !ok {
+		t.Fatalf("got %T want *ConfigError", err)
+	}
+
+	// The syntax errors of all files are returned.
+	write("a.json", `{`)
+	write("b.json", "{\n  \"node_name\": }")
+	_, _, err = b.Build()
+	if merr, ok := err.(*multierror.Error); !ok || len(merr.Errors) != 2 {
+		t.Fatalf("got error %v want 2 errors", err)
+	} else if got, want := merr.Errors[1].Error(), "b.json': line 2, column 16: "; !strings.Contains(got, want) {
+		t.Fatalf("got error %q want %q", got, want)
+	}
+}
+
+func TestConfigBuilder_Deprecations(t *testing.T) {
+	t.Parallel()
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "a.json")
+	if err := ioutil.WriteFile(path, []byte(`{"statsd_addr": "127.0.0.1:8125"}`), 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	b := &ConfigBuilder{Paths: []string{dir}, Limits: DefaultConfigLimits()}
+	cfg, warnings, err := b.Build()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	verify.Values(t, "statsd_address", cfg.Telemetry.StatsdAddr, "127.0.0.1:8125")
+	verify.Values(t, "warnings", warnings, []string{
+		path + ": statsd_addr is deprecated. Please use telemetry.statsd_address instead",
+	})
+
+	// Deprecations fail strict builds like other warnings.
+	b.Strict = true
+	if _, _, err := b.Build(); err == nil || !strings.Contains(err.Error(), "statsd_addr is deprecated") {
+		t.Fatalf("got error %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// ConfigCache caches decoded configuration files by path and content hash
+// so that files which did not change are not decoded again when the
+// configuration is reloaded. The cached configurations are shared between
+// reads and must not be modified.
+type ConfigCache struct {
+	// Limits bounds the files read through the cache.
+	Limits ConfigLimits
+
+	// Vars are the variables which are interpolated into the files read
+	// through the cache. Changing them invalidates the cache.
+	Vars map[string]string
+
+	// StrictKeys rejects unknown keys of service and check definitions,
+	// see ConfigBuilder.
+	StrictKeys bool
+
+	// DisableFunctions leaves the function calls of the files unevaluated,
+	// see ConfigBuilder.
+	DisableFunctions bool
+
+	// Remote, if set, returns true for the files fetched from a remote
+	// URL, see ConfigBuilder.
+	Remote func(path string) bool
+
+	l        sync.Mutex
+	files    map[string]cachedConfigFile
+	varsHash [sha256.Size]byte
+}
+
+// cachedConfigFile is a decoded configuration file and the hash of the
+// contents it was decoded from. strict is set if the file was checked for
+// unknown keys. config is nil for files which are decoded on every read.
+type cachedConfigFile struct {
+	hash   [sha256.Size]byte
+	strict bool
+	config *Config
+}
+
+// NewConfigCache returns an empty cache using the default limits.
+func NewConfigCache() *ConfigCache {
+	return &ConfigCache{
+		Limits: DefaultConfigLimits(),
+		files:  make(map[string]cachedConfigFile),
+	}
+}
+
+// ReadConfigPaths works like ReadConfigPaths but only decodes the files
+// which were added or changed since the last call.
+func (c *ConfigCache) ReadConfigPaths(paths []string) (*Config, error) {
+	return c.readConfigPaths(paths, nil)
+}
+
+// readConfigPaths works like ReadConfigPaths and records the file which
+// set each key in prov if it is not nil.
+func (c *ConfigCache) readConfigPaths(paths []string, prov Provenance) (*Config, error) {
+	if h := hashVars(c.Vars); h != c.varsHash {
+		c.l.Lock()
+		c.files = make(map[string]cachedConfigFile)
+		c.varsHash = h
+		c.l.Unlock()
+	}
+	return readConfigPaths(paths, runtime.GOMAXPROCS(0), c.Limits, c, prov)
+}
+
+// Len returns the number of cached configuration files.
+func (c *ConfigCache) Len() int {
+	c.l.Lock()
+	defer c.l.Unlock()
+	n := 0
+	for _, cached := range c.files {
+		if cached.config != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// decode returns the decoded configuration file at path from the cache if
+// its contents are unchanged and decodes it otherwise.
+func (c *ConfigCache) decode(path string, limits ConfigLimits) (*Config, error) {
+	data, err := readConfigFileData(path, limits)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(data)
+
+	c.l.Lock()
+	cached, ok := c.files[path]
+	c.l.Unlock()
+	if ok && cached.config != nil && cached.hash == hash && (cached.strict || !c.StrictKeys) {
+		return cached.config, nil
+	}
+
+	// Remote files could read local files with function calls.
+	funcs := !c.DisableFunctions && (c.Remote == nil || !c.Remote(path))
+	config, err := decodeConfigData(path, data, limits, c.Vars, c.StrictKeys, funcs)
+	if err != nil {
+		return nil, err
+	}
+
+	// The results of function calls, like the contents of other files,
+	// can change without the file changing, so only the hash is recorded
+	// for Hashes.
+	cached = cachedConfigFile{hash: hash, strict: c.StrictKeys, config: config}
+	if funcs && hasConfigFuncs(data) {
+		cached.config = nil
+	}
+
+	c.l.Lock()
+	c.files[path] = cached
+	c.l.Unlock()
+	return config, nil
+}
+
+// hashVars returns a hash of the variables which does not depend on their
+// order.
+func hashVars(vars map[string]string) [sha256.Size]byte {
+	if len(vars) == 0 {
+		return [sha256.Size]byte{}
+	}
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(h, "%q=%q\n", name, vars[name])
+	}
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+// retain removes the cached files which are no longer read.
+func (c *ConfigCache) retain(files []*configFile) {
+	keep := make(map[string]bool, len(files))
+	for _, cf := range files {
+		keep[cf.path] = true
+	}
+
+	c.l.Lock()
+	defer c.l.Unlock()
+	for path := range c.files {
+		if !keep[path] {
+			delete(c.files, path)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package agent
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/consul/testutil"
+)
+
+func TestConfigCache_ReadConfigPaths(t *testing.T) {
+	t.Parallel()
+	td := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(td)
+
+	write := func(name, content string) string {
+		path := filepath.Join(td, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		return path
+	}
+	a := write("a.json", `{"datacenter": "dc1"}`)
+	b := write("b.json", `{"node_name": "foo"}`)
+	c := write("c.json", `{"log_level": "info"}`)
+
+	cache := NewConfigCache()
+	config, err := cache.ReadConfigPaths([]string{td})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if config.Datacenter != "dc1" || config.NodeName != "foo" || config.LogLevel != "info" {
+		t.Fatalf("bad: %#v", config)
+	}
+	cachedA := cache.files[a].config
+
+	// Change one file and remove another one.
+	write("b.json", `{"node_name": "bar"}`)
+	if err := os.Remove(c); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	config, err = cache.ReadConfigPaths([]string{td})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if config.Datacenter != "dc1" || config.NodeName != "bar" || config.LogLevel != "" {
+		t.Fatalf("bad: %#v", config)
+	}
+	if cache.files[a].config != cachedA {
+		t.Fatal("unchanged file was decoded again")
+	}
+	if cache.files[b].config.NodeName != "bar" {
+		t.Fatal("changed file was not decoded again")
+	}
+	if _, ok := cache.files[c]; ok {
+		t.Fatal("removed file is still cached")
+	}
+
+	// Decode errors are not cached.
+	write("b.json", `{`)
+	if _, err := cache.ReadConfigPaths([]string{td}); err == nil {
+		t.Fatal("should have err")
+	}
+	if cache.files[b].config.NodeName != "bar" {
+		t.Fatal("cache was updated by an invalid file")
+	}
+}
+
+func BenchmarkConfigCache_ReadConfigPaths(b *testing.B) {
+	td := writeBenchmarkConfigDir(b, 3000)
+	defer os.RemoveAll(td)
+
+	cache := NewConfigCache()
+	if _, err := cache.ReadConfigPaths([]string{td}); err != nil {
+		b.Fatalf("err: %s", err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := cache.ReadConfigPaths([]string{td}); err != nil {
+			b.Fatalf("err: %s", err)
+		}
+	}
+}
+
+func TestConfigCache_Vars(t *testing.T) {
+	t.Parallel()
+	td := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(td)
+
+	if err := ioutil.WriteFile(filepath.Join(td, "a.json"), []byte(`{"datacenter": "${DC}"}`), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cache := NewConfigCache()
+	for _, dc := range []string{"dc1", "dc2"} {
+		cache.Vars = map[string]string{"DC": dc}
+		config, err := cache.ReadConfigPaths([]string{td})
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if config.Datacenter != dc {
+			t.Fatalf("got %q want %q", config.Datacenter, dc)
+		}
+	}
+}
+
+func TestConfigCache_StrictKeys(t *testing.T) {
+	t.Parallel()
+	td := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(td)
+
+	if err := ioutil.WriteFile(filepath.Join(td, "a.json"), []byte(`{"service": {"name": "web", "prot": 80}}`), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Files decoded without checking the keys are decoded again when
+	// the keys are checked.
+	cache := NewConfigCache()
+	if _, err := cache.ReadConfigPaths([]string{td}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	cache.StrictKeys = true
+	_, err := cache.ReadConfigPaths([]string{td})
+	if err == nil || !strings.Contains(err.Error(), "service.prot") {
+		t.Fatalf("got error %v", err)
+	}
+}
+
+func TestConfigCache_functions(t *testing.T) {
+	t.Parallel()
+	td := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(td)
+
+	secret := filepath.Join(td, "secret")
+	if err := ioutil.WriteFile(secret, []byte("s3cr3t"), 0600); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	doc := []byte(`{"node_meta": {"secret": "${file \"` + secret + `\"}"}}`)
+	local := filepath.Join(td, "local.json")
+	remote := filepath.Join(td, "remote.json")
+	for _, path := range []string{local, remote} {
+		if err := ioutil.WriteFile(path, doc, 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	// Files calling functions are decoded again on every read, but their
+	// hashes are recorded so that they are not reported as changed.
+	cache := NewConfigCache()
+	cache.Remote = func(path string) bool { return path == remote }
+	config, err := cache.ReadConfigPaths([]string{local})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if got := config.Meta["secret"]; got != "s3cr3t" {
+		t.Fatalf("got %q", got)
+	}
+	if cache.Len() != 0 {
+		t.Fatalf("got %d cached files", cache.Len())
+	}
+	changed, err := ChangedConfigFiles([]string{local}, cache.Hashes())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(changed) != 0 {
+		t.Fatalf("got %v want no changes", changed)
+	}
+
+	// The functions of remote files are not evaluated.
+	if config, err = cache.ReadConfigPaths([]string{remote}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if got := config.Meta["secret"]; got != `${file "`+secret+`"}` {
+		t.Fatalf("got %q", got)
+	}
+}
@@ -0,0 +1,215 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	version "github.com/hashicorp/go-version"
+)
+
+// configKeyVersion records which agent versions support a configuration
+// key. The key also covers all keys nested below it.
+type configKeyVersion struct {
+	key string
+
+	// added is the first version which supports the key.
+	added string
+
+	// removed is the first version which no longer supports the key.
+	removed string
+}
+
+// configKeyVersions is the schema table of the configuration keys which
+// were added or removed since 0.7.0. Keys which are not listed are
+// supported by all of these versions.
+var configKeyVersions = []configKeyVersion{
+	{key: "performance", added: "0.7.0"},
+	{key: "raft_protocol", added: "0.7.0"},
+	{key: "node_meta", added: "0.7.3"},
+	{key: "autopilot", added: "0.8.0"},
+	{key: "addresses.rpc", removed: "0.8.0"},
+	{key: "ports.rpc", removed: "0.8.0"},
+	{key: "enable_script_checks", added: "0.9.0"},
+	{key: "limits", added: "0.9.3"},
+	{key: "allow_remote_exec_without_acls", added: "0.9.3"},
+	{key: "audit", added: "0.9.3"},
+	{key: "check_defaults", added: "0.9.3"},
+	{key: "check_deregister_interval_min", added: "0.9.3"},
+	{key: "check_output_max_size", added: "0.9.3"},
+	{key: "config_overlay", added: "0.9.3"},
+	{key: "config_stale_check_interval", added: "0.9.3"},
+	{key: "data_dir_encryption", added: "0.9.3"},
+	{key: "data_dir_filesystem_denylist", added: "0.9.3"},
+	{key: "deregister_critical_service_after", added: "0.9.3"},
+	{key: "disable_pid_file_check", added: "0.9.3"},
+	{key: "enable_agent_tls_for_checks", added: "0.9.3"},
+	{key: "enable_eventlog", added: "0.9.3"},
+	{key: "enable_local_script_checks", added: "0.9.3"},
+	{key: "gossip_key_rotation", added: "0.9.3"},
+	{key: "http_config.allowed_client_subjects", added: "0.9.3"},
+	{key: "http_config.read_only", added: "0.9.3"},
+	{key: "license_path", added: "0.9.3"},
+	{key: "node_meta_file", added: "0.9.3"},
+	{key: "node_meta_limits", added: "0.9.3"},
+	{key: "permissions", added: "0.9.3"},
+	{key: "ports.expose_max_port", added: "0.9.3"},
+	{key: "ports.expose_min_port", added: "0.9.3"},
+	{key: "ports.grpc", added: "0.9.3"},
+	{key: "ports.sidecar_max_port", added: "0.9.3"},
+	{key: "ports.sidecar_min_port", added: "0.9.3"},
+	{key: "read_replica", added: "0.9.3"},
+	{key: "reporting", added: "0.9.3"},
+	{key: "serf_lan_allowed_cidrs", added: "0.9.3"},
+	{key: "serf_wan_allowed_cidrs", added: "0.9.3"},
+	{key: "start_in_maintenance", added: "0.9.3"},
+	{key: "start_in_maintenance_reason", added: "0.9.3"},
+	{key: "strict_permissions", added: "0.9.3"},
+	{key: "systemd_notify", added: "0.9.3"},
+	{key: "tagged_addresses", added: "0.9.3"},
+	{key: "variable", added: "0.9.3"},
+	{key: "windows_service_name", added: "0.9.3"},
+	{key: "atlas_acl_token", removed: "0.9.3"},
+	{key: "atlas_endpoint", removed: "0.9.3"},
+	{key: "atlas_infrastructure", removed: "0.9.3"},
+	{key: "atlas_join", removed: "0.9.3"},
+	{key: "atlas_token", removed: "0.9.3"},
+}
+
+// configDefaultChange records a version which changed the default value of
+// a configuration key.
+type configDefaultChange struct {
+	key     string
+	version string
+	old     string
+	new     string
+}
+
+// configDefaultChanges lists the changes of default values since 0.7.0.
+var configDefaultChanges = []configDefaultChange{
+	{key: "acl_enforce_version_8", version: "0.8.0", old: "false", new: "true"},
+	{key: "disable_host_node_id", version: "0.8.5", old: "false", new: "true"},
+	{key: "enable_script_checks", version: "0.9.0", old: "true", new: "false"},
+	{key: "raft_protocol", version: "1.0.0", old: "2", new: "3"},
+}
+
+// ConfigCompatIssue is a part of a configuration which behaves differently
+// on the target version.
+type ConfigCompatIssue struct {
+	// Path is the configuration file of an unsupported key. It is empty
+	// for default changes, which concern all files.
+	Path string
+
+	// Key is the dotted path of the configuration key.
+	Key string
+
+	// Unsupported is true if the target version does not support the key.
+	// Otherwise the key is not set and its default differs on the target
+	// version.
+	Unsupported bool
+
+	// Message describes the issue.
+	Message string
+}
+
+// CheckConfigCompatibility compares the configuration files at the given
+// paths against the schema table and returns the keys which the target
+// version does not support, and the keys whose defaults differ between the
+// current and the target version and which are not set in any file.
+func CheckConfigCompatibility(paths []string, limits ConfigLimits, current, target string) ([]ConfigCompatIssue, error) {
+	cur, err := version.NewVersion(current)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid version %q: %s", current, err)
+	}
+	// A target like 1.x stands for the earliest version of the series.
+	if strings.HasSuffix(target, ".x") {
+		target = strings.TrimSuffix(target, "x") + "0"
+	}
+	tgt, err := version.NewVersion(target)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid target version %q: %s", target, err)
+	}
+
+	var issues []ConfigCompatIssue
+	set := make(map[string]bool)
+	for _, cf := range configFiles(paths) {
+		if cf.err != nil {
+			return nil, cf.err
+		}
+		data, err := readConfigFileData(cf.path, limits)
+		if err != nil {
+			return nil, err
+		}
+		var raw map[string]interface{}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("Error decoding '%s': %s", cf.path, err)
+		}
+
+		keys := rawConfigKeys(raw, "")
+		for _, key := range keys {
+			set[key] = true
+		}
+		for _, kv := range configKeyVersions {
+			if !hasConfigKey(keys, kv.key) {
+				continue
+			}
+			var msg string
+			switch {
+			case kv.added != "" && tgt.LessThan(version.Must(version.NewVersion(kv.added))):
+				msg = fmt.Sprintf("'%s' is not supported before %s", kv.key, kv.added)
+			case kv.removed != "" && !tgt.LessThan(version.Must(version.NewVersion(kv.removed))):
+				msg = fmt.Sprintf("'%s' is not supported since %s", kv.key, kv.removed)
+			default:
+				continue
+			}
+			issues = append(issues, ConfigCompatIssue{Path: cf.path, Key: kv.key, Unsupported: true, Message: msg})
+		}
+	}
+
+	for _, dc := range configDefaultChanges {
+		if set[dc.key] {
+			continue
+		}
+		v := version.Must(version.NewVersion(dc.version))
+		curHasNew, tgtHasNew := !cur.LessThan(v), !tgt.LessThan(v)
+		if curHasNew == tgtHasNew {
+			continue
+		}
+		from, to := dc.old, dc.new
+		if curHasNew {
+			from, to = dc.new, dc.old
+		}
+		issues = append(issues, ConfigCompatIssue{
+			Key: dc.key,
+			Message: fmt.Sprintf("'%s' is not set and defaults to %s instead of %s on %s",
+				dc.key, to, from, tgt),
+		})
+	}
+	return issues, nil
+}
+
+// rawConfigKeys returns the dotted paths of all keys in the configuration
+// document in sorted order.
+func rawConfigKeys(raw map[string]interface{}, prefix string) []string {
+	var keys []string
+	for k, v := range raw {
+		key := prefix + k
+		keys = append(keys, key)
+		if m, ok := v.(map[string]interface{}); ok {
+			keys = append(keys, rawConfigKeys(m, key+".")...)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// hasConfigKey returns true if the key or a key nested below it is in keys.
+func hasConfigKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key || strings.HasPrefix(k, key+".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package agent
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/consul/testutil"
+	"github.com/pascaldekloe/goe/verify"
+)
+
+func TestCheckConfigCompatibility(t *testing.T) {
+	t.Parallel()
+	td := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(td)
+
+	files := map[string]string{
+		"a.json": `{"autopilot": {"cleanup_dead_servers": true}, "ports": {"rpc": 8400}}`,
+		"b.json": `{"systemd_notify": true, "node_meta": {"rack": "a"}, "acl_enforce_version_8": false}`,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(td, name), []byte(content), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	a, b := filepath.Join(td, "a.json"), filepath.Join(td, "b.json")
+
+	tests := []struct {
+		target string
+		issues []ConfigCompatIssue
+	}{
+		{
+			target: "0.7.0",
+			issues: []ConfigCompatIssue{
+				{Path: a, Key: "autopilot", Unsupported: true, Message: "'autopilot' is not supported before 0.8.0"},
+				{Path: b, Key: "node_meta", Unsupported: true, Message: "'node_meta' is not supported before 0.7.3"},
+				{Path: b, Key: "systemd_notify", Unsupported: true, Message: "'systemd_notify' is not supported before 0.9.3"},
+				{Key: "disable_host_node_id", Message: "'disable_host_node_id' is not set and defaults to false instead of true on 0.7.0"},
+				{Key: "enable_script_checks", Message: "'enable_script_checks' is not set and defaults to true instead of false on 0.7.0"},
+			},
+		},
+		{
+			target: "0.9.3",
+			issues: []ConfigCompatIssue{
+				{Path: a, Key: "ports.rpc", Unsupported: true, Message: "'ports.rpc' is not supported since 0.8.0"},
+			},
+		},
+		{
+			target: "1.x",
+			issues: []ConfigCompatIssue{
+				{Path: a, Key: "ports.rpc", Unsupported: true, Message: "'ports.rpc' is not supported since 0.8.0"},
+				{Key: "raft_protocol", Message: "'raft_protocol' is not set and defaults to 3 instead of 2 on 1.0.0"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			issues, err := CheckConfigCompatibility([]string{td}, DefaultConfigLimits(), "0.9.3", tt.target)
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			verify.Values(t, "", issues, tt.issues)
+		})
+	}
+
+	if _, err := CheckConfigCompatibility([]string{td}, DefaultConfigLimits(), "0.9.3", "latest"); err == nil {
+		t.Fatal("should fail")
+	}
+}
+
+// configKeysBefore070 are the configuration keys which all versions since
+// 0.7.0 support and which therefore have no entry in configKeyVersions.
+var configKeysBefore070 = strings.Fields(`
+acl_agent_master_token acl_agent_token acl_datacenter acl_default_policy
+acl_down_policy acl_enforce_version_8 acl_master_token acl_replication_token
+acl_token acl_ttl addresses addresses.dns addresses.http addresses.https
+advertise_addr advertise_addr_wan advertise_addrs advertise_addrs.rpc
+advertise_addrs.serf_lan advertise_addrs.serf_wan bind_addr bootstrap
+bootstrap_expect ca_file ca_path cert_file check_update_interval checks
+client_addr data_dir datacenter disable_anonymous_signature
+disable_coordinates disable_host_node_id disable_keyring_file
+disable_remote_exec disable_update_check dns_config dns_config.allow_stale
+dns_config.disable_compression dns_config.enable_truncate
+dns_config.max_stale dns_config.node_ttl dns_config.only_passing
+dns_config.recursor_timeout dns_config.service_ttl
+dns_config.udp_answer_limit domain enable_acl_replication enable_debug
+enable_syslog encrypt encrypt_verify_incoming encrypt_verify_outgoing
+http_config http_config.block_endpoints http_config.response_headers
+key_file leave_on_terminate log_level node_id node_name pid_file ports
+ports.dns ports.http ports.https ports.serf_lan ports.serf_wan ports.server
+protocol reconnect_timeout reconnect_timeout_wan recursors
+rejoin_after_leave retry_interval retry_interval_wan retry_join
+retry_join_wan retry_max retry_max_wan serf_lan_bind serf_wan_bind server
+server_name services session_ttl_min skip_leave_on_interrupt start_join
+start_join_wan syslog_facility telemetry telemetry.circonus_api_app
+telemetry.circonus_api_token telemetry.circonus_api_url
+telemetry.circonus_broker_id telemetry.circonus_broker_select_tag
+telemetry.circonus_check_display_name
+telemetry.circonus_check_force_metric_activation telemetry.circonus_check_id
+telemetry.circonus_check_instance_id telemetry.circonus_check_search_tag
+telemetry.circonus_check_tags telemetry.circonus_submission_interval
+telemetry.circonus_submission_url telemetry.disable_hostname
+telemetry.dogstatsd_addr telemetry.dogstatsd_tags telemetry.filter_default
+telemetry.prefix_filter telemetry.statsd_address telemetry.statsite_address
+telemetry.statsite_prefix tls_cipher_suites tls_min_version
+tls_prefer_server_cipher_suites translate_wan_addrs ui ui_dir unix_sockets
+unix_sockets.group unix_sockets.mode unix_sockets.user verify_incoming
+verify_incoming_https verify_incoming_rpc verify_outgoing
+verify_server_hostname watches
+`)
+
+func TestConfigKeyVersions_complete(t *testing.T) {
+	t.Parallel()
+	old := make(map[string]bool)
+	for _, key := range configKeysBefore070 {
+		old[key] = true
+	}
+	listed := func(key string) bool {
+		for _, kv := range configKeyVersions {
+			if key == kv.key || strings.HasPrefix(key, kv.key+".") {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Every key of the configuration must either be listed or be known
+	// to every version, so that new keys cannot be forgotten.
+	var walk func(fields []mergeField)
+	walk = func(fields []mergeField) {
+		for _, f := range fields {
+			if f.kind == mergeStruct || f.kind == mergeStructPtr {
+				walk(f.fields)
+			}
+			if f.key == "" || f.kind == mergeSkip || listed(f.key) || old[f.key] {
+				continue
+			}
+			t.Errorf("configuration key %q has no entry in configKeyVersions", f.key)
+		}
+	}
+	walk(mergeFieldsForConfig())
+}
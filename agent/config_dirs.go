@@ -0,0 +1,135 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ExpandConfigDirs replaces every directory among the configuration paths
+// with the directory followed by all of its subdirectories, so that the
+// files of the whole tree are read. The tree is walked depth first with the
+// subdirectories of a directory in lexical order, which means that the
+// files of a directory are merged before the files of its subdirectories.
+//
+// Hidden directories, like the ..data directories of mounted Kubernetes
+// volumes, symlinked directories and the overrides directories holding the
+// override files are not descended into. Paths which cannot be read are
+// kept so that reading them reports the error. Glob patterns are expanded
+// first, see ExpandConfigGlobs.
+func ExpandConfigDirs(paths []string) ([]string, error) {
+	var result []string
+	for _, path := range ExpandConfigGlobs(paths) {
+		if fi, err := os.Stat(path); err != nil || !fi.IsDir() {
+			result = append(result, path)
+			continue
+		}
+		dirs, err := configSubdirs(path)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, dirs...)
+	}
+	return result, nil
+}
+
+// ExpandConfigGlobs replaces the configuration paths which contain the
+// glob characters '*', '?' or '[' and do not exist with the paths matching
+// them in lexical order, like "consul.d/*/services" for the services
+// directories of all teams. Like the files of a configuration directory,
+// files only match if they are configuration files which are not empty,
+// and wildcards do not match hidden files and directories. Patterns which
+// are malformed or match nothing are kept so that reading them reports
+// the error.
+func ExpandConfigGlobs(paths []string) []string {
+	var result []string
+	for _, path := range paths {
+		if !isConfigGlob(path) {
+			result = append(result, path)
+			continue
+		}
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			result = append(result, path)
+			continue
+		}
+		sort.Strings(matches)
+
+		var found []string
+		for _, m := range matches {
+			if isHiddenGlobMatch(path, m) {
+				continue
+			}
+			fi, err := os.Stat(m)
+			if err != nil {
+				continue
+			}
+			if fi.IsDir() || (isConfigFileName(m) && fi.Size() > 0) {
+				found = append(found, m)
+			}
+		}
+		if len(found) == 0 {
+			found = []string{path}
+		}
+		result = append(result, found...)
+	}
+	return result
+}
+
+// isHiddenGlobMatch returns true if a wildcard of pattern matched a hidden
+// file or directory of match. Names starting with a dot only match if the
+// pattern spells out the dot.
+func isHiddenGlobMatch(pattern, match string) bool {
+	sep := string(filepath.Separator)
+	ps := strings.Split(filepath.Clean(pattern), sep)
+	ms := strings.Split(filepath.Clean(match), sep)
+	if len(ps) != len(ms) {
+		return false
+	}
+	for i := range ms {
+		if strings.HasPrefix(ms[i], ".") && !strings.HasPrefix(ps[i], ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// isConfigGlob returns true if path is a glob pattern instead of the path
+// of an existing file or directory.
+func isConfigGlob(path string) bool {
+	if !strings.ContainsAny(path, "*?[") {
+		return false
+	}
+	_, err := os.Stat(path)
+	return os.IsNotExist(err)
+}
+
+// configSubdirs returns dir and its subdirectories in the order in which
+// ExpandConfigDirs reads them.
+func configSubdirs(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading '%s': %s", dir, err)
+	}
+	contents, err := f.Readdir(-1)
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("Error reading '%s': %s", dir, err)
+	}
+	sort.Sort(dirEnts(contents))
+
+	dirs := []string{dir}
+	for _, fi := range contents {
+		if !fi.IsDir() || strings.HasPrefix(fi.Name(), ".") || fi.Name() == ConfigOverridesDir {
+			continue
+		}
+		sub, err := configSubdirs(filepath.Join(dir, fi.Name()))
+		if err != nil {
+			return nil, err
+		}
+		dirs = append(dirs, sub...)
+	}
+	return dirs, nil
+}
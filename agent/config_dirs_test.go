@@ -0,0 +1,164 @@
+package agent
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/consul/testutil"
+	"github.com/pascaldekloe/goe/verify"
+)
+
+func TestExpandConfigDirs(t *testing.T) {
+	t.Parallel()
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+	for _, sub := range []string{
+		"services/web",
+		"services/db",
+		"checks",
+		".hidden",
+		ConfigOverridesDir,
+		"services/" + ConfigOverridesDir,
+	} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(dir, "checks"), filepath.Join(dir, "linked")); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	file := filepath.Join(dir, "base.json")
+	if err := ioutil.WriteFile(file, []byte(`{}`), 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	missing := filepath.Join(dir, "missing")
+
+	got, err := ExpandConfigDirs([]string{file, dir, missing})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	want := []string{
+		file,
+		dir,
+		filepath.Join(dir, "checks"),
+		filepath.Join(dir, "services"),
+		filepath.Join(dir, "services/db"),
+		filepath.Join(dir, "services/web"),
+		missing,
+	}
+	verify.Values(t, "paths", got, want)
+}
+
+func TestExpandConfigDirs_ReadConfigPaths(t *testing.T) {
+	t.Parallel()
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"a.json":          `{"log_level": "INFO", "node_meta": {"a": "1"}}`,
+		"services/b.json": `{"log_level": "WARN", "node_meta": {"b": "1"}}`,
+		"z.json":          `{"log_level": "DEBUG", "node_meta": {"z": "1"}}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	paths, err := ExpandConfigDirs([]string{dir})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	c, err := ReadConfigPaths(paths)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The files of the directory are merged before the ones of its
+	// subdirectories.
+	if c.LogLevel != "WARN" {
+		t.Fatalf("got log level %q", c.LogLevel)
+	}
+	verify.Values(t, "meta", c.Meta, map[string]string{"a": "1", "b": "1", "z": "1"})
+}
+
+func TestExpandConfigGlobs(t *testing.T) {
+	t.Parallel()
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"team-b/services/web.json":   `{}`,
+		"team-a/services/db.hcl":     `{}`,
+		"team-a/services/notes.md":   `notes`,
+		"team-a/services/empty.json": ``,
+		"team-a/base.yaml":           `{}`,
+		".team-c/services/x.json":    `{}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	file := filepath.Join(dir, "team-a/base.yaml")
+	nomatch := filepath.Join(dir, "*/checks")
+	got := ExpandConfigGlobs([]string{
+		file,
+		filepath.Join(dir, "*/services"),
+		filepath.Join(dir, "team-a/services/*"),
+		nomatch,
+	})
+	want := []string{
+		file,
+		filepath.Join(dir, "team-a/services"),
+		filepath.Join(dir, "team-b/services"),
+		filepath.Join(dir, "team-a/services/db.hcl"),
+		nomatch,
+	}
+	verify.Values(t, "paths", got, want)
+
+	_, err := ReadConfigPaths([]string{nomatch})
+	if err == nil || !strings.Contains(err.Error(), "no configuration files or directories match") {
+		t.Fatalf("got error %v", err)
+	}
+}
+
+func TestReadConfigPaths_formats(t *testing.T) {
+	t.Parallel()
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"a.json": `{"node_meta": {"a": "1"}}`,
+		"b.hcl":  `node_meta { b = "1" }` + "\n" + `log_level = "WARN"`,
+		"c.yaml": "node_meta:\n  c: \"1\"\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	b := &ConfigBuilder{Default: DefaultConfig(), Paths: []string{filepath.Join(dir, "*.*")}}
+	c, _, err := b.Build()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	verify.Values(t, "node_meta", c.Meta, map[string]string{"a": "1", "b": "1", "c": "1"})
+	verify.Values(t, "log_level", c.LogLevel, "WARN")
+	verify.Values(t, "load order", b.LoadOrder(), []string{
+		filepath.Join(dir, "a.json"),
+		filepath.Join(dir, "b.hcl"),
+		filepath.Join(dir, "c.yaml"),
+	})
+	verify.Values(t, "source", b.Provenance().Source("log_level"), filepath.Join(dir, "b.hcl"))
+}
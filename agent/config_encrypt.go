@@ -0,0 +1,89 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/memberlist"
+)
+
+// validateEncryptKey checks that key is a base64 encoded gossip
+// encryption key of a size supported by memberlist.
+func validateEncryptKey(key string) error {
+	b, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return configErrorf([]string{"encrypt"},
+			"Invalid encryption key: %s. The key must be base64 encoded, use 'consul keygen' to generate one", err)
+	}
+	if err := memberlist.ValidateKey(b); err != nil {
+		return configErrorf([]string{"encrypt"},
+			"Invalid encryption key: %s, got %d bytes. Use 'consul keygen' to generate a valid key", err, len(b))
+	}
+	return nil
+}
+
+// verifyKeyrings checks that the encryption key is installed in the
+// keyrings persisted in the data directory and returns a warning for each
+// keyring which does not have it. The agent uses an existing keyring
+// instead of the key, so a missing key is not an error: keys are removed
+// from the keyring after a rotation or with 'consul keyring -remove'. It
+// can however mean that the agent was pointed at the data directory of a
+// different cluster. Keyrings encrypted with the data directory encryption
+// key are not checked.
+func (c *Config) verifyKeyrings() (warnings []string, err error) {
+	if c.EncryptKey == "" || c.DisableKeyringFile || c.DataDir == "" {
+		return nil, nil
+	}
+	if _, err := c.EncryptBytes(); err != nil {
+		return nil, nil
+	}
+
+	files := []string{SerfLANKeyring}
+	if c.Server {
+		files = append(files, SerfWANKeyring)
+	}
+	for _, f := range files {
+		path := filepath.Join(c.DataDir, f)
+		data, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error reading keyring '%s': %s", path, err)
+		}
+		if bytes.HasPrefix(data, encryptedFileHeader) {
+			continue
+		}
+
+		var keys []string
+		if err := json.Unmarshal(data, &keys); err != nil {
+			return nil, fmt.Errorf("Error reading keyring '%s': %s", path, err)
+		}
+		if !keyringHasKey(keys, c.EncryptKey) {
+			warnings = append(warnings, fmt.Sprintf(
+				"Encryption key is not in the keyring '%s', which is used instead of the key. "+
+					"Remove the key from the configuration if it was rotated, install it with "+
+					"'consul keyring -install', or delete the keyring to start over with the key", path))
+		}
+	}
+	return warnings, nil
+}
+
+// keyringHasKey returns true if keys holds key.
+func keyringHasKey(keys []string, key string) bool {
+	want, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return false
+	}
+	for _, k := range keys {
+		if b, err := base64.StdEncoding.DecodeString(k); err == nil && bytes.Equal(b, want) {
+			return true
+		}
+	}
+	return false
+}
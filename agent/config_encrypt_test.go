@@ -0,0 +1,95 @@
+package agent
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/consul/testutil"
+)
+
+func TestConfig_verifyKeyrings(t *testing.T) {
+	t.Parallel()
+	key1 := "tbLJg26ZJyJ9pK3qhc9jig=="
+	key2 := "4leC33rgtXKIVUr9Nr0snQ=="
+
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+	empty := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(empty)
+	if err := initKeyring(filepath.Join(dir, SerfLANKeyring), key1); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	tests := []struct {
+		desc    string
+		cfg     *Config
+		warning string
+	}{
+		{"no keyring", &Config{DataDir: empty, EncryptKey: key2}, ""},
+		{"key in keyring", &Config{DataDir: dir, EncryptKey: key1}, ""},
+		{"keyring file disabled", &Config{DataDir: dir, EncryptKey: key2, DisableKeyringFile: true}, ""},
+		{"key not in keyring", &Config{DataDir: dir, EncryptKey: key2}, "Encryption key is not in the keyring"},
+		{"no WAN keyring", &Config{DataDir: dir, EncryptKey: key1, Server: true}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			warnings, err := tt.cfg.verifyKeyrings()
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			got := strings.Join(warnings, "; ")
+			if (tt.warning == "" && got != "") || !strings.Contains(got, tt.warning) {
+				t.Fatalf("got warnings %q want %q", got, tt.warning)
+			}
+		})
+	}
+
+	// The key is checked against the WAN keyring of servers as well.
+	if err := ioutil.WriteFile(filepath.Join(dir, SerfWANKeyring), []byte(`["`+key2+`"]`), 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	warnings, err := (&Config{DataDir: dir, EncryptKey: key1, Server: true}).verifyKeyrings()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], SerfWANKeyring) {
+		t.Fatalf("got warnings %v", warnings)
+	}
+
+	// A keyring which cannot be read is still an error.
+	if err := ioutil.WriteFile(filepath.Join(dir, SerfWANKeyring), []byte(`{`), 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := (&Config{DataDir: dir, EncryptKey: key1, Server: true}).verifyKeyrings(); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestConfigBuilder_rotatedEncryptKey(t *testing.T) {
+	t.Parallel()
+	key1 := "tbLJg26ZJyJ9pK3qhc9jig=="
+	key2 := "4leC33rgtXKIVUr9Nr0snQ=="
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+
+	// key1 was rotated out of the keyring, but the configuration still
+	// has it, which must not keep the agent from starting.
+	if err := initKeyring(filepath.Join(dir, SerfLANKeyring), key2); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	b := &ConfigBuilder{
+		Sources: []ConfigSource{{Name: "-hcl", Format: ConfigFormatHCL, Data: `data_dir = "` + dir + `"
+encrypt = "` + key1 + `"`}},
+		Limits: DefaultConfigLimits(),
+	}
+	_, warnings, err := b.Build()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !strings.Contains(strings.Join(warnings, "; "), "Encryption key is not in the keyring") {
+		t.Fatalf("got warnings %v", warnings)
+	}
+}
@@ -0,0 +1,244 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// envConfigPrefix is the prefix of the environment variables which
+// override configuration keys.
+const envConfigPrefix = "CONSUL_"
+
+// ReadEnvFile reads a dotenv-style file with one KEY=VALUE pair per line.
+// Empty lines and lines starting with '#' are ignored, an "export " prefix
+// is allowed and values may be enclosed in single or double quotes. Double
+// quoted values support the escape sequences of Go string literals.
+func ReadEnvFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading '%s': %s", path, err)
+	}
+	defer f.Close()
+
+	env, err := parseEnvFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading '%s': %s", path, err)
+	}
+	return env, nil
+}
+
+// envNameRe matches the valid names of variables in an env file.
+var envNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func parseEnvFile(r io.Reader) (map[string]string, error) {
+	env := make(map[string]string)
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", n)
+		}
+		name, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if !envNameRe.MatchString(name) {
+			return nil, fmt.Errorf("line %d: invalid variable name %q", n, name)
+		}
+
+		switch {
+		case strings.HasPrefix(value, `"`):
+			v, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid quoted value for %s", n, name)
+			}
+			value = v
+		case strings.HasPrefix(value, "'"):
+			if len(value) < 2 || !strings.HasSuffix(value, "'") {
+				return nil, fmt.Errorf("line %d: invalid quoted value for %s", n, name)
+			}
+			value = value[1 : len(value)-1]
+		default:
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = strings.TrimSpace(value[:i])
+			}
+		}
+		env[name] = value
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// interpolateRe matches the ${NAME} and ${var.NAME} references in
+// configuration values.
+var interpolateRe = regexp.MustCompile(`\$\{((?:var\.)?[A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// interpolateVars replaces the ${NAME} references in all string values of
+// the decoded JSON value v with the value of NAME in vars. References to
+// names which are not in vars are left as they are so that values like
+// shell commands of watch handlers are not changed.
+func interpolateVars(v interface{}, vars map[string]string) interface{} {
+	switch v := v.(type) {
+	case string:
+		return interpolateRe.ReplaceAllStringFunc(v, func(ref string) string {
+			if val, ok := vars[ref[2:len(ref)-1]]; ok {
+				return val
+			}
+			return ref
+		})
+	case []interface{}:
+		for i := range v {
+			v[i] = interpolateVars(v[i], vars)
+		}
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = interpolateVars(v[k], vars)
+		}
+	}
+	return v
+}
+
+// envConfigKey is a configuration key which can be set through an
+// environment variable.
+type envConfigKey struct {
+	path []string
+	kind reflect.Kind
+}
+
+var (
+	envConfigKeysOnce sync.Once
+	envConfigKeys     map[string]envConfigKey
+)
+
+// envConfigKeysForConfig returns the configuration keys which can be set
+// through environment variables by their variable name. The name is the
+// upper-cased key joined with '_' and prefixed with CONSUL_, e.g.
+// CONSUL_PORTS_DNS for ports.dns.
+func envConfigKeysForConfig() map[string]envConfigKey {
+	envConfigKeysOnce.Do(func() {
+		envConfigKeys = make(map[string]envConfigKey)
+		addEnvConfigKeys(envConfigKeys, mergeFieldsForConfig(), reflect.TypeOf(Config{}))
+	})
+	return envConfigKeys
+}
+
+// addEnvConfigKeys adds the keys of the fields in the merge plan of the
+// struct type t which hold scalars or lists of strings. Parsed fields are
+// set through the key of their raw value.
+func addEnvConfigKeys(keys map[string]envConfigKey, fields []mergeField, t reflect.Type) {
+	for _, f := range fields {
+		ft := t.Field(f.index).Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		switch {
+		case f.kind == mergeStruct || f.kind == mergeStructPtr:
+			addEnvConfigKeys(keys, f.fields, ft)
+			continue
+		case f.key == "" || f.raw >= 0 || f.kind == mergeSkip:
+			continue
+		}
+
+		kind := ft.Kind()
+		switch kind {
+		case reflect.String, reflect.Bool,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		case reflect.Slice:
+			if ft.Elem().Kind() != reflect.String {
+				continue
+			}
+		default:
+			continue
+		}
+		path := strings.Split(f.key, ".")
+		keys[ConfigEnvName(strings.Join(path, "_"))] = envConfigKey{path: path, kind: kind}
+	}
+}
+
+// ConfigEnviron returns the CONSUL_<KEY> variables of environ, which holds
+// KEY=VALUE entries like the ones returned by os.Environ.
+func ConfigEnviron(environ []string) map[string]string {
+	env := make(map[string]string)
+	for _, kv := range environ {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) == 2 && strings.HasPrefix(parts[0], envConfigPrefix) {
+			env[parts[0]] = parts[1]
+		}
+	}
+	return env
+}
+
+// ConfigFromEnv builds a configuration from the CONSUL_<KEY> variables in
+// env which match a configuration key. Lists are given as comma separated
+// values. Variables which do not match a configuration key are ignored,
+// except for the keys of the ports and addresses blocks.
+func ConfigFromEnv(env map[string]string) (*Config, error) {
+	keys := envConfigKeysForConfig()
+	raw := make(map[string]interface{})
+	for name, value := range env {
+		key, ok := keys[name]
+		if !ok {
+			// Unknown ports and addresses are errors like they are in
+			// the configuration files.
+			for _, block := range strictConfigBlocks {
+				prefix := ConfigEnvName(block) + "_"
+				if !strings.HasPrefix(name, prefix) {
+					continue
+				}
+				sub := block + "." + strings.ToLower(strings.TrimPrefix(name, prefix))
+				if !isLegacyConfigKey(sub) {
+					return nil, fmt.Errorf("%s: unknown key %s", name, sub)
+				}
+			}
+			continue
+		}
+
+		var v interface{}
+		switch key.kind {
+		case reflect.String:
+			v = value
+		case reflect.Bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid boolean %q", name, value)
+			}
+			v = b
+		case reflect.Slice:
+			var list []interface{}
+			for _, s := range strings.Split(value, ",") {
+				if s = strings.TrimSpace(s); s != "" {
+					list = append(list, s)
+				}
+			}
+			v = list
+		default:
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid number %q", name, value)
+			}
+			v = n
+		}
+		setConfigKey(raw, strings.Join(key.path, "."), v)
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(raw); err != nil {
+		return nil, err
+	}
+	return DecodeConfig(&buf)
+}
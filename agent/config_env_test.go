@@ -0,0 +1,167 @@
+package agent
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pascaldekloe/goe/verify"
+)
+
+func TestParseEnvFile(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		desc string
+		in   string
+		env  map[string]string
+		err  string
+	}{
+		{"empty", "", map[string]string{}, ""},
+		{
+			desc: "values",
+			in: `
+# comment
+A=1
+export B = two words
+C="quoted \"value\"\n"
+D='single $quoted'
+E=value # comment
+F=
+`,
+			env: map[string]string{
+				"A": "1",
+				"B": "two words",
+				"C": "quoted \"value\"\n",
+				"D": "single $quoted",
+				"E": "value",
+				"F": "",
+			},
+		},
+		{desc: "no value", in: "A", err: "line 1: expected KEY=VALUE"},
+		{desc: "bad name", in: "\n1A=b", err: `line 2: invalid variable name "1A"`},
+		{desc: "bad quotes", in: `A="b`, err: "line 1: invalid quoted value for A"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			env, err := parseEnvFile(strings.NewReader(tt.in))
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("got error %v want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if !reflect.DeepEqual(env, tt.env) {
+				t.Fatalf("got %v want %v", env, tt.env)
+			}
+		})
+	}
+}
+
+func TestDecodeConfig_interpolation(t *testing.T) {
+	t.Parallel()
+	in := `{
+		"datacenter": "${DC}",
+		"node_name": "web-${HOST_ID}",
+		"check_update_interval": "${INTERVAL}",
+		"retry_join": ["${JOIN}"],
+		"watches": [{"type": "key", "key": "a", "handler": "echo ${CONSUL_INDEX}"}]
+	}`
+	vars := map[string]string{"DC": "dc2", "HOST_ID": "7", "INTERVAL": "1m", "JOIN": "10.0.0.1"}
+	c, err := decodeConfig(strings.NewReader(in), vars, false, false)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if c.Datacenter != "dc2" || c.NodeName != "web-7" || c.CheckUpdateInterval != time.Minute {
+		t.Fatalf("bad: %#v", c)
+	}
+	if !reflect.DeepEqual(c.RetryJoin, []string{"10.0.0.1"}) {
+		t.Fatalf("bad: %v", c.RetryJoin)
+	}
+	// Unknown references are left alone.
+	if got := c.Watches[0]["handler"]; got != "echo ${CONSUL_INDEX}" {
+		t.Fatalf("bad: %v", got)
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Parallel()
+	env := map[string]string{
+		"CONSUL_DATACENTER":             "dc2",
+		"CONSUL_SERVER":                 "true",
+		"CONSUL_PORTS_DNS":              "8653",
+		"CONSUL_RETRY_JOIN":             "a, b",
+		"CONSUL_DNS_CONFIG_ALLOW_STALE": "true",
+		"CONSUL_CHECK_UPDATE_INTERVAL":  "1m",
+		"CONSUL_HTTP_TOKEN":             "ignored",
+		"OTHER":                         "ignored",
+	}
+	c, err := ConfigFromEnv(env)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	want := &Config{
+		Datacenter:             "dc2",
+		Server:                 true,
+		Ports:                  PortConfig{DNS: 8653},
+		RetryJoin:              []string{"a", "b"},
+		DNSConfig:              DNSConfig{AllowStale: Bool(true)},
+		CheckUpdateInterval:    time.Minute,
+		CheckUpdateIntervalRaw: "1m",
+	}
+	verify.Values(t, "", c, want)
+
+	// Legacy keys are ignored like in the configuration files.
+	if _, err := ConfigFromEnv(map[string]string{"CONSUL_PORTS_RPC": "8400"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for name, value := range map[string]string{
+		"CONSUL_SERVER":          "yes please",
+		"CONSUL_PORTS_DNS":       "a",
+		"CONSUL_PORTS_HTTTP":     "8500",
+		"CONSUL_ADDRESSES_HTTTP": "127.0.0.1",
+	} {
+		if _, err := ConfigFromEnv(map[string]string{name: value}); err == nil || !strings.Contains(err.Error(), name) {
+			t.Fatalf("%s=%s: got error %v", name, value, err)
+		}
+	}
+}
+
+func TestConfigEnviron(t *testing.T) {
+	t.Parallel()
+	environ := []string{
+		"CONSUL_DATACENTER=dc2",
+		"CONSUL_NODE_META_FILE=a=b",
+		"CONSUL_EMPTY=",
+		"HOME=/root",
+		"CONSUL_BROKEN",
+	}
+	want := map[string]string{
+		"CONSUL_DATACENTER":     "dc2",
+		"CONSUL_NODE_META_FILE": "a=b",
+		"CONSUL_EMPTY":          "",
+	}
+	verify.Values(t, "", ConfigEnviron(environ), want)
+}
+
+func TestEnvConfigKeys_mergePlan(t *testing.T) {
+	t.Parallel()
+	fields := mergeFieldsForConfig()
+	for name, k := range envConfigKeysForConfig() {
+		key := strings.Join(k.path, ".")
+		if f := findMergeField(fields, key); f == nil {
+			t.Fatalf("%s: key %q is not in the merge plan", name, key)
+		}
+	}
+	for _, block := range strictConfigBlocks {
+		for _, k := range configBlockKeys(block) {
+			if findMergeField(fields, block+"."+k) == nil {
+				t.Fatalf("key %q is not in the merge plan", block+"."+k)
+			}
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package agent
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FlexibleDuration is the unparsed value of a duration setting, like
+// "30s". Older configurations also gave durations as a number of seconds,
+// which decodeConfig translates into this form.
+type FlexibleDuration string
+
+// Duration parses the duration.
+func (d FlexibleDuration) Duration() (time.Duration, error) {
+	return time.ParseDuration(string(d))
+}
+
+// flexibleListKeys are the keys of lists which historically also accepted
+// a single string in place of a list with one element.
+var flexibleListKeys = []string{
+	"recursors",
+	"retry_join",
+	"retry_join_wan",
+	"start_join",
+	"start_join_wan",
+}
+
+// flexibleAddrKeys are the keys of space separated lists of addresses
+// which also accept a list of addresses.
+var flexibleAddrKeys = []string{
+	"client_addr",
+	"addresses.dns",
+	"addresses.http",
+	"addresses.https",
+}
+
+// fixupFlexibleConfig translates the alternative forms of the flexible keys
+// in the raw JSON configuration into the form they are decoded from. It
+// returns the keys which were set to a single string in place of a list,
+// which is deprecated.
+func fixupFlexibleConfig(raw map[string]interface{}) []string {
+	var scalars []string
+	for _, key := range flexibleListKeys {
+		v, ok := lookupConfigKey(raw, key)
+		if !ok {
+			continue
+		}
+		if s, ok := v.(string); ok {
+			setConfigKey(raw, key, []interface{}{s})
+			scalars = append(scalars, key)
+		}
+	}
+	for _, key := range flexibleAddrKeys {
+		v, ok := lookupConfigKey(raw, key)
+		if !ok {
+			continue
+		}
+		if list, ok := v.([]interface{}); ok {
+			addrs := make([]string, len(list))
+			for i, addr := range list {
+				addrs[i] = fmt.Sprint(addr)
+			}
+			setConfigKey(raw, key, strings.Join(addrs, " "))
+		}
+	}
+	return scalars
+}
+
+// checkDurationKeys are the lower case keys of check definitions whose
+// values are durations, see FixupCheckType.
+var checkDurationKeys = map[string]bool{
+	"deregister_critical_service_after": true,
+	"deregistercriticalserviceafter":    true,
+	"interval":                          true,
+	"timeout":                           true,
+	"ttl":                               true,
+}
+
+// fixupFlexibleDurations translates the durations in the raw JSON
+// configuration which are given as a number of seconds into duration
+// strings, including the durations of the service and check definitions.
+// It returns the keys which were translated.
+func fixupFlexibleDurations(raw map[string]interface{}) []string {
+	keys := fixupDurations(mergeFieldsForConfig(), reflect.TypeOf(Config{}), raw)
+	return append(keys, fixupDefinitionDurations(raw)...)
+}
+
+// fixupDefinitionDurations translates the durations of the service and
+// check definitions in raw. They are decoded by FixupCheckType, which
+// takes numbers as nanoseconds like the HTTP API does, so numbers of
+// seconds must be translated before.
+func fixupDefinitionDurations(raw map[string]interface{}) []string {
+	var keys []string
+	check := func(prefix string, obj map[string]interface{}) {
+		for _, k := range sortedConfigKeys(obj) {
+			if !checkDurationKeys[strings.ToLower(k)] {
+				continue
+			}
+			if s, ok := secondsDuration(obj[k]); ok {
+				obj[k] = s
+				keys = append(keys, prefix+k)
+			}
+		}
+	}
+	service := func(prefix string, obj map[string]interface{}) {
+		for _, k := range sortedConfigKeys(obj) {
+			if name := strings.ToLower(k); name == "check" || name == "checks" {
+				eachConfigObject(prefix+k, obj[k], check)
+			}
+		}
+	}
+	for _, k := range sortedConfigKeys(raw) {
+		switch k {
+		case "service", "services":
+			eachConfigObject(k, raw[k], service)
+		case "check", "checks":
+			eachConfigObject(k, raw[k], check)
+		}
+	}
+	return keys
+}
+
+// eachConfigObject calls fn with the key prefix of v and v if v is an
+// object, or with the prefix and object of each element if v is a list.
+func eachConfigObject(key string, v interface{}, fn func(prefix string, obj map[string]interface{})) {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		fn(key+".", x)
+	case []interface{}:
+		for i, elem := range x {
+			if obj, ok := elem.(map[string]interface{}); ok {
+				fn(fmt.Sprintf("%s[%d].", key, i), obj)
+			}
+		}
+	}
+}
+
+// sortedConfigKeys returns the keys of obj in lexical order.
+func sortedConfigKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var flexibleDurationType = reflect.TypeOf(FlexibleDuration(""))
+
+// fixupDurations translates the durations of the fields in the merge plan
+// of the struct type t which are set in raw, the object of the struct.
+func fixupDurations(fields []mergeField, t reflect.Type, raw map[string]interface{}) []string {
+	var keys []string
+	for _, f := range fields {
+		sf := t.Field(f.index)
+		if sf.Anonymous && f.kind == mergeStruct {
+			keys = append(keys, fixupDurations(f.fields, sf.Type, raw)...)
+			continue
+		}
+		name := f.key[strings.LastIndex(f.key, ".")+1:]
+		v, ok := raw[name]
+		if f.key == "" || !ok {
+			continue
+		}
+
+		switch {
+		case sf.Type == flexibleDurationType:
+			if s, ok := secondsDuration(v); ok {
+				raw[name] = s
+				keys = append(keys, f.key)
+			}
+
+		case sf.Type.Kind() == reflect.Map && sf.Type.Elem() == flexibleDurationType:
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			var subkeys []string
+			for k := range m {
+				subkeys = append(subkeys, k)
+			}
+			sort.Strings(subkeys)
+			for _, k := range subkeys {
+				if s, ok := secondsDuration(m[k]); ok {
+					m[k] = s
+					keys = append(keys, f.key+"."+k)
+				}
+			}
+
+		case f.kind == mergeStruct:
+			if sub, ok := v.(map[string]interface{}); ok {
+				keys = append(keys, fixupDurations(f.fields, sf.Type, sub)...)
+			}
+		}
+	}
+	return keys
+}
+
+// secondsDuration returns the duration string for a number of seconds.
+func secondsDuration(v interface{}) (string, bool) {
+	n, ok := v.(float64)
+	if !ok {
+		return "", false
+	}
+	return strconv.FormatFloat(n, 'f', -1, 64) + "s", true
+}
@@ -0,0 +1,104 @@
+package agent
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFixupFlexibleConfig(t *testing.T) {
+	t.Parallel()
+	var raw map[string]interface{}
+	in := `{"retry_join": "a", "start_join": ["b"], "recursors": "c", "client_addr": ["1.2.3.4", "::1"]}`
+	if err := json.Unmarshal([]byte(in), &raw); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	scalars := fixupFlexibleConfig(raw)
+	if got, want := scalars, []string{"recursors", "retry_join"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got scalars %v want %v", got, want)
+	}
+	want := map[string]interface{}{
+		"retry_join":  []interface{}{"a"},
+		"start_join":  []interface{}{"b"},
+		"recursors":   []interface{}{"c"},
+		"client_addr": "1.2.3.4 ::1",
+	}
+	if !reflect.DeepEqual(raw, want) {
+		t.Fatalf("got %#v want %#v", raw, want)
+	}
+}
+
+func TestFixupFlexibleDurations(t *testing.T) {
+	t.Parallel()
+	var raw map[string]interface{}
+	in := `{"acl_ttl": 30, "retry_interval": "2s", "dns_config": {"service_ttl": {"web": 5, "*": "1s"}}, "autopilot": {"last_contact_threshold": 0.2}}`
+	if err := json.Unmarshal([]byte(in), &raw); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	keys := fixupFlexibleDurations(raw)
+	if got, want := keys, []string{"dns_config.service_ttl.web", "autopilot.last_contact_threshold", "acl_ttl"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got keys %v want %v", got, want)
+	}
+	want := map[string]interface{}{
+		"acl_ttl":        "30s",
+		"retry_interval": "2s",
+		"dns_config":     map[string]interface{}{"service_ttl": map[string]interface{}{"web": "5s", "*": "1s"}},
+		"autopilot":      map[string]interface{}{"last_contact_threshold": "0.2s"},
+	}
+	if !reflect.DeepEqual(raw, want) {
+		t.Fatalf("got %#v want %#v", raw, want)
+	}
+}
+
+func TestFixupFlexibleDurations_definitions(t *testing.T) {
+	t.Parallel()
+	var raw map[string]interface{}
+	in := `{
+		"check": {"ttl": 30},
+		"checks": [{"interval": "10s"}, {"interval": 10, "timeout": 1.5}],
+		"service": {"name": "web", "check": {"interval": 10, "DeregisterCriticalServiceAfter": 60}},
+		"services": [{"name": "db", "checks": [{"ttl": "5s"}, {"deregister_critical_service_after": 90}]}]
+	}`
+	if err := json.Unmarshal([]byte(in), &raw); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	keys := fixupFlexibleDurations(raw)
+	want := []string{
+		"check.ttl",
+		"checks[1].interval",
+		"checks[1].timeout",
+		"service.check.DeregisterCriticalServiceAfter",
+		"service.check.interval",
+		"services[0].checks[1].deregister_critical_service_after",
+	}
+	if !reflect.DeepEqual(keys, want) {
+		t.Fatalf("got keys %v want %v", keys, want)
+	}
+}
+
+func TestDecodeConfig_definitionDurations(t *testing.T) {
+	t.Parallel()
+	in := `{"check": {"name": "c", "ttl": 30}, "service": {"name": "web", "check": {"script": "true", "interval": 10}}}`
+	c, err := DecodeConfig(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if got, want := c.Checks[0].TTL, 30*time.Second; got != want {
+		t.Fatalf("got ttl %v want %v", got, want)
+	}
+	if got, want := c.Services[0].Check.Interval, 10*time.Second; got != want {
+		t.Fatalf("got interval %v want %v", got, want)
+	}
+	want := []string{
+		`a number of seconds for check.ttl is deprecated. Please use a duration like "30s" instead`,
+		`a number of seconds for service.check.interval is deprecated. Please use a duration like "30s" instead`,
+	}
+	if !reflect.DeepEqual(c.Deprecations, want) {
+		t.Fatalf("got deprecations %v want %v", c.Deprecations, want)
+	}
+}
@@ -0,0 +1,90 @@
+package agent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// configFuncRe matches the ${env "NAME"} and ${file "path"} function calls
+// in configuration values. The argument is a double quoted string.
+var configFuncRe = regexp.MustCompile(`\$\{\s*(env|file)\s+("(?:[^"\\]|\\.)*")\s*\}`)
+
+// configFuncs are the functions which can be called in configuration
+// values by name.
+var configFuncs = map[string]func(arg string) (string, error){
+	"env": func(name string) (string, error) {
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %q is not set", name)
+		}
+		return v, nil
+	},
+	"file": func(path string) (string, error) {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(b)), nil
+	},
+}
+
+// interpolateConfigFuncs replaces the function calls in all string values
+// of the decoded JSON value v with their results, like ${env "HOSTNAME"}
+// with the value of the environment variable HOSTNAME and ${file "/etc/dc"}
+// with the contents of the file without surrounding whitespace.
+func interpolateConfigFuncs(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		var err error
+		s := configFuncRe.ReplaceAllStringFunc(v, func(call string) string {
+			if err != nil {
+				return call
+			}
+			m := configFuncRe.FindStringSubmatch(call)
+			arg, uerr := strconv.Unquote(m[2])
+			if uerr != nil {
+				err = fmt.Errorf("Failed to evaluate %s: invalid argument", call)
+				return call
+			}
+			result, ferr := configFuncs[m[1]](arg)
+			if ferr != nil {
+				err = fmt.Errorf("Failed to evaluate %s: %v", call, ferr)
+				return call
+			}
+			return result
+		})
+		return s, err
+	case []interface{}:
+		for i := range v {
+			e, err := interpolateConfigFuncs(v[i])
+			if err != nil {
+				return nil, err
+			}
+			v[i] = e
+		}
+	case map[string]interface{}:
+		for k := range v {
+			e, err := interpolateConfigFuncs(v[k])
+			if err != nil {
+				return nil, err
+			}
+			v[k] = e
+		}
+	}
+	return v, nil
+}
+
+// configFuncCallRe matches the start of a function call in an encoded
+// configuration document, in which the quotes of the argument may be
+// escaped.
+var configFuncCallRe = regexp.MustCompile(`\$\{\s*(env|file)\s`)
+
+// hasConfigFuncs returns true if the configuration document data calls
+// functions, whose results can change without the document changing.
+func hasConfigFuncs(data []byte) bool {
+	return configFuncCallRe.Match(data)
+}
@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/consul/testutil"
+	"github.com/pascaldekloe/goe/verify"
+)
+
+func TestInterpolateConfigFuncs(t *testing.T) {
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+	dcFile := filepath.Join(dir, "dc")
+	if err := ioutil.WriteFile(dcFile, []byte("dc3\n"), 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	os.Setenv("CONSUL_TEST_FUNC_NODE", "node-1")
+	defer os.Unsetenv("CONSUL_TEST_FUNC_NODE")
+
+	in := `{
+		"node_name": "${env \"CONSUL_TEST_FUNC_NODE\"}",
+		"datacenter": "${ file \"` + dcFile + `\" }",
+		"node_meta": {"name": "${env \"CONSUL_TEST_FUNC_NODE\"}-${env \"CONSUL_TEST_FUNC_NODE\"}"},
+		"retry_join": ["${env \"CONSUL_TEST_FUNC_NODE\"}.example.com", "${env NAME}"]
+	}`
+	c, err := decodeConfig(strings.NewReader(in), nil, false, true)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	verify.Values(t, "", []string{c.NodeName, c.Datacenter, c.Meta["name"]}, []string{"node-1", "dc3", "node-1-node-1"})
+	verify.Values(t, "retry_join", c.RetryJoin, []string{"node-1.example.com", "${env NAME}"})
+
+	// The calls are kept if the functions are disabled.
+	c, err = decodeConfig(strings.NewReader(in), nil, false, false)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if c.NodeName != `${env "CONSUL_TEST_FUNC_NODE"}` {
+		t.Fatalf("got node name %q", c.NodeName)
+	}
+
+	tests := []struct {
+		desc, in, err string
+	}{
+		{"unset variable", `{"node_name": "${env \"CONSUL_TEST_FUNC_MISSING\"}"}`, `environment variable "CONSUL_TEST_FUNC_MISSING" is not set`},
+		{"missing file", `{"datacenter": "${file \"` + filepath.Join(dir, "missing") + `\"}"}`, "Failed to evaluate ${file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			_, err := decodeConfig(strings.NewReader(tt.in), nil, false, true)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("got error %v want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestConfigBuilder_disableFunctions(t *testing.T) {
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+	os.Setenv("CONSUL_TEST_FUNC_NODE", "node-1")
+	defer os.Unsetenv("CONSUL_TEST_FUNC_NODE")
+	path := filepath.Join(dir, "node.hcl")
+	if err := ioutil.WriteFile(path, []byte(`node_name = "${env "CONSUL_TEST_FUNC_NODE"}"`), 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	cache := NewConfigCache()
+	b := &ConfigBuilder{Paths: []string{path}, Limits: DefaultConfigLimits(), Cache: cache}
+	c, _, err := b.Build()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if c.NodeName != "node-1" {
+		t.Fatalf("got node name %q", c.NodeName)
+	}
+
+	// Files calling functions are not cached since the results can change.
+	if cache.Len() != 0 {
+		t.Fatalf("got %d cached files", cache.Len())
+	}
+	os.Setenv("CONSUL_TEST_FUNC_NODE", "node-2")
+	if c, _, err = b.Build(); err != nil || c.NodeName != "node-2" {
+		t.Fatalf("got node name %q and error %v", c.NodeName, err)
+	}
+
+	b.DisableFunctions = true
+	b.Sources = []ConfigSource{{Name: "-hcl", Format: ConfigFormatHCL, Data: `node_meta { name = "${env "CONSUL_TEST_FUNC_NODE"}" }`}}
+	if c, _, err = b.Build(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	verify.Values(t, "", []string{c.NodeName, c.Meta["name"]},
+		[]string{`${env "CONSUL_TEST_FUNC_NODE"}`, `${env "CONSUL_TEST_FUNC_NODE"}`})
+}
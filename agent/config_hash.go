@@ -0,0 +1,109 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+)
+
+// volatileConfigFields are the fields of the configuration which are not
+// part of its hash since they hold state of the agent or of the files the
+// configuration was read from instead of settings.
+var volatileConfigFields = map[string]bool{
+	"ConsulConfig": true,
+	"WatchPlans":   true,
+	"Deprecations": true,
+	"Unset":        true,
+}
+
+// Hash returns a digest of the configuration which is equal for
+// configurations with the same settings, so that the running configuration
+// of an agent can be compared with the intended one. All settings are
+// included, including secrets and the settings which are not part of the
+// JSON encoding of the configuration.
+func (c *Config) Hash() string {
+	h := sha256.New()
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" || volatileConfigFields[f.Name] {
+			continue
+		}
+		fmt.Fprintf(h, "%s:", f.Name)
+		hashConfigValue(h, v.Field(i))
+		fmt.Fprint(h, ";")
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// hashConfigValue writes a canonical encoding of v to w. Map entries are
+// written in the order of their keys, pointers by the value they point to
+// and functions and channels not at all.
+func hashConfigValue(w io.Writer, v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			fmt.Fprint(w, "nil")
+			return
+		}
+		hashConfigValue(w, v.Elem())
+
+	case reflect.Struct:
+		t := v.Type()
+		fmt.Fprint(w, "{")
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).PkgPath != "" {
+				continue
+			}
+			fmt.Fprintf(w, "%s:", t.Field(i).Name)
+			hashConfigValue(w, v.Field(i))
+			fmt.Fprint(w, ",")
+		}
+		fmt.Fprint(w, "}")
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			fmt.Fprint(w, "nil")
+			return
+		}
+		fmt.Fprint(w, "[")
+		for i := 0; i < v.Len(); i++ {
+			hashConfigValue(w, v.Index(i))
+			fmt.Fprint(w, ",")
+		}
+		fmt.Fprint(w, "]")
+
+	case reflect.Map:
+		if v.IsNil() {
+			fmt.Fprint(w, "nil")
+			return
+		}
+		keys := make(map[string]reflect.Value)
+		var names []string
+		for _, k := range v.MapKeys() {
+			name := fmt.Sprint(k.Interface())
+			keys[name] = k
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprint(w, "{")
+		for _, name := range names {
+			fmt.Fprintf(w, "%q:", name)
+			hashConfigValue(w, v.MapIndex(keys[name]))
+			fmt.Fprint(w, ",")
+		}
+		fmt.Fprint(w, "}")
+
+	case reflect.String:
+		fmt.Fprintf(w, "%q", v.String())
+
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer, reflect.Invalid:
+
+	default:
+		fmt.Fprintf(w, "%v", v.Interface())
+	}
+}
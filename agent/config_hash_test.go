@@ -0,0 +1,47 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/hashicorp/consul/agent/structs"
+)
+
+func TestConfig_Hash(t *testing.T) {
+	t.Parallel()
+	base := func() *Config {
+		c := DefaultConfig()
+		c.NodeName = "a"
+		c.Meta = map[string]string{"a": "1", "b": "2", "c": "3"}
+		c.Services = []*structs.ServiceDefinition{&structs.ServiceDefinition{Name: "web", Port: 80}}
+		return c
+	}
+	want := base().Hash()
+	if got := base().Hash(); got != want {
+		t.Fatalf("equal configurations have different hashes %q and %q", got, want)
+	}
+
+	tests := []struct {
+		desc    string
+		modify  func(c *Config)
+		changed bool
+	}{
+		{"service port", func(c *Config) { c.Services[0].Port = 8080 }, true},
+		{"node meta", func(c *Config) { c.Meta["a"] = "x" }, true},
+		{"encrypt", func(c *Config) { c.EncryptKey = "pUqJrVyVRj5jsiYEkM/tFQ==" }, true},
+		{"dns port", func(c *Config) { c.Ports.DNS = 8653 }, true},
+		{"watch plans", func(c *Config) { c.WatchPlans = nil }, false},
+		{"deprecations", func(c *Config) { c.Deprecations = []string{"x"} }, false},
+		{"map order", func(c *Config) {
+			c.Meta = map[string]string{"c": "3", "b": "2", "a": "1"}
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			c := base()
+			tt.modify(c)
+			if got := c.Hash() != want; got != tt.changed {
+				t.Fatalf("got changed %v want %v", got, tt.changed)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package agent
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// ConfigChangeFunc is called after a reload replaced the running
+// configuration old with new. changed holds the configuration keys whose
+// values differ, with nested keys joined by dots like
+// "telemetry.prefix_filter". Both configurations are shared and must not
+// be modified.
+type ConfigChangeFunc func(old, new *Config, changed map[string]bool)
+
+// configHooks holds the functions registered with OnConfigChange.
+type configHooks struct {
+	sync.Mutex
+	nextID uint64
+	hooks  []configHook
+}
+
+type configHook struct {
+	id uint64
+	fn ConfigChangeFunc
+}
+
+// OnConfigChange registers fn to be called after every reload which
+// changes the running configuration. The functions are called in the order
+// in which they were registered, synchronously from ReloadConfig, so they
+// should not block. The returned function removes the registration.
+func (a *Agent) OnConfigChange(fn ConfigChangeFunc) func() {
+	a.configHooks.Lock()
+	defer a.configHooks.Unlock()
+
+	a.configHooks.nextID++
+	id := a.configHooks.nextID
+	a.configHooks.hooks = append(a.configHooks.hooks, configHook{id: id, fn: fn})
+	return func() {
+		a.configHooks.Lock()
+		defer a.configHooks.Unlock()
+		for i, h := range a.configHooks.hooks {
+			if h.id == id {
+				a.configHooks.hooks = append(a.configHooks.hooks[:i:i], a.configHooks.hooks[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// notifyConfigChange calls the registered functions if the configuration
+// changed from old to new.
+func (a *Agent) notifyConfigChange(old, new *Config) {
+	changed := ChangedConfigKeys(old, new)
+	if len(changed) == 0 {
+		return
+	}
+
+	a.configHooks.Lock()
+	hooks := make([]configHook, len(a.configHooks.hooks))
+	copy(hooks, a.configHooks.hooks)
+	a.configHooks.Unlock()
+
+	for _, h := range hooks {
+		h.fn(old, new, changed)
+	}
+}
+
+// ChangedConfigKeys returns the configuration keys whose values differ
+// between a and b. Nested blocks are compared field by field and their
+// keys are joined by dots. Values which are parsed from other keys, like
+// durations, are reported by the key they are parsed from. A changed
+// license file is reported as "license".
+func ChangedConfigKeys(a, b *Config) map[string]bool {
+	changed := make(map[string]bool)
+	changedConfigKeys(mergeFieldsForConfig(), reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem(), changed)
+	if a.License != b.License {
+		changed["license"] = true
+	}
+	return changed
+}
+
+// Diff returns the changes from c to other sorted by key. A change is
+// reloadable if ReloadConfig applies it to the running agent, otherwise it
+// only takes effect when the agent is restarted.
+func (c *Config) Diff(other *Config) []ConfigChange {
+	var keys []string
+	for key := range ChangedConfigKeys(c, other) {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var changes []ConfigChange
+	for _, key := range keys {
+		changes = append(changes, ConfigChange{Key: key, Reloadable: reloadableConfigKeys[key]})
+	}
+	return changes
+}
+
+// changedConfigKeys adds the keys of the fields in the merge plan whose
+// values differ between a and b to changed. Fields which are not set by a
+// key of their own are not compared, and parsed fields are compared in
+// place of their raw values.
+func changedConfigKeys(fields []mergeField, a, b reflect.Value, changed map[string]bool) {
+	raw := make(map[int]bool)
+	for _, f := range fields {
+		if f.raw >= 0 {
+			raw[f.raw] = true
+		}
+	}
+	for _, f := range fields {
+		if raw[f.index] {
+			continue
+		}
+		fa, fb := a.Field(f.index), b.Field(f.index)
+		switch f.kind {
+		case mergeStruct:
+			changedConfigKeys(f.fields, fa, fb, changed)
+			continue
+		case mergeStructPtr:
+			if !fa.IsNil() && !fb.IsNil() {
+				changedConfigKeys(f.fields, fa.Elem(), fb.Elem(), changed)
+				continue
+			}
+		}
+		if f.key == "" {
+			continue
+		}
+		if !reflect.DeepEqual(fa.Interface(), fb.Interface()) {
+			changed[f.key] = true
+		}
+	}
+}
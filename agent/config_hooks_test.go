@@ -0,0 +1,129 @@
+package agent
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/agent/structs"
+	"github.com/pascaldekloe/goe/verify"
+)
+
+func TestChangedConfigKeys(t *testing.T) {
+	t.Parallel()
+	a := DefaultConfig()
+	b := DefaultConfig()
+	if got := ChangedConfigKeys(a, b); len(got) != 0 {
+		t.Fatalf("got %v want no changes", got)
+	}
+
+	b.LogLevel = "DEBUG"
+	b.Ports.HTTP = 8501
+	b.Telemetry.PrefixFilter = []string{"-consul.http"}
+	b.HTTPConfig.ReadOnly = true
+	b.UnixSockets.Usr = "consul"
+	b.Services = []*structs.ServiceDefinition{&structs.ServiceDefinition{Name: "web"}}
+	b.License = "new"
+	b.ACLTTL, b.ACLTTLRaw = 10*time.Second, "10s"
+	want := map[string]bool{
+		"acl_ttl":                 true,
+		"license":                 true,
+		"log_level":               true,
+		"ports.http":              true,
+		"telemetry.prefix_filter": true,
+		"http_config.read_only":   true,
+		"unix_sockets.user":       true,
+		"services":                true,
+	}
+	verify.Values(t, "changed", ChangedConfigKeys(a, b), want)
+}
+
+func TestAgent_OnConfigChange(t *testing.T) {
+	t.Parallel()
+	a := NewTestAgent(t.Name(), nil)
+	defer a.Shutdown()
+
+	type call struct {
+		old, new *Config
+		changed  map[string]bool
+	}
+	var calls []call
+	var order []string
+	remove := a.OnConfigChange(func(old, new *Config, changed map[string]bool) {
+		calls = append(calls, call{old, new, changed})
+		order = append(order, "first")
+	})
+	a.OnConfigChange(func(old, new *Config, changed map[string]bool) {
+		order = append(order, "second")
+	})
+
+	old := a.RuntimeConfig()
+	cfg := TestConfig()
+	cfg.LogLevel = "WARN"
+	cfg.Meta = map[string]string{"rack": "r1"}
+	if err := a.ReloadConfig(cfg); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(calls) != 1 {
+		t.Fatalf("got %d calls want 1", len(calls))
+	}
+	if calls[0].old != old || calls[0].new != a.RuntimeConfig() {
+		t.Fatal("hook did not get the old and new configuration")
+	}
+	verify.Values(t, "changed", calls[0].changed, map[string]bool{"log_level": true, "node_meta": true})
+	verify.Values(t, "order", order, []string{"first", "second"})
+
+	// A reload which changes nothing does not call the hooks.
+	if err := a.ReloadConfig(cfg); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(order) != 2 {
+		t.Fatalf("got %v", order)
+	}
+
+	// Removed hooks are not called.
+	remove()
+	cfg.LogLevel = "ERR"
+	if err := a.ReloadConfig(cfg); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(calls) != 1 {
+		t.Fatalf("got %d calls want 1", len(calls))
+	}
+	verify.Values(t, "order", order, []string{"first", "second", "second"})
+}
+
+func TestConfig_Diff(t *testing.T) {
+	t.Parallel()
+	a := DefaultConfig()
+	b := DefaultConfig()
+	if got := a.Diff(b); len(got) != 0 {
+		t.Fatalf("got %v want no changes", got)
+	}
+
+	b.LogLevel = "DEBUG"
+	b.Ports.HTTP = 8501
+	b.Meta = map[string]string{"rack": "r1"}
+	want := []ConfigChange{
+		{Key: "log_level", Reloadable: true},
+		{Key: "node_meta", Reloadable: true},
+		{Key: "ports.http", Reloadable: false},
+	}
+	verify.Values(t, "diff", a.Diff(b), want)
+}
+
+func TestRestartConfigKeys(t *testing.T) {
+	t.Parallel()
+	cur := DefaultConfig()
+	cur.NodeID = "40e4a748-2192-161a-0510-9bf59fe950b5"
+
+	// The node ID generated by the agent is not a change.
+	next := DefaultConfig()
+	next.LogLevel = "DEBUG"
+	if got := restartConfigKeys(cur, next); len(got) != 0 {
+		t.Fatalf("got %v want no keys", got)
+	}
+
+	next.NodeID = "a8e9ab5a-3ab2-4f08-9b22-ea2fd87e23cd"
+	next.Ports.DNS = 8601
+	verify.Values(t, "keys", restartConfigKeys(cur, next), []string{"node_id", "ports.dns"})
+}
@@ -0,0 +1,48 @@
+package agent
+
+import (
+	"os"
+
+	"github.com/hashicorp/consul/agent/consul"
+)
+
+// kubernetesVarNames are the variables which are provided for
+// interpolation in Kubernetes mode. They are read from the environment
+// variables of the same name, which are usually set through the downward
+// API, e.g.
+//
+//	env:
+//	  - name: POD_IP
+//	    valueFrom:
+//	      fieldRef:
+//	        fieldPath: status.podIP
+var kubernetesVarNames = []string{"POD_IP", "POD_NAME", "POD_NAMESPACE", "NODE_NAME"}
+
+// KubernetesVars returns the variables which can be referenced as ${NAME}
+// in configuration files when the agent runs in Kubernetes mode.
+func KubernetesVars() map[string]string {
+	return kubernetesVars(os.LookupEnv)
+}
+
+// kubernetesVars returns the Kubernetes variables from lookup. POD_NAME
+// defaults to the hostname, which Kubernetes sets to the name of the pod,
+// and POD_IP to the private IP address of the pod.
+func kubernetesVars(lookup func(string) (string, bool)) map[string]string {
+	vars := make(map[string]string)
+	for _, name := range kubernetesVarNames {
+		if v, ok := lookup(name); ok && v != "" {
+			vars[name] = v
+		}
+	}
+	if _, ok := vars["POD_NAME"]; !ok {
+		if hostname, err := os.Hostname(); err == nil {
+			vars["POD_NAME"] = hostname
+		}
+	}
+	if _, ok := vars["POD_IP"]; !ok {
+		if ip, err := consul.GetPrivateIP(); err == nil {
+			vars["POD_IP"] = ip.String()
+		}
+	}
+	return vars
+}
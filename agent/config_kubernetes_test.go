@@ -0,0 +1,106 @@
+package agent
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/consul/testutil"
+)
+
+func TestKubernetesVars(t *testing.T) {
+	t.Parallel()
+	env := map[string]string{
+		"POD_IP":        "10.1.2.3",
+		"POD_NAME":      "consul-abcde",
+		"POD_NAMESPACE": "default",
+		"NODE_NAME":     "node-1",
+	}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+	if got := kubernetesVars(lookup); !reflect.DeepEqual(got, env) {
+		t.Fatalf("got %v want %v", got, env)
+	}
+
+	// The pod name and IP have defaults outside of a pod.
+	got := kubernetesVars(func(string) (string, bool) { return "", false })
+	if got["POD_NAME"] == "" {
+		t.Fatalf("bad: %v", got)
+	}
+	if _, ok := got["NODE_NAME"]; ok {
+		t.Fatalf("bad: %v", got)
+	}
+}
+
+// writeKubernetesVolume writes the files like the kubelet does for a
+// mounted ConfigMap: the files live in a timestamped directory which the
+// ..data symlink points to and the visible files are symlinks through
+// ..data. Updates atomically replace the ..data symlink.
+func writeKubernetesVolume(t *testing.T, dir, version string, files map[string]string) {
+	data := filepath.Join(dir, ".."+version)
+	if err := os.Mkdir(data, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(data, name), []byte(content), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		link := filepath.Join(dir, name)
+		if _, err := os.Lstat(link); os.IsNotExist(err) {
+			if err := os.Symlink(filepath.Join("..data", name), link); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+		}
+	}
+	tmp := filepath.Join(dir, "..data_tmp")
+	if err := os.Symlink(filepath.Base(data), tmp); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, "..data")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestConfigFiles_kubernetesVolume(t *testing.T) {
+	t.Parallel()
+	td := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(td)
+
+	writeKubernetesVolume(t, td, "v1", map[string]string{"config.json": `{"datacenter": "dc1"}`})
+	config, err := ReadConfigPaths([]string{td})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if config.Datacenter != "dc1" {
+		t.Fatalf("bad: %#v", config)
+	}
+
+	files := configFiles([]string{td})
+	if len(files) != 1 || files[0].size != int64(len(`{"datacenter": "dc1"}`)) {
+		t.Fatalf("bad: %#v", files)
+	}
+
+	hashes, err := ReadConfigFileHashes([]string{td})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	writeKubernetesVolume(t, td, "v2", map[string]string{"config.json": `{"datacenter": "dc2"}`})
+	current, err := ReadConfigFileHashes([]string{td})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if got, want := current.Changed(hashes), []string{filepath.Join(td, "config.json")}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v want %v", got, want)
+	}
+	config, err = ReadConfigPaths([]string{td})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if config.Datacenter != "dc2" {
+		t.Fatalf("bad: %#v", config)
+	}
+}
@@ -0,0 +1,117 @@
+package agent
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// ConfigLimits bounds the configuration files read by ReadConfigPaths so
+// that a malformed or malicious file cannot exhaust the memory of the agent
+// at startup. A zero value disables the respective limit.
+type ConfigLimits struct {
+	// MaxFileSize is the maximum size of a single file in bytes.
+	MaxFileSize int64
+
+	// MaxTotalSize is the maximum size of all files in bytes.
+	MaxTotalSize int64
+
+	// MaxDepth is the maximum nesting depth of JSON objects and arrays.
+	MaxDepth int
+}
+
+// DefaultConfigLimits returns the limits used unless configured otherwise.
+func DefaultConfigLimits() ConfigLimits {
+	return ConfigLimits{
+		MaxFileSize:  16 * 1024 * 1024,
+		MaxTotalSize: 512 * 1024 * 1024,
+		MaxDepth:     64,
+	}
+}
+
+// checkSizes rejects the files which exceed the file size limit or which
+// take the total size of the files beyond its limit.
+func (l ConfigLimits) checkSizes(files []*configFile) {
+	var total int64
+	for _, cf := range files {
+		if cf.err != nil {
+			continue
+		}
+		total += cf.size
+		switch {
+		case l.MaxFileSize > 0 && cf.size > l.MaxFileSize:
+			cf.err = fmt.Errorf("Error reading '%s': file is larger than the limit of %d bytes", cf.path, l.MaxFileSize)
+		case l.MaxTotalSize > 0 && total > l.MaxTotalSize:
+			cf.err = fmt.Errorf("Error reading '%s': configuration files are larger than the total limit of %d bytes", cf.path, l.MaxTotalSize)
+		}
+	}
+}
+
+// readConfigFileData reads the configuration file at path, failing as soon
+// as it grows beyond the file size limit. YAML files are returned as the
+// JSON document of the same configuration.
+func readConfigFileData(path string, limits ConfigLimits) ([]byte, error) {
+	return readConfigFileFormat(path, configFileFormat(path), limits)
+}
+
+// readConfigFileFormat works like readConfigFileData for a file in the
+// given format regardless of its extension.
+func readConfigFileFormat(path, format string, limits ConfigLimits) ([]byte, error) {
+	if format != ConfigFormatJSON && format != ConfigFormatYAML && format != ConfigFormatHCL {
+		return nil, fmt.Errorf("Error reading '%s': unknown configuration format %q", path, format)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading '%s': %s", path, err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if limits.MaxFileSize > 0 {
+		r = io.LimitReader(f, limits.MaxFileSize+1)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading '%s': %s", path, err)
+	}
+	if limits.MaxFileSize > 0 && int64(len(data)) > limits.MaxFileSize {
+		return nil, fmt.Errorf("Error reading '%s': file is larger than the limit of %d bytes", path, limits.MaxFileSize)
+	}
+	if data, err = configDataToJSON(format, data); err != nil {
+		return nil, fmt.Errorf("Error decoding '%s': %s", path, err)
+	}
+	return data, nil
+}
+
+// checkJSONDepth returns an error if the JSON objects and arrays in data are
+// nested deeper than max. It only scans for brackets outside of strings and
+// does not validate the document.
+func checkJSONDepth(data []byte, max int) error {
+	if max <= 0 {
+		return nil
+	}
+	depth, inString, escaped := 0, false, false
+	for _, c := range data {
+		switch {
+		case inString && escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case inString && c == '"':
+			inString = false
+		case inString:
+		case c == '"':
+			inString = true
+		case c == '{' || c == '[':
+			depth++
+			if depth > max {
+				return fmt.Errorf("nesting depth exceeds the limit of %d", max)
+			}
+		case c == '}' || c == ']':
+			depth--
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package agent
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/consul/testutil"
+)
+
+func TestCheckJSONDepth(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		json string
+		max  int
+		ok   bool
+	}{
+		{`{"a": 1}`, 1, true},
+		{`{"a": {"b": [1]}}`, 3, true},
+		{`{"a": {"b": [1]}}`, 2, false},
+		{`[[[[]]]]`, 3, false},
+		{`{"a": "{[{[{["}`, 1, true},
+		{`{"a": "\"{[{["}`, 1, true},
+		{`{"a": "\\", "b": {}}`, 1, false},
+		{`{"a": {"b": {}}}`, 0, true},
+	}
+	for _, tt := range tests {
+		err := checkJSONDepth([]byte(tt.json), tt.max)
+		if tt.ok != (err == nil) {
+			t.Errorf("%s with max %d: got %v", tt.json, tt.max, err)
+		}
+	}
+}
+
+func TestReadConfigPaths_limits(t *testing.T) {
+	t.Parallel()
+	td := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(td)
+
+	files := map[string]string{
+		"a.json": `{"node_name": "foo"}`,
+		"b.json": `{"service": {"name": "web", "tags": ["` + strings.Repeat("x", 100) + `"]}}`,
+		"c.json": `{"service": {"name": "db", "checks": [{"args": ["true"], "interval": "10s"}]}}`,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(td, name), []byte(content), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	tests := []struct {
+		desc   string
+		limits ConfigLimits
+		err    string
+	}{
+		{"defaults", DefaultConfigLimits(), ""},
+		{"disabled", ConfigLimits{}, ""},
+		{"file size", ConfigLimits{MaxFileSize: 100}, "b.json': file is larger than the limit of 100 bytes"},
+		{"total size", ConfigLimits{MaxTotalSize: 150}, "b.json': configuration files are larger than the total limit of 150 bytes"},
+		{"depth", ConfigLimits{MaxDepth: 3}, "c.json': nesting depth exceeds the limit of 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			_, err := readConfigPaths([]string{td}, 2, tt.limits, nil, nil)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("err: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("got error %v want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestReadConfigFileData_growing(t *testing.T) {
+	t.Parallel()
+	tf := testutil.TempFile(t, "consul")
+	tf.Write([]byte(`{"node_name": "foo"}`))
+	tf.Close()
+	defer os.Remove(tf.Name())
+
+	// A file which grew after it was listed is still rejected while it is
+	// read.
+	_, err := readConfigFileData(tf.Name(), ConfigLimits{MaxFileSize: 10})
+	if err == nil || !strings.Contains(err.Error(), "larger than the limit of 10 bytes") {
+		t.Fatalf("got error %v", err)
+	}
+}
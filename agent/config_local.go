@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/hcl"
+)
+
+// LocalConfigEnv is the environment variable which holds a complete
+// configuration document. It is merged after the configuration files and
+// before the command line flags, like in the official container images.
+const LocalConfigEnv = "CONSUL_LOCAL_CONFIG"
+
+// hclListKeys are the keys whose HCL blocks are decoded into lists even if
+// there is only one of them.
+var hclListKeys = map[string]bool{
+	"checks":   true,
+	"services": true,
+	"watches":  true,
+}
+
+// DecodeLocalConfig decodes the configuration document of the
+// CONSUL_LOCAL_CONFIG environment variable. Documents which start with '{'
+// are decoded as JSON and all others as HCL. The document is checked
+// against the limits and the given variables are interpolated like in
+// configuration files.
+func DecodeLocalConfig(data string, limits ConfigLimits, vars map[string]string) (*Config, error) {
+	return DecodeConfigSource(LocalConfigEnv, "", data, limits, vars)
+}
+
+// DecodeConfigSource decodes a configuration document which is not read
+// from a file, like a command line flag or an environment variable, in the
+// given format. If format is empty, documents which start with '{' are
+// decoded as JSON and all others as HCL. Errors name the source by name
+// like the errors of configuration files name the file.
+func DecodeConfigSource(name, format, data string, limits ConfigLimits, vars map[string]string) (*Config, error) {
+	return decodeConfigSource(name, format, data, limits, vars, true)
+}
+
+// decodeConfigSource works like DecodeConfigSource and evaluates the
+// function calls of the document only if funcs is set.
+func decodeConfigSource(name, format, data string, limits ConfigLimits, vars map[string]string, funcs bool) (*Config, error) {
+	if limits.MaxFileSize > 0 && int64(len(data)) > limits.MaxFileSize {
+		return nil, fmt.Errorf("Error decoding '%s': document is larger than the limit of %d bytes",
+			name, limits.MaxFileSize)
+	}
+
+	if format == "" {
+		format = ConfigFormatHCL
+		if strings.HasPrefix(strings.TrimSpace(data), "{") {
+			format = ConfigFormatJSON
+		}
+	}
+	b, err := configDataToJSON(format, []byte(data))
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding '%s': %s", name, err)
+	}
+	return decodeConfigData(name, b, limits, vars, false, funcs)
+}
+
+// hclToJSON translates an HCL configuration document into the JSON
+// document of the same configuration.
+func hclToJSON(data string) ([]byte, error) {
+	var raw map[string]interface{}
+	if err := hcl.Decode(&raw, data); err != nil {
+		return nil, err
+	}
+	return json.Marshal(flattenHCL(raw, ""))
+}
+
+// flattenHCL replaces the lists of objects which HCL decodes blocks into
+// with the single object they contain, except for the keys which hold lists.
+func flattenHCL(v interface{}, key string) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = flattenHCL(e, k)
+		}
+		return v
+	case []map[string]interface{}:
+		if len(v) == 1 && !hclListKeys[key] {
+			return flattenHCL(v[0], key)
+		}
+		list := make([]interface{}, len(v))
+		for i, e := range v {
+			list[i] = flattenHCL(e, "")
+		}
+		return list
+	case []interface{}:
+		for i, e := range v {
+			v[i] = flattenHCL(e, "")
+		}
+		return v
+	}
+	return v
+}
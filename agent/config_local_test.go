@@ -0,0 +1,94 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/consul/agent/structs"
+	"github.com/pascaldekloe/goe/verify"
+)
+
+func TestDecodeLocalConfig(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		desc string
+		in   string
+		c    *Config
+		err  string
+	}{
+		{
+			desc: "json",
+			in:   `{"node_name": "a", "node_meta": {"k": "v"}}`,
+			c:    &Config{NodeName: "a", Meta: map[string]string{"k": "v"}},
+		},
+		{
+			desc: "hcl",
+			in: `
+				node_name = "a"
+				retry_join = ["b", "c"]
+				node_meta {
+					k = "v"
+				}
+				ports {
+					dns = 8601
+				}`,
+			c: &Config{
+				NodeName:  "a",
+				RetryJoin: []string{"b", "c"},
+				Meta:      map[string]string{"k": "v"},
+				Ports:     PortConfig{DNS: 8601},
+			},
+		},
+		{
+			desc: "hcl services",
+			in: `
+				services {
+					name = "web"
+				}
+				service {
+					name = "db"
+				}`,
+			c: &Config{
+				Services: []*structs.ServiceDefinition{
+					&structs.ServiceDefinition{Name: "web"},
+					&structs.ServiceDefinition{Name: "db"},
+				},
+			},
+		},
+		{
+			desc: "vars",
+			in:   `node_name = "${NODE}"`,
+			c:    &Config{NodeName: "a"},
+		},
+		{
+			desc: "invalid key",
+			in:   `foo = "bar"`,
+			err:  "Error decoding 'CONSUL_LOCAL_CONFIG': Config has invalid keys: foo",
+		},
+		{
+			desc: "invalid hcl",
+			in:   `node_name = "a`,
+			err:  "Error decoding 'CONSUL_LOCAL_CONFIG': ",
+		},
+		{
+			desc: "size",
+			in:   `{"node_name": "` + strings.Repeat("x", 200) + `"}`,
+			err:  "Error decoding 'CONSUL_LOCAL_CONFIG': document is larger than the limit of 200 bytes",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			c, err := DecodeLocalConfig(tt.in, ConfigLimits{MaxFileSize: 200}, map[string]string{"NODE": "a"})
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			verify.Values(t, "", c, tt.c)
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package agent
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// mergeKind is the way MergeConfig merges a field of a configuration.
+type mergeKind int
+
+const (
+	// mergeSet replaces the value unless the merged value is the zero
+	// value. Booleans can therefore only be enabled by a later
+	// configuration, pointers are used where they need to be disabled.
+	mergeSet mergeKind = iota
+
+	// mergeAppend appends the merged slice.
+	mergeAppend
+
+	// mergeReplace replaces the slice unless the merged slice is empty.
+	mergeReplace
+
+	// mergeUnion adds the entries of the merged map, replacing existing
+	// keys.
+	mergeUnion
+
+	// mergeStruct merges the fields of a nested configuration block.
+	mergeStruct
+
+	// mergeStructPtr merges the fields of a nested configuration block
+	// referenced by pointer into a copy of the block, so that blocks
+	// which are not set are left nil.
+	mergeStructPtr
+
+	// mergeSkip ignores the field.
+	mergeSkip
+)
+
+// mergeTags maps the values of the merge struct tag to merge kinds. The
+// tag overrides the merge kind of a field, which is otherwise derived from
+// the type of the field.
+var mergeTags = map[string]mergeKind{
+	"set":     mergeSet,
+	"append":  mergeAppend,
+	"replace": mergeReplace,
+	"union":   mergeUnion,
+	"skip":    mergeSkip,
+}
+
+// mergeTagKind returns the merge kind given by the merge tag of a field
+// and whether the field has a tag. It panics if the tag is not known or
+// does not fit the type of the field since the merge plan is derived from
+// the struct definitions and cannot be fixed by configuration.
+func mergeTagKind(t reflect.Type, sf reflect.StructField) (mergeKind, bool) {
+	tag, ok := sf.Tag.Lookup("merge")
+	if !ok {
+		return mergeSet, false
+	}
+	kind, ok := mergeTags[tag]
+	switch {
+	case !ok:
+		panic(fmt.Sprintf("agent: unknown merge policy %q for %s.%s", tag, t.Name(), sf.Name))
+	case kind == mergeAppend || kind == mergeReplace:
+		ok = sf.Type.Kind() == reflect.Slice
+	case kind == mergeUnion:
+		ok = sf.Type.Kind() == reflect.Map
+	}
+	if !ok {
+		panic(fmt.Sprintf("agent: merge policy %q cannot be used for %s.%s of type %s", tag, t.Name(), sf.Name, sf.Type))
+	}
+	return kind, true
+}
+
+// mergeField describes how a single field is merged.
+type mergeField struct {
+	name  string
+	index int
+	kind  mergeKind
+
+	// key is the dotted configuration key of the field, like "ports.dns",
+	// or empty if the field is not set by a key of its own.
+	key string
+
+	// raw is the index of the string field holding the unparsed value of
+	// a parsed field, e.g. ACLTTLRaw for ACLTTL, or -1. A parsed field is
+	// also merged when it is the zero value but its raw value is set.
+	raw int
+
+	// fields describes the fields of a nested configuration block.
+	fields []mergeField
+}
+
+var (
+	configMergeFieldsOnce sync.Once
+	configMergeFields     []mergeField
+)
+
+// mergeFieldsForConfig returns the merge plan for Config which is derived
+// from the struct once and then cached.
+func mergeFieldsForConfig() []mergeField {
+	configMergeFieldsOnce.Do(func() {
+		configMergeFields = newMergeFields(reflect.TypeOf(Config{}), "", "")
+	})
+	return configMergeFields
+}
+
+// newMergeFields returns the merge plan for the exported fields of the
+// given struct type. Structs declared in this package and pointers to them
+// are configuration blocks and are merged field by field, so that new
+// blocks and fields are merged without code of their own.
+func newMergeFields(t reflect.Type, prefix, keyPrefix string) []mergeField {
+	var fields []mergeField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		f := mergeField{name: prefix + sf.Name, index: i, raw: -1}
+		switch key := strings.Split(sf.Tag.Get("mapstructure"), ",")[0]; {
+		case t == reflect.TypeOf(Config{}) && sf.Name == "Services":
+			f.key = "services"
+		case t == reflect.TypeOf(Config{}) && sf.Name == "Checks":
+			f.key = "checks"
+		case sf.Anonymous:
+			f.key = strings.TrimSuffix(keyPrefix, ".")
+		case key == "-":
+		case key == "":
+			f.key = keyPrefix + strings.ToLower(sf.Name)
+		default:
+			f.key = keyPrefix + key
+		}
+		if raw, ok := t.FieldByName(sf.Name + "Raw"); ok && len(raw.Index) == 1 && raw.Type.Kind() == reflect.String {
+			f.raw = raw.Index[0]
+
+			// Parsed fields are set by the key of their raw value.
+			if key := strings.Split(raw.Tag.Get("mapstructure"), ",")[0]; f.key == "" && key != "" && key != "-" {
+				f.key = keyPrefix + key
+			}
+		}
+
+		kind, ok := mergeTagKind(t, sf)
+		switch {
+		case ok:
+			f.kind = kind
+		case sf.Type.Kind() == reflect.Slice:
+			f.kind = mergeAppend
+		case sf.Type.Kind() == reflect.Map:
+			f.kind = mergeUnion
+		case sf.Type.Kind() == reflect.Struct && sf.Type.PkgPath() == t.PkgPath():
+			f.kind = mergeStruct
+		case sf.Type.Kind() == reflect.Ptr && sf.Type.Elem().Kind() == reflect.Struct && sf.Type.Elem().PkgPath() == t.PkgPath():
+			f.kind = mergeStructPtr
+		default:
+			f.kind = mergeSet
+		}
+		switch f.kind {
+		case mergeStruct, mergeStructPtr:
+			nested := f.key + "."
+			if sf.Anonymous {
+				nested = keyPrefix
+			}
+			st := sf.Type
+			if st.Kind() == reflect.Ptr {
+				st = st.Elem()
+			}
+			f.fields = newMergeFields(st, f.name+".", nested)
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// mergeFields merges the fields of b into result according to the plan.
+// Slices and maps are copied so that result never shares them with b. If
+// prov is not nil, source is recorded for the keys of the merged fields.
+func mergeFields(fields []mergeField, result, b reflect.Value, source string, prov Provenance) {
+	for _, f := range fields {
+		dst, src := result.Field(f.index), b.Field(f.index)
+		switch f.kind {
+		case mergeSet:
+			if src.IsZero() && (f.raw < 0 || b.Field(f.raw).String() == "") {
+				continue
+			}
+			dst.Set(src)
+
+		case mergeAppend:
+			if src.Len() == 0 {
+				continue
+			}
+			s := reflect.MakeSlice(dst.Type(), 0, dst.Len()+src.Len())
+			dst.Set(reflect.AppendSlice(reflect.AppendSlice(s, dst), src))
+
+		case mergeReplace:
+			if src.Len() == 0 {
+				continue
+			}
+			dst.Set(reflect.AppendSlice(reflect.MakeSlice(src.Type(), 0, src.Len()), src))
+
+		case mergeUnion:
+			if src.Len() == 0 {
+				continue
+			}
+			m := reflect.MakeMapWithSize(dst.Type(), dst.Len()+src.Len())
+			for _, k := range dst.MapKeys() {
+				m.SetMapIndex(k, dst.MapIndex(k))
+			}
+			for _, k := range src.MapKeys() {
+				m.SetMapIndex(k, src.MapIndex(k))
+			}
+			dst.Set(m)
+
+		case mergeStruct:
+			mergeFields(f.fields, dst, src, source, prov)
+			continue
+
+		case mergeStructPtr:
+			if src.IsNil() {
+				continue
+			}
+			v := reflect.New(dst.Type().Elem())
+			if !dst.IsNil() {
+				v.Elem().Set(dst.Elem())
+			}
+			mergeFields(f.fields, v.Elem(), src.Elem(), source, prov)
+			dst.Set(v)
+			continue
+
+		default:
+			continue
+		}
+		if prov != nil && f.key != "" {
+			prov[f.key] = source
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package agent
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pascaldekloe/goe/verify"
+)
+
+// fillValue sets v to a non-zero value. Nested configuration blocks are
+// filled recursively, other structs are left zero unless referenced by
+// pointer.
+func fillValue(v reflect.Value, pkgPath string) {
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(1)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(1)
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(1)
+	case reflect.String:
+		v.SetString("x")
+	case reflect.Interface:
+		if reflect.TypeOf("").AssignableTo(v.Type()) {
+			v.Set(reflect.ValueOf("x"))
+		}
+	case reflect.Ptr:
+		v.Set(reflect.New(v.Type().Elem()))
+		if v.Type().Elem().Kind() != reflect.Struct || v.Type().Elem().PkgPath() == pkgPath {
+			fillValue(v.Elem(), pkgPath)
+		}
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+		fillValue(v.Index(0), pkgPath)
+	case reflect.Map:
+		k, e := reflect.New(v.Type().Key()).Elem(), reflect.New(v.Type().Elem()).Elem()
+		fillValue(k, pkgPath)
+		fillValue(e, pkgPath)
+		v.Set(reflect.MakeMap(v.Type()))
+		v.SetMapIndex(k, e)
+	case reflect.Struct:
+		if v.Type().PkgPath() != pkgPath {
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath == "" {
+				fillValue(v.Field(i), pkgPath)
+			}
+		}
+	}
+}
+
+// checkMergeFields verifies that every field of b was merged into result
+// unless it is skipped.
+func checkMergeFields(t *testing.T, fields []mergeField, result, b reflect.Value) {
+	for _, f := range fields {
+		got, want := result.Field(f.index), b.Field(f.index)
+		switch f.kind {
+		case mergeStruct:
+			checkMergeFields(t, f.fields, got, want)
+		case mergeStructPtr:
+			if got.IsNil() {
+				t.Errorf("field %s is not merged", f.name)
+			} else if got.Pointer() == want.Pointer() {
+				t.Errorf("field %s shares its block with the merged configuration", f.name)
+			} else {
+				checkMergeFields(t, f.fields, got.Elem(), want.Elem())
+			}
+		case mergeSkip:
+			if !got.IsZero() {
+				t.Errorf("skipped field %s was merged", f.name)
+			}
+		default:
+			if want.IsZero() {
+				t.Errorf("field %s was not filled, extend fillValue", f.name)
+			} else if !reflect.DeepEqual(got.Interface(), want.Interface()) {
+				t.Errorf("field %s is not merged", f.name)
+			}
+		}
+	}
+}
+
+func TestMergeConfig_allFields(t *testing.T) {
+	t.Parallel()
+	var b Config
+	pkgPath := reflect.TypeOf(b).PkgPath()
+	fillValue(reflect.ValueOf(&b).Elem(), pkgPath)
+
+	result := MergeConfig(&Config{}, &b)
+	checkMergeFields(t, mergeFieldsForConfig(), reflect.ValueOf(result).Elem(), reflect.ValueOf(&b).Elem())
+}
+
+func TestMergeConfig_policies(t *testing.T) {
+	t.Parallel()
+	type block struct {
+		Tags  []string          `merge:"replace"`
+		Meta  map[string]string `merge:"union"`
+		Name  string            `merge:"skip"`
+		Addrs []string
+	}
+	fields := newMergeFields(reflect.TypeOf(block{}), "", "")
+	var got []mergeKind
+	for _, f := range fields {
+		got = append(got, f.kind)
+	}
+	want := []mergeKind{mergeReplace, mergeUnion, mergeSkip, mergeAppend}
+	verify.Values(t, "", got, want)
+
+	// A policy which is unknown or does not fit the type of the field is
+	// a programming error.
+	tests := []struct {
+		desc string
+		typ  interface{}
+	}{
+		{"unknown policy", struct {
+			Tags []string `merge:"prepend"`
+		}{}},
+		{"append to map", struct {
+			Meta map[string]string `merge:"append"`
+		}{}},
+		{"union of slice", struct {
+			Tags []string `merge:"union"`
+		}{}},
+		{"replace string", struct {
+			Name string `merge:"replace"`
+		}{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("should panic")
+				}
+			}()
+			newMergeFields(reflect.TypeOf(tt.typ), "", "")
+		})
+	}
+}
+
+func TestMergeConfig_structPtr(t *testing.T) {
+	t.Parallel()
+	type limits struct {
+		Max   int
+		Names []string
+	}
+	type block struct {
+		Name   string
+		Limits *limits `mapstructure:"limits"`
+	}
+	fields := newMergeFields(reflect.TypeOf(block{}), "", "")
+	if fields[1].kind != mergeStructPtr {
+		t.Fatalf("got merge kind %v want %v", fields[1].kind, mergeStructPtr)
+	}
+
+	merge := func(a, b block) (block, Provenance) {
+		prov := make(Provenance)
+		mergeFields(fields, reflect.ValueOf(&a).Elem(), reflect.ValueOf(&b).Elem(), "b", prov)
+		return a, prov
+	}
+
+	// Blocks which are not set stay nil.
+	got, _ := merge(block{Name: "a"}, block{Name: "b"})
+	if got.Limits != nil {
+		t.Fatalf("got %v want nil", got.Limits)
+	}
+
+	a := block{Limits: &limits{Max: 1, Names: []string{"a"}}}
+	b := block{Limits: &limits{Names: []string{"b"}}}
+	got, prov := merge(a, b)
+	verify.Values(t, "", got.Limits, &limits{Max: 1, Names: []string{"a", "b"}})
+	verify.Values(t, "", prov, Provenance{"limits.names": "b"})
+
+	// The merged block must be a copy.
+	if got.Limits == a.Limits || got.Limits == b.Limits {
+		t.Fatal("merged block shares storage with its inputs")
+	}
+	if len(a.Limits.Names) != 1 {
+		t.Fatalf("a was modified: %v", a.Limits)
+	}
+}
+
+func TestMergeConfig_kinds(t *testing.T) {
+	t.Parallel()
+	a := &Config{
+		NodeName:        "a",
+		Server:          true,
+		StartJoin:       []string{"1.1.1.1"},
+		Meta:            map[string]string{"a": "1", "b": "1"},
+		ACLTTL:          30 * time.Second,
+		ACLTTLRaw:       "30s",
+		Telemetry:       Telemetry{DogStatsdTags: []string{"a"}, StatsdAddr: "a"},
+		EncryptKey:      "key",
+		TaggedAddresses: map[string]string{"lan": "1.1.1.1"},
+		RetryJoinWan:    []string{},
+		TLSMinVersion:   "tls12",
+	}
+	b := &Config{
+		NodeName:  "b",
+		StartJoin: []string{"2.2.2.2"},
+		Meta:      map[string]string{"b": "2", "c": "2"},
+		ACLTTLRaw: "0s",
+		Telemetry: Telemetry{DogStatsdTags: []string{"b"}},
+	}
+	want := &Config{
+		NodeName:        "b",
+		Server:          true,
+		StartJoin:       []string{"1.1.1.1", "2.2.2.2"},
+		Meta:            map[string]string{"a": "1", "b": "2", "c": "2"},
+		ACLTTL:          0,
+		ACLTTLRaw:       "0s",
+		Telemetry:       Telemetry{DogStatsdTags: []string{"b"}, StatsdAddr: "a"},
+		EncryptKey:      "key",
+		TaggedAddresses: map[string]string{"lan": "1.1.1.1"},
+		RetryJoinWan:    []string{},
+		TLSMinVersion:   "tls12",
+	}
+	got := MergeConfig(a, b)
+	verify.Values(t, "", got, want)
+
+	// The merged configuration must not share maps with its inputs.
+	got.Meta["d"] = "3"
+	if _, ok := a.Meta["d"]; ok {
+		t.Fatal("merged map shares storage with a")
+	}
+	if strings.Join(a.StartJoin, ",") != "1.1.1.1" {
+		t.Fatalf("a was modified: %v", a.StartJoin)
+	}
+}
@@ -0,0 +1,273 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	discover "github.com/hashicorp/go-discover"
+)
+
+// LegacyConfigChange describes a legacy configuration key which was
+// translated or removed by MigrateLegacyConfig.
+type LegacyConfigChange struct {
+	// Key is the dotted path of the legacy key.
+	Key string
+
+	// NewKey is the dotted path of the key the value was moved to. It is
+	// empty if the key has no equivalent and was removed.
+	NewKey string
+}
+
+// legacyConfigKey describes how a legacy configuration key is translated.
+// migrate returns the value for newKey given the legacy value and the
+// current value of newKey, which is nil if it is not set. If migrate is
+// nil the legacy value is used unless newKey is already set.
+type legacyConfigKey struct {
+	key     string
+	newKey  string
+	migrate func(old, cur interface{}) interface{}
+}
+
+// legacyConfigKeys lists the configuration keys which were renamed or
+// removed. Keys without a newKey have no equivalent.
+var legacyConfigKeys = []legacyConfigKey{
+	{key: "addresses.rpc"},
+	{key: "atlas_acl_token"},
+	{key: "atlas_endpoint"},
+	{key: "atlas_infrastructure"},
+	{key: "atlas_join"},
+	{key: "atlas_token"},
+	{key: "dogstatsd_addr", newKey: "telemetry.dogstatsd_addr"},
+	{key: "dogstatsd_tags", newKey: "telemetry.dogstatsd_tags"},
+	{key: "http_api_response_headers", newKey: "http_config.response_headers", migrate: migrateMap},
+	{key: "non_voting_server", newKey: "read_replica"},
+	{key: "ports.rpc"},
+	{key: "recursor", newKey: "recursors", migrate: migrateAppend},
+	{key: "retry_join_azure", newKey: "retry_join", migrate: migrateRetryJoin("azure")},
+	{key: "retry_join_ec2", newKey: "retry_join", migrate: migrateRetryJoin("aws")},
+	{key: "retry_join_gce", newKey: "retry_join", migrate: migrateRetryJoin("gce")},
+	{key: "statsd_addr", newKey: "telemetry.statsd_address"},
+	{key: "statsite_addr", newKey: "telemetry.statsite_address"},
+	{key: "statsite_prefix", newKey: "telemetry.statsite_prefix"},
+}
+
+// MigrateLegacyConfig translates the legacy keys in the raw JSON
+// configuration to their replacements and removes the legacy keys which
+// have no equivalent. It returns the changes in the order they were made.
+func MigrateLegacyConfig(raw map[string]interface{}) []LegacyConfigChange {
+	var changes []LegacyConfigChange
+	for _, lk := range legacyConfigKeys {
+		old, ok := lookupConfigKey(raw, lk.key)
+		if !ok {
+			continue
+		}
+		deleteConfigKey(raw, lk.key)
+		changes = append(changes, LegacyConfigChange{Key: lk.key, NewKey: lk.newKey})
+		if lk.newKey == "" {
+			continue
+		}
+
+		cur, _ := lookupConfigKey(raw, lk.newKey)
+		v := old
+		switch {
+		case lk.migrate != nil:
+			v = lk.migrate(old, cur)
+		case cur != nil:
+			v = cur
+		}
+		if v != nil {
+			setConfigKey(raw, lk.newKey, v)
+		}
+	}
+	return changes
+}
+
+// MigratedConfigFile is a configuration file translated by
+// MigrateConfigFiles.
+type MigratedConfigFile struct {
+	// Path is the path of the source file.
+	Path string
+
+	// Raw is the translated configuration document.
+	Raw map[string]interface{}
+
+	// Changes are the legacy keys which were translated or removed.
+	Changes []LegacyConfigChange
+
+	// Rewritten are the keys whose values were rewritten from a
+	// deprecated form, like a single string in place of a list or a
+	// number of seconds in place of a duration.
+	Rewritten []string
+
+	// Err is set if the agent still rejects the translated document, e.g.
+	// because of unknown keys which have no translation.
+	Err error
+}
+
+// MigrateConfigFiles reads the configuration files at the given paths in
+// merge order and translates the legacy keys and the deprecated forms of
+// the values in every file. Each translated file is decoded like when it
+// is loaded by the agent, with the variables it declares set to their
+// defaults, and the error is recorded with the file.
+func MigrateConfigFiles(paths []string, limits ConfigLimits) ([]MigratedConfigFile, error) {
+	files := configFiles(paths)
+	limits.checkSizes(files)
+
+	var migrated []MigratedConfigFile
+	for _, cf := range files {
+		if cf.err != nil {
+			return nil, cf.err
+		}
+		data, err := readConfigFileData(cf.path, limits)
+		if err != nil {
+			return nil, err
+		}
+		var raw map[string]interface{}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("Error decoding '%s': %s", cf.path, err)
+		}
+
+		m := MigratedConfigFile{Path: cf.path, Raw: raw}
+		m.Changes = MigrateLegacyConfig(raw)
+		m.Rewritten = append(fixupFlexibleConfig(raw), fixupFlexibleDurations(raw)...)
+		m.Err = checkMigratedConfig(cf.path, raw, limits)
+		migrated = append(migrated, m)
+	}
+	return migrated, nil
+}
+
+// checkMigratedConfig decodes the translated document raw of the file at
+// path with the variables it declares set to their defaults, or to empty
+// strings if they have none.
+func checkMigratedConfig(path string, raw map[string]interface{}, limits ConfigLimits) error {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	decls := make(map[string]*ConfigVariable)
+	if err := decodeConfigVariables(path, data, decls); err != nil {
+		return err
+	}
+	vars := make(map[string]string)
+	for name, decl := range decls {
+		vars[configVarPrefix+name] = ""
+		if decl.Default != nil {
+			vars[configVarPrefix+name] = *decl.Default
+		}
+	}
+	_, err = decodeConfigData(path, data, limits, vars, false, false)
+	return err
+}
+
+// migrateMap merges the legacy map into the current one. The legacy values
+// take precedence like they did when they were translated on load.
+func migrateMap(old, cur interface{}) interface{} {
+	oldMap, ok := old.(map[string]interface{})
+	if !ok {
+		return old
+	}
+	m := make(map[string]interface{})
+	if curMap, ok := cur.(map[string]interface{}); ok {
+		for k, v := range curMap {
+			m[k] = v
+		}
+	}
+	for k, v := range oldMap {
+		m[k] = v
+	}
+	return m
+}
+
+// migrateAppend appends the legacy value to the current list.
+func migrateAppend(old, cur interface{}) interface{} {
+	var list []interface{}
+	switch v := cur.(type) {
+	case nil:
+	case []interface{}:
+		list = append(list, v...)
+	default:
+		list = append(list, v)
+	}
+	return append(list, old)
+}
+
+// migrateRetryJoin translates a legacy retry_join_<provider> block into a
+// go-discover configuration string and appends it to retry_join.
+func migrateRetryJoin(provider string) func(old, cur interface{}) interface{} {
+	return func(old, cur interface{}) interface{} {
+		block, ok := old.(map[string]interface{})
+		if !ok {
+			return old
+		}
+		cfg := discover.Config{"provider": provider}
+		for k, v := range block {
+			if s := fmt.Sprint(v); s != "" {
+				cfg[k] = s
+			}
+		}
+		if len(cfg) == 1 {
+			return cur
+		}
+		return migrateAppend(cfg.String(), cur)
+	}
+}
+
+// isLegacyConfigKey returns true if key is a legacy configuration key.
+func isLegacyConfigKey(key string) bool {
+	for _, lk := range legacyConfigKeys {
+		if lk.key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupConfigKey returns the value at the dotted path in raw.
+func lookupConfigKey(raw map[string]interface{}, key string) (interface{}, bool) {
+	parts := strings.Split(key, ".")
+	m := raw
+	for _, p := range parts[:len(parts)-1] {
+		sub, ok := m[p].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		m = sub
+	}
+	v, ok := m[parts[len(parts)-1]]
+	return v, ok
+}
+
+// setConfigKey sets the value at the dotted path in raw and creates the
+// missing parent objects.
+func setConfigKey(raw map[string]interface{}, key string, v interface{}) {
+	parts := strings.Split(key, ".")
+	m := raw
+	for _, p := range parts[:len(parts)-1] {
+		sub, ok := m[p].(map[string]interface{})
+		if !ok {
+			sub = make(map[string]interface{})
+			m[p] = sub
+		}
+		m = sub
+	}
+	m[parts[len(parts)-1]] = v
+}
+
+// deleteConfigKey removes the value at the dotted path in raw and the
+// parent objects which become empty.
+func deleteConfigKey(raw map[string]interface{}, key string) {
+	parts := strings.SplitN(key, ".", 2)
+	if len(parts) == 1 {
+		delete(raw, key)
+		return
+	}
+	sub, ok := raw[parts[0]].(map[string]interface{})
+	if !ok {
+		return
+	}
+	deleteConfigKey(sub, parts[1])
+	if len(sub) == 0 {
+		delete(raw, parts[0])
+	}
+}
@@ -0,0 +1,157 @@
+package agent
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/consul/testutil"
+	"github.com/pascaldekloe/goe/verify"
+)
+
+func TestMigrateLegacyConfig(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		desc    string
+		in      string
+		out     string
+		changes []LegacyConfigChange
+	}{
+		{
+			desc: "no legacy keys",
+			in:   `{"datacenter": "dc1", "ports": {"http": 1}}`,
+			out:  `{"datacenter": "dc1", "ports": {"http": 1}}`,
+		},
+		{
+			desc: "removed",
+			in:   `{"ports": {"rpc": 1, "http": 2}, "addresses": {"rpc": "a"}, "atlas_join": true, "atlas_token": "x"}`,
+			out:  `{"ports": {"http": 2}}`,
+			changes: []LegacyConfigChange{
+				{Key: "addresses.rpc"},
+				{Key: "atlas_join"},
+				{Key: "atlas_token"},
+				{Key: "ports.rpc"},
+			},
+		},
+		{
+			desc: "telemetry",
+			in:   `{"statsd_addr": "a", "statsite_addr": "b", "telemetry": {"statsite_address": "c"}}`,
+			out:  `{"telemetry": {"statsd_address": "a", "statsite_address": "c"}}`,
+			changes: []LegacyConfigChange{
+				{Key: "statsd_addr", NewKey: "telemetry.statsd_address"},
+				{Key: "statsite_addr", NewKey: "telemetry.statsite_address"},
+			},
+		},
+		{
+			desc: "recursor",
+			in:   `{"recursor": "a", "recursors": ["b"]}`,
+			out:  `{"recursors": ["b", "a"]}`,
+			changes: []LegacyConfigChange{
+				{Key: "recursor", NewKey: "recursors"},
+			},
+		},
+		{
+			desc: "non voting server",
+			in:   `{"non_voting_server": true}`,
+			out:  `{"read_replica": true}`,
+			changes: []LegacyConfigChange{
+				{Key: "non_voting_server", NewKey: "read_replica"},
+			},
+		},
+		{
+			desc: "response headers",
+			in:   `{"http_api_response_headers": {"a": "1", "b": "2"}, "http_config": {"response_headers": {"b": "3", "c": "4"}}}`,
+			out:  `{"http_config": {"response_headers": {"a": "1", "b": "2", "c": "4"}}}`,
+			changes: []LegacyConfigChange{
+				{Key: "http_api_response_headers", NewKey: "http_config.response_headers"},
+			},
+		},
+		{
+			desc: "retry join",
+			in: `{"retry_join": ["1.2.3.4"],
+				"retry_join_ec2": {"region": "us-east-1", "tag_key": "k", "tag_value": "v"},
+				"retry_join_gce": {"project_name": "p", "credentials_file": "/a b"},
+				"retry_join_azure": {}}`,
+			out: `{"retry_join": [
+				"1.2.3.4",
+				"provider=aws region=us-east-1 tag_key=k tag_value=v",
+				"provider=gce credentials_file=%2Fa+b project_name=p"]}`,
+			changes: []LegacyConfigChange{
+				{Key: "retry_join_azure", NewKey: "retry_join"},
+				{Key: "retry_join_ec2", NewKey: "retry_join"},
+				{Key: "retry_join_gce", NewKey: "retry_join"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			var in, out map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.in), &in); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if err := json.Unmarshal([]byte(tt.out), &out); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			changes := MigrateLegacyConfig(in)
+			if !reflect.DeepEqual(in, out) {
+				t.Fatalf("got %v want %v", in, out)
+			}
+			if !reflect.DeepEqual(changes, tt.changes) {
+				t.Fatalf("got changes %v want %v", changes, tt.changes)
+			}
+		})
+	}
+}
+
+func TestMigrateConfigFiles(t *testing.T) {
+	t.Parallel()
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+	for name, data := range map[string]string{
+		"a.json": `{"recursor": "8.8.8.8", "start_join": "1.2.3.4", "dns_config": {"max_stale": 5}}`,
+		"b.hcl":  `variable "dc" {} datacenter = "${var.dc}" ports { rpc = 8400 }`,
+		"c.yaml": "atlas_join: true\nnode_nmae: web\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0600); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	files, err := MigrateConfigFiles([]string{dir}, DefaultConfigLimits())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("got %d files want 3", len(files))
+	}
+
+	a := files[0]
+	verify.Values(t, "a changes", a.Changes, []LegacyConfigChange{{Key: "recursor", NewKey: "recursors"}})
+	verify.Values(t, "a rewritten", a.Rewritten, []string{"start_join", "dns_config.max_stale"})
+	verify.Values(t, "a raw", a.Raw, map[string]interface{}{
+		"recursors":  []interface{}{"8.8.8.8"},
+		"start_join": []interface{}{"1.2.3.4"},
+		"dns_config": map[string]interface{}{"max_stale": "5s"},
+	})
+	if a.Err != nil {
+		t.Fatalf("err: %v", a.Err)
+	}
+
+	// The variables are kept and the file is checked without values.
+	b := files[1]
+	verify.Values(t, "b changes", b.Changes, []LegacyConfigChange{{Key: "ports.rpc"}})
+	if b.Raw["datacenter"] != "${var.dc}" || b.Err != nil {
+		t.Fatalf("got datacenter %v and error %v", b.Raw["datacenter"], b.Err)
+	}
+
+	// Unknown keys have no translation.
+	c := files[2]
+	verify.Values(t, "c changes", c.Changes, []LegacyConfigChange{{Key: "atlas_join"}})
+	if c.Err == nil || !strings.Contains(c.Err.Error(), "node_nmae") {
+		t.Fatalf("got error %v want node_nmae", c.Err)
+	}
+}
@@ -0,0 +1,42 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// ReadNodeMetaFile reads the node metadata from the JSON or HCL file at
+// path. The file holds a single object whose values are strings, like the
+// node_meta block.
+func ReadNodeMetaFile(path string, limits ConfigLimits) (map[string]string, error) {
+	data, err := readConfigFileData(path, limits)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		if data, err = hclToJSON(string(data)); err != nil {
+			return nil, fmt.Errorf("Error decoding '%s': %s", path, err)
+		}
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("Error decoding '%s': %s", path, err)
+	}
+
+	var keys []string
+	for k := range raw {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	meta := make(map[string]string)
+	for _, k := range keys {
+		v, ok := raw[k].(string)
+		if !ok {
+			return nil, fmt.Errorf("Error decoding '%s': value of %q must be a string", path, k)
+		}
+		meta[k] = v
+	}
+	return meta, nil
+}
@@ -0,0 +1,200 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/consul/agent/structs"
+)
+
+// ConfigOverlayFile is the file in the data directory which holds the
+// configuration overlay last fetched from the servers, so that settings
+// which need a restart are applied when the agent starts.
+const ConfigOverlayFile = "config-overlay.json"
+
+// configOverlayAllowedKeys are the only keys an overlay can set. Anyone
+// with write access to the KV prefix can change the overlay, which is
+// applied by every agent at once, so only settings which cannot run code,
+// change the security of the agent or select the overlays are allowed.
+var configOverlayAllowedKeys = map[string]bool{
+	"dns_config":  true,
+	"log_level":   true,
+	"performance": true,
+	"telemetry":   true,
+}
+
+// ConfigOverlayDoc is a configuration document stored in the KV store
+// which applies to this agent.
+type ConfigOverlayDoc struct {
+	Key   string
+	Value []byte
+}
+
+// ConfigOverlayDocs are the configuration documents of an overlay in the
+// order in which they are merged.
+type ConfigOverlayDocs []ConfigOverlayDoc
+
+// ConfigOverlayKeys returns the KV keys below prefix which hold the
+// overlays for the agent with the given node name and metadata, in the
+// order in which they are merged: the default overlay, the overlays for
+// the node metadata sorted by key and the overlay for the node.
+func ConfigOverlayKeys(prefix, node string, meta map[string]string) []string {
+	var metaKeys []string
+	for k := range meta {
+		metaKeys = append(metaKeys, k)
+	}
+	sort.Strings(metaKeys)
+
+	keys := []string{path.Join(prefix, "default")}
+	for _, k := range metaKeys {
+		keys = append(keys, path.Join(prefix, "meta", k, meta[k]))
+	}
+	return append(keys, path.Join(prefix, "node", node))
+}
+
+// selectConfigOverlay returns the documents among the KV entries which are
+// stored at the given keys, in the order of the keys.
+func selectConfigOverlay(entries structs.DirEntries, keys []string) ConfigOverlayDocs {
+	byKey := make(map[string][]byte)
+	for _, e := range entries {
+		byKey[e.Key] = e.Value
+	}
+	var docs ConfigOverlayDocs
+	for _, k := range keys {
+		if v, ok := byKey[k]; ok {
+			docs = append(docs, ConfigOverlayDoc{Key: k, Value: v})
+		}
+	}
+	return docs
+}
+
+// Decode decodes the documents like configuration files, JSON or HCL, and
+// merges them in order. Documents which set a key that is not in
+// configOverlayAllowedKeys are rejected.
+func (d ConfigOverlayDocs) Decode(limits ConfigLimits) (*Config, error) {
+	result := &Config{}
+	for _, doc := range d {
+		if limits.MaxFileSize > 0 && int64(len(doc.Value)) > limits.MaxFileSize {
+			return nil, fmt.Errorf("Error decoding '%s': document is larger than the limit of %d bytes",
+				doc.Key, limits.MaxFileSize)
+		}
+		data := doc.Value
+		if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+			var err error
+			if data, err = hclToJSON(string(data)); err != nil {
+				return nil, fmt.Errorf("Error decoding '%s': %s", doc.Key, err)
+			}
+		}
+		var raw map[string]interface{}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("Error decoding '%s': %s", doc.Key, err)
+		}
+		var keys []string
+		for k := range raw {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if !configOverlayAllowedKeys[k] {
+				return nil, fmt.Errorf("Error decoding '%s': %s cannot be set by a configuration overlay", doc.Key, k)
+			}
+		}
+
+		c, err := decodeConfigData(doc.Key, data, limits, nil, false, false)
+		if err != nil {
+			return nil, err
+		}
+		result = MergeConfig(result, c)
+	}
+	return result, nil
+}
+
+// FetchConfigOverlay fetches the configuration overlay of the agent from
+// the KV store. If minIndex is set the call blocks until the overlays
+// change or the query times out. It returns the index to use for the next
+// call.
+func (a *Agent) FetchConfigOverlay(minIndex uint64) (ConfigOverlayDocs, uint64, error) {
+	cfg := a.RuntimeConfig()
+	args := structs.KeyRequest{
+		Datacenter: cfg.Datacenter,
+		Key:        strings.TrimSuffix(cfg.ConfigOverlay.Prefix, "/") + "/",
+		QueryOptions: structs.QueryOptions{
+			MinQueryIndex: minIndex,
+			AllowStale:    true,
+		},
+	}
+	args.Token = a.tokens.AgentToken()
+
+	var out structs.IndexedDirEntries
+	if err := a.RPC("KVS.List", &args, &out); err != nil {
+		return nil, 0, err
+	}
+	keys := ConfigOverlayKeys(cfg.ConfigOverlay.Prefix, cfg.NodeName, cfg.Meta)
+	return selectConfigOverlay(out.Entries, keys), out.Index, nil
+}
+
+// WriteConfigOverlayFile writes the configuration overlay to the data
+// directory, encrypted if data directory encryption is enabled.
+func (a *Agent) WriteConfigOverlayFile(docs ConfigOverlayDocs) error {
+	dataDir := a.RuntimeConfig().DataDir
+	if dataDir == "" {
+		return nil
+	}
+	encoded, err := json.Marshal(docs)
+	if err != nil {
+		return err
+	}
+	return a.writeDataFileAtomic(filepath.Join(dataDir, ConfigOverlayFile), encoded)
+}
+
+// ReadConfigOverlayFile reads the configuration overlay which was written
+// to the data directory by WriteConfigOverlayFile. It returns no documents
+// if there is none.
+func (c *Config) ReadConfigOverlayFile() (ConfigOverlayDocs, error) {
+	if c.DataDir == "" {
+		return nil, nil
+	}
+	file := filepath.Join(c.DataDir, ConfigOverlayFile)
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(data, encryptedFileHeader) {
+		// The key may be a secret reference which is not resolved yet.
+		enc := &Config{DataDirEncryption: c.DataDirEncryption}
+		if err := enc.ResolveSecretRefs(); err != nil {
+			return nil, err
+		}
+		key, err := enc.DataDirEncryptionKey()
+		if err != nil {
+			return nil, err
+		}
+		if key == nil {
+			return nil, fmt.Errorf("failed reading %q: file is encrypted but data_dir_encryption is not configured", file)
+		}
+		ddc, err := newDataDirCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = ddc.open(data); err != nil {
+			return nil, fmt.Errorf("failed reading %q: %v", file, err)
+		}
+	}
+
+	var docs ConfigOverlayDocs
+	if err := json.Unmarshal(data, &docs); err != nil {
+		return nil, fmt.Errorf("failed reading %q: %v", file, err)
+	}
+	return docs, nil
+}
@@ -0,0 +1,143 @@
+package agent
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/consul/testutil"
+	"github.com/pascaldekloe/goe/verify"
+)
+
+func TestConfigOverlayKeys(t *testing.T) {
+	t.Parallel()
+	got := ConfigOverlayKeys("fleet/config/", "node1", map[string]string{"rack": "r1", "env": "prod"})
+	want := []string{
+		"fleet/config/default",
+		"fleet/config/meta/env/prod",
+		"fleet/config/meta/rack/r1",
+		"fleet/config/node/node1",
+	}
+	verify.Values(t, "keys", got, want)
+}
+
+func TestConfigOverlayDocs_Decode(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		desc string
+		docs ConfigOverlayDocs
+		c    *Config
+		err  string
+	}{
+		{desc: "empty", c: &Config{}},
+		{
+			desc: "merged in order",
+			docs: ConfigOverlayDocs{
+				{Key: "default", Value: []byte(`{"log_level": "WARN", "telemetry": {"statsd_address": "10.0.0.1:8125"}}`)},
+				{Key: "node/node1", Value: []byte(`log_level = "DEBUG"`)},
+			},
+			c: &Config{LogLevel: "DEBUG", Telemetry: Telemetry{StatsdAddr: "10.0.0.1:8125"}},
+		},
+		{
+			desc: "syntax",
+			docs: ConfigOverlayDocs{{Key: "default", Value: []byte(`{"log_level": }`)}},
+			err:  "Error decoding 'default'",
+		},
+		{
+			desc: "denied",
+			docs: ConfigOverlayDocs{{Key: "default", Value: []byte(`{"node_meta": {"rack": "r2"}}`)}},
+			err:  "node_meta cannot be set by a configuration overlay",
+		},
+		{
+			desc: "not allowed",
+			docs: ConfigOverlayDocs{
+				{Key: "default", Value: []byte(`{"log_level": "WARN"}`)},
+				{Key: "node/node1", Value: []byte(`watches = [{type = "event", handler = "rm -rf /"}]`)},
+			},
+			err: "Error decoding 'node/node1': watches cannot be set by a configuration overlay",
+		},
+		{
+			desc: "tokens",
+			docs: ConfigOverlayDocs{{Key: "default", Value: []byte(`{"acl_token": "secret", "log_level": "WARN"}`)}},
+			err:  "acl_token cannot be set by a configuration overlay",
+		},
+		{
+			desc: "too large",
+			docs: ConfigOverlayDocs{{Key: "default", Value: bytes.Repeat([]byte(" "), 1025)}},
+			err:  "larger than the limit of 1024 bytes",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			limits := DefaultConfigLimits()
+			limits.MaxFileSize = 1024
+			c, err := tt.docs.Decode(limits)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			verify.Values(t, "config", c, tt.c)
+		})
+	}
+}
+
+func TestAgent_ConfigOverlay(t *testing.T) {
+	t.Parallel()
+	cfg := TestConfig()
+	cfg.NodeName = "node1"
+	cfg.Meta = map[string]string{"rack": "r1"}
+	cfg.ConfigOverlay.Prefix = "fleet/config"
+	cfg.DataDir = testutil.TempDir(t, "agent") // we manage the data dir
+	cfg.DataDirEncryption.Key = testDataDirKey
+	defer os.RemoveAll(cfg.DataDir)
+	a := NewTestAgent(t.Name(), cfg)
+	defer a.Shutdown()
+
+	setKV(t, a.Agent, "fleet/config/default", []byte(`{"log_level": "WARN"}`), "")
+	setKV(t, a.Agent, "fleet/config/meta/rack/r2", []byte(`{"log_level": "ERR"}`), "")
+	setKV(t, a.Agent, "fleet/config/node/node1", []byte(`{"log_level": "DEBUG"}`), "")
+	setKV(t, a.Agent, "fleet/config-other/default", []byte(`{}`), "")
+
+	docs, index, err := a.FetchConfigOverlay(0)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if index == 0 {
+		t.Fatal("expected an index")
+	}
+	want := ConfigOverlayDocs{
+		{Key: "fleet/config/default", Value: []byte(`{"log_level": "WARN"}`)},
+		{Key: "fleet/config/node/node1", Value: []byte(`{"log_level": "DEBUG"}`)},
+	}
+	verify.Values(t, "docs", docs, want)
+
+	// The overlay is encrypted in the data directory and read back.
+	if err := a.WriteConfigOverlayFile(docs); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	content, err := ioutil.ReadFile(filepath.Join(cfg.DataDir, ConfigOverlayFile))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !bytes.HasPrefix(content, encryptedFileHeader) || bytes.Contains(content, []byte("fleet/config")) {
+		t.Fatalf("overlay not encrypted: %q", content)
+	}
+	got, err := cfg.ReadConfigOverlayFile()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	verify.Values(t, "file", got, want)
+
+	cfg.DataDirEncryption.Key = ""
+	if _, err := cfg.ReadConfigOverlayFile(); err == nil || !strings.Contains(err.Error(), "data_dir_encryption is not configured") {
+		t.Fatalf("got error %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ConfigOverridesDir is the subdirectory of a configuration directory which
+// holds the override files for individual datacenters and hosts.
+const ConfigOverridesDir = "overrides"
+
+// ConfigOverrideFiles returns the override files in the overrides
+// directories of the given configuration directories which apply to the
+// datacenter and node name: overrides/dc-<datacenter> and
+// overrides/host-<node name> with any of the extensions of configuration
+// files. They are returned in merge order, the datacenter overrides of all
+// directories first so that the host overrides take precedence, and the
+// files of one directory with the same name in alphabetical order.
+func ConfigOverrideFiles(paths []string, datacenter, nodeName string) []string {
+	var dirs []string
+	for _, path := range ExpandConfigGlobs(paths) {
+		if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+			dirs = append(dirs, filepath.Join(path, ConfigOverridesDir))
+		}
+	}
+
+	var names []string
+	if datacenter != "" {
+		names = append(names, "dc-"+strings.ToLower(datacenter))
+	}
+	if nodeName != "" {
+		names = append(names, "host-"+nodeName)
+	}
+
+	var files []string
+	for _, name := range names {
+		// Names containing a path separator could point outside of the
+		// overrides directory.
+		if strings.ContainsAny(name, `/\`) {
+			continue
+		}
+		for _, dir := range dirs {
+			fis, err := ioutil.ReadDir(dir)
+			if err != nil {
+				continue
+			}
+			for _, fi := range fis {
+				base := strings.TrimSuffix(fi.Name(), filepath.Ext(fi.Name()))
+				if !fi.IsDir() && base == name && isConfigFileName(fi.Name()) {
+					files = append(files, filepath.Join(dir, fi.Name()))
+				}
+			}
+		}
+	}
+	return files
+}
+
+// ConfigOverrideSelectors returns the datacenter and node name which
+// select the override files, as set by the last of the given
+// configurations which sets them. The node name defaults to the hostname.
+func ConfigOverrideSelectors(configs ...*Config) (datacenter, nodeName string) {
+	for _, c := range configs {
+		if c == nil {
+			continue
+		}
+		if c.Datacenter != "" {
+			datacenter = c.Datacenter
+		}
+		if c.NodeName != "" {
+			nodeName = c.NodeName
+		}
+	}
+	if nodeName == "" {
+		nodeName, _ = os.Hostname()
+	}
+	return datacenter, strings.TrimSpace(nodeName)
+}
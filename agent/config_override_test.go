@@ -0,0 +1,113 @@
+package agent
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/consul/testutil"
+	"github.com/pascaldekloe/goe/verify"
+)
+
+func TestConfigOverrideFiles(t *testing.T) {
+	t.Parallel()
+	dir1 := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir1)
+	dir2 := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir2)
+
+	for _, file := range []string{
+		filepath.Join(dir1, ConfigOverridesDir, "dc-east.json"),
+		filepath.Join(dir1, ConfigOverridesDir, "host-web1.json"),
+		filepath.Join(dir1, ConfigOverridesDir, "host-web1.txt"),
+		filepath.Join(dir1, ConfigOverridesDir, "host-web2.json"),
+		filepath.Join(dir2, ConfigOverridesDir, "dc-east.json"),
+		filepath.Join(dir2, ConfigOverridesDir, "dc-west.yaml"),
+		filepath.Join(dir2, ConfigOverridesDir, "host-web3.hcl"),
+		filepath.Join(dir2, ConfigOverridesDir, "host-web3.yml"),
+	} {
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if err := ioutil.WriteFile(file, []byte(`{}`), 0600); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	cfgFile := filepath.Join(dir1, "config.json")
+	if err := ioutil.WriteFile(cfgFile, []byte(`{}`), 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	tests := []struct {
+		desc       string
+		paths      []string
+		datacenter string
+		nodeName   string
+		files      []string
+	}{
+		{
+			desc:       "dc and host",
+			paths:      []string{dir1, dir2},
+			datacenter: "EAST",
+			nodeName:   "web1",
+			files: []string{
+				filepath.Join(dir1, ConfigOverridesDir, "dc-east.json"),
+				filepath.Join(dir2, ConfigOverridesDir, "dc-east.json"),
+				filepath.Join(dir1, ConfigOverridesDir, "host-web1.json"),
+			},
+		},
+		{
+			desc:       "extensions",
+			paths:      []string{dir1, dir2},
+			datacenter: "west",
+			nodeName:   "web3",
+			files: []string{
+				filepath.Join(dir2, ConfigOverridesDir, "dc-west.yaml"),
+				filepath.Join(dir2, ConfigOverridesDir, "host-web3.hcl"),
+				filepath.Join(dir2, ConfigOverridesDir, "host-web3.yml"),
+			},
+		},
+		{
+			desc:       "missing",
+			paths:      []string{dir2},
+			datacenter: "north",
+			nodeName:   "web1",
+		},
+		{
+			desc:       "config file",
+			paths:      []string{cfgFile},
+			datacenter: "east",
+			nodeName:   "web1",
+		},
+		{
+			desc:       "path in node name",
+			paths:      []string{dir1},
+			datacenter: "west",
+			nodeName:   "../" + ConfigOverridesDir + "/host-web2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			files := ConfigOverrideFiles(tt.paths, tt.datacenter, tt.nodeName)
+			verify.Values(t, "files", files, tt.files)
+		})
+	}
+}
+
+func TestConfigOverrideSelectors(t *testing.T) {
+	t.Parallel()
+	dc, node := ConfigOverrideSelectors(DefaultConfig(), &Config{NodeName: "web1"}, nil, &Config{Datacenter: "east"})
+	if dc != "east" || node != "web1" {
+		t.Fatalf("got %q, %q", dc, node)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	dc, node = ConfigOverrideSelectors(DefaultConfig())
+	if dc != "dc1" || node != hostname {
+		t.Fatalf("got %q, %q", dc, node)
+	}
+}
@@ -0,0 +1,30 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// jsonErrorPosition adds the line and column to the syntax errors of
+// decoding the JSON document data, which only report the byte offset.
+// Other errors are returned as they are.
+func jsonErrorPosition(data []byte, err error) error {
+	serr, ok := err.(*json.SyntaxError)
+	if !ok {
+		return err
+	}
+	offset := serr.Offset
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+
+	// The offset is the position after the byte which failed.
+	before := data[:offset]
+	if offset > 0 {
+		before = data[:offset-1]
+	}
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := len(before) - bytes.LastIndex(before, []byte("\n"))
+	return fmt.Errorf("line %d, column %d: %s", line, col, err)
+}
@@ -0,0 +1,31 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestJSONErrorPosition(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		in, err string
+	}{
+		{"{\"a\": x}", "line 1, column 7: invalid character 'x' looking for beginning of value"},
+		{"{\n  \"a\": 1,\n  \"b\" 2\n}", "line 3, column 7: invalid character '2' after object key"},
+		{"{\n  \"a\": 1,\n}", "line 3, column 1: invalid character '}' looking for beginning of object key string"},
+	}
+	for _, tt := range tests {
+		var raw interface{}
+		err := json.NewDecoder(bytes.NewBufferString(tt.in)).Decode(&raw)
+		if got := jsonErrorPosition([]byte(tt.in), err); got == nil || got.Error() != tt.err {
+			t.Errorf("%q: got %v want %q", tt.in, got, tt.err)
+		}
+	}
+
+	other := errors.New("other")
+	if got := jsonErrorPosition(nil, other); got != other {
+		t.Fatalf("got %v want %v", got, other)
+	}
+}
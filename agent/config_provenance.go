@@ -0,0 +1,29 @@
+package agent
+
+import (
+	"sort"
+)
+
+// Provenance records which source supplied the value of each configuration
+// key, by the dotted key like "ports.dns". The sources are the paths of the
+// configuration files and the names of the other configuration sources,
+// see ConfigSource. Lists which are appended and maps which are merged
+// record the last source which added to them. Keys which are not recorded
+// have their default value.
+type Provenance map[string]string
+
+// Source returns the source which supplied the value of key, or an empty
+// string if the key has its default value.
+func (p Provenance) Source(key string) string {
+	return p[key]
+}
+
+// Keys returns the recorded keys in lexical order.
+func (p Provenance) Keys() []string {
+	keys := make([]string, 0, len(p))
+	for k := range p {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
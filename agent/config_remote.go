@@ -0,0 +1,197 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-rootcerts"
+)
+
+// remoteConfigTimeout bounds the time to fetch a remote configuration file.
+const remoteConfigTimeout = 30 * time.Second
+
+// IsConfigURL returns true if the configuration path is a URL of a remote
+// configuration file instead of a local path.
+func IsConfigURL(path string) bool {
+	p := strings.ToLower(path)
+	return strings.HasPrefix(p, "https://") || strings.HasPrefix(p, "http://")
+}
+
+// RemoteConfig fetches the configuration files given as https URLs, like
+// centrally hosted configurations, and writes them to a local directory so
+// that they are read like the other configuration files. A URL can pin the
+// file to a checksum with the checksum query parameter, like
+// "https://example.com/consul.json?checksum=sha256:<hex>", which is not
+// sent to the server. The format of a file is chosen by the extension of
+// the path of its URL.
+type RemoteConfig struct {
+	// Dir is the directory the fetched files are written to. If it is
+	// empty, a temporary directory is created by the first fetch and
+	// removed by Close.
+	Dir string
+
+	// CAFile is a PEM encoded bundle of the certificate authorities which
+	// are trusted to sign the certificates of the servers. The system
+	// roots are trusted if it is empty.
+	CAFile string
+
+	// Limits bounds the size of the fetched files.
+	Limits ConfigLimits
+
+	// urls maps the local paths of the fetched files to their URLs.
+	urls map[string]string
+
+	// tempDir is the temporary directory created for the files.
+	tempDir string
+}
+
+// Fetch fetches the files of the URLs among paths and returns paths with
+// the URLs replaced by the local paths of the files, so that the order of
+// the paths is kept. Files are fetched again by every call.
+func (r *RemoteConfig) Fetch(paths []string) ([]string, error) {
+	var client *http.Client
+	result := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if !IsConfigURL(p) {
+			result = append(result, p)
+			continue
+		}
+		if client == nil {
+			var err error
+			if client, err = r.client(); err != nil {
+				return nil, err
+			}
+			if r.Dir == "" {
+				if r.Dir, err = ioutil.TempDir("", "consul-config"); err != nil {
+					return nil, err
+				}
+				r.tempDir = r.Dir
+			}
+		}
+		local, err := r.fetch(client, p)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading '%s': %s", p, err)
+		}
+		if r.urls == nil {
+			r.urls = make(map[string]string)
+		}
+		r.urls[local] = p
+		result = append(result, local)
+	}
+	return result, nil
+}
+
+// Fetched returns true if path is the local path of a file fetched by the
+// last call to Fetch.
+func (r *RemoteConfig) Fetched(path string) bool {
+	_, ok := r.urls[path]
+	return ok
+}
+
+// Describe replaces the local paths of the fetched files in s, like an
+// error message, with their URLs.
+func (r *RemoteConfig) Describe(s string) string {
+	if len(r.urls) == 0 {
+		return s
+	}
+	var pairs []string
+	for local, u := range r.urls {
+		pairs = append(pairs, local, u)
+	}
+	return strings.NewReplacer(pairs...).Replace(s)
+}
+
+// client returns the HTTP client which verifies the servers with CAFile.
+func (r *RemoteConfig) client() (*http.Client, error) {
+	tlsConfig := &tls.Config{}
+	if err := rootcerts.ConfigureTLS(tlsConfig, &rootcerts.Config{CAFile: r.CAFile}); err != nil {
+		return nil, fmt.Errorf("Error reading '%s': %s", r.CAFile, err)
+	}
+	return &http.Client{
+		Timeout:   remoteConfigTimeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment},
+	}, nil
+}
+
+// fetch fetches the file at rawurl and returns the path it was written to.
+func (r *RemoteConfig) fetch(client *http.Client, rawurl string) (string, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "https" {
+		return "", fmt.Errorf("only https URLs are supported")
+	}
+
+	var checksum []byte
+	q := u.Query()
+	if v := q.Get("checksum"); v != "" {
+		if !strings.HasPrefix(v, "sha256:") {
+			return "", fmt.Errorf("checksum must be a sha256 checksum like \"sha256:<hex>\", got %q", v)
+		}
+		if checksum, err = hex.DecodeString(strings.TrimPrefix(v, "sha256:")); err != nil || len(checksum) != sha256.Size {
+			return "", fmt.Errorf("invalid sha256 checksum %q", v)
+		}
+		q.Del("checksum")
+		u.RawQuery = q.Encode()
+	}
+
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected response %s", resp.Status)
+	}
+
+	var body io.Reader = resp.Body
+	if r.Limits.MaxFileSize > 0 {
+		body = io.LimitReader(resp.Body, r.Limits.MaxFileSize+1)
+	}
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+	if r.Limits.MaxFileSize > 0 && int64(len(data)) > r.Limits.MaxFileSize {
+		return "", fmt.Errorf("file is larger than the limit of %d bytes", r.Limits.MaxFileSize)
+	}
+	if checksum != nil {
+		if sum := sha256.Sum256(data); string(sum[:]) != string(checksum) {
+			return "", fmt.Errorf("checksum mismatch, got sha256:%x", sum)
+		}
+	}
+
+	// The name keeps the extension which selects the format.
+	ext := path.Ext(u.Path)
+	if ext == "" {
+		ext = ".json"
+	}
+	id := sha256.Sum256([]byte(rawurl))
+	local := filepath.Join(r.Dir, hex.EncodeToString(id[:8])+ext)
+	if err := ioutil.WriteFile(local, data, 0600); err != nil {
+		return "", err
+	}
+	return local, nil
+}
+
+// Close removes the temporary directory of the fetched files.
+func (r *RemoteConfig) Close() error {
+	if r.tempDir == "" {
+		return nil
+	}
+	err := os.RemoveAll(r.tempDir)
+	r.Dir, r.tempDir, r.urls = "", "", nil
+	return err
+}
@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/consul/testutil"
+	"github.com/pascaldekloe/goe/verify"
+)
+
+func TestRemoteConfig_Fetch(t *testing.T) {
+	t.Parallel()
+	const doc = `{"node_name": "remote"}`
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("checksum") != "" {
+			t.Errorf("checksum was sent to the server")
+		}
+		switch r.URL.Path {
+		case "/consul.json", "/consul":
+			fmt.Fprint(w, doc)
+		case "/consul.hcl":
+			fmt.Fprint(w, `node_name = "hcl"`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, ca, 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	local := filepath.Join(dir, "local.json")
+	if err := ioutil.WriteFile(local, []byte(`{"datacenter": "dc2"}`), 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	r := &RemoteConfig{CAFile: caFile, Limits: DefaultConfigLimits()}
+	defer r.Close()
+	sum := sha256.Sum256([]byte(doc))
+	jsonURL := fmt.Sprintf("%s/consul.json?checksum=sha256:%x", srv.URL, sum)
+	hclURL := srv.URL + "/consul.hcl"
+	paths, err := r.Fetch([]string{jsonURL, local, hclURL})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(paths) != 3 || paths[1] != local || filepath.Ext(paths[2]) != ".hcl" {
+		t.Fatalf("got paths %v", paths)
+	}
+	c, err := ReadConfigPaths(paths)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	verify.Values(t, "", []string{c.NodeName, c.Datacenter}, []string{"hcl", "dc2"})
+	if got := r.Describe("Error decoding '" + paths[0] + "'"); got != "Error decoding '"+jsonURL+"'" {
+		t.Fatalf("got %q", got)
+	}
+
+	// The temporary directory is removed by Close.
+	tmp := r.Dir
+	if err := r.Close(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Fatalf("got %v want the directory to be removed", err)
+	}
+
+	tests := []struct {
+		desc, url, caFile, err string
+	}{
+		{"checksum mismatch", srv.URL + "/consul.json?checksum=sha256:" + strings.Repeat("00", 32), caFile, "checksum mismatch"},
+		{"bad checksum", srv.URL + "/consul.json?checksum=md5:00", caFile, "must be a sha256 checksum"},
+		{"http", "http://127.0.0.1/consul.json", caFile, "only https URLs are supported"},
+		{"not found", srv.URL + "/missing.json", caFile, "unexpected response 404"},
+		{"untrusted", srv.URL + "/consul", "", "certificate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			r := &RemoteConfig{CAFile: tt.caFile, Limits: DefaultConfigLimits()}
+			defer r.Close()
+			_, err := r.Fetch([]string{tt.url})
+			if err == nil || !strings.Contains(err.Error(), tt.err) || !strings.Contains(err.Error(), tt.url) {
+				t.Fatalf("got error %v want %q", err, tt.err)
+			}
+		})
+	}
+}
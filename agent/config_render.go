@@ -0,0 +1,151 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// RenderedConfigFile is a configuration file with all variables
+// interpolated, the legacy keys translated and the variable declarations
+// removed.
+type RenderedConfigFile struct {
+	// Path is the path of the source file.
+	Path string
+
+	// Raw is the rendered configuration document.
+	Raw map[string]interface{}
+}
+
+// RenderConfigFiles reads the configuration files at the given paths in
+// merge order and interpolates the variables into them. Every file is
+// validated like when it is loaded by the agent.
+func RenderConfigFiles(paths []string, limits ConfigLimits, vars map[string]string) ([]RenderedConfigFile, error) {
+	files := configFiles(paths)
+	limits.checkSizes(files)
+
+	var rendered []RenderedConfigFile
+	for _, cf := range files {
+		if cf.err != nil {
+			return nil, cf.err
+		}
+		data, err := readConfigFileData(cf.path, limits)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := decodeConfigData(cf.path, data, limits, vars, false, true); err != nil {
+			return nil, err
+		}
+
+		var raw map[string]interface{}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("Error decoding '%s': %s", cf.path, err)
+		}
+		raw = interpolateVars(raw, vars).(map[string]interface{})
+		delete(raw, "variable")
+		MigrateLegacyConfig(raw)
+		rendered = append(rendered, RenderedConfigFile{Path: cf.path, Raw: raw})
+	}
+	return rendered, nil
+}
+
+// MergeRenderedConfigFiles merges the rendered files into a single
+// configuration document. Objects are merged, lists are appended and later
+// values replace earlier ones. Since the agent does not let zero values
+// like false replace earlier values, the merged document is decoded and
+// compared with the merged configuration of the files, and an error is
+// returned if they differ.
+func MergeRenderedConfigFiles(files []RenderedConfigFile) (map[string]interface{}, error) {
+	merged := make(map[string]interface{})
+	want := new(Config)
+	for _, f := range files {
+		raw := deepCopyRaw(f.Raw).(map[string]interface{})
+		c, err := decodeRaw(raw)
+		if err != nil {
+			return nil, fmt.Errorf("Error decoding '%s': %s", f.Path, err)
+		}
+		want = MergeConfig(want, c)
+
+		// The single definitions are merged into the lists so that the
+		// definitions of all files are kept.
+		for single, list := range map[string]string{"service": "services", "check": "checks"} {
+			if v, ok := raw[single]; ok {
+				delete(raw, single)
+				raw[list] = append(toList(raw[list]), v)
+			}
+		}
+		mergeRaw(merged, raw)
+	}
+
+	got, err := decodeRaw(deepCopyRaw(merged).(map[string]interface{}))
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding the merged configuration: %s", err)
+	}
+	if !reflect.DeepEqual(MergeConfig(new(Config), got), want) {
+		return nil, fmt.Errorf("The files cannot be merged into a single file without " +
+			"changing the configuration, e.g. because a later file sets a boolean to false. " +
+			"Render the files individually instead.")
+	}
+	return merged, nil
+}
+
+// decodeRaw decodes a configuration document.
+func decodeRaw(raw map[string]interface{}) (*Config, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(raw); err != nil {
+		return nil, err
+	}
+	return DecodeConfig(&buf)
+}
+
+// mergeRaw merges the configuration document src into dst.
+func mergeRaw(dst, src map[string]interface{}) {
+	for k, v := range src {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if d, ok := dst[k].(map[string]interface{}); ok {
+				mergeRaw(d, v)
+				continue
+			}
+		case []interface{}:
+			if d, ok := dst[k].([]interface{}); ok {
+				dst[k] = append(d, v...)
+				continue
+			}
+		}
+		dst[k] = v
+	}
+}
+
+// toList returns v as a list.
+func toList(v interface{}) []interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return v
+	default:
+		return []interface{}{v}
+	}
+}
+
+// deepCopyRaw returns a copy of the decoded JSON value v which does not
+// share any objects or lists with v.
+func deepCopyRaw(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = deepCopyRaw(e)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, e := range v {
+			l[i] = deepCopyRaw(e)
+		}
+		return l
+	}
+	return v
+}
@@ -0,0 +1,69 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pascaldekloe/goe/verify"
+)
+
+func TestMergeRenderedConfigFiles(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		desc   string
+		files  []map[string]interface{}
+		merged map[string]interface{}
+		err    string
+	}{
+		{
+			desc: "merge",
+			files: []map[string]interface{}{
+				{"datacenter": "dc1", "retry_join": []interface{}{"a"}, "ports": map[string]interface{}{"dns": 8600.0}},
+				{"datacenter": "dc2", "retry_join": []interface{}{"b"}, "ports": map[string]interface{}{"http": 8500.0}},
+			},
+			merged: map[string]interface{}{
+				"datacenter": "dc2",
+				"retry_join": []interface{}{"a", "b"},
+				"ports":      map[string]interface{}{"dns": 8600.0, "http": 8500.0},
+			},
+		},
+		{
+			desc: "definitions",
+			files: []map[string]interface{}{
+				{"service": map[string]interface{}{"name": "a"}},
+				{"services": []interface{}{map[string]interface{}{"name": "b"}}, "check": map[string]interface{}{"name": "c", "ttl": "10s"}},
+			},
+			merged: map[string]interface{}{
+				"services": []interface{}{map[string]interface{}{"name": "a"}, map[string]interface{}{"name": "b"}},
+				"checks":   []interface{}{map[string]interface{}{"name": "c", "ttl": "10s"}},
+			},
+		},
+		{
+			desc: "zero value",
+			files: []map[string]interface{}{
+				{"server": true},
+				{"server": false},
+			},
+			err: "The files cannot be merged into a single file",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			var files []RenderedConfigFile
+			for _, raw := range tt.files {
+				files = append(files, RenderedConfigFile{Path: tt.desc, Raw: raw})
+			}
+			merged, err := MergeRenderedConfigFiles(files)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			verify.Values(t, "", merged, tt.merged)
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package agent
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/hashicorp/consul/agent/structs"
+	discover "github.com/hashicorp/go-discover"
+)
+
+// secretConfigKeys are the configuration keys whose values are secrets.
+var secretConfigKeys = map[string]bool{
+	"encrypt":                      true,
+	"acl_token":                    true,
+	"acl_agent_token":              true,
+	"acl_agent_master_token":       true,
+	"acl_master_token":             true,
+	"acl_replication_token":        true,
+	"data_dir_encryption.key":      true,
+	"telemetry.circonus_api_token": true,
+}
+
+// discoverSecretKeys are the keys of go-discover configurations whose
+// values are credentials.
+var discoverSecretKeys = []string{
+	"access_key_id",
+	"secret_access_key",
+	"subscription_id",
+	"tenant_id",
+	"client_id",
+	"credentials_file",
+	"username",
+	"api_key",
+}
+
+// Sanitized returns a copy of the configuration in which the secrets are
+// hidden, so that it can be logged or returned by the API. Besides the
+// values resolved from secret references and the keys of secrets, this
+// hides the credentials of the go-discover configurations of retry_join
+// and retry_join_wan and the tokens of services, checks and watches. The
+// copy shares the values which are not modified with the configuration.
+func (c *Config) Sanitized() *Config {
+	s := *c.redactSecretRefs()
+	walkConfigStrings(mergeFieldsForConfig(), reflect.ValueOf(&s).Elem(), func(name, v string) (string, error) {
+		switch {
+		case v == "":
+			return v, nil
+		case secretConfigKeys[name]:
+			return "hidden", nil
+		case strings.HasPrefix(name, "retry_join[") || strings.HasPrefix(name, "retry_join_wan["):
+			return sanitizeDiscoverConfig(v), nil
+		}
+		return v, nil
+	})
+
+	if len(c.Services) > 0 {
+		s.Services = make([]*structs.ServiceDefinition, len(c.Services))
+		for i, svc := range c.Services {
+			cp := *svc
+			if cp.Token != "" {
+				cp.Token = "hidden"
+			}
+			s.Services[i] = &cp
+		}
+	}
+	if len(c.Checks) > 0 {
+		s.Checks = make([]*structs.CheckDefinition, len(c.Checks))
+		for i, chk := range c.Checks {
+			cp := *chk
+			if cp.Token != "" {
+				cp.Token = "hidden"
+			}
+			s.Checks[i] = &cp
+		}
+	}
+	if len(c.Watches) > 0 {
+		s.Watches = make([]map[string]interface{}, len(c.Watches))
+		for i, params := range c.Watches {
+			cp := make(map[string]interface{}, len(params))
+			for k, v := range params {
+				cp[k] = v
+			}
+			if _, ok := cp["token"]; ok {
+				cp["token"] = "hidden"
+			}
+			s.Watches[i] = cp
+		}
+	}
+
+	// The compiled watch plans hold the tokens of the watches as well.
+	s.WatchPlans = nil
+	return &s
+}
+
+// sanitizeDiscoverConfig hides the credentials of a go-discover
+// configuration. Addresses are returned as they are.
+func sanitizeDiscoverConfig(addr string) string {
+	if !strings.Contains(addr, "provider=") {
+		return addr
+	}
+	cfg, err := discover.Parse(addr)
+	if err != nil {
+		return "hidden"
+	}
+	for _, k := range discoverSecretKeys {
+		if cfg[k] != "" {
+			cfg[k] = "hidden"
+		}
+	}
+	return cfg.String()
+}
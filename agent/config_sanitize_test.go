@@ -0,0 +1,47 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/hashicorp/consul/agent/structs"
+	"github.com/pascaldekloe/goe/verify"
+)
+
+func TestConfig_Sanitized(t *testing.T) {
+	t.Parallel()
+	c := DefaultConfig()
+	c.NodeName = "a"
+	c.EncryptKey = "pUqJrVyVRj5jsiYEkM/tFQ=="
+	c.ACLToken = "token"
+	c.ACLMasterToken = "master"
+	c.DataDirEncryption.Key = "key"
+	c.Telemetry.CirconusAPIToken = "circonus"
+	c.RetryJoin = []string{"10.0.0.1", "provider=aws tag_key=consul tag_value=server access_key_id=AKIA secret_access_key=s3cr3t"}
+	c.RetryJoinWan = []string{"provider=softlayer username=u api_key=k datacenter=dal06"}
+	c.Services = []*structs.ServiceDefinition{&structs.ServiceDefinition{Name: "web", Token: "svc"}}
+	c.Checks = []*structs.CheckDefinition{&structs.CheckDefinition{Name: "disk", Token: "chk"}}
+	c.Watches = []map[string]interface{}{{"type": "key", "key": "k", "token": "watch"}}
+
+	s := c.Sanitized()
+	verify.Values(t, "node_name", s.NodeName, "a")
+	verify.Values(t, "encrypt", s.EncryptKey, "hidden")
+	verify.Values(t, "acl_token", s.ACLToken, "hidden")
+	verify.Values(t, "acl_master_token", s.ACLMasterToken, "hidden")
+	verify.Values(t, "acl_agent_token", s.ACLAgentToken, "")
+	verify.Values(t, "data_dir_encryption.key", s.DataDirEncryption.Key, "hidden")
+	verify.Values(t, "telemetry.circonus_api_token", s.Telemetry.CirconusAPIToken, "hidden")
+	verify.Values(t, "retry_join", s.RetryJoin, []string{
+		"10.0.0.1",
+		"provider=aws access_key_id=hidden secret_access_key=hidden tag_key=consul tag_value=server",
+	})
+	verify.Values(t, "retry_join_wan", s.RetryJoinWan, []string{"provider=softlayer api_key=hidden datacenter=dal06 username=hidden"})
+	verify.Values(t, "service token", s.Services[0].Token, "hidden")
+	verify.Values(t, "check token", s.Checks[0].Token, "hidden")
+	verify.Values(t, "watch token", s.Watches[0]["token"], "hidden")
+
+	// The configuration itself is not modified.
+	verify.Values(t, "original encrypt", c.EncryptKey, "pUqJrVyVRj5jsiYEkM/tFQ==")
+	verify.Values(t, "original retry_join", c.RetryJoin[1], "provider=aws tag_key=consul tag_value=server access_key_id=AKIA secret_access_key=s3cr3t")
+	verify.Values(t, "original service token", c.Services[0].Token, "svc")
+	verify.Values(t, "original watch token", c.Watches[0]["token"], "watch")
+}
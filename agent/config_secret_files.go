@@ -0,0 +1,53 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+)
+
+// secretFileKeys are the secret configuration keys which can be read from
+// a file with the "_file" variant of the key, like acl_token_file for
+// acl_token. data_dir_encryption.key is not among them since it has a
+// key_file setting of its own.
+var secretFileKeys = []string{
+	"encrypt",
+	"acl_token",
+	"acl_agent_token",
+	"acl_agent_master_token",
+	"acl_master_token",
+	"acl_replication_token",
+	"telemetry.circonus_api_token",
+}
+
+// fixupSecretFiles replaces the "_file" variants of the secret keys in the
+// decoded configuration document with file secret references to the
+// files, so that the files are read, watched and hidden like the files of
+// other secret references.
+func fixupSecretFiles(obj map[string]interface{}) error {
+	for _, key := range secretFileKeys {
+		parent, name := obj, key
+		if i := strings.LastIndex(key, "."); i >= 0 {
+			m, ok := obj[key[:i]].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			parent, name = m, key[i+1:]
+		}
+		v, ok := parent[name+"_file"]
+		if !ok {
+			continue
+		}
+		path, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%s_file must be the path of a file, got %v", key, v)
+		}
+		if _, ok := parent[name]; ok {
+			return fmt.Errorf("%s and %s_file cannot both be set", key, key)
+		}
+		delete(parent, name+"_file")
+		if path != "" {
+			parent[name] = secretRefPrefix + "file://" + path
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package agent
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/consul/testutil"
+	"github.com/pascaldekloe/goe/verify"
+)
+
+func TestDecodeConfig_secretFiles(t *testing.T) {
+	t.Parallel()
+	in := `{
+		"acl_token_file": "/run/secrets/token",
+		"encrypt_file": "",
+		"telemetry": {"circonus_api_token_file": "/run/secrets/circonus"},
+		"data_dir_encryption": {"key_file": "/run/secrets/key"}
+	}`
+	c, err := DecodeConfig(bytes.NewBufferString(in))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	verify.Values(t, "acl_token", c.ACLToken, "ref+file:///run/secrets/token")
+	verify.Values(t, "encrypt", c.EncryptKey, "")
+	verify.Values(t, "circonus_api_token", c.Telemetry.CirconusAPIToken, "ref+file:///run/secrets/circonus")
+	verify.Values(t, "data_dir_encryption.key_file", c.DataDirEncryption.KeyFile, "/run/secrets/key")
+
+	tests := []struct {
+		in, err string
+	}{
+		{`{"acl_token": "a", "acl_token_file": "/a"}`, "acl_token and acl_token_file cannot both be set"},
+		{`{"acl_token_file": 1}`, "acl_token_file must be the path of a file"},
+		{`{"data_dir_encryption": {"key_file_file": "/a"}}`, "invalid keys"},
+	}
+	for _, tt := range tests {
+		_, err := DecodeConfig(bytes.NewBufferString(tt.in))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Fatalf("%s: got error %v want %q", tt.in, err, tt.err)
+		}
+	}
+}
+
+func TestConfigBuilder_secretFiles(t *testing.T) {
+	t.Parallel()
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+	token := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(token, []byte("secret\n"), 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	cfg := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(cfg, []byte(`{"acl_token_file": "`+token+`"}`), 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	b := &ConfigBuilder{Paths: []string{cfg}, Limits: DefaultConfigLimits()}
+	c, _, err := b.Build()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	verify.Values(t, "acl_token", c.ACLToken, "secret")
+	verify.Values(t, "sanitized", c.Sanitized().ACLToken, "hidden")
+}
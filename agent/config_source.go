@@ -0,0 +1,82 @@
+package agent
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// ConfigKeySource returns the path of the last configuration file at the
+// given paths which sets the top-level key, or an empty string if no file
+// sets it. Files which cannot be read are skipped since the agent already
+// reported them.
+func ConfigKeySource(paths []string, limits ConfigLimits, key string) string {
+	var src string
+	for _, cf := range configFiles(paths) {
+		if cf.err != nil {
+			continue
+		}
+		data, err := readConfigFileData(cf.path, limits)
+		if err != nil {
+			continue
+		}
+		if configDataHasKey(data, key) {
+			src = cf.path
+		}
+	}
+	return src
+}
+
+// ConfigKeyValue works like ConfigKeySource for the dotted path of a key,
+// like "ports.http", and also returns the value the file sets as decoded
+// from JSON.
+func ConfigKeyValue(paths []string, limits ConfigLimits, key string) (string, interface{}) {
+	var src string
+	var value interface{}
+	for _, cf := range configFiles(paths) {
+		if cf.err != nil {
+			continue
+		}
+		data, err := readConfigFileData(cf.path, limits)
+		if err != nil {
+			continue
+		}
+		var raw map[string]interface{}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			continue
+		}
+		if v, ok := lookupConfigKey(raw, key); ok {
+			src, value = cf.path, v
+		}
+	}
+	return src, value
+}
+
+// LocalConfigHasKey returns true if the CONSUL_LOCAL_CONFIG document sets
+// the top-level key.
+func LocalConfigHasKey(data, key string) bool {
+	b := []byte(data)
+	if !strings.HasPrefix(strings.TrimSpace(data), "{") {
+		var err error
+		if b, err = hclToJSON(data); err != nil {
+			return false
+		}
+	}
+	return configDataHasKey(b, key)
+}
+
+// ConfigEnvName returns the name of the CONSUL_<KEY> entry of the env file
+// which sets the top-level key.
+func ConfigEnvName(key string) string {
+	return envConfigPrefix + strings.ToUpper(key)
+}
+
+// configDataHasKey returns true if the JSON configuration document sets
+// the top-level key.
+func configDataHasKey(data []byte, key string) bool {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return false
+	}
+	_, ok := raw[key]
+	return ok
+}
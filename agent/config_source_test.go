@@ -0,0 +1,60 @@
+package agent
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/consul/testutil"
+)
+
+func TestConfigKeySource(t *testing.T) {
+	t.Parallel()
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"a.json": `{"server": true, "bootstrap": true}`,
+		"b.json": `{"bootstrap": false}`,
+		"c.json": `{"datacenter": "dc1"}`,
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0600); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"server", filepath.Join(dir, "a.json")},
+		{"bootstrap", filepath.Join(dir, "b.json")},
+		{"bootstrap_expect", ""},
+	}
+	for _, tt := range tests {
+		if got := ConfigKeySource([]string{dir}, DefaultConfigLimits(), tt.key); got != tt.want {
+			t.Fatalf("%s: got %q want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestLocalConfigHasKey(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		in   string
+		key  string
+		want bool
+	}{
+		{`{"bootstrap": true}`, "bootstrap", true},
+		{`{"bootstrap": true}`, "bootstrap_expect", false},
+		{`bootstrap_expect = 3`, "bootstrap_expect", true},
+		{`bootstrap_expect = "3`, "bootstrap_expect", false},
+	}
+	for _, tt := range tests {
+		if got := LocalConfigHasKey(tt.in, tt.key); got != tt.want {
+			t.Fatalf("%q %s: got %v want %v", tt.in, tt.key, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"sort"
+)
+
+// ConfigFileHashes maps the configuration files a configuration was loaded
+// from to the hashes of their contents.
+type ConfigFileHashes map[string][sha256.Size]byte
+
+// Hashes returns the hashes of the files read through the cache.
+func (c *ConfigCache) Hashes() ConfigFileHashes {
+	c.l.Lock()
+	defer c.l.Unlock()
+	hashes := make(ConfigFileHashes, len(c.files))
+	for path, cached := range c.files {
+		hashes[path] = cached.hash
+	}
+	return hashes
+}
+
+// ReadConfigFileHashes returns the hashes of the configuration files below
+// paths as they are currently on disk.
+func ReadConfigFileHashes(paths []string) (ConfigFileHashes, error) {
+	hashes := make(ConfigFileHashes)
+	for _, cf := range configFiles(paths) {
+		if cf.err != nil {
+			return nil, cf.err
+		}
+		data, err := readConfigFileData(cf.path, ConfigLimits{})
+		if err != nil {
+			return nil, err
+		}
+		hashes[cf.path] = sha256.Sum256(data)
+	}
+	return hashes, nil
+}
+
+// ChangedConfigFiles returns the configuration files below paths which were
+// added, removed or changed compared to hashes in lexical order.
+func ChangedConfigFiles(paths []string, hashes ConfigFileHashes) ([]string, error) {
+	current, err := ReadConfigFileHashes(paths)
+	if err != nil {
+		return nil, err
+	}
+	return current.Changed(hashes), nil
+}
+
+// Changed returns the files which were added, removed or changed in h
+// compared to old in lexical order.
+func (h ConfigFileHashes) Changed(old ConfigFileHashes) []string {
+	var changed []string
+	for path, hash := range h {
+		if oldHash, ok := old[path]; !ok || oldHash != hash {
+			changed = append(changed, path)
+		}
+	}
+	for path := range old {
+		if _, ok := h[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
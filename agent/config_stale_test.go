@@ -0,0 +1,60 @@
+package agent
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/consul/testutil"
+)
+
+func TestChangedConfigFiles(t *testing.T) {
+	t.Parallel()
+	td := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(td)
+
+	write := func(name, content string) string {
+		path := filepath.Join(td, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		return path
+	}
+	a := write("a.json", `{"datacenter": "dc1"}`)
+	b := write("b.json", `{"node_name": "foo"}`)
+	write("c.json", `{"log_level": "info"}`)
+
+	cache := NewConfigCache()
+	if _, err := cache.ReadConfigPaths([]string{td}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	hashes := cache.Hashes()
+
+	changed, err := ChangedConfigFiles([]string{td}, hashes)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(changed) != 0 {
+		t.Fatalf("got %v want no changes", changed)
+	}
+
+	// Change, remove and add a file.
+	write("a.json", `{"datacenter": "dc2"}`)
+	if err := os.Remove(b); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	d := write("d.json", `{}`)
+	changed, err = ChangedConfigFiles([]string{td}, hashes)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if want := []string{a, b, d}; !reflect.DeepEqual(changed, want) {
+		t.Fatalf("got %v want %v", changed, want)
+	}
+
+	if _, err := ChangedConfigFiles([]string{filepath.Join(td, "missing")}, hashes); err == nil {
+		t.Fatal("should have err")
+	}
+}
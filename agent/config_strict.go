@@ -0,0 +1,59 @@
+package agent
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// strictConfigBlocks are the configuration blocks whose unknown keys are
+// reported on their own together with the valid keys. A misspelled port or
+// address would otherwise leave the listener on its default, which is
+// hard to notice.
+var strictConfigBlocks = []string{"addresses", "ports"}
+
+// configBlockKeys returns the keys of the configuration block in lexical
+// order, without the key of the block.
+func configBlockKeys(block string) []string {
+	var keys []string
+	for _, f := range findMergeField(mergeFieldsForConfig(), block).fields {
+		if f.key != "" && f.raw < 0 {
+			keys = append(keys, strings.TrimPrefix(f.key, block+"."))
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// checkStrictConfigBlocks returns an error for the first unknown key of
+// the strict configuration blocks in the raw JSON configuration. Keys are
+// matched case-insensitively like they are decoded.
+func checkStrictConfigBlocks(raw map[string]interface{}) error {
+	for _, block := range strictConfigBlocks {
+		obj, ok := raw[block].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		valid := configBlockKeys(block)
+		var keys []string
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if !configBlockHasKey(valid, k) {
+				return fmt.Errorf("Unknown key %s.%s, valid keys are: %s", block, k, strings.Join(valid, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+func configBlockHasKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
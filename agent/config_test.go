@@ -5,17 +5,20 @@ import (
 	"crypto/tls"
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net"
 	"os"
 	"path/filepath"
 	"reflect"
+	"runtime"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/hashicorp/consul/agent/structs"
 	"github.com/hashicorp/consul/testutil"
+	multierror "github.com/hashicorp/go-multierror"
 	"github.com/pascaldekloe/goe/verify"
 )
 
@@ -61,6 +64,18 @@ func TestDecodeConfig(t *testing.T) {
 			in:  `{"bad": "no way jose"}`,
 			err: errors.New("Config has invalid keys: bad"),
 		},
+		{
+			in:  `{"ports": {"htttp": 8500}}`,
+			err: errors.New("Unknown key ports.htttp, valid keys are: dns, expose_max_port, expose_min_port, grpc, http, https, serf_lan, serf_wan, server, sidecar_max_port, sidecar_min_port"),
+		},
+		{
+			in:  `{"addresses": {"dns": "127.0.0.1", "rcp": "127.0.0.1"}}`,
+			err: errors.New("Unknown key addresses.rcp, valid keys are: dns, http, https"),
+		},
+		{
+			in: `{"ports": {"HTTP": 8500}}`,
+			c:  &Config{Ports: PortConfig{HTTP: 8500}},
+		},
 		{
 			in:               `{"advertise_addr":"unix:///path/to/file"}`,
 			parseTemplateErr: errors.New("Failed to parse Advertise address: unix:///path/to/file"),
@@ -155,7 +170,7 @@ func TestDecodeConfig(t *testing.T) {
 		},
 		{
 			in: `{"addresses":{"rpc":"a"}}`,
-			c:  &Config{Addresses: AddressConfig{RPC: "a"}},
+			c:  &Config{},
 		},
 		{
 			in: `{"advertise_addr":"1.2.3.4"}`,
@@ -202,23 +217,23 @@ func TestDecodeConfig(t *testing.T) {
 		},
 		{
 			in: `{"atlas_acl_token":"a"}`,
-			c:  &Config{DeprecatedAtlasACLToken: "a"},
+			c:  &Config{},
 		},
 		{
 			in: `{"atlas_endpoint":"a"}`,
-			c:  &Config{DeprecatedAtlasEndpoint: "a"},
+			c:  &Config{},
 		},
 		{
 			in: `{"atlas_infrastructure":"a"}`,
-			c:  &Config{DeprecatedAtlasInfrastructure: "a"},
+			c:  &Config{},
 		},
 		{
 			in: `{"atlas_join":true}`,
-			c:  &Config{DeprecatedAtlasJoin: true},
+			c:  &Config{},
 		},
 		{
 			in: `{"atlas_token":"a"}`,
-			c:  &Config{DeprecatedAtlasToken: "a"},
+			c:  &Config{},
 		},
 		{
 			in: `{"autopilot":{"cleanup_dead_servers":true}}`,
@@ -272,10 +287,22 @@ func TestDecodeConfig(t *testing.T) {
 			in: `{"ca_path":"a"}`,
 			c:  &Config{CAPath: "a"},
 		},
+		{
+			in: `{"check_deregister_interval_min":"10s"}`,
+			c:  &Config{CheckDeregisterIntervalMin: 10 * time.Second, CheckDeregisterIntervalMinRaw: "10s"},
+		},
+		{
+			in: `{"check_output_max_size":8192}`,
+			c:  &Config{CheckOutputMaxSize: 8192},
+		},
 		{
 			in: `{"check_update_interval":"2s"}`,
 			c:  &Config{CheckUpdateInterval: 2 * time.Second, CheckUpdateIntervalRaw: "2s"},
 		},
+		{
+			in: `{"config_stale_check_interval":"1m"}`,
+			c:  &Config{ConfigStaleCheckInterval: time.Minute, ConfigStaleCheckIntervalRaw: "1m"},
+		},
 		{
 			in: `{"cert_file":"a"}`,
 			c:  &Config{CertFile: "a"},
@@ -288,14 +315,47 @@ func TestDecodeConfig(t *testing.T) {
 			in: `{"client_addr":"{{\"1.2.3.4\"}}"}`,
 			c:  &Config{ClientAddr: "1.2.3.4"},
 		},
+		{
+			in: `{"client_addr":"1.2.3.4, 5.6.7.8"}`,
+			c:  &Config{ClientAddr: "1.2.3.4 5.6.7.8"},
+		},
+		{
+			in: `{"client_addr":"{{\"1.2.3.4 5.6.7.8\"}}"}`,
+			c:  &Config{ClientAddr: "1.2.3.4 5.6.7.8"},
+		},
+		{
+			in: `{"client_addr":["1.2.3.4","5.6.7.8"]}`,
+			c:  &Config{ClientAddr: "1.2.3.4 5.6.7.8"},
+		},
+		{
+			in: `{"addresses":{"http":["1.2.3.4","unix:///var/run/consul.sock"]}}`,
+			c:  &Config{Addresses: AddressConfig{HTTP: "1.2.3.4 unix:///var/run/consul.sock"}},
+		},
+		{
+			in:               `{"client_addr":"1.2.3.4 foo"}`,
+			c:                &Config{ClientAddr: "1.2.3.4 foo"},
+			parseTemplateErr: errors.New("Failed to parse Client address, \"foo\" is not a valid IP address or socket"),
+		},
 		{
 			in: `{"data_dir":"a"}`,
 			c:  &Config{DataDir: "a"},
 		},
+		{
+			in: `{"read_replica":true}`,
+			c:  &Config{ReadReplica: true},
+		},
+		{
+			in: `{"non_voting_server":true}`,
+			c:  &Config{ReadReplica: true},
+		},
 		{
 			in: `{"datacenter":"a"}`,
 			c:  &Config{Datacenter: "a"},
 		},
+		{
+			in: `{"deregister_critical_service_after":"72h"}`,
+			c:  &Config{DeregisterCriticalServiceAfter: 72 * time.Hour, DeregisterCriticalServiceAfterRaw: "72h"},
+		},
 		{
 			in: `{"disable_coordinates":true}`,
 			c:  &Config{DisableCoordinates: true},
@@ -337,7 +397,18 @@ func TestDecodeConfig(t *testing.T) {
 			c: &Config{
 				DNSConfig: DNSConfig{
 					ServiceTTL:    map[string]time.Duration{"*": 2 * time.Second, "a": 456 * time.Second},
-					ServiceTTLRaw: map[string]string{"*": "2s", "a": "456s"},
+					ServiceTTLRaw: map[string]FlexibleDuration{"*": "2s", "a": "456s"},
+				},
+			},
+		},
+		{
+			in: `{"dns_config":{"node_ttl":30,"service_ttl":{"*":1.5}}}`,
+			c: &Config{
+				DNSConfig: DNSConfig{
+					NodeTTL:       30 * time.Second,
+					NodeTTLRaw:    "30s",
+					ServiceTTL:    map[string]time.Duration{"*": 1500 * time.Millisecond},
+					ServiceTTLRaw: map[string]FlexibleDuration{"*": "1.5s"},
 				},
 			},
 		},
@@ -353,6 +424,10 @@ func TestDecodeConfig(t *testing.T) {
 			in: `{"disable_remote_exec":false}`,
 			c:  &Config{DisableRemoteExec: Bool(false)},
 		},
+		{
+			in: `{"allow_remote_exec_without_acls":true}`,
+			c:  &Config{AllowRemoteExecWithoutACLs: true},
+		},
 		{
 			in: `{"disable_update_check":true}`,
 			c:  &Config{DisableUpdateCheck: true},
@@ -381,14 +456,83 @@ func TestDecodeConfig(t *testing.T) {
 			in: `{"enable_syslog":true}`,
 			c:  &Config{EnableSyslog: true},
 		},
+		{
+			in: `{"enable_eventlog":true}`,
+			c:  &Config{EnableEventLog: true},
+		},
 		{
 			in: `{"disable_keyring_file":true}`,
 			c:  &Config{DisableKeyringFile: true},
 		},
+		{
+			in: `{"data_dir_encryption":{"key":"a2V5","key_file":"/tmp/key"}}`,
+			c:  &Config{DataDirEncryption: DataDirEncryption{Key: "a2V5", KeyFile: "/tmp/key"}},
+		},
+		{
+			in: `{"permissions":{"data_dir_mode":"0700","config_file_mode":"0640","secret_file_mode":"0400"}}`,
+			c:  &Config{Permissions: Permissions{DataDirMode: "0700", ConfigFileMode: "0640", SecretFileMode: "0400"}},
+		},
+		{
+			in: `{"strict_permissions":true}`,
+			c:  &Config{StrictPermissions: true},
+		},
+		{
+			in: `{"start_in_maintenance":true,"start_in_maintenance_reason":"rebuild"}`,
+			c:  &Config{StartInMaintenance: true, StartInMaintenanceReason: "rebuild"},
+		},
+		{
+			in: `{"gossip_key_rotation":{"interval":"720h","retain":2}}`,
+			c:  &Config{GossipKeyRotation: GossipKeyRotation{Interval: 720 * time.Hour, IntervalRaw: "720h", Retain: 2}},
+		},
+		{
+			in: `{"config_overlay":{"enabled":true,"prefix":"fleet/config"}}`,
+			c:  &Config{ConfigOverlay: ConfigOverlay{Enabled: true, Prefix: "fleet/config"}},
+		},
+		{
+			in: `{"audit":{"enabled":true,"sink":{"type":"file","path":"/tmp/audit.log","format":"text","rotate_bytes":1024,"rotate_duration":"24h","rotate_max_files":3}}}`,
+			c: &Config{Audit: Audit{Enabled: true, Sink: AuditSink{
+				Type:              "file",
+				Path:              "/tmp/audit.log",
+				Format:            "text",
+				RotateBytes:       1024,
+				RotateDuration:    24 * time.Hour,
+				RotateDurationRaw: "24h",
+				RotateMaxFiles:    3,
+			}}},
+		},
+		{
+			in: `{"check_defaults":{"http":{"timeout":"5s","tls_skip_verify":true,"headers":{"x-foo":["bar"]},"output_max_size":100}}}`,
+			c: &Config{CheckDefaults: CheckDefaults{HTTP: HTTPCheckDefaults{
+				Timeout:       5 * time.Second,
+				TimeoutRaw:    "5s",
+				TLSSkipVerify: true,
+				Headers:       map[string][]string{"x-foo": []string{"bar"}},
+				OutputMaxSize: 100,
+			}}},
+		},
+		{
+			in: `{"license_path":"a","reporting":{"export_address":"https://usage.example.com","interval":"2h"}}`,
+			c: &Config{
+				LicensePath: "a",
+				Reporting:   Reporting{ExportAddress: "https://usage.example.com", Interval: 2 * time.Hour, IntervalRaw: "2h"},
+			},
+		},
+		{
+			in: `{"enable_agent_tls_for_checks":true}`,
+			c:  &Config{EnableAgentTLSForChecks: true},
+		},
 		{
 			in: `{"enable_script_checks":true}`,
 			c:  &Config{EnableScriptChecks: true},
 		},
+		{
+			in: `{"enable_local_script_checks":true}`,
+			c:  &Config{EnableLocalScriptChecks: true},
+		},
+		{
+			in: `{"systemd_notify":true}`,
+			c:  &Config{SystemdNotify: true},
+		},
 		{
 			in: `{"encrypt_verify_incoming":true}`,
 			c:  &Config{EncryptVerifyIncoming: Bool(true)},
@@ -401,10 +545,22 @@ func TestDecodeConfig(t *testing.T) {
 			in: `{"http_config":{"block_endpoints":["a","b","c","d"]}}`,
 			c:  &Config{HTTPConfig: HTTPConfig{BlockEndpoints: []string{"a", "b", "c", "d"}}},
 		},
+		{
+			in: `{"http_config":{"allowed_client_subjects":["*.ops.example.com"]}}`,
+			c:  &Config{HTTPConfig: HTTPConfig{AllowedClientSubjects: []string{"*.ops.example.com"}}},
+		},
+		{
+			in: `{"http_config":{"read_only":true}}`,
+			c:  &Config{HTTPConfig: HTTPConfig{ReadOnly: true}},
+		},
 		{
 			in: `{"http_api_response_headers":{"a":"b","c":"d"}}`,
 			c:  &Config{HTTPConfig: HTTPConfig{ResponseHeaders: map[string]string{"a": "b", "c": "d"}}},
 		},
+		{
+			in: `{"http_api_response_headers":{"a":"b"},"http_config":{"response_headers":{"a":"x","c":"d"}}}`,
+			c:  &Config{HTTPConfig: HTTPConfig{ResponseHeaders: map[string]string{"a": "b", "c": "d"}}},
+		},
 		{
 			in: `{"http_config":{"response_headers":{"a":"b","c":"d"}}}`,
 			c:  &Config{HTTPConfig: HTTPConfig{ResponseHeaders: map[string]string{"a": "b", "c": "d"}}},
@@ -429,6 +585,18 @@ func TestDecodeConfig(t *testing.T) {
 			in: `{"node_meta":{"a":"b","c":"d"}}`,
 			c:  &Config{Meta: map[string]string{"a": "b", "c": "d"}},
 		},
+		{
+			in: `{"node_meta_limits":{"max_keys":100,"max_key_length":64,"max_value_length":1024}}`,
+			c:  &Config{NodeMetaLimits: NodeMetaLimits{MaxKeys: 100, MaxKeyLength: 64, MaxValueLength: 1024}},
+		},
+		{
+			in: `{"serf_lan_allowed_cidrs":["10.0.0.0/8"],"serf_wan_allowed_cidrs":["192.168.0.0/16","fd00::/8"]}`,
+			c:  &Config{SerfLANAllowedCIDRs: []string{"10.0.0.0/8"}, SerfWANAllowedCIDRs: []string{"192.168.0.0/16", "fd00::/8"}},
+		},
+		{
+			in: `{"node_meta_file":"a"}`,
+			c:  &Config{NodeMetaFile: "a"},
+		},
 		{
 			in: `{"node_name":"a"}`,
 			c:  &Config{NodeName: "a"},
@@ -437,14 +605,18 @@ func TestDecodeConfig(t *testing.T) {
 			in: `{"performance": { "raft_multiplier": 3 }}`,
 			c:  &Config{Performance: Performance{RaftMultiplier: 3}},
 		},
-		{
-			in:  `{"performance": { "raft_multiplier": 11 }}`,
-			err: errors.New("Performance.RaftMultiplier must be <= 10"),
-		},
 		{
 			in: `{"pid_file":"a"}`,
 			c:  &Config{PidFile: "a"},
 		},
+		{
+			in: `{"data_dir_filesystem_denylist":["nfs","fuse"]}`,
+			c:  &Config{DataDirFilesystemDenylist: []string{"nfs", "fuse"}},
+		},
+		{
+			in: `{"disable_pid_file_check":true}`,
+			c:  &Config{DisablePidFileCheck: true},
+		},
 		{
 			in: `{"ports":{"dns":1234}}`,
 			c:  &Config{Ports: PortConfig{DNS: 1234}},
@@ -457,6 +629,11 @@ func TestDecodeConfig(t *testing.T) {
 			in: `{"ports":{"https":1234}}`,
 			c:  &Config{Ports: PortConfig{HTTPS: 1234}},
 		},
+		{
+			in: `{"ports":{"grpc":8502,"sidecar_min_port":30000,"sidecar_max_port":30100,"expose_min_port":30200,"expose_max_port":30300}}`,
+			c: &Config{Ports: PortConfig{GRPC: 8502, SidecarMinPort: 30000, SidecarMaxPort: 30100,
+				ExposeMinPort: 30200, ExposeMaxPort: 30300}},
+		},
 		{
 			in: `{"ports":{"serf_lan":1234}}`,
 			c:  &Config{Ports: PortConfig{SerfLan: 1234}},
@@ -471,7 +648,7 @@ func TestDecodeConfig(t *testing.T) {
 		},
 		{
 			in: `{"ports":{"rpc":1234}}`,
-			c:  &Config{Ports: PortConfig{RPC: 1234}},
+			c:  &Config{},
 		},
 		{
 			in: `{"raft_protocol":3}`,
@@ -495,12 +672,20 @@ func TestDecodeConfig(t *testing.T) {
 		},
 		{
 			in: `{"recursor":"a"}`,
-			c:  &Config{DNSRecursor: "a", DNSRecursors: []string{"a"}},
+			c:  &Config{DNSRecursors: []string{"a"}},
 		},
 		{
 			in: `{"recursors":["a","b"]}`,
 			c:  &Config{DNSRecursors: []string{"a", "b"}},
 		},
+		{
+			in: `{"recursors":"a"}`,
+			c:  &Config{DNSRecursors: []string{"a"}},
+		},
+		{
+			in: `{"recursor":"a","recursors":"b"}`,
+			c:  &Config{DNSRecursors: []string{"b", "a"}},
+		},
 		{
 			in: `{"rejoin_after_leave":true}`,
 			c:  &Config{RejoinAfterLeave: true},
@@ -509,6 +694,10 @@ func TestDecodeConfig(t *testing.T) {
 			in: `{"retry_interval":"2s"}`,
 			c:  &Config{RetryInterval: 2 * time.Second, RetryIntervalRaw: "2s"},
 		},
+		{
+			in: `{"retry_interval":2}`,
+			c:  &Config{RetryInterval: 2 * time.Second, RetryIntervalRaw: "2s"},
+		},
 		{
 			in: `{"retry_interval_wan":"2s"}`,
 			c:  &Config{RetryIntervalWan: 2 * time.Second, RetryIntervalWanRaw: "2s"},
@@ -517,69 +706,78 @@ func TestDecodeConfig(t *testing.T) {
 			in: `{"retry_join":["a","b"]}`,
 			c:  &Config{RetryJoin: []string{"a", "b"}},
 		},
-		// todo(fs): temporarily disabling tests after moving the code
-		// todo(fs): to patch the deprecated retry-join flags to command/agent.go
-		// todo(fs): where it cannot be tested.
-		//		{
-		//			in: `{"retry_join_azure":{"client_id":"a"}}`,
-		//			c:  &Config{RetryJoin: []string{"provider=azure client_id=a"}},
-		//		},
-		//		{
-		//			in: `{"retry_join_azure":{"tag_name":"a"}}`,
-		//			c:  &Config{RetryJoin: []string{"provider=azure tag_name=a"}},
-		//		},
-		//		{
-		//			in: `{"retry_join_azure":{"tag_value":"a"}}`,
-		//			c:  &Config{RetryJoin: []string{"provider=azure tag_value=a"}},
-		//		},
-		//		{
-		//			in: `{"retry_join_azure":{"secret_access_key":"a"}}`,
-		//			c:  &Config{RetryJoin: []string{"provider=azure secret_access_key=a"}},
-		//		},
-		//		{
-		//			in: `{"retry_join_azure":{"subscription_id":"a"}}`,
-		//			c:  &Config{RetryJoin: []string{"provider=azure subscription_id=a"}},
-		//		},
-		//		{
-		//			in: `{"retry_join_azure":{"tenant_id":"a"}}`,
-		//			c:  &Config{RetryJoin: []string{"provider=azure tenant_id=a"}},
-		//		},
-		//		{
-		//			in: `{"retry_join_ec2":{"access_key_id":"a"}}`,
-		//			c:  &Config{RetryJoin: []string{"provider=aws access_key_id=a"}},
-		//		},
-		//		{
-		//			in: `{"retry_join_ec2":{"region":"a"}}`,
-		//			c:  &Config{RetryJoin: []string{"provider=aws region=a"}},
-		//		},
-		//		{
-		//			in: `{"retry_join_ec2":{"tag_key":"a"}}`,
-		//			c:  &Config{RetryJoin: []string{"provider=aws tag_key=a"}},
-		//		},
-		//		{
-		//			in: `{"retry_join_ec2":{"tag_value":"a"}}`,
-		//			c:  &Config{RetryJoin: []string{"provider=aws tag_value=a"}},
-		//		},
-		//		{
-		//			in: `{"retry_join_ec2":{"secret_access_key":"a"}}`,
-		//			c:  &Config{RetryJoin: []string{"provider=aws secret_access_key=a"}},
-		//		},
-		//		{
-		//			in: `{"retry_join_gce":{"credentials_file":"a"}}`,
-		//			c:  &Config{RetryJoin: []string{"provider=gce credentials_file=a"}},
-		//		},
-		//		{
-		//			in: `{"retry_join_gce":{"project_name":"a"}}`,
-		//			c:  &Config{RetryJoin: []string{"provider=gce project_name=a"}},
-		//		},
-		//		{
-		//			in: `{"retry_join_gce":{"tag_value":"a"}}`,
-		//			c:  &Config{RetryJoin: []string{"provider=gce tag_value=a"}},
-		//		},
-		//		{
-		//			in: `{"retry_join_gce":{"zone_pattern":"a"}}`,
-		//			c:  &Config{RetryJoin: []string{"provider=gce zone_pattern=a"}},
-		//		},
+		{
+			in: `{"retry_join":"a"}`,
+			c:  &Config{RetryJoin: []string{"a"}},
+		},
+		{
+			in: `{"retry_join":"a","retry_join_ec2":{"region":"b"}}`,
+			c:  &Config{RetryJoin: []string{"a", "provider=aws region=b"}},
+		},
+		{
+			in: `{"retry_join_wan":"a"}`,
+			c:  &Config{RetryJoinWan: []string{"a"}},
+		},
+		{
+			in: `{"retry_join_azure":{"client_id":"a"}}`,
+			c:  &Config{RetryJoin: []string{"provider=azure client_id=a"}},
+		},
+		{
+			in: `{"retry_join_azure":{"tag_name":"a"}}`,
+			c:  &Config{RetryJoin: []string{"provider=azure tag_name=a"}},
+		},
+		{
+			in: `{"retry_join_azure":{"tag_value":"a"}}`,
+			c:  &Config{RetryJoin: []string{"provider=azure tag_value=a"}},
+		},
+		{
+			in: `{"retry_join_azure":{"secret_access_key":"a"}}`,
+			c:  &Config{RetryJoin: []string{"provider=azure secret_access_key=a"}},
+		},
+		{
+			in: `{"retry_join_azure":{"subscription_id":"a"}}`,
+			c:  &Config{RetryJoin: []string{"provider=azure subscription_id=a"}},
+		},
+		{
+			in: `{"retry_join_azure":{"tenant_id":"a"}}`,
+			c:  &Config{RetryJoin: []string{"provider=azure tenant_id=a"}},
+		},
+		{
+			in: `{"retry_join_ec2":{"access_key_id":"a"}}`,
+			c:  &Config{RetryJoin: []string{"provider=aws access_key_id=a"}},
+		},
+		{
+			in: `{"retry_join_ec2":{"region":"a"}}`,
+			c:  &Config{RetryJoin: []string{"provider=aws region=a"}},
+		},
+		{
+			in: `{"retry_join_ec2":{"tag_key":"a"}}`,
+			c:  &Config{RetryJoin: []string{"provider=aws tag_key=a"}},
+		},
+		{
+			in: `{"retry_join_ec2":{"tag_value":"a"}}`,
+			c:  &Config{RetryJoin: []string{"provider=aws tag_value=a"}},
+		},
+		{
+			in: `{"retry_join_ec2":{"secret_access_key":"a"}}`,
+			c:  &Config{RetryJoin: []string{"provider=aws secret_access_key=a"}},
+		},
+		{
+			in: `{"retry_join_gce":{"credentials_file":"a"}}`,
+			c:  &Config{RetryJoin: []string{"provider=gce credentials_file=a"}},
+		},
+		{
+			in: `{"retry_join_gce":{"project_name":"a"}}`,
+			c:  &Config{RetryJoin: []string{"provider=gce project_name=a"}},
+		},
+		{
+			in: `{"retry_join_gce":{"tag_value":"a"}}`,
+			c:  &Config{RetryJoin: []string{"provider=gce tag_value=a"}},
+		},
+		{
+			in: `{"retry_join_gce":{"zone_pattern":"a"}}`,
+			c:  &Config{RetryJoin: []string{"provider=gce zone_pattern=a"}},
+		},
 		{
 			in: `{"retry_join_wan":["a","b"]}`,
 			c:  &Config{RetryJoinWan: []string{"a", "b"}},
@@ -642,10 +840,18 @@ func TestDecodeConfig(t *testing.T) {
 			in: `{"start_join_wan":["a","b"]}`,
 			c:  &Config{StartJoinWan: []string{"a", "b"}},
 		},
+		{
+			in: `{"start_join":"a","start_join_wan":"b"}`,
+			c:  &Config{StartJoin: []string{"a"}, StartJoinWan: []string{"b"}},
+		},
 		{
 			in: `{"statsd_addr":"a"}`,
 			c:  &Config{Telemetry: Telemetry{StatsdAddr: "a"}},
 		},
+		{
+			in: `{"statsd_addr":"a","telemetry":{"statsd_address":"b"}}`,
+			c:  &Config{Telemetry: Telemetry{StatsdAddr: "b"}},
+		},
 		{
 			in: `{"statsite_addr":"a"}`,
 			c:  &Config{Telemetry: Telemetry{StatsiteAddr: "a"}},
@@ -658,6 +864,10 @@ func TestDecodeConfig(t *testing.T) {
 			in: `{"syslog_facility":"a"}`,
 			c:  &Config{SyslogFacility: "a"},
 		},
+		{
+			in: `{"windows_service_name":"a"}`,
+			c:  &Config{WindowsServiceName: "a"},
+		},
 		{
 			in: `{"telemetry":{"circonus_api_app":"a"}}`,
 			c:  &Config{Telemetry: Telemetry{CirconusAPIApp: "a"}},
@@ -761,6 +971,10 @@ func TestDecodeConfig(t *testing.T) {
 			in: `{"tls_prefer_server_cipher_suites":true}`,
 			c:  &Config{TLSPreferServerCipherSuites: true},
 		},
+		{
+			in: `{"tagged_addresses":{"wan":"1.2.3.4","public":"5.6.7.8"}}`,
+			c:  &Config{TaggedAddresses: map[string]string{"wan": "1.2.3.4", "public": "5.6.7.8"}},
+		},
 		{
 			in: `{"translate_wan_addrs":true}`,
 			c:  &Config{TranslateWanAddrs: true},
@@ -846,7 +1060,8 @@ func TestDecodeConfig(t *testing.T) {
 							"Interval": "2s",
 							"Timeout": "3s",
 							"TTL": "4s",
-							"DeregisterCriticalServiceAfter": "5s"
+							"DeregisterCriticalServiceAfter": "5s",
+							"output_max_size": 6
 						}
 					}
 				}`,
@@ -872,11 +1087,12 @@ func TestDecodeConfig(t *testing.T) {
 							TCP:               "m",
 							DockerContainerID: "n",
 							Shell:             "o",
-							TLSSkipVerify:     true,
+							TLSSkipVerify:     Bool(true),
 							Interval:          2 * time.Second,
 							Timeout:           3 * time.Second,
 							TTL:               4 * time.Second,
 							DeregisterCriticalServiceAfter: 5 * time.Second,
+							OutputMaxSize:                  6,
 						},
 					},
 				},
@@ -956,7 +1172,7 @@ func TestDecodeConfig(t *testing.T) {
 								TCP:               "m",
 								DockerContainerID: "n",
 								Shell:             "o",
-								TLSSkipVerify:     true,
+								TLSSkipVerify:     Bool(true),
 								Interval:          2 * time.Second,
 								Timeout:           3 * time.Second,
 								TTL:               4 * time.Second,
@@ -974,7 +1190,7 @@ func TestDecodeConfig(t *testing.T) {
 								TCP:               "mm",
 								DockerContainerID: "nn",
 								Shell:             "oo",
-								TLSSkipVerify:     false,
+								TLSSkipVerify:     Bool(false),
 								Interval:          22 * time.Second,
 								Timeout:           33 * time.Second,
 								TTL:               44 * time.Second,
@@ -1067,7 +1283,7 @@ func TestDecodeConfig(t *testing.T) {
 							TCP:               "m",
 							DockerContainerID: "n",
 							Shell:             "o",
-							TLSSkipVerify:     true,
+							TLSSkipVerify:     Bool(true),
 							Interval:          2 * time.Second,
 							Timeout:           3 * time.Second,
 							TTL:               4 * time.Second,
@@ -1094,7 +1310,7 @@ func TestDecodeConfig(t *testing.T) {
 							TCP:               "mm",
 							DockerContainerID: "nn",
 							Shell:             "oo",
-							TLSSkipVerify:     false,
+							TLSSkipVerify:     Bool(false),
 							Interval:          22 * time.Second,
 							Timeout:           33 * time.Second,
 							TTL:               44 * time.Second,
@@ -1126,7 +1342,10 @@ func TestDecodeConfig(t *testing.T) {
 						"interval": "2s",
 						"timeout": "3s",
 						"ttl": "4s",
-						"deregister_critical_service_after": "5s"
+						"deregister_critical_service_after": "5s",
+						"output_max_size": 6,
+						"enable_agent_tls": false,
+						"tls_server_name": "i"
 					}
 				}`,
 			c: &Config{
@@ -1145,11 +1364,14 @@ func TestDecodeConfig(t *testing.T) {
 						Method:            "x",
 						TCP:               "g",
 						DockerContainerID: "h",
-						TLSSkipVerify:     true,
+						TLSSkipVerify:     Bool(true),
 						Interval:          2 * time.Second,
 						Timeout:           3 * time.Second,
 						TTL:               4 * time.Second,
 						DeregisterCriticalServiceAfter: 5 * time.Second,
+						OutputMaxSize:                  6,
+						EnableAgentTLS:                 Bool(false),
+						TLSServerName:                  "i",
 					},
 				},
 			},
@@ -1216,7 +1438,7 @@ func TestDecodeConfig(t *testing.T) {
 						Method:            "x",
 						TCP:               "j",
 						DockerContainerID: "k",
-						TLSSkipVerify:     true,
+						TLSSkipVerify:     Bool(true),
 						Interval:          2 * time.Second,
 						Timeout:           3 * time.Second,
 						TTL:               4 * time.Second,
@@ -1236,7 +1458,7 @@ func TestDecodeConfig(t *testing.T) {
 						Method:            "xx",
 						TCP:               "jj",
 						DockerContainerID: "kk",
-						TLSSkipVerify:     false,
+						TLSSkipVerify:     Bool(false),
 						Interval:          22 * time.Second,
 						Timeout:           33 * time.Second,
 						TTL:               44 * time.Second,
@@ -1261,6 +1483,11 @@ func TestDecodeConfig(t *testing.T) {
 			if got, want := err, tt.parseTemplateErr; !reflect.DeepEqual(got, want) {
 				t.Fatalf("got error %v on ResolveTmplAddrs, expected %v", err, want)
 			}
+
+			// The deprecation warnings are tested separately.
+			if c != nil {
+				c.Deprecations = nil
+			}
 			got, want := c, tt.c
 			verify.Values(t, "", got, want)
 		})
@@ -1282,7 +1509,42 @@ func TestDecodeConfig_VerifyUniqueListeners(t *testing.T) {
 		{
 			"http_dns IP identical",
 			`{"addresses": {"http": "0.0.0.0", "dns": "0.0.0.0"}, "ports": {"http": 8000, "dns": 8000}}`,
-			errors.New("HTTP address already configured for DNS"),
+			configErrorf([]string{"ports.dns", "ports.http"}, "DNS and HTTP cannot both listen on 0.0.0.0:8000"),
+		},
+		{
+			"http_dns list overlap",
+			`{"addresses": {"http": "10.0.0.1 127.0.0.1", "dns": "127.0.0.1"}, "ports": {"http": 8000, "dns": 8000}}`,
+			configErrorf([]string{"ports.dns", "ports.http"}, "DNS and HTTP cannot both listen on 127.0.0.1:8000"),
+		},
+		{
+			"http_dns client addr",
+			`{"client_addr": "127.0.0.1", "addresses": {"http": "127.0.0.1"}, "ports": {"http": 8000, "dns": 8000}}`,
+			configErrorf([]string{"ports.dns", "ports.http"}, "DNS and HTTP cannot both listen on 127.0.0.1:8000"),
+		},
+		{
+			"http_dns wildcard",
+			`{"addresses": {"http": "127.0.0.1", "dns": "0.0.0.0"}, "ports": {"http": 8000, "dns": 8000}}`,
+			configErrorf([]string{"ports.dns", "ports.http"}, "DNS and HTTP cannot both listen on 127.0.0.1:8000"),
+		},
+		{
+			"http_dns dual stack",
+			`{"addresses": {"http": "0.0.0.0 ::", "dns": "::1"}, "ports": {"http": 8000, "dns": 8001}}`,
+			nil,
+		},
+		{
+			"http_server bind addr",
+			`{"bind_addr": "0.0.0.0", "client_addr": "127.0.0.1", "ports": {"http": 8300, "server": 8300}}`,
+			configErrorf([]string{"ports.http", "ports.server"}, "HTTP and Server RPC cannot both listen on 0.0.0.0:8300"),
+		},
+		{
+			"http_socket",
+			`{"addresses": {"http": "unix:///tmp/consul.sock", "https": "unix:///tmp/consul.sock"}}`,
+			configErrorf([]string{"ports.http", "ports.https"}, "HTTP and HTTPS cannot both listen on unix:///tmp/consul.sock"),
+		},
+		{
+			"http_dns client addr disabled",
+			`{"client_addr": "127.0.0.1", "ports": {"http": -1, "dns": -1, "https": -1}}`,
+			nil,
 		},
 	}
 
@@ -1301,6 +1563,78 @@ func TestDecodeConfig_VerifyUniqueListeners(t *testing.T) {
 	}
 }
 
+func TestDecodeConfig_deprecations(t *testing.T) {
+	t.Parallel()
+	in := `{"ports": {"rpc": 8400}, "recursor": "a", "retry_join_wan": "b", "retry_interval": 2}`
+	c, err := DecodeConfig(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	want := []string{
+		"ports.rpc is deprecated and is no longer used. Please remove it from your configuration",
+		"recursor is deprecated. Please use recursors instead",
+		"a single string for retry_join_wan is deprecated. Please use a list instead",
+		`a number of seconds for retry_interval is deprecated. Please use a duration like "30s" instead`,
+	}
+	verify.Values(t, "", c.Deprecations, want)
+}
+
+func TestDecodeConfig_strictKeys(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		desc string
+		in   string
+		err  string
+	}{
+		{
+			"valid",
+			`{"service": {"name": "web", "tag": "a", "check": {"http": "http://localhost", "interval": "10s"}}, "check": {"name": "c", "ttl": "10s"}}`,
+			"",
+		},
+		{
+			"service",
+			`{"service": {"name": "web", "prot": 80}}`,
+			"Config has invalid keys: service.prot",
+		},
+		{
+			"services",
+			`{"services": [{"name": "web"}, {"name": "db", "prot": 80}]}`,
+			"Config has invalid keys: services[1].prot",
+		},
+		{
+			"check",
+			`{"check": {"name": "c", "intervall": "10s"}}`,
+			"Config has invalid keys: check.intervall",
+		},
+		{
+			"checks",
+			`{"checks": [{"name": "c", "intervall": "10s"}]}`,
+			"Config has invalid keys: checks[0].intervall",
+		},
+		{
+			"config and service",
+			`{"bind_adr": "127.0.0.1", "service": {"name": "web", "prot": 80}}`,
+			"Config has invalid keys: bind_adr,service.prot",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			// The definitions are decoded without checking the keys
+			// unless strict is set.
+			if _, err := decodeConfig(strings.NewReader(tt.in), nil, false, false); err != nil && tt.desc != "config and service" {
+				t.Fatalf("err: %v", err)
+			}
+			_, err := decodeConfig(strings.NewReader(tt.in), nil, true, false)
+			if got, want := fmt.Sprint(err), tt.err; tt.err != "" && got != want {
+				t.Fatalf("got error %q want %q", got, want)
+			}
+			if tt.err == "" && err != nil {
+				t.Fatalf("err: %v", err)
+			}
+		})
+	}
+}
+
 func TestDefaultConfig(t *testing.T) {
 	t.Parallel()
 
@@ -1338,13 +1672,6 @@ func TestMergeConfig(t *testing.T) {
 		CheckUpdateIntervalRaw: "8m",
 		RetryIntervalRaw:       "10s",
 		RetryIntervalWanRaw:    "10s",
-		DeprecatedRetryJoinEC2: RetryJoinEC2{
-			Region:          "us-east-1",
-			TagKey:          "Key1",
-			TagValue:        "Value1",
-			AccessKeyID:     "nope",
-			SecretAccessKey: "nope",
-		},
 		Telemetry: Telemetry{
 			DisableHostname: false,
 			StatsdAddr:      "nope",
@@ -1366,7 +1693,40 @@ func TestMergeConfig(t *testing.T) {
 		BootstrapExpect: 3,
 		Datacenter:      "dc2",
 		DataDir:         "/tmp/bar",
-		DNSRecursors:    []string{"127.0.0.2:1001"},
+		DataDirEncryption: DataDirEncryption{
+			Key:     "a2V5",
+			KeyFile: "/tmp/key",
+		},
+		Permissions: Permissions{
+			DataDirMode:    "0700",
+			ConfigFileMode: "0640",
+			SecretFileMode: "0400",
+		},
+		StrictPermissions:        true,
+		StartInMaintenance:       true,
+		StartInMaintenanceReason: "rebuild",
+		GossipKeyRotation: GossipKeyRotation{
+			Interval:    720 * time.Hour,
+			IntervalRaw: "720h",
+			Retain:      2,
+		},
+		ConfigOverlay: ConfigOverlay{
+			Enabled: true,
+			Prefix:  "fleet/config",
+		},
+		Audit: Audit{
+			Enabled: true,
+			Sink: AuditSink{
+				Type:              "file",
+				Path:              "/tmp/audit.log",
+				Format:            "text",
+				RotateBytes:       1024,
+				RotateDuration:    24 * time.Hour,
+				RotateDurationRaw: "24h",
+				RotateMaxFiles:    3,
+			},
+		},
+		DNSRecursors: []string{"127.0.0.2:1001"},
 		DNSConfig: DNSConfig{
 			AllowStale:         Bool(false),
 			EnableTruncate:     true,
@@ -1411,45 +1771,52 @@ func TestMergeConfig(t *testing.T) {
 			MaxTrailingLogs:         Uint64(10),
 			ServerStabilizationTime: Duration(time.Duration(100)),
 		},
-		EnableDebug:            true,
-		VerifyIncoming:         true,
-		VerifyOutgoing:         true,
-		CAFile:                 "test/ca.pem",
-		CertFile:               "test/cert.pem",
-		KeyFile:                "test/key.pem",
-		TLSMinVersion:          "tls12",
-		Checks:                 []*structs.CheckDefinition{nil},
-		Services:               []*structs.ServiceDefinition{nil},
-		StartJoin:              []string{"1.1.1.1"},
-		StartJoinWan:           []string{"1.1.1.1"},
-		EnableUI:               true,
-		UIDir:                  "/opt/consul-ui",
-		EnableSyslog:           true,
-		RejoinAfterLeave:       true,
-		RetryJoin:              []string{"1.1.1.1"},
-		RetryIntervalRaw:       "10s",
-		RetryInterval:          10 * time.Second,
-		RetryJoinWan:           []string{"1.1.1.1"},
-		RetryIntervalWanRaw:    "10s",
-		RetryIntervalWan:       10 * time.Second,
-		ReconnectTimeoutLanRaw: "24h",
-		ReconnectTimeoutLan:    24 * time.Hour,
-		ReconnectTimeoutWanRaw: "36h",
-		ReconnectTimeoutWan:    36 * time.Hour,
-		EnableScriptChecks:     true,
-		CheckUpdateInterval:    8 * time.Minute,
-		CheckUpdateIntervalRaw: "8m",
-		ACLToken:               "1111",
-		ACLAgentMasterToken:    "2222",
-		ACLAgentToken:          "3333",
-		ACLMasterToken:         "4444",
-		ACLDatacenter:          "dc2",
-		ACLTTL:                 15 * time.Second,
-		ACLTTLRaw:              "15s",
-		ACLDownPolicy:          "deny",
-		ACLDefaultPolicy:       "deny",
-		ACLReplicationToken:    "8765309",
-		ACLEnforceVersion8:     Bool(true),
+		EnableDebug:                 true,
+		VerifyIncoming:              true,
+		VerifyOutgoing:              true,
+		CAFile:                      "test/ca.pem",
+		CertFile:                    "test/cert.pem",
+		KeyFile:                     "test/key.pem",
+		TLSMinVersion:               "tls12",
+		Checks:                      []*structs.CheckDefinition{nil},
+		Services:                    []*structs.ServiceDefinition{nil},
+		StartJoin:                   []string{"1.1.1.1"},
+		StartJoinWan:                []string{"1.1.1.1"},
+		EnableUI:                    true,
+		UIDir:                       "/opt/consul-ui",
+		EnableSyslog:                true,
+		EnableEventLog:              true,
+		WindowsServiceName:          "consul-agent",
+		RejoinAfterLeave:            true,
+		RetryJoin:                   []string{"1.1.1.1"},
+		RetryIntervalRaw:            "10s",
+		RetryInterval:               10 * time.Second,
+		RetryJoinWan:                []string{"1.1.1.1"},
+		RetryIntervalWanRaw:         "10s",
+		RetryIntervalWan:            10 * time.Second,
+		ReconnectTimeoutLanRaw:      "24h",
+		ReconnectTimeoutLan:         24 * time.Hour,
+		ReconnectTimeoutWanRaw:      "36h",
+		ReconnectTimeoutWan:         36 * time.Hour,
+		EnableScriptChecks:          true,
+		EnableLocalScriptChecks:     true,
+		SystemdNotify:               true,
+		CheckUpdateInterval:         8 * time.Minute,
+		CheckUpdateIntervalRaw:      "8m",
+		CheckOutputMaxSize:          8192,
+		ConfigStaleCheckInterval:    2 * time.Minute,
+		ConfigStaleCheckIntervalRaw: "2m",
+		ACLToken:                    "1111",
+		ACLAgentMasterToken:         "2222",
+		ACLAgentToken:               "3333",
+		ACLMasterToken:              "4444",
+		ACLDatacenter:               "dc2",
+		ACLTTL:                      15 * time.Second,
+		ACLTTLRaw:                   "15s",
+		ACLDownPolicy:               "deny",
+		ACLDefaultPolicy:            "deny",
+		ACLReplicationToken:         "8765309",
+		ACLEnforceVersion8:          Bool(true),
 		Watches: []map[string]interface{}{
 			map[string]interface{}{
 				"type":    "keyprefix",
@@ -1457,7 +1824,8 @@ func TestMergeConfig(t *testing.T) {
 				"handler": "foobar",
 			},
 		},
-		DisableRemoteExec: Bool(true),
+		DisableRemoteExec:          Bool(true),
+		AllowRemoteExecWithoutACLs: true,
 		Telemetry: Telemetry{
 			StatsiteAddr:    "127.0.0.1:7250",
 			StatsitePrefix:  "stats_prefix",
@@ -1479,6 +1847,7 @@ func TestMergeConfig(t *testing.T) {
 			ResponseHeaders: map[string]string{
 				"Access-Control-Allow-Origin": "*",
 			},
+			AllowedClientSubjects: []string{"*.ops.example.com"},
 		},
 		UnixSockets: UnixSocketConfig{
 			UnixSocketPermissions{
@@ -1487,13 +1856,6 @@ func TestMergeConfig(t *testing.T) {
 				Perms: "0700",
 			},
 		},
-		DeprecatedRetryJoinEC2: RetryJoinEC2{
-			Region:          "us-east-2",
-			TagKey:          "Key2",
-			TagValue:        "Value2",
-			AccessKeyID:     "foo",
-			SecretAccessKey: "bar",
-		},
 		SessionTTLMinRaw: "1000s",
 		SessionTTLMin:    1000 * time.Second,
 		AdvertiseAddrs: AdvertiseAddrsConfig{
@@ -1504,6 +1866,13 @@ func TestMergeConfig(t *testing.T) {
 			RPC:        &net.TCPAddr{},
 			RPCRaw:     "127.0.0.5:1233",
 		},
+		CheckDeregisterIntervalMin:    10 * time.Second,
+		CheckDeregisterIntervalMinRaw: "10s",
+		DeregisterCriticalServiceAfter:    72 * time.Hour,
+		DeregisterCriticalServiceAfterRaw: "72h",
+		ReadReplica:                       true,
+		DisablePidFileCheck:               true,
+		DataDirFilesystemDenylist:         []string{"fuse"},
 	}
 
 	c := MergeConfig(a, b)
@@ -1579,6 +1948,207 @@ func TestReadConfigPaths_dir(t *testing.T) {
 	}
 }
 
+func TestReadConfigPaths_parallel(t *testing.T) {
+	t.Parallel()
+	td := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(td)
+
+	// Every file overrides the node name and adds a service so that the
+	// result depends on the merge order.
+	for i := 0; i < 100; i++ {
+		content := fmt.Sprintf(`{"node_name": "node-%03d", "service": {"name": "svc-%03d"}}`, i, i)
+		path := filepath.Join(td, fmt.Sprintf("%03d.json", i))
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	serial, err := readConfigPaths([]string{td}, 1, DefaultConfigLimits(), nil, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	parallel, err := readConfigPaths([]string{td}, 8, DefaultConfigLimits(), nil, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if got, want := parallel.NodeName, "node-099"; got != want {
+		t.Fatalf("got node name %q want %q", got, want)
+	}
+	for i, s := range parallel.Services {
+		if got, want := s.Name, fmt.Sprintf("svc-%03d", i); got != want {
+			t.Fatalf("got service %q want %q", got, want)
+		}
+	}
+	verify.Values(t, "", parallel, serial)
+}
+
+func TestReadConfigPaths_parallelErrorOrder(t *testing.T) {
+	t.Parallel()
+	td := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(td)
+
+	for _, name := range []string{"a.json", "b.json", "c.json"} {
+		content := `{"node_name": "bar"}`
+		if name != "a.json" {
+			content = "{"
+		}
+		if err := ioutil.WriteFile(filepath.Join(td, name), []byte(content), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	// The errors of all failing files are reported in merge order.
+	_, err := readConfigPaths([]string{td, "/i/shouldnt/exist/ever/rainbows"}, 8, DefaultConfigLimits(), nil, nil)
+	merr, ok := err.(*multierror.Error)
+	if !ok || len(merr.Errors) != 3 {
+		t.Fatalf("got error %v want errors for b.json, c.json and the missing path", err)
+	}
+	for i, want := range []string{"b.json", "c.json", "rainbows"} {
+		if !strings.Contains(merr.Errors[i].Error(), want) {
+			t.Fatalf("got error %v want error for %s", merr.Errors[i], want)
+		}
+	}
+}
+
+func TestReadConfigPaths_parallelEarlyError(t *testing.T) {
+	t.Parallel()
+	td := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(td)
+
+	// An error in the first file does not stop the other files from
+	// being decoded, but they are not merged.
+	for i := 0; i < 100; i++ {
+		content := `{"node_name": "bar"}`
+		if i == 0 {
+			content = "{"
+		}
+		path := filepath.Join(td, fmt.Sprintf("%03d.json", i))
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	_, err := readConfigPaths([]string{td}, 2, DefaultConfigLimits(), nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "000.json") {
+		t.Fatalf("got error %v want error for 000.json", err)
+	}
+}
+
+// writeBenchmarkConfigDir writes n service definition files to a new
+// directory.
+func writeBenchmarkConfigDir(b *testing.B, n int) string {
+	td, err := ioutil.TempDir("", "consul-bench")
+	if err != nil {
+		b.Fatalf("err: %s", err)
+	}
+	for i := 0; i < n; i++ {
+		content := fmt.Sprintf(`{
+			"service": {
+				"name": "svc-%d",
+				"tags": ["primary", "v1"],
+				"port": %d,
+				"checks": [
+					{"http": "http://localhost:%d/health", "interval": "10s", "timeout": "1s"},
+					{"tcp": "localhost:%d", "interval": "10s"}
+				]
+			}
+		}`, i, 10000+i, 10000+i, 10000+i)
+		path := filepath.Join(td, fmt.Sprintf("svc-%05d.json", i))
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			b.Fatalf("err: %s", err)
+		}
+	}
+	return td
+}
+
+func BenchmarkReadConfigPaths(b *testing.B) {
+	td := writeBenchmarkConfigDir(b, 3000)
+	defer os.RemoveAll(td)
+
+	bench := func(workers int) func(b *testing.B) {
+		return func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := readConfigPaths([]string{td}, workers, DefaultConfigLimits(), nil, nil); err != nil {
+					b.Fatalf("err: %s", err)
+				}
+			}
+		}
+	}
+	b.Run("serial", bench(1))
+	b.Run("parallel", bench(runtime.GOMAXPROCS(0)))
+}
+
+func TestConfig_ListenerAddrs(t *testing.T) {
+	t.Parallel()
+	c := DefaultConfig()
+	c.ClientAddr = "127.0.0.1"
+	c.Addresses.HTTP = "unix:///tmp/consul.sock"
+	c.Ports.HTTPS = 8501
+	c.CertFile = "cert.pem"
+	c.KeyFile = "key.pem"
+
+	dns, err := c.DNSAddrs()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	verify.Values(t, "dns", dns, []ProtoAddr{
+		{"dns", &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 8600}},
+		{"dns", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 8600}},
+	})
+
+	http, err := c.HTTPAddrs()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	verify.Values(t, "http", http, []ProtoAddr{
+		{"http", &net.UnixAddr{Name: "/tmp/consul.sock", Net: "unix"}},
+		{"https", &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 8501}},
+	})
+	if got, want := http[1].String(), "https://127.0.0.1:8501"; got != want {
+		t.Fatalf("got %q want %q", got, want)
+	}
+
+	c.Addresses.DNS = "unix:///tmp/dns.sock"
+	if _, err := c.DNSAddrs(); err == nil || !strings.Contains(err.Error(), "DNS cannot listen on unix socket") {
+		t.Fatalf("got error %v", err)
+	}
+}
+
+func TestConfig_ListenerAddrs_clientAddrList(t *testing.T) {
+	t.Parallel()
+	c := DefaultConfig()
+	c.ClientAddr = "127.0.0.1, 10.0.0.5"
+	c.Addresses.HTTP = "10.0.0.6"
+
+	dns, err := c.DNSAddrs()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	verify.Values(t, "dns", dns, []ProtoAddr{
+		{"dns", &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 8600}},
+		{"dns", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 8600}},
+		{"dns", &net.TCPAddr{IP: net.ParseIP("10.0.0.5"), Port: 8600}},
+		{"dns", &net.UDPAddr{IP: net.ParseIP("10.0.0.5"), Port: 8600}},
+	})
+
+	http, err := c.HTTPAddrs()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	verify.Values(t, "http", http, []ProtoAddr{
+		{"http", &net.TCPAddr{IP: net.ParseIP("10.0.0.6"), Port: 8500}},
+	})
+
+	if _, err := c.ClientListeners("", 80); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	c.ClientAddr = ""
+	if _, err := c.ClientListeners("", 80); err == nil || !strings.Contains(err.Error(), "Failed to parse IP") {
+		t.Fatalf("got error %v", err)
+	}
+}
+
 func TestUnixSockets(t *testing.T) {
 	t.Parallel()
 	if p := socketPath("unix:///path/to/socket"); p != "/path/to/socket" {
@@ -1605,7 +2175,7 @@ func TestCheckDefinitionToCheckType(t *testing.T) {
 		Interval:          1 * time.Second,
 		DockerContainerID: "abc123",
 		Shell:             "/bin/ksh",
-		TLSSkipVerify:     true,
+		TLSSkipVerify:     Bool(true),
 		Timeout:           2 * time.Second,
 		TTL:               3 * time.Second,
 		DeregisterCriticalServiceAfter: 4 * time.Second,
@@ -1622,10 +2192,26 @@ func TestCheckDefinitionToCheckType(t *testing.T) {
 		Interval:          1 * time.Second,
 		DockerContainerID: "abc123",
 		Shell:             "/bin/ksh",
-		TLSSkipVerify:     true,
+		TLSSkipVerify:     Bool(true),
 		Timeout:           2 * time.Second,
 		TTL:               3 * time.Second,
 		DeregisterCriticalServiceAfter: 4 * time.Second,
 	}
 	verify.Values(t, "", got.CheckType(), want)
 }
+
+func TestConfig_SetupTaggedAndAdvertiseAddrs(t *testing.T) {
+	t.Parallel()
+	c := DefaultConfig()
+	c.AdvertiseAddr = "10.0.0.1"
+	c.TaggedAddresses = map[string]string{"wan": "1.2.3.4", "public": "5.6.7.8"}
+	if err := c.SetupTaggedAndAdvertiseAddrs(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	verify.Values(t, "tagged", c.TaggedAddresses, map[string]string{
+		"lan":    "10.0.0.1",
+		"wan":    "1.2.3.4",
+		"public": "5.6.7.8",
+	})
+	verify.Values(t, "advertise wan", c.AdvertiseAddrWan, "10.0.0.1")
+}
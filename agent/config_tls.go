@@ -0,0 +1,31 @@
+package agent
+
+import (
+	"crypto/tls"
+
+	"github.com/hashicorp/go-rootcerts"
+)
+
+// verifyTLSFiles checks that the certificate authorities and the
+// certificate and key of the TLS configuration can be loaded, so that a
+// missing or broken file is reported when the configuration is read
+// instead of when the first TLS connection is made.
+func (c *Config) verifyTLSFiles() []error {
+	var errs []error
+	if c.CAFile != "" {
+		if _, err := rootcerts.LoadCAFile(c.CAFile); err != nil {
+			errs = append(errs, configErrorf([]string{"ca_file"}, "ca_file: %s", err))
+		}
+	}
+	if c.CAPath != "" {
+		if _, err := rootcerts.LoadCAPath(c.CAPath); err != nil {
+			errs = append(errs, configErrorf([]string{"ca_path"}, "ca_path: %s", err))
+		}
+	}
+	if c.CertFile != "" && c.KeyFile != "" {
+		if _, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile); err != nil {
+			errs = append(errs, configErrorf([]string{"cert_file", "key_file"}, "cert_file and key_file: %s", err))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,57 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfig_verifyTLSFiles(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		desc string
+		cfg  *Config
+		errs []string
+	}{
+		{desc: "none", cfg: &Config{}},
+		{
+			desc: "valid",
+			cfg: &Config{
+				CAFile:   "../test/ca/root.cer",
+				CAPath:   "../test/ca_path",
+				CertFile: "../test/key/ourdomain.cer",
+				KeyFile:  "../test/key/ourdomain.key",
+			},
+		},
+		{
+			desc: "missing files",
+			cfg: &Config{
+				CAFile:   "../test/ca/missing.cer",
+				CAPath:   "../test/missing",
+				CertFile: "../test/key/ourdomain.cer",
+				KeyFile:  "../test/key/missing.key",
+			},
+			errs: []string{"ca_file: ", "ca_path: ", "cert_file and key_file: "},
+		},
+		{
+			desc: "mismatched keypair",
+			cfg: &Config{
+				CertFile: "../test/key/ourdomain.cer",
+				KeyFile:  "../test/key/ssl-cert-snakeoil.key",
+			},
+			errs: []string{"cert_file and key_file: tls: private key does not match public key"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			errs := tt.cfg.verifyTLSFiles()
+			if len(errs) != len(tt.errs) {
+				t.Fatalf("got %v want %d errors", errs, len(tt.errs))
+			}
+			for i, err := range errs {
+				if !strings.HasPrefix(err.Error(), tt.errs[i]) {
+					t.Fatalf("got %q want %q", err, tt.errs[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package agent
+
+import (
+	"reflect"
+	"sort"
+)
+
+// unsetConfigKeys removes the keys whose value is null from the decoded
+// configuration document and returns them. Keys of nested configuration
+// blocks are returned in their dotted form, like "telemetry.statsd_address".
+// Null values of keys which are not settings are returned as invalid.
+func unsetConfigKeys(obj map[string]interface{}) (unset, invalid []string) {
+	fields := mergeFieldsForConfig()
+	var walk func(obj map[string]interface{}, prefix string)
+	walk = func(obj map[string]interface{}, prefix string) {
+		for k, v := range obj {
+			key := prefix + k
+			f := findMergeField(fields, key)
+			switch {
+			case v == nil && f != nil:
+				unset = append(unset, key)
+				delete(obj, k)
+			case v == nil:
+				invalid = append(invalid, key)
+				delete(obj, k)
+			case f != nil && (f.kind == mergeStruct || f.kind == mergeStructPtr):
+				if m, ok := v.(map[string]interface{}); ok {
+					walk(m, key+".")
+				}
+			}
+		}
+	}
+	walk(obj, "")
+	sort.Strings(unset)
+	sort.Strings(invalid)
+	return unset, invalid
+}
+
+// findMergeField returns the field which is set by the given key or nil.
+func findMergeField(fields []mergeField, key string) *mergeField {
+	for i := range fields {
+		f := &fields[i]
+		if f.key == key && f.kind != mergeSkip {
+			return f
+		}
+		if nested := findMergeField(f.fields, key); nested != nil {
+			return nested
+		}
+	}
+	return nil
+}
+
+// unsetFields resets the fields set by the given keys to their value in
+// the default configuration def, so that settings like pointers to
+// booleans or ports are never left without a value. Configuration blocks
+// referenced by pointer are copied before they are modified since they are
+// shared with the merged configuration.
+func unsetFields(fields []mergeField, v, def reflect.Value, keys map[string]bool) {
+	for _, f := range fields {
+		dst := v.Field(f.index)
+		if f.key != "" && keys[f.key] && f.kind != mergeSkip {
+			dst.Set(def.Field(f.index))
+			if f.raw >= 0 {
+				v.Field(f.raw).Set(def.Field(f.raw))
+			}
+			continue
+		}
+
+		switch f.kind {
+		case mergeStruct:
+			unsetFields(f.fields, dst, def.Field(f.index), keys)
+
+		case mergeStructPtr:
+			if dst.IsNil() {
+				continue
+			}
+			d := def.Field(f.index)
+			if d.IsNil() {
+				d = reflect.New(dst.Type().Elem())
+			}
+			cp := reflect.New(dst.Type().Elem())
+			cp.Elem().Set(dst.Elem())
+			unsetFields(f.fields, cp.Elem(), d.Elem(), keys)
+			dst.Set(cp)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package agent
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pascaldekloe/goe/verify"
+)
+
+func TestDecodeConfig_unset(t *testing.T) {
+	t.Parallel()
+	in := `{
+		"node_name": null,
+		"start_join": null,
+		"dns_config": {"allow_stale": null, "max_stale": "5s"},
+		"acl_ttl": null
+	}`
+	c, err := DecodeConfig(bytes.NewBufferString(in))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	verify.Values(t, "unset", c.Unset, []string{"acl_ttl", "dns_config.allow_stale", "node_name", "start_join"})
+	if c.DNSConfig.MaxStale != 5*time.Second {
+		t.Fatalf("got max_stale %v want 5s", c.DNSConfig.MaxStale)
+	}
+
+	// Null values of keys which are not settings are rejected.
+	for _, in := range []string{`{"foo": null}`, `{"dns_config": {"foo": null}}`} {
+		_, err := DecodeConfig(bytes.NewBufferString(in))
+		if err == nil || !strings.Contains(err.Error(), "invalid keys") {
+			t.Fatalf("%s: got error %v want invalid keys", in, err)
+		}
+	}
+}
+
+func TestMergeConfig_unset(t *testing.T) {
+	t.Parallel()
+	a := &Config{
+		NodeName:          "a",
+		StartJoin:         []string{"1.1.1.1"},
+		Meta:              map[string]string{"a": "1"},
+		ACLTTL:            10 * time.Second,
+		ACLTTLRaw:         "10s",
+		DisableHostNodeID: Bool(false),
+		Ports:             PortConfig{DNS: 53, HTTP: 80},
+		DNSConfig:         DNSConfig{AllowStale: Bool(false), MaxStale: time.Second},
+		Autopilot:         Autopilot{CleanupDeadServers: Bool(false)},
+	}
+	b := &Config{
+		Datacenter: "b",
+		StartJoin:  []string{"2.2.2.2"},
+		Unset: []string{"node_name", "start_join", "node_meta", "acl_ttl", "disable_host_node_id",
+			"ports.dns", "dns_config.allow_stale", "autopilot"},
+	}
+	prov := make(Provenance)
+	got := MergeConfigSource(a, b, "b.json", prov)
+
+	// The unset keys are reset to their default values.
+	def := DefaultConfig()
+	want := &Config{
+		Datacenter:        "b",
+		StartJoin:         []string{"2.2.2.2"},
+		ACLTTL:            def.ACLTTL,
+		ACLTTLRaw:         def.ACLTTLRaw,
+		DisableHostNodeID: def.DisableHostNodeID,
+		Ports:             PortConfig{DNS: def.Ports.DNS, HTTP: 80},
+		DNSConfig:         DNSConfig{AllowStale: def.DNSConfig.AllowStale, MaxStale: time.Second},
+		Autopilot:         def.Autopilot,
+		Unset:             b.Unset,
+	}
+	verify.Values(t, "", got, want)
+	if prov["node_name"] != "b.json" || prov["dns_config.allow_stale"] != "b.json" {
+		t.Fatalf("unset keys not recorded: %v", prov)
+	}
+	if a.NodeName != "a" || a.DNSConfig.AllowStale == nil || *a.DNSConfig.AllowStale {
+		t.Fatalf("a was modified: %v", a)
+	}
+
+	// A later configuration sets the cleared value again, also when the
+	// merged configurations are merged onto another one.
+	c := &Config{NodeName: "c"}
+	got = MergeConfig(MergeConfig(a, MergeConfig(b, c)), &Config{})
+	if got.NodeName != "c" || len(got.Meta) != 0 {
+		t.Fatalf("got node name %q and meta %v", got.NodeName, got.Meta)
+	}
+}
+
+func TestConfigBuilder_unsetStartsAgent(t *testing.T) {
+	t.Parallel()
+	b := &ConfigBuilder{
+		Default: TestConfig(),
+		Sources: []ConfigSource{{Name: "nulls", Format: ConfigFormatJSON, Data: `{
+			"node_id": null,
+			"disable_host_node_id": null,
+			"acl_enforce_version_8": null,
+			"disable_remote_exec": null,
+			"ports": {"dns": null}
+		}`}},
+	}
+	cfg, _, err := b.Build()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if cfg.DisableHostNodeID == nil || cfg.ACLEnforceVersion8 == nil || cfg.DisableRemoteExec == nil {
+		t.Fatalf("unset pointers are nil: %v %v %v", cfg.DisableHostNodeID, cfg.ACLEnforceVersion8, cfg.DisableRemoteExec)
+	}
+	if cfg.Ports.DNS != DefaultConfig().Ports.DNS {
+		t.Fatalf("got dns port %d", cfg.Ports.DNS)
+	}
+
+	// The agent generates a node ID and handles remote exec events with
+	// the defaults instead of dereferencing nil pointers.
+	a := NewTestAgent(t.Name(), cfg)
+	defer a.Shutdown()
+	if a.RuntimeConfig().NodeID == "" {
+		t.Fatal("no node ID was generated")
+	}
+	a.ingestUserEvent(&UserEvent{ID: "1", Name: remoteExecName})
+}
@@ -0,0 +1,658 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/consul/agent/consul"
+	"github.com/hashicorp/consul/agent/structs"
+	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/consul/ipaddr"
+	multierror "github.com/hashicorp/go-multierror"
+)
+
+// validDatacenter is used to validate a datacenter
+var validDatacenter = regexp.MustCompile("^[a-zA-Z0-9_-]+$")
+
+// ConfigError is a validation error of a configuration. Keys lists the
+// configuration keys whose values cause the error so that callers can
+// point at where they were set.
+type ConfigError struct {
+	Message string
+	Keys    []string
+}
+
+func (e *ConfigError) Error() string {
+	return e.Message
+}
+
+// configErrors returns the single error of errs as it is and multiple
+// errors as a *multierror.Error so that all of them are reported at once.
+func configErrors(errs []error) error {
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return &multierror.Error{Errors: errs}
+}
+
+// configErrorf returns a ConfigError for the given keys.
+func configErrorf(keys []string, format string, args ...interface{}) *ConfigError {
+	return &ConfigError{Message: fmt.Sprintf(format, args...), Keys: keys}
+}
+
+// Validate checks the merged configuration for invalid values and
+// combinations of settings without touching the filesystem or the network,
+// except for reading the data directory encryption key file. It returns all
+// errors in the order they are checked, and warnings about settings which
+// are valid but likely not what was intended.
+func (c *Config) Validate() (warnings []string, errs []error) {
+	return c.validate(true)
+}
+
+// validate implements Validate. If readFiles is false the data directory
+// encryption key file is not read either, so that validating a document
+// for the API does not reveal whether the files it names exist.
+func (c *Config) validate(readFiles bool) (warnings []string, errs []error) {
+	errorf := func(keys []string, format string, args ...interface{}) {
+		errs = append(errs, configErrorf(keys, format, args...))
+	}
+
+	enc := c.DataDirEncryption
+	if readFiles || enc.KeyFile == "" || enc.Key != "" {
+		if _, err := c.DataDirEncryptionKey(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := c.ValidateAudit(); err != nil {
+		errs = append(errs, err)
+	}
+
+	// Ensure all endpoints are unique
+	if err := c.VerifyUniqueListeners(); err != nil {
+		errs = append(errs, err)
+	}
+	errs = append(errs, validatePorts(c.Ports)...)
+
+	// Only the client endpoints and the WAN gossip pool can be disabled.
+	if c.Ports.SerfLan < 0 {
+		errorf([]string{"ports.serf_lan"}, "ports.serf_lan cannot be disabled")
+	}
+	if c.Ports.Server < 0 {
+		errorf([]string{"ports.server"}, "ports.server cannot be disabled")
+	}
+	if c.Ports.SerfWan < 0 {
+		if len(c.StartJoinWan) > 0 || len(c.RetryJoinWan) > 0 {
+			errorf([]string{"ports.serf_wan"}, "start_join_wan and retry_join_wan require ports.serf_wan to be enabled")
+		}
+		if c.TranslateWanAddrs {
+			warnings = append(warnings, "translate_wan_addrs has no effect with ports.serf_wan disabled")
+		}
+	}
+
+	// Verify DNS settings
+	if c.DNSConfig.UDPAnswerLimit < 1 {
+		warnings = append(warnings, fmt.Sprintf("dns_config.udp_answer_limit %d too low, must always be greater than zero", c.DNSConfig.UDPAnswerLimit))
+	}
+	if c.DNSConfig.NodeTTL < 0 {
+		errorf([]string{"dns_config.node_ttl"}, "dns_config.node_ttl cannot be negative")
+	}
+	var services []string
+	for service, ttl := range c.DNSConfig.ServiceTTL {
+		if ttl < 0 {
+			services = append(services, service)
+		}
+	}
+	sort.Strings(services)
+	for _, service := range services {
+		errorf([]string{"dns_config.service_ttl"}, "dns_config.service_ttl of %q cannot be negative", service)
+	}
+	if c.DNSConfig.MaxStale < 0 {
+		errorf([]string{"dns_config.max_stale"}, "dns_config.max_stale cannot be negative")
+	}
+	if c.DNSConfig.RecursorTimeout < 0 {
+		errorf([]string{"dns_config.recursor_timeout"}, "dns_config.recursor_timeout cannot be negative")
+	}
+
+	if _, err := ParseCIDRs(c.SerfLANAllowedCIDRs); err != nil {
+		errs = append(errs, configErrorf([]string{"serf_lan_allowed_cidrs"}, "serf_lan_allowed_cidrs: %s", err))
+	}
+	if _, err := ParseCIDRs(c.SerfWANAllowedCIDRs); err != nil {
+		errs = append(errs, configErrorf([]string{"serf_wan_allowed_cidrs"}, "serf_wan_allowed_cidrs: %s", err))
+	}
+
+	if c.EncryptKey != "" {
+		if err := validateEncryptKey(c.EncryptKey); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if c.GossipKeyRotation.Interval > 0 {
+		if !c.Server {
+			errs = append(errs, fmt.Errorf("gossip_key_rotation can only be configured on servers"))
+		} else if c.GossipKeyRotation.Interval < time.Minute {
+			errs = append(errs, fmt.Errorf("gossip_key_rotation.interval must be at least 1m"))
+		}
+		if c.DisableKeyringFile {
+			errs = append(errs, configErrorf([]string{"gossip_key_rotation.interval", "disable_keyring_file"},
+				"gossip_key_rotation cannot be used with disable_keyring_file, the previous keys are read "+
+					"from the keyring file"))
+		}
+	}
+	if c.GossipKeyRotation.Retain < 1 {
+		errs = append(errs, fmt.Errorf("gossip_key_rotation.retain must be at least 1"))
+	}
+
+	if c.CheckDeregisterIntervalMin < time.Second {
+		errs = append(errs, fmt.Errorf("check_deregister_interval_min must be at least 1s"))
+	} else if c.DeregisterCriticalServiceAfter != 0 && c.DeregisterCriticalServiceAfter < c.CheckDeregisterIntervalMin {
+		errs = append(errs, fmt.Errorf("deregister_critical_service_after must be at least check_deregister_interval_min (%v) or 0 to disable it",
+			c.CheckDeregisterIntervalMin))
+	}
+
+	if addr := c.Reporting.ExportAddress; addr != "" {
+		u, err := url.Parse(addr)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, configErrorf([]string{"reporting.export_address"},
+				"reporting.export_address %q must be an http or https URL", addr))
+		}
+		if c.Reporting.Interval < time.Minute {
+			errs = append(errs, configErrorf([]string{"reporting.interval"}, "reporting.interval must be at least 1m"))
+		}
+	}
+
+	if c.CheckDefaults.HTTP.Timeout < 0 {
+		errs = append(errs, configErrorf([]string{"check_defaults.http.timeout"}, "check_defaults.http.timeout cannot be negative"))
+	}
+	if c.CheckDefaults.HTTP.OutputMaxSize < 0 {
+		errs = append(errs, configErrorf([]string{"check_defaults.http.output_max_size"}, "check_defaults.http.output_max_size cannot be negative"))
+	}
+	if c.CheckOutputMaxSize < 1 {
+		errs = append(errs, fmt.Errorf("check_output_max_size must be at least 1"))
+	}
+
+	if c.ConfigStaleCheckInterval < 0 || (c.ConfigStaleCheckInterval > 0 && c.ConfigStaleCheckInterval < time.Second) {
+		errs = append(errs, fmt.Errorf("config_stale_check_interval must be at least 1s or 0 to disable it"))
+	}
+
+	// Verifying the server hostname implies verifying outgoing connections,
+	// which needs a CA to check the server certificates against.
+	if (c.VerifyOutgoing || c.VerifyServerHostname) && c.CAFile == "" && c.CAPath == "" {
+		if c.VerifyServerHostname {
+			errs = append(errs, fmt.Errorf("verify_server_hostname requires ca_file or ca_path to be set"))
+		} else {
+			errs = append(errs, fmt.Errorf("verify_outgoing requires ca_file or ca_path to be set"))
+		}
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		errorf([]string{"cert_file", "key_file"}, "cert_file and key_file must be set together")
+	} else if c.Ports.HTTPS > 0 && c.CertFile == "" {
+		// Without a certificate the HTTPS listener would not be started.
+		errorf([]string{"ports.https"}, "ports.https requires cert_file and key_file to be set")
+	}
+
+	// Incoming connections are verified against the CA and must be answered
+	// with a certificate of our own.
+	if c.VerifyIncoming || c.VerifyIncomingRPC || c.VerifyIncomingHTTPS {
+		if c.CAFile == "" && c.CAPath == "" {
+			errs = append(errs, fmt.Errorf("verify_incoming requires ca_file or ca_path to be set"))
+		}
+		if c.CertFile == "" || c.KeyFile == "" {
+			errs = append(errs, fmt.Errorf("verify_incoming requires cert_file and key_file to be set"))
+		}
+	}
+
+	// Client certificates can only be matched if they are verified.
+	if len(c.HTTPConfig.AllowedClientSubjects) > 0 {
+		if !c.VerifyIncoming && !c.VerifyIncomingHTTPS {
+			errs = append(errs, fmt.Errorf("http_config.allowed_client_subjects requires verify_incoming or verify_incoming_https"))
+		} else if _, err := NewSubjectAllowlist(c.HTTPConfig.AllowedClientSubjects); err != nil {
+			errs = append(errs, fmt.Errorf("http_config.allowed_client_subjects: %v", err))
+		}
+	}
+
+	if !validDatacenter.MatchString(c.Datacenter) {
+		errs = append(errs, fmt.Errorf("Datacenter must be alpha-numeric with underscores and hypens only"))
+	}
+	if c.ACLDatacenter != "" && !validDatacenter.MatchString(c.ACLDatacenter) {
+		errs = append(errs, fmt.Errorf("ACL datacenter must be alpha-numeric with underscores and hypens only"))
+	}
+
+	// Remote exec runs arbitrary commands written to the KV store, so only
+	// allow it without ACLs when explicitly requested.
+	if c.DisableRemoteExec != nil && !*c.DisableRemoteExec && c.ACLDatacenter == "" && !c.AllowRemoteExecWithoutACLs {
+		errs = append(errs, fmt.Errorf("Remote exec cannot be enabled when ACLs are disabled. "+
+			"Set acl_datacenter or allow_remote_exec_without_acls"))
+	}
+
+	if c.BootstrapExpect < 0 {
+		errorf([]string{"bootstrap_expect"}, "bootstrap_expect cannot be negative")
+	}
+	if c.ReadReplica && !c.Server {
+		errorf([]string{"read_replica"}, "Read replica mode cannot be enabled when server mode is not enabled")
+	}
+
+	// Only allow bootstrap mode when acting as a server
+	if c.Bootstrap && !c.Server {
+		errorf([]string{"bootstrap"}, "Bootstrap mode cannot be enabled when server mode is not enabled")
+	}
+
+	// Expect can only work when acting as a server
+	if c.BootstrapExpect != 0 && !c.Server {
+		errorf([]string{"bootstrap_expect"}, "Expect mode cannot be enabled when server mode is not enabled")
+	}
+
+	// Expect can only work when dev mode is off
+	if c.BootstrapExpect > 0 && c.DevMode {
+		errorf([]string{"bootstrap_expect"}, "Expect mode cannot be enabled when dev mode is enabled")
+	}
+
+	// Expect & Bootstrap are mutually exclusive
+	if c.BootstrapExpect != 0 && c.Bootstrap {
+		errorf([]string{"bootstrap", "bootstrap_expect"}, "Bootstrap cannot be provided with an expected server count")
+	}
+
+	if c.NodeID != "" {
+		if _, err := ValidateNodeID(c.NodeID); err != nil {
+			errorf([]string{"node_id"}, "%s", err)
+		}
+	}
+
+	if c.Protocol < int(consul.ProtocolVersionMin) || c.Protocol > consul.ProtocolVersionMax {
+		errorf([]string{"protocol"}, "protocol version %d is not supported, must be in range [%d, %d]",
+			c.Protocol, consul.ProtocolVersionMin, consul.ProtocolVersionMax)
+	}
+	if c.Performance.RaftMultiplier > consul.MaxRaftMultiplier {
+		errorf([]string{"performance.raft_multiplier"}, "performance.raft_multiplier must be in range [1, %d], or 0 for the default",
+			consul.MaxRaftMultiplier)
+	}
+	if c.RaftProtocol != 0 && (c.RaftProtocol < consul.RaftProtocolVersionMin || c.RaftProtocol > consul.RaftProtocolVersionMax) {
+		errorf([]string{"raft_protocol"}, "raft_protocol version %d is not supported, must be in range [%d, %d]",
+			c.RaftProtocol, consul.RaftProtocolVersionMin, consul.RaftProtocolVersionMax)
+	}
+
+	// Servers speaking an older Raft protocol are added as voters right
+	// away, so the Autopilot features built on non-voters don't apply.
+	if c.Server && c.RaftProtocol < 3 {
+		var features []string
+		if c.ReadReplica {
+			features = append(features, "read_replica")
+		}
+		if c.Autopilot.ServerStabilizationTimeRaw != "" {
+			features = append(features, "autopilot.server_stabilization_time")
+		}
+		if c.Autopilot.RedundancyZoneTag != "" {
+			features = append(features, "autopilot.redundancy_zone_tag")
+		}
+		if c.Autopilot.DisableUpgradeMigration != nil {
+			features = append(features, "autopilot.disable_upgrade_migration")
+		}
+		for _, feature := range features {
+			warnings = append(warnings, fmt.Sprintf("%s requires raft_protocol 3 and has no effect", feature))
+		}
+	}
+
+	errs = append(errs, validateRetryJoin("retry_join", c.RetryJoin)...)
+	errs = append(errs, validateRetryJoin("retry_join_wan", c.RetryJoinWan)...)
+
+	// The tagged addresses are published as they are, so remote agents
+	// translating to them need an address they can connect to.
+	for _, tag := range []string{"lan", "wan"} {
+		if addr, ok := c.TaggedAddresses[tag]; ok && net.ParseIP(addr) == nil {
+			errorf([]string{"tagged_addresses." + tag}, "tagged_addresses.%s must be a valid IP address, got %q", tag, addr)
+		}
+	}
+
+	if ipaddr.IsAny(c.AdvertiseAddr) {
+		errs = append(errs, fmt.Errorf("Advertise address cannot be %s", c.AdvertiseAddr))
+	}
+	if ipaddr.IsAny(c.AdvertiseAddrWan) {
+		errs = append(errs, fmt.Errorf("Advertise WAN address cannot be %s", c.AdvertiseAddrWan))
+	}
+
+	// The permissions of the unix sockets are applied when the listeners
+	// are created, which is too late to report them as configuration errors.
+	if u := c.UnixSockets; u.Grp != "" {
+		if _, err := strconv.Atoi(u.Grp); err != nil {
+			errorf([]string{"unix_sockets.group"}, "unix_sockets.group must be a numeric group id, got %q", u.Grp)
+		}
+	}
+	if u := c.UnixSockets; u.Perms != "" {
+		if mode, err := strconv.ParseUint(u.Perms, 8, 32); err != nil || mode > 0777 {
+			errorf([]string{"unix_sockets.mode"}, "unix_sockets.mode must be octal file permissions like \"0770\", got %q", u.Perms)
+		}
+	}
+	if c.UnixSockets != (UnixSocketConfig{}) && !c.hasUnixSocketAddr() {
+		warnings = append(warnings, "unix_sockets has no effect since no client address is a unix socket")
+	}
+
+	if c.StartInMaintenanceReason != "" && !c.StartInMaintenance {
+		warnings = append(warnings, "start_in_maintenance_reason has no effect without start_in_maintenance")
+	}
+
+	// Verify the node metadata entries are valid
+	if l := c.NodeMetaLimits; l.MaxKeys < 0 || l.MaxKeyLength < 0 || l.MaxValueLength < 0 {
+		errs = append(errs, configErrorf([]string{"node_meta_limits"}, "node_meta_limits cannot be negative"))
+	} else if err := structs.ValidateMetadataLimits(c.Meta, c.NodeMetaLimits.MetaLimits()); err != nil {
+		warnings = append(warnings, fmt.Sprintf("Failed to parse node metadata: %v", err))
+	}
+
+	// The services are registered after the configuration is loaded, so
+	// check them here to report their mistakes along with the others.
+	ids := make(map[string]int)
+	for i, s := range c.Services {
+		if s.Name == "" {
+			errorf([]string{"services"}, "services[%d]: name missing", i)
+			continue
+		}
+		if err := structs.ValidateMetadata(s.Meta); err != nil {
+			errorf([]string{"services"}, "services[%d]: invalid meta: %v", i, err)
+		}
+		id := s.NodeService().ID
+		if j, ok := ids[id]; ok {
+			warnings = append(warnings, fmt.Sprintf("services[%d] replaces services[%d] with the same id %q", i, j, id))
+		}
+		ids[id] = i
+
+		if !isZeroCheckType(&s.Check) {
+			checkErrs, checkWarnings := validateCheckType(&s.Check)
+			for _, msg := range checkErrs {
+				errorf([]string{"services"}, "services[%d].check: %s", i, msg)
+			}
+			for _, msg := range checkWarnings {
+				warnings = append(warnings, fmt.Sprintf("services[%d].check: %s", i, msg))
+			}
+		}
+		for j, chk := range s.Checks {
+			checkErrs, checkWarnings := validateCheckType(chk)
+			for _, msg := range checkErrs {
+				errorf([]string{"services"}, "services[%d].checks[%d]: %s", i, j, msg)
+			}
+			for _, msg := range checkWarnings {
+				warnings = append(warnings, fmt.Sprintf("services[%d].checks[%d]: %s", i, j, msg))
+			}
+		}
+	}
+	for i, chk := range c.Checks {
+		if chk.ID == "" && chk.Name == "" {
+			errorf([]string{"checks"}, "checks[%d]: name missing", i)
+		}
+		checkErrs, checkWarnings := validateCheckType(chk.CheckType())
+		for _, msg := range checkErrs {
+			errorf([]string{"checks"}, "checks[%d]: %s", i, msg)
+		}
+		for _, msg := range checkWarnings {
+			warnings = append(warnings, fmt.Sprintf("checks[%d]: %s", i, msg))
+		}
+	}
+
+	// It doesn't make sense to include both UI options.
+	if c.EnableUI && c.UIDir != "" {
+		errs = append(errs, fmt.Errorf("Both the ui and ui-dir flags were specified, please provide only one\n"+
+			"If trying to use your own web UI resources, use the ui-dir flag\n"+
+			"If using Consul version 0.7.0 or later, the web UI is included in the binary so use ui to enable it"))
+	}
+	return warnings, errs
+}
+
+// validateCheckType returns the problems of a check definition: exactly
+// one of script, http, tcp and ttl must be set, all but TTL checks need an
+// interval, and the durations and initial status must be valid.
+func validateCheckType(chk *structs.CheckType) (errs, warnings []string) {
+	var kinds []string
+	if chk.Script != "" {
+		kinds = append(kinds, "script")
+	}
+	if chk.HTTP != "" {
+		kinds = append(kinds, "http")
+	}
+	if chk.TCP != "" {
+		kinds = append(kinds, "tcp")
+	}
+	if chk.TTL != 0 {
+		kinds = append(kinds, "ttl")
+	}
+	switch len(kinds) {
+	case 0:
+		errs = append(errs, "one of script, http, tcp and ttl must be set")
+	case 1:
+	default:
+		errs = append(errs, fmt.Sprintf("only one of script, http, tcp and ttl may be set, got %s", strings.Join(kinds, ", ")))
+	}
+
+	if chk.DockerContainerID != "" && chk.Script == "" {
+		errs = append(errs, "docker_container_id requires script")
+	}
+	if chk.TTL < 0 {
+		errs = append(errs, "ttl cannot be negative")
+	}
+	if chk.Script != "" || chk.HTTP != "" || chk.TCP != "" {
+		switch {
+		case chk.Interval <= 0:
+			errs = append(errs, fmt.Sprintf("interval must be set for a %s check", kinds[0]))
+		case chk.Interval < MinInterval:
+			warnings = append(warnings, fmt.Sprintf("interval %v is below the minimum of %v and is raised to it", chk.Interval, MinInterval))
+		}
+	}
+	if chk.Timeout < 0 {
+		errs = append(errs, "timeout cannot be negative")
+	}
+
+	switch chk.Status {
+	case "", api.HealthPassing, api.HealthWarning, api.HealthCritical:
+	default:
+		errs = append(errs, fmt.Sprintf("status %q must be one of passing, warning and critical", chk.Status))
+	}
+	return errs, warnings
+}
+
+// isZeroCheckType returns true if none of the fields of the check of a
+// service definition are set.
+func isZeroCheckType(chk *structs.CheckType) bool {
+	return reflect.DeepEqual(*chk, structs.CheckType{})
+}
+
+// ConfigValidation is the result of validating a configuration document
+// against the running agent.
+type ConfigValidation struct {
+	// Valid is true if the agent would start with the configuration.
+	Valid bool
+
+	// Errors and Warnings are the problems found in the configuration.
+	Errors   []*ConfigError
+	Warnings []string
+
+	// Changes are the keys set by the document whose values differ from
+	// the running configuration.
+	Changes []ConfigChange
+}
+
+// ConfigChange is a configuration key whose value differs from the running
+// configuration.
+type ConfigChange struct {
+	Key string
+
+	// Reloadable is true if the new value is applied by a reload, and
+	// false if it requires a restart of the agent.
+	Reloadable bool
+}
+
+// ParseCIDRs parses a list of networks in CIDR notation, like
+// serf_lan_allowed_cidrs.
+func ParseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// ValidateConfigDocument decodes the JSON or HCL configuration document
+// like a configuration file, merges it over the defaults and validates the
+// result without reading the files it names. The keys set by the document
+// are compared with the running configuration cur. Keys which are not set
+// are not compared since they may be set by command line flags or other
+// configuration files of the agent. Secrets are not compared, so that the
+// result does not reveal whether they match the running configuration.
+func ValidateConfigDocument(data []byte, limits ConfigLimits, cur *Config) *ConfigValidation {
+	result := &ConfigValidation{}
+	fail := func(err error) *ConfigValidation {
+		result.Errors = append(result.Errors, &ConfigError{Message: err.Error()})
+		return result
+	}
+
+	if limits.MaxFileSize > 0 && int64(len(data)) > limits.MaxFileSize {
+		return fail(fmt.Errorf("document is larger than the limit of %d bytes", limits.MaxFileSize))
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		var err error
+		if data, err = hclToJSON(string(data)); err != nil {
+			return fail(err)
+		}
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fail(err)
+	}
+	doc, err := decodeConfigData("request body", data, limits, nil, false, false)
+	if err != nil {
+		return fail(err)
+	}
+
+	next := MergeConfig(DefaultConfig(), doc)
+	warnings, errs := next.validate(false)
+	result.Warnings = append(warnings, doc.Deprecations...)
+	for _, err := range errs {
+		if ce, ok := err.(*ConfigError); ok {
+			result.Errors = append(result.Errors, ce)
+		} else {
+			fail(err)
+		}
+	}
+	result.Valid = len(result.Errors) == 0
+
+	// The agent lowercases the datacenters of the running configuration.
+	next.Datacenter = strings.ToLower(next.Datacenter)
+	next.ACLDatacenter = strings.ToLower(next.ACLDatacenter)
+	MigrateLegacyConfig(raw)
+	result.Changes = configChanges(cur, next, raw)
+	return result
+}
+
+// configChanges returns the changes from cur to next of the keys set in
+// the decoded configuration document raw, sorted by key. The secret keys
+// are left out and the other keys are compared with their secrets, like
+// the tokens of services, hidden.
+func configChanges(cur, next *Config, raw map[string]interface{}) []ConfigChange {
+	set := make(map[string]bool)
+	fields := mergeFieldsForConfig()
+	var walk func(obj map[string]interface{}, prefix string)
+	walk = func(obj map[string]interface{}, prefix string) {
+		for k, v := range obj {
+			key := prefix + k
+			switch key {
+			case "service":
+				key = "services"
+			case "check":
+				key = "checks"
+			}
+			f := findMergeField(fields, key)
+			if f == nil {
+				continue
+			}
+			if m, ok := v.(map[string]interface{}); ok && (f.kind == mergeStruct || f.kind == mergeStructPtr) {
+				walk(m, key+".")
+				continue
+			}
+			set[key] = true
+		}
+	}
+	walk(raw, "")
+
+	var changes []ConfigChange
+	for _, change := range cur.Sanitized().Diff(next.Sanitized()) {
+		if set[change.Key] && !secretConfigKeys[change.Key] {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// validatePorts checks the port ranges of the ports block and that the
+// ports of the endpoints are outside of them.
+func validatePorts(p PortConfig) []error {
+	type portRange struct {
+		name     string
+		min, max int
+	}
+	var ranges []portRange
+	var errs []error
+	for _, r := range []portRange{
+		{"sidecar", p.SidecarMinPort, p.SidecarMaxPort},
+		{"expose", p.ExposeMinPort, p.ExposeMaxPort},
+	} {
+		keys := []string{"ports." + r.name + "_min_port", "ports." + r.name + "_max_port"}
+		switch {
+		case r.min <= 0 || r.max > 65535:
+			errs = append(errs, configErrorf(keys, "ports.%s_min_port and ports.%s_max_port must be in range [1, 65535], got %d and %d",
+				r.name, r.name, r.min, r.max))
+		case r.min > r.max:
+			errs = append(errs, configErrorf(keys, "ports.%s_min_port %d must not be greater than ports.%s_max_port %d",
+				r.name, r.min, r.name, r.max))
+		default:
+			ranges = append(ranges, r)
+		}
+	}
+	if len(ranges) == 2 && ranges[0].min <= ranges[1].max && ranges[1].min <= ranges[0].max {
+		errs = append(errs, configErrorf([]string{"ports.sidecar_min_port", "ports.expose_min_port"},
+			"the ports.sidecar range %d-%d and the ports.expose range %d-%d overlap",
+			ranges[0].min, ranges[0].max, ranges[1].min, ranges[1].max))
+	}
+
+	fixed := []struct {
+		key  string
+		port int
+	}{
+		{"ports.dns", p.DNS},
+		{"ports.http", p.HTTP},
+		{"ports.https", p.HTTPS},
+		{"ports.grpc", p.GRPC},
+		{"ports.serf_lan", p.SerfLan},
+		{"ports.serf_wan", p.SerfWan},
+		{"ports.server", p.Server},
+	}
+	for _, f := range fixed {
+		for _, r := range ranges {
+			if f.port >= r.min && f.port <= r.max {
+				errs = append(errs, configErrorf([]string{f.key}, "%s %d is in the ports.%s range %d-%d",
+					f.key, f.port, r.name, r.min, r.max))
+			}
+		}
+	}
+	return errs
+}
+
+// hasUnixSocketAddr returns true if one of the client endpoints listens on
+// a unix socket.
+func (c *Config) hasUnixSocketAddr() bool {
+	for _, addrs := range []string{c.ClientAddr, c.Addresses.DNS, c.Addresses.HTTP, c.Addresses.HTTPS} {
+		for _, addr := range splitAddrs(addrs) {
+			if socketPath(addr) != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,360 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/consul/agent/structs"
+	"github.com/pascaldekloe/goe/verify"
+)
+
+func TestValidDatacenter(t *testing.T) {
+	t.Parallel()
+	shouldMatch := []string{
+		"dc1",
+		"east-aws-001",
+		"PROD_aws01-small",
+	}
+	noMatch := []string{
+		"east.aws",
+		"east!aws",
+		"first,second",
+	}
+	for _, m := range shouldMatch {
+		if !validDatacenter.MatchString(m) {
+			t.Fatalf("expected match: %s", m)
+		}
+	}
+	for _, m := range noMatch {
+		if validDatacenter.MatchString(m) {
+			t.Fatalf("expected no match: %s", m)
+		}
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		desc     string
+		in       string
+		errs     []string
+		keys     [][]string
+		warnings []string
+	}{
+		{desc: "defaults", in: `{}`},
+		{
+			desc: "bootstrap",
+			in:   `{"bootstrap": true, "bootstrap_expect": 3}`,
+			errs: []string{
+				"Bootstrap mode cannot be enabled when server mode is not enabled",
+				"Expect mode cannot be enabled when server mode is not enabled",
+				"Bootstrap cannot be provided with an expected server count",
+			},
+			keys: [][]string{{"bootstrap"}, {"bootstrap_expect"}, {"bootstrap", "bootstrap_expect"}},
+		},
+		{
+			desc: "datacenter",
+			in:   `{"datacenter": "east.aws", "check_output_max_size": 0, "protocol": 4, "performance": {"raft_multiplier": 11}}`,
+			errs: []string{
+				"Datacenter must be alpha-numeric with underscores and hypens only",
+				"protocol version 4 is not supported, must be in range [2, 3]",
+				"performance.raft_multiplier must be in range [1, 10], or 0 for the default",
+			},
+			keys: [][]string{nil, {"protocol"}, {"performance.raft_multiplier"}},
+		},
+		{
+			desc: "gossip key rotation without keyring file",
+			in:   `{"server": true, "disable_keyring_file": true, "gossip_key_rotation": {"interval": "720h"}}`,
+			errs: []string{"gossip_key_rotation cannot be used with disable_keyring_file, the previous keys are read from the keyring file"},
+			keys: [][]string{{"gossip_key_rotation.interval", "disable_keyring_file"}},
+		},
+		{
+			desc: "encryption key",
+			in:   `{"encrypt": "not base64"}`,
+			errs: []string{"Invalid encryption key: illegal base64 data at input byte 3. The key must be base64 encoded, use 'consul keygen' to generate one"},
+			keys: [][]string{{"encrypt"}},
+		},
+		{
+			desc: "encryption key size",
+			in:   `{"encrypt": "a2V5"}`,
+			errs: []string{"Invalid encryption key: key size must be 16, 24 or 32 bytes, got 3 bytes. Use 'consul keygen' to generate a valid key"},
+			keys: [][]string{{"encrypt"}},
+		},
+		{
+			desc: "reporting",
+			in:   `{"reporting": {"export_address": "usage.example.com:443", "interval": "10s"}}`,
+			errs: []string{
+				`reporting.export_address "usage.example.com:443" must be an http or https URL`,
+				"reporting.interval must be at least 1m",
+			},
+			keys: [][]string{{"reporting.export_address"}, {"reporting.interval"}},
+		},
+		{
+			desc: "dns config",
+			in: `{"dns_config": {"node_ttl": "-1s", "service_ttl": {"web": "-5s", "*": "5s", "db": "-1s"},
+				"max_stale": "-1m", "recursor_timeout": "-2s"}}`,
+			errs: []string{
+				"dns_config.node_ttl cannot be negative",
+				`dns_config.service_ttl of "db" cannot be negative`,
+				`dns_config.service_ttl of "web" cannot be negative`,
+				"dns_config.max_stale cannot be negative",
+				"dns_config.recursor_timeout cannot be negative",
+			},
+			keys: [][]string{
+				{"dns_config.node_ttl"}, {"dns_config.service_ttl"}, {"dns_config.service_ttl"},
+				{"dns_config.max_stale"}, {"dns_config.recursor_timeout"},
+			},
+		},
+		{
+			desc: "check defaults",
+			in:   `{"check_defaults": {"http": {"timeout": "-1s", "output_max_size": -1}}}`,
+			errs: []string{
+				"check_defaults.http.timeout cannot be negative",
+				"check_defaults.http.output_max_size cannot be negative",
+			},
+			keys: [][]string{{"check_defaults.http.timeout"}, {"check_defaults.http.output_max_size"}},
+		},
+		{
+			desc: "tls",
+			in:   `{"verify_incoming_rpc": true, "cert_file": "a.pem"}`,
+			errs: []string{
+				"cert_file and key_file must be set together",
+				"verify_incoming requires ca_file or ca_path to be set",
+				"verify_incoming requires cert_file and key_file to be set",
+			},
+			keys: [][]string{{"cert_file", "key_file"}, nil, nil},
+		},
+		{
+			desc: "unix sockets",
+			in:   `{"addresses": {"http": "unix:///tmp/consul.sock"}, "unix_sockets": {"user": "consul", "group": "wheel", "mode": "0999"}}`,
+			errs: []string{
+				`unix_sockets.group must be a numeric group id, got "wheel"`,
+				`unix_sockets.mode must be octal file permissions like "0770", got "0999"`,
+			},
+			keys: [][]string{{"unix_sockets.group"}, {"unix_sockets.mode"}},
+		},
+		{
+			desc:     "unix sockets without socket address",
+			in:       `{"unix_sockets": {"mode": "0770"}}`,
+			warnings: []string{"unix_sockets has no effect since no client address is a unix socket"},
+		},
+		{
+			desc: "tagged addresses",
+			in:   `{"tagged_addresses": {"lan": "10.0.0.1", "wan": "example.com", "public": "example.com"}}`,
+			errs: []string{`tagged_addresses.wan must be a valid IP address, got "example.com"`},
+			keys: [][]string{{"tagged_addresses.wan"}},
+		},
+		{
+			desc: "port ranges",
+			in:   `{"ports": {"sidecar_min_port": 21255, "sidecar_max_port": 21000, "expose_min_port": -1}}`,
+			errs: []string{
+				"ports.sidecar_min_port 21255 must not be greater than ports.sidecar_max_port 21000",
+				"ports.expose_min_port and ports.expose_max_port must be in range [1, 65535], got -1 and 21755",
+			},
+			keys: [][]string{
+				{"ports.sidecar_min_port", "ports.sidecar_max_port"},
+				{"ports.expose_min_port", "ports.expose_max_port"},
+			},
+		},
+		{
+			desc: "port range overlaps",
+			in:   `{"ports": {"http": 21100, "sidecar_max_port": 21600}}`,
+			errs: []string{
+				"the ports.sidecar range 21000-21600 and the ports.expose range 21500-21755 overlap",
+				"ports.http 21100 is in the ports.sidecar range 21000-21600",
+			},
+			keys: [][]string{{"ports.sidecar_min_port", "ports.expose_min_port"}, {"ports.http"}},
+		},
+		{
+			desc: "disabled ports",
+			in:   `{"ports": {"serf_lan": -1, "server": -1, "serf_wan": -1}, "retry_join_wan": ["10.0.0.1"], "translate_wan_addrs": true}`,
+			errs: []string{
+				"ports.serf_lan cannot be disabled",
+				"ports.server cannot be disabled",
+				"start_join_wan and retry_join_wan require ports.serf_wan to be enabled",
+			},
+			keys:     [][]string{{"ports.serf_lan"}, {"ports.server"}, {"ports.serf_wan"}},
+			warnings: []string{"translate_wan_addrs has no effect with ports.serf_wan disabled"},
+		},
+		{
+			desc: "https without certificate",
+			in:   `{"ports": {"https": 8501}}`,
+			errs: []string{"ports.https requires cert_file and key_file to be set"},
+			keys: [][]string{{"ports.https"}},
+		},
+		{
+			desc: "serf allowed cidrs",
+			in:   `{"serf_lan_allowed_cidrs": ["10.0.0.0/8", "10.1.0.0"], "serf_wan_allowed_cidrs": ["fd00::/8"]}`,
+			errs: []string{"serf_lan_allowed_cidrs: invalid CIDR address: 10.1.0.0"},
+			keys: [][]string{{"serf_lan_allowed_cidrs"}},
+		},
+		{
+			desc:     "warnings",
+			in:       `{"server": true, "read_replica": true, "dns_config": {"udp_answer_limit": -1}, "start_in_maintenance_reason": "rebuild"}`,
+			warnings: []string{
+				"dns_config.udp_answer_limit -1 too low, must always be greater than zero",
+				"read_replica requires raft_protocol 3 and has no effect",
+				"start_in_maintenance_reason has no effect without start_in_maintenance",
+			},
+		},
+		{
+			desc:     "node meta limits",
+			in:       `{"node_meta": {"rack": "rack1"}, "node_meta_limits": {"max_keys": 100, "max_value_length": 4}}`,
+			warnings: []string{"Failed to parse node metadata: Couldn't load metadata pair ('rack', 'rack1'): Value is too long (limit: 4 characters)"},
+		},
+		{
+			desc: "services",
+			in: `{"services": [{"name": "web", "meta": {"consul-version": "1"}}, {"port": 80},
+				{"id": "web", "name": "web2"}, {"name": "db", "meta": {"version": "1"}}]}`,
+			errs: []string{
+				"services[0]: invalid meta: Couldn't load metadata pair ('consul-version', '1'): Key prefix 'consul-' is reserved for internal use",
+				"services[1]: name missing",
+			},
+			keys:     [][]string{{"services"}, {"services"}},
+			warnings: []string{`services[2] replaces services[0] with the same id "web"`},
+		},
+		{
+			desc: "checks",
+			in: `{
+				"service": {"name": "web", "check": {"http": "http://localhost", "tcp": "localhost:80", "interval": "10s"},
+					"checks": [{"http": "http://localhost"}, {"ttl": "10s", "status": "passing"}]},
+				"checks": [
+					{"name": "a", "interval": "10s"},
+					{"id": "b", "script": "true", "interval": "100ms", "timeout": "-1s"},
+					{"ttl": "10s", "status": "ok", "docker_container_id": "abc"}
+				]
+			}`,
+			errs: []string{
+				"services[0].check: only one of script, http, tcp and ttl may be set, got http, tcp",
+				"services[0].checks[0]: interval must be set for a http check",
+				"checks[0]: one of script, http, tcp and ttl must be set",
+				"checks[1]: timeout cannot be negative",
+				"checks[2]: name missing",
+				"checks[2]: docker_container_id requires script",
+				`checks[2]: status "ok" must be one of passing, warning and critical`,
+			},
+			keys: [][]string{{"services"}, {"services"}, {"checks"}, {"checks"}, {"checks"}, {"checks"}, {"checks"}},
+			warnings: []string{"checks[1]: interval 100ms is below the minimum of 1s and is raised to it"},
+		},
+		{
+			desc: "retry join",
+			in: `{"retry_join": ["10.0.0.1", "provider=aws tag_key=consul tag_value=server", "provider=ec2 tag_key=consul"],
+				"retry_join_wan": ["provider=gce project_name=x secret"]}`,
+			errs: []string{
+				`retry_join[2]: unknown provider "ec2", must be one of aws, azure, gce, softlayer`,
+				"retry_join_wan[0]: invalid format: secret",
+			},
+			keys: [][]string{{"retry_join"}, {"retry_join_wan"}},
+		},
+		{
+			desc: "negative node meta limits",
+			in:   `{"node_meta_limits": {"max_keys": -1}}`,
+			errs: []string{"node_meta_limits cannot be negative"},
+			keys: [][]string{{"node_meta_limits"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			c, err := DecodeConfig(strings.NewReader(tt.in))
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			warnings, errs := MergeConfig(DefaultConfig(), c).Validate()
+			var msgs []string
+			var keys [][]string
+			for _, err := range errs {
+				msgs = append(msgs, err.Error())
+				var k []string
+				if ce, ok := err.(*ConfigError); ok {
+					k = ce.Keys
+				}
+				keys = append(keys, k)
+			}
+			if !verify.Values(t, "errors", msgs, tt.errs) {
+				t.FailNow()
+			}
+			if tt.keys != nil && !verify.Values(t, "keys", keys, tt.keys) {
+				t.FailNow()
+			}
+			verify.Values(t, "warnings", warnings, tt.warnings)
+		})
+	}
+}
+
+func TestValidateConfigDocument(t *testing.T) {
+	t.Parallel()
+	cur := MergeConfig(DefaultConfig(), &Config{
+		Datacenter: "dc1",
+		LogLevel:   "INFO",
+		ACLToken:   "secret",
+		Telemetry:  Telemetry{StatsdAddr: "127.0.0.1:8125"},
+		Services:   []*structs.ServiceDefinition{{Name: "web", Token: "secret"}},
+	})
+
+	tests := []struct {
+		desc    string
+		in      string
+		valid   bool
+		errs    []string
+		changes []ConfigChange
+	}{
+		{
+			desc:  "unchanged",
+			in:    `{"datacenter": "DC1", "log_level": "INFO"}`,
+			valid: true,
+		},
+		{
+			desc:  "json",
+			in:    `{"datacenter": "dc2", "log_level": "DEBUG", "telemetry": {"statsd_address": "127.0.0.1:8125", "prefix_filter": ["+consul.raft"]}}`,
+			valid: true,
+			changes: []ConfigChange{
+				{Key: "datacenter", Reloadable: false},
+				{Key: "log_level", Reloadable: true},
+				{Key: "telemetry.prefix_filter", Reloadable: true},
+			},
+		},
+		{
+			desc:  "hcl",
+			in:    "check_update_interval = \"10s\"\nnode_meta { rack = \"a\" }",
+			valid: true,
+			changes: []ConfigChange{
+				{Key: "check_update_interval", Reloadable: false},
+				{Key: "node_meta", Reloadable: true},
+			},
+		},
+		{
+			desc:    "invalid",
+			in:      `{"bootstrap": true}`,
+			errs:    []string{"Bootstrap mode cannot be enabled when server mode is not enabled"},
+			changes: []ConfigChange{{Key: "bootstrap", Reloadable: false}},
+		},
+		{
+			desc:  "secrets",
+			in:    `{"acl_token": "guess", "service": {"name": "web", "token": "guess"}}`,
+			valid: true,
+		},
+		{
+			desc:  "files are not read",
+			in:      `{"data_dir_encryption": {"key_file": "/does/not/exist"}}`,
+			valid:   true,
+			changes: []ConfigChange{{Key: "data_dir_encryption.key_file", Reloadable: false}},
+		},
+		{
+			desc: "syntax",
+			in:   `{"bootstrap": }`,
+			errs: []string{"invalid character '}' looking for beginning of value"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			got := ValidateConfigDocument([]byte(tt.in), DefaultConfigLimits(), cur)
+			var msgs []string
+			for _, err := range got.Errors {
+				msgs = append(msgs, err.Message)
+			}
+			verify.Values(t, "valid", got.Valid, tt.valid)
+			verify.Values(t, "errors", msgs, tt.errs)
+			verify.Values(t, "changes", got.Changes, tt.changes)
+		})
+	}
+}
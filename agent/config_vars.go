@@ -0,0 +1,196 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl"
+)
+
+// configVarPrefix is the prefix of the references to declared variables,
+// e.g. ${var.dc}.
+const configVarPrefix = "var."
+
+// ConfigVariable is a variable declared in a configuration file, e.g. with
+// "variable": {"dc": {"default": "dc1"}} in JSON or with
+// variable "dc" { default = "dc1" } in HCL.
+type ConfigVariable struct {
+	// Name is the name of the variable.
+	Name string
+
+	// Default is the value of the variable if it is not set. Variables
+	// without a default must be set.
+	Default *string
+
+	// Path is the file the variable is declared in.
+	Path string
+}
+
+// ReadConfigVariables returns the variables declared in the configuration
+// files at the given paths by name. Files exceeding the limits are
+// rejected.
+func ReadConfigVariables(paths []string, limits ConfigLimits) (map[string]*ConfigVariable, error) {
+	decls := make(map[string]*ConfigVariable)
+	for _, cf := range configFiles(paths) {
+		if cf.err != nil {
+			return nil, cf.err
+		}
+		data, err := readConfigFileData(cf.path, limits)
+		if err != nil {
+			return nil, err
+		}
+		if err := decodeConfigVariables(cf.path, data, decls); err != nil {
+			return nil, err
+		}
+	}
+	return decls, nil
+}
+
+// LocalConfigVariables adds the variables declared in the
+// CONSUL_LOCAL_CONFIG document to decls. Variables which are also declared
+// in the configuration files are rejected.
+func LocalConfigVariables(data string, decls map[string]*ConfigVariable) error {
+	b := []byte(data)
+	if !strings.HasPrefix(strings.TrimSpace(data), "{") {
+		var err error
+		if b, err = hclToJSON(data); err != nil {
+			return fmt.Errorf("Error decoding '%s': %s", LocalConfigEnv, err)
+		}
+	}
+	return decodeConfigVariables(LocalConfigEnv, b, decls)
+}
+
+// decodeConfigVariables adds the variables declared in the JSON
+// configuration document from path to decls.
+func decodeConfigVariables(path string, data []byte, decls map[string]*ConfigVariable) error {
+	var doc struct {
+		Variable map[string]struct {
+			Default interface{} `json:"default"`
+		} `json:"variable"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("Error decoding '%s': %s", path, err)
+	}
+	for name, v := range doc.Variable {
+		if !envNameRe.MatchString(name) {
+			return fmt.Errorf("Error decoding '%s': invalid variable name %q", path, name)
+		}
+		if d, ok := decls[name]; ok {
+			return fmt.Errorf("Error decoding '%s': variable %q is already declared in '%s'", path, name, d.Path)
+		}
+		decl := &ConfigVariable{Name: name, Path: path}
+		if v.Default != nil {
+			s, err := configVarString(v.Default)
+			if err != nil {
+				return fmt.Errorf("Error decoding '%s': variable %q: %s", path, name, err)
+			}
+			decl.Default = &s
+		}
+		decls[name] = decl
+	}
+	return nil
+}
+
+// ReadVarFile reads a file which sets variables with name = "value" lines
+// in HCL or a JSON object.
+func ReadVarFile(path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading '%s': %s", path, err)
+	}
+	var raw map[string]interface{}
+	if err := hcl.Decode(&raw, string(data)); err != nil {
+		return nil, fmt.Errorf("Error decoding '%s': %s", path, err)
+	}
+	values := make(map[string]string, len(raw))
+	for name, v := range raw {
+		s, err := configVarString(v)
+		if err != nil {
+			return nil, fmt.Errorf("Error decoding '%s': variable %q: %s", path, name, err)
+		}
+		values[name] = s
+	}
+	return values, nil
+}
+
+// configVarString returns the string of a scalar variable value.
+func configVarString(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case bool, int, int64, float64:
+		return fmt.Sprint(v), nil
+	default:
+		return "", fmt.Errorf("value must be a string, number or boolean")
+	}
+}
+
+// ResolveConfigVariables returns the values of the declared variables as
+// the interpolation variables of the configuration files, e.g. "var.dc".
+// The values override the defaults. Setting a variable which was not
+// declared is an error, as is a declared variable without a value.
+func ResolveConfigVariables(decls map[string]*ConfigVariable, values map[string]string) (map[string]string, error) {
+	var undeclared []string
+	for name := range values {
+		if _, ok := decls[name]; !ok {
+			undeclared = append(undeclared, name)
+		}
+	}
+	if len(undeclared) > 0 {
+		sort.Strings(undeclared)
+		return nil, fmt.Errorf("Variables are set but not declared: %s", strings.Join(undeclared, ", "))
+	}
+
+	vars := make(map[string]string, len(decls))
+	var unset []string
+	for name, decl := range decls {
+		switch v, ok := values[name]; {
+		case ok:
+			vars[configVarPrefix+name] = v
+		case decl.Default != nil:
+			vars[configVarPrefix+name] = *decl.Default
+		default:
+			unset = append(unset, name)
+		}
+	}
+	if len(unset) > 0 {
+		sort.Strings(unset)
+		return nil, fmt.Errorf("Variables are declared but not set: %s", strings.Join(unset, ", "))
+	}
+	return vars, nil
+}
+
+// undefinedConfigVar returns the name of the first ${var.NAME} reference
+// in the decoded JSON value v, which is left after all declared variables
+// were interpolated.
+func undefinedConfigVar(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		for _, m := range interpolateRe.FindAllStringSubmatch(v, -1) {
+			if strings.HasPrefix(m[1], configVarPrefix) {
+				return m[1]
+			}
+		}
+	case []interface{}:
+		for _, e := range v {
+			if name := undefinedConfigVar(e); name != "" {
+				return name
+			}
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if name := undefinedConfigVar(v[k]); name != "" {
+				return name
+			}
+		}
+	}
+	return ""
+}
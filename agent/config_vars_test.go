@@ -0,0 +1,137 @@
+package agent
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/consul/testutil"
+	"github.com/pascaldekloe/goe/verify"
+)
+
+func TestReadConfigVariables(t *testing.T) {
+	t.Parallel()
+	td := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(td)
+
+	files := map[string]string{
+		"a.json": `{"variable": {"dc": {"default": "dc1"}, "port": {"default": 8600}}}`,
+		"b.json": `{"variable": {"node": {}}, "node_name": "${var.node}"}`,
+		"c.json": `{"variable": {"dc": {}}}`,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(td, name), []byte(content), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	a, b := filepath.Join(td, "a.json"), filepath.Join(td, "b.json")
+	decls, err := ReadConfigVariables([]string{a, b}, DefaultConfigLimits())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	dc1, port := "dc1", "8600"
+	want := map[string]*ConfigVariable{
+		"dc":   &ConfigVariable{Name: "dc", Default: &dc1, Path: a},
+		"port": &ConfigVariable{Name: "port", Default: &port, Path: a},
+		"node": &ConfigVariable{Name: "node", Path: b},
+	}
+	verify.Values(t, "", decls, want)
+
+	if err := LocalConfigVariables(`variable "rack" { default = "r1" }`, decls); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if got := decls["rack"]; got == nil || *got.Default != "r1" || got.Path != LocalConfigEnv {
+		t.Fatalf("got %#v", got)
+	}
+
+	_, err = ReadConfigVariables([]string{td}, DefaultConfigLimits())
+	if err == nil || !strings.Contains(err.Error(), `c.json': variable "dc" is already declared in '`+a+`'`) {
+		t.Fatalf("got error %v", err)
+	}
+}
+
+func TestResolveConfigVariables(t *testing.T) {
+	t.Parallel()
+	dc1 := "dc1"
+	decls := map[string]*ConfigVariable{
+		"dc":   &ConfigVariable{Name: "dc", Default: &dc1},
+		"node": &ConfigVariable{Name: "node"},
+	}
+	tests := []struct {
+		desc   string
+		values map[string]string
+		vars   map[string]string
+		err    string
+	}{
+		{
+			desc:   "defaults",
+			values: map[string]string{"node": "a"},
+			vars:   map[string]string{"var.dc": "dc1", "var.node": "a"},
+		},
+		{
+			desc:   "override",
+			values: map[string]string{"node": "a", "dc": "dc2"},
+			vars:   map[string]string{"var.dc": "dc2", "var.node": "a"},
+		},
+		{
+			desc:   "not set",
+			values: map[string]string{},
+			err:    "Variables are declared but not set: node",
+		},
+		{
+			desc:   "not declared",
+			values: map[string]string{"node": "a", "rack": "r1"},
+			err:    "Variables are set but not declared: rack",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			vars, err := ResolveConfigVariables(decls, tt.values)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("got error %v want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			verify.Values(t, "", vars, tt.vars)
+		})
+	}
+}
+
+func TestReadVarFile(t *testing.T) {
+	t.Parallel()
+	tf := testutil.TempFile(t, "consul")
+	tf.Write([]byte("dc = \"dc2\"\nport = 8600\nserver = true\n"))
+	tf.Close()
+	defer os.Remove(tf.Name())
+
+	values, err := ReadVarFile(tf.Name())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	want := map[string]string{"dc": "dc2", "port": "8600", "server": "true"}
+	verify.Values(t, "", values, want)
+}
+
+func TestDecodeConfig_variables(t *testing.T) {
+	t.Parallel()
+	in := `{"variable": {"dc": {"default": "dc1"}}, "datacenter": "${var.dc}", "node_name": "${NODE}-${var.dc}"}`
+	c, err := decodeConfig(strings.NewReader(in), map[string]string{"var.dc": "dc2"}, false, false)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if got, want := []string{c.Datacenter, c.NodeName}, []string{"dc2", "${NODE}-dc2"}; !verify.Values(t, "", got, want) {
+		return
+	}
+
+	_, err = decodeConfig(strings.NewReader(`{"datacenter": "${var.rack}"}`), map[string]string{"var.dc": "dc2"}, false, false)
+	if err == nil || err.Error() != "Undefined variable var.rack" {
+		t.Fatalf("got error %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// The formats of configuration files.
+const (
+	ConfigFormatJSON = "json"
+	ConfigFormatYAML = "yaml"
+	ConfigFormatHCL  = "hcl"
+)
+
+// configFileFormat returns the format of the configuration file at path
+// by its extension. Files ending in ".yaml" or ".yml" are YAML, files
+// ending in ".hcl" are HCL and all other files are JSON.
+func configFileFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return ConfigFormatYAML
+	case ".hcl":
+		return ConfigFormatHCL
+	}
+	return ConfigFormatJSON
+}
+
+// configDataToJSON translates a configuration document in the given
+// format into the JSON document of the same configuration. JSON documents
+// are returned as they are.
+func configDataToJSON(format string, data []byte) ([]byte, error) {
+	switch format {
+	case ConfigFormatJSON:
+		return data, nil
+	case ConfigFormatYAML:
+		return yamlToJSON(data)
+	case ConfigFormatHCL:
+		return hclToJSON(string(data))
+	}
+	return nil, fmt.Errorf("unknown configuration format %q", format)
+}
+
+// isConfigFileName returns true if the file of a configuration directory
+// with the given name is read as a configuration file.
+func isConfigFileName(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json", ".yaml", ".yml", ".hcl":
+		return true
+	}
+	return false
+}
+
+// ParseConfigFile decodes the configuration file at path in the given
+// format, which is "json", "yaml" or "hcl". If format is empty, it is
+// chosen by the extension of the file like for the files of configuration
+// directories. If strict is set, unknown keys of service and check
+// definitions are rejected like the unknown keys of the configuration.
+func ParseConfigFile(path, format string, strict bool) (*Config, error) {
+	if format == "" {
+		format = configFileFormat(path)
+	}
+	limits := DefaultConfigLimits()
+	data, err := readConfigFileFormat(path, format, limits)
+	if err != nil {
+		return nil, err
+	}
+	return decodeConfigData(path, data, limits, nil, strict, true)
+}
+
+// yamlToJSON translates a YAML configuration document into the JSON
+// document of the same configuration.
+func yamlToJSON(data []byte) ([]byte, error) {
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return []byte("{}"), nil
+	}
+	v, err := yamlJSONValue(raw)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := v.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("document must be a mapping")
+	}
+	return json.Marshal(v)
+}
+
+// yamlJSONValue replaces the maps which YAML decodes mappings into with
+// maps keyed by strings which can be encoded as JSON.
+func yamlJSONValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			key, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("key %v must be a string", k)
+			}
+			ev, err := yamlJSONValue(e)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = ev
+		}
+		return m, nil
+	case []interface{}:
+		for i, e := range v {
+			ev, err := yamlJSONValue(e)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = ev
+		}
+		return v, nil
+	}
+	return v, nil
+}
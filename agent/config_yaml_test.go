@@ -0,0 +1,149 @@
+package agent
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/consul/agent/structs"
+	"github.com/hashicorp/consul/testutil"
+	"github.com/pascaldekloe/goe/verify"
+)
+
+func TestParseConfigFile(t *testing.T) {
+	t.Parallel()
+	td := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(td)
+
+	tests := []struct {
+		desc   string
+		name   string
+		format string
+		in     string
+		c      *Config
+		err    string
+	}{
+		{
+			desc: "json",
+			name: "a.json",
+			in:   `{"node_name": "a", "node_meta": {"k": "v"}}`,
+			c:    &Config{NodeName: "a", Meta: map[string]string{"k": "v"}},
+		},
+		{
+			desc: "yaml",
+			name: "a.yaml",
+			in: `
+node_name: a
+retry_join: [b, c]
+node_meta:
+  k: v
+ports:
+  dns: 8601
+services:
+  - name: web
+    port: 80
+`,
+			c: &Config{
+				NodeName:  "a",
+				RetryJoin: []string{"b", "c"},
+				Meta:      map[string]string{"k": "v"},
+				Ports:     PortConfig{DNS: 8601},
+				Services: []*structs.ServiceDefinition{
+					&structs.ServiceDefinition{Name: "web", Port: 80},
+				},
+			},
+		},
+		{
+			desc: "yml",
+			name: "a.yml",
+			in:   "node_name: a\n",
+			c:    &Config{NodeName: "a"},
+		},
+		{
+			desc:   "explicit format",
+			name:   "config",
+			format: "yaml",
+			in:     "node_name: a\n",
+			c:      &Config{NodeName: "a"},
+		},
+		{
+			desc:   "explicit json",
+			name:   "a.yaml",
+			format: "json",
+			in:     `{"node_name": "a"}`,
+			c:      &Config{NodeName: "a"},
+		},
+		{
+			desc:   "unknown format",
+			name:   "a.json",
+			format: "toml",
+			in:     `{}`,
+			err:    `unknown configuration format "toml"`,
+		},
+		{
+			desc: "invalid yaml",
+			name: "b.yaml",
+			in:   "node_name: [a\n",
+			err:  "Error decoding",
+		},
+		{
+			desc: "not a mapping",
+			name: "c.yaml",
+			in:   "- a\n",
+			err:  "document must be a mapping",
+		},
+		{
+			desc: "non-string key",
+			name: "d.yaml",
+			in:   "node_meta:\n  1: v\n",
+			err:  "key 1 must be a string",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			path := filepath.Join(td, tt.name)
+			if err := ioutil.WriteFile(path, []byte(tt.in), 0600); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			c, err := ParseConfigFile(path, tt.format, false)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			verify.Values(t, "", c, tt.c)
+		})
+	}
+}
+
+func TestReadConfigPaths_yaml(t *testing.T) {
+	t.Parallel()
+	td := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(td)
+
+	files := map[string]string{
+		"a.json": `{"node_name": "a", "datacenter": "dc1"}`,
+		"b.yaml": "node_name: b\n",
+		"c.yml":  "datacenter: dc2\n",
+		"d.txt":  "node_name: bad\n",
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(td, name), []byte(data), 0600); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	config, err := ReadConfigPaths([]string{td})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if config.NodeName != "b" || config.Datacenter != "dc2" {
+		t.Fatalf("bad: %#v", config)
+	}
+}
@@ -171,12 +171,24 @@ func (b *BasicAutopilot) PromoteNonVoters(autopilotConfig *structs.AutopilotConf
 		return fmt.Errorf("failed to get raft configuration: %v", err)
 	}
 
+	// Read replicas stay non-voters
+	readReplicas := make(map[raft.ServerID]bool)
+	for _, m := range b.server.LANMembers() {
+		if ok, parts := metadata.IsConsulServer(m); ok && parts.NonVoter {
+			readReplicas[raft.ServerID(parts.ID)] = true
+		}
+	}
+
 	// Find any non-voters eligible for promotion
 	var promotions []raft.Server
 	voterCount := 0
 	for _, server := range future.Configuration().Servers {
 		// If this server has been stable and passing for long enough, promote it to a voter
 		if !isVoter(server.Suffrage) {
+			if readReplicas[server.ID] {
+				continue
+			}
+
 			health := b.server.getServerHealth(string(server.ID))
 			if health.IsStable(time.Now(), autopilotConfig) {
 				promotions = append(promotions, server)
@@ -251,3 +251,63 @@ func TestAutopilot_PromoteNonVoter(t *testing.T) {
 		}
 	})
 }
+
+func TestAutopilot_ReadReplicaNotPromoted(t *testing.T) {
+	t.Parallel()
+	dir1, s1 := testServerWithConfig(t, func(c *Config) {
+		c.Datacenter = "dc1"
+		c.Bootstrap = true
+		c.RaftConfig.ProtocolVersion = 3
+		c.AutopilotConfig.ServerStabilizationTime = 200 * time.Millisecond
+		c.ServerHealthInterval = 100 * time.Millisecond
+		c.AutopilotInterval = 100 * time.Millisecond
+	})
+	defer os.RemoveAll(dir1)
+	defer s1.Shutdown()
+
+	// Two stable non-voters would be promoted together, unless they are
+	// read replicas.
+	var servers []*Server
+	for i := 0; i < 2; i++ {
+		dir, s := testServerWithConfig(t, func(c *Config) {
+			c.Datacenter = "dc1"
+			c.Bootstrap = false
+			c.RaftConfig.ProtocolVersion = 3
+			c.NonVoter = true
+		})
+		defer os.RemoveAll(dir)
+		defer s.Shutdown()
+		joinLAN(t, s, s1)
+		servers = append(servers, s)
+	}
+
+	testrpc.WaitForLeader(t, s1.RPC, "dc1")
+	retry.Run(t, func(r *retry.R) {
+		future := s1.raft.GetConfiguration()
+		if err := future.Error(); err != nil {
+			r.Fatal(err)
+		}
+		if got := future.Configuration().Servers; len(got) != 3 {
+			r.Fatalf("bad: %v", got)
+		}
+		for _, s := range servers {
+			health := s1.getServerHealth(string(s.config.NodeID))
+			if health == nil || !health.Healthy {
+				r.Fatalf("bad: %v", health)
+			}
+			if time.Now().Sub(health.StableSince) < 2*s1.config.AutopilotConfig.ServerStabilizationTime {
+				r.Fatal("stable period not elapsed")
+			}
+		}
+	})
+
+	future := s1.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		t.Fatal(err)
+	}
+	for _, server := range future.Configuration().Servers[1:] {
+		if server.Suffrage != raft.Nonvoter {
+			t.Fatalf("read replica was promoted: %v", server)
+		}
+	}
+}
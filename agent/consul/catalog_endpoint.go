@@ -35,6 +35,11 @@ func (c *Catalog) Register(args *structs.RegisterRequest, reply *struct{}) error
 			return fmt.Errorf("Bad node ID: %v", err)
 		}
 	}
+	if len(args.NodeMeta) > 0 {
+		if err := structs.ValidateMetadataLimits(args.NodeMeta, c.srv.config.NodeMetaLimits); err != nil {
+			return err
+		}
+	}
 
 	// Fetch the ACL token, if any.
 	rule, err := c.srv.resolveToken(args.Token)
@@ -164,6 +169,11 @@ func (c *Catalog) ListDatacenters(args *struct{}, reply *[]string) error {
 		return err
 	}
 
+	// Without the WAN gossip pool only the local datacenter is known.
+	if len(dcs) == 0 {
+		dcs = []string{c.srv.config.Datacenter}
+	}
+
 	*reply = dcs
 	return nil
 }
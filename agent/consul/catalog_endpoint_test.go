@@ -114,6 +114,35 @@ func TestCatalog_Register_NodeID(t *testing.T) {
 	}
 }
 
+func TestCatalog_Register_NodeMetaLimits(t *testing.T) {
+	t.Parallel()
+	dir1, s1 := testServerWithConfig(t, func(c *Config) {
+		c.NodeMetaLimits = structs.MetaLimits{MaxKeyPairs: 2}
+	})
+	defer os.RemoveAll(dir1)
+	defer s1.Shutdown()
+	codec := rpcClient(t, s1)
+	defer codec.Close()
+
+	arg := structs.RegisterRequest{
+		Datacenter: "dc1",
+		Node:       "foo",
+		Address:    "127.0.0.1",
+		NodeMeta:   map[string]string{"a": "1", "b": "2", "c": "3"},
+	}
+	var out struct{}
+
+	err := msgpackrpc.CallWithCodec(codec, "Catalog.Register", &arg, &out)
+	if err == nil || !strings.Contains(err.Error(), "cannot contain more than 2 key/value pairs") {
+		t.Fatalf("err: %v", err)
+	}
+
+	delete(arg.NodeMeta, "c")
+	if err := msgpackrpc.CallWithCodec(codec, "Catalog.Register", &arg, &out); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
+
 func TestCatalog_Register_ACLDeny(t *testing.T) {
 	t.Parallel()
 	dir1, s1 := testServerWithConfig(t, func(c *Config) {
@@ -172,6 +172,9 @@ func (c *Client) setupSerf(conf *serf.Config, ch chan serf.Event, path string) (
 	if err := lib.EnsurePath(conf.SnapshotPath, false); err != nil {
 		return nil, err
 	}
+	if err := setupCIDRTransport(conf, c.config.SerfLANAllowedCIDRs, c.logger); err != nil {
+		return nil, err
+	}
 	return serf.Create(conf)
 }
 
@@ -82,7 +82,7 @@ type Config struct {
 	// RaftConfig is the configuration used for Raft in the local DC
 	RaftConfig *raft.Config
 
-	// (Enterprise-only) NonVoter is used to prevent this server from being added
+	// NonVoter is used to prevent this server from being added
 	// as a voting member of the Raft cluster.
 	NonVoter bool
 
@@ -111,6 +111,12 @@ type Config struct {
 	// SerfWANConfig is the configuration for the cross-dc serf
 	SerfWANConfig *serf.Config
 
+	// SerfLANAllowedCIDRs and SerfWANAllowedCIDRs restrict the gossip of
+	// the intra-dc and cross-dc serf to the given networks. Gossip from
+	// other addresses is dropped. They are unrestricted if empty.
+	SerfLANAllowedCIDRs []*net.IPNet
+	SerfWANAllowedCIDRs []*net.IPNet
+
 	// SerfFloodInterval controls how often we attempt to flood local Serf
 	// Consul servers into the global areas (WAN and user-defined areas in
 	// Consul Enterprise).
@@ -294,6 +300,9 @@ type Config struct {
 	// place, and a small jitter is applied to avoid a thundering herd.
 	RPCHoldTimeout time.Duration
 
+	// NodeMetaLimits bounds the node metadata of catalog registrations.
+	NodeMetaLimits structs.MetaLimits
+
 	// AutopilotConfig is used to apply the initial autopilot config when
 	// bootstrapping.
 	AutopilotConfig *structs.AutopilotConfig
@@ -377,6 +386,8 @@ func DefaultConfig() *Config {
 		// than enough when running in the high performance mode.
 		RPCHoldTimeout: 7 * time.Second,
 
+		NodeMetaLimits: structs.DefaultMetaLimits(),
+
 		TLSMinVersion: "tls10",
 
 		AutopilotConfig: &structs.AutopilotConfig{
@@ -0,0 +1,149 @@
+package consul
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/memberlist"
+	"github.com/hashicorp/serf/serf"
+)
+
+// cidrTransport is a memberlist transport which drops the gossip packets
+// and closes the gossip connections from addresses outside of the allowed
+// networks.
+type cidrTransport struct {
+	*memberlist.NetTransport
+
+	allowed    []*net.IPNet
+	logger     *log.Logger
+	packetCh   chan *memberlist.Packet
+	streamCh   chan net.Conn
+	shutdownCh chan struct{}
+}
+
+// setupCIDRTransport sets up the memberlist transport of conf to accept
+// gossip only from the allowed networks. It leaves conf alone if allowed is
+// empty.
+func setupCIDRTransport(conf *serf.Config, allowed []*net.IPNet, logger *log.Logger) error {
+	if len(allowed) == 0 {
+		return nil
+	}
+
+	mc := conf.MemberlistConfig
+	out := mc.LogOutput
+	if out == nil {
+		out = os.Stderr
+	}
+	nt, err := memberlist.NewNetTransport(&memberlist.NetTransportConfig{
+		BindAddrs: []string{mc.BindAddr},
+		BindPort:  mc.BindPort,
+		Logger:    log.New(out, "", log.LstdFlags),
+	})
+	if err != nil {
+		return fmt.Errorf("Could not set up network transport: %v", err)
+	}
+	if mc.BindPort == 0 {
+		mc.BindPort = nt.GetAutoBindPort()
+		mc.AdvertisePort = mc.BindPort
+	}
+
+	t := &cidrTransport{
+		NetTransport: nt,
+		allowed:      allowed,
+		logger:       logger,
+		packetCh:     make(chan *memberlist.Packet),
+		streamCh:     make(chan net.Conn),
+		shutdownCh:   make(chan struct{}),
+	}
+	go t.filterPackets()
+	go t.filterStreams()
+	mc.Transport = t
+	return nil
+}
+
+// PacketCh returns the packets from the allowed networks.
+func (t *cidrTransport) PacketCh() <-chan *memberlist.Packet {
+	return t.packetCh
+}
+
+// StreamCh returns the connections from the allowed networks.
+func (t *cidrTransport) StreamCh() <-chan net.Conn {
+	return t.streamCh
+}
+
+// Shutdown stops the filtering and the underlying transport.
+func (t *cidrTransport) Shutdown() error {
+	close(t.shutdownCh)
+	return t.NetTransport.Shutdown()
+}
+
+func (t *cidrTransport) filterPackets() {
+	for {
+		select {
+		case p := <-t.NetTransport.PacketCh():
+			if !t.isAllowed(p.From) {
+				t.deny(p.From)
+				continue
+			}
+			select {
+			case t.packetCh <- p:
+			case <-t.shutdownCh:
+				return
+			}
+		case <-t.shutdownCh:
+			return
+		}
+	}
+}
+
+func (t *cidrTransport) filterStreams() {
+	for {
+		select {
+		case conn := <-t.NetTransport.StreamCh():
+			if !t.isAllowed(conn.RemoteAddr()) {
+				t.deny(conn.RemoteAddr())
+				conn.Close()
+				continue
+			}
+			select {
+			case t.streamCh <- conn:
+			case <-t.shutdownCh:
+				conn.Close()
+				return
+			}
+		case <-t.shutdownCh:
+			return
+		}
+	}
+}
+
+// isAllowed returns true if addr is in one of the allowed networks.
+func (t *cidrTransport) isAllowed(addr net.Addr) bool {
+	var ip net.IP
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		ip = a.IP
+	case *net.TCPAddr:
+		ip = a.IP
+	default:
+		host, _, err := net.SplitHostPort(addr.String())
+		if err != nil {
+			return false
+		}
+		ip = net.ParseIP(host)
+	}
+	for _, n := range t.allowed {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *cidrTransport) deny(addr net.Addr) {
+	metrics.IncrCounter([]string{"consul", "memberlist", "cidr_denied"}, 1)
+	t.logger.Printf("[DEBUG] consul: Dropped gossip from %s outside of the allowed CIDRs", addr)
+}
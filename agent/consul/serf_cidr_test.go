@@ -0,0 +1,57 @@
+package consul
+
+import (
+	"net"
+	"os"
+	"testing"
+)
+
+func TestCIDRTransport_isAllowed(t *testing.T) {
+	t.Parallel()
+	_, n1, _ := net.ParseCIDR("10.0.0.0/8")
+	_, n2, _ := net.ParseCIDR("fd00::/8")
+	tr := &cidrTransport{allowed: []*net.IPNet{n1, n2}}
+
+	tests := []struct {
+		addr net.Addr
+		ok   bool
+	}{
+		{&net.UDPAddr{IP: net.ParseIP("10.1.2.3"), Port: 8301}, true},
+		{&net.TCPAddr{IP: net.ParseIP("10.1.2.3"), Port: 8301}, true},
+		{&net.UDPAddr{IP: net.ParseIP("192.168.1.1"), Port: 8301}, false},
+		{&net.TCPAddr{IP: net.ParseIP("fd00::1"), Port: 8301}, true},
+		{&net.IPAddr{IP: net.ParseIP("10.1.2.3")}, false},
+	}
+	for _, tt := range tests {
+		if got := tr.isAllowed(tt.addr); got != tt.ok {
+			t.Errorf("%s: got %v want %v", tt.addr, got, tt.ok)
+		}
+	}
+}
+
+func TestServer_SerfLANAllowedCIDRs(t *testing.T) {
+	t.Parallel()
+	dir1, s1 := testServer(t)
+	defer os.RemoveAll(dir1)
+	defer s1.Shutdown()
+
+	_, denied, _ := net.ParseCIDR("10.0.0.0/8")
+	dir2, s2 := testServerWithConfig(t, func(c *Config) {
+		c.SerfLANAllowedCIDRs = []*net.IPNet{denied}
+	})
+	defer os.RemoveAll(dir2)
+	defer s2.Shutdown()
+
+	// s2 drops the gossip from 127.0.0.1, so s1 cannot join it.
+	if _, err := s1.JoinLAN([]string{joinAddrLAN(s2)}); err == nil {
+		t.Fatal("expected the join to fail")
+	}
+
+	_, allowed, _ := net.ParseCIDR("127.0.0.0/8")
+	dir3, s3 := testServerWithConfig(t, func(c *Config) {
+		c.SerfLANAllowedCIDRs = []*net.IPNet{allowed}
+	})
+	defer os.RemoveAll(dir3)
+	defer s3.Shutdown()
+	joinLAN(t, s1, s3)
+}
@@ -49,6 +49,20 @@ const (
 	ProtocolVersionMax = 3
 )
 
+// These are the Raft protocol versions that Consul servers can speak.
+// Version 3 is required for the Autopilot features which add servers as
+// non-voters first.
+const (
+	RaftProtocolVersionMin = 1
+	RaftProtocolVersionMax = 3
+)
+
+var (
+	// ErrWANFederationDisabled is returned by the operations on the WAN
+	// gossip pool when it is disabled.
+	ErrWANFederationDisabled = errors.New("WAN Federation is disabled")
+)
+
 const (
 	serfLANSnapshot   = "serf/local.snapshot"
 	serfWANSnapshot   = "serf/remote.snapshot"
@@ -351,21 +365,25 @@ func NewServerLogger(config *Config, logger *log.Logger, tokens *token.Store) (*
 	// created, so we can pull it out from there reliably, even though it's
 	// a little gross to be reading the updated config.
 
-	// Initialize the WAN Serf.
-	serfBindPortWAN := config.SerfWANConfig.MemberlistConfig.BindPort
-	s.serfWAN, err = s.setupSerf(config.SerfWANConfig, s.eventChWAN, serfWANSnapshot, true, serfBindPortWAN)
-	if err != nil {
-		s.Shutdown()
-		return nil, fmt.Errorf("Failed to start WAN Serf: %v", err)
-	}
-
-	// See big comment above why we are doing this.
-	if serfBindPortWAN == 0 {
+	// Initialize the WAN Serf unless it is disabled, in which case the
+	// LAN serf cluster announces port 0 which is never flooded to.
+	serfBindPortWAN := 0
+	if config.SerfWANConfig != nil {
 		serfBindPortWAN = config.SerfWANConfig.MemberlistConfig.BindPort
+		s.serfWAN, err = s.setupSerf(config.SerfWANConfig, s.eventChWAN, serfWANSnapshot, true, serfBindPortWAN)
+		if err != nil {
+			s.Shutdown()
+			return nil, fmt.Errorf("Failed to start WAN Serf: %v", err)
+		}
+
+		// See big comment above why we are doing this.
 		if serfBindPortWAN == 0 {
-			return nil, fmt.Errorf("Failed to get dynamic bind port for WAN Serf")
+			serfBindPortWAN = config.SerfWANConfig.MemberlistConfig.BindPort
+			if serfBindPortWAN == 0 {
+				return nil, fmt.Errorf("Failed to get dynamic bind port for WAN Serf")
+			}
+			s.logger.Printf("[INFO] agent: Serf WAN TCP bound to port %d", serfBindPortWAN)
 		}
-		s.logger.Printf("[INFO] agent: Serf WAN TCP bound to port %d", serfBindPortWAN)
 	}
 
 	// Initialize the LAN Serf.
@@ -376,21 +394,23 @@ func NewServerLogger(config *Config, logger *log.Logger, tokens *token.Store) (*
 	}
 	go s.lanEventHandler()
 
-	// Add a "static route" to the WAN Serf and hook it up to Serf events.
-	if err := s.router.AddArea(types.AreaWAN, s.serfWAN, s.connPool, s.config.VerifyOutgoing); err != nil {
-		s.Shutdown()
-		return nil, fmt.Errorf("Failed to add WAN serf route: %v", err)
-	}
-	go router.HandleSerfEvents(s.logger, s.router, types.AreaWAN, s.serfWAN.ShutdownCh(), s.eventChWAN)
+	if s.serfWAN != nil {
+		// Add a "static route" to the WAN Serf and hook it up to Serf events.
+		if err := s.router.AddArea(types.AreaWAN, s.serfWAN, s.connPool, s.config.VerifyOutgoing); err != nil {
+			s.Shutdown()
+			return nil, fmt.Errorf("Failed to add WAN serf route: %v", err)
+		}
+		go router.HandleSerfEvents(s.logger, s.router, types.AreaWAN, s.serfWAN.ShutdownCh(), s.eventChWAN)
 
-	// Fire up the LAN <-> WAN join flooder.
-	portFn := func(s *metadata.Server) (int, bool) {
-		if s.WanJoinPort > 0 {
-			return s.WanJoinPort, true
+		// Fire up the LAN <-> WAN join flooder.
+		portFn := func(s *metadata.Server) (int, bool) {
+			if s.WanJoinPort > 0 {
+				return s.WanJoinPort, true
+			}
+			return 0, false
 		}
-		return 0, false
+		go s.Flood(portFn, s.serfWAN)
 	}
-	go s.Flood(portFn, s.serfWAN)
 
 	// Start monitoring leadership. This must happen after Serf is set up
 	// since it can fire events when leadership is obtained.
@@ -471,6 +491,14 @@ func (s *Server) setupSerf(conf *serf.Config, ch chan serf.Event, path string, w
 		return nil, err
 	}
 
+	allowed := s.config.SerfLANAllowedCIDRs
+	if wan {
+		allowed = s.config.SerfWANAllowedCIDRs
+	}
+	if err := setupCIDRTransport(conf, allowed, s.logger); err != nil {
+		return nil, err
+	}
+
 	return serf.Create(conf)
 }
 
@@ -887,6 +915,9 @@ func (s *Server) JoinLAN(addrs []string) (int, error) {
 // The target address should be another node listening on the
 // Serf WAN address
 func (s *Server) JoinWAN(addrs []string) (int, error) {
+	if s.serfWAN == nil {
+		return 0, ErrWANFederationDisabled
+	}
 	return s.serfWAN.Join(addrs, true)
 }
 
@@ -900,8 +931,12 @@ func (s *Server) LANMembers() []serf.Member {
 	return s.serfLAN.Members()
 }
 
-// WANMembers is used to return the members of the LAN cluster
+// WANMembers is used to return the members of the WAN cluster, which are
+// none if it is disabled.
 func (s *Server) WANMembers() []serf.Member {
+	if s.serfWAN == nil {
+		return nil
+	}
 	return s.serfWAN.Members()
 }
 
@@ -910,8 +945,10 @@ func (s *Server) RemoveFailedNode(node string) error {
 	if err := s.serfLAN.RemoveFailedNode(node); err != nil {
 		return err
 	}
-	if err := s.serfWAN.RemoveFailedNode(node); err != nil {
-		return err
+	if s.serfWAN != nil {
+		if err := s.serfWAN.RemoveFailedNode(node); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -926,13 +963,20 @@ func (s *Server) KeyManagerLAN() *serf.KeyManager {
 	return s.serfLAN.KeyManager()
 }
 
-// KeyManagerWAN returns the WAN Serf keyring manager
+// KeyManagerWAN returns the WAN Serf keyring manager, or nil if the WAN
+// Serf is disabled.
 func (s *Server) KeyManagerWAN() *serf.KeyManager {
+	if s.serfWAN == nil {
+		return nil
+	}
 	return s.serfWAN.KeyManager()
 }
 
 // Encrypted determines if gossip is encrypted
 func (s *Server) Encrypted() bool {
+	if s.serfWAN == nil {
+		return s.serfLAN.EncryptionEnabled()
+	}
 	return s.serfLAN.EncryptionEnabled() && s.serfWAN.EncryptionEnabled()
 }
 
@@ -1040,9 +1084,11 @@ func (s *Server) Stats() map[string]map[string]string {
 		},
 		"raft":     s.raft.Stats(),
 		"serf_lan": s.serfLAN.Stats(),
-		"serf_wan": s.serfWAN.Stats(),
 		"runtime":  runtimeStats(),
 	}
+	if s.serfWAN != nil {
+		stats["serf_wan"] = s.serfWAN.Stats()
+	}
 	return stats
 }
 
@@ -1053,6 +1099,9 @@ func (s *Server) GetLANCoordinate() (*coordinate.Coordinate, error) {
 
 // GetWANCoordinate returns the coordinate of the server in the WAN gossip pool.
 func (s *Server) GetWANCoordinate() (*coordinate.Coordinate, error) {
+	if s.serfWAN == nil {
+		return nil, ErrWANFederationDisabled
+	}
 	return s.serfWAN.GetCoordinate()
 }
 
@@ -238,6 +238,39 @@ func TestServer_JoinWAN(t *testing.T) {
 	})
 }
 
+func TestServer_WANDisabled(t *testing.T) {
+	t.Parallel()
+	dir1, s1 := testServerWithConfig(t, func(c *Config) {
+		c.SerfWANConfig = nil
+	})
+	defer os.RemoveAll(dir1)
+	defer s1.Shutdown()
+	testrpc.WaitForLeader(t, s1.RPC, "dc1")
+
+	dir2, s2 := testServerDC(t, "dc2")
+	defer os.RemoveAll(dir2)
+	defer s2.Shutdown()
+
+	addr := fmt.Sprintf("127.0.0.1:%d", s2.config.SerfWANConfig.MemberlistConfig.BindPort)
+	if _, err := s1.JoinWAN([]string{addr}); err != ErrWANFederationDisabled {
+		t.Fatalf("got error %v want %v", err, ErrWANFederationDisabled)
+	}
+	if got := s1.WANMembers(); got != nil {
+		t.Fatalf("got WAN members %v", got)
+	}
+	if _, ok := s1.Stats()["serf_wan"]; ok {
+		t.Fatalf("got serf_wan stats")
+	}
+
+	var dcs []string
+	if err := s1.RPC("Catalog.ListDatacenters", struct{}{}, &dcs); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(dcs) != 1 || dcs[0] != "dc1" {
+		t.Fatalf("got datacenters %v", dcs)
+	}
+}
+
 func TestServer_JoinWAN_Flood(t *testing.T) {
 	t.Parallel()
 	// Set up two servers in a WAN.
@@ -0,0 +1,70 @@
+package agent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// VerifyDataDir checks that the data directory exists or can be created,
+// is a directory and is writable, so that a bad data directory is reported
+// before any part of the agent starts and writes state into it. It returns
+// warnings if the data directory is on a filesystem type of the
+// data_dir_filesystem_denylist.
+func (c *Config) VerifyDataDir() ([]string, error) {
+	dir := c.DataDir
+	if dir == "" {
+		return nil, fmt.Errorf("Must specify data directory using -data-dir")
+	}
+
+	// A data directory which does not exist yet is created by the agent,
+	// which needs the closest existing parent to be a writable directory.
+	path := dir
+	for {
+		fi, err := os.Stat(path)
+		if err == nil {
+			if !fi.IsDir() {
+				if path == dir {
+					return nil, fmt.Errorf("The data-dir specified at %q is not a directory", dir)
+				}
+				return nil, fmt.Errorf("The data-dir specified at %q cannot be created since %q is not a directory", dir, path)
+			}
+			break
+		}
+		// A parent which is a file is reported once the walk reaches it.
+		if pe, ok := err.(*os.PathError); !os.IsNotExist(err) && !(ok && pe.Err == syscall.ENOTDIR) {
+			return nil, fmt.Errorf("Error getting data-dir: %s", err)
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return nil, fmt.Errorf("Error getting data-dir: %s", err)
+		}
+		path = parent
+	}
+
+	f, err := ioutil.TempFile(path, ".consul-write-test")
+	if err != nil {
+		if path == dir {
+			return nil, fmt.Errorf("The data-dir specified at %q is not writable: %s", dir, err)
+		}
+		return nil, fmt.Errorf("The data-dir specified at %q cannot be created: %s", dir, err)
+	}
+	f.Close()
+	os.Remove(f.Name())
+
+	var warnings []string
+	if fstype, ok := filesystemType(path); ok {
+		for _, denied := range c.DataDirFilesystemDenylist {
+			if strings.EqualFold(fstype, denied) {
+				warnings = append(warnings, fmt.Sprintf("The data-dir specified at %q is on a %s "+
+					"filesystem, which does not provide the locking and fsync guarantees Consul "+
+					"relies on", dir, fstype))
+				break
+			}
+		}
+	}
+	return warnings, nil
+}
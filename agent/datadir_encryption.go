@@ -0,0 +1,214 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/memberlist"
+	"github.com/hashicorp/serf/serf"
+)
+
+// encryptedFileHeader prefixes the contents of files in the data directory
+// which were encrypted with the data directory encryption key.
+var encryptedFileHeader = []byte("consul-encrypted:v1\n")
+
+// keyringPersistInterval is how often the encrypted keyrings are checked
+// for changes made by other agents, which Serf applies without notifying
+// the agent.
+const keyringPersistInterval = time.Second
+
+// dataDirCipher encrypts and decrypts files written to the data directory.
+type dataDirCipher struct {
+	aead cipher.AEAD
+}
+
+// newDataDirCipher returns a cipher using AES-GCM with the given key.
+func newDataDirCipher(key []byte) (*dataDirCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &dataDirCipher{aead: aead}, nil
+}
+
+// seal encrypts the given plaintext. The result consists of the header,
+// the nonce and the ciphertext.
+func (c *dataDirCipher) seal(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	out := append([]byte{}, encryptedFileHeader...)
+	out = append(out, nonce...)
+	return c.aead.Seal(out, nonce, plaintext, encryptedFileHeader), nil
+}
+
+// open decrypts data produced by seal.
+func (c *dataDirCipher) open(data []byte) ([]byte, error) {
+	data = bytes.TrimPrefix(data, encryptedFileHeader)
+	n := c.aead.NonceSize()
+	if len(data) < n {
+		return nil, fmt.Errorf("encrypted data is truncated")
+	}
+	plaintext, err := c.aead.Open(nil, data[:n], data[n:], encryptedFileHeader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data, is the data_dir_encryption key correct? %v", err)
+	}
+	return plaintext, nil
+}
+
+// sealDataFile returns the contents to write to a file in the data
+// directory for the given plaintext. The plaintext is returned unchanged if
+// data directory encryption is disabled.
+func (a *Agent) sealDataFile(plaintext []byte) ([]byte, error) {
+	if a.dataDirCipher == nil {
+		return plaintext, nil
+	}
+	return a.dataDirCipher.seal(plaintext)
+}
+
+// openDataFile returns the plaintext for contents read from a file in the
+// data directory. Files written before encryption was enabled are returned
+// unchanged so that they are migrated on their next write.
+func (a *Agent) openDataFile(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, encryptedFileHeader) {
+		return data, nil
+	}
+	if a.dataDirCipher == nil {
+		return nil, fmt.Errorf("file is encrypted but data_dir_encryption is not configured")
+	}
+	return a.dataDirCipher.open(data)
+}
+
+// loadKeyringFile loads the keyring file of the given Serf config. With data
+// directory encryption enabled the file is decrypted, re-written encrypted
+// if it was still in plaintext, and detached from Serf so that Serf does
+// not persist key changes in plaintext. The agent persists the keyring
+// instead, see persistKeyrings.
+func (a *Agent) loadKeyringFile(c *serf.Config) error {
+	if a.dataDirCipher == nil || c.KeyringFile == "" {
+		return loadKeyringFile(c)
+	}
+
+	path := c.KeyringFile
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	plaintext, err := a.openDataFile(data)
+	if err != nil {
+		return fmt.Errorf("failed reading keyring %q: %v", path, err)
+	}
+	keys := make([]string, 0)
+	if err := json.Unmarshal(plaintext, &keys); err != nil {
+		return err
+	}
+	if err := loadKeyring(c, keys); err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(data, encryptedFileHeader) {
+		if err := a.writeKeyringFile(path, keys); err != nil {
+			return fmt.Errorf("failed encrypting keyring %q: %v", path, err)
+		}
+	}
+
+	c.KeyringFile = ""
+	a.keyringLock.Lock()
+	defer a.keyringLock.Unlock()
+	if a.keyrings == nil {
+		a.keyrings = make(map[string]*memberlist.Keyring)
+		a.keyringsWritten = make(map[string][]string)
+	}
+	a.keyrings[path] = c.MemberlistConfig.Keyring
+	a.keyringsWritten[path] = encodeKeyring(c.MemberlistConfig.Keyring)
+	return nil
+}
+
+// writeKeyringFile writes the given keys as an encrypted keyring file.
+func (a *Agent) writeKeyringFile(path string, keys []string) error {
+	encoded, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+	return a.writeDataFileAtomic(path, encoded)
+}
+
+// writeDataFileAtomic encrypts the given contents if data directory
+// encryption is enabled and writes them atomically to path.
+func (a *Agent) writeDataFileAtomic(path string, contents []byte) error {
+	sealed, err := a.sealDataFile(contents)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, sealed)
+}
+
+// persistKeyrings writes the keyrings which were detached from Serf by
+// loadKeyringFile to their encrypted files if their keys changed since
+// they were last written. It is called by the keyring operations of the
+// agent before they return, by watchKeyrings and on shutdown.
+func (a *Agent) persistKeyrings() error {
+	a.keyringLock.Lock()
+	defer a.keyringLock.Unlock()
+
+	var errs error
+	for path, k := range a.keyrings {
+		keys := encodeKeyring(k)
+		if reflect.DeepEqual(keys, a.keyringsWritten[path]) {
+			continue
+		}
+		if err := a.writeKeyringFile(path, keys); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("failed persisting keyring %q: %v", path, err))
+			continue
+		}
+		a.keyringsWritten[path] = keys
+	}
+	return errs
+}
+
+// watchKeyrings persists the encrypted keyrings whenever their keys
+// change. Serf applies the keyring operations of other agents and the
+// gossip key rotation without notifying the agent, so the keyrings are
+// checked every keyringPersistInterval.
+func (a *Agent) watchKeyrings() {
+	a.keyringLock.Lock()
+	n := len(a.keyrings)
+	a.keyringLock.Unlock()
+	if n == 0 {
+		return
+	}
+
+	for {
+		select {
+		case <-time.After(keyringPersistInterval):
+		case <-a.shutdownCh:
+			return
+		}
+		if err := a.persistKeyrings(); err != nil {
+			a.logger.Printf("[ERR] agent: %v", err)
+		}
+	}
+}
+
+// encodeKeyring returns the base64 encoded keys of k.
+func encodeKeyring(k *memberlist.Keyring) []string {
+	var keys []string
+	for _, key := range k.GetKeys() {
+		keys = append(keys, base64.StdEncoding.EncodeToString(key))
+	}
+	return keys
+}
@@ -0,0 +1,229 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/consul/agent/structs"
+	"github.com/hashicorp/consul/testutil"
+	"github.com/hashicorp/consul/testutil/retry"
+	"github.com/pascaldekloe/goe/verify"
+)
+
+// testDataDirKey is a base64 encoded 32 byte data directory encryption key.
+const testDataDirKey = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+
+func TestConfig_DataDirEncryptionKey(t *testing.T) {
+	t.Parallel()
+	tf := testutil.TempFile(t, "datadir-key")
+	tf.Write([]byte(testDataDirKey + "\n"))
+	tf.Close()
+	defer os.Remove(tf.Name())
+
+	tests := []struct {
+		desc    string
+		key     string
+		keyFile string
+		len     int
+		err     string
+	}{
+		{desc: "disabled"},
+		{desc: "key", key: testDataDirKey, len: 32},
+		{desc: "key file", keyFile: tf.Name(), len: 32},
+		{desc: "16 bytes", key: "MDEyMzQ1Njc4OWFiY2RlZg==", len: 16},
+		{desc: "both", key: testDataDirKey, keyFile: tf.Name(), err: "mutually exclusive"},
+		{desc: "bad base64", key: "!!", err: "invalid key"},
+		{desc: "bad length", key: "a2V5", err: "got 3"},
+		{desc: "missing file", keyFile: "/nonexistent/key", err: "no such file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			c := &Config{DataDirEncryption: DataDirEncryption{Key: tt.key, KeyFile: tt.keyFile}}
+			key, err := c.DataDirEncryptionKey()
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			if len(key) != tt.len {
+				t.Fatalf("got key length %d want %d", len(key), tt.len)
+			}
+		})
+	}
+}
+
+func TestAgent_DataDirFiles(t *testing.T) {
+	t.Parallel()
+	c := &Config{DataDirEncryption: DataDirEncryption{Key: testDataDirKey}}
+	key, err := c.DataDirEncryptionKey()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	ddc, err := newDataDirCipher(key)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	plain := &Agent{}
+	enc := &Agent{dataDirCipher: ddc}
+
+	sealed, err := enc.sealDataFile([]byte("secret"))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !bytes.HasPrefix(sealed, encryptedFileHeader) || bytes.Contains(sealed, []byte("secret")) {
+		t.Fatalf("bad: %q", sealed)
+	}
+	if got, err := enc.openDataFile(sealed); err != nil || string(got) != "secret" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+
+	// Plaintext files written before encryption was enabled are passed
+	// through.
+	if got, err := enc.openDataFile([]byte("legacy")); err != nil || string(got) != "legacy" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+
+	// Encrypted files cannot be read without the key.
+	if _, err := plain.openDataFile(sealed); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// Tampered files are rejected.
+	sealed[len(sealed)-1] ^= 0xff
+	if _, err := enc.openDataFile(sealed); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestAgent_DataDirEncryption(t *testing.T) {
+	t.Parallel()
+	cfg := TestConfig()
+	cfg.Server = false
+	cfg.DataDir = testutil.TempDir(t, "agent") // we manage the data dir
+	cfg.DataDirEncryption.Key = testDataDirKey
+	defer os.RemoveAll(cfg.DataDir)
+
+	key := "tbLJg26ZJyJ9pK3qhc9jig=="
+	a := &TestAgent{Name: t.Name(), Config: cfg, Key: key}
+	a.Start()
+	defer a.Shutdown()
+
+	// The plaintext keyring written before startup is encrypted.
+	keyring := filepath.Join(cfg.DataDir, SerfLANKeyring)
+	content, err := ioutil.ReadFile(keyring)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !bytes.HasPrefix(content, encryptedFileHeader) {
+		t.Fatalf("keyring not encrypted: %q", content)
+	}
+	if err := checkForKey(key, a.Config.ConsulConfig.SerfLANConfig.MemberlistConfig.Keyring); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	svc := &structs.NodeService{
+		ID:      "redis",
+		Service: "redis",
+		Port:    8000,
+	}
+	if err := a.AddService(svc, nil, true, "mytoken", ConfigSourceLocal); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	file := filepath.Join(cfg.DataDir, servicesDir, stringHash(svc.ID))
+	content, err = ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !bytes.HasPrefix(content, encryptedFileHeader) || bytes.Contains(content, []byte("mytoken")) {
+		t.Fatalf("service not encrypted: %q", content)
+	}
+	a.Shutdown()
+
+	// Should load the encrypted state back during later start.
+	a2 := &TestAgent{Name: t.Name() + "-a2", Config: cfg}
+	a2.Start()
+	defer a2.Shutdown()
+	if _, ok := a2.state.services[svc.ID]; !ok {
+		t.Fatalf("bad: %#v", a2.state.services)
+	}
+	if err := checkForKey(key, a2.Config.ConsulConfig.SerfLANConfig.MemberlistConfig.Keyring); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func TestAgent_DataDirEncryption_persistKeyring(t *testing.T) {
+	t.Parallel()
+	cfg := TestConfig()
+	cfg.DataDir = testutil.TempDir(t, "agent") // we manage the data dir
+	cfg.DataDirEncryption.Key = testDataDirKey
+	defer os.RemoveAll(cfg.DataDir)
+
+	key1 := "tbLJg26ZJyJ9pK3qhc9jig=="
+	key2 := "4leC33rgtXKIVUr9Nr0snQ=="
+	a := &TestAgent{Name: t.Name(), Config: cfg, Key: key1}
+	a.Start()
+	defer a.Shutdown()
+
+	// The keyring file is written before the operation returns.
+	if _, err := a.InstallKey(key2, "", 0); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := a.UseKey(key2, "", 0); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	keys, err := a.localKeyringKeys()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	verify.Values(t, "", keys, []string{key2, key1})
+
+	if _, err := a.RemoveKey(key1, "", 0); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if keys, err = a.localKeyringKeys(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	verify.Values(t, "", keys, []string{key2})
+}
+
+func TestAgent_DataDirEncryption_watchKeyrings(t *testing.T) {
+	t.Parallel()
+	cfg := TestConfig()
+	cfg.DataDir = testutil.TempDir(t, "agent") // we manage the data dir
+	cfg.DataDirEncryption.Key = testDataDirKey
+	defer os.RemoveAll(cfg.DataDir)
+
+	key1 := "tbLJg26ZJyJ9pK3qhc9jig=="
+	key2 := "4leC33rgtXKIVUr9Nr0snQ=="
+	a := &TestAgent{Name: t.Name(), Config: cfg, Key: key1}
+	a.Start()
+	defer a.Shutdown()
+
+	// Serf changes the keyring directly when another agent installs a
+	// key, which is persisted without a keyring operation of this agent.
+	b, err := base64.StdEncoding.DecodeString(key2)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := a.Config.ConsulConfig.SerfLANConfig.MemberlistConfig.Keyring.AddKey(b); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	retry.Run(t, func(r *retry.R) {
+		keys, err := a.localKeyringKeys()
+		if err != nil {
+			r.Fatalf("err: %v", err)
+		}
+		if len(keys) != 2 || keys[0] != key1 || keys[1] != key2 {
+			r.Fatalf("got keys %v", keys)
+		}
+	})
+}
@@ -0,0 +1,33 @@
+// +build linux
+
+package agent
+
+import (
+	"syscall"
+)
+
+// filesystemTypes maps the magic numbers of statfs to filesystem types.
+var filesystemTypes = map[int64]string{
+	0x6969:     "nfs",
+	0xff534d42: "cifs",
+	0x517b:     "smb",
+	0xfe534d42: "smb2",
+	0x65735546: "fuse",
+	0xef53:     "ext4",
+	0x58465342: "xfs",
+	0x9123683e: "btrfs",
+	0x2fc12fc1: "zfs",
+	0x01021994: "tmpfs",
+	0x794c7630: "overlay",
+}
+
+// filesystemType returns the type of the filesystem the given path is on.
+// ext2 and ext3 are reported as ext4 since they share the magic number.
+func filesystemType(path string) (string, bool) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return "", false
+	}
+	fstype, ok := filesystemTypes[int64(st.Type)&0xffffffff]
+	return fstype, ok
+}
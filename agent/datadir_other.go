@@ -0,0 +1,9 @@
+// +build !linux
+
+package agent
+
+// filesystemType returns the type of the filesystem the given path is on,
+// which is only detected on Linux.
+func filesystemType(path string) (string, bool) {
+	return "", false
+}
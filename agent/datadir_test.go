@@ -0,0 +1,77 @@
+package agent
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/consul/testutil"
+)
+
+func TestConfig_VerifyDataDir(t *testing.T) {
+	t.Parallel()
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(file, nil, 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	tests := []struct {
+		desc    string
+		dataDir string
+		err     string
+	}{
+		{"missing", "", "Must specify data directory"},
+		{"existing", dir, ""},
+		{"creatable", filepath.Join(dir, "a", "b"), ""},
+		{"file", file, "is not a directory"},
+		{"below file", filepath.Join(file, "a"), `cannot be created since "` + file + `" is not a directory`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			cfg := &Config{DataDir: tt.dataDir}
+			_, err := cfg.VerifyDataDir()
+			if tt.err == "" && err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("got error %v want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestConfig_VerifyDataDir_filesystemDenylist(t *testing.T) {
+	t.Parallel()
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+
+	fstype, ok := filesystemType(dir)
+	if !ok {
+		t.Skip("filesystem type of the data directory is unknown")
+	}
+
+	cfg := &Config{DataDir: dir, DataDirFilesystemDenylist: []string{"nfs"}}
+	if fstype != "nfs" {
+		warnings, err := cfg.VerifyDataDir()
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if len(warnings) != 0 {
+			t.Fatalf("got warnings %v want none", warnings)
+		}
+	}
+
+	cfg.DataDirFilesystemDenylist = []string{strings.ToUpper(fstype)}
+	warnings, err := cfg.VerifyDataDir()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "is on a "+fstype+" filesystem") {
+		t.Fatalf("got warnings %v want %s warning", warnings, fstype)
+	}
+}
@@ -51,8 +51,9 @@ type DNSServer struct {
 }
 
 func NewDNSServer(a *Agent) (*DNSServer, error) {
+	cfg := a.RuntimeConfig()
 	var recursors []string
-	for _, r := range a.config.DNSRecursors {
+	for _, r := range cfg.DNSRecursors {
 		ra, err := recursorAddr(r)
 		if err != nil {
 			return nil, fmt.Errorf("Invalid recursor address: %v", err)
@@ -61,16 +62,16 @@ func NewDNSServer(a *Agent) (*DNSServer, error) {
 	}
 
 	// Make sure domain is FQDN, make it case insensitive for ServeMux
-	domain := dns.Fqdn(strings.ToLower(a.config.Domain))
+	domain := dns.Fqdn(strings.ToLower(cfg.Domain))
 
 	srv := &DNSServer{
 		agent:     a,
-		config:    &a.config.DNSConfig,
+		config:    &cfg.DNSConfig,
 		domain:    domain,
 		logger:    a.logger,
 		recursors: recursors,
 	}
-	srv.disableCompression.Store(a.config.DNSConfig.DisableCompression)
+	srv.disableCompression.Store(cfg.DNSConfig.DisableCompression)
 
 	return srv, nil
 }
@@ -120,10 +121,11 @@ START:
 
 // handlePtr is used to handle "reverse" DNS queries
 func (d *DNSServer) handlePtr(resp dns.ResponseWriter, req *dns.Msg) {
+	cfg := d.agent.RuntimeConfig()
 	q := req.Question[0]
 	defer func(s time.Time) {
 		metrics.MeasureSinceWithLabels([]string{"consul", "dns", "ptr_query"}, s,
-			[]metrics.Label{{Name: "node", Value: d.agent.config.NodeName}})
+			[]metrics.Label{{Name: "node", Value: cfg.NodeName}})
 		d.logger.Printf("[DEBUG] dns: request for %v (%v) from client %s (%s)",
 			q, time.Now().Sub(s), resp.RemoteAddr().String(),
 			resp.RemoteAddr().Network())
@@ -141,7 +143,7 @@ func (d *DNSServer) handlePtr(resp dns.ResponseWriter, req *dns.Msg) {
 		d.addSOA(m)
 	}
 
-	datacenter := d.agent.config.Datacenter
+	datacenter := cfg.Datacenter
 
 	// Get the QName without the domain suffix
 	qName := strings.ToLower(dns.Fqdn(req.Question[0].Name))
@@ -193,7 +195,7 @@ func (d *DNSServer) handleQuery(resp dns.ResponseWriter, req *dns.Msg) {
 	q := req.Question[0]
 	defer func(s time.Time) {
 		metrics.MeasureSinceWithLabels([]string{"consul", "dns", "domain_query"}, s,
-			[]metrics.Label{{Name: "node", Value: d.agent.config.NodeName}})
+			[]metrics.Label{{Name: "node", Value: d.agent.RuntimeConfig().NodeName}})
 		d.logger.Printf("[DEBUG] dns: request for %v (%v) from client %s (%s)",
 			q, time.Now().Sub(s), resp.RemoteAddr().String(),
 			resp.RemoteAddr().Network())
@@ -272,7 +274,7 @@ func (d *DNSServer) addSOA(msg *dns.Msg) {
 // nameservers returns the names and ip addresses of up to three random servers
 // in the current cluster which serve as authoritative name servers for zone.
 func (d *DNSServer) nameservers(edns bool) (ns []dns.RR, extra []dns.RR) {
-	out, err := d.lookupServiceNodes(d.agent.config.Datacenter, structs.ConsulServiceName, "")
+	out, err := d.lookupServiceNodes(d.agent.RuntimeConfig().Datacenter, structs.ConsulServiceName, "")
 	if err != nil {
 		d.logger.Printf("[WARN] dns: Unable to get list of servers: %s", err)
 		return nil, nil
@@ -325,7 +327,7 @@ func (d *DNSServer) nameservers(edns bool) (ns []dns.RR, extra []dns.RR) {
 // dispatch is used to parse a request and invoke the correct handler
 func (d *DNSServer) dispatch(network string, req, resp *dns.Msg) {
 	// By default the query is in the default datacenter
-	datacenter := d.agent.config.Datacenter
+	datacenter := d.agent.RuntimeConfig().Datacenter
 
 	// Get the QName without the domain suffix
 	qName := strings.ToLower(dns.Fqdn(req.Question[0].Name))
@@ -763,6 +765,8 @@ func (d *DNSServer) serviceLookup(network, datacenter, service, tag string, req,
 
 // preparedQueryLookup is used to handle a prepared query.
 func (d *DNSServer) preparedQueryLookup(network, datacenter, query string, req, resp *dns.Msg) {
+	cfg := d.agent.RuntimeConfig()
+
 	// Execute the prepared query.
 	args := structs.PreparedQueryExecuteRequest{
 		Datacenter:    datacenter,
@@ -777,8 +781,8 @@ func (d *DNSServer) preparedQueryLookup(network, datacenter, query string, req,
 		// send the local agent's data through to allow distance sorting
 		// relative to ourself on the server side.
 		Agent: structs.QuerySource{
-			Datacenter: d.agent.config.Datacenter,
-			Node:       d.agent.config.NodeName,
+			Datacenter: cfg.Datacenter,
+			Node:       cfg.NodeName,
 		},
 	}
 
@@ -308,7 +308,7 @@ func TestDNS_NodeLookup_CNAME(t *testing.T) {
 	defer recursor.Shutdown()
 
 	cfg := TestConfig()
-	cfg.DNSRecursor = recursor.Addr
+	cfg.DNSRecursors = []string{recursor.Addr}
 	a := NewTestAgent(t.Name(), cfg)
 	defer a.Shutdown()
 
@@ -2044,7 +2044,7 @@ func TestDNS_Recurse(t *testing.T) {
 	defer recursor.Shutdown()
 
 	cfg := TestConfig()
-	cfg.DNSRecursor = recursor.Addr
+	cfg.DNSRecursors = []string{recursor.Addr}
 	a := NewTestAgent(t.Name(), cfg)
 	defer a.Shutdown()
 
@@ -2076,7 +2076,7 @@ func TestDNS_Recurse_Truncation(t *testing.T) {
 	defer recursor.Shutdown()
 
 	cfg := TestConfig()
-	cfg.DNSRecursor = recursor.Addr
+	cfg.DNSRecursors = []string{recursor.Addr}
 	a := NewTestAgent(t.Name(), cfg)
 	defer a.Shutdown()
 
@@ -2117,7 +2117,7 @@ func TestDNS_RecursorTimeout(t *testing.T) {
 	defer resolver.Close()
 
 	cfg := TestConfig()
-	cfg.DNSRecursor = resolver.LocalAddr().String() // host must cause a connection|read|write timeout
+	cfg.DNSRecursors = []string{resolver.LocalAddr().String()} // host must cause a connection|read|write timeout
 	cfg.DNSConfig.RecursorTimeout = serverClientTimeout
 	a := NewTestAgent(t.Name(), cfg)
 	defer a.Shutdown()
@@ -2965,7 +2965,7 @@ func TestDNS_ServiceLookup_CNAME(t *testing.T) {
 	defer recursor.Shutdown()
 
 	cfg := TestConfig()
-	cfg.DNSRecursor = recursor.Addr
+	cfg.DNSRecursors = []string{recursor.Addr}
 	a := NewTestAgent(t.Name(), cfg)
 	defer a.Shutdown()
 
@@ -3062,7 +3062,7 @@ func TestDNS_NodeLookup_TTL(t *testing.T) {
 	defer recursor.Shutdown()
 
 	cfg := TestConfig()
-	cfg.DNSRecursor = recursor.Addr
+	cfg.DNSRecursors = []string{recursor.Addr}
 	cfg.DNSConfig.NodeTTL = 10 * time.Second
 	cfg.DNSConfig.AllowStale = Bool(true)
 	cfg.DNSConfig.MaxStale = time.Second
@@ -4763,7 +4763,7 @@ func TestDNS_Compression_Recurse(t *testing.T) {
 	defer recursor.Shutdown()
 
 	cfg := TestConfig()
-	cfg.DNSRecursor = recursor.Addr
+	cfg.DNSRecursors = []string{recursor.Addr}
 	a := NewTestAgent(t.Name(), cfg)
 	defer a.Shutdown()
 
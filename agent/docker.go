@@ -75,7 +75,9 @@ func ParseHost(host string) (string, string, string, error) {
 	return proto, addr, basePath, nil
 }
 
-func (c *DockerClient) call(method, uri string, v interface{}) (*circbuf.Buffer, int, error) {
+// call sends a request to the Docker API and returns up to maxbuf bytes of
+// the response body, or up to the buffer size of the client if maxbuf is 0.
+func (c *DockerClient) call(method, uri string, v interface{}, maxbuf int64) (*circbuf.Buffer, int, error) {
 	req, err := http.NewRequest(method, uri, nil)
 	if err != nil {
 		return nil, 0, err
@@ -105,7 +107,10 @@ func (c *DockerClient) call(method, uri string, v interface{}) (*circbuf.Buffer,
 	}
 	defer resp.Body.Close()
 
-	b, err := circbuf.NewBuffer(c.maxbuf)
+	if maxbuf <= 0 {
+		maxbuf = c.maxbuf
+	}
+	b, err := circbuf.NewBuffer(maxbuf)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -127,7 +132,7 @@ func (c *DockerClient) CreateExec(containerID string, cmd []string) (string, err
 	}
 
 	uri := fmt.Sprintf("/containers/%s/exec", url.QueryEscape(containerID))
-	b, code, err := c.call("POST", uri, data)
+	b, code, err := c.call("POST", uri, data, 0)
 	switch {
 	case err != nil:
 		return "", fmt.Errorf("create exec failed for container %s: %s", containerID, err)
@@ -146,10 +151,12 @@ func (c *DockerClient) CreateExec(containerID string, cmd []string) (string, err
 	}
 }
 
-func (c *DockerClient) StartExec(containerID, execID string) (*circbuf.Buffer, error) {
+// StartExec runs the exec instance and returns up to maxbuf bytes of its
+// output, or up to the buffer size of the client if maxbuf is 0.
+func (c *DockerClient) StartExec(containerID, execID string, maxbuf int64) (*circbuf.Buffer, error) {
 	data := struct{ Detach, Tty bool }{Detach: false, Tty: true}
 	uri := fmt.Sprintf("/exec/%s/start", execID)
-	b, code, err := c.call("POST", uri, data)
+	b, code, err := c.call("POST", uri, data, maxbuf)
 	switch {
 	case err != nil:
 		return nil, fmt.Errorf("start exec failed for container %s: %s", containerID, err)
@@ -166,7 +173,7 @@ func (c *DockerClient) StartExec(containerID, execID string) (*circbuf.Buffer, e
 
 func (c *DockerClient) InspectExec(containerID, execID string) (int, error) {
 	uri := fmt.Sprintf("/exec/%s/json", execID)
-	b, code, err := c.call("GET", uri, nil)
+	b, code, err := c.call("GET", uri, nil, 0)
 	switch {
 	case err != nil:
 		return 0, fmt.Errorf("inspect exec failed for container %s: %s", containerID, err)
@@ -0,0 +1,122 @@
+package agent
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/hashicorp/consul/agent/consul"
+	"github.com/hashicorp/consul/agent/structs"
+)
+
+// gossipKeySize is the size of generated gossip keys. It matches the keys
+// generated by "consul keygen".
+const gossipKeySize = 16
+
+// shouldRotateGossipKeys returns true if this agent is responsible for
+// rotating the gossip keys. Keyring operations are applied to all
+// datacenters, so only the leader of a single datacenter may rotate: the
+// ACL datacenter if one is configured.
+func (a *Agent) shouldRotateGossipKeys() bool {
+	srv, ok := a.delegate.(*consul.Server)
+	if !ok || !srv.IsLeader() {
+		return false
+	}
+	cfg := a.RuntimeConfig()
+	return cfg.ACLDatacenter == "" || cfg.ACLDatacenter == cfg.Datacenter
+}
+
+// rotateGossipKeys periodically installs a new gossip key, makes it the
+// primary key and removes keys beyond the configured number of retained
+// previous keys.
+func (a *Agent) rotateGossipKeys() {
+	cfg := a.RuntimeConfig()
+	interval := cfg.GossipKeyRotation.Interval
+	if interval <= 0 || !cfg.Server {
+		return
+	}
+
+	for {
+		select {
+		case <-time.After(interval):
+		case <-a.shutdownCh:
+			return
+		}
+
+		if !a.GossipEncrypted() || !a.shouldRotateGossipKeys() {
+			continue
+		}
+		if err := a.rotateGossipKey(); err != nil {
+			a.logger.Printf("[ERR] agent: Failed to rotate gossip key: %v", err)
+		}
+	}
+}
+
+// rotateGossipKey performs a single rotation of the gossip key.
+func (a *Agent) rotateGossipKey() error {
+	b := make([]byte, gossipKeySize)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	key := base64.StdEncoding.EncodeToString(b)
+	token := a.tokens.AgentToken()
+
+	keyringOp := func(op string, f func(string, string, uint8) (*structs.KeyringResponses, error), key string) error {
+		out, err := f(key, token, 0)
+		if err != nil {
+			return fmt.Errorf("%s: %v", op, err)
+		}
+		if err := keyringErrorsOrNil(out.Responses); err != nil {
+			return fmt.Errorf("%s: %v", op, err)
+		}
+		return nil
+	}
+	if err := keyringOp("install", a.InstallKey, key); err != nil {
+		return err
+	}
+	if err := keyringOp("use", a.UseKey, key); err != nil {
+		return err
+	}
+	a.logger.Printf("[INFO] agent: Rotated gossip key")
+
+	keys, err := a.localKeyringKeys()
+	if err != nil {
+		return fmt.Errorf("reading keyring: %v", err)
+	}
+	retain := a.RuntimeConfig().GossipKeyRotation.Retain
+	if len(keys) <= 1+retain {
+		return nil
+	}
+	for _, k := range keys[1+retain:] {
+		if err := keyringOp("remove", a.RemoveKey, k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// localKeyringKeys returns the keys of the local LAN keyring file, which
+// lists the primary key first, followed by the previous primary keys, most
+// recent first. Serf writes the file before it answers the keyring
+// operations, and the agent writes encrypted files before the keyring
+// operations return.
+func (a *Agent) localKeyringKeys() ([]string, error) {
+	path := filepath.Join(a.RuntimeConfig().DataDir, SerfLANKeyring)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := a.openDataFile(data)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	if err := json.Unmarshal(plaintext, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
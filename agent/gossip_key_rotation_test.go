@@ -0,0 +1,56 @@
+package agent
+
+import (
+	"testing"
+)
+
+func TestAgent_RotateGossipKey(t *testing.T) {
+	t.Parallel()
+	key := "tbLJg26ZJyJ9pK3qhc9jig=="
+	cfg := TestConfig()
+	cfg.GossipKeyRotation.Retain = 1
+
+	// Production agents have no partial consul configuration, so the keys
+	// must not be read from it. Without the faster raft timings of the test
+	// configuration the leader election can outlast the startup wait, and
+	// the keyring operations don't need a leader.
+	cfg.ConsulConfig = nil
+	cfg.Bootstrap = false
+	a := &TestAgent{Name: t.Name(), Config: cfg, Key: key}
+	a.Start()
+	defer a.Shutdown()
+
+	var primaries []string
+	for i := 0; i < 3; i++ {
+		if err := a.rotateGossipKey(); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		keys, err := a.localKeyringKeys()
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		primaries = append(primaries, keys[0])
+	}
+
+	// Only the current and the previous primary key must be left, in
+	// order of recency, on the local agent and in the cluster.
+	keys, err := a.localKeyringKeys()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(keys) != 2 || keys[0] != primaries[2] || keys[1] != primaries[1] {
+		t.Fatalf("got keys %v want %v", keys, primaries[1:])
+	}
+	if keys[0] == key || keys[1] == key {
+		t.Fatalf("original key should have been removed: %v", keys)
+	}
+	out, err := a.ListKeys("", 0)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	for _, r := range out.Responses {
+		if len(r.Keys) != 2 || r.Keys[primaries[2]] == 0 || r.Keys[primaries[1]] == 0 {
+			t.Fatalf("got keys %v in %s", r.Keys, r.Datacenter)
+		}
+	}
+}
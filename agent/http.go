@@ -1,6 +1,7 @@
 package agent
 
 import (
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -23,22 +24,36 @@ type HTTPServer struct {
 	agent     *Agent
 	blacklist *Blacklist
 
+	// clientSubjects restricts mutating requests over HTTPS to allowed
+	// client certificates.
+	clientSubjects *SubjectAllowlist
+
 	// proto is filled by the agent to "http" or "https".
 	proto string
 }
 
-func NewHTTPServer(addr string, a *Agent) *HTTPServer {
+func NewHTTPServer(addr string, a *Agent) (*HTTPServer, error) {
+	cfg := a.RuntimeConfig()
+
+	// The patterns are validated when the configuration is built, but
+	// configurations created in code haven't been.
+	clientSubjects, err := NewSubjectAllowlist(cfg.HTTPConfig.AllowedClientSubjects)
+	if err != nil {
+		return nil, err
+	}
 	s := &HTTPServer{
-		Server:    &http.Server{Addr: addr},
-		agent:     a,
-		blacklist: NewBlacklist(a.config.HTTPConfig.BlockEndpoints),
+		Server:         &http.Server{Addr: addr},
+		agent:          a,
+		blacklist:      NewBlacklist(cfg.HTTPConfig.BlockEndpoints),
+		clientSubjects: clientSubjects,
 	}
-	s.Server.Handler = s.handler(a.config.EnableDebug)
-	return s
+	s.Server.Handler = s.handler(cfg.EnableDebug)
+	return s, nil
 }
 
 // handler is used to attach our handlers to the mux
 func (s *HTTPServer) handler(enableDebug bool) http.Handler {
+	cfg := s.agent.RuntimeConfig()
 	mux := http.NewServeMux()
 
 	// handleFuncMetrics takes the given pattern and handler and wraps to produce
@@ -74,7 +89,7 @@ func (s *HTTPServer) handler(enableDebug bool) http.Handler {
 	mux.HandleFunc("/", s.Index)
 
 	// API V1.
-	if s.agent.config.ACLDatacenter != "" {
+	if cfg.ACLDatacenter != "" {
 		handleFuncMetrics("/v1/acl/bootstrap", s.wrap(s.ACLBootstrap))
 		handleFuncMetrics("/v1/acl/create", s.wrap(s.ACLCreate))
 		handleFuncMetrics("/v1/acl/update", s.wrap(s.ACLUpdate))
@@ -98,6 +113,7 @@ func (s *HTTPServer) handler(enableDebug bool) http.Handler {
 	handleFuncMetrics("/v1/agent/self", s.wrap(s.AgentSelf))
 	handleFuncMetrics("/v1/agent/maintenance", s.wrap(s.AgentNodeMaintenance))
 	handleFuncMetrics("/v1/agent/reload", s.wrap(s.AgentReload))
+	handleFuncMetrics("/v1/agent/config/validate", s.wrap(s.AgentConfigValidate))
 	handleFuncMetrics("/v1/agent/monitor", s.wrap(s.AgentMonitor))
 	handleFuncMetrics("/v1/agent/metrics", s.wrap(s.AgentMetrics))
 	handleFuncMetrics("/v1/agent/services", s.wrap(s.AgentServices))
@@ -122,7 +138,7 @@ func (s *HTTPServer) handler(enableDebug bool) http.Handler {
 	handleFuncMetrics("/v1/catalog/services", s.wrap(s.CatalogServices))
 	handleFuncMetrics("/v1/catalog/service/", s.wrap(s.CatalogServiceNodes))
 	handleFuncMetrics("/v1/catalog/node/", s.wrap(s.CatalogNodeServices))
-	if !s.agent.config.DisableCoordinates {
+	if !cfg.DisableCoordinates {
 		handleFuncMetrics("/v1/coordinate/datacenters", s.wrap(s.CoordinateDatacenters))
 		handleFuncMetrics("/v1/coordinate/nodes", s.wrap(s.CoordinateNodes))
 	} else {
@@ -166,9 +182,9 @@ func (s *HTTPServer) handler(enableDebug bool) http.Handler {
 	}
 
 	// Use the custom UI dir if provided.
-	if s.agent.config.UIDir != "" {
-		mux.Handle("/ui/", http.StripPrefix("/ui/", http.FileServer(http.Dir(s.agent.config.UIDir))))
-	} else if s.agent.config.EnableUI {
+	if cfg.UIDir != "" {
+		mux.Handle("/ui/", http.StripPrefix("/ui/", http.FileServer(http.Dir(cfg.UIDir))))
+	} else if cfg.EnableUI {
 		mux.Handle("/ui/", http.StripPrefix("/ui/", http.FileServer(assetFS())))
 	}
 	return mux
@@ -200,8 +216,12 @@ var (
 // wrap is used to wrap functions to make them more convenient
 func (s *HTTPServer) wrap(handler func(resp http.ResponseWriter, req *http.Request) (interface{}, error)) http.HandlerFunc {
 	return func(resp http.ResponseWriter, req *http.Request) {
-		setHeaders(resp, s.agent.config.HTTPConfig.ResponseHeaders)
-		setTranslateAddr(resp, s.agent.config.TranslateWanAddrs)
+		cfg := s.agent.RuntimeConfig()
+		setHeaders(resp, cfg.HTTPConfig.ResponseHeaders)
+		setTranslateAddr(resp, cfg.TranslateWanAddrs)
+
+		// handlerErr is the error reported to the client, if any.
+		var handlerErr error
 
 		// Obfuscate any tokens from appearing in the logs
 		formVals, err := url.ParseQuery(req.URL.RawQuery)
@@ -222,6 +242,35 @@ func (s *HTTPServer) wrap(handler func(resp http.ResponseWriter, req *http.Reque
 		}
 		logURL = aclEndpointRE.ReplaceAllString(logURL, "$1<hidden>$3")
 
+		// Record the request in the audit log once it has been handled.
+		if s.agent.auditLog != nil {
+			aw := &auditResponseWriter{ResponseWriter: resp}
+			resp = aw
+			start := time.Now()
+			defer func() {
+				var token string
+				s.parseToken(req, &token)
+				e := &auditEvent{
+					Time:       start.UTC(),
+					RemoteAddr: req.RemoteAddr,
+					Token:      auditTokenID(token),
+					Method:     req.Method,
+					URL:        logURL,
+					Status:     aw.status,
+					Duration:   time.Since(start).String(),
+				}
+				if e.Status == 0 {
+					e.Status = http.StatusOK
+				}
+				if handlerErr != nil {
+					e.Error = handlerErr.Error()
+				}
+				if err := s.agent.auditLog.Write(e); err != nil {
+					s.agent.logger.Printf("[ERR] http: Failed to write audit log: %v", err)
+				}
+			}()
+		}
+
 		if s.blacklist.Block(req.URL.Path) {
 			errMsg := "Endpoint is blocked by agent configuration"
 			s.agent.logger.Printf("[ERR] http: Request %s %v, error: %v from=%s", req.Method, logURL, err, req.RemoteAddr)
@@ -230,7 +279,30 @@ func (s *HTTPServer) wrap(handler func(resp http.ResponseWriter, req *http.Reque
 			return
 		}
 
+		if cfg.HTTPConfig.ReadOnly && isMutatingRequest(req) {
+			errMsg := "Agent is in read-only mode"
+			s.agent.logger.Printf("[ERR] http: Request %s %v, error: %v from=%s", req.Method, logURL, errMsg, req.RemoteAddr)
+			resp.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(resp, errMsg)
+			return
+		}
+
+		if s.proto == "https" && s.clientSubjects.Enabled() && req.Method != "GET" && req.Method != "HEAD" {
+			var cert *x509.Certificate
+			if req.TLS != nil && len(req.TLS.PeerCertificates) > 0 {
+				cert = req.TLS.PeerCertificates[0]
+			}
+			if !s.clientSubjects.Allow(cert) {
+				errMsg := "Client certificate is not allowed to access this endpoint"
+				s.agent.logger.Printf("[ERR] http: Request %s %v, error: %v from=%s", req.Method, logURL, errMsg, req.RemoteAddr)
+				resp.WriteHeader(http.StatusForbidden)
+				fmt.Fprint(resp, errMsg)
+				return
+			}
+		}
+
 		handleErr := func(err error) {
+			handlerErr = err
 			s.agent.logger.Printf("[ERR] http: Request %s %v, error: %v from=%s", req.Method, logURL, err, req.RemoteAddr)
 			switch {
 			case acl.IsErrPermissionDenied(err) || acl.IsErrNotFound(err):
@@ -269,7 +341,7 @@ func (s *HTTPServer) wrap(handler func(resp http.ResponseWriter, req *http.Reque
 // marshalJSON marshals the object into JSON, respecting the user's pretty-ness
 // configuration.
 func (s *HTTPServer) marshalJSON(req *http.Request, obj interface{}) ([]byte, error) {
-	if _, ok := req.URL.Query()["pretty"]; ok || s.agent.config.DevMode {
+	if _, ok := req.URL.Query()["pretty"]; ok || s.agent.RuntimeConfig().DevMode {
 		buf, err := json.MarshalIndent(obj, "", "    ")
 		if err != nil {
 			return nil, err
@@ -287,7 +359,8 @@ func (s *HTTPServer) marshalJSON(req *http.Request, obj interface{}) ([]byte, er
 
 // Returns true if the UI is enabled.
 func (s *HTTPServer) IsUIEnabled() bool {
-	return s.agent.config.UIDir != "" || s.agent.config.EnableUI
+	cfg := s.agent.RuntimeConfig()
+	return cfg.UIDir != "" || cfg.EnableUI
 }
 
 // Renders a simple index page
@@ -419,7 +492,7 @@ func (s *HTTPServer) parseDC(req *http.Request, dc *string) {
 	if other := req.URL.Query().Get("dc"); other != "" {
 		*dc = other
 	} else if *dc == "" {
-		*dc = s.agent.config.Datacenter
+		*dc = s.agent.RuntimeConfig().Datacenter
 	}
 }
 
@@ -446,7 +519,7 @@ func (s *HTTPServer) parseSource(req *http.Request, source *structs.QuerySource)
 	s.parseDC(req, &source.Datacenter)
 	if node := req.URL.Query().Get("near"); node != "" {
 		if node == "_agent" {
-			source.Node = s.agent.config.NodeName
+			source.Node = s.agent.RuntimeConfig().NodeName
 		} else {
 			source.Node = node
 		}
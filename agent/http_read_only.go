@@ -0,0 +1,51 @@
+package agent
+
+import (
+	"net/http"
+	"strings"
+)
+
+// mutatingEndpoints are the prefixes of the endpoints which change state
+// regardless of the request method, since some of them still accept GET
+// requests for compatibility.
+var mutatingEndpoints = []string{
+	"/v1/acl/create",
+	"/v1/acl/update",
+	"/v1/acl/destroy/",
+	"/v1/acl/clone/",
+	"/v1/agent/join/",
+	"/v1/agent/leave",
+	"/v1/agent/force-leave/",
+	"/v1/agent/maintenance",
+	"/v1/agent/reload",
+	"/v1/agent/token/",
+	"/v1/agent/check/",
+	"/v1/agent/service/",
+	"/v1/catalog/register",
+	"/v1/catalog/deregister",
+	"/v1/event/fire/",
+	"/v1/session/create",
+	"/v1/session/destroy/",
+	"/v1/session/renew/",
+	"/v1/txn",
+}
+
+// readOnlyEndpoints are the endpoints which only read state although they
+// are called with a method other than GET.
+var readOnlyEndpoints = map[string]bool{
+	"/v1/agent/config/validate": true,
+}
+
+// isMutatingRequest returns true if the request may change the state of
+// the agent or the cluster.
+func isMutatingRequest(req *http.Request) bool {
+	for _, prefix := range mutatingEndpoints {
+		if strings.HasPrefix(req.URL.Path, prefix) {
+			return true
+		}
+	}
+	if req.Method == "GET" || req.Method == "HEAD" {
+		return false
+	}
+	return !readOnlyEndpoints[req.URL.Path]
+}
@@ -231,6 +231,43 @@ func TestHTTPAPI_BlockEndpoints(t *testing.T) {
 	}
 }
 
+func TestHTTPAPI_ReadOnly(t *testing.T) {
+	t.Parallel()
+
+	cfg := TestConfig()
+	cfg.HTTPConfig.ReadOnly = true
+
+	a := NewTestAgent(t.Name(), cfg)
+	defer a.Shutdown()
+
+	handler := func(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+		return nil, nil
+	}
+
+	tests := []struct {
+		method, path string
+		code         int
+	}{
+		{"GET", "/v1/agent/self", http.StatusOK},
+		{"HEAD", "/v1/catalog/nodes", http.StatusOK},
+		{"PUT", "/v1/agent/config/validate", http.StatusOK},
+		{"PUT", "/v1/kv/foo", http.StatusForbidden},
+		{"DELETE", "/v1/kv/foo", http.StatusForbidden},
+		{"PUT", "/v1/agent/reload", http.StatusForbidden},
+		{"GET", "/v1/agent/join/127.0.0.1", http.StatusForbidden},
+		{"GET", "/v1/agent/check/pass/web", http.StatusForbidden},
+		{"GET", "/v1/agent/service/maintenance/web", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, tt.path, nil)
+		resp := httptest.NewRecorder()
+		a.srv.wrap(handler)(resp, req)
+		if got, want := resp.Code, tt.code; got != want {
+			t.Fatalf("%s %s: bad response code got %d want %d", tt.method, tt.path, got, want)
+		}
+	}
+}
+
 func TestHTTPAPI_TranslateAddrHeader(t *testing.T) {
 	t.Parallel()
 	// Header should not be present if address translation is off.
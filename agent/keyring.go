@@ -122,6 +122,17 @@ func (a *Agent) keyringProcess(args *structs.KeyringRequest) (*structs.KeyringRe
 	return &reply, nil
 }
 
+// keyringChange runs a keyring operation which changes the keys and
+// persists the encrypted keyrings before it returns, also if the operation
+// failed on some nodes since the local keyring may have changed anyway.
+func (a *Agent) keyringChange(args *structs.KeyringRequest) (*structs.KeyringResponses, error) {
+	reply, err := a.keyringProcess(args)
+	if perr := a.persistKeyrings(); perr != nil && err == nil {
+		err = perr
+	}
+	return reply, err
+}
+
 // ParseRelayFactor validates and converts the given relay factor to uint8
 func ParseRelayFactor(n int) (uint8, error) {
 	if n < 0 || n > 5 {
@@ -142,21 +153,21 @@ func (a *Agent) ListKeys(token string, relayFactor uint8) (*structs.KeyringRespo
 func (a *Agent) InstallKey(key, token string, relayFactor uint8) (*structs.KeyringResponses, error) {
 	args := structs.KeyringRequest{Key: key, Operation: structs.KeyringInstall}
 	parseKeyringRequest(&args, token, relayFactor)
-	return a.keyringProcess(&args)
+	return a.keyringChange(&args)
 }
 
 // UseKey changes the primary encryption key used to encrypt messages
 func (a *Agent) UseKey(key, token string, relayFactor uint8) (*structs.KeyringResponses, error) {
 	args := structs.KeyringRequest{Key: key, Operation: structs.KeyringUse}
 	parseKeyringRequest(&args, token, relayFactor)
-	return a.keyringProcess(&args)
+	return a.keyringChange(&args)
 }
 
 // RemoveKey will remove a gossip encryption key from the keyring
 func (a *Agent) RemoveKey(key, token string, relayFactor uint8) (*structs.KeyringResponses, error) {
 	args := structs.KeyringRequest{Key: key, Operation: structs.KeyringRemove}
 	parseKeyringRequest(&args, token, relayFactor)
-	return a.keyringProcess(&args)
+	return a.keyringChange(&args)
 }
 
 func parseKeyringRequest(req *structs.KeyringRequest, token string, relayFactor uint8) {
@@ -0,0 +1,49 @@
+package agent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/consul/types"
+	"github.com/hashicorp/go-uuid"
+)
+
+// NodeIDFile is the name of the file in the data directory which persists
+// the node ID.
+const NodeIDFile = "node-id"
+
+// ValidateNodeID returns the node ID in lower case, which is the form the
+// agent uses, or an error if it is not a UUID.
+func ValidateNodeID(id types.NodeID) (types.NodeID, error) {
+	lower := strings.ToLower(string(id))
+	if _, err := uuid.ParseUUID(lower); err != nil {
+		return "", fmt.Errorf("Invalid node ID %q: %s", id, err)
+	}
+	return types.NodeID(lower), nil
+}
+
+// ReadNodeIDFile returns the node ID persisted in the data directory, or an
+// empty ID if there is none. Older versions of Consul persisted IDs with
+// upper case letters or surrounding whitespace; legacy is true for these so
+// that the file can be migrated to the lower case form.
+func ReadNodeIDFile(dataDir string) (id types.NodeID, legacy bool, err error) {
+	path := filepath.Join(dataDir, NodeIDFile)
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("Error reading node ID from '%s': %s", path, err)
+	}
+
+	stored := string(raw)
+	id, err = ValidateNodeID(types.NodeID(strings.TrimSpace(stored)))
+	if err != nil {
+		return "", false, fmt.Errorf("Error reading node ID from '%s': %s. Fix or remove the file, "+
+			"which lets the agent generate a new node ID", path, err)
+	}
+	return id, stored != string(id), nil
+}
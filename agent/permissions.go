@@ -0,0 +1,91 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// parseFileMode parses an octal file mode as used in the permissions block.
+func parseFileMode(name, s string) (os.FileMode, error) {
+	m, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || m > 0777 {
+		return 0, fmt.Errorf("permissions.%s: invalid mode %q", name, s)
+	}
+	return os.FileMode(m), nil
+}
+
+// AuditPermissions checks the ownership and modes of the data directory, the
+// given configuration directories and the configuration files read from the
+// given paths, which are the same files that ReadConfigPaths reads, and the
+// files referenced by file secret references against the permissions block. All violations are
+// returned so that they can be reported at once. Paths which do not exist
+// are skipped since their absence is reported elsewhere.
+func (c *Config) AuditPermissions(configPaths []string) ([]string, error) {
+	dataDirMode, err := parseFileMode("data_dir_mode", c.Permissions.DataDirMode)
+	if err != nil {
+		return nil, err
+	}
+	configFileMode, err := parseFileMode("config_file_mode", c.Permissions.ConfigFileMode)
+	if err != nil {
+		return nil, err
+	}
+	secretFileMode, err := parseFileMode("secret_file_mode", c.Permissions.SecretFileMode)
+	if err != nil {
+		return nil, err
+	}
+
+	var violations []string
+	audit := func(kind, path string, max os.FileMode) os.FileInfo {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil
+		}
+		violations = append(violations, auditFileInfo(kind, path, fi, max)...)
+		return fi
+	}
+
+	if c.DataDir != "" {
+		audit("data_dir", c.DataDir, dataDirMode)
+	}
+	for _, path := range ExpandConfigGlobs(configPaths) {
+		if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+			audit("config", path, configFileMode)
+		}
+	}
+	for _, f := range configFiles(configPaths) {
+		if f.err == nil {
+			audit("config", f.path, configFileMode)
+		}
+	}
+	secretFiles := secretFilesFromConfig(c)
+	if c.DataDirEncryption.KeyFile != "" {
+		secretFiles = append(secretFiles, c.DataDirEncryption.KeyFile)
+	}
+	for _, path := range secretFiles {
+		audit("secret", path, secretFileMode)
+	}
+	return violations, nil
+}
+
+// auditFileInfo returns the violations for a single file or directory. Files
+// must be owned by the user running the agent or by root and must not grant
+// more permissions than max. Directories may additionally be searchable
+// wherever they are readable.
+func auditFileInfo(kind, path string, fi os.FileInfo, max os.FileMode) []string {
+	if !permissionAuditSupported {
+		return nil
+	}
+
+	var violations []string
+	if uid, ok := fileOwner(fi); ok && uid != 0 && uid != os.Getuid() {
+		violations = append(violations, fmt.Sprintf("%s %q is owned by uid %d, expected uid %d or root", kind, path, uid, os.Getuid()))
+	}
+	if fi.IsDir() {
+		max |= (max & 0444) >> 2
+	}
+	if mode := fi.Mode().Perm(); mode&^max != 0 {
+		violations = append(violations, fmt.Sprintf("%s %q has mode %04o, expected at most %04o", kind, path, mode, max))
+	}
+	return violations
+}
@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/hashicorp/consul/testutil"
+	"github.com/pascaldekloe/goe/verify"
+)
+
+func TestConfig_AuditPermissions(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not audited on windows")
+	}
+
+	td := testutil.TempDir(t, "audit")
+	defer os.RemoveAll(td)
+
+	dataDir := filepath.Join(td, "data")
+	configDir := filepath.Join(td, "config.d")
+	configFile := filepath.Join(configDir, "a.json")
+	emptyFile := filepath.Join(configDir, "b.json")
+	ignoredFile := filepath.Join(configDir, "README")
+	subDir := filepath.Join(configDir, "services")
+	subFile := filepath.Join(subDir, "web.hcl")
+	globFile := filepath.Join(td, "extra.yaml")
+	secretFile := filepath.Join(td, "token")
+	keyFile := filepath.Join(td, "key")
+	if err := os.Mkdir(dataDir, 0755); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := os.MkdirAll(subDir, 0755); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	files := map[string]os.FileMode{
+		configFile:  0666,
+		emptyFile:   0666,
+		ignoredFile: 0666,
+		subFile:     0664,
+		globFile:    0666,
+		secretFile:  0640,
+		keyFile:     0600,
+	}
+	for path, mode := range files {
+		data := []byte("{}")
+		if path == emptyFile {
+			data = nil
+		}
+		if err := ioutil.WriteFile(path, data, mode); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if err := os.Chmod(path, mode); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	c := DefaultConfig()
+	c.DataDir = dataDir
+	c.DataDirEncryption.KeyFile = keyFile
+	c.SecretRefs = map[string]string{"acl_token": "ref+file://" + secretFile}
+
+	// The files which are read are audited: the configuration files of
+	// the directories expanded recursively and of the glob patterns, but
+	// not empty files or files of other types.
+	paths, err := ExpandConfigDirs([]string{configDir, filepath.Join(td, "*.yaml"), filepath.Join(td, "missing.json")})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	violations, err := c.AuditPermissions(paths)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	want := []string{
+		`data_dir "` + dataDir + `" has mode 0755, expected at most 0750`,
+		`config "` + configFile + `" has mode 0666, expected at most 0644`,
+		`config "` + subFile + `" has mode 0664, expected at most 0644`,
+		`config "` + globFile + `" has mode 0666, expected at most 0644`,
+		`secret "` + secretFile + `" has mode 0640, expected at most 0600`,
+	}
+	verify.Values(t, "", violations, want)
+
+	// Relaxed expectations accept the same tree.
+	c.Permissions = Permissions{DataDirMode: "755", ConfigFileMode: "666", SecretFileMode: "640"}
+	violations, err = c.AuditPermissions(paths)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	verify.Values(t, "", violations, []string(nil))
+
+	c.Permissions.SecretFileMode = "rw"
+	if _, err := c.AuditPermissions(nil); err == nil || err.Error() != `permissions.secret_file_mode: invalid mode "rw"` {
+		t.Fatalf("got error %v", err)
+	}
+}
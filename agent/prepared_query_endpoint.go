@@ -91,11 +91,12 @@ func parseLimit(req *http.Request, limit *int) error {
 
 // preparedQueryExecute executes a prepared query.
 func (s *HTTPServer) preparedQueryExecute(id string, resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	cfg := s.agent.RuntimeConfig()
 	args := structs.PreparedQueryExecuteRequest{
 		QueryIDOrName: id,
 		Agent: structs.QuerySource{
-			Node:       s.agent.config.NodeName,
-			Datacenter: s.agent.config.Datacenter,
+			Node:       cfg.NodeName,
+			Datacenter: cfg.Datacenter,
 		},
 	}
 	s.parseSource(req, &args.Source)
@@ -135,11 +136,12 @@ func (s *HTTPServer) preparedQueryExecute(id string, resp http.ResponseWriter, r
 // interpolated template (if it's a template), as well as additional info
 // about the execution of a query.
 func (s *HTTPServer) preparedQueryExplain(id string, resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	cfg := s.agent.RuntimeConfig()
 	args := structs.PreparedQueryExecuteRequest{
 		QueryIDOrName: id,
 		Agent: structs.QuerySource{
-			Node:       s.agent.config.NodeName,
-			Datacenter: s.agent.config.Datacenter,
+			Node:       cfg.NodeName,
+			Datacenter: cfg.Datacenter,
 		},
 	}
 	s.parseSource(req, &args.Source)
@@ -237,7 +237,7 @@ WAIT:
 // Returns if execution should continue
 func (a *Agent) remoteExecGetSpec(event *remoteExecEvent, spec *remoteExecSpec) bool {
 	get := structs.KeyRequest{
-		Datacenter: a.config.Datacenter,
+		Datacenter: a.RuntimeConfig().Datacenter,
 		Key:        path.Join(event.Prefix, event.Session, remoteExecFileName),
 		QueryOptions: structs.QueryOptions{
 			AllowStale: true, // Stale read for scale! Retry on failure.
@@ -300,9 +300,10 @@ func (a *Agent) remoteExecWriteExitCode(event *remoteExecEvent, exitCode *int) b
 
 // remoteExecWriteKey is used to write an output key for a remote exec job
 func (a *Agent) remoteExecWriteKey(event *remoteExecEvent, suffix string, val []byte) error {
-	key := path.Join(event.Prefix, event.Session, a.config.NodeName, suffix)
+	cfg := a.RuntimeConfig()
+	key := path.Join(event.Prefix, event.Session, cfg.NodeName, suffix)
 	write := structs.KVSRequest{
-		Datacenter: a.config.Datacenter,
+		Datacenter: cfg.Datacenter,
 		Op:         api.KVLock,
 		DirEnt: structs.DirEntry{
 			Key:     key,
@@ -317,10 +317,10 @@ func TestHandleRemoteExecFailed(t *testing.T) {
 
 func makeRexecSession(t *testing.T, a *Agent, token string) string {
 	args := structs.SessionRequest{
-		Datacenter: a.config.Datacenter,
+		Datacenter: a.RuntimeConfig().Datacenter,
 		Op:         structs.SessionCreate,
 		Session: structs.Session{
-			Node:      a.config.NodeName,
+			Node:      a.RuntimeConfig().NodeName,
 			LockDelay: 15 * time.Second,
 		},
 		WriteRequest: structs.WriteRequest{
@@ -336,7 +336,7 @@ func makeRexecSession(t *testing.T, a *Agent, token string) string {
 
 func destroySession(t *testing.T, a *Agent, session string, token string) {
 	args := structs.SessionRequest{
-		Datacenter: a.config.Datacenter,
+		Datacenter: a.RuntimeConfig().Datacenter,
 		Op:         structs.SessionDestroy,
 		Session: structs.Session{
 			ID: session,
@@ -353,7 +353,7 @@ func destroySession(t *testing.T, a *Agent, session string, token string) {
 
 func setKV(t *testing.T, a *Agent, key string, val []byte, token string) {
 	write := structs.KVSRequest{
-		Datacenter: a.config.Datacenter,
+		Datacenter: a.RuntimeConfig().Datacenter,
 		Op:         api.KVSet,
 		DirEnt: structs.DirEntry{
 			Key:   key,
@@ -371,7 +371,7 @@ func setKV(t *testing.T, a *Agent, key string, val []byte, token string) {
 
 func getKV(t *testing.T, a *Agent, key string, token string) *structs.DirEntry {
 	req := structs.KeyRequest{
-		Datacenter: a.config.Datacenter,
+		Datacenter: a.RuntimeConfig().Datacenter,
 		Key:        key,
 		QueryOptions: structs.QueryOptions{
 			Token: token,
@@ -10,11 +10,12 @@ import (
 )
 
 func (a *Agent) retryJoinLAN() {
+	cfg := a.RuntimeConfig()
 	r := &retryJoiner{
 		cluster:     "LAN",
-		addrs:       a.config.RetryJoin,
-		maxAttempts: a.config.RetryMaxAttempts,
-		interval:    a.config.RetryInterval,
+		addrs:       cfg.RetryJoin,
+		maxAttempts: cfg.RetryMaxAttempts,
+		interval:    cfg.RetryInterval,
 		join:        a.JoinLAN,
 		logger:      a.logger,
 	}
@@ -24,11 +25,12 @@ func (a *Agent) retryJoinLAN() {
 }
 
 func (a *Agent) retryJoinWAN() {
+	cfg := a.RuntimeConfig()
 	r := &retryJoiner{
 		cluster:     "WAN",
-		addrs:       a.config.RetryJoinWan,
-		maxAttempts: a.config.RetryMaxAttemptsWan,
-		interval:    a.config.RetryIntervalWan,
+		addrs:       cfg.RetryJoinWan,
+		maxAttempts: cfg.RetryMaxAttemptsWan,
+		interval:    cfg.RetryIntervalWan,
 		join:        a.JoinWAN,
 		logger:      a.logger,
 	}
@@ -112,3 +114,29 @@ func (r *retryJoiner) retryJoin() error {
 		time.Sleep(r.interval)
 	}
 }
+
+// validateRetryJoin checks the go-discover configurations among the
+// addresses of the retry join setting key, so that a mistyped provider is
+// reported when the configuration is read instead of on every join attempt.
+// The configurations are not included in the errors since they may contain
+// credentials.
+func validateRetryJoin(key string, addrs []string) []error {
+	var errs []error
+	for i, addr := range addrs {
+		if !strings.Contains(addr, "provider=") {
+			continue
+		}
+		cfg, err := discover.Parse(addr)
+		if err != nil {
+			errs = append(errs, configErrorf([]string{key}, "%s[%d]: %s", key, i, err))
+			continue
+		}
+		name := cfg["provider"]
+		if _, ok := discover.Providers[name]; !ok {
+			names := (&discover.Discover{}).Names()
+			errs = append(errs, configErrorf([]string{key}, "%s[%d]: unknown provider %q, must be one of %s",
+				key, i, name, strings.Join(names, ", ")))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,282 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+)
+
+// secretRefPrefix marks a string config value as a reference to a secret
+// which is resolved during config building. References have the form
+// "ref+<scheme>://<location>".
+const secretRefPrefix = "ref+"
+
+// SecretResolver resolves the location part of a secret reference to the
+// secret it refers to.
+type SecretResolver interface {
+	Resolve(location string) (string, error)
+}
+
+// SecretResolverFunc is an adapter to allow the use of ordinary functions
+// as a SecretResolver.
+type SecretResolverFunc func(location string) (string, error)
+
+// Resolve calls f(location).
+func (f SecretResolverFunc) Resolve(location string) (string, error) {
+	return f(location)
+}
+
+var (
+	secretResolversLock sync.RWMutex
+	secretResolvers     = map[string]SecretResolver{
+		"env":    SecretResolverFunc(resolveEnvSecret),
+		"file":   SecretResolverFunc(resolveFileSecret),
+		"vault":  SecretResolverFunc(resolveVaultSecret),
+		"aws-sm": SecretResolverFunc(resolveAWSSecret),
+	}
+)
+
+// RegisterSecretResolver registers a resolver for the given scheme so that
+// config values of the form "ref+<scheme>://..." are resolved with it. An
+// existing resolver for the scheme is replaced.
+func RegisterSecretResolver(scheme string, r SecretResolver) {
+	secretResolversLock.Lock()
+	defer secretResolversLock.Unlock()
+	secretResolvers[scheme] = r
+}
+
+// parseSecretRef splits a secret reference into its scheme and location. ok
+// is false if the value is not a secret reference.
+func parseSecretRef(v string) (scheme, location string, ok bool) {
+	if !strings.HasPrefix(v, secretRefPrefix) {
+		return "", "", false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(v, secretRefPrefix), "://", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// resolveSecretRef resolves a single secret reference.
+func resolveSecretRef(ref string) (string, error) {
+	scheme, location, ok := parseSecretRef(ref)
+	if !ok {
+		return "", fmt.Errorf("invalid secret reference %q", ref)
+	}
+
+	secretResolversLock.RLock()
+	r, ok := secretResolvers[scheme]
+	secretResolversLock.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("unknown secret reference scheme %q", scheme)
+	}
+	return r.Resolve(location)
+}
+
+// ResolveSecretRefs replaces every string value in the configuration which
+// is written as a secret reference with the secret it refers to. The
+// original references are recorded in SecretRefs keyed by the config key of
+// the field so that the resolved values can be treated as secrets.
+func (c *Config) ResolveSecretRefs() error {
+	if c == nil {
+		return nil
+	}
+	refs := make(map[string]string)
+	err := walkConfigStrings(mergeFieldsForConfig(), reflect.ValueOf(c).Elem(), func(name, s string) (string, error) {
+		if _, _, ok := parseSecretRef(s); !ok {
+			return s, nil
+		}
+		secret, err := resolveSecretRef(s)
+		if err != nil {
+			return "", fmt.Errorf("Failed to resolve %s: %v", name, err)
+		}
+		refs[name] = s
+		return secret, nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(refs) > 0 {
+		c.SecretRefs = refs
+	}
+	return nil
+}
+
+// redactSecretRefs returns a copy of the configuration in which all values
+// that were resolved from secret references are hidden.
+func (c *Config) redactSecretRefs() *Config {
+	if len(c.SecretRefs) == 0 {
+		return c
+	}
+	redacted := *c
+	walkConfigStrings(mergeFieldsForConfig(), reflect.ValueOf(&redacted).Elem(), func(name, s string) (string, error) {
+		if _, ok := c.SecretRefs[name]; ok {
+			return "hidden", nil
+		}
+		return s, nil
+	})
+	return &redacted
+}
+
+// walkConfigStrings calls fn for every string, string slice element and
+// string map value of the fields in the merge plan which are set by a
+// configuration key, and replaces the value with the result. Values are
+// named by their keys, slice elements like "retry_join[0]" and map values
+// like "node_meta.rack". Slices, maps and blocks referenced by pointer are
+// copied before they are modified so that the walk can be used on a
+// shallow copy of a config.
+func walkConfigStrings(fields []mergeField, v reflect.Value, fn func(name, s string) (string, error)) error {
+	for _, f := range fields {
+		fv := v.Field(f.index)
+		switch f.kind {
+		case mergeStruct:
+			if err := walkConfigStrings(f.fields, fv, fn); err != nil {
+				return err
+			}
+			continue
+
+		case mergeStructPtr:
+			if fv.IsNil() {
+				continue
+			}
+			cp := reflect.New(fv.Type().Elem())
+			cp.Elem().Set(fv.Elem())
+			if err := walkConfigStrings(f.fields, cp.Elem(), fn); err != nil {
+				return err
+			}
+			fv.Set(cp)
+			continue
+		}
+		if f.key == "" {
+			continue
+		}
+		if err := walkConfigValue(fv, f.key, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkConfigValue calls fn for the strings of the value of the given key
+// like walkConfigStrings.
+func walkConfigValue(v reflect.Value, key string, fn func(name, s string) (string, error)) error {
+	switch v.Kind() {
+	case reflect.String:
+		s, err := fn(key, v.String())
+		if err != nil {
+			return err
+		}
+		if s != v.String() {
+			v.SetString(s)
+		}
+
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String || v.Len() == 0 {
+			return nil
+		}
+		out := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			s, err := fn(fmt.Sprintf("%s[%d]", key, i), v.Index(i).String())
+			if err != nil {
+				return err
+			}
+			out.Index(i).SetString(s)
+		}
+		v.Set(out)
+
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String || v.Type().Elem().Kind() != reflect.String || v.Len() == 0 {
+			return nil
+		}
+		out := reflect.MakeMap(v.Type())
+		for _, k := range v.MapKeys() {
+			s, err := fn(key+"."+k.String(), v.MapIndex(k).String())
+			if err != nil {
+				return err
+			}
+			out.SetMapIndex(k, reflect.ValueOf(s).Convert(v.Type().Elem()))
+		}
+		v.Set(out)
+	}
+	return nil
+}
+
+// resolveEnvSecret resolves "ref+env://NAME" to the value of the environment
+// variable NAME.
+func resolveEnvSecret(name string) (string, error) {
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %q is not set", name)
+	}
+	return v, nil
+}
+
+// resolveFileSecret resolves "ref+file:///path" to the contents of the file
+// with surrounding whitespace removed.
+func resolveFileSecret(path string) (string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// resolveVaultSecret resolves "ref+vault://<path>#<key>" by reading the
+// secret at path from the Vault server configured through the VAULT_ADDR
+// and VAULT_TOKEN environment variables. Both the KV version 1 and version
+// 2 response formats are supported.
+func resolveVaultSecret(location string) (string, error) {
+	parts := strings.SplitN(location, "#", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", fmt.Errorf("vault reference %q must have the form <path>#<key>", location)
+	}
+	path, key := strings.Trim(parts[0], "/"), parts[1]
+
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return "", fmt.Errorf("VAULT_ADDR is not set")
+	}
+	req, err := http.NewRequest("GET", strings.TrimRight(addr, "/")+"/v1/"+path, nil)
+	if err != nil {
+		return "", err
+	}
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+
+	client := cleanhttp.DefaultClient()
+	client.Timeout = 10 * time.Second
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned %s for %q", resp.Status, path)
+	}
+
+	var out struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("failed to decode vault response: %v", err)
+	}
+	data := out.Data
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		data = inner
+	}
+	v, ok := data[key].(string)
+	if !ok {
+		return "", fmt.Errorf("vault secret %q has no string key %q", path, key)
+	}
+	return v, nil
+}
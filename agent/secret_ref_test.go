@@ -0,0 +1,133 @@
+package agent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/consul/testutil"
+	"github.com/pascaldekloe/goe/verify"
+)
+
+func TestConfig_ResolveSecretRefs(t *testing.T) {
+	os.Setenv("CONSUL_TEST_SECRET_REF", "env-secret")
+	defer os.Unsetenv("CONSUL_TEST_SECRET_REF")
+
+	tf := testutil.TempFile(t, "secret")
+	tf.Write([]byte("file-secret\n"))
+	tf.Close()
+	defer os.Remove(tf.Name())
+
+	c := &Config{
+		ACLToken:  "ref+env://CONSUL_TEST_SECRET_REF",
+		Telemetry: Telemetry{CirconusAPIToken: "ref+file://" + tf.Name()},
+		RetryJoin: []string{"1.2.3.4", "ref+env://CONSUL_TEST_SECRET_REF"},
+		Meta:      map[string]string{"rack": "ref+env://CONSUL_TEST_SECRET_REF"},
+		NodeName:  "node1",
+	}
+	if err := c.ResolveSecretRefs(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	want := &Config{
+		ACLToken:  "env-secret",
+		Telemetry: Telemetry{CirconusAPIToken: "file-secret"},
+		RetryJoin: []string{"1.2.3.4", "env-secret"},
+		Meta:      map[string]string{"rack": "env-secret"},
+		NodeName:  "node1",
+		SecretRefs: map[string]string{
+			"acl_token":                    "ref+env://CONSUL_TEST_SECRET_REF",
+			"telemetry.circonus_api_token": "ref+file://" + tf.Name(),
+			"retry_join[1]":                "ref+env://CONSUL_TEST_SECRET_REF",
+			"node_meta.rack":               "ref+env://CONSUL_TEST_SECRET_REF",
+		},
+	}
+	verify.Values(t, "", c, want)
+
+	// The redacted copy must hide the secrets without touching the original.
+	r := c.redactSecretRefs()
+	if r.ACLToken != "hidden" || r.RetryJoin[1] != "hidden" || r.Meta["rack"] != "hidden" {
+		t.Fatalf("secrets not redacted: %#v", r)
+	}
+	if r.RetryJoin[0] != "1.2.3.4" || r.NodeName != "node1" {
+		t.Fatalf("bad: %#v", r)
+	}
+	if c.ACLToken != "env-secret" || c.RetryJoin[1] != "env-secret" || c.Meta["rack"] != "env-secret" {
+		t.Fatalf("original modified: %#v", c)
+	}
+}
+
+func TestConfig_ResolveSecretRefs_Errors(t *testing.T) {
+	tests := []struct {
+		in  string
+		err string
+	}{
+		{"ref+nope://x", `Failed to resolve datacenter: unknown secret reference scheme "nope"`},
+		{"ref+env://CONSUL_TEST_SECRET_REF_UNSET", `Failed to resolve datacenter: environment variable "CONSUL_TEST_SECRET_REF_UNSET" is not set`},
+		{"ref+vault://secret/foo", `Failed to resolve datacenter: vault reference "secret/foo" must have the form <path>#<key>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			c := &Config{Datacenter: tt.in}
+			err := c.ResolveSecretRefs()
+			if err == nil || err.Error() != tt.err {
+				t.Fatalf("got error %v want %s", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestConfig_ResolveSecretRefs_Vault(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got, want := r.Header.Get("X-Vault-Token"), "root"; got != want {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/consul":
+			w.Write([]byte(`{"data":{"gossip":"v1-secret"}}`))
+		case "/v1/kv/data/consul":
+			w.Write([]byte(`{"data":{"data":{"gossip":"v2-secret"}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	os.Setenv("VAULT_ADDR", srv.URL)
+	os.Setenv("VAULT_TOKEN", "root")
+	defer os.Unsetenv("VAULT_ADDR")
+	defer os.Unsetenv("VAULT_TOKEN")
+
+	c := &Config{
+		EncryptKey:     "ref+vault://secret/consul#gossip",
+		ACLMasterToken: "ref+vault://kv/data/consul#gossip",
+	}
+	if err := c.ResolveSecretRefs(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if c.EncryptKey != "v1-secret" || c.ACLMasterToken != "v2-secret" {
+		t.Fatalf("bad: %#v", c)
+	}
+
+	c = &Config{EncryptKey: "ref+vault://secret/missing#gossip"}
+	if err := c.ResolveSecretRefs(); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("got error %v", err)
+	}
+}
+
+func TestRegisterSecretResolver(t *testing.T) {
+	RegisterSecretResolver("test", SecretResolverFunc(func(location string) (string, error) {
+		return strings.ToUpper(location), nil
+	}))
+
+	c := &Config{NodeName: "ref+test://node"}
+	if err := c.ResolveSecretRefs(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if c.NodeName != "NODE" {
+		t.Fatalf("bad: %#v", c)
+	}
+}
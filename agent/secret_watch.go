@@ -0,0 +1,88 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// secretFilesFromConfig returns the sorted, de-duplicated list of files
+// referenced by file secret references in the given configuration.
+func secretFilesFromConfig(c *Config) []string {
+	seen := make(map[string]bool)
+	var files []string
+	for _, ref := range c.SecretRefs {
+		scheme, path, ok := parseSecretRef(ref)
+		if !ok || scheme != "file" || seen[path] {
+			continue
+		}
+		seen[path] = true
+		files = append(files, path)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// setSecretFiles updates the set of watched secret files from the given
+// configuration. The license file is watched as well.
+func (a *Agent) setSecretFiles(c *Config) {
+	a.secretFilesLock.Lock()
+	defer a.secretFilesLock.Unlock()
+	a.secretFiles = secretFilesFromConfig(c)
+	if c.LicensePath != "" {
+		a.secretFiles = append(a.secretFiles, c.LicensePath)
+	}
+}
+
+// secretFileHashes returns a content hash for every watched secret file.
+// Files which cannot be read get an empty hash so that removing or
+// restoring a file is detected as a change.
+func (a *Agent) secretFileHashes() map[string][sha256.Size]byte {
+	a.secretFilesLock.Lock()
+	files := a.secretFiles
+	a.secretFilesLock.Unlock()
+
+	hashes := make(map[string][sha256.Size]byte, len(files))
+	for _, path := range files {
+		var h [sha256.Size]byte
+		if b, err := ioutil.ReadFile(path); err == nil {
+			h = sha256.Sum256(b)
+		}
+		hashes[path] = h
+	}
+	return hashes
+}
+
+// watchSecretFiles periodically checks the files referenced by file secret
+// references and triggers a configuration reload when any of them changes.
+// Content hashes are compared instead of modification times so that files
+// replaced through a symlink swap, as done for mounted volumes, are
+// detected as well.
+func (a *Agent) watchSecretFiles() {
+	interval := a.RuntimeConfig().SecretFileWatchInterval
+	if interval <= 0 {
+		return
+	}
+
+	hashes := a.secretFileHashes()
+	for {
+		select {
+		case <-time.After(interval):
+		case <-a.shutdownCh:
+			return
+		}
+
+		current := a.secretFileHashes()
+		if reflect.DeepEqual(current, hashes) {
+			continue
+		}
+
+		a.logger.Printf("[INFO] agent: Secret file changed, reloading configuration")
+		if err := a.TriggerReload(); err != nil {
+			a.logger.Printf("[ERR] agent: Failed to reload configuration after secret file change: %v", err)
+		}
+		hashes = a.secretFileHashes()
+	}
+}
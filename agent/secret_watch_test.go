@@ -0,0 +1,149 @@
+package agent
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/testutil"
+	"github.com/pascaldekloe/goe/verify"
+)
+
+func TestSecretFilesFromConfig(t *testing.T) {
+	t.Parallel()
+	c := &Config{
+		SecretRefs: map[string]string{
+			"acl_token":     "ref+file:///b",
+			"encrypt":       "ref+file:///a",
+			"acl_agent":     "ref+file:///a",
+			"cert_file":     "ref+env://CERT",
+			"retry_join[0]": "ref+vault://secret/x#y",
+		},
+	}
+	verify.Values(t, "", secretFilesFromConfig(c), []string{"/a", "/b"})
+}
+
+func TestAgent_WatchSecretFiles(t *testing.T) {
+	t.Parallel()
+	td := testutil.TempDir(t, "secret")
+	defer os.RemoveAll(td)
+
+	path := filepath.Join(td, "token")
+	if err := ioutil.WriteFile(path, []byte("one"), 0600); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cfg := TestConfig()
+	cfg.SecretFileWatchInterval = 10 * time.Millisecond
+	cfg.SecretRefs = map[string]string{"acl_token": "ref+file://" + path}
+	a := &Agent{
+		logger:     log.New(os.Stderr, "", log.LstdFlags),
+		reloadCh:   make(chan chan error),
+		shutdownCh: make(chan struct{}),
+	}
+	a.config.Store(cfg)
+	defer close(a.shutdownCh)
+	a.setSecretFiles(cfg)
+	go a.watchSecretFiles()
+
+	// Nothing changed, so no reload must be requested.
+	select {
+	case <-a.reloadCh:
+		t.Fatal("unexpected reload")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := ioutil.WriteFile(path, []byte("two"), 0600); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	select {
+	case errCh := <-a.reloadCh:
+		errCh <- nil
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected reload after secret file change")
+	}
+}
+
+func TestAgent_setSecretFiles_License(t *testing.T) {
+	t.Parallel()
+	a := &Agent{}
+	a.setSecretFiles(&Config{
+		SecretRefs:  map[string]string{"acl_token": "ref+file:///b"},
+		LicensePath: "/etc/consul/license.hclic",
+	})
+	verify.Values(t, "", a.secretFiles, []string{"/b", "/etc/consul/license.hclic"})
+}
+
+func TestAgent_ReloadConfig_SecretFileTokens(t *testing.T) {
+	t.Parallel()
+	td := testutil.TempDir(t, "secret")
+	defer os.RemoveAll(td)
+
+	path := filepath.Join(td, "agent-token")
+	build := func(token string) *Config {
+		if err := ioutil.WriteFile(path, []byte(token), 0600); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		b := &ConfigBuilder{
+			Default: TestConfig(),
+			Sources: []ConfigSource{{Name: "token", Format: ConfigFormatJSON, Data: `{"acl_agent_token_file": "` + path + `"}`}},
+		}
+		cfg, _, err := b.Build()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		return cfg
+	}
+
+	a := NewTestAgent(t.Name(), build("one"))
+	defer a.Shutdown()
+	if got := a.tokens.AgentToken(); got != "one" {
+		t.Fatalf("got agent token %q", got)
+	}
+
+	// A rotated token is applied by a reload.
+	if err := a.ReloadConfig(build("two")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if got := a.tokens.AgentToken(); got != "two" {
+		t.Fatalf("got agent token %q want %q", got, "two")
+	}
+	if got := a.RuntimeConfig().ACLAgentToken; got != "two" {
+		t.Fatalf("got configured agent token %q want %q", got, "two")
+	}
+
+	// A token set through the API is kept if the file didn't change.
+	a.tokens.UpdateAgentToken("api")
+	if err := a.ReloadConfig(build("two")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if got := a.tokens.AgentToken(); got != "api" {
+		t.Fatalf("got agent token %q want %q", got, "api")
+	}
+}
+
+func TestAgent_ReloadConfig_EncryptKey(t *testing.T) {
+	t.Parallel()
+	key1 := "tbLJg26ZJyJ9pK3qhc9jig=="
+	key2 := "4leC33rgtXKIVUr9Nr0snQ=="
+	cfg := TestConfig()
+	cfg.EncryptKey = key1
+	a := NewTestAgent(t.Name(), cfg)
+	defer a.Shutdown()
+
+	// The new key is installed but the old one stays the primary key.
+	cfg2 := TestConfig()
+	cfg2.EncryptKey = key2
+	if err := a.ReloadConfig(cfg2); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var keys []string
+	for _, k := range a.Config.ConsulConfig.SerfLANConfig.MemberlistConfig.Keyring.GetKeys() {
+		keys = append(keys, base64.StdEncoding.EncodeToString(k))
+	}
+	verify.Values(t, "keys", keys, []string{key1, key2})
+}
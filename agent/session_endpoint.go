@@ -37,7 +37,7 @@ func (s *HTTPServer) SessionCreate(resp http.ResponseWriter, req *http.Request)
 	args := structs.SessionRequest{
 		Op: structs.SessionCreate,
 		Session: structs.Session{
-			Node:      s.agent.config.NodeName,
+			Node:      s.agent.RuntimeConfig().NodeName,
 			Checks:    []types.CheckID{structs.SerfCheckID},
 			LockDelay: 15 * time.Second,
 			Behavior:  structs.SessionKeysRelease,
@@ -211,7 +211,7 @@ func TestSessionCustomTTL(t *testing.T) {
 	ttl := 250 * time.Millisecond
 	cfg := TestConfig()
 	cfg.SessionTTLMin = ttl
-	cfg.SessionTTLMinRaw = ttl.String()
+	cfg.SessionTTLMinRaw = FlexibleDuration(ttl.String())
 	a := NewTestAgent(t.Name(), cfg)
 	defer a.Shutdown()
 
@@ -253,7 +253,7 @@ func TestSessionTTLRenew(t *testing.T) {
 	ttl := 250 * time.Millisecond
 	cfg := TestConfig()
 	cfg.SessionTTLMin = ttl
-	cfg.SessionTTLMinRaw = ttl.String()
+	cfg.SessionTTLMinRaw = FlexibleDuration(ttl.String())
 	a := NewTestAgent(t.Name(), cfg)
 	defer a.Shutdown()
 
@@ -29,10 +29,13 @@ type CheckDefinition struct {
 	Interval                       time.Duration
 	DockerContainerID              string
 	Shell                          string
-	TLSSkipVerify                  bool
+	TLSSkipVerify                  *bool
 	Timeout                        time.Duration
 	TTL                            time.Duration
 	DeregisterCriticalServiceAfter time.Duration
+	OutputMaxSize                  int
+	EnableAgentTLS                 *bool
+	TLSServerName                  string
 }
 
 func (c *CheckDefinition) HealthCheck(node string) *HealthCheck {
@@ -71,6 +74,9 @@ func (c *CheckDefinition) CheckType() *CheckType {
 		TLSSkipVerify:     c.TLSSkipVerify,
 		Timeout:           c.Timeout,
 		TTL:               c.TTL,
+		OutputMaxSize:     c.OutputMaxSize,
+		EnableAgentTLS:    c.EnableAgentTLS,
+		TLSServerName:     c.TLSServerName,
 		DeregisterCriticalServiceAfter: c.DeregisterCriticalServiceAfter,
 	}
 }
@@ -31,10 +31,26 @@ type CheckType struct {
 	Interval          time.Duration
 	DockerContainerID string
 	Shell             string
-	TLSSkipVerify     bool
 	Timeout           time.Duration
 	TTL               time.Duration
 
+	// TLSSkipVerify, if set, overrides tls_skip_verify of the HTTP check
+	// defaults of the agent.
+	TLSSkipVerify *bool
+
+	// EnableAgentTLS, if set, overrides enable_agent_tls_for_checks of the
+	// agent for an HTTP check.
+	EnableAgentTLS *bool
+
+	// TLSServerName, if set, replaces the server name of the agent to
+	// verify the certificate of the endpoint of an HTTP check using the
+	// TLS configuration of the agent.
+	TLSServerName string
+
+	// OutputMaxSize, if >0, overrides the maximum number of bytes of the
+	// check output which is stored.
+	OutputMaxSize int
+
 	// DeregisterCriticalServiceAfter, if >0, will cause the associated
 	// service, if any, to be deregistered if this check is critical for
 	// longer than this duration.
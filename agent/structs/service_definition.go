@@ -7,6 +7,7 @@ type ServiceDefinition struct {
 	Tags              []string
 	Address           string
 	Port              int
+	Meta              map[string]string
 	Check             CheckType
 	Checks            CheckTypes
 	Token             string
@@ -20,6 +21,7 @@ func (s *ServiceDefinition) NodeService() *NodeService {
 		Tags:              s.Tags,
 		Address:           s.Address,
 		Port:              s.Port,
+		Meta:              s.Meta,
 		EnableTagOverride: s.EnableTagOverride,
 	}
 	if ns.ID == "" && ns.Service != "" {
@@ -28,12 +30,16 @@ func (s *ServiceDefinition) NodeService() *NodeService {
 	return ns
 }
 
+// CheckTypes returns the valid checks of the service. It does not modify
+// the definition so that definitions can be registered repeatedly.
 func (s *ServiceDefinition) CheckTypes() (checks CheckTypes) {
-	s.Checks = append(s.Checks, &s.Check)
 	for _, check := range s.Checks {
 		if check.Valid() {
 			checks = append(checks, check)
 		}
 	}
+	if s.Check.Valid() {
+		checks = append(checks, &s.Check)
+	}
 	return
 }
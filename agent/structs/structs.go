@@ -59,19 +59,24 @@ const (
 	// NodeMaint is the special key set by a node in maintenance mode.
 	NodeMaint = "_node_maintenance"
 
+	// ConfigStale is the check ID set by a node whose configuration files
+	// changed since the configuration was last loaded.
+	ConfigStale = "_config_stale"
+
 	// ServiceMaintPrefix is the prefix for a service in maintenance mode.
 	ServiceMaintPrefix = "_service_maintenance:"
 
 	// The meta key prefix reserved for Consul's internal use
 	metaKeyReservedPrefix = "consul-"
 
-	// metaMaxKeyPairs is maximum number of metadata key pairs allowed to be registered
+	// metaMaxKeyPairs is the default maximum number of metadata key pairs
+	// allowed to be registered
 	metaMaxKeyPairs = 64
 
-	// metaKeyMaxLength is the maximum allowed length of a metadata key
+	// metaKeyMaxLength is the default maximum allowed length of a metadata key
 	metaKeyMaxLength = 128
 
-	// metaValueMaxLength is the maximum allowed length of a metadata value
+	// metaValueMaxLength is the default maximum allowed length of a metadata value
 	metaValueMaxLength = 512
 
 	// MaxLockDelay provides a maximum LockDelay value for
@@ -306,14 +311,58 @@ type Node struct {
 }
 type Nodes []*Node
 
+// MetaLimits bounds the node metadata. Zero fields use the defaults.
+type MetaLimits struct {
+	// MaxKeyPairs is the maximum number of key/value pairs.
+	MaxKeyPairs int
+
+	// KeyMaxLength is the maximum length of a key.
+	KeyMaxLength int
+
+	// ValueMaxLength is the maximum length of a value.
+	ValueMaxLength int
+}
+
+// DefaultMetaLimits returns the default node metadata limits.
+func DefaultMetaLimits() MetaLimits {
+	return MetaLimits{
+		MaxKeyPairs:    metaMaxKeyPairs,
+		KeyMaxLength:   metaKeyMaxLength,
+		ValueMaxLength: metaValueMaxLength,
+	}
+}
+
+// withDefaults returns l with the zero fields set to the defaults.
+func (l MetaLimits) withDefaults() MetaLimits {
+	d := DefaultMetaLimits()
+	if l.MaxKeyPairs == 0 {
+		l.MaxKeyPairs = d.MaxKeyPairs
+	}
+	if l.KeyMaxLength == 0 {
+		l.KeyMaxLength = d.KeyMaxLength
+	}
+	if l.ValueMaxLength == 0 {
+		l.ValueMaxLength = d.ValueMaxLength
+	}
+	return l
+}
+
 // ValidateMeta validates a set of key/value pairs from the agent config
+// against the default limits.
 func ValidateMetadata(meta map[string]string) error {
-	if len(meta) > metaMaxKeyPairs {
-		return fmt.Errorf("Node metadata cannot contain more than %d key/value pairs", metaMaxKeyPairs)
+	return ValidateMetadataLimits(meta, DefaultMetaLimits())
+}
+
+// ValidateMetadataLimits validates a set of key/value pairs against the
+// given limits.
+func ValidateMetadataLimits(meta map[string]string, limits MetaLimits) error {
+	limits = limits.withDefaults()
+	if len(meta) > limits.MaxKeyPairs {
+		return fmt.Errorf("Node metadata cannot contain more than %d key/value pairs", limits.MaxKeyPairs)
 	}
 
 	for key, value := range meta {
-		if err := validateMetaPair(key, value); err != nil {
+		if err := validateMetaPair(key, value, limits); err != nil {
 			return fmt.Errorf("Couldn't load metadata pair ('%s', '%s'): %s", key, value, err)
 		}
 	}
@@ -322,21 +371,21 @@ func ValidateMetadata(meta map[string]string) error {
 }
 
 // validateMetaPair checks that the given key/value pair is in a valid format
-func validateMetaPair(key, value string) error {
+func validateMetaPair(key, value string, limits MetaLimits) error {
 	if key == "" {
 		return fmt.Errorf("Key cannot be blank")
 	}
 	if !metaKeyFormat(key) {
 		return fmt.Errorf("Key contains invalid characters")
 	}
-	if len(key) > metaKeyMaxLength {
-		return fmt.Errorf("Key is too long (limit: %d characters)", metaKeyMaxLength)
+	if len(key) > limits.KeyMaxLength {
+		return fmt.Errorf("Key is too long (limit: %d characters)", limits.KeyMaxLength)
 	}
 	if strings.HasPrefix(key, metaKeyReservedPrefix) {
 		return fmt.Errorf("Key prefix '%s' is reserved for internal use", metaKeyReservedPrefix)
 	}
-	if len(value) > metaValueMaxLength {
-		return fmt.Errorf("Value is too long (limit: %d characters)", metaValueMaxLength)
+	if len(value) > limits.ValueMaxLength {
+		return fmt.Errorf("Value is too long (limit: %d characters)", limits.ValueMaxLength)
 	}
 	return nil
 }
@@ -372,6 +421,7 @@ type ServiceNode struct {
 	ServiceTags              []string
 	ServiceAddress           string
 	ServicePort              int
+	ServiceMeta              map[string]string
 	ServiceEnableTagOverride bool
 
 	RaftIndex
@@ -382,6 +432,13 @@ type ServiceNode struct {
 func (s *ServiceNode) PartialClone() *ServiceNode {
 	tags := make([]string, len(s.ServiceTags))
 	copy(tags, s.ServiceTags)
+	var meta map[string]string
+	if s.ServiceMeta != nil {
+		meta = make(map[string]string, len(s.ServiceMeta))
+		for k, v := range s.ServiceMeta {
+			meta[k] = v
+		}
+	}
 
 	return &ServiceNode{
 		// Skip ID, see above.
@@ -393,6 +450,7 @@ func (s *ServiceNode) PartialClone() *ServiceNode {
 		ServiceTags:              tags,
 		ServiceAddress:           s.ServiceAddress,
 		ServicePort:              s.ServicePort,
+		ServiceMeta:              meta,
 		ServiceEnableTagOverride: s.ServiceEnableTagOverride,
 		RaftIndex: RaftIndex{
 			CreateIndex: s.CreateIndex,
@@ -409,6 +467,7 @@ func (s *ServiceNode) ToNodeService() *NodeService {
 		Tags:              s.ServiceTags,
 		Address:           s.ServiceAddress,
 		Port:              s.ServicePort,
+		Meta:              s.ServiceMeta,
 		EnableTagOverride: s.ServiceEnableTagOverride,
 		RaftIndex: RaftIndex{
 			CreateIndex: s.CreateIndex,
@@ -426,6 +485,7 @@ type NodeService struct {
 	Tags              []string
 	Address           string
 	Port              int
+	Meta              map[string]string
 	EnableTagOverride bool
 
 	RaftIndex
@@ -441,6 +501,7 @@ func (s *NodeService) IsSame(other *NodeService) bool {
 		!reflect.DeepEqual(s.Tags, other.Tags) ||
 		s.Address != other.Address ||
 		s.Port != other.Port ||
+		!reflect.DeepEqual(s.Meta, other.Meta) ||
 		s.EnableTagOverride != other.EnableTagOverride {
 		return false
 	}
@@ -460,6 +521,7 @@ func (s *NodeService) ToServiceNode(node string) *ServiceNode {
 		ServiceTags:              s.Tags,
 		ServiceAddress:           s.Address,
 		ServicePort:              s.Port,
+		ServiceMeta:              s.Meta,
 		ServiceEnableTagOverride: s.EnableTagOverride,
 		RaftIndex: RaftIndex{
 			CreateIndex: s.CreateIndex,
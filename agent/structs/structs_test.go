@@ -138,6 +138,7 @@ func testServiceNode() *ServiceNode {
 		ServiceTags:              []string{"prod", "v1"},
 		ServiceAddress:           "127.0.0.2",
 		ServicePort:              8080,
+		ServiceMeta:              map[string]string{"version": "1"},
 		ServiceEnableTagOverride: true,
 		RaftIndex: RaftIndex{
 			CreateIndex: 1,
@@ -175,6 +176,12 @@ func TestStructs_ServiceNode_PartialClone(t *testing.T) {
 	if reflect.DeepEqual(sn, clone) {
 		t.Fatalf("clone wasn't independent of the original")
 	}
+
+	sn.ServiceTags = clone.ServiceTags
+	sn.ServiceMeta["version"] = "2"
+	if reflect.DeepEqual(sn, clone) {
+		t.Fatalf("clone wasn't independent of the original")
+	}
 }
 
 func TestStructs_ServiceNode_Conversions(t *testing.T) {
@@ -201,6 +208,7 @@ func TestStructs_NodeService_IsSame(t *testing.T) {
 		Tags:              []string{"foo", "bar"},
 		Address:           "127.0.0.1",
 		Port:              1234,
+		Meta:              map[string]string{"version": "1"},
 		EnableTagOverride: true,
 	}
 	if !ns.IsSame(ns) {
@@ -213,6 +221,7 @@ func TestStructs_NodeService_IsSame(t *testing.T) {
 		Tags:              []string{"foo", "bar"},
 		Address:           "127.0.0.1",
 		Port:              1234,
+		Meta:              map[string]string{"version": "1"},
 		EnableTagOverride: true,
 		RaftIndex: RaftIndex{
 			CreateIndex: 1,
@@ -245,6 +254,7 @@ func TestStructs_NodeService_IsSame(t *testing.T) {
 	check(func() { other.Tags = []string{"foo"} }, func() { other.Tags = []string{"foo", "bar"} })
 	check(func() { other.Address = "XXX" }, func() { other.Address = "127.0.0.1" })
 	check(func() { other.Port = 9999 }, func() { other.Port = 1234 })
+	check(func() { other.Meta = nil }, func() { other.Meta = map[string]string{"version": "1"} })
 	check(func() { other.EnableTagOverride = false }, func() { other.EnableTagOverride = true })
 }
 
@@ -504,6 +514,34 @@ func TestStructs_ValidateMetadata(t *testing.T) {
 	}
 }
 
+func TestStructs_ValidateMetadataLimits(t *testing.T) {
+	limits := MetaLimits{MaxKeyPairs: 100, KeyMaxLength: 8, ValueMaxLength: 4}
+
+	// More pairs than the default are fine
+	meta := make(map[string]string)
+	for i := 0; i < metaMaxKeyPairs+1; i++ {
+		meta[fmt.Sprintf("key%d", i)] = "v"
+	}
+	if err := ValidateMetadataLimits(meta, limits); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	meta = map[string]string{"key": "value"}
+	if err := ValidateMetadataLimits(meta, limits); err == nil || !strings.Contains(err.Error(), "limit: 4 characters") {
+		t.Fatalf("got %v", err)
+	}
+	meta = map[string]string{"longerkey": "v"}
+	if err := ValidateMetadataLimits(meta, limits); err == nil || !strings.Contains(err.Error(), "limit: 8 characters") {
+		t.Fatalf("got %v", err)
+	}
+
+	// Zero limits use the defaults
+	meta = map[string]string{"key": strings.Repeat("v", metaValueMaxLength)}
+	if err := ValidateMetadataLimits(meta, MetaLimits{}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
 func TestStructs_validateMetaPair(t *testing.T) {
 	longKey := strings.Repeat("a", metaKeyMaxLength+1)
 	longValue := strings.Repeat("b", metaValueMaxLength+1)
@@ -529,7 +567,7 @@ func TestStructs_validateMetaPair(t *testing.T) {
 	}
 
 	for _, pair := range pairs {
-		err := validateMetaPair(pair.Key, pair.Value)
+		err := validateMetaPair(pair.Key, pair.Value, DefaultMetaLimits())
 		if pair.Error == "" && err != nil {
 			t.Fatalf("should have succeeded: %v, %v", pair, err)
 		} else if pair.Error != "" && !strings.Contains(err.Error(), pair.Error) {
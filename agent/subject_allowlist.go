@@ -0,0 +1,55 @@
+package agent
+
+import (
+	"crypto/x509"
+	"fmt"
+	"path"
+)
+
+// SubjectAllowlist restricts access to the HTTP API to client certificates
+// with a subject alternative name matching one of a list of glob patterns.
+type SubjectAllowlist struct {
+	patterns []string
+}
+
+// NewSubjectAllowlist returns an allowlist for the given patterns. The
+// patterns use the syntax of path.Match, e.g. "*.ops.example.com".
+func NewSubjectAllowlist(patterns []string) (*SubjectAllowlist, error) {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid client subject pattern %q: %v", p, err)
+		}
+	}
+	return &SubjectAllowlist{patterns}, nil
+}
+
+// Enabled returns true if any patterns are configured.
+func (s *SubjectAllowlist) Enabled() bool {
+	return len(s.patterns) > 0
+}
+
+// Allow returns true if one of the subject alternative names of the given
+// certificate matches one of the patterns. DNS names, email addresses, IP
+// addresses and URIs are considered.
+func (s *SubjectAllowlist) Allow(cert *x509.Certificate) bool {
+	if cert == nil {
+		return false
+	}
+	var names []string
+	names = append(names, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	for _, u := range cert.URIs {
+		names = append(names, u.String())
+	}
+	for _, p := range s.patterns {
+		for _, name := range names {
+			if ok, _ := path.Match(p, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
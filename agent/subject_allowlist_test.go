@@ -0,0 +1,116 @@
+package agent
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/consul/testutil"
+)
+
+func TestSubjectAllowlist(t *testing.T) {
+	t.Parallel()
+
+	spiffe, _ := url.Parse("spiffe://dc1/ops")
+	cert := &x509.Certificate{
+		DNSNames:       []string{"deploy.ops.example.com"},
+		EmailAddresses: []string{"ci@example.com"},
+		IPAddresses:    []net.IP{net.ParseIP("10.0.0.1")},
+		URIs:           []*url.URL{spiffe},
+	}
+
+	tests := []struct {
+		desc     string
+		patterns []string
+		cert     *x509.Certificate
+		allow    bool
+	}{
+		{"no cert", []string{"*"}, nil, false},
+		{"dns glob", []string{"*.ops.example.com"}, cert, true},
+		{"email", []string{"ci@example.com"}, cert, true},
+		{"ip", []string{"10.0.0.*"}, cert, true},
+		{"uri", []string{"spiffe://dc1/*"}, cert, true},
+		{"no match", []string{"*.dev.example.com", "admin@example.com"}, cert, false},
+		{"empty cert", []string{"*"}, &x509.Certificate{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			s, err := NewSubjectAllowlist(tt.patterns)
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			if got, want := s.Allow(tt.cert), tt.allow; got != want {
+				t.Fatalf("got %v want %v", got, want)
+			}
+		})
+	}
+
+	if _, err := NewSubjectAllowlist([]string{"[a-"}); err == nil {
+		t.Fatal("expected error for bad pattern")
+	}
+}
+
+func TestNewHTTPServer_InvalidClientSubjects(t *testing.T) {
+	t.Parallel()
+	// Configurations created in code skip the validation of the builder,
+	// so the HTTP server must not come up without its allowlist.
+	cfg := TestConfig()
+	cfg.DataDir = testutil.TempDir(t, "agent")
+	defer os.RemoveAll(cfg.DataDir)
+	cfg.HTTPConfig.AllowedClientSubjects = []string{"[a-"}
+	a, err := New(cfg)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := NewHTTPServer("127.0.0.1:0", a); err == nil || !strings.Contains(err.Error(), "invalid client subject pattern") {
+		t.Fatalf("got error %v", err)
+	}
+}
+
+func TestHTTPAPI_AllowedClientSubjects(t *testing.T) {
+	t.Parallel()
+	cfg := TestConfig()
+	cfg.HTTPConfig.AllowedClientSubjects = []string{"*.ops.example.com"}
+	a := NewTestAgent(t.Name(), cfg)
+	defer a.Shutdown()
+
+	srv := &HTTPServer{agent: a.Agent, blacklist: NewBlacklist(nil), proto: "https"}
+	srv.clientSubjects, _ = NewSubjectAllowlist(cfg.HTTPConfig.AllowedClientSubjects)
+	handler := func(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+		return nil, nil
+	}
+	allowed := &x509.Certificate{DNSNames: []string{"deploy.ops.example.com"}}
+	denied := &x509.Certificate{DNSNames: []string{"web.example.com"}}
+
+	tests := []struct {
+		desc   string
+		method string
+		cert   *x509.Certificate
+		code   int
+	}{
+		{"read without cert", "GET", nil, http.StatusOK},
+		{"write without cert", "PUT", nil, http.StatusForbidden},
+		{"write with allowed cert", "PUT", allowed, http.StatusOK},
+		{"write with other cert", "DELETE", denied, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, "/v1/agent/service/register", nil)
+			req.TLS = &tls.ConnectionState{}
+			if tt.cert != nil {
+				req.TLS.PeerCertificates = []*x509.Certificate{tt.cert}
+			}
+			resp := httptest.NewRecorder()
+			srv.wrap(handler)(resp, req)
+			if got, want := resp.Code, tt.code; got != want {
+				t.Fatalf("got %d want %d", got, want)
+			}
+		})
+	}
+}
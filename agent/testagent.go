@@ -102,9 +102,6 @@ func (a *TestAgent) Start() *TestAgent {
 	if a.Config == nil {
 		a.Config = TestConfig()
 	}
-	if a.Config.DNSRecursor != "" {
-		a.Config.DNSRecursors = append(a.Config.DNSRecursors, a.Config.DNSRecursor)
-	}
 	if a.Config.DataDir == "" {
 		name := "agent"
 		if a.Name != "" {
@@ -10,7 +10,8 @@ import (
 // depending on how the agent and the other node are configured. The dc
 // parameter is the dc the datacenter this node is from.
 func (a *Agent) TranslateAddress(dc string, addr string, taggedAddresses map[string]string) string {
-	if a.config.TranslateWanAddrs && (a.config.Datacenter != dc) {
+	cfg := a.RuntimeConfig()
+	if cfg.TranslateWanAddrs && (cfg.Datacenter != dc) {
 		wanAddr := taggedAddresses["wan"]
 		if wanAddr != "" {
 			addr = wanAddr
@@ -23,6 +24,8 @@ func (a *Agent) TranslateAddress(dc string, addr string, taggedAddresses map[str
 // final, translated address, depending on how the agent and the other node are
 // configured. The dc parameter is the datacenter this structure is from.
 func (a *Agent) TranslateAddresses(dc string, subj interface{}) {
+	cfg := a.RuntimeConfig()
+
 	// CAUTION - SUBTLE! An agent running on a server can, in some cases,
 	// return pointers directly into the immutable state store for
 	// performance (it's via the in-memory RPC mechanism). It's never safe
@@ -34,7 +37,7 @@ func (a *Agent) TranslateAddresses(dc string, subj interface{}) {
 	// done. This also happens to skip looking at any of the incoming
 	// structure for the common case of not needing to translate, so it will
 	// skip a lot of work if no translation needs to be done.
-	if !a.config.TranslateWanAddrs || (a.config.Datacenter == dc) {
+	if !cfg.TranslateWanAddrs || (cfg.Datacenter == dc) {
 		return
 	}
 
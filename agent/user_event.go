@@ -148,7 +148,7 @@ func (a *Agent) shouldProcessUserEvent(msg *UserEvent) bool {
 				msg.NodeFilter, msg.Name, err)
 			return false
 		}
-		if !re.MatchString(a.config.NodeName) {
+		if !re.MatchString(a.RuntimeConfig().NodeName) {
 			return false
 		}
 	}
@@ -209,7 +209,7 @@ func (a *Agent) ingestUserEvent(msg *UserEvent) {
 	// Special handling for internal events
 	switch msg.Name {
 	case remoteExecName:
-		if *a.config.DisableRemoteExec {
+		if *a.RuntimeConfig().DisableRemoteExec {
 			a.logger.Printf("[INFO] agent: ignoring remote exec event (%s), disabled.", msg.ID)
 		} else {
 			go a.handleRemoteExec(msg)
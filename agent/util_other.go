@@ -5,8 +5,13 @@ package agent
 import (
 	"os"
 	"os/exec"
+	"syscall"
 )
 
+// permissionAuditSupported is true if file modes and owners can be audited
+// on this platform.
+const permissionAuditSupported = true
+
 // ExecScript returns a command to execute a script
 func ExecScript(script string) (*exec.Cmd, error) {
 	shell := "/bin/sh"
@@ -15,3 +20,20 @@ func ExecScript(script string) (*exec.Cmd, error) {
 	}
 	return exec.Command(shell, "-c", script), nil
 }
+
+// fileOwner returns the uid of the owner of the given file.
+func fileOwner(fi os.FileInfo) (int, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return int(st.Uid), true
+}
+
+// processAlive returns true if a process with the given PID is running.
+// A process owned by another user is running as well even though it cannot
+// be signaled.
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
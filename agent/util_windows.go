@@ -9,6 +9,10 @@ import (
 	"syscall"
 )
 
+// permissionAuditSupported is true if file modes and owners can be audited
+// on this platform. Windows uses ACLs which are not reflected in file modes.
+const permissionAuditSupported = false
+
 // ExecScript returns a command to execute a script
 func ExecScript(script string) (*exec.Cmd, error) {
 	shell := "cmd"
@@ -22,3 +26,20 @@ func ExecScript(script string) (*exec.Cmd, error) {
 	}
 	return cmd, nil
 }
+
+// fileOwner returns the uid of the owner of the given file, which is not
+// available on Windows.
+func fileOwner(fi os.FileInfo) (int, bool) {
+	return 0, false
+}
+
+// processAlive returns true if a process with the given PID is running.
+// FindProcess opens the process on Windows and fails if it does not exist.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
@@ -2,15 +2,21 @@ package agent
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"net/http"
+	"net/url"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/armon/circbuf"
 	"github.com/hashicorp/consul/watch"
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/mitchellh/mapstructure"
 )
 
 const (
@@ -18,8 +24,104 @@ const (
 	// last WatchBufSize. Prevents an enormous buffer
 	// from being captured
 	WatchBufSize = 4 * 1024 // 4KB
+
+	// defaultWatchHTTPTimeout is the timeout of the requests of HTTP watch
+	// handlers without one.
+	defaultWatchHTTPTimeout = 10 * time.Second
 )
 
+// watchExempt are the parameters of a watch which configure its handler
+// instead of the watched data.
+var watchExempt = []string{"handler", "handler_type", "http_handler_config"}
+
+// WatchHTTPHandlerConfig configures a watch handler which sends the watched
+// data to an HTTP endpoint instead of running a script.
+type WatchHTTPHandlerConfig struct {
+	Path          string              `mapstructure:"path"`
+	Method        string              `mapstructure:"method"`
+	Header        map[string][]string `mapstructure:"header"`
+	Timeout       time.Duration       `mapstructure:"-"`
+	TimeoutRaw    string              `mapstructure:"timeout"`
+	TLSSkipVerify bool                `mapstructure:"tls_skip_verify"`
+}
+
+// parseWatchHandler checks the handler parameters of a watch plan parsed
+// with watchExempt. Script handlers need a "handler" script. HTTP handlers
+// need an "http_handler_config", which is replaced with its decoded
+// *WatchHTTPHandlerConfig.
+func parseWatchHandler(wp *watch.Plan) error {
+	handlerType, ok := wp.Exempt["handler_type"].(string)
+	if _, set := wp.Exempt["handler_type"]; set && !ok {
+		return fmt.Errorf("Watch handler_type must be a string")
+	}
+
+	switch handlerType {
+	case "", "script":
+		if _, ok := wp.Exempt["http_handler_config"]; ok {
+			return fmt.Errorf("Watch http_handler_config requires handler_type http")
+		}
+		h := wp.Exempt["handler"]
+		if _, ok := h.(string); h == nil || !ok {
+			return fmt.Errorf("Watch handler must be a string")
+		}
+
+	case "http":
+		if _, ok := wp.Exempt["handler"]; ok {
+			return fmt.Errorf("Watch handler cannot be set with handler_type http")
+		}
+		raw, ok := wp.Exempt["http_handler_config"]
+		if !ok {
+			return fmt.Errorf("Watch handler_type http requires http_handler_config")
+		}
+		var config WatchHTTPHandlerConfig
+		var md mapstructure.Metadata
+		dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+			Metadata: &md,
+			Result:   &config,
+		})
+		if err != nil {
+			return err
+		}
+		if err := dec.Decode(raw); err != nil {
+			return fmt.Errorf("Watch http_handler_config invalid: %v", err)
+		}
+		if len(md.Unused) > 0 {
+			return fmt.Errorf("Watch http_handler_config has invalid keys: %v", md.Unused)
+		}
+		u, err := url.Parse(config.Path)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("Watch http_handler_config path %q must be an http or https URL", config.Path)
+		}
+		if config.Method == "" {
+			config.Method = "POST"
+		}
+		config.Timeout = defaultWatchHTTPTimeout
+		if config.TimeoutRaw != "" {
+			config.Timeout, err = time.ParseDuration(config.TimeoutRaw)
+			if err != nil {
+				return fmt.Errorf("Watch http_handler_config timeout invalid: %v", err)
+			}
+			if config.Timeout <= 0 {
+				return fmt.Errorf("Watch http_handler_config timeout must be positive")
+			}
+		}
+		wp.Exempt["http_handler_config"] = &config
+
+	default:
+		return fmt.Errorf("Watch handler_type %q must be script or http", handlerType)
+	}
+	return nil
+}
+
+// makeWatchPlanHandler returns the handler of a watch plan checked with
+// parseWatchHandler.
+func makeWatchPlanHandler(logOutput io.Writer, wp *watch.Plan) watch.HandlerFunc {
+	if config, ok := wp.Exempt["http_handler_config"].(*WatchHTTPHandlerConfig); ok {
+		return makeHTTPWatchHandler(logOutput, config)
+	}
+	return makeWatchHandler(logOutput, wp.Exempt["handler"])
+}
+
 // makeWatchHandler returns a handler for the given watch
 func makeWatchHandler(logOutput io.Writer, params interface{}) watch.HandlerFunc {
 	script := params.(string)
@@ -66,3 +168,67 @@ func makeWatchHandler(logOutput io.Writer, params interface{}) watch.HandlerFunc
 	}
 	return fn
 }
+
+// makeHTTPWatchHandler returns a handler which sends the watched data as
+// JSON to the endpoint of config, along with the index in the
+// X-Consul-Index header.
+func makeHTTPWatchHandler(logOutput io.Writer, config *WatchHTTPHandlerConfig) watch.HandlerFunc {
+	logger := log.New(logOutput, "", log.LstdFlags)
+
+	trans := cleanhttp.DefaultTransport()
+	if trans.TLSClientConfig == nil {
+		trans.TLSClientConfig = &tls.Config{}
+	}
+	trans.TLSClientConfig.InsecureSkipVerify = config.TLSSkipVerify
+	client := &http.Client{
+		Timeout:   config.Timeout,
+		Transport: trans,
+	}
+
+	fn := func(idx uint64, data interface{}) {
+		var inp bytes.Buffer
+		if err := json.NewEncoder(&inp).Encode(data); err != nil {
+			logger.Printf("[ERR] agent: Failed to encode data for watch '%s': %v", config.Path, err)
+			return
+		}
+
+		req, err := http.NewRequest(config.Method, config.Path, &inp)
+		if err != nil {
+			logger.Printf("[ERR] agent: Failed to setup watch: %v", err)
+			return
+		}
+		for key, values := range config.Header {
+			for _, v := range values {
+				req.Header.Add(key, v)
+			}
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Consul-Index", strconv.FormatUint(idx, 10))
+
+		resp, err := client.Do(req)
+		if err != nil {
+			logger.Printf("[ERR] agent: Failed to invoke watch handler '%s': %v", config.Path, err)
+			return
+		}
+		defer resp.Body.Close()
+
+		// Collect the output, like the output of script handlers
+		output, _ := circbuf.NewBuffer(WatchBufSize)
+		if _, err := io.Copy(output, resp.Body); err != nil {
+			logger.Printf("[ERR] agent: Failed to read the response of watch handler '%s': %v", config.Path, err)
+			return
+		}
+		outputStr := string(output.Bytes())
+		if output.TotalWritten() > output.Size() {
+			outputStr = fmt.Sprintf("Captured %d of %d bytes\n...\n%s",
+				output.Size(), output.TotalWritten(), outputStr)
+		}
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			logger.Printf("[ERR] agent: watch handler '%s' failed with status %s: %s", config.Path, resp.Status, outputStr)
+			return
+		}
+		logger.Printf("[DEBUG] agent: watch handler '%s' output: %s", config.Path, outputStr)
+	}
+	return fn
+}
@@ -2,8 +2,15 @@ package agent
 
 import (
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/watch"
+	"github.com/pascaldekloe/goe/verify"
 )
 
 func TestMakeWatchHandler(t *testing.T) {
@@ -28,3 +35,146 @@ func TestMakeWatchHandler(t *testing.T) {
 		t.Fatalf("bad: %s", raw)
 	}
 }
+
+func TestParseWatchHandler(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		desc   string
+		params map[string]interface{}
+		config *WatchHTTPHandlerConfig
+		err    string
+	}{
+		{
+			desc:   "script",
+			params: map[string]interface{}{"handler": "true"},
+		},
+		{
+			desc:   "script without handler",
+			params: map[string]interface{}{"handler_type": "script"},
+			err:    "Watch handler must be a string",
+		},
+		{
+			desc: "http",
+			params: map[string]interface{}{
+				"handler_type": "http",
+				"http_handler_config": map[string]interface{}{
+					"path":            "https://example.com/watch",
+					"header":          map[string]interface{}{"x-token": []interface{}{"abc"}},
+					"timeout":         "5s",
+					"tls_skip_verify": true,
+				},
+			},
+			config: &WatchHTTPHandlerConfig{
+				Path:          "https://example.com/watch",
+				Method:        "POST",
+				Header:        map[string][]string{"x-token": []string{"abc"}},
+				Timeout:       5 * time.Second,
+				TimeoutRaw:    "5s",
+				TLSSkipVerify: true,
+			},
+		},
+		{
+			desc: "http defaults",
+			params: map[string]interface{}{
+				"handler_type":        "http",
+				"http_handler_config": map[string]interface{}{"path": "http://localhost:8080", "method": "PUT"},
+			},
+			config: &WatchHTTPHandlerConfig{
+				Path:    "http://localhost:8080",
+				Method:  "PUT",
+				Timeout: defaultWatchHTTPTimeout,
+			},
+		},
+		{
+			desc:   "http without config",
+			params: map[string]interface{}{"handler_type": "http"},
+			err:    "Watch handler_type http requires http_handler_config",
+		},
+		{
+			desc: "http with script",
+			params: map[string]interface{}{
+				"handler_type":        "http",
+				"handler":             "true",
+				"http_handler_config": map[string]interface{}{"path": "http://localhost"},
+			},
+			err: "Watch handler cannot be set with handler_type http",
+		},
+		{
+			desc: "http bad path",
+			params: map[string]interface{}{
+				"handler_type":        "http",
+				"http_handler_config": map[string]interface{}{"path": "localhost:8080"},
+			},
+			err: `Watch http_handler_config path "localhost:8080" must be an http or https URL`,
+		},
+		{
+			desc: "http bad key",
+			params: map[string]interface{}{
+				"handler_type":        "http",
+				"http_handler_config": map[string]interface{}{"path": "http://localhost", "methd": "PUT"},
+			},
+			err: "Watch http_handler_config has invalid keys: [methd]",
+		},
+		{
+			desc: "http bad timeout",
+			params: map[string]interface{}{
+				"handler_type":        "http",
+				"http_handler_config": map[string]interface{}{"path": "http://localhost", "timeout": "-1s"},
+			},
+			err: "Watch http_handler_config timeout must be positive",
+		},
+		{
+			desc:   "unknown type",
+			params: map[string]interface{}{"handler_type": "grpc"},
+			err:    `Watch handler_type "grpc" must be script or http`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			tt.params["type"] = "key"
+			tt.params["key"] = "foo"
+			wp, err := watch.ParseExempt(tt.params, watchExempt)
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			err = parseWatchHandler(wp)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("got error %v want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			if tt.config != nil {
+				verify.Values(t, "config", wp.Exempt["http_handler_config"], tt.config)
+			}
+		})
+	}
+}
+
+func TestMakeHTTPWatchHandler(t *testing.T) {
+	t.Parallel()
+	var gotBody, gotIndex, gotToken, gotMethod string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		gotBody = string(b)
+		gotIndex = r.Header.Get("X-Consul-Index")
+		gotToken = r.Header.Get("X-Token")
+		gotMethod = r.Method
+	}))
+	defer server.Close()
+
+	handler := makeHTTPWatchHandler(os.Stderr, &WatchHTTPHandlerConfig{
+		Path:    server.URL,
+		Method:  "PUT",
+		Header:  map[string][]string{"X-Token": []string{"abc"}},
+		Timeout: time.Second,
+	})
+	handler(100, []string{"foo", "bar", "baz"})
+	verify.Values(t, "body", strings.TrimSpace(gotBody), `["foo","bar","baz"]`)
+	verify.Values(t, "index", gotIndex, "100")
+	verify.Values(t, "token", gotToken, "abc")
+	verify.Values(t, "method", gotMethod, "PUT")
+}
@@ -24,6 +24,7 @@ type AgentService struct {
 	Tags              []string
 	Port              int
 	Address           string
+	Meta              map[string]string
 	EnableTagOverride bool
 	CreateIndex       uint64
 	ModifyIndex       uint64
@@ -46,12 +47,13 @@ type AgentMember struct {
 
 // AgentServiceRegistration is used to register a new service
 type AgentServiceRegistration struct {
-	ID                string   `json:",omitempty"`
-	Name              string   `json:",omitempty"`
-	Tags              []string `json:",omitempty"`
-	Port              int      `json:",omitempty"`
-	Address           string   `json:",omitempty"`
-	EnableTagOverride bool     `json:",omitempty"`
+	ID                string            `json:",omitempty"`
+	Name              string            `json:",omitempty"`
+	Tags              []string          `json:",omitempty"`
+	Port              int               `json:",omitempty"`
+	Address           string            `json:",omitempty"`
+	Meta              map[string]string `json:",omitempty"`
+	EnableTagOverride bool              `json:",omitempty"`
 	Check             *AgentServiceCheck
 	Checks            AgentServiceChecks
 }
@@ -80,6 +82,11 @@ type AgentServiceCheck struct {
 	Status            string              `json:",omitempty"`
 	Notes             string              `json:",omitempty"`
 	TLSSkipVerify     bool                `json:",omitempty"`
+	TLSServerName     string              `json:",omitempty"`
+
+	// EnableAgentTLS, if set, overrides whether an HTTP check uses the
+	// TLS client configuration of the agent.
+	EnableAgentTLS *bool `json:",omitempty"`
 
 	// In Consul 0.7 and later, checks that are associated with a service
 	// may also contain this optional DeregisterCriticalServiceAfter field,
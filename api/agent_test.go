@@ -119,6 +119,7 @@ func TestAPI_AgentServices(t *testing.T) {
 		Name: "foo",
 		Tags: []string{"bar", "baz"},
 		Port: 8000,
+		Meta: map[string]string{"version": "1"},
 		Check: &AgentServiceCheck{
 			TTL: "15s",
 		},
@@ -134,6 +135,9 @@ func TestAPI_AgentServices(t *testing.T) {
 	if _, ok := services["foo"]; !ok {
 		t.Fatalf("missing service: %v", services)
 	}
+	if v := services["foo"].Meta["version"]; v != "1" {
+		t.Fatalf("bad meta: %v", services["foo"].Meta)
+	}
 	checks, err := agent.Checks()
 	if err != nil {
 		t.Fatalf("err: %v", err)
@@ -23,6 +23,7 @@ type CatalogService struct {
 	ServiceAddress           string
 	ServiceTags              []string
 	ServicePort              int
+	ServiceMeta              map[string]string
 	ServiceEnableTagOverride bool
 	CreateIndex              uint64
 	ModifyIndex              uint64
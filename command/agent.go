@@ -2,15 +2,15 @@ package command
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/signal"
 	"path/filepath"
-	"reflect"
-	"regexp"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -18,22 +18,15 @@ import (
 	"github.com/armon/go-metrics/circonus"
 	"github.com/armon/go-metrics/datadog"
 	"github.com/hashicorp/consul/agent"
-	"github.com/hashicorp/consul/agent/structs"
 	"github.com/hashicorp/consul/configutil"
-	"github.com/hashicorp/consul/ipaddr"
 	"github.com/hashicorp/consul/lib"
 	"github.com/hashicorp/consul/logger"
-	"github.com/hashicorp/consul/watch"
 	"github.com/hashicorp/go-checkpoint"
-	discover "github.com/hashicorp/go-discover"
 	multierror "github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/logutils"
 	"github.com/mitchellh/cli"
 )
 
-// validDatacenter is used to validate a datacenter
-var validDatacenter = regexp.MustCompile("^[a-zA-Z0-9_-]+$")
-
 // AgentCommand is a Command implementation that runs a Consul agent.
 // The command will not end unless a shutdown message is sent on the
 // ShutdownCh. If two messages are sent on the ShutdownCh it will forcibly
@@ -49,6 +42,49 @@ type AgentCommand struct {
 	logFilter         *logutils.LevelFilter
 	logOutput         io.Writer
 	logger            *log.Logger
+
+	// configCache holds the decoded configuration files so that a reload
+	// only decodes the files which changed.
+	configCache *agent.ConfigCache
+
+	// configPaths are the configuration files and directories read by
+	// the last call to readConfig.
+	configPaths []string
+
+	// configLimits are the limits of the configuration read by the last
+	// call to readConfig.
+	configLimits agent.ConfigLimits
+
+	// configMissing are the optional configuration files which did not
+	// exist when readConfig was last called.
+	configMissing []string
+
+	// kubernetes is set if the agent runs in Kubernetes mode.
+	kubernetes bool
+
+	// remoteConfig fetches the configuration files given as URLs. It
+	// keeps the fetched files until the agent exits.
+	remoteConfig *agent.RemoteConfig
+
+	// configLoadedAt holds the time.Time the configuration was last
+	// loaded successfully.
+	configLoadedAt atomic.Value
+
+	// configSources holds the configSources of the configuration which
+	// was last loaded successfully.
+	configSources atomic.Value
+
+	// configOverlay holds the agent.ConfigOverlayDocs of the configuration
+	// overlay which was last fetched from the servers.
+	configOverlay atomic.Value
+
+	// service is the Windows service the agent runs as. It is nil if the
+	// agent was not started by the service control manager.
+	service *windowsService
+
+	// printConfig is the format of -print-config, or empty if the agent
+	// is started.
+	printConfig *printConfigFormat
 }
 
 // readConfig is responsible for setup of our configuration using
@@ -61,15 +97,45 @@ func (cmd *AgentCommand) readConfig() *agent.Config {
 	var dnsRecursors []string
 	var dev bool
 	var nodeMeta []string
+	var hclSnippets []string
+	var varFlags configVarFlags
+	limits := agent.DefaultConfigLimits()
 
 	f := cmd.BaseCommand.NewFlagSet(cmd)
 
 	f.Var((*configutil.AppendSliceValue)(&cfgFiles), "config-file",
 		"Path to a JSON file to read configuration from. This can be specified multiple times.")
 	f.Var((*configutil.AppendSliceValue)(&cfgFiles), "config-dir",
-		"Path to a directory to read configuration files from. This will read every file ending "+
-			"in '.json' as configuration in this directory in alphabetical order. This can be "+
-			"specified multiple times.")
+		"Path to a directory or a glob pattern of directories and files to read configuration "+
+			"files from. This will read every file ending in '.json', '.yaml', '.yml' or '.hcl' "+
+			"as configuration in this directory in alphabetical order. This can be specified "+
+			"multiple times.")
+	optionalFiles := addOptionalConfigFileFlag(f, &cfgFiles)
+	configURLCAFile := f.String("config-url-ca-file", "",
+		"Path to a PEM encoded CA bundle to verify the servers of the configuration files "+
+			"given as https URLs with. Defaults to the system roots.")
+	f.Var((*configutil.AppendSliceValue)(&hclSnippets), "hcl",
+		"HCL configuration snippet, like 'ports { dns = 8601 }'. It overrides the configuration "+
+			"files but not the other command line flags. This can be specified multiple times.")
+	recursive := addConfigDirRecursiveFlag(f)
+	strictKeys := addConfigStrictFlag(f)
+	disableFuncs := addConfigFunctionsFlag(f)
+	cmd.printConfig = addPrintConfigFlag(f)
+	configEnv := f.Bool("config-env", false,
+		"Reads configuration keys from the CONSUL_<KEY> environment variables, e.g. "+
+			"CONSUL_PORTS_DNS for ports.dns. They override the configuration files but not "+
+			"the -env-file entries and the command line flags.")
+	f.BoolVar(&cmd.kubernetes, "kubernetes", false,
+		"Enables the Kubernetes mode. The configuration is reloaded whenever the configuration "+
+			"files change and ${POD_IP}, ${POD_NAME}, ${POD_NAMESPACE} and ${NODE_NAME} can be "+
+			"referenced in configuration files.")
+	varFlags.addFlags(f)
+	f.Int64Var(&limits.MaxFileSize, "config-max-file-size", limits.MaxFileSize,
+		"Maximum size of a single configuration file in bytes. 0 disables the limit.")
+	f.Int64Var(&limits.MaxTotalSize, "config-max-total-size", limits.MaxTotalSize,
+		"Maximum size of all configuration files in bytes. 0 disables the limit.")
+	f.IntVar(&limits.MaxDepth, "config-max-depth", limits.MaxDepth,
+		"Maximum nesting depth of objects and arrays in configuration files. 0 disables the limit.")
 	f.Var((*configutil.AppendSliceValue)(&dnsRecursors), "recursor",
 		"Address of an upstream DNS server. Can be specified multiple times.")
 	f.Var((*configutil.AppendSliceValue)(&nodeMeta), "node-meta",
@@ -83,6 +149,8 @@ func (cmd *AgentCommand) readConfig() *agent.Config {
 			" that persists in the data-dir.")
 
 	f.BoolVar(&cmdCfg.EnableScriptChecks, "enable-script-checks", false, "Enables health check scripts.")
+	f.BoolVar(&cmdCfg.EnableLocalScriptChecks, "enable-local-script-checks", false,
+		"Enables health check scripts from configuration files only.")
 	var disableHostNodeID configutil.BoolValue
 	f.Var(&disableHostNodeID, "disable-host-node-id",
 		"Setting this to true will prevent Consul from using information from the"+
@@ -97,10 +165,12 @@ func (cmd *AgentCommand) readConfig() *agent.Config {
 	f.StringVar(&cmdCfg.EncryptKey, "encrypt", "", "Provides the gossip encryption key.")
 	f.BoolVar(&cmdCfg.DisableKeyringFile, "disable-keyring-file", false, "Disables the backing up "+
 		"of the keyring to a file.")
+	f.BoolVar(&cmdCfg.StrictPermissions, "strict-permissions", false, "Refuses to start if the "+
+		"data directory, configuration or secret files have unsafe ownership or permissions.")
 
 	f.BoolVar(&cmdCfg.Server, "server", false, "Switches agent to server mode.")
-	f.BoolVar(&cmdCfg.NonVotingServer, "non-voting-server", false,
-		"(Enterprise-only) This flag is used to make the server not participate in the Raft quorum, "+
+	f.BoolVar(&cmdCfg.ReadReplica, "read-replica", false,
+		"This flag is used to make the server not participate in the Raft quorum, "+
 			"and have it only receive the data replication stream. This can be used to add read scalability "+
 			"to a cluster in cases where a high volume of reads to servers are needed.")
 	f.BoolVar(&cmdCfg.Bootstrap, "bootstrap", false, "Sets server to bootstrap mode.")
@@ -108,19 +178,26 @@ func (cmd *AgentCommand) readConfig() *agent.Config {
 	f.StringVar(&cmdCfg.Domain, "domain", "", "Domain to use for DNS interface.")
 
 	f.StringVar(&cmdCfg.ClientAddr, "client", "",
-		"Sets the address to bind for client access. This includes RPC, DNS, HTTP and HTTPS (if configured).")
+		"Sets the address to bind for client access. This includes RPC, DNS, HTTP and HTTPS (if configured). "+
+			"Can be a space or comma separated list of addresses.")
 	f.StringVar(&cmdCfg.BindAddr, "bind", "", "Sets the bind address for cluster communication.")
 	f.StringVar(&cmdCfg.SerfWanBindAddr, "serf-wan-bind", "", "Address to bind Serf WAN listeners to.")
 	f.StringVar(&cmdCfg.SerfLanBindAddr, "serf-lan-bind", "", "Address to bind Serf LAN listeners to.")
-	f.IntVar(&cmdCfg.Ports.HTTP, "http-port", 0, "Sets the HTTP API port to listen on.")
-	f.IntVar(&cmdCfg.Ports.DNS, "dns-port", 0, "DNS port to use.")
+	f.IntVar(&cmdCfg.Ports.HTTP, "http-port", 0, "Sets the HTTP API port to listen on. -1 disables it.")
+	f.IntVar(&cmdCfg.Ports.DNS, "dns-port", 0, "DNS port to use. -1 disables it.")
+	f.IntVar(&cmdCfg.Ports.HTTPS, "https-port", 0, "Sets the HTTPS API port to listen on. -1 disables it.")
+	f.IntVar(&cmdCfg.Ports.GRPC, "grpc-port", 0, "Sets the gRPC API port to listen on. -1 disables it.")
+	f.IntVar(&cmdCfg.Ports.SerfLan, "serf-lan-port", 0, "Sets the Serf LAN port to listen on.")
+	f.IntVar(&cmdCfg.Ports.SerfWan, "serf-wan-port", 0,
+		"Sets the Serf WAN port to listen on. -1 disables the WAN gossip pool of servers.")
+	f.IntVar(&cmdCfg.Ports.Server, "server-port", 0, "Sets the server RPC port to listen on.")
 	f.StringVar(&cmdCfg.AdvertiseAddr, "advertise", "", "Sets the advertise address to use.")
 	f.StringVar(&cmdCfg.AdvertiseAddrWan, "advertise-wan", "",
 		"Sets address to advertise on WAN instead of -advertise address.")
 
-	f.IntVar(&cmdCfg.Protocol, "protocol", -1,
+	f.IntVar(&cmdCfg.Protocol, "protocol", 0,
 		"Sets the protocol version. Defaults to latest.")
-	f.IntVar(&cmdCfg.RaftProtocol, "raft-protocol", -1,
+	f.IntVar(&cmdCfg.RaftProtocol, "raft-protocol", 0,
 		"Sets the Raft protocol version. Defaults to latest.")
 
 	f.BoolVar(&cmdCfg.EnableSyslog, "syslog", false,
@@ -137,24 +214,6 @@ func (cmd *AgentCommand) readConfig() *agent.Config {
 		"Maximum number of join attempts. Defaults to 0, which will retry indefinitely.")
 	f.StringVar(&retryInterval, "retry-interval", "",
 		"Time to wait between join attempts.")
-	f.StringVar(&cmdCfg.DeprecatedRetryJoinEC2.Region, "retry-join-ec2-region", "",
-		"EC2 Region to discover servers in.")
-	f.StringVar(&cmdCfg.DeprecatedRetryJoinEC2.TagKey, "retry-join-ec2-tag-key", "",
-		"EC2 tag key to filter on for server discovery.")
-	f.StringVar(&cmdCfg.DeprecatedRetryJoinEC2.TagValue, "retry-join-ec2-tag-value", "",
-		"EC2 tag value to filter on for server discovery.")
-	f.StringVar(&cmdCfg.DeprecatedRetryJoinGCE.ProjectName, "retry-join-gce-project-name", "",
-		"Google Compute Engine project to discover servers in.")
-	f.StringVar(&cmdCfg.DeprecatedRetryJoinGCE.ZonePattern, "retry-join-gce-zone-pattern", "",
-		"Google Compute Engine region or zone to discover servers in (regex pattern).")
-	f.StringVar(&cmdCfg.DeprecatedRetryJoinGCE.TagValue, "retry-join-gce-tag-value", "",
-		"Google Compute Engine tag value to filter on for server discovery.")
-	f.StringVar(&cmdCfg.DeprecatedRetryJoinGCE.CredentialsFile, "retry-join-gce-credentials-file", "",
-		"Path to credentials JSON file to use with Google Compute Engine.")
-	f.StringVar(&cmdCfg.DeprecatedRetryJoinAzure.TagName, "retry-join-azure-tag-name", "",
-		"Azure tag name to filter on for server discovery.")
-	f.StringVar(&cmdCfg.DeprecatedRetryJoinAzure.TagValue, "retry-join-azure-tag-value", "",
-		"Azure tag value to filter on for server discovery.")
 	f.Var((*configutil.AppendSliceValue)(&cmdCfg.RetryJoinWan), "retry-join-wan",
 		"Address of an agent to join -wan at start time with retries enabled. "+
 			"Can be specified multiple times.")
@@ -163,41 +222,20 @@ func (cmd *AgentCommand) readConfig() *agent.Config {
 	f.StringVar(&retryIntervalWan, "retry-interval-wan", "",
 		"Time to wait between join -wan attempts.")
 
-	// deprecated flags
-	var dcDeprecated string
-	var atlasJoin bool
-	var atlasInfrastructure, atlasToken, atlasEndpoint string
-	f.StringVar(&dcDeprecated, "dc", "",
-		"(deprecated) Datacenter of the agent (use 'datacenter' instead).")
-	f.StringVar(&atlasInfrastructure, "atlas", "",
-		"(deprecated) Sets the Atlas infrastructure name, enables SCADA.")
-	f.StringVar(&atlasToken, "atlas-token", "",
-		"(deprecated) Provides the Atlas API token.")
-	f.BoolVar(&atlasJoin, "atlas-join", false,
-		"(deprecated) Enables auto-joining the Atlas cluster.")
-	f.StringVar(&atlasEndpoint, "atlas-endpoint", "",
-		"(deprecated) The address of the endpoint for Atlas integration.")
+	addDeprecatedFlags(f, deprecatedAgentFlags)
 
 	if err := cmd.BaseCommand.Parse(cmd.args); err != nil {
 		return nil
 	}
 
-	// check deprecated flags
-	if atlasInfrastructure != "" {
-		cmd.UI.Warn("WARNING: 'atlas' is deprecated")
-	}
-	if atlasToken != "" {
-		cmd.UI.Warn("WARNING: 'atlas-token' is deprecated")
-	}
-	if atlasJoin {
-		cmd.UI.Warn("WARNING: 'atlas-join' is deprecated")
-	}
-	if atlasEndpoint != "" {
-		cmd.UI.Warn("WARNING: 'atlas-endpoint' is deprecated")
+	// Translate the deprecated flags to their replacements.
+	deprecated, err := translateDeprecatedFlags(f, deprecatedAgentFlags)
+	if err != nil {
+		cmd.UI.Error(fmt.Sprintf("Error: %s", err))
+		return nil
 	}
-	if dcDeprecated != "" && cmdCfg.Datacenter == "" {
-		cmd.UI.Warn("WARNING: 'dc' is deprecated. Use 'datacenter' instead")
-		cmdCfg.Datacenter = dcDeprecated
+	for _, c := range deprecated {
+		cmd.UI.Warn("WARNING: " + c.String())
 	}
 
 	if retryInterval != "" {
@@ -226,72 +264,198 @@ func (cmd *AgentCommand) readConfig() *agent.Config {
 		}
 	}
 
-	cfg := agent.DefaultConfig()
-	if dev {
-		cfg = agent.DevConfig()
+	// Configuration files given as https URLs are fetched and then read
+	// like the local files.
+	if cmd.remoteConfig == nil {
+		cmd.remoteConfig = &agent.RemoteConfig{}
+	}
+	cmd.remoteConfig.CAFile = *configURLCAFile
+	cmd.remoteConfig.Limits = limits
+	cfgFiles, err = cmd.remoteConfig.Fetch(cfgFiles)
+	if err != nil {
+		cmd.UI.Error(err.Error())
+		return nil
+	}
+
+	cfgFiles, err = expandConfigDirs(cfgFiles, *recursive)
+	if err != nil {
+		cmd.UI.Error(err.Error())
+		return nil
 	}
 
-	if len(cfgFiles) > 0 {
-		fileConfig, err := agent.ReadConfigPaths(cfgFiles)
+	// The variables of the env file take precedence over the ones of the
+	// Kubernetes mode.
+	var base map[string]string
+	if cmd.kubernetes {
+		base = agent.KubernetesVars()
+	}
+	localConfig := os.Getenv(agent.LocalConfigEnv)
+	vars, env, err := varFlags.vars(base, cfgFiles, localConfig, limits)
+	if err != nil {
+		cmd.UI.Error(err.Error())
+		return nil
+	}
+
+	// The CONSUL_<KEY> environment variables and the entries of the env
+	// file override the configuration files in this order but not the
+	// command line flags.
+	var environConfig *agent.Config
+	if *configEnv {
+		environConfig, err = agent.ConfigFromEnv(agent.ConfigEnviron(os.Environ()))
 		if err != nil {
-			cmd.UI.Error(err.Error())
+			cmd.UI.Error(fmt.Sprintf("Error reading the environment: %s", err))
+			return nil
+		}
+	}
+	var envConfig *agent.Config
+	if len(env) > 0 {
+		envConfig, err = agent.ConfigFromEnv(env)
+		if err != nil {
+			cmd.UI.Error(fmt.Sprintf("Error reading '%s': %s", varFlags.envFile, err))
 			return nil
 		}
-
-		cfg = agent.MergeConfig(cfg, fileConfig)
 	}
 
 	cmdCfg.DNSRecursors = append(cmdCfg.DNSRecursors, dnsRecursors...)
 
-	cfg = agent.MergeConfig(cfg, &cmdCfg)
-	disableHostNodeID.Merge(cfg.DisableHostNodeID)
+	if cmd.configCache == nil {
+		cmd.configCache = agent.NewConfigCache()
+	}
+	builder := &agent.ConfigBuilder{
+		Default: agent.DefaultConfig(),
+		Paths:   cfgFiles,
+		Sources: []agent.ConfigSource{
+			{Name: "environment", Config: environConfig},
+			{Name: varFlags.envFile, Config: envConfig},
+
+			// A complete configuration document in CONSUL_LOCAL_CONFIG
+			// is merged after the configuration files.
+			{Name: agent.LocalConfigEnv, Data: localConfig},
+
+			// The configuration overlay fetched from the servers is
+			// merged after the local configuration and before the
+			// command line flags.
+			{Name: "config overlay", Load: func(cur *agent.Config) (*agent.Config, error) {
+				if !cur.ConfigOverlay.Enabled {
+					return nil, nil
+				}
+				return cmd.readConfigOverlay(cur, cmdCfg.DataDir, limits)
+			}},
+		},
+		Limits:           limits,
+		Vars:             vars,
+		Cache:            cmd.configCache,
+		StrictKeys:       *strictKeys,
+		DisableFunctions: *disableFuncs,
+		Remote:           cmd.remoteConfig.Fetched,
+	}
+	// The -hcl snippets are merged in order before the other command line
+	// flags.
+	for _, snippet := range hclSnippets {
+		builder.Sources = append(builder.Sources, agent.ConfigSource{
+			Name:   "-hcl",
+			Format: agent.ConfigFormatHCL,
+			Data:   snippet,
+		})
+	}
+	builder.Sources = append(builder.Sources, agent.ConfigSource{Name: "command line flags", Config: &cmdCfg})
+	if dev {
+		builder.Default = agent.DevConfig()
+	}
+	cfg, warnings, err := builder.Build()
+	cfgFiles = builder.Files()
+	cmd.configPaths = cfgFiles
+	cmd.configLimits = limits
+	cmd.configMissing = optionalFiles.missing
+
+	// Point the errors about conflicting settings at the source which set
+	// the key last, in the reverse order of the merge.
+	setFlags := make(map[string]bool)
+	f.Visit(func(fl *flag.Flag) { setFlags[fl.Name] = true })
+	source := func(key, flagName string) string {
+		if setFlags[flagName] {
+			return "-" + flagName
+		}
+		if localConfig != "" && agent.LocalConfigHasKey(localConfig, key) {
+			return agent.LocalConfigEnv
+		}
+		if _, ok := env[agent.ConfigEnvName(key)]; ok {
+			return fmt.Sprintf("%s in '%s'", agent.ConfigEnvName(key), varFlags.envFile)
+		}
+		if path := agent.ConfigKeySource(cfgFiles, limits, key); path != "" {
+			return fmt.Sprintf("'%s'", path)
+		}
+		return "the defaults"
+	}
 
-	if cfg.NodeName == "" {
-		hostname, err := os.Hostname()
-		if err != nil {
-			cmd.UI.Error(fmt.Sprintf("Error determining node name: %s", err))
-			return nil
+	// describe names where the keys of configuration errors were set.
+	describe := func(err error) string {
+		ce, ok := err.(*agent.ConfigError)
+		if !ok || len(ce.Keys) == 0 {
+			return cmd.remoteConfig.Describe(err.Error())
+		}
+		var srcs []string
+		for _, key := range ce.Keys {
+			flagName := strings.Replace(key, "_", "-", -1)
+			src := source(key, flagName)
+			if old := deprecatedFlagFor(f, deprecatedAgentFlags, flagName); old != "" && src == "the defaults" {
+				src = "-" + old
+			}
+			srcs = append(srcs, fmt.Sprintf("%s set by %s", key, src))
 		}
-		cfg.NodeName = hostname
+		return cmd.remoteConfig.Describe(fmt.Sprintf("%s (%s)", ce.Message, strings.Join(srcs, ", ")))
 	}
-	cfg.NodeName = strings.TrimSpace(cfg.NodeName)
-	if cfg.NodeName == "" {
-		cmd.UI.Error("Node name can not be empty")
+
+	if err != nil {
+		if merr, ok := err.(*multierror.Error); ok {
+			cmd.UI.Error(fmt.Sprintf("The configuration has %d errors:", len(merr.Errors)))
+			for _, err := range merr.Errors {
+				cmd.UI.Error("  * " + describe(err))
+			}
+		} else {
+			cmd.UI.Error(describe(err))
+		}
 		return nil
 	}
-
-	// Make sure LeaveOnTerm and SkipLeaveOnInt are set to the right
-	// defaults based on the agent's mode (client or server).
-	if cfg.LeaveOnTerm == nil {
-		cfg.LeaveOnTerm = agent.Bool(!cfg.Server)
+	for _, w := range warnings {
+		cmd.UI.Warn("WARNING: " + cmd.remoteConfig.Describe(w))
 	}
-	if cfg.SkipLeaveOnInt == nil {
-		cfg.SkipLeaveOnInt = agent.Bool(cfg.Server)
+	if w := flagConflicts(f, cfgFiles, limits); w != "" {
+		cmd.UI.Warn(w)
 	}
+	disableHostNodeID.Merge(cfg.DisableHostNodeID)
 
-	// Ensure we have a data directory if we are not in dev mode.
+	// Ensure we have a usable data directory if we are not in dev mode.
 	if !dev {
-		if cfg.DataDir == "" {
-			cmd.UI.Error("Must specify data directory using -data-dir")
+		warnings, err := cfg.VerifyDataDir()
+		if err != nil {
+			cmd.UI.Error(err.Error())
 			return nil
 		}
-
-		if finfo, err := os.Stat(cfg.DataDir); err != nil {
-			if !os.IsNotExist(err) {
-				cmd.UI.Error(fmt.Sprintf("Error getting data-dir: %s", err))
-				return nil
-			}
-		} else if !finfo.IsDir() {
-			cmd.UI.Error(fmt.Sprintf("The data-dir specified at %q is not a directory", cfg.DataDir))
-			return nil
+		for _, w := range warnings {
+			cmd.UI.Warn("WARNING: " + w)
 		}
 	}
 
-	// Ensure all endpoints are unique
-	if err := cfg.VerifyUniqueListeners(); err != nil {
-		cmd.UI.Error(fmt.Sprintf("All listening endpoints must be unique: %s", err))
+	// Audit the permissions of the data directory, configuration files and
+	// secret files.
+	violations, err := cfg.AuditPermissions(cfgFiles)
+	if err != nil {
+		cmd.UI.Error(err.Error())
 		return nil
 	}
+	if len(violations) > 0 {
+		if cfg.StrictPermissions {
+			for _, v := range violations {
+				cmd.UI.Error(fmt.Sprintf("Permission audit: %s", v))
+			}
+			cmd.UI.Error("Refusing to start with -strict-permissions")
+			return nil
+		}
+		for _, v := range violations {
+			cmd.UI.Warn(fmt.Sprintf("WARNING: Permission audit: %s", v))
+		}
+	}
 
 	// Check the data dir for signs of an un-migrated Consul 0.5.x or older
 	// server. Consul refuses to start if this is present to protect a server
@@ -312,213 +476,50 @@ func (cmd *AgentCommand) readConfig() *agent.Config {
 		}
 	}
 
-	// Verify DNS settings
-	if cfg.DNSConfig.UDPAnswerLimit < 1 {
-		cmd.UI.Error(fmt.Sprintf("dns_config.udp_answer_limit %d too low, must always be greater than zero", cfg.DNSConfig.UDPAnswerLimit))
-	}
-
 	if cfg.EncryptKey != "" {
-		if _, err := cfg.EncryptBytes(); err != nil {
-			cmd.UI.Error(fmt.Sprintf("Invalid encryption key: %s", err))
-			return nil
-		}
 		keyfileLAN := filepath.Join(cfg.DataDir, agent.SerfLANKeyring)
 		if _, err := os.Stat(keyfileLAN); err == nil {
-			cmd.UI.Error("WARNING: LAN keyring exists but -encrypt given, using keyring")
+			cmd.UI.Warn("WARNING: LAN keyring exists but -encrypt given, using keyring")
 		}
 		if cfg.Server {
 			keyfileWAN := filepath.Join(cfg.DataDir, agent.SerfWANKeyring)
 			if _, err := os.Stat(keyfileWAN); err == nil {
-				cmd.UI.Error("WARNING: WAN keyring exists but -encrypt given, using keyring")
+				cmd.UI.Warn("WARNING: WAN keyring exists but -encrypt given, using keyring")
 			}
 		}
 	}
 
-	// Ensure the datacenter is always lowercased. The DNS endpoints automatically
-	// lowercase all queries, and internally we expect DC1 and dc1 to be the same.
-	cfg.Datacenter = strings.ToLower(cfg.Datacenter)
-
-	// Verify datacenter is valid
-	if !validDatacenter.MatchString(cfg.Datacenter) {
-		cmd.UI.Error("Datacenter must be alpha-numeric with underscores and hypens only")
-		return nil
-	}
-
-	// If 'acl_datacenter' is set, ensure it is lowercased.
-	if cfg.ACLDatacenter != "" {
-		cfg.ACLDatacenter = strings.ToLower(cfg.ACLDatacenter)
-
-		// Verify 'acl_datacenter' is valid
-		if !validDatacenter.MatchString(cfg.ACLDatacenter) {
-			cmd.UI.Error("ACL datacenter must be alpha-numeric with underscores and hypens only")
-			return nil
-		}
-	}
-
-	// Only allow bootstrap mode when acting as a server
-	if cfg.Bootstrap && !cfg.Server {
-		cmd.UI.Error("Bootstrap mode cannot be enabled when server mode is not enabled")
-		return nil
-	}
-
-	// Expect can only work when acting as a server
-	if cfg.BootstrapExpect != 0 && !cfg.Server {
-		cmd.UI.Error("Expect mode cannot be enabled when server mode is not enabled")
-		return nil
-	}
-
-	// Expect can only work when dev mode is off
-	if cfg.BootstrapExpect > 0 && cfg.DevMode {
-		cmd.UI.Error("Expect mode cannot be enabled when dev mode is enabled")
-		return nil
-	}
-
-	// Expect & Bootstrap are mutually exclusive
-	if cfg.BootstrapExpect != 0 && cfg.Bootstrap {
-		cmd.UI.Error("Bootstrap cannot be provided with an expected server count")
-		return nil
-	}
-
-	if ipaddr.IsAny(cfg.AdvertiseAddr) {
-		cmd.UI.Error("Advertise address cannot be " + cfg.AdvertiseAddr)
-		return nil
-	}
-
-	if ipaddr.IsAny(cfg.AdvertiseAddrWan) {
-		cmd.UI.Error("Advertise WAN address cannot be " + cfg.AdvertiseAddrWan)
-		return nil
-	}
-
-	// patch deprecated retry-join-{gce,azure,ec2)-* parameters
-	// into -retry-join and issue warning.
-	// todo(fs): this should really be in DecodeConfig where it can be tested
-	if !reflect.DeepEqual(cfg.DeprecatedRetryJoinEC2, agent.RetryJoinEC2{}) {
-		m := discover.Config{
-			"provider":          "aws",
-			"region":            cfg.DeprecatedRetryJoinEC2.Region,
-			"tag_key":           cfg.DeprecatedRetryJoinEC2.TagKey,
-			"tag_value":         cfg.DeprecatedRetryJoinEC2.TagValue,
-			"access_key_id":     cfg.DeprecatedRetryJoinEC2.AccessKeyID,
-			"secret_access_key": cfg.DeprecatedRetryJoinEC2.SecretAccessKey,
-		}
-		cfg.RetryJoin = append(cfg.RetryJoin, m.String())
-		cfg.DeprecatedRetryJoinEC2 = agent.RetryJoinEC2{}
-
-		// redact m before output
-		if m["access_key_id"] != "" {
-			m["access_key_id"] = "hidden"
-		}
-		if m["secret_access_key"] != "" {
-			m["secret_access_key"] = "hidden"
-		}
-
-		cmd.UI.Warn(fmt.Sprintf("==> DEPRECATION: retry_join_ec2 is deprecated. "+
-			"Please add %q to retry_join\n", m))
-	}
-	if !reflect.DeepEqual(cfg.DeprecatedRetryJoinAzure, agent.RetryJoinAzure{}) {
-		m := discover.Config{
-			"provider":          "azure",
-			"tag_name":          cfg.DeprecatedRetryJoinAzure.TagName,
-			"tag_value":         cfg.DeprecatedRetryJoinAzure.TagValue,
-			"subscription_id":   cfg.DeprecatedRetryJoinAzure.SubscriptionID,
-			"tenant_id":         cfg.DeprecatedRetryJoinAzure.TenantID,
-			"client_id":         cfg.DeprecatedRetryJoinAzure.ClientID,
-			"secret_access_key": cfg.DeprecatedRetryJoinAzure.SecretAccessKey,
-		}
-		cfg.RetryJoin = append(cfg.RetryJoin, m.String())
-		cfg.DeprecatedRetryJoinAzure = agent.RetryJoinAzure{}
-
-		// redact m before output
-		if m["subscription_id"] != "" {
-			m["subscription_id"] = "hidden"
-		}
-		if m["tenant_id"] != "" {
-			m["tenant_id"] = "hidden"
-		}
-		if m["client_id"] != "" {
-			m["client_id"] = "hidden"
-		}
-		if m["secret_access_key"] != "" {
-			m["secret_access_key"] = "hidden"
-		}
-
-		cmd.UI.Warn(fmt.Sprintf("==> DEPRECATION: retry_join_azure is deprecated. "+
-			"Please add %q to retry_join\n", m))
-	}
-	if !reflect.DeepEqual(cfg.DeprecatedRetryJoinGCE, agent.RetryJoinGCE{}) {
-		m := discover.Config{
-			"provider":         "gce",
-			"project_name":     cfg.DeprecatedRetryJoinGCE.ProjectName,
-			"zone_pattern":     cfg.DeprecatedRetryJoinGCE.ZonePattern,
-			"tag_value":        cfg.DeprecatedRetryJoinGCE.TagValue,
-			"credentials_file": cfg.DeprecatedRetryJoinGCE.CredentialsFile,
-		}
-		cfg.RetryJoin = append(cfg.RetryJoin, m.String())
-		cfg.DeprecatedRetryJoinGCE = agent.RetryJoinGCE{}
-
-		// redact m before output
-		if m["credentials_file"] != "" {
-			m["credentials_file"] = "hidden"
-		}
-
-		cmd.UI.Warn(fmt.Sprintf("==> DEPRECATION: retry_join_gce is deprecated. "+
-			"Please add %q to retry_join\n", m))
-	}
-
-	// Compile all the watches
-	for _, params := range cfg.Watches {
-		// Parse the watches, excluding the handler
-		wp, err := watch.ParseExempt(params, []string{"handler"})
-		if err != nil {
-			cmd.UI.Error(fmt.Sprintf("Failed to parse watch (%#v): %v", params, err))
-			return nil
-		}
-
-		// Get the handler
-		h := wp.Exempt["handler"]
-		if _, ok := h.(string); h == nil || !ok {
-			cmd.UI.Error("Watch handler must be a string")
+	// Catch a bad node ID file before the agent starts rather than when
+	// it sets up its identity.
+	if cfg.NodeID == "" && !dev {
+		if _, _, err := agent.ReadNodeIDFile(cfg.DataDir); err != nil {
+			cmd.UI.Error(err.Error())
 			return nil
 		}
-
-		// Store the watch plan
-		cfg.WatchPlans = append(cfg.WatchPlans, wp)
 	}
 
 	// Warn if we are in expect mode
 	if cfg.BootstrapExpect == 1 {
-		cmd.UI.Error("WARNING: BootstrapExpect Mode is specified as 1; this is the same as Bootstrap mode.")
+		cmd.UI.Warn("WARNING: BootstrapExpect Mode is specified as 1; this is the same as Bootstrap mode.")
 		cfg.BootstrapExpect = 0
 		cfg.Bootstrap = true
 	} else if cfg.BootstrapExpect > 0 {
-		cmd.UI.Error(fmt.Sprintf("WARNING: Expect Mode enabled, expecting %d servers", cfg.BootstrapExpect))
+		cmd.UI.Warn(fmt.Sprintf("WARNING: Expect Mode enabled, expecting %d servers", cfg.BootstrapExpect))
 	}
 
 	// Warn if we are expecting an even number of servers
 	if cfg.BootstrapExpect != 0 && cfg.BootstrapExpect%2 == 0 {
+		src := source("bootstrap_expect", "bootstrap-expect")
 		if cfg.BootstrapExpect == 2 {
-			cmd.UI.Error("WARNING: A cluster with 2 servers will provide no failure tolerance.  See https://www.consul.io/docs/internals/consensus.html#deployment-table")
+			cmd.UI.Warn(fmt.Sprintf("WARNING: A cluster with 2 servers will provide no failure tolerance (bootstrap_expect set by %s).  See https://www.consul.io/docs/internals/consensus.html#deployment-table", src))
 		} else {
-			cmd.UI.Error("WARNING: A cluster with an even number of servers does not achieve optimum fault tolerance.  See https://www.consul.io/docs/internals/consensus.html#deployment-table")
+			cmd.UI.Warn(fmt.Sprintf("WARNING: A cluster with an even number of servers does not achieve optimum fault tolerance (bootstrap_expect set by %s).  See https://www.consul.io/docs/internals/consensus.html#deployment-table", src))
 		}
 	}
 
 	// Warn if we are in bootstrap mode
 	if cfg.Bootstrap {
-		cmd.UI.Error("WARNING: Bootstrap mode enabled! Do not enable unless necessary")
-	}
-
-	// Verify the node metadata entries are valid
-	if err := structs.ValidateMetadata(cfg.Meta); err != nil {
-		cmd.UI.Error(fmt.Sprintf("Failed to parse node metadata: %v", err))
-	}
-
-	// It doesn't make sense to include both UI options.
-	if cfg.EnableUI == true && cfg.UIDir != "" {
-		cmd.UI.Error("Both the ui and ui-dir flags were specified, please provide only one")
-		cmd.UI.Error("If trying to use your own web UI resources, use the ui-dir flag")
-		cmd.UI.Error("If using Consul version 0.7.0 or later, the web UI is included in the binary so use ui to enable it")
-		return nil
+		cmd.UI.Warn("WARNING: Bootstrap mode enabled! Do not enable unless necessary")
 	}
 
 	// Set the version info
@@ -526,11 +527,6 @@ func (cmd *AgentCommand) readConfig() *agent.Config {
 	cfg.Version = cmd.Version
 	cfg.VersionPrerelease = cmd.VersionPrerelease
 
-	if err := cfg.ResolveTmplAddrs(); err != nil {
-		cmd.UI.Error(fmt.Sprintf("Failed to parse config: %v", err))
-		return nil
-	}
-
 	if err := cfg.SetupTaggedAndAdvertiseAddrs(); err != nil {
 		cmd.UI.Error(fmt.Sprintf("Failed to set up tagged and advertise addresses: %v", err))
 		return nil
@@ -726,13 +722,18 @@ func startupTelemetry(config *agent.Config) (*metrics.InmemSink, error) {
 
 func (cmd *AgentCommand) Run(args []string) int {
 	code := cmd.run(args)
+	if cmd.remoteConfig != nil {
+		cmd.remoteConfig.Close()
+	}
 	if cmd.logger != nil {
 		cmd.logger.Println("[INFO] Exit code: ", code)
 	}
+	cmd.service.stopped(code)
 	return code
 }
 
 func (cmd *AgentCommand) run(args []string) int {
+	ui := cmd.UI
 	cmd.UI = &cli.PrefixedUi{
 		OutputPrefix: "==> ",
 		InfoPrefix:   "    ",
@@ -742,16 +743,45 @@ func (cmd *AgentCommand) run(args []string) int {
 
 	// Parse our configs
 	cmd.args = args
-	config := cmd.readConfig()
+	config, loadStats := cmd.loadConfig()
 	if config == nil {
 		return 1
 	}
 
+	// Print the merged configuration without the prefixes of the Ui so
+	// that it can be processed by other tools.
+	if cmd.printConfig != nil && *cmd.printConfig != "" {
+		out, err := formatConfig(config, *cmd.printConfig)
+		if err != nil {
+			cmd.UI.Error(fmt.Sprintf("Error printing the configuration: %s", err))
+			return 1
+		}
+		ui.Output(out)
+		return 0
+	}
+
+	// Connect to the service control manager when running as a Windows
+	// service.
+	if config.WindowsServiceName != "" {
+		service, err := startWindowsService(config.WindowsServiceName)
+		if err != nil {
+			cmd.UI.Error(fmt.Sprintf("Error starting Windows service: %s", err))
+			return 1
+		}
+		cmd.service = service
+	}
+
 	// Setup the log outputs
+	eventLogSource := config.WindowsServiceName
+	if eventLogSource == "" {
+		eventLogSource = "consul"
+	}
 	logConfig := &logger.Config{
 		LogLevel:       config.LogLevel,
 		EnableSyslog:   config.EnableSyslog,
 		SyslogFacility: config.SyslogFacility,
+		EnableEventLog: config.EnableEventLog,
+		EventLogSource: eventLogSource,
 	}
 	logFilter, logGate, logWriter, logOutput, ok := logger.Setup(logConfig, cmd.UI)
 	if !ok {
@@ -760,12 +790,15 @@ func (cmd *AgentCommand) run(args []string) int {
 	cmd.logFilter = logFilter
 	cmd.logOutput = logOutput
 	cmd.logger = log.New(logOutput, "", log.LstdFlags)
+	cmd.logMissingConfigFiles()
 
 	memSink, err := startupTelemetry(config)
 	if err != nil {
 		cmd.UI.Error(err.Error())
 		return 1
 	}
+	emitConfigLoadMetrics(loadStats)
+	cmd.configLoaded()
 
 	// Create the agent
 	cmd.UI.Output("Starting Consul agent...")
@@ -778,10 +811,16 @@ func (cmd *AgentCommand) run(args []string) int {
 	agent.LogWriter = logWriter
 	agent.MemSink = memSink
 
+	agent.OnConfigChange(cmd.reloadLogLevel)
+
 	if err := agent.Start(); err != nil {
 		cmd.UI.Error(fmt.Sprintf("Error starting agent: %s", err))
 		return 1
 	}
+	if b, err := json.Marshal(agent.RuntimeConfig().Sanitized()); err == nil {
+		cmd.logger.Printf("[DEBUG] agent: Runtime configuration: %s", b)
+	}
+	cmd.logger.Printf("[INFO] agent: Configuration hash: %s", agent.RuntimeConfig().Hash())
 
 	// shutdown agent before endpoints
 	defer agent.ShutdownEndpoints()
@@ -804,6 +843,32 @@ func (cmd *AgentCommand) run(args []string) int {
 	// Let the agent know we've finished registration
 	agent.StartSync()
 
+	go cmd.emitConfigAge(agent.ShutdownCh())
+	if config.ConfigStaleCheckInterval > 0 {
+		go cmd.detectStaleConfig(agent, config.ConfigStaleCheckInterval)
+	}
+	if cmd.kubernetes {
+		go cmd.watchConfigFiles(agent, configWatchInterval)
+	}
+	if config.ConfigOverlay.Enabled {
+		go cmd.watchConfigOverlay(agent)
+	}
+
+	// Tell systemd that we are up once the listeners are started and the
+	// initial join has completed.
+	sd := &systemdNotifier{}
+	var watchdogCh <-chan time.Time
+	if config.SystemdNotify {
+		sd = newSystemdNotifier(os.LookupEnv, cmd.logger)
+		sd.notify("READY=1")
+		if sd.watchdog > 0 {
+			watchdog := time.NewTicker(sd.watchdog)
+			defer watchdog.Stop()
+			watchdogCh = watchdog.C
+		}
+	}
+	cmd.service.running()
+
 	cmd.UI.Output("Consul agent running!")
 	cmd.UI.Info(fmt.Sprintf("       Version: '%s'", cmd.HumanVersion))
 	cmd.UI.Info(fmt.Sprintf("       Node ID: '%s'", config.NodeID))
@@ -833,6 +898,8 @@ func (cmd *AgentCommand) run(args []string) int {
 		select {
 		case s := <-signalCh:
 			sig = s
+		case s := <-cmd.service.SignalCh():
+			sig = s
 		case ch := <-agent.ReloadCh():
 			sig = syscall.SIGHUP
 			reloadErrCh = ch
@@ -844,6 +911,11 @@ func (cmd *AgentCommand) run(args []string) int {
 		case <-agent.ShutdownCh():
 			// agent is already down!
 			return 0
+		case <-watchdogCh:
+			// The watchdog is pet from the main loop so that systemd
+			// restarts an agent which stopped handling signals.
+			sd.notify("WATCHDOG=1")
+			continue
 		}
 
 		switch sig {
@@ -853,7 +925,9 @@ func (cmd *AgentCommand) run(args []string) int {
 		case syscall.SIGHUP:
 			cmd.logger.Println("[INFO] Caught signal: ", sig)
 
+			sd.notify("RELOADING=1")
 			conf, err := cmd.handleReload(agent, config)
+			sd.notify("READY=1")
 			if conf != nil {
 				config = conf
 			}
@@ -867,6 +941,8 @@ func (cmd *AgentCommand) run(args []string) int {
 
 		default:
 			cmd.logger.Println("[INFO] Caught signal: ", sig)
+			sd.notify("STOPPING=1")
+			cmd.service.stopping()
 
 			graceful := (sig == os.Interrupt && !(*config.SkipLeaveOnInt)) || (sig == syscall.SIGTERM && (*config.LeaveOnTerm))
 			if !graceful {
@@ -900,21 +976,38 @@ func (cmd *AgentCommand) run(args []string) int {
 	}
 }
 
+// reloadLogLevel changes the log level when a reload changed it. Invalid
+// levels are rejected by handleReload before they are applied.
+func (cmd *AgentCommand) reloadLogLevel(old, new *agent.Config, changed map[string]bool) {
+	if changed["log_level"] {
+		cmd.logFilter.SetMinLevel(logutils.LogLevel(strings.ToUpper(new.LogLevel)))
+	}
+}
+
 // handleReload is invoked when we should reload our configs, e.g. SIGHUP
 func (cmd *AgentCommand) handleReload(agent *agent.Agent, cfg *agent.Config) (*agent.Config, error) {
 	cmd.logger.Println("[INFO] Reloading configuration...")
 	var errs error
-	newCfg := cmd.readConfig()
+	defer func() {
+		if errs != nil {
+			metrics.IncrCounter([]string{"consul", "agent", "config", "reload", "failure"}, 1)
+		} else {
+			metrics.IncrCounter([]string{"consul", "agent", "config", "reload", "success"}, 1)
+			cmd.configLoaded()
+		}
+	}()
+	newCfg, loadStats := cmd.loadConfig()
 	if newCfg == nil {
 		errs = multierror.Append(errs, fmt.Errorf("Failed to reload configs"))
 		return cfg, errs
 	}
+	emitConfigLoadMetrics(loadStats)
+	cmd.logMissingConfigFiles()
 
-	// Change the log level
+	// Validate the log level, which is applied by the agent's config
+	// change hook.
 	minLevel := logutils.LogLevel(strings.ToUpper(newCfg.LogLevel))
-	if logger.ValidateLevelFilter(minLevel, cmd.logFilter) {
-		cmd.logFilter.SetMinLevel(minLevel)
-	} else {
+	if !logger.ValidateLevelFilter(minLevel, cmd.logFilter) {
 		errs = multierror.Append(fmt.Errorf(
 			"Invalid log level: %s. Valid log levels are: %v",
 			minLevel, cmd.logFilter.Levels))
@@ -0,0 +1,73 @@
+package command
+
+import (
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/consul/agent"
+	"github.com/mitchellh/cli"
+)
+
+// configAgeInterval is how often the time since the configuration was last
+// loaded successfully is reported.
+const configAgeInterval = 10 * time.Second
+
+// configLoadStats describes a configuration load.
+type configLoadStats struct {
+	parseTime time.Duration
+	files     int
+	warnings  int
+}
+
+// warningCounter counts the warnings written to the wrapped Ui.
+type warningCounter struct {
+	cli.Ui
+	warnings int
+}
+
+func (u *warningCounter) Warn(s string) {
+	u.warnings++
+	u.Ui.Warn(s)
+}
+
+// loadConfig reads the configuration like readConfig and returns statistics
+// about the load.
+func (cmd *AgentCommand) loadConfig() (*agent.Config, configLoadStats) {
+	ui := &warningCounter{Ui: cmd.UI}
+	cmd.UI = ui
+	defer func() { cmd.UI = ui.Ui }()
+
+	start := time.Now()
+	cfg := cmd.readConfig()
+	stats := configLoadStats{
+		parseTime: time.Since(start),
+		warnings:  ui.warnings,
+	}
+	if cmd.configCache != nil {
+		stats.files = cmd.configCache.Len()
+	}
+	return cfg, stats
+}
+
+// emitConfigLoadMetrics reports the statistics of a configuration load.
+func emitConfigLoadMetrics(stats configLoadStats) {
+	metrics.AddSample([]string{"consul", "agent", "config", "parse_time"}, float32(stats.parseTime.Seconds()*1000))
+	metrics.SetGauge([]string{"consul", "agent", "config", "files"}, float32(stats.files))
+	metrics.SetGauge([]string{"consul", "agent", "config", "warnings"}, float32(stats.warnings))
+}
+
+// emitConfigAge periodically reports the time since the configuration was
+// last loaded successfully until stopCh is closed. Agents which keep
+// failing to reload pushed configuration stand out by a growing value.
+func (cmd *AgentCommand) emitConfigAge(stopCh <-chan struct{}) {
+	for {
+		select {
+		case <-time.After(configAgeInterval):
+		case <-stopCh:
+			return
+		}
+		loadedAt, _ := cmd.configLoadedAt.Load().(time.Time)
+		metrics.SetGauge([]string{"consul", "agent", "config", "seconds_since_last_load"},
+			float32(time.Since(loadedAt).Seconds()))
+	}
+}
@@ -0,0 +1,89 @@
+package command
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/hashicorp/consul/agent"
+)
+
+// configOverlayRetryInterval is how long to wait before fetching the
+// configuration overlay again after a failed fetch.
+const configOverlayRetryInterval = 10 * time.Second
+
+// readConfigOverlay returns the configuration overlay to merge into cfg.
+// This is the overlay last fetched from the servers or, when the agent
+// starts, the copy of it in the data directory which is overridden by the
+// -data-dir flag if set.
+func (cmd *AgentCommand) readConfigOverlay(cfg *agent.Config, dataDir string, limits agent.ConfigLimits) (*agent.Config, error) {
+	docs, ok := cmd.configOverlay.Load().(agent.ConfigOverlayDocs)
+	if !ok {
+		c := *cfg
+		if dataDir != "" {
+			c.DataDir = dataDir
+		}
+		var err error
+		if docs, err = c.ReadConfigOverlayFile(); err != nil {
+			return nil, err
+		}
+		cmd.configOverlay.Store(docs)
+	}
+	return docs.Decode(limits)
+}
+
+// watchConfigOverlay fetches the configuration overlay from the servers
+// and reloads the configuration whenever it changes until the agent shuts
+// down. Overlays which fail to decode are not applied. The overlay is also
+// written to the data directory so that the settings which cannot be
+// reloaded are applied when the agent restarts.
+func (cmd *AgentCommand) watchConfigOverlay(a *agent.Agent) {
+	var index uint64
+	for {
+		docs, next, err := a.FetchConfigOverlay(index)
+		select {
+		case <-a.ShutdownCh():
+			return
+		default:
+		}
+		if err != nil {
+			cmd.logger.Printf("[WARN] agent: Failed to fetch configuration overlay: %v", err)
+			select {
+			case <-time.After(configOverlayRetryInterval):
+			case <-a.ShutdownCh():
+				return
+			}
+			continue
+		}
+
+		switch {
+		case next < index:
+			// Start over if the index went backwards, e.g. after a
+			// snapshot was restored.
+			index = 0
+		case next == 0:
+			// A query with an index of 0 would not block.
+			index = 1
+		default:
+			index = next
+		}
+
+		cur, _ := cmd.configOverlay.Load().(agent.ConfigOverlayDocs)
+		if reflect.DeepEqual(cur, docs) {
+			continue
+		}
+		src, _ := cmd.configSources.Load().(configSources)
+		if _, err := docs.Decode(src.limits); err != nil {
+			cmd.logger.Printf("[ERR] agent: Ignoring configuration overlay: %v", err)
+			continue
+		}
+		cmd.configOverlay.Store(docs)
+		if err := a.WriteConfigOverlayFile(docs); err != nil {
+			cmd.logger.Printf("[WARN] agent: Failed to persist configuration overlay: %v", err)
+		}
+
+		cmd.logger.Printf("[INFO] agent: Configuration overlay changed, reloading configuration")
+		if err := a.TriggerReload(); err != nil {
+			cmd.logger.Printf("[ERR] agent: Failed to reload configuration after overlay change: %v", err)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/consul/agent"
+)
+
+// configSources are the configuration files a configuration was loaded
+// from and the limits they were read with.
+type configSources struct {
+	paths  []string
+	hashes agent.ConfigFileHashes
+	limits agent.ConfigLimits
+}
+
+// configLoaded records the time and the sources of a successfully loaded
+// configuration.
+func (cmd *AgentCommand) configLoaded() {
+	src := configSources{paths: cmd.configPaths, limits: cmd.configLimits}
+	if len(src.paths) > 0 && cmd.configCache != nil {
+		src.hashes = cmd.configCache.Hashes()
+	}
+	cmd.configSources.Store(src)
+	cmd.configLoadedAt.Store(time.Now())
+}
+
+// checkStaleConfig compares the configuration files on disk with the ones
+// the running configuration was loaded from and flags the agent if they
+// differ.
+func (cmd *AgentCommand) checkStaleConfig(a *agent.Agent) error {
+	src, _ := cmd.configSources.Load().(configSources)
+	changed, err := agent.ChangedConfigFiles(src.paths, src.hashes)
+	if err != nil {
+		return err
+	}
+
+	stale := len(changed) > 0
+	var value float32
+	if stale {
+		value = 1
+	}
+	metrics.SetGauge([]string{"consul", "agent", "config", "stale"}, value)
+	a.SetConfigStale(stale, fmt.Sprintf("Configuration files changed since the last reload: %s", strings.Join(changed, ", ")))
+	return nil
+}
+
+// detectStaleConfig periodically checks whether the configuration is stale
+// until the agent shuts down.
+func (cmd *AgentCommand) detectStaleConfig(a *agent.Agent, interval time.Duration) {
+	for {
+		select {
+		case <-time.After(interval):
+		case <-a.ShutdownCh():
+			return
+		}
+		if err := cmd.checkStaleConfig(a); err != nil {
+			cmd.logger.Printf("[WARN] agent: Failed to check for configuration changes: %v", err)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+
+	discover "github.com/hashicorp/go-discover"
+)
+
+// deprecatedFlag describes a deprecated flag of the agent command and how
+// it is translated. The value of a flag with a newFlag is given to newFlag
+// unless newFlag is set as well. The values of the flags of a retry join
+// group are combined into a go-discover configuration for the provider
+// which is appended to -retry-join. Flags with neither have no equivalent
+// and are ignored.
+type deprecatedFlag struct {
+	name    string
+	isBool  bool
+	usage   string
+	newFlag string
+
+	// group, provider and key describe the flags of the retry join
+	// providers. The values of secret keys are hidden in the warnings.
+	group    string
+	provider string
+	key      string
+	secret   bool
+}
+
+// deprecatedAgentFlags lists the deprecated flags of the agent command in
+// the order they are translated.
+var deprecatedAgentFlags = []deprecatedFlag{
+	{name: "atlas", usage: "Sets the Atlas infrastructure name, enables SCADA."},
+	{name: "atlas-endpoint", usage: "The address of the endpoint for Atlas integration."},
+	{name: "atlas-join", isBool: true, usage: "Enables auto-joining the Atlas cluster."},
+	{name: "atlas-token", usage: "Provides the Atlas API token."},
+	{name: "dc", newFlag: "datacenter", usage: "Datacenter of the agent (use 'datacenter' instead)."},
+	{name: "non-voting-server", isBool: true, newFlag: "read-replica", usage: "Equivalent to -read-replica."},
+	{name: "retry-join-azure-tag-name", group: "retry-join-azure", provider: "azure", key: "tag_name",
+		usage: "Azure tag name to filter on for server discovery."},
+	{name: "retry-join-azure-tag-value", group: "retry-join-azure", provider: "azure", key: "tag_value",
+		usage: "Azure tag value to filter on for server discovery."},
+	{name: "retry-join-ec2-region", group: "retry-join-ec2", provider: "aws", key: "region",
+		usage: "EC2 Region to discover servers in."},
+	{name: "retry-join-ec2-tag-key", group: "retry-join-ec2", provider: "aws", key: "tag_key",
+		usage: "EC2 tag key to filter on for server discovery."},
+	{name: "retry-join-ec2-tag-value", group: "retry-join-ec2", provider: "aws", key: "tag_value",
+		usage: "EC2 tag value to filter on for server discovery."},
+	{name: "retry-join-gce-credentials-file", group: "retry-join-gce", provider: "gce", key: "credentials_file", secret: true,
+		usage: "Path to credentials JSON file to use with Google Compute Engine."},
+	{name: "retry-join-gce-project-name", group: "retry-join-gce", provider: "gce", key: "project_name",
+		usage: "Google Compute Engine project to discover servers in."},
+	{name: "retry-join-gce-tag-value", group: "retry-join-gce", provider: "gce", key: "tag_value",
+		usage: "Google Compute Engine tag value to filter on for server discovery."},
+	{name: "retry-join-gce-zone-pattern", group: "retry-join-gce", provider: "gce", key: "zone_pattern",
+		usage: "Google Compute Engine region or zone to discover servers in (regex pattern)."},
+}
+
+// deprecatedFlagChange describes a deprecated flag which was translated by
+// translateDeprecatedFlags. For the retry join groups, Flag is the group
+// and Value is the go-discover configuration with the secrets hidden.
+type deprecatedFlagChange struct {
+	Flag    string
+	NewFlag string
+	Value   string
+}
+
+// String returns the warning about the change.
+func (c deprecatedFlagChange) String() string {
+	switch {
+	case c.NewFlag == "":
+		return fmt.Sprintf("'%s' is deprecated", c.Flag)
+	case c.Value != "":
+		return fmt.Sprintf("'%s-*' is deprecated. Please add %q to '%s'", c.Flag, c.Value, c.NewFlag)
+	default:
+		return fmt.Sprintf("'%s' is deprecated. Use '%s' instead", c.Flag, c.NewFlag)
+	}
+}
+
+// addDeprecatedFlags adds the deprecated flags to f.
+func addDeprecatedFlags(f *flag.FlagSet, flags []deprecatedFlag) {
+	for _, d := range flags {
+		usage := "(deprecated) " + d.usage
+		if d.isBool {
+			f.Bool(d.name, false, usage)
+		} else {
+			f.String(d.name, "", usage)
+		}
+	}
+}
+
+// translateDeprecatedFlags gives the values of the deprecated flags set in
+// f to their replacements and returns the changes in the order of flags.
+// The replacements are not marked as set so that the errors about their
+// settings can still name the deprecated flag, see deprecatedFlagFor.
+func translateDeprecatedFlags(f *flag.FlagSet, flags []deprecatedFlag) ([]deprecatedFlagChange, error) {
+	set := make(map[string]bool)
+	f.Visit(func(fl *flag.Flag) { set[fl.Name] = true })
+
+	var changes []deprecatedFlagChange
+	groups := make(map[string]discover.Config)
+	var order []deprecatedFlag
+	for _, d := range flags {
+		if !set[d.name] {
+			continue
+		}
+		v := f.Lookup(d.name).Value.String()
+		switch {
+		case d.group != "":
+			if groups[d.group] == nil {
+				groups[d.group] = discover.Config{"provider": d.provider}
+				order = append(order, d)
+			}
+			groups[d.group][d.key] = v
+		case d.newFlag != "":
+			if !set[d.newFlag] {
+				if err := f.Lookup(d.newFlag).Value.Set(v); err != nil {
+					return nil, fmt.Errorf("invalid value %q for flag -%s: %v", v, d.name, err)
+				}
+			}
+			changes = append(changes, deprecatedFlagChange{Flag: d.name, NewFlag: d.newFlag})
+		default:
+			changes = append(changes, deprecatedFlagChange{Flag: d.name})
+		}
+	}
+
+	for _, g := range order {
+		cfg := groups[g.group]
+		if err := f.Lookup("retry-join").Value.Set(cfg.String()); err != nil {
+			return nil, err
+		}
+		for _, d := range flags {
+			if d.group == g.group && d.secret && cfg[d.key] != "" {
+				cfg[d.key] = "hidden"
+			}
+		}
+		changes = append(changes, deprecatedFlagChange{Flag: g.group, NewFlag: "retry-join", Value: cfg.String()})
+	}
+	return changes, nil
+}
+
+// deprecatedFlagFor returns the deprecated flag set in f whose value was
+// given to newFlag, or an empty string if there is none.
+func deprecatedFlagFor(f *flag.FlagSet, flags []deprecatedFlag, newFlag string) string {
+	set := make(map[string]bool)
+	f.Visit(func(fl *flag.Flag) { set[fl.Name] = true })
+	for _, d := range flags {
+		if d.newFlag == newFlag && set[d.name] {
+			return d.name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,96 @@
+package command
+
+import (
+	"flag"
+	"io/ioutil"
+	"testing"
+
+	"github.com/hashicorp/consul/configutil"
+	"github.com/pascaldekloe/goe/verify"
+)
+
+func TestTranslateDeprecatedFlags(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		desc      string
+		args      []string
+		dc        string
+		replica   bool
+		retryJoin []string
+		warnings  []string
+		dcFlag    string
+	}{
+		{
+			desc: "none",
+			args: []string{"-datacenter=dc1"},
+			dc:   "dc1",
+		},
+		{
+			desc:     "replacement",
+			args:     []string{"-dc=dc2", "-non-voting-server"},
+			dc:       "dc2",
+			replica:  true,
+			warnings: []string{"'dc' is deprecated. Use 'datacenter' instead", "'non-voting-server' is deprecated. Use 'read-replica' instead"},
+			dcFlag:   "dc",
+		},
+		{
+			desc:     "replacement set",
+			args:     []string{"-dc=dc2", "-datacenter=dc1"},
+			dc:       "dc1",
+			warnings: []string{"'dc' is deprecated. Use 'datacenter' instead"},
+			dcFlag:   "dc",
+		},
+		{
+			desc:     "no equivalent",
+			args:     []string{"-atlas-join", "-atlas=hashicorp/prod"},
+			warnings: []string{"'atlas' is deprecated", "'atlas-join' is deprecated"},
+		},
+		{
+			desc: "retry join",
+			args: []string{
+				"-retry-join=1.2.3.4",
+				"-retry-join-gce-project-name=p", "-retry-join-gce-credentials-file=/secret",
+				"-retry-join-ec2-region=us-east-1", "-retry-join-ec2-tag-key=k",
+			},
+			retryJoin: []string{
+				"1.2.3.4",
+				"provider=aws region=us-east-1 tag_key=k",
+				"provider=gce credentials_file=%2Fsecret project_name=p",
+			},
+			warnings: []string{
+				`'retry-join-ec2-*' is deprecated. Please add "provider=aws region=us-east-1 tag_key=k" to 'retry-join'`,
+				`'retry-join-gce-*' is deprecated. Please add "provider=gce credentials_file=hidden project_name=p" to 'retry-join'`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			var dc string
+			var replica bool
+			var retryJoin []string
+			f := flag.NewFlagSet("", flag.ContinueOnError)
+			f.SetOutput(ioutil.Discard)
+			f.StringVar(&dc, "datacenter", "", "")
+			f.BoolVar(&replica, "read-replica", false, "")
+			f.Var((*configutil.AppendSliceValue)(&retryJoin), "retry-join", "")
+			addDeprecatedFlags(f, deprecatedAgentFlags)
+			if err := f.Parse(tt.args); err != nil {
+				t.Fatalf("err: %v", err)
+			}
+
+			changes, err := translateDeprecatedFlags(f, deprecatedAgentFlags)
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			var warnings []string
+			for _, c := range changes {
+				warnings = append(warnings, c.String())
+			}
+			verify.Values(t, "warnings", warnings, tt.warnings)
+			verify.Values(t, "", []interface{}{dc, replica, retryJoin}, []interface{}{tt.dc, tt.replica, tt.retryJoin})
+			if got := deprecatedFlagFor(f, deprecatedAgentFlags, "datacenter"); got != tt.dcFlag {
+				t.Fatalf("got deprecated flag %q want %q", got, tt.dcFlag)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/consul/agent"
+)
+
+// flagConfigKeys maps the command line flags which replace a setting of
+// the configuration files to the key of the setting. Flags which append to
+// a list, like -join, are not listed since they don't replace anything.
+var flagConfigKeys = map[string]string{
+	"advertise":                  "advertise_addr",
+	"advertise-wan":              "advertise_addr_wan",
+	"bind":                       "bind_addr",
+	"bootstrap":                  "bootstrap",
+	"bootstrap-expect":           "bootstrap_expect",
+	"client":                     "client_addr",
+	"data-dir":                   "data_dir",
+	"datacenter":                 "datacenter",
+	"dc":                         "datacenter",
+	"disable-host-node-id":       "disable_host_node_id",
+	"disable-keyring-file":       "disable_keyring_file",
+	"dns-port":                   "ports.dns",
+	"domain":                     "domain",
+	"enable-local-script-checks": "enable_local_script_checks",
+	"enable-script-checks":       "enable_script_checks",
+	"encrypt":                    "encrypt",
+	"http-port":                  "ports.http",
+	"log-level":                  "log_level",
+	"node":                       "node_name",
+	"node-id":                    "node_id",
+	"non-voting-server":          "read_replica",
+	"pid-file":                   "pid_file",
+	"protocol":                   "protocol",
+	"raft-protocol":              "raft_protocol",
+	"read-replica":               "read_replica",
+	"rejoin":                     "rejoin_after_leave",
+	"retry-interval":             "retry_interval",
+	"retry-interval-wan":         "retry_interval_wan",
+	"retry-max":                  "retry_max",
+	"retry-max-wan":              "retry_max_wan",
+	"serf-lan-bind":              "serf_lan_bind",
+	"serf-wan-bind":              "serf_wan_bind",
+	"server":                     "server",
+	"strict-permissions":         "strict_permissions",
+	"syslog":                     "enable_syslog",
+	"ui":                         "ui",
+	"ui-dir":                     "ui_dir",
+}
+
+// flagConflicts returns a single warning listing the settings of the
+// configuration files at paths which the command line flags set in f
+// override with a different value, or an empty string if there are none.
+// The value of the encryption key is not shown.
+func flagConflicts(f *flag.FlagSet, paths []string, limits agent.ConfigLimits) string {
+	var lines []string
+	f.Visit(func(fl *flag.Flag) {
+		key, ok := flagConfigKeys[fl.Name]
+		if !ok {
+			return
+		}
+		path, v := agent.ConfigKeyValue(paths, limits, key)
+		if path == "" || fmt.Sprint(v) == fl.Value.String() {
+			return
+		}
+		flagValue, fileValue := fmt.Sprintf("%q", fl.Value.String()), fmt.Sprintf("%q", fmt.Sprint(v))
+		if key == "encrypt" {
+			flagValue, fileValue = "hidden", "hidden"
+		}
+		lines = append(lines, fmt.Sprintf("  %s: -%s=%s overrides %s from '%s'",
+			key, fl.Name, flagValue, fileValue, path))
+	})
+	if len(lines) == 0 {
+		return ""
+	}
+	sort.Strings(lines)
+	return "WARNING: Command line flags override settings of the configuration files:\n" +
+		strings.Join(lines, "\n")
+}
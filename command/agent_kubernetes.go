@@ -0,0 +1,48 @@
+package command
+
+import (
+	"time"
+
+	"github.com/hashicorp/consul/agent"
+)
+
+// configWatchInterval is how often the configuration files are checked for
+// changes in Kubernetes mode. The kubelet updates mounted ConfigMaps and
+// secrets only about once a minute, so there is no need to check more
+// often.
+const configWatchInterval = 5 * time.Second
+
+// watchConfigFiles reloads the configuration whenever the configuration
+// files change until the agent shuts down. The contents of the files are
+// compared so that files which are replaced through the symlink swap of
+// mounted ConfigMap and secret volumes are detected. A change which failed
+// to reload is not retried until the files change again.
+func (cmd *AgentCommand) watchConfigFiles(a *agent.Agent, interval time.Duration) {
+	var attempted agent.ConfigFileHashes
+	for {
+		select {
+		case <-time.After(interval):
+		case <-a.ShutdownCh():
+			return
+		}
+
+		src, _ := cmd.configSources.Load().(configSources)
+		current, err := agent.ReadConfigFileHashes(src.paths)
+		if err != nil {
+			cmd.logger.Printf("[WARN] agent: Failed to check for configuration changes: %v", err)
+			continue
+		}
+		if len(current.Changed(src.hashes)) == 0 {
+			continue
+		}
+		if attempted != nil && len(current.Changed(attempted)) == 0 {
+			continue
+		}
+		attempted = current
+
+		cmd.logger.Printf("[INFO] agent: Configuration files changed, reloading configuration")
+		if err := a.TriggerReload(); err != nil {
+			cmd.logger.Printf("[ERR] agent: Failed to reload configuration after file change: %v", err)
+		}
+	}
+}
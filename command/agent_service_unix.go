@@ -0,0 +1,23 @@
+// +build !windows
+
+package command
+
+import (
+	"fmt"
+	"os"
+)
+
+// windowsService is not supported on this platform. All methods can be
+// called on a nil service.
+type windowsService struct{}
+
+// startWindowsService returns an error since Windows services are only
+// supported on Windows.
+func startWindowsService(name string) (*windowsService, error) {
+	return nil, fmt.Errorf("Windows services are only supported on Windows")
+}
+
+func (s *windowsService) SignalCh() <-chan os.Signal { return nil }
+func (s *windowsService) running()                   {}
+func (s *windowsService) stopping()                  {}
+func (s *windowsService) stopped(code int)           {}
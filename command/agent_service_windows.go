@@ -0,0 +1,184 @@
+// +build windows
+
+package command
+
+import (
+	"os"
+	"runtime"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	// errServiceNotStarted is returned by StartServiceCtrlDispatcher when
+	// the process was not started by the service control manager.
+	errServiceNotStarted = syscall.Errno(1063) // ERROR_FAILED_SERVICE_CONTROLLER_CONNECT
+
+	errCallNotImplemented  = 120  // ERROR_CALL_NOT_IMPLEMENTED
+	errServiceSpecific     = 1066 // ERROR_SERVICE_SPECIFIC_ERROR
+	servicePendingWaitHint = 30000
+)
+
+var procRegisterServiceCtrlHandlerEx = windows.NewLazySystemDLL("advapi32.dll").NewProc("RegisterServiceCtrlHandlerExW")
+
+// windowsService connects the agent to the Windows service control manager.
+// Stop and shutdown requests are delivered as SIGTERM and parameter change
+// requests as SIGHUP so that they are handled like the signals on other
+// platforms. All methods can be called on a nil service, which is used when
+// the agent does not run as a service.
+type windowsService struct {
+	name     *uint16
+	signalCh chan os.Signal
+	startCh  chan error
+	stopCh   chan uint32
+	doneCh   chan struct{}
+
+	l      sync.Mutex
+	handle windows.Handle
+	status windows.SERVICE_STATUS
+}
+
+// startWindowsService connects to the service control manager as the
+// service with the given name. It returns a nil service if the agent was
+// not started by the service control manager, e.g. when it is run from a
+// console.
+func startWindowsService(name string) (*windowsService, error) {
+	n, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return nil, err
+	}
+	s := &windowsService{
+		name:     n,
+		signalCh: make(chan os.Signal, 4),
+		startCh:  make(chan error, 1),
+		stopCh:   make(chan uint32, 1),
+		doneCh:   make(chan struct{}),
+	}
+	go s.dispatch()
+	if err := <-s.startCh; err != nil {
+		if err == errServiceNotStarted {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
+// dispatch runs the service control dispatcher, which calls serviceMain on
+// a new thread and returns once it has returned.
+func (s *windowsService) dispatch() {
+	defer close(s.doneCh)
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	table := []windows.SERVICE_TABLE_ENTRY{
+		{ServiceName: s.name, ServiceProc: windows.NewCallback(s.serviceMain)},
+		{},
+	}
+	if err := windows.StartServiceCtrlDispatcher(&table[0]); err != nil {
+		select {
+		case s.startCh <- err:
+		default:
+		}
+	}
+}
+
+func (s *windowsService) serviceMain(argc, argv uintptr) uintptr {
+	h, _, err := procRegisterServiceCtrlHandlerEx.Call(
+		uintptr(unsafe.Pointer(s.name)), windows.NewCallback(s.handleControl), 0)
+	if h == 0 {
+		s.startCh <- err
+		return 0
+	}
+	s.handle = windows.Handle(h)
+	s.setStatus(windows.SERVICE_START_PENDING, 0)
+	s.startCh <- nil
+
+	code := <-s.stopCh
+	s.setStatus(windows.SERVICE_STOPPED, code)
+	return 0
+}
+
+func (s *windowsService) handleControl(ctrl, eventType, eventData, context uintptr) uintptr {
+	switch ctrl {
+	case windows.SERVICE_CONTROL_STOP, windows.SERVICE_CONTROL_SHUTDOWN:
+		s.setStatus(windows.SERVICE_STOP_PENDING, 0)
+		s.signal(syscall.SIGTERM)
+	case windows.SERVICE_CONTROL_PARAMCHANGE:
+		s.signal(syscall.SIGHUP)
+	case windows.SERVICE_CONTROL_INTERROGATE:
+		s.l.Lock()
+		windows.SetServiceStatus(s.handle, &s.status)
+		s.l.Unlock()
+	default:
+		return errCallNotImplemented
+	}
+	return 0
+}
+
+func (s *windowsService) signal(sig os.Signal) {
+	select {
+	case s.signalCh <- sig:
+	default:
+	}
+}
+
+func (s *windowsService) setStatus(state uint32, code uint32) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	s.status = windows.SERVICE_STATUS{
+		ServiceType:  windows.SERVICE_WIN32_OWN_PROCESS,
+		CurrentState: state,
+	}
+	switch state {
+	case windows.SERVICE_RUNNING:
+		s.status.ControlsAccepted = windows.SERVICE_ACCEPT_STOP |
+			windows.SERVICE_ACCEPT_SHUTDOWN | windows.SERVICE_ACCEPT_PARAMCHANGE
+	case windows.SERVICE_START_PENDING, windows.SERVICE_STOP_PENDING:
+		s.status.WaitHint = servicePendingWaitHint
+	}
+	if code != 0 {
+		s.status.Win32ExitCode = errServiceSpecific
+		s.status.ServiceSpecificExitCode = code
+	}
+	windows.SetServiceStatus(s.handle, &s.status)
+}
+
+// SignalCh returns the channel the service control requests are delivered
+// on.
+func (s *windowsService) SignalCh() <-chan os.Signal {
+	if s == nil {
+		return nil
+	}
+	return s.signalCh
+}
+
+// running reports that the agent has started.
+func (s *windowsService) running() {
+	if s == nil {
+		return
+	}
+	s.setStatus(windows.SERVICE_RUNNING, 0)
+}
+
+// stopping reports that the agent is shutting down.
+func (s *windowsService) stopping() {
+	if s == nil {
+		return
+	}
+	s.setStatus(windows.SERVICE_STOP_PENDING, 0)
+}
+
+// stopped reports that the agent has exited with the given code and waits
+// until the service control manager was notified.
+func (s *windowsService) stopped(code int) {
+	if s == nil {
+		return
+	}
+	s.stopCh <- uint32(code)
+	<-s.doneCh
+}
@@ -0,0 +1,77 @@
+package command
+
+import (
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// systemdNotifier reports the state of the agent to systemd through the
+// sd_notify protocol. The zero value does not send anything so that it can
+// be used when the integration is disabled or the agent does not run under
+// systemd.
+type systemdNotifier struct {
+	// socket is the path of the datagram socket systemd listens on.
+	socket string
+
+	// watchdog is the interval at which the watchdog has to be pet. It is
+	// zero if the watchdog is not enabled for the agent.
+	watchdog time.Duration
+
+	logger *log.Logger
+}
+
+// newSystemdNotifier returns a notifier for the socket and watchdog given by
+// the NOTIFY_SOCKET, WATCHDOG_USEC and WATCHDOG_PID variables. The watchdog
+// is pet at half of the configured timeout, as recommended by systemd.
+func newSystemdNotifier(lookup func(string) (string, bool), logger *log.Logger) *systemdNotifier {
+	n := &systemdNotifier{logger: logger}
+	n.socket, _ = lookup("NOTIFY_SOCKET")
+
+	usec, ok := lookup("WATCHDOG_USEC")
+	if !ok || n.socket == "" {
+		return n
+	}
+	if pid, ok := lookup("WATCHDOG_PID"); ok && pid != strconv.Itoa(os.Getpid()) {
+		return n
+	}
+	us, err := strconv.ParseInt(usec, 10, 64)
+	if err != nil || us <= 0 {
+		if logger != nil {
+			logger.Printf("[WARN] agent: Ignoring invalid WATCHDOG_USEC %q", usec)
+		}
+		return n
+	}
+	n.watchdog = time.Duration(us) * time.Microsecond / 2
+	return n
+}
+
+// send writes the state, e.g. "READY=1", to the systemd socket. A leading
+// '@' in the socket path denotes a socket in the abstract namespace.
+func (n *systemdNotifier) send(state string) error {
+	if n.socket == "" {
+		return nil
+	}
+	addr := &net.UnixAddr{Name: n.socket, Net: "unixgram"}
+	if strings.HasPrefix(addr.Name, "@") {
+		addr.Name = "\x00" + addr.Name[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// notify sends the state to systemd and logs failures since the agent keeps
+// running without the notifications.
+func (n *systemdNotifier) notify(state string) {
+	if err := n.send(state); err != nil && n.logger != nil {
+		n.logger.Printf("[WARN] agent: Failed to notify systemd of %q: %v", state, err)
+	}
+}
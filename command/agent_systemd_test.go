@@ -0,0 +1,80 @@
+package command
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/testutil"
+)
+
+func TestSystemdNotifier_watchdog(t *testing.T) {
+	t.Parallel()
+	pid := strconv.Itoa(os.Getpid())
+	tests := []struct {
+		desc string
+		env  map[string]string
+		want time.Duration
+	}{
+		{"no socket", map[string]string{"WATCHDOG_USEC": "10000000"}, 0},
+		{"no watchdog", map[string]string{"NOTIFY_SOCKET": "/run/notify"}, 0},
+		{"watchdog", map[string]string{"NOTIFY_SOCKET": "/run/notify", "WATCHDOG_USEC": "10000000"}, 5 * time.Second},
+		{"own pid", map[string]string{"NOTIFY_SOCKET": "/run/notify", "WATCHDOG_USEC": "10000000", "WATCHDOG_PID": pid}, 5 * time.Second},
+		{"other pid", map[string]string{"NOTIFY_SOCKET": "/run/notify", "WATCHDOG_USEC": "10000000", "WATCHDOG_PID": "1"}, 0},
+		{"invalid", map[string]string{"NOTIFY_SOCKET": "/run/notify", "WATCHDOG_USEC": "soon"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			lookup := func(k string) (string, bool) {
+				v, ok := tt.env[k]
+				return v, ok
+			}
+			n := newSystemdNotifier(lookup, nil)
+			if got, want := n.watchdog, tt.want; got != want {
+				t.Fatalf("got watchdog %v want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestSystemdNotifier_send(t *testing.T) {
+	t.Parallel()
+	td := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(td)
+
+	socket := filepath.Join(td, "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer conn.Close()
+
+	n := newSystemdNotifier(func(k string) (string, bool) {
+		if k == "NOTIFY_SOCKET" {
+			return socket, true
+		}
+		return "", false
+	}, nil)
+	for _, state := range []string{"READY=1", "WATCHDOG=1"} {
+		if err := n.send(state); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		buf := make([]byte, 64)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		l, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if got, want := string(buf[:l]), state; got != want {
+			t.Fatalf("got %q want %q", got, want)
+		}
+	}
+
+	// Without a socket nothing is sent.
+	if err := (&systemdNotifier{}).send("READY=1"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
@@ -2,6 +2,7 @@ package command
 
 import (
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
@@ -13,6 +14,7 @@ import (
 	"github.com/hashicorp/consul/agent"
 	"github.com/hashicorp/consul/testutil"
 	"github.com/hashicorp/consul/testutil/retry"
+	"github.com/hashicorp/consul/types"
 	"github.com/hashicorp/consul/version"
 	"github.com/mitchellh/cli"
 )
@@ -29,30 +31,6 @@ func TestCommand_implements(t *testing.T) {
 	var _ cli.Command = new(AgentCommand)
 }
 
-func TestValidDatacenter(t *testing.T) {
-	t.Parallel()
-	shouldMatch := []string{
-		"dc1",
-		"east-aws-001",
-		"PROD_aws01-small",
-	}
-	noMatch := []string{
-		"east.aws",
-		"east!aws",
-		"first,second",
-	}
-	for _, m := range shouldMatch {
-		if !validDatacenter.MatchString(m) {
-			t.Fatalf("expected match: %s", m)
-		}
-	}
-	for _, m := range noMatch {
-		if validDatacenter.MatchString(m) {
-			t.Fatalf("expected no match: %s", m)
-		}
-	}
-}
-
 // TestConfigFail should test command line flags that lead to an immediate error.
 func TestConfigFail(t *testing.T) {
 	t.Parallel()
@@ -449,3 +427,1032 @@ func TestBadDataDirPermissions(t *testing.T) {
 		t.Fatalf("expected permission denied error, got: %s", out)
 	}
 }
+
+func TestDataDirNotCreatable(t *testing.T) {
+	t.Parallel()
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(file, nil, 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	ui := cli.NewMockUi()
+	cmd := &AgentCommand{
+		BaseCommand: baseCommand(ui),
+		args:        []string{"-data-dir=" + filepath.Join(file, "data")},
+	}
+	if conf := cmd.readConfig(); conf != nil {
+		t.Fatalf("Should fail with a data directory below a file")
+	}
+	if out := ui.ErrorWriter.String(); !strings.Contains(out, "cannot be created") {
+		t.Fatalf("expected data directory error, got: %s", out)
+	}
+}
+
+func TestStrictPermissions(t *testing.T) {
+	t.Parallel()
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+	if err := os.Chmod(dir, 0777); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Violations are only reported by default.
+	ui := cli.NewMockUi()
+	cmd := &AgentCommand{
+		BaseCommand: baseCommand(ui),
+		args:        []string{"-data-dir=" + dir, "-bind=1.2.3.4"},
+	}
+	if conf := cmd.readConfig(); conf == nil {
+		t.Fatalf("should not fail: %s", ui.ErrorWriter.String())
+	}
+	if out := ui.ErrorWriter.String(); !strings.Contains(out, "WARNING: Permission audit: data_dir") {
+		t.Fatalf("expected permission warning, got: %s", out)
+	}
+
+	// They are fatal with -strict-permissions.
+	ui = cli.NewMockUi()
+	cmd = &AgentCommand{
+		BaseCommand: baseCommand(ui),
+		args:        []string{"-data-dir=" + dir, "-bind=1.2.3.4", "-strict-permissions"},
+	}
+	if conf := cmd.readConfig(); conf != nil {
+		t.Fatalf("should fail")
+	}
+	if out := ui.ErrorWriter.String(); !strings.Contains(out, "has mode 0777, expected at most 0750") {
+		t.Fatalf("expected permission error, got: %s", out)
+	}
+}
+
+func TestRemoteExecRequiresACLs(t *testing.T) {
+	t.Parallel()
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		desc string
+		json string
+		err  string
+	}{
+		{"disabled by default", `{}`, ""},
+		{"enabled without acls", `{"disable_remote_exec": false}`, "Remote exec cannot be enabled when ACLs are disabled"},
+		{"enabled with acls", `{"disable_remote_exec": false, "acl_datacenter": "dc1"}`, ""},
+		{"enabled with override", `{"disable_remote_exec": false, "allow_remote_exec_without_acls": true}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			cfgFile := filepath.Join(dir, "config.json")
+			if err := ioutil.WriteFile(cfgFile, []byte(tt.json), 0600); err != nil {
+				t.Fatalf("err: %v", err)
+			}
+
+			ui := cli.NewMockUi()
+			cmd := &AgentCommand{
+				BaseCommand: baseCommand(ui),
+				args:        []string{"-data-dir=" + dir, "-bind=1.2.3.4", "-config-file=" + cfgFile},
+			}
+			conf := cmd.readConfig()
+			if tt.err == "" {
+				if conf == nil {
+					t.Fatalf("should not fail: %s", ui.ErrorWriter.String())
+				}
+				return
+			}
+			if conf != nil {
+				t.Fatalf("should fail")
+			}
+			if out := ui.ErrorWriter.String(); !strings.Contains(out, tt.err) {
+				t.Fatalf("got %q want %q", out, tt.err)
+			}
+		})
+	}
+}
+
+func TestVerifyServerHostnameImpliesVerifyOutgoing(t *testing.T) {
+	t.Parallel()
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		desc string
+		json string
+		err  string
+	}{
+		{"no ca", `{"verify_server_hostname": true}`, "verify_server_hostname requires ca_file or ca_path to be set"},
+		{"verify outgoing no ca", `{"verify_outgoing": true}`, "verify_outgoing requires ca_file or ca_path to be set"},
+		{"ca file", `{"verify_server_hostname": true, "ca_file": "../test/ca/root.cer"}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			cfgFile := filepath.Join(dir, "tls.json")
+			if err := ioutil.WriteFile(cfgFile, []byte(tt.json), 0600); err != nil {
+				t.Fatalf("err: %v", err)
+			}
+
+			ui := cli.NewMockUi()
+			cmd := &AgentCommand{
+				BaseCommand: baseCommand(ui),
+				args:        []string{"-data-dir=" + dir, "-bind=1.2.3.4", "-config-file=" + cfgFile},
+			}
+			conf := cmd.readConfig()
+			if tt.err != "" {
+				if conf != nil {
+					t.Fatal("should fail")
+				}
+				if out := ui.ErrorWriter.String(); !strings.Contains(out, tt.err) {
+					t.Fatalf("got %q want %q", out, tt.err)
+				}
+				return
+			}
+			if conf == nil {
+				t.Fatalf("should not fail: %s", ui.ErrorWriter.String())
+			}
+			if !conf.VerifyOutgoing {
+				t.Fatal("verify_outgoing should be implied")
+			}
+		})
+	}
+}
+
+func TestGossipKeyRotationConfig(t *testing.T) {
+	t.Parallel()
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		desc string
+		json string
+		err  string
+	}{
+		{"server", `{"server": true, "gossip_key_rotation": {"interval": "24h"}}`, ""},
+		{"client", `{"gossip_key_rotation": {"interval": "24h"}}`, "gossip_key_rotation can only be configured on servers"},
+		{"short interval", `{"server": true, "gossip_key_rotation": {"interval": "1s"}}`, "gossip_key_rotation.interval must be at least 1m"},
+		{"negative retain", `{"server": true, "gossip_key_rotation": {"interval": "24h", "retain": -1}}`, "gossip_key_rotation.retain must be at least 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			cfgFile := filepath.Join(dir, "rotation.json")
+			if err := ioutil.WriteFile(cfgFile, []byte(tt.json), 0600); err != nil {
+				t.Fatalf("err: %v", err)
+			}
+
+			ui := cli.NewMockUi()
+			cmd := &AgentCommand{
+				BaseCommand: baseCommand(ui),
+				args:        []string{"-data-dir=" + dir, "-bind=1.2.3.4", "-config-file=" + cfgFile},
+			}
+			conf := cmd.readConfig()
+			if tt.err == "" {
+				if conf == nil {
+					t.Fatalf("should not fail: %s", ui.ErrorWriter.String())
+				}
+				return
+			}
+			if conf != nil {
+				t.Fatal("should fail")
+			}
+			if out := ui.ErrorWriter.String(); !strings.Contains(out, tt.err) {
+				t.Fatalf("got %q want %q", out, tt.err)
+			}
+		})
+	}
+}
+
+func TestCheckOutputMaxSizeConfig(t *testing.T) {
+	t.Parallel()
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		desc string
+		json string
+		size int
+		err  string
+	}{
+		{"default", `{}`, 4096, ""},
+		{"set", `{"check_output_max_size": 100}`, 100, ""},
+		{"negative", `{"check_output_max_size": -1}`, 0, "check_output_max_size must be at least 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			cfgFile := filepath.Join(dir, "output.json")
+			if err := ioutil.WriteFile(cfgFile, []byte(tt.json), 0600); err != nil {
+				t.Fatalf("err: %v", err)
+			}
+
+			ui := cli.NewMockUi()
+			cmd := &AgentCommand{
+				BaseCommand: baseCommand(ui),
+				args:        []string{"-data-dir=" + dir, "-bind=1.2.3.4", "-config-file=" + cfgFile},
+			}
+			conf := cmd.readConfig()
+			if tt.err != "" {
+				if conf != nil {
+					t.Fatal("should fail")
+				}
+				if out := ui.ErrorWriter.String(); !strings.Contains(out, tt.err) {
+					t.Fatalf("got %q want %q", out, tt.err)
+				}
+				return
+			}
+			if conf == nil {
+				t.Fatalf("should not fail: %s", ui.ErrorWriter.String())
+			}
+			if conf.CheckOutputMaxSize != tt.size {
+				t.Fatalf("got %d want %d", conf.CheckOutputMaxSize, tt.size)
+			}
+		})
+	}
+}
+
+func TestDeregisterCriticalServiceAfterConfig(t *testing.T) {
+	t.Parallel()
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		desc string
+		json string
+		err  string
+	}{
+		{"default", `{"deregister_critical_service_after": "72h"}`, ""},
+		{"lowered minimum", `{"check_deregister_interval_min": "10s", "deregister_critical_service_after": "30s"}`, ""},
+		{"short minimum", `{"check_deregister_interval_min": "10ms"}`, "check_deregister_interval_min must be at least 1s"},
+		{"below minimum", `{"deregister_critical_service_after": "30s"}`, "deregister_critical_service_after must be at least check_deregister_interval_min (1m0s)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			cfgFile := filepath.Join(dir, "deregister.json")
+			if err := ioutil.WriteFile(cfgFile, []byte(tt.json), 0600); err != nil {
+				t.Fatalf("err: %v", err)
+			}
+
+			ui := cli.NewMockUi()
+			cmd := &AgentCommand{
+				BaseCommand: baseCommand(ui),
+				args:        []string{"-data-dir=" + dir, "-bind=1.2.3.4", "-config-file=" + cfgFile},
+			}
+			conf := cmd.readConfig()
+			if tt.err == "" {
+				if conf == nil {
+					t.Fatalf("should not fail: %s", ui.ErrorWriter.String())
+				}
+				return
+			}
+			if conf != nil {
+				t.Fatal("should fail")
+			}
+			if out := ui.ErrorWriter.String(); !strings.Contains(out, tt.err) {
+				t.Fatalf("got %q want %q", out, tt.err)
+			}
+		})
+	}
+}
+
+func TestBootstrapConfig(t *testing.T) {
+	t.Parallel()
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+	cfgFile := filepath.Join(dir, "bootstrap.json")
+
+	tests := []struct {
+		desc  string
+		json  string
+		flags []string
+		err   string
+	}{
+		{"server", `{"server": true, "bootstrap_expect": 3}`, nil, ""},
+		{"both in file", `{"server": true, "bootstrap": true, "bootstrap_expect": 3}`, nil,
+			"(bootstrap set by '" + cfgFile + "', bootstrap_expect set by '" + cfgFile + "')"},
+		{"both with flag", `{"server": true, "bootstrap_expect": 3}`, []string{"-bootstrap"},
+			"(bootstrap set by -bootstrap, bootstrap_expect set by '" + cfgFile + "')"},
+		{"client bootstrap", `{"bootstrap": true}`, nil,
+			"Bootstrap mode cannot be enabled when server mode is not enabled (bootstrap set by '" + cfgFile + "')"},
+		{"client expect", `{}`, []string{"-bootstrap-expect=3"},
+			"Expect mode cannot be enabled when server mode is not enabled (bootstrap_expect set by -bootstrap-expect)"},
+		{"negative expect", `{"server": true, "bootstrap_expect": -1}`, nil,
+			"bootstrap_expect cannot be negative (bootstrap_expect set by '" + cfgFile + "')"},
+		{"read replica", `{"server": true, "read_replica": true}`, nil, ""},
+		{"client read replica", `{"read_replica": true}`, nil,
+			"Read replica mode cannot be enabled when server mode is not enabled (read_replica set by '" + cfgFile + "')"},
+		{"client non voting server", `{}`, []string{"-non-voting-server"},
+			"Read replica mode cannot be enabled when server mode is not enabled (read_replica set by -non-voting-server)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			if err := ioutil.WriteFile(cfgFile, []byte(tt.json), 0600); err != nil {
+				t.Fatalf("err: %v", err)
+			}
+
+			ui := cli.NewMockUi()
+			cmd := &AgentCommand{
+				BaseCommand: baseCommand(ui),
+				args:        append([]string{"-data-dir=" + dir, "-bind=1.2.3.4", "-config-file=" + cfgFile}, tt.flags...),
+			}
+			conf := cmd.readConfig()
+			if tt.err == "" {
+				if conf == nil {
+					t.Fatalf("should not fail: %s", ui.ErrorWriter.String())
+				}
+				return
+			}
+			if conf != nil {
+				t.Fatal("should fail")
+			}
+			if out := ui.ErrorWriter.String(); !strings.Contains(out, tt.err) {
+				t.Fatalf("got %q want %q", out, tt.err)
+			}
+		})
+	}
+}
+
+func TestOverrideConfig(t *testing.T) {
+	t.Parallel()
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+	cfgDir := filepath.Join(dir, "config")
+	files := map[string]string{
+		"main.json":                   `{"datacenter": "east", "node_name": "web1", "log_level": "WARN", "node_meta": {"tier": "web"}}`,
+		"overrides/dc-east.json":      `{"log_level": "ERR", "node_meta": {"zone": "east-1"}}`,
+		"overrides/host-web1.json":    `{"log_level": "DEBUG"}`,
+		"overrides/host-web2.json":    `{"log_level": "TRACE"}`,
+		"overrides/dc-west.json":      `{"log_level": "INFO"}`,
+		"overrides/ignored/main.json": `{"server": true}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(cfgDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	tests := []struct {
+		desc     string
+		flags    []string
+		logLevel string
+		meta     map[string]string
+	}{
+		{"dc and host", nil, "DEBUG", map[string]string{"tier": "web", "zone": "east-1"}},
+		{"host flag", []string{"-node=web2"}, "TRACE", map[string]string{"tier": "web", "zone": "east-1"}},
+		{"dc flag", []string{"-datacenter=west", "-node=web3"}, "INFO", map[string]string{"tier": "web"}},
+		{"flags win", []string{"-log-level=WARN"}, "WARN", map[string]string{"tier": "web", "zone": "east-1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			ui := cli.NewMockUi()
+			cmd := &AgentCommand{
+				BaseCommand: baseCommand(ui),
+				args:        append([]string{"-data-dir=" + dir, "-bind=1.2.3.4", "-config-dir=" + cfgDir}, tt.flags...),
+			}
+			conf := cmd.readConfig()
+			if conf == nil {
+				t.Fatalf("should not fail: %s", ui.ErrorWriter.String())
+			}
+			if conf.LogLevel != tt.logLevel {
+				t.Fatalf("got log level %q want %q", conf.LogLevel, tt.logLevel)
+			}
+			if !reflect.DeepEqual(conf.Meta, tt.meta) {
+				t.Fatalf("got meta %v want %v", conf.Meta, tt.meta)
+			}
+		})
+	}
+}
+
+func TestOptionalConfigFile(t *testing.T) {
+	t.Parallel()
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+	present := filepath.Join(dir, "present.json")
+	if err := ioutil.WriteFile(present, []byte(`{"log_level": "DEBUG"}`), 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	missing := filepath.Join(dir, "missing.json")
+
+	ui := cli.NewMockUi()
+	cmd := &AgentCommand{
+		BaseCommand: baseCommand(ui),
+		args: []string{"-data-dir=" + dir, "-bind=1.2.3.4",
+			"-config-file-optional=" + present, "-config-file-optional=" + missing},
+	}
+	conf := cmd.readConfig()
+	if conf == nil {
+		t.Fatalf("should not fail: %s", ui.ErrorWriter.String())
+	}
+	if conf.LogLevel != "DEBUG" {
+		t.Fatalf("got log level %q", conf.LogLevel)
+	}
+	if !reflect.DeepEqual(cmd.configPaths, []string{present}) {
+		t.Fatalf("got paths %v", cmd.configPaths)
+	}
+	if !reflect.DeepEqual(cmd.configMissing, []string{missing}) {
+		t.Fatalf("got missing %v", cmd.configMissing)
+	}
+
+	// A missing file which is not optional still fails.
+	ui = cli.NewMockUi()
+	cmd = &AgentCommand{
+		BaseCommand: baseCommand(ui),
+		args:        []string{"-data-dir=" + dir, "-bind=1.2.3.4", "-config-file=" + missing},
+	}
+	if conf := cmd.readConfig(); conf != nil {
+		t.Fatal("should fail")
+	}
+}
+
+func TestRecursiveConfigDir(t *testing.T) {
+	t.Parallel()
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+	cfgDir := filepath.Join(dir, "config")
+	files := map[string]string{
+		"base.json":                 `{"log_level": "WARN"}`,
+		"services/web.json":         `{"service": {"name": "web"}}`,
+		"services/db/db.json":       `{"service": {"name": "db"}}`,
+		"checks/disk.json":          `{"check": {"name": "disk", "ttl": "10s"}}`,
+		"checks/.hidden/other.json": `{"check": {"name": "other", "ttl": "10s"}}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(cfgDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	tests := []struct {
+		desc     string
+		flags    []string
+		services []string
+		checks   []string
+	}{
+		{"flat", nil, nil, nil},
+		{"recursive", []string{"-config-dir-recursive"}, []string{"web", "db"}, []string{"disk"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			ui := cli.NewMockUi()
+			cmd := &AgentCommand{
+				BaseCommand: baseCommand(ui),
+				args:        append([]string{"-data-dir=" + dir, "-bind=1.2.3.4", "-config-dir=" + cfgDir}, tt.flags...),
+			}
+			conf := cmd.readConfig()
+			if conf == nil {
+				t.Fatalf("should not fail: %s", ui.ErrorWriter.String())
+			}
+			var services, checks []string
+			for _, svc := range conf.Services {
+				services = append(services, svc.Name)
+			}
+			for _, chk := range conf.Checks {
+				checks = append(checks, chk.Name)
+			}
+			if !reflect.DeepEqual(services, tt.services) || !reflect.DeepEqual(checks, tt.checks) {
+				t.Fatalf("got services %v checks %v want %v %v", services, checks, tt.services, tt.checks)
+			}
+		})
+	}
+}
+
+func TestFlagConflicts(t *testing.T) {
+	t.Parallel()
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+	cfgFile := filepath.Join(dir, "config.json")
+	content := `{"log_level": "INFO", "node_name": "web1", "ports": {"http": 8501}, "encrypt": "pUqJrVyVRj5jsiYEkM/tFQYfWyJIv4s3XkvDwy7Cu5s="}`
+	if err := ioutil.WriteFile(cfgFile, []byte(content), 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	ui := cli.NewMockUi()
+	cmd := &AgentCommand{
+		BaseCommand: baseCommand(ui),
+		args: []string{"-data-dir=" + dir, "-bind=1.2.3.4", "-config-file=" + cfgFile,
+			"-log-level=DEBUG", "-node=web1", "-http-port=8502", "-encrypt=Xe2vjgqAamESLe7dF7Pr8A0Ywi3q1qTs/Rxu5e3AtLk="},
+	}
+	if conf := cmd.readConfig(); conf == nil {
+		t.Fatalf("should not fail: %s", ui.ErrorWriter.String())
+	}
+
+	want := "WARNING: Command line flags override settings of the configuration files:\n" +
+		"  encrypt: -encrypt=hidden overrides hidden from '" + cfgFile + "'\n" +
+		"  log_level: -log-level=\"DEBUG\" overrides \"INFO\" from '" + cfgFile + "'\n" +
+		"  ports.http: -http-port=\"8502\" overrides \"8501\" from '" + cfgFile + "'\n"
+	if out := ui.ErrorWriter.String(); !strings.Contains(out, want) {
+		t.Fatalf("got %q want %q", out, want)
+	}
+}
+
+func TestProtocolConfig(t *testing.T) {
+	t.Parallel()
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+	cfgFile := filepath.Join(dir, "protocol.json")
+
+	tests := []struct {
+		desc     string
+		json     string
+		flags    []string
+		protocol int
+		raft     int
+		err      string
+		warn     string
+	}{
+		{"defaults", `{}`, nil, 2, 0, "", ""},
+		{"file", `{"protocol": 3, "raft_protocol": 3}`, nil, 3, 3, "", ""},
+		{"flags", `{"protocol": 3, "raft_protocol": 3}`, []string{"-protocol=2", "-raft-protocol=2"}, 2, 2, "", ""},
+		{"protocol too high", `{"protocol": 4}`, nil, 0, 0,
+			"protocol version 4 is not supported, must be in range [2, 3] (protocol set by '" + cfgFile + "')", ""},
+		{"raft protocol too high", `{}`, []string{"-raft-protocol=4"}, 0, 0,
+			"raft_protocol version 4 is not supported, must be in range [1, 3] (raft_protocol set by -raft-protocol)", ""},
+		{"read replica", `{"server": true, "read_replica": true}`, nil, 2, 0, "",
+			"WARNING: read_replica requires raft_protocol 3 and has no effect"},
+		{"stabilization", `{"server": true, "raft_protocol": 2, "autopilot": {"server_stabilization_time": "10s"}}`, nil, 2, 2, "",
+			"WARNING: autopilot.server_stabilization_time requires raft_protocol 3 and has no effect"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			if err := ioutil.WriteFile(cfgFile, []byte(tt.json), 0600); err != nil {
+				t.Fatalf("err: %v", err)
+			}
+
+			ui := cli.NewMockUi()
+			cmd := &AgentCommand{
+				BaseCommand: baseCommand(ui),
+				args:        append([]string{"-data-dir=" + dir, "-bind=1.2.3.4", "-config-file=" + cfgFile}, tt.flags...),
+			}
+			conf := cmd.readConfig()
+			out := ui.ErrorWriter.String()
+			if tt.err != "" {
+				if conf != nil {
+					t.Fatal("should fail")
+				}
+				if !strings.Contains(out, tt.err) {
+					t.Fatalf("got %q want %q", out, tt.err)
+				}
+				return
+			}
+			if conf == nil {
+				t.Fatalf("should not fail: %s", out)
+			}
+			if conf.Protocol != tt.protocol || conf.RaftProtocol != tt.raft {
+				t.Fatalf("got %d/%d want %d/%d", conf.Protocol, conf.RaftProtocol, tt.protocol, tt.raft)
+			}
+			if !strings.Contains(out, tt.warn) {
+				t.Fatalf("got %q want %q", out, tt.warn)
+			}
+			if tt.warn == "" && strings.Contains(out, "raft_protocol 3") {
+				t.Fatalf("unexpected warning %q", out)
+			}
+		})
+	}
+}
+
+func TestNodeIDConfig(t *testing.T) {
+	t.Parallel()
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+	cfgFile := filepath.Join(dir, "node-id.json")
+	dataDir := filepath.Join(dir, "data")
+	if err := os.Mkdir(dataDir, 0700); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	nodeIDFile := filepath.Join(dataDir, agent.NodeIDFile)
+
+	tests := []struct {
+		desc   string
+		json   string
+		flags  []string
+		file   string
+		nodeID types.NodeID
+		err    string
+	}{
+		{"none", `{}`, nil, "", "", ""},
+		{"lower case", `{"node_id": "ADF4238A-882B-9DDC-4A9D-5B6758E4159E"}`, nil, "",
+			"adf4238a-882b-9ddc-4a9d-5b6758e4159e", ""},
+		{"invalid flag", `{}`, []string{"-node-id=nope"}, "", "",
+			`Invalid node ID "nope": uuid string is wrong length (node_id set by -node-id)`},
+		{"invalid config", `{"node_id": "nope"}`, nil, "", "",
+			"(node_id set by '" + cfgFile + "')"},
+		{"invalid persisted", `{}`, nil, "adf4238a!882b!9ddc!4a9d!5b6758e4159e", "",
+			"Error reading node ID from '" + nodeIDFile + "'"},
+		{"configured overrides persisted", `{"node_id": "adf4238a-882b-9ddc-4a9d-5b6758e4159e"}`, nil, "nope",
+			"adf4238a-882b-9ddc-4a9d-5b6758e4159e", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			if err := ioutil.WriteFile(cfgFile, []byte(tt.json), 0600); err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			os.Remove(nodeIDFile)
+			if tt.file != "" {
+				if err := ioutil.WriteFile(nodeIDFile, []byte(tt.file), 0600); err != nil {
+					t.Fatalf("err: %v", err)
+				}
+			}
+
+			ui := cli.NewMockUi()
+			cmd := &AgentCommand{
+				BaseCommand: baseCommand(ui),
+				args:        append([]string{"-data-dir=" + dataDir, "-bind=1.2.3.4", "-config-file=" + cfgFile}, tt.flags...),
+			}
+			conf := cmd.readConfig()
+			out := ui.ErrorWriter.String()
+			if tt.err != "" {
+				if conf != nil {
+					t.Fatal("should fail")
+				}
+				if !strings.Contains(out, tt.err) {
+					t.Fatalf("got %q want %q", out, tt.err)
+				}
+				return
+			}
+			if conf == nil {
+				t.Fatalf("should not fail: %s", out)
+			}
+			if conf.NodeID != tt.nodeID {
+				t.Fatalf("got %q want %q", conf.NodeID, tt.nodeID)
+			}
+		})
+	}
+}
+
+func TestBootstrapConfig_evenWarning(t *testing.T) {
+	t.Parallel()
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+
+	ui := cli.NewMockUi()
+	cmd := &AgentCommand{
+		BaseCommand: baseCommand(ui),
+		args:        []string{"-data-dir=" + dir, "-bind=1.2.3.4", "-server", "-bootstrap-expect=4"},
+	}
+	if conf := cmd.readConfig(); conf == nil {
+		t.Fatalf("should not fail: %s", ui.ErrorWriter.String())
+	}
+	want := "does not achieve optimum fault tolerance (bootstrap_expect set by -bootstrap-expect)"
+	if out := ui.ErrorWriter.String(); !strings.Contains(out, want) {
+		t.Fatalf("got %q want %q", out, want)
+	}
+}
+
+func TestConfigLimits(t *testing.T) {
+	t.Parallel()
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+
+	cfgFile := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(cfgFile, []byte(`{"node_meta": {"a": "b"}}`), 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	ui := cli.NewMockUi()
+	cmd := &AgentCommand{
+		BaseCommand: baseCommand(ui),
+		args:        []string{"-data-dir=" + dir, "-bind=1.2.3.4", "-config-file=" + cfgFile, "-config-max-depth=1"},
+	}
+	if conf := cmd.readConfig(); conf != nil {
+		t.Fatal("should fail")
+	}
+	if out := ui.ErrorWriter.String(); !strings.Contains(out, "config.json': nesting depth exceeds the limit of 1") {
+		t.Fatalf("bad: %s", out)
+	}
+}
+
+func TestLoadConfig_stats(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		desc     string
+		args     []string
+		config   string
+		warnings int
+	}{
+		{"none", nil, `{}`, 0},
+		{"deprecated flag", []string{"-dc=dc2"}, `{}`, 1},
+		{"deprecated key in both files", nil, `{"recursor": "8.8.8.8"}`, 2},
+		{"bootstrap", []string{"-server", "-bootstrap"}, `{}`, 1},
+		{"even bootstrap expect", []string{"-server", "-bootstrap-expect=2"}, `{}`, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			dir := testutil.TempDir(t, "consul")
+			defer os.RemoveAll(dir)
+			for _, name := range []string{"a.json", "b.json"} {
+				if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(tt.config), 0600); err != nil {
+					t.Fatalf("err: %v", err)
+				}
+			}
+
+			ui := cli.NewMockUi()
+			cmd := &AgentCommand{
+				BaseCommand: baseCommand(ui),
+				args:        append([]string{"-data-dir=" + dir, "-bind=1.2.3.4", "-config-file=" + filepath.Join(dir, "a.json"), "-config-file=" + filepath.Join(dir, "b.json")}, tt.args...),
+			}
+			conf, stats := cmd.loadConfig()
+			if conf == nil {
+				t.Fatalf("should not fail: %s", ui.ErrorWriter.String())
+			}
+			if stats.files != 2 {
+				t.Fatalf("got %d files want 2", stats.files)
+			}
+			if stats.warnings != tt.warnings {
+				t.Fatalf("got %d warnings want %d: %s", stats.warnings, tt.warnings, ui.ErrorWriter.String())
+			}
+			if cmd.UI != ui {
+				t.Fatal("UI was not restored")
+			}
+		})
+	}
+}
+
+func TestEnvFile(t *testing.T) {
+	t.Parallel()
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+
+	envFile := filepath.Join(dir, "consul.env")
+	env := "NODE=web-1\nCONSUL_DATACENTER=dc2\nCONSUL_LOG_LEVEL=debug\n"
+	if err := ioutil.WriteFile(envFile, []byte(env), 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	cfgFile := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(cfgFile, []byte(`{"node_name": "${NODE}", "datacenter": "dc1", "log_level": "info"}`), 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	ui := cli.NewMockUi()
+	cmd := &AgentCommand{
+		BaseCommand: baseCommand(ui),
+		args: []string{"-data-dir=" + dir, "-bind=1.2.3.4", "-config-file=" + cfgFile,
+			"-env-file=" + envFile, "-log-level=warn"},
+	}
+	conf := cmd.readConfig()
+	if conf == nil {
+		t.Fatalf("should not fail: %s", ui.ErrorWriter.String())
+	}
+	// The env file overrides the configuration files but not the flags.
+	if conf.NodeName != "web-1" || conf.Datacenter != "dc2" || conf.LogLevel != "warn" {
+		t.Fatalf("bad: %q %q %q", conf.NodeName, conf.Datacenter, conf.LogLevel)
+	}
+
+	ui = cli.NewMockUi()
+	cmd = &AgentCommand{
+		BaseCommand: baseCommand(ui),
+		args:        []string{"-data-dir=" + dir, "-bind=1.2.3.4", "-env-file=" + filepath.Join(dir, "missing.env")},
+	}
+	if conf := cmd.readConfig(); conf != nil {
+		t.Fatal("should fail")
+	}
+	if out := ui.ErrorWriter.String(); !strings.Contains(out, "missing.env") {
+		t.Fatalf("bad: %s", out)
+	}
+}
+
+func TestReadConfig_multipleErrors(t *testing.T) {
+	t.Parallel()
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+
+	cfgFile := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(cfgFile, []byte(`{"bootstrap": true, "serf_lan_allowed_cidrs": ["bogus"]}`), 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	ui := cli.NewMockUi()
+	cmd := &AgentCommand{
+		BaseCommand: baseCommand(ui),
+		args:        []string{"-data-dir=" + dir, "-bind=1.2.3.4", "-config-file=" + cfgFile},
+	}
+	if conf := cmd.readConfig(); conf != nil {
+		t.Fatal("should fail")
+	}
+	out := ui.ErrorWriter.String()
+	for _, want := range []string{
+		"The configuration has 2 errors:",
+		"  * Bootstrap mode cannot be enabled when server mode is not enabled",
+		"  * serf_lan_allowed_cidrs: invalid CIDR address: bogus (serf_lan_allowed_cidrs set by '" + cfgFile + "')",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("got %q want %q", out, want)
+		}
+	}
+}
+
+func TestConfigEnv(t *testing.T) {
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+
+	os.Setenv("CONSUL_DATACENTER", "dc2")
+	defer os.Unsetenv("CONSUL_DATACENTER")
+	os.Setenv("CONSUL_LOG_LEVEL", "debug")
+	defer os.Unsetenv("CONSUL_LOG_LEVEL")
+	os.Setenv("CONSUL_NODE_NAME", "web-1")
+	defer os.Unsetenv("CONSUL_NODE_NAME")
+
+	envFile := filepath.Join(dir, "consul.env")
+	if err := ioutil.WriteFile(envFile, []byte("CONSUL_NODE_NAME=web-2\n"), 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	cfgFile := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(cfgFile, []byte(`{"datacenter": "dc1", "log_level": "info"}`), 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	for _, env := range []bool{false, true} {
+		ui := cli.NewMockUi()
+		args := []string{"-data-dir=" + dir, "-bind=1.2.3.4", "-config-file=" + cfgFile,
+			"-env-file=" + envFile, "-log-level=warn"}
+		if env {
+			args = append(args, "-config-env")
+		}
+		cmd := &AgentCommand{BaseCommand: baseCommand(ui), args: args}
+		conf := cmd.readConfig()
+		if conf == nil {
+			t.Fatalf("should not fail: %s", ui.ErrorWriter.String())
+		}
+
+		// The environment overrides the configuration files but not
+		// the env file and the flags.
+		dc := "dc1"
+		if env {
+			dc = "dc2"
+		}
+		if conf.Datacenter != dc || conf.NodeName != "web-2" || conf.LogLevel != "warn" {
+			t.Fatalf("env %v: bad: %q %q %q", env, conf.Datacenter, conf.NodeName, conf.LogLevel)
+		}
+	}
+}
+
+func TestKubernetesMode(t *testing.T) {
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+
+	os.Setenv("NODE_NAME", "node-1")
+	defer os.Unsetenv("NODE_NAME")
+
+	cfgFile := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(cfgFile, []byte(`{"node_meta": {"k8s-node": "${NODE_NAME}"}}`), 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	for _, k8s := range []bool{false, true} {
+		ui := cli.NewMockUi()
+		cmd := &AgentCommand{
+			BaseCommand: baseCommand(ui),
+			args: []string{"-data-dir=" + dir, "-bind=1.2.3.4", "-config-file=" + cfgFile,
+				fmt.Sprintf("-kubernetes=%v", k8s)},
+		}
+		conf := cmd.readConfig()
+		if conf == nil {
+			t.Fatalf("should not fail: %s", ui.ErrorWriter.String())
+		}
+		want := "${NODE_NAME}"
+		if k8s {
+			want = "node-1"
+		}
+		if got := conf.Meta["k8s-node"]; got != want {
+			t.Fatalf("kubernetes=%v: got %q want %q", k8s, got, want)
+		}
+	}
+}
+
+func TestReadConfig_localConfigEnv(t *testing.T) {
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+
+	os.Setenv("CONSUL_LOCAL_CONFIG", `node_name = "env" datacenter = "env"`)
+	defer os.Unsetenv("CONSUL_LOCAL_CONFIG")
+
+	cfgFile := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(cfgFile, []byte(`{"node_name": "file", "datacenter": "file", "domain": "file"}`), 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The document overrides the configuration files but not the flags.
+	ui := cli.NewMockUi()
+	cmd := &AgentCommand{
+		BaseCommand: baseCommand(ui),
+		args: []string{"-data-dir=" + dir, "-bind=1.2.3.4", "-config-file=" + cfgFile,
+			"-node=flag"},
+	}
+	conf := cmd.readConfig()
+	if conf == nil {
+		t.Fatalf("should not fail: %s", ui.ErrorWriter.String())
+	}
+	got := []string{conf.NodeName, conf.Datacenter, conf.Domain}
+	want := []string{"flag", "env", "file"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v want %v", got, want)
+	}
+
+	// Invalid documents are rejected.
+	os.Setenv("CONSUL_LOCAL_CONFIG", `{"foo": "bar"}`)
+	ui = cli.NewMockUi()
+	cmd = &AgentCommand{
+		BaseCommand: baseCommand(ui),
+		args:        []string{"-data-dir=" + dir, "-bind=1.2.3.4"},
+	}
+	if conf := cmd.readConfig(); conf != nil {
+		t.Fatalf("should fail")
+	}
+	if got, want := ui.ErrorWriter.String(), "Error decoding 'CONSUL_LOCAL_CONFIG': Config has invalid keys: foo"; !strings.Contains(got, want) {
+		t.Fatalf("got %q want %q", got, want)
+	}
+}
+
+func TestReadConfig_hclFlag(t *testing.T) {
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+
+	cfgFile := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(cfgFile, []byte(`{"node_name": "file", "datacenter": "file", "domain": "file"}`), 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The snippets override the configuration files and each other in
+	// order but not the other flags.
+	ui := cli.NewMockUi()
+	cmd := &AgentCommand{
+		BaseCommand: baseCommand(ui),
+		args: []string{"-data-dir=" + dir, "-bind=1.2.3.4", "-config-file=" + cfgFile,
+			"-hcl", `node_name = "hcl" datacenter = "hcl1"`, "-hcl", `datacenter = "hcl2"`,
+			"-node=flag"},
+	}
+	conf := cmd.readConfig()
+	if conf == nil {
+		t.Fatalf("should not fail: %s", ui.ErrorWriter.String())
+	}
+	got := []string{conf.NodeName, conf.Datacenter, conf.Domain}
+	want := []string{"flag", "hcl2", "file"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v want %v", got, want)
+	}
+
+	// Invalid snippets are rejected.
+	ui = cli.NewMockUi()
+	cmd = &AgentCommand{
+		BaseCommand: baseCommand(ui),
+		args:        []string{"-data-dir=" + dir, "-bind=1.2.3.4", "-hcl", `node_name = "a`},
+	}
+	if conf := cmd.readConfig(); conf != nil {
+		t.Fatalf("should fail")
+	}
+	if got, want := ui.ErrorWriter.String(), "Error decoding '-hcl': "; !strings.Contains(got, want) {
+		t.Fatalf("got %q want %q", got, want)
+	}
+}
+
+func TestReadConfig_variables(t *testing.T) {
+	t.Parallel()
+	dir := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(dir)
+
+	cfgFile := filepath.Join(dir, "config.json")
+	varFile := filepath.Join(dir, "vars.hcl")
+	files := map[string]string{
+		cfgFile: `{"variable": {"dc": {"default": "dc1"}, "rack": {}}, "datacenter": "${var.dc}", "node_meta": {"rack": "${var.rack}"}}`,
+		varFile: `rack = "r1"`,
+	}
+	for path, content := range files {
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	tests := []struct {
+		args []string
+		dc   string
+		rack string
+		err  string
+	}{
+		{args: []string{"-var-file=" + varFile}, dc: "dc1", rack: "r1"},
+		{args: []string{"-var-file=" + varFile, "-var=dc=dc2", "-var=rack=r2"}, dc: "dc2", rack: "r2"},
+		{args: nil, err: "Variables are declared but not set: rack"},
+		{args: []string{"-var=rack"}, err: `Invalid variable "rack", must be of the format name=value`},
+	}
+	for _, tt := range tests {
+		ui := cli.NewMockUi()
+		cmd := &AgentCommand{
+			BaseCommand: baseCommand(ui),
+			args:        append([]string{"-data-dir=" + dir, "-bind=1.2.3.4", "-config-file=" + cfgFile}, tt.args...),
+		}
+		conf := cmd.readConfig()
+		if tt.err != "" {
+			if conf != nil || !strings.Contains(ui.ErrorWriter.String(), tt.err) {
+				t.Fatalf("%v: got %q want %q", tt.args, ui.ErrorWriter.String(), tt.err)
+			}
+			continue
+		}
+		if conf == nil {
+			t.Fatalf("%v: should not fail: %s", tt.args, ui.ErrorWriter.String())
+		}
+		if conf.Datacenter != tt.dc || conf.Meta["rack"] != tt.rack {
+			t.Fatalf("%v: got %q, %q want %q, %q", tt.args, conf.Datacenter, conf.Meta["rack"], tt.dc, tt.rack)
+		}
+	}
+}
@@ -69,6 +69,42 @@ func init() {
 			}, nil
 		},
 
+		"config": func() (cli.Command, error) {
+			return &ConfigCommand{
+				BaseCommand: BaseCommand{
+					Flags: FlagSetNone,
+					UI:    ui,
+				},
+			}, nil
+		},
+
+		"config check": func() (cli.Command, error) {
+			return &ConfigCheckCommand{
+				BaseCommand: BaseCommand{
+					Flags: FlagSetNone,
+					UI:    ui,
+				},
+			}, nil
+		},
+
+		"config migrate": func() (cli.Command, error) {
+			return &ConfigMigrateCommand{
+				BaseCommand: BaseCommand{
+					Flags: FlagSetNone,
+					UI:    ui,
+				},
+			}, nil
+		},
+
+		"config render": func() (cli.Command, error) {
+			return &ConfigRenderCommand{
+				BaseCommand: BaseCommand{
+					Flags: FlagSetNone,
+					UI:    ui,
+				},
+			}, nil
+		},
+
 		"configtest": func() (cli.Command, error) {
 			return &ConfigTestCommand{
 				BaseCommand: BaseCommand{
@@ -0,0 +1,96 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/consul/agent"
+	"github.com/hashicorp/consul/configutil"
+	"github.com/hashicorp/consul/version"
+)
+
+// ConfigCheckCommand is a Command implementation that checks agent
+// configuration files against another agent version.
+type ConfigCheckCommand struct {
+	BaseCommand
+}
+
+func (c *ConfigCheckCommand) Help() string {
+	helpText := `
+Usage: consul config check [options] -target-version=VERSION
+
+  Checks whether the agent configuration files can be used with another
+  agent version before rolling it out. Keys which the target version does
+  not support are reported as errors. Keys which are not set and whose
+  defaults differ on the target version are reported as warnings. The
+  command exits with 1 if any key is not supported.
+
+  The target version can name a series, like 1.x, which stands for its first
+  release.
+
+    $ consul config check -config-dir=/etc/consul.d -target-version=1.x
+
+` + c.BaseCommand.Help()
+
+	return strings.TrimSpace(helpText)
+}
+
+func (c *ConfigCheckCommand) Run(args []string) int {
+	var cfgFiles []string
+	var target string
+	limits := agent.DefaultConfigLimits()
+
+	f := c.BaseCommand.NewFlagSet(c)
+	f.Var((*configutil.AppendSliceValue)(&cfgFiles), "config-file",
+		"Path to a JSON file to read configuration from. This can be specified multiple times.")
+	f.Var((*configutil.AppendSliceValue)(&cfgFiles), "config-dir",
+		"Path to a directory to read configuration files from. This will read every file ending "+
+			"in '.json' as configuration in this directory in alphabetical order. This can be "+
+			"specified multiple times.")
+	addOptionalConfigFileFlag(f, &cfgFiles)
+	recursive := addConfigDirRecursiveFlag(f)
+	f.StringVar(&target, "target-version", "",
+		"Agent version to check the configuration against, e.g. 1.0.0 or 1.x.")
+
+	if err := c.BaseCommand.Parse(args); err != nil {
+		return 1
+	}
+	if len(cfgFiles) == 0 {
+		c.UI.Error("Must specify at least one config file or directory")
+		return 1
+	}
+	if target == "" {
+		c.UI.Error("Missing -target-version")
+		return 1
+	}
+
+	cfgFiles, err := expandConfigDirs(cfgFiles, *recursive)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+	issues, err := agent.CheckConfigCompatibility(cfgFiles, limits, version.Version, target)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	unsupported := 0
+	for _, issue := range issues {
+		if issue.Unsupported {
+			unsupported++
+			c.UI.Error(fmt.Sprintf("%s: %s", issue.Path, issue.Message))
+			continue
+		}
+		c.UI.Warn(fmt.Sprintf("WARNING: %s", issue.Message))
+	}
+	if unsupported > 0 {
+		return 1
+	}
+	c.UI.Output(fmt.Sprintf("Configuration is compatible with %s", target))
+	return 0
+}
+
+func (c *ConfigCheckCommand) Synopsis() string {
+	return "Checks agent configuration files against another version"
+}
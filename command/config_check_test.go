@@ -0,0 +1,59 @@
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/consul/testutil"
+	"github.com/mitchellh/cli"
+)
+
+func testConfigCheckCommand(t *testing.T) (*cli.MockUi, *ConfigCheckCommand) {
+	ui := cli.NewMockUi()
+	return ui, &ConfigCheckCommand{
+		BaseCommand: BaseCommand{
+			UI:    ui,
+			Flags: FlagSetNone,
+		},
+	}
+}
+
+func TestConfigCheckCommand_implements(t *testing.T) {
+	t.Parallel()
+	var _ cli.Command = &ConfigCheckCommand{}
+}
+
+func TestConfigCheckCommand(t *testing.T) {
+	t.Parallel()
+	td := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(td)
+
+	cfgFile := filepath.Join(td, "config.json")
+	if err := ioutil.WriteFile(cfgFile, []byte(`{"autopilot": {"cleanup_dead_servers": true}}`), 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	tests := []struct {
+		args []string
+		code int
+		out  string
+	}{
+		{[]string{"-target-version=1.x"}, 1, "Must specify at least one config file or directory"},
+		{[]string{"-config-file=" + cfgFile}, 1, "Missing -target-version"},
+		{[]string{"-config-file=" + cfgFile, "-target-version=0.7.0"}, 1, "config.json: 'autopilot' is not supported before 0.8.0"},
+		{[]string{"-config-file=" + cfgFile, "-target-version=1.x"}, 0, "'raft_protocol' is not set and defaults to 3 instead of 2 on 1.0.0"},
+	}
+	for _, tt := range tests {
+		ui, cmd := testConfigCheckCommand(t)
+		code := cmd.Run(tt.args)
+		if code != tt.code {
+			t.Fatalf("%v: got code %d want %d: %s", tt.args, code, tt.code, ui.ErrorWriter.String())
+		}
+		if out := ui.OutputWriter.String() + ui.ErrorWriter.String(); !strings.Contains(out, tt.out) {
+			t.Fatalf("%v: got %q want %q", tt.args, out, tt.out)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package command
+
+import (
+	"strings"
+
+	"github.com/mitchellh/cli"
+)
+
+var _ cli.Command = (*ConfigCommand)(nil)
+
+type ConfigCommand struct {
+	BaseCommand
+}
+
+func (c *ConfigCommand) Run(args []string) int {
+	return cli.RunResultHelp
+}
+
+func (c *ConfigCommand) Help() string {
+	helpText := `
+Usage: consul config <subcommand> [options] [args]
+
+  This command has subcommands for working with agent configuration files
+  without starting an agent.
+
+  Check configuration files before upgrading agents:
+
+      $ consul config check -config-dir=/etc/consul.d -target-version=1.x
+
+  Translate a legacy configuration file:
+
+      $ consul config migrate /etc/consul.d/legacy.json
+
+  Render configuration files with their variables set:
+
+      $ consul config render -config-dir=/etc/consul.d -var=dc=east -output=out
+
+  For more examples, ask for subcommand help or view the documentation.
+
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *ConfigCommand) Synopsis() string {
+	return "Work with agent configuration files"
+}
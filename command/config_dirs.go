@@ -0,0 +1,23 @@
+package command
+
+import (
+	"flag"
+
+	"github.com/hashicorp/consul/agent"
+)
+
+// addConfigDirRecursiveFlag adds the -config-dir-recursive flag.
+func addConfigDirRecursiveFlag(f *flag.FlagSet) *bool {
+	return f.Bool("config-dir-recursive", false,
+		"Makes -config-dir also read the files in the subdirectories of the directories, "+
+			"depth first and in alphabetical order.")
+}
+
+// expandConfigDirs returns the configuration paths with the subdirectories
+// of the directories if recursive is set.
+func expandConfigDirs(paths []string, recursive bool) ([]string, error) {
+	if !recursive {
+		return paths, nil
+	}
+	return agent.ExpandConfigDirs(paths)
+}
@@ -0,0 +1,99 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// hclIdent matches the keys which can be written without quotes.
+var hclIdent = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_\-]*$`)
+
+// formatHCL writes the decoded JSON configuration m as HCL. Objects are
+// written as blocks and keys are sorted so that the output is stable.
+func formatHCL(m map[string]interface{}) string {
+	var buf bytes.Buffer
+	writeHCLObject(&buf, m, 0)
+	return buf.String()
+}
+
+func writeHCLObject(buf *bytes.Buffer, m map[string]interface{}, depth int) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	indent := strings.Repeat("  ", depth)
+	for _, k := range keys {
+		v := m[k]
+		if v == nil {
+			continue
+		}
+		key := k
+		if !hclIdent.MatchString(k) {
+			key = strconv.Quote(k)
+		}
+		if obj, ok := v.(map[string]interface{}); ok {
+			fmt.Fprintf(buf, "%s%s {\n", indent, key)
+			writeHCLObject(buf, obj, depth+1)
+			fmt.Fprintf(buf, "%s}\n", indent)
+			continue
+		}
+		fmt.Fprintf(buf, "%s%s = ", indent, key)
+		writeHCLValue(buf, v, depth)
+		buf.WriteString("\n")
+	}
+}
+
+func writeHCLValue(buf *bytes.Buffer, v interface{}, depth int) {
+	indent := strings.Repeat("  ", depth)
+	switch v := v.(type) {
+	case string:
+		buf.WriteString(strconv.Quote(v))
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case float64:
+		buf.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+	case map[string]interface{}:
+		buf.WriteString("{\n")
+		writeHCLObject(buf, v, depth+1)
+		buf.WriteString(indent + "}")
+	case []interface{}:
+		if !hclNested(v) {
+			buf.WriteString("[")
+			for i, e := range v {
+				if i > 0 {
+					buf.WriteString(", ")
+				}
+				writeHCLValue(buf, e, depth)
+			}
+			buf.WriteString("]")
+			return
+		}
+		buf.WriteString("[\n")
+		for _, e := range v {
+			buf.WriteString(indent + "  ")
+			writeHCLValue(buf, e, depth+1)
+			buf.WriteString(",\n")
+		}
+		buf.WriteString(indent + "]")
+	default:
+		buf.WriteString(strconv.Quote(fmt.Sprint(v)))
+	}
+}
+
+// hclNested returns true if the list contains objects or lists and is
+// therefore written with one element per line.
+func hclNested(list []interface{}) bool {
+	for _, e := range list {
+		switch e.(type) {
+		case map[string]interface{}, []interface{}:
+			return true
+		}
+	}
+	return false
+}
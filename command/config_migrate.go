@@ -0,0 +1,170 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/consul/agent"
+)
+
+// ConfigMigrateCommand is a Command implementation that translates legacy
+// agent configuration files.
+type ConfigMigrateCommand struct {
+	BaseCommand
+}
+
+func (c *ConfigMigrateCommand) Help() string {
+	helpText := `
+Usage: consul config migrate [options] FILE_OR_DIR...
+
+  Reads agent configuration files and writes the equivalent configuration
+  without legacy keys. Keys which were renamed, like "recursor" or
+  "retry_join_ec2", are translated to their replacements. Keys which have no
+  equivalent anymore, like "ports.rpc" or the Atlas settings, are removed.
+  Deprecated forms of values, like a single string in place of a list, are
+  rewritten. Every translated or removed key is reported on stderr, as is
+  every file which the agent would still reject, e.g. because of unknown
+  keys. The files of a directory are read like with -config-dir.
+
+  A single file is written to stdout. To translate the file "legacy.json"
+  to HCL:
+
+    $ consul config migrate legacy.json > consul.hcl
+
+  Several files are written to a directory, each to a file with the name
+  of the source file and the extension of the output format:
+
+    $ consul config migrate -output-dir=/etc/consul.d.new /etc/consul.d
+
+` + c.BaseCommand.Help()
+
+	return strings.TrimSpace(helpText)
+}
+
+func (c *ConfigMigrateCommand) Run(args []string) int {
+	var format, outputDir string
+
+	f := c.BaseCommand.NewFlagSet(c)
+	f.StringVar(&format, "format", "hcl",
+		"Output format of the translated configuration. Must be \"hcl\" or \"json\".")
+	f.StringVar(&outputDir, "output-dir", "",
+		"Directory to write the translated files to instead of stdout. It is created if "+
+			"it does not exist. Required for more than one file.")
+
+	if err := c.BaseCommand.Parse(args); err != nil {
+		return 1
+	}
+	if format != "hcl" && format != "json" {
+		c.UI.Error(fmt.Sprintf("Invalid format %q, must be \"hcl\" or \"json\"", format))
+		return 1
+	}
+	paths := f.Args()
+	if len(paths) == 0 {
+		c.UI.Error("Missing FILE_OR_DIR argument")
+		return 1
+	}
+
+	files, err := agent.MigrateConfigFiles(paths, agent.DefaultConfigLimits())
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+	if len(files) > 1 && outputDir == "" {
+		c.UI.Error(fmt.Sprintf("Found %d configuration files, -output-dir is required "+
+			"for more than one file", len(files)))
+		return 1
+	}
+
+	// The names of the output files must not collide, like for a.json and
+	// a.hcl, or replace the source files.
+	outputs := make(map[string]string)
+	if outputDir != "" {
+		written := make(map[string]string)
+		sources := make(map[string]bool)
+		for _, m := range files {
+			if abs, err := filepath.Abs(m.Path); err == nil {
+				sources[abs] = true
+			}
+		}
+		for _, m := range files {
+			name := strings.TrimSuffix(filepath.Base(m.Path), filepath.Ext(m.Path)) + "." + format
+			out := filepath.Join(outputDir, name)
+			if src, ok := written[out]; ok {
+				c.UI.Error(fmt.Sprintf("Both '%s' and '%s' would be written to '%s'", src, m.Path, out))
+				return 1
+			}
+			if abs, err := filepath.Abs(out); err == nil && sources[abs] {
+				c.UI.Error(fmt.Sprintf("Writing '%s' would replace a source file, use another -output-dir", out))
+				return 1
+			}
+			outputs[m.Path] = out
+			written[out] = m.Path
+		}
+		if err := os.MkdirAll(outputDir, 0755); err != nil {
+			c.UI.Error(fmt.Sprintf("Error creating '%s': %s", outputDir, err))
+			return 1
+		}
+	}
+
+	failed := 0
+	for _, m := range files {
+		// The messages name the file if there are several.
+		prefix := ""
+		if len(files) > 1 {
+			prefix = fmt.Sprintf("'%s': ", m.Path)
+		}
+		for _, change := range m.Changes {
+			if change.NewKey == "" {
+				c.UI.Warn(fmt.Sprintf("WARNING: %s'%s' has no equivalent and was removed", prefix, change.Key))
+				continue
+			}
+			c.UI.Warn(fmt.Sprintf("%sTranslated '%s' to '%s'", prefix, change.Key, change.NewKey))
+		}
+		for _, key := range m.Rewritten {
+			c.UI.Warn(fmt.Sprintf("%sRewrote the value of '%s' to the current form", prefix, key))
+		}
+		if m.Err != nil {
+			c.UI.Error(fmt.Sprintf("Could not translate '%s': %s", m.Path, m.Err))
+			failed++
+			continue
+		}
+
+		out, err := encodeMigratedConfig(m.Raw, format)
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Error encoding '%s': %s", m.Path, err))
+			return 1
+		}
+		if outputDir == "" {
+			c.UI.Output(out)
+			continue
+		}
+		if err := ioutil.WriteFile(outputs[m.Path], []byte(out+"\n"), 0600); err != nil {
+			c.UI.Error(fmt.Sprintf("Error writing '%s': %s", outputs[m.Path], err))
+			return 1
+		}
+		c.UI.Output(fmt.Sprintf("Wrote '%s'", outputs[m.Path]))
+	}
+	if failed > 0 {
+		c.UI.Error(fmt.Sprintf("%d of %d configuration files could not be translated", failed, len(files)))
+		return 1
+	}
+	return 0
+}
+
+// encodeMigratedConfig encodes the translated configuration document raw
+// in the given output format.
+func encodeMigratedConfig(raw map[string]interface{}, format string) (string, error) {
+	if format == "json" {
+		out, err := json.MarshalIndent(raw, "", "  ")
+		return string(out), err
+	}
+	return strings.TrimSuffix(formatHCL(raw), "\n"), nil
+}
+
+func (c *ConfigMigrateCommand) Synopsis() string {
+	return "Translates legacy agent configuration files"
+}
@@ -0,0 +1,184 @@
+package command
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/consul/testutil"
+	"github.com/hashicorp/hcl"
+	"github.com/mitchellh/cli"
+)
+
+func testConfigMigrateCommand(t *testing.T) (*cli.MockUi, *ConfigMigrateCommand) {
+	ui := cli.NewMockUi()
+	return ui, &ConfigMigrateCommand{
+		BaseCommand: BaseCommand{
+			UI:    ui,
+			Flags: FlagSetNone,
+		},
+	}
+}
+
+func TestConfigMigrateCommand_implements(t *testing.T) {
+	t.Parallel()
+	var _ cli.Command = &ConfigMigrateCommand{}
+}
+
+func TestConfigMigrateCommand_BadArgs(t *testing.T) {
+	t.Parallel()
+	for _, args := range [][]string{
+		{},
+		{"a.json", "b.json"},
+		{"-format=yaml", "a.json"},
+		{"does-not-exist.json"},
+	} {
+		ui, cmd := testConfigMigrateCommand(t)
+		if code := cmd.Run(args); code != 1 {
+			t.Fatalf("%v: got code %d want 1: %s", args, code, ui.ErrorWriter.String())
+		}
+	}
+}
+
+func TestConfigMigrateCommand(t *testing.T) {
+	t.Parallel()
+	td := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(td)
+
+	cfgFile := filepath.Join(td, "legacy.json")
+	legacy := `{
+		"datacenter": "dc1",
+		"ports": {"rpc": 8400, "http": 8500},
+		"atlas_infrastructure": "hashicorp/prod",
+		"retry_join_ec2": {"region": "us-east-1", "tag_key": "consul", "tag_value": "server"},
+		"node_meta": {"rack id": "a-1"},
+		"services": [{"name": "web", "tags": ["a", "b"], "port": 80}]
+	}`
+	if err := ioutil.WriteFile(cfgFile, []byte(legacy), 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	ui, cmd := testConfigMigrateCommand(t)
+	if code := cmd.Run([]string{cfgFile}); code != 0 {
+		t.Fatalf("bad: %d, %s", code, ui.ErrorWriter.String())
+	}
+
+	out := ui.OutputWriter.String()
+	var raw map[string]interface{}
+	if err := hcl.Decode(&raw, out); err != nil {
+		t.Fatalf("output is not valid HCL: %s\n%s", err, out)
+	}
+	for _, want := range []string{
+		`datacenter = "dc1"`,
+		`retry_join = ["provider=aws region=us-east-1 tag_key=consul tag_value=server"]`,
+		`"rack id" = "a-1"`,
+		`http = 8500`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("output does not contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "rpc") || strings.Contains(out, "atlas") {
+		t.Fatalf("output contains legacy keys:\n%s", out)
+	}
+
+	errOut := ui.ErrorWriter.String()
+	for _, want := range []string{
+		"'atlas_infrastructure' has no equivalent and was removed",
+		"'ports.rpc' has no equivalent and was removed",
+		"Translated 'retry_join_ec2' to 'retry_join'",
+	} {
+		if !strings.Contains(errOut, want) {
+			t.Fatalf("stderr does not contain %q:\n%s", want, errOut)
+		}
+	}
+
+	// The JSON output can be read by the agent directly.
+	ui, cmd = testConfigMigrateCommand(t)
+	if code := cmd.Run([]string{"-format=json", cfgFile}); code != 0 {
+		t.Fatalf("bad: %d, %s", code, ui.ErrorWriter.String())
+	}
+	var migrated map[string]interface{}
+	if err := json.Unmarshal([]byte(ui.OutputWriter.String()), &migrated); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, ok := migrated["retry_join"]; !ok {
+		t.Fatalf("bad: %v", migrated)
+	}
+}
+
+func TestConfigMigrateCommand_outputDir(t *testing.T) {
+	t.Parallel()
+	td := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(td)
+
+	src := filepath.Join(td, "src")
+	if err := os.Mkdir(src, 0700); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	for name, data := range map[string]string{
+		"a.json": `{"recursor": "8.8.8.8"}`,
+		"b.hcl":  `ports { rpc = 8400 }`,
+		"c.json": `{"node_nmae": "web"}`,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(src, name), []byte(data), 0600); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	// Several files need an output directory.
+	ui, cmd := testConfigMigrateCommand(t)
+	if code := cmd.Run([]string{src}); code != 1 || !strings.Contains(ui.ErrorWriter.String(), "-output-dir is required") {
+		t.Fatalf("got code %d: %s", code, ui.ErrorWriter.String())
+	}
+
+	// The output files must not replace the sources.
+	ui, cmd = testConfigMigrateCommand(t)
+	if code := cmd.Run([]string{"-output-dir=" + src, src}); code != 1 || !strings.Contains(ui.ErrorWriter.String(), "would replace a source file") {
+		t.Fatalf("got code %d: %s", code, ui.ErrorWriter.String())
+	}
+
+	// The files which can be translated are written and the others are
+	// reported.
+	out := filepath.Join(td, "out")
+	ui, cmd = testConfigMigrateCommand(t)
+	if code := cmd.Run([]string{"-output-dir=" + out, src}); code != 1 {
+		t.Fatalf("got code %d want 1: %s", code, ui.ErrorWriter.String())
+	}
+	errOut := ui.ErrorWriter.String()
+	for _, want := range []string{
+		"'" + filepath.Join(src, "a.json") + "': Translated 'recursor' to 'recursors'",
+		"'" + filepath.Join(src, "b.hcl") + "': 'ports.rpc' has no equivalent and was removed",
+		"Could not translate '" + filepath.Join(src, "c.json") + "'",
+		"1 of 3 configuration files could not be translated",
+	} {
+		if !strings.Contains(errOut, want) {
+			t.Fatalf("stderr does not contain %q:\n%s", want, errOut)
+		}
+	}
+	a, err := ioutil.ReadFile(filepath.Join(out, "a.hcl"))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !strings.Contains(string(a), `recursors = ["8.8.8.8"]`) {
+		t.Fatalf("bad: %s", a)
+	}
+	if _, err := os.Stat(filepath.Join(out, "b.hcl")); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(out, "c.hcl")); !os.IsNotExist(err) {
+		t.Fatalf("got %v want c.hcl not to be written", err)
+	}
+
+	// Files with the same name collide.
+	if err := ioutil.WriteFile(filepath.Join(src, "a.hcl"), []byte(`datacenter = "dc1"`), 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	ui, cmd = testConfigMigrateCommand(t)
+	if code := cmd.Run([]string{"-output-dir=" + out, src}); code != 1 || !strings.Contains(ui.ErrorWriter.String(), "would be written to") {
+		t.Fatalf("got code %d: %s", code, ui.ErrorWriter.String())
+	}
+}
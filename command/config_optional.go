@@ -0,0 +1,46 @@
+package command
+
+import (
+	"flag"
+	"os"
+)
+
+// optionalConfigFiles implements the -config-file-optional flag. Files
+// which exist are appended to the configuration paths, in order with the
+// -config-file and -config-dir flags, and files which do not exist are
+// recorded in missing instead of failing the read.
+type optionalConfigFiles struct {
+	paths   *[]string
+	missing []string
+}
+
+// addOptionalConfigFileFlag adds the -config-file-optional flag which
+// appends to paths.
+func addOptionalConfigFileFlag(f *flag.FlagSet, paths *[]string) *optionalConfigFiles {
+	v := &optionalConfigFiles{paths: paths}
+	f.Var(v, "config-file-optional",
+		"Path to a JSON file to read configuration from if it exists. This can be specified "+
+			"multiple times.")
+	return v
+}
+
+func (v *optionalConfigFiles) String() string {
+	return ""
+}
+
+func (v *optionalConfigFiles) Set(path string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		v.missing = append(v.missing, path)
+		return nil
+	}
+	*v.paths = append(*v.paths, path)
+	return nil
+}
+
+// logMissingConfigFiles logs the optional configuration files which did
+// not exist when the configuration was last read.
+func (cmd *AgentCommand) logMissingConfigFiles() {
+	for _, path := range cmd.configMissing {
+		cmd.logger.Printf("[DEBUG] agent: Skipping optional configuration file '%s' which does not exist", path)
+	}
+}
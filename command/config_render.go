@@ -0,0 +1,160 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/consul/agent"
+	"github.com/hashicorp/consul/configutil"
+)
+
+// ConfigRenderCommand is a Command implementation that writes agent
+// configuration files with all variables interpolated.
+type ConfigRenderCommand struct {
+	BaseCommand
+}
+
+func (c *ConfigRenderCommand) Help() string {
+	helpText := `
+Usage: consul config render [options] -output=DIR
+
+  Reads the agent configuration files like the agent does, interpolates the
+  variables set by -env-file, -var and -var-file into them and writes the
+  rendered files to the output directory without starting an agent. The
+  rendered files no longer declare variables and legacy keys are translated
+  to their replacements. Every file is validated before anything is written.
+
+  To render the files of a configuration directory for the "east"
+  datacenter:
+
+    $ consul config render -config-dir=/etc/consul.d -var=dc=east \
+        -output=rendered
+
+  To write a single file with the merged configuration instead:
+
+    $ consul config render -config-dir=/etc/consul.d -var=dc=east \
+        -output=rendered -merge
+
+` + c.BaseCommand.Help()
+
+	return strings.TrimSpace(helpText)
+}
+
+func (c *ConfigRenderCommand) Run(args []string) int {
+	var cfgFiles []string
+	var varFlags configVarFlags
+	var output string
+	var merge bool
+	limits := agent.DefaultConfigLimits()
+
+	f := c.BaseCommand.NewFlagSet(c)
+	f.Var((*configutil.AppendSliceValue)(&cfgFiles), "config-file",
+		"Path to a JSON file to read configuration from. This can be specified multiple times.")
+	f.Var((*configutil.AppendSliceValue)(&cfgFiles), "config-dir",
+		"Path to a directory to read configuration files from. This will read every file ending "+
+			"in '.json' as configuration in this directory in alphabetical order. This can be "+
+			"specified multiple times.")
+	addOptionalConfigFileFlag(f, &cfgFiles)
+	recursive := addConfigDirRecursiveFlag(f)
+	varFlags.addFlags(f)
+	f.StringVar(&output, "output", "",
+		"Directory to write the rendered configuration files to. It is created if it does "+
+			"not exist.")
+	f.BoolVar(&merge, "merge", false,
+		"Writes the merged configuration of all files to a single file named config.json "+
+			"instead of rendering every file.")
+
+	if err := c.BaseCommand.Parse(args); err != nil {
+		return 1
+	}
+	if len(cfgFiles) == 0 {
+		c.UI.Error("Must specify at least one config file or directory")
+		return 1
+	}
+	if output == "" {
+		c.UI.Error("Missing -output directory")
+		return 1
+	}
+	if len(f.Args()) > 0 {
+		c.UI.Error(fmt.Sprintf("Too many arguments (expected 0, got %d)", len(f.Args())))
+		return 1
+	}
+
+	cfgFiles, err := expandConfigDirs(cfgFiles, *recursive)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+	vars, _, err := varFlags.vars(nil, cfgFiles, "", limits)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+	files, err := agent.RenderConfigFiles(cfgFiles, limits, vars)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	// Collect the output files first so that nothing is written if the
+	// files cannot be rendered.
+	out := make(map[string]map[string]interface{})
+	var names []string
+	if merge {
+		merged, err := agent.MergeRenderedConfigFiles(files)
+		if err != nil {
+			c.UI.Error(err.Error())
+			return 1
+		}
+		out["config.json"] = merged
+		names = append(names, "config.json")
+	} else {
+		sources := make(map[string]string)
+		for _, file := range files {
+			name := filepath.Base(file.Path)
+			if src, ok := sources[name]; ok {
+				c.UI.Error(fmt.Sprintf("Files '%s' and '%s' would both be rendered to '%s'", src, file.Path, name))
+				return 1
+			}
+			sources[name] = file.Path
+			out[name] = file.Raw
+			names = append(names, name)
+		}
+
+		// The agent reads the files of the output directory in
+		// alphabetical order, which must be the order they were merged in.
+		if !sort.StringsAreSorted(names) {
+			c.UI.Error("The rendered files would be read in a different order than the " +
+				"source files. Use -merge to render them into a single file instead.")
+			return 1
+		}
+	}
+
+	if err := os.MkdirAll(output, 0755); err != nil {
+		c.UI.Error(fmt.Sprintf("Error creating '%s': %s", output, err))
+		return 1
+	}
+	for _, name := range names {
+		data, err := json.MarshalIndent(out[name], "", "  ")
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Error encoding '%s': %s", name, err))
+			return 1
+		}
+		path := filepath.Join(output, name)
+		if err := ioutil.WriteFile(path, append(data, '\n'), 0600); err != nil {
+			c.UI.Error(fmt.Sprintf("Error writing '%s': %s", path, err))
+			return 1
+		}
+		c.UI.Output(fmt.Sprintf("Rendered '%s'", path))
+	}
+	return 0
+}
+
+func (c *ConfigRenderCommand) Synopsis() string {
+	return "Renders agent configuration files with their variables"
+}
@@ -0,0 +1,120 @@
+package command
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/consul/testutil"
+	"github.com/mitchellh/cli"
+	"github.com/pascaldekloe/goe/verify"
+)
+
+func testConfigRenderCommand(t *testing.T) (*cli.MockUi, *ConfigRenderCommand) {
+	ui := cli.NewMockUi()
+	return ui, &ConfigRenderCommand{
+		BaseCommand: BaseCommand{
+			UI:    ui,
+			Flags: FlagSetNone,
+		},
+	}
+}
+
+func TestConfigRenderCommand_implements(t *testing.T) {
+	t.Parallel()
+	var _ cli.Command = &ConfigRenderCommand{}
+}
+
+func TestConfigRenderCommand_BadArgs(t *testing.T) {
+	t.Parallel()
+	for _, args := range [][]string{
+		{},
+		{"-config-file=a.json"},
+		{"-output=out"},
+		{"-config-file=does-not-exist.json", "-output=out"},
+	} {
+		ui, cmd := testConfigRenderCommand(t)
+		if code := cmd.Run(args); code != 1 {
+			t.Fatalf("%v: got code %d want 1: %s", args, code, ui.ErrorWriter.String())
+		}
+	}
+}
+
+func TestConfigRenderCommand(t *testing.T) {
+	t.Parallel()
+	td := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(td)
+
+	cfgDir := filepath.Join(td, "config")
+	if err := os.Mkdir(cfgDir, 0755); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	files := map[string]string{
+		"a.json": `{"variable": {"dc": {"default": "dc1"}}, "datacenter": "${var.dc}", "node_meta": {"a": "1"}}`,
+		"b.json": `{"node_meta": {"b": "${var.dc}"}, "service": {"name": "web"}, "recursor": "8.8.8.8"}`,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(cfgDir, name), []byte(content), 0600); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	read := func(path string) map[string]interface{} {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		var raw map[string]interface{}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		return raw
+	}
+
+	t.Run("files", func(t *testing.T) {
+		out := filepath.Join(td, "files")
+		ui, cmd := testConfigRenderCommand(t)
+		if code := cmd.Run([]string{"-config-dir=" + cfgDir, "-var=dc=east", "-output=" + out}); code != 0 {
+			t.Fatalf("got code %d: %s", code, ui.ErrorWriter.String())
+		}
+		verify.Values(t, "a.json", read(filepath.Join(out, "a.json")), map[string]interface{}{
+			"datacenter": "east",
+			"node_meta":  map[string]interface{}{"a": "1"},
+		})
+		verify.Values(t, "b.json", read(filepath.Join(out, "b.json")), map[string]interface{}{
+			"node_meta": map[string]interface{}{"b": "east"},
+			"service":   map[string]interface{}{"name": "web"},
+			"recursors": []interface{}{"8.8.8.8"},
+		})
+	})
+
+	t.Run("merge", func(t *testing.T) {
+		out := filepath.Join(td, "merged")
+		ui, cmd := testConfigRenderCommand(t)
+		if code := cmd.Run([]string{"-config-dir=" + cfgDir, "-output=" + out, "-merge"}); code != 0 {
+			t.Fatalf("got code %d: %s", code, ui.ErrorWriter.String())
+		}
+		verify.Values(t, "config.json", read(filepath.Join(out, "config.json")), map[string]interface{}{
+			"datacenter": "dc1",
+			"node_meta":  map[string]interface{}{"a": "1", "b": "dc1"},
+			"services":   []interface{}{map[string]interface{}{"name": "web"}},
+			"recursors":  []interface{}{"8.8.8.8"},
+		})
+	})
+
+	t.Run("undeclared", func(t *testing.T) {
+		out := filepath.Join(td, "undeclared")
+		ui, cmd := testConfigRenderCommand(t)
+		if code := cmd.Run([]string{"-config-dir=" + cfgDir, "-var=rack=r1", "-output=" + out}); code != 1 {
+			t.Fatalf("got code %d want 1", code)
+		}
+		if got, want := ui.ErrorWriter.String(), "Variables are set but not declared: rack\n"; got != want {
+			t.Fatalf("got %q want %q", got, want)
+		}
+		if _, err := os.Stat(out); !os.IsNotExist(err) {
+			t.Fatalf("should not create the output directory: %v", err)
+		}
+	})
+}
@@ -0,0 +1,19 @@
+package command
+
+import (
+	"flag"
+)
+
+// addConfigStrictFlag adds the -config-strict flag.
+func addConfigStrictFlag(f *flag.FlagSet) *bool {
+	return f.Bool("config-strict", false,
+		"Rejects unknown keys of the service and check definitions in the configuration "+
+			"files, which are ignored otherwise.")
+}
+
+// addConfigFunctionsFlag adds the -disable-config-functions flag.
+func addConfigFunctionsFlag(f *flag.FlagSet) *bool {
+	return f.Bool("disable-config-functions", false,
+		"Leaves the function calls like ${env \"NAME\"} and ${file \"path\"} in the "+
+			"configuration values unevaluated.")
+}
@@ -0,0 +1,88 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/consul/agent"
+	"github.com/hashicorp/consul/configutil"
+)
+
+// configVarFlags are the flags which set the variables interpolated into
+// the configuration files.
+type configVarFlags struct {
+	envFile   string
+	varFiles  []string
+	varValues []string
+}
+
+func (v *configVarFlags) addFlags(f *flag.FlagSet) {
+	f.StringVar(&v.envFile, "env-file", "",
+		"Path to a file with KEY=VALUE lines. The values can be referenced as ${KEY} in "+
+			"configuration files and CONSUL_<KEY> entries override configuration keys.")
+	f.Var((*configutil.AppendSliceValue)(&v.varValues), "var",
+		"Sets a variable declared in the configuration files, of the format `name=value`. "+
+			"The value can be referenced as ${var.name}. Can be specified multiple times.")
+	f.Var((*configutil.AppendSliceValue)(&v.varFiles), "var-file",
+		"Path to a file which sets variables declared in the configuration files with "+
+			"name = \"value\" lines. Can be specified multiple times.")
+}
+
+// vars returns the variables interpolated into the configuration files at
+// paths and the CONSUL_LOCAL_CONFIG document, and the entries of the env
+// file. The variables of the env file take precedence over the base
+// variables. The variables declared in the configuration are set by the
+// -var-file and -var flags, with the later ones taking precedence.
+func (v *configVarFlags) vars(base map[string]string, paths []string, localConfig string, limits agent.ConfigLimits) (vars, env map[string]string, err error) {
+	vars = make(map[string]string, len(base))
+	for k, val := range base {
+		vars[k] = val
+	}
+	if v.envFile != "" {
+		if env, err = agent.ReadEnvFile(v.envFile); err != nil {
+			return nil, nil, err
+		}
+		for k, val := range env {
+			vars[k] = val
+		}
+	}
+
+	decls, err := agent.ReadConfigVariables(paths, limits)
+	if err != nil {
+		return nil, nil, err
+	}
+	if localConfig != "" {
+		if err := agent.LocalConfigVariables(localConfig, decls); err != nil {
+			return nil, nil, err
+		}
+	}
+	values := make(map[string]string)
+	for _, path := range v.varFiles {
+		fileValues, err := agent.ReadVarFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		for k, val := range fileValues {
+			values[k] = val
+		}
+	}
+	for _, kv := range v.varValues {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			return nil, nil, fmt.Errorf("Invalid variable %q, must be of the format name=value", kv)
+		}
+		values[parts[0]] = parts[1]
+	}
+	configVars, err := agent.ResolveConfigVariables(decls, values)
+	if err != nil {
+		return nil, nil, err
+	}
+	for k, val := range configVars {
+		vars[k] = val
+	}
+	if len(vars) == 0 {
+		vars = nil
+	}
+	return vars, env, nil
+}
@@ -0,0 +1,71 @@
+package command
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+
+	"github.com/hashicorp/consul/agent"
+)
+
+// printConfigFormat is the value of the -print-config flag, "json" or
+// "hcl". It can be given without a value, which selects the JSON format.
+type printConfigFormat string
+
+func (f *printConfigFormat) String() string {
+	return string(*f)
+}
+
+func (f *printConfigFormat) Set(v string) error {
+	switch v {
+	case "true", "json":
+		*f = "json"
+	case "hcl":
+		*f = "hcl"
+	case "false":
+		*f = ""
+	default:
+		return fmt.Errorf("unknown format %q, must be json or hcl", v)
+	}
+	return nil
+}
+
+// IsBoolFlag allows the flag to be given without a value.
+func (f *printConfigFormat) IsBoolFlag() bool {
+	return true
+}
+
+// addPrintConfigFlag adds the -print-config flag.
+func addPrintConfigFlag(f *flag.FlagSet) *printConfigFormat {
+	var format printConfigFormat
+	f.Var(&format, "print-config",
+		"Prints the configuration merged from the configuration files, the environment "+
+			"and the command line flags with its secrets hidden and exits instead of "+
+			"starting the agent.")
+	return &format
+}
+
+// formatConfig returns the sanitized configuration in the format.
+func formatConfig(cfg *agent.Config, format printConfigFormat) (string, error) {
+	switch format {
+	case "json":
+		b, err := json.MarshalIndent(cfg.Sanitized(), "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	case "hcl":
+		// The HCL document holds the same keys as the JSON one.
+		b, err := json.Marshal(cfg.Sanitized())
+		if err != nil {
+			return "", err
+		}
+		var raw map[string]interface{}
+		if err := json.Unmarshal(b, &raw); err != nil {
+			return "", err
+		}
+		return encodeMigratedConfig(raw, "hcl")
+	default:
+		return "", fmt.Errorf("unknown format %q", format)
+	}
+}
@@ -0,0 +1,63 @@
+package command
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl"
+	"github.com/mitchellh/cli"
+)
+
+func TestAgentCommand_PrintConfig(t *testing.T) {
+	t.Parallel()
+	ui := cli.NewMockUi()
+	cmd := &AgentCommand{BaseCommand: baseCommand(ui)}
+	args := []string{"-dev", "-print-config", "-node", "a"}
+	if code := cmd.Run(args); code != 0 {
+		t.Fatalf("bad: %d: %s", code, ui.ErrorWriter.String())
+	}
+
+	var cfg struct {
+		NodeName string
+	}
+	if err := json.Unmarshal([]byte(ui.OutputWriter.String()), &cfg); err != nil {
+		t.Fatalf("err: %s: %s", err, ui.OutputWriter.String())
+	}
+	if cfg.NodeName != "a" {
+		t.Fatalf("got node name %q want %q", cfg.NodeName, "a")
+	}
+}
+
+func TestAgentCommand_PrintConfigFormat(t *testing.T) {
+	t.Parallel()
+	ui := cli.NewMockUi()
+	cmd := &AgentCommand{BaseCommand: baseCommand(ui)}
+	args := []string{"-dev", "-print-config=hcl", "-node", "a", "-http-port", "8123"}
+	if code := cmd.Run(args); code != 0 {
+		t.Fatalf("bad: %d: %s", code, ui.ErrorWriter.String())
+	}
+	out := ui.OutputWriter.String()
+	var cfg struct {
+		NodeName string
+		Ports    struct {
+			HTTP int
+		}
+	}
+	if err := hcl.Decode(&cfg, out); err != nil {
+		t.Fatalf("err: %s: %s", err, out)
+	}
+	if cfg.NodeName != "a" || cfg.Ports.HTTP != 8123 {
+		t.Fatalf("got node name %q and HTTP port %d: %s", cfg.NodeName, cfg.Ports.HTTP, out)
+	}
+
+	var f printConfigFormat
+	if err := f.Set("yaml"); err == nil || !strings.Contains(err.Error(), "must be json or hcl") {
+		t.Fatalf("bad: %v", err)
+	}
+	for v, want := range map[string]printConfigFormat{"true": "json", "json": "json", "hcl": "hcl", "false": ""} {
+		if err := f.Set(v); err != nil || f != want {
+			t.Fatalf("%s: got %q, %v", v, f, err)
+		}
+	}
+}
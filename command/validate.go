@@ -6,6 +6,7 @@ import (
 
 	"github.com/hashicorp/consul/agent"
 	"github.com/hashicorp/consul/configutil"
+	multierror "github.com/hashicorp/go-multierror"
 )
 
 // ValidateCommand is a Command implementation that is used to
@@ -24,7 +25,8 @@ Usage: consul validate [options] FILE_OR_DIRECTORY...
   This is useful to do a test of the configuration only, without actually
   starting the agent.
 
-  Returns 0 if the configuration is valid, or 1 if there are problems.
+  All errors and warnings are reported. Returns 0 if the configuration is
+  valid, or 1 if there are problems.
 
 ` + c.BaseCommand.Help()
 
@@ -34,16 +36,28 @@ Usage: consul validate [options] FILE_OR_DIRECTORY...
 func (c *ValidateCommand) Run(args []string) int {
 	var configFiles []string
 	var quiet bool
+	var showSources bool
+	var failOnWarnings bool
 
 	f := c.BaseCommand.NewFlagSet(c)
 	f.Var((*configutil.AppendSliceValue)(&configFiles), "config-file",
 		"Path to a JSON file to read configuration from. This can be specified multiple times.")
 	f.Var((*configutil.AppendSliceValue)(&configFiles), "config-dir",
-		"Path to a directory to read configuration files from. This will read every file ending in "+
-			".json as configuration in this directory in alphabetical order.")
+		"Path to a directory or a glob pattern of directories and files to read configuration "+
+			"files from. This will read every file ending in .json, .yaml, .yml or .hcl as "+
+			"configuration in this directory in alphabetical order.")
+	addOptionalConfigFileFlag(f, &configFiles)
+	recursive := addConfigDirRecursiveFlag(f)
+	strictKeys := addConfigStrictFlag(f)
+	disableFuncs := addConfigFunctionsFlag(f)
 	f.BoolVar(&quiet, "quiet", false,
 		"When given, a successful run will produce no output.")
-	c.BaseCommand.HideFlags("config-file", "config-dir")
+	f.BoolVar(&showSources, "show-sources", false,
+		"Prints the configuration files in load order and the file which set each "+
+			"configuration key.")
+	f.BoolVar(&failOnWarnings, "fail-on-warnings", false,
+		"When given, warnings about the configuration fail the validation.")
+	c.BaseCommand.HideFlags("config-file", "config-dir", "config-file-optional", "config-dir-recursive")
 
 	if err := c.BaseCommand.Parse(args); err != nil {
 		return 1
@@ -58,11 +72,47 @@ func (c *ValidateCommand) Run(args []string) int {
 		return 1
 	}
 
-	_, err := agent.ReadConfigPaths(configFiles)
+	configFiles, err := expandConfigDirs(configFiles, *recursive)
 	if err != nil {
 		c.UI.Error(fmt.Sprintf("Config validation failed: %v", err.Error()))
 		return 1
 	}
+	builder := &agent.ConfigBuilder{
+		Paths:            configFiles,
+		Limits:           agent.DefaultConfigLimits(),
+		StrictKeys:       *strictKeys,
+		DisableFunctions: *disableFuncs,
+	}
+	_, warnings, err := builder.Build()
+	for _, w := range warnings {
+		c.UI.Warn("WARNING: " + w)
+	}
+	if err != nil {
+		prov := builder.Provenance()
+		if merr, ok := err.(*multierror.Error); ok {
+			c.UI.Error(fmt.Sprintf("Config validation failed with %d errors:", len(merr.Errors)))
+			for _, err := range merr.Errors {
+				c.UI.Error("  * " + describeConfigError(err, prov))
+			}
+		} else {
+			c.UI.Error(fmt.Sprintf("Config validation failed: %v", describeConfigError(err, prov)))
+		}
+		return 1
+	}
+	if failOnWarnings && len(warnings) > 0 {
+		c.UI.Error(fmt.Sprintf("Config validation failed: %d warnings", len(warnings)))
+		return 1
+	}
+	if showSources {
+		c.UI.Output("Load order:")
+		for i, path := range builder.LoadOrder() {
+			c.UI.Output(fmt.Sprintf("  %d. %s", i+1, path))
+		}
+		prov := builder.Provenance()
+		for _, key := range prov.Keys() {
+			c.UI.Output(fmt.Sprintf("%s: %s", key, prov.Source(key)))
+		}
+	}
 
 	if !quiet {
 		c.UI.Output("Configuration is valid!")
@@ -70,6 +120,25 @@ func (c *ValidateCommand) Run(args []string) int {
 	return 0
 }
 
+// describeConfigError adds the configuration files which set the keys of
+// a *agent.ConfigError to its message.
+func describeConfigError(err error, prov agent.Provenance) string {
+	ce, ok := err.(*agent.ConfigError)
+	if !ok || len(ce.Keys) == 0 {
+		return err.Error()
+	}
+	var srcs []string
+	for _, key := range ce.Keys {
+		if src := prov.Source(key); src != "" {
+			srcs = append(srcs, fmt.Sprintf("%s set by '%s'", key, src))
+		}
+	}
+	if len(srcs) == 0 {
+		return ce.Message
+	}
+	return fmt.Sprintf("%s (%s)", ce.Message, strings.Join(srcs, ", "))
+}
+
 func (c *ValidateCommand) Synopsis() string {
 	return "Validate config files/directories"
 }
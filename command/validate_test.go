@@ -4,6 +4,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/consul/testutil"
@@ -127,3 +128,133 @@ func TestValidateCommandQuiet(t *testing.T) {
 		t.Fatalf("bad: %v", ui.OutputWriter.String())
 	}
 }
+
+func TestValidateCommandFailOnConflictingSettings(t *testing.T) {
+	t.Parallel()
+	td := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(td)
+
+	fp := filepath.Join(td, "config.json")
+	err := ioutil.WriteFile(fp, []byte(`{"bootstrap": true}`), 0644)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	ui, cmd := testValidateCommand(t)
+
+	args := []string{fp}
+
+	if code := cmd.Run(args); code != 1 {
+		t.Fatalf("bad: %d", code)
+	}
+	if out := ui.ErrorWriter.String(); !strings.Contains(out, "Bootstrap mode cannot be enabled when server mode is not enabled") {
+		t.Fatalf("bad: %s", out)
+	}
+}
+
+func TestValidateCommandConfigStrict(t *testing.T) {
+	t.Parallel()
+	td := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(td)
+
+	fp := filepath.Join(td, "config.json")
+	err := ioutil.WriteFile(fp, []byte(`{"service": {"name": "web", "prot": 80}}`), 0644)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	_, cmd := testValidateCommand(t)
+	if code := cmd.Run([]string{fp}); code != 0 {
+		t.Fatalf("bad: %d", code)
+	}
+
+	ui, cmd := testValidateCommand(t)
+	if code := cmd.Run([]string{"-config-strict", fp}); code != 1 {
+		t.Fatalf("bad: %d", code)
+	}
+	if out := ui.ErrorWriter.String(); !strings.Contains(out, "Config has invalid keys: service.prot") {
+		t.Fatalf("bad: %s", out)
+	}
+}
+
+func TestValidateCommandShowSources(t *testing.T) {
+	t.Parallel()
+	td := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(td)
+
+	a := filepath.Join(td, "a.json")
+	if err := ioutil.WriteFile(a, []byte(`{"datacenter": "dc2", "node_name": "a"}`), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	b := filepath.Join(td, "b.json")
+	if err := ioutil.WriteFile(b, []byte(`{"node_name": "b"}`), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	ui, cmd := testValidateCommand(t)
+	if code := cmd.Run([]string{"-show-sources", td}); code != 0 {
+		t.Fatalf("bad: %d: %s", code, ui.ErrorWriter.String())
+	}
+	want := "Load order:\n  1. " + a + "\n  2. " + b + "\n" +
+		"datacenter: " + a + "\nnode_name: " + b + "\nConfiguration is valid!\n"
+	if out := ui.OutputWriter.String(); out != want {
+		t.Fatalf("got %q want %q", out, want)
+	}
+}
+
+func TestValidateCommandReportsAllErrors(t *testing.T) {
+	t.Parallel()
+	td := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(td)
+
+	fp := filepath.Join(td, "config.json")
+	err := ioutil.WriteFile(fp, []byte(`{
+		"bootstrap": true,
+		"performance": {"raft_multiplier": 20},
+		"services": [{"id": "web", "name": "web"}, {"id": "web", "name": "web"}]
+	}`), 0644)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	ui, cmd := testValidateCommand(t)
+	if code := cmd.Run([]string{fp}); code != 1 {
+		t.Fatalf("bad: %d", code)
+	}
+	out := ui.ErrorWriter.String()
+	for _, want := range []string{
+		"WARNING: services[1] replaces services[0] with the same id \"web\"",
+		"Config validation failed with 2 errors:",
+		"Bootstrap mode cannot be enabled when server mode is not enabled (bootstrap set by '" + fp + "')",
+		"performance.raft_multiplier must be in range [1, 10], or 0 for the default (performance.raft_multiplier set by '" + fp + "')",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in %s", want, out)
+		}
+	}
+}
+
+func TestValidateCommandFailOnWarnings(t *testing.T) {
+	t.Parallel()
+	td := testutil.TempDir(t, "consul")
+	defer os.RemoveAll(td)
+
+	fp := filepath.Join(td, "config.json")
+	err := ioutil.WriteFile(fp, []byte(`{"services": [{"id": "web", "name": "web"}, {"id": "web", "name": "web"}]}`), 0644)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	_, cmd := testValidateCommand(t)
+	if code := cmd.Run([]string{fp}); code != 0 {
+		t.Fatalf("bad: %d", code)
+	}
+
+	ui, cmd := testValidateCommand(t)
+	if code := cmd.Run([]string{"-fail-on-warnings", fp}); code != 1 {
+		t.Fatalf("bad: %d", code)
+	}
+	if out := ui.ErrorWriter.String(); !strings.Contains(out, "Config validation failed: 1 warnings") {
+		t.Fatalf("bad: %s", out)
+	}
+}
@@ -0,0 +1,46 @@
+package logger
+
+import (
+	"github.com/hashicorp/logutils"
+)
+
+// eventLogID is the event id of all messages written to the Windows Event
+// Log.
+const eventLogID = 1
+
+// EventLogger writes messages to the Windows Event Log.
+type EventLogger interface {
+	Error(id uint32, msg string) error
+	Warning(id uint32, msg string) error
+	Info(id uint32, msg string) error
+}
+
+// EventLogWrapper is used to cleanup log messages before writing them to
+// the Windows Event Log. Implements the io.Writer interface.
+type EventLogWrapper struct {
+	l    EventLogger
+	filt *logutils.LevelFilter
+}
+
+// Write is used to implement io.Writer
+func (e *EventLogWrapper) Write(p []byte) (int, error) {
+	// Skip the event log if the log level doesn't apply
+	if !e.filt.Check(p) {
+		return 0, nil
+	}
+
+	// The event log only knows errors, warnings and informational
+	// messages.
+	level, afterLevel := splitLevel(p)
+	msg := string(afterLevel)
+	var err error
+	switch level {
+	case "ERR", "CRIT":
+		err = e.l.Error(eventLogID, msg)
+	case "WARN":
+		err = e.l.Warning(eventLogID, msg)
+	default:
+		err = e.l.Info(eventLogID, msg)
+	}
+	return len(p), err
+}
@@ -0,0 +1,43 @@
+package logger
+
+import (
+	"testing"
+
+	"github.com/hashicorp/logutils"
+	"github.com/pascaldekloe/goe/verify"
+)
+
+type testEventLogger struct {
+	events []string
+}
+
+func (l *testEventLogger) Error(id uint32, msg string) error {
+	l.events = append(l.events, "error: "+msg)
+	return nil
+}
+
+func (l *testEventLogger) Warning(id uint32, msg string) error {
+	l.events = append(l.events, "warning: "+msg)
+	return nil
+}
+
+func (l *testEventLogger) Info(id uint32, msg string) error {
+	l.events = append(l.events, "info: "+msg)
+	return nil
+}
+
+func TestEventLogFilter(t *testing.T) {
+	t.Parallel()
+	l := &testEventLogger{}
+	filt := LevelFilter()
+	filt.MinLevel = logutils.LogLevel("INFO")
+
+	e := &EventLogWrapper{l, filt}
+	for _, msg := range []string{"[DEBUG] a", "[INFO] b", "[WARN] c", "[ERR] d", "[CRIT] e"} {
+		if _, err := e.Write([]byte(msg)); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	want := []string{"info: b", "warning: c", "error: d", "error: e"}
+	verify.Values(t, "", l.events, want)
+}
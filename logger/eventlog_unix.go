@@ -0,0 +1,13 @@
+// +build !windows
+
+package logger
+
+import (
+	"fmt"
+)
+
+// NewEventLogger returns an error since the Windows Event Log is only
+// available on Windows.
+func NewEventLogger(source string) (EventLogger, error) {
+	return nil, fmt.Errorf("The Windows Event Log is only supported on Windows")
+}
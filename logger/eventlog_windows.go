@@ -0,0 +1,48 @@
+// +build windows
+
+package logger
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+// eventLog writes to the Windows Event Log through an event source.
+type eventLog struct {
+	handle windows.Handle
+}
+
+// NewEventLogger opens the event source with the given name. The source
+// should be registered, e.g. with the New-EventLog cmdlet, for the event
+// viewer to show the messages without a warning about missing descriptions.
+func NewEventLogger(source string) (EventLogger, error) {
+	name, err := windows.UTF16PtrFromString(source)
+	if err != nil {
+		return nil, err
+	}
+	h, err := windows.RegisterEventSource(nil, name)
+	if err != nil {
+		return nil, err
+	}
+	return &eventLog{handle: h}, nil
+}
+
+func (l *eventLog) report(etype uint16, id uint32, msg string) error {
+	s, err := windows.UTF16PtrFromString(msg)
+	if err != nil {
+		return err
+	}
+	ss := []*uint16{s}
+	return windows.ReportEvent(l.handle, etype, 0, id, 0, 1, 0, &ss[0], nil)
+}
+
+func (l *eventLog) Error(id uint32, msg string) error {
+	return l.report(windows.EVENTLOG_ERROR_TYPE, id, msg)
+}
+
+func (l *eventLog) Warning(id uint32, msg string) error {
+	return l.report(windows.EVENTLOG_WARNING_TYPE, id, msg)
+}
+
+func (l *eventLog) Info(id uint32, msg string) error {
+	return l.report(windows.EVENTLOG_INFORMATION_TYPE, id, msg)
+}
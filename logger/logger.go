@@ -21,6 +21,12 @@ type Config struct {
 
 	// SyslogFacility is the destination for syslog forwarding.
 	SyslogFacility string
+
+	// EnableEventLog controls forwarding to the Windows Event Log.
+	EnableEventLog bool
+
+	// EventLogSource is the event source the messages are written with.
+	EventLogSource string
 }
 
 // Setup is used to perform setup of several logging objects:
@@ -77,13 +83,26 @@ func Setup(config *Config, ui cli.Ui) (*logutils.LevelFilter, *GatedWriter, *Log
 		}
 	}
 
+	// Set up the Windows Event Log if it's enabled.
+	var eventlog io.Writer
+	if config.EnableEventLog {
+		l, err := NewEventLogger(config.EventLogSource)
+		if err != nil {
+			ui.Error(fmt.Sprintf("Event log setup error: %v", err))
+			return nil, nil, nil, nil, false
+		}
+		eventlog = &EventLogWrapper{l, logFilter}
+	}
+
 	// Create a log writer, and wrap a logOutput around it
 	logWriter := NewLogWriter(512)
-	var logOutput io.Writer
+	writers := []io.Writer{logFilter, logWriter}
 	if syslog != nil {
-		logOutput = io.MultiWriter(logFilter, logWriter, syslog)
-	} else {
-		logOutput = io.MultiWriter(logFilter, logWriter)
+		writers = append(writers, syslog)
+	}
+	if eventlog != nil {
+		writers = append(writers, eventlog)
 	}
+	logOutput := io.MultiWriter(writers...)
 	return logFilter, logGate, logWriter, logOutput, true
 }
@@ -34,16 +34,7 @@ func (s *SyslogWrapper) Write(p []byte) (int, error) {
 	}
 
 	// Extract log level
-	var level string
-	afterLevel := p
-	x := bytes.IndexByte(p, '[')
-	if x >= 0 {
-		y := bytes.IndexByte(p[x:], ']')
-		if y >= 0 {
-			level = string(p[x+1 : x+y])
-			afterLevel = p[x+y+2:]
-		}
-	}
+	level, afterLevel := splitLevel(p)
 
 	// Each log level will be handled by a specific syslog priority
 	priority, ok := levelPriority[level]
@@ -55,3 +46,16 @@ func (s *SyslogWrapper) Write(p []byte) (int, error) {
 	err := s.l.WriteLevel(priority, afterLevel)
 	return len(p), err
 }
+
+// splitLevel extracts the log level from a log message and returns it
+// together with the remainder of the message.
+func splitLevel(p []byte) (string, []byte) {
+	x := bytes.IndexByte(p, '[')
+	if x >= 0 {
+		y := bytes.IndexByte(p[x:], ']')
+		if y >= 0 {
+			return string(p[x+1 : x+y]), p[x+y+2:]
+		}
+	}
+	return "", p
+}
@@ -187,6 +187,45 @@ func (c *Config) OutgoingTLSConfig() (*tls.Config, error) {
 	return tlsConfig, nil
 }
 
+// ClientTLSConfig generates a TLS configuration for connections to
+// endpoints other than Consul servers, like the HTTPS endpoints of health
+// checks. Unlike OutgoingTLSConfig, the server certificate is always
+// verified, against the configured CAs or the system CAs if none are
+// configured, and ServerName is only used if set.
+func (c *Config) ClientTLSConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName: c.ServerName,
+	}
+	if len(c.CipherSuites) != 0 {
+		tlsConfig.CipherSuites = c.CipherSuites
+	}
+
+	rootConfig := &rootcerts.Config{
+		CAFile: c.CAFile,
+		CAPath: c.CAPath,
+	}
+	if err := rootcerts.ConfigureTLS(tlsConfig, rootConfig); err != nil {
+		return nil, err
+	}
+
+	cert, err := c.KeyPair()
+	if err != nil {
+		return nil, err
+	} else if cert != nil {
+		tlsConfig.Certificates = []tls.Certificate{*cert}
+	}
+
+	if c.TLSMinVersion != "" {
+		tlsvers, ok := TLSLookup[c.TLSMinVersion]
+		if !ok {
+			return nil, fmt.Errorf("TLSMinVersion: value %s not supported, please specify one of [tls10,tls11,tls12]", c.TLSMinVersion)
+		}
+		tlsConfig.MinVersion = tlsvers
+	}
+
+	return tlsConfig, nil
+}
+
 // Clone returns a copy of c. Only the exported fields are copied. This
 // was copied from https://golang.org/src/crypto/tls/common.go since that
 // isn't exported and Go 1.7's vet uncovered an unsafe copy of a mutex in
@@ -199,6 +199,44 @@ func TestConfig_OutgoingTLS_WithKeyPair(t *testing.T) {
 	}
 }
 
+func TestConfig_ClientTLS(t *testing.T) {
+	conf := &Config{
+		CAFile:        "../test/ca/root.cer",
+		CertFile:      "../test/key/ourdomain.cer",
+		KeyFile:       "../test/key/ourdomain.key",
+		ServerName:    "web.service.consul",
+		TLSMinVersion: "tls12",
+	}
+	tls, err := conf.ClientTLSConfig()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(tls.RootCAs.Subjects()) != 1 {
+		t.Fatalf("expect root cert")
+	}
+	if tls.InsecureSkipVerify {
+		t.Fatalf("should verify the server certificate")
+	}
+	if tls.ServerName != "web.service.consul" {
+		t.Fatalf("got server name %q", tls.ServerName)
+	}
+	if len(tls.Certificates) != 1 {
+		t.Fatalf("expected client cert")
+	}
+	if tls.MinVersion != TLSLookup["tls12"] {
+		t.Fatalf("got min version %x", tls.MinVersion)
+	}
+
+	// Without a CA the system CAs are used.
+	tls, err = (&Config{}).ClientTLSConfig()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if tls.RootCAs != nil || tls.InsecureSkipVerify || len(tls.Certificates) != 0 {
+		t.Fatalf("got %#v", tls)
+	}
+}
+
 func TestConfig_OutgoingTLS_TLSMinVersion(t *testing.T) {
 	tlsVersions := []string{"tls10", "tls11", "tls12"}
 	for _, version := range tlsVersions {